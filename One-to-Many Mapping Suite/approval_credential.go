@@ -0,0 +1,340 @@
+package mapping
+
+import (
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/asn1"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "net/url"
+    "sort"
+    "strings"
+    "time"
+)
+
+// -------------------------------
+//  审批证书（可验证凭证，JSON-LD）
+// -------------------------------
+
+// 凭证上下文与类型
+const (
+    credentialsContextV1 = "https://www.w3.org/2018/credentials/v1"
+    bimApprovalVocab     = "urn:bim:approval#"
+
+    ApprovalCredentialType = "BIMApprovalCredential"
+    // ApprovalProofType proof.jws 为对去掉 proof 的凭证规范化 JSON（见 CanonicalBytes）的分离式 JWS
+    ApprovalProofType = "CanonicalJsonDetachedJws"
+)
+
+// ApprovalCredential 已批准 / 已发布更新的可验证凭证，用于向业主、主管部门移交
+type ApprovalCredential struct {
+    Context           []interface{}    `json:"@context"`
+    ID                string           `json:"id"`
+    Type              []string         `json:"type"`
+    Issuer            string           `json:"issuer"`
+    IssuanceDate      string           `json:"issuanceDate"`
+    CredentialSubject ApprovalSubject  `json:"credentialSubject"`
+    Proof             *CredentialProof `json:"proof,omitempty"`
+}
+
+// ApprovalSubject 凭证主体：链上锚定的更新、文件指纹与审批人
+type ApprovalSubject struct {
+    ID           string `json:"id"` // urn:bim:update:<UpdateID>
+    UpdateID     string `json:"updateId"`
+    ModelID      string `json:"modelId"`
+    Version      string `json:"version"`
+    Status       string `json:"status"`
+    TxID         string `json:"txId"` // InitBIMUpdate 交易
+    Channel      string `json:"channel,omitempty"`
+    Initiator    string `json:"initiator"`
+    InitiatorMSP string `json:"initiatorMsp,omitempty"`
+
+    Files              []CredentialFile     `json:"files,omitempty"`
+    ChangeManifestRoot string               `json:"changeManifestRoot,omitempty"`
+    Approvers          []CredentialApprover `json:"approvers"`
+
+    // VerificationURL 扫码核验地址，打印为二维码附在移交文件上
+    VerificationURL string `json:"verificationUrl,omitempty"`
+}
+
+// CredentialFile 更新锚定的文件
+type CredentialFile struct {
+    Name          string `json:"name"`
+    CID           string `json:"cid"`
+    SHA256        string `json:"sha256"`
+    HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+    Digest        string `json:"digest,omitempty"`
+}
+
+// CredentialApprover 审批人及其签名提案的证书信息
+type CredentialApprover struct {
+    Approver    string `json:"approver"`
+    MSPID       string `json:"mspId"`
+    CertSubject string `json:"certSubject"`
+    CertIssuer  string `json:"certIssuer"`
+    CertSerial  string `json:"certSerial"`
+    TxID        string `json:"txId"`
+    ApprovedAt  string `json:"approvedAt"`
+}
+
+// CredentialProof 签发方签名
+type CredentialProof struct {
+    Type               string `json:"type"`
+    Created            string `json:"created"`
+    VerificationMethod string `json:"verificationMethod"`
+    ProofPurpose       string `json:"proofPurpose"`
+    JWS                string `json:"jws"`
+}
+
+// CredentialRequest 生成审批证书的输入
+type CredentialRequest struct {
+    Record *LedgerRecord
+    // Approvals 全部审批记录（多人会签时），为空时使用 Record.Approval
+    Approvals []*LedgerApproval
+    Channel   string
+
+    // Issuer 签发方 URI（如 did:web:... 或机构网址）
+    Issuer string
+    // VerificationMethod 签名公钥的标识，核验方据此获取公钥；为空时使用 Issuer
+    VerificationMethod string
+    // VerifyBaseURL 核验服务地址，为空时不生成核验链接
+    VerifyBaseURL string
+}
+
+// IssueApprovalCredential 为已批准 / 已发布的更新签发审批证书。
+// 签名者为 ECDSA P-256（ES256）或 RSA（RS256）密钥，例如 SigningIdentity。
+func IssueApprovalCredential(req *CredentialRequest, signer crypto.Signer) (*ApprovalCredential, error) {
+    if req == nil || signer == nil {
+        return nil, errors.New("证书请求或签名者为空")
+    }
+    rec := req.Record
+    if rec == nil || rec.InitRecord == nil {
+        return nil, errors.New("更新记录为空")
+    }
+    if req.Issuer == "" {
+        return nil, errors.New("Issuer 不能为空")
+    }
+    update := rec.InitRecord
+    if update.Status != bundleApproved && update.Status != bundleStatusPublished {
+        return nil, fmt.Errorf("更新 %s 状态为 %s，只能为已批准或已发布的更新签发证书", update.UpdateID, update.Status)
+    }
+
+    approvals := req.Approvals
+    if len(approvals) == 0 {
+        if err := DefaultApprovalVerifier(rec); err != nil {
+            return nil, err
+        }
+        approvals = []*LedgerApproval{rec.Approval}
+    }
+    subject := ApprovalSubject{
+        ID:        "urn:bim:update:" + update.UpdateID,
+        UpdateID:  update.UpdateID,
+        ModelID:   update.ModelID,
+        Version:   update.Version,
+        Status:    update.Status,
+        Channel:   req.Channel,
+        Initiator: update.Initiator,
+    }
+    if sig, ok := update.Signatures[update.Initiator]; ok {
+        subject.TxID = sig.TxID
+        subject.InitiatorMSP = sig.MSPID
+    }
+    if subject.TxID == "" {
+        return nil, fmt.Errorf("更新 %s 缺少发起人的签名提案", update.UpdateID)
+    }
+    for _, att := range update.anchoredFiles() {
+        subject.Files = append(subject.Files, CredentialFile{
+            Name:          att.Name,
+            CID:           att.CID,
+            SHA256:        att.SHA256,
+            HashAlgorithm: att.HashAlgorithm,
+            Digest:        att.Digest,
+        })
+    }
+    if update.ChangeManifest != nil {
+        subject.ChangeManifestRoot = update.ChangeManifest.RootHash
+    }
+    for _, appr := range approvals {
+        approver, err := credentialApprover(update, appr)
+        if err != nil {
+            return nil, err
+        }
+        subject.Approvers = append(subject.Approvers, *approver)
+    }
+    sort.Slice(subject.Approvers, func(i, j int) bool { return subject.Approvers[i].ApprovedAt < subject.Approvers[j].ApprovedAt })
+    if req.VerifyBaseURL != "" {
+        subject.VerificationURL = strings.TrimRight(req.VerifyBaseURL, "/") + "/" + url.PathEscape(update.UpdateID) +
+            "?" + url.Values{"tx": {subject.TxID}}.Encode()
+    }
+
+    now := time.Now().UTC().Format(time.RFC3339)
+    cred := &ApprovalCredential{
+        Context:           []interface{}{credentialsContextV1, map[string]string{"@vocab": bimApprovalVocab}},
+        ID:                "urn:bim:credential:" + update.UpdateID + ":" + subject.TxID,
+        Type:              []string{"VerifiableCredential", ApprovalCredentialType},
+        Issuer:            req.Issuer,
+        IssuanceDate:      now,
+        CredentialSubject: subject,
+    }
+    method := req.VerificationMethod
+    if method == "" {
+        method = req.Issuer
+    }
+    cred.Proof = &CredentialProof{
+        Type:               ApprovalProofType,
+        Created:            now,
+        VerificationMethod: method,
+        ProofPurpose:       "assertionMethod",
+    }
+    jws, err := signDetachedJWS(cred, signer)
+    if err != nil {
+        return nil, err
+    }
+    cred.Proof.JWS = jws
+    return cred, nil
+}
+
+// VerifyApprovalCredential 解析凭证并用签发方公钥校验签名。
+// 公钥须由核验方根据 proof.verificationMethod 从可信渠道获取；链上记录仍应按 VerificationURL 另行核对。
+func VerifyApprovalCredential(data []byte, pub crypto.PublicKey) (*ApprovalCredential, error) {
+    var cred ApprovalCredential
+    if err := json.Unmarshal(data, &cred); err != nil {
+        return nil, fmt.Errorf("凭证解析失败: %v", err)
+    }
+    if cred.Proof == nil || cred.Proof.JWS == "" {
+        return nil, errors.New("凭证未签名")
+    }
+    if cred.Proof.Type != ApprovalProofType {
+        return nil, fmt.Errorf("不支持的签名类型 %s", cred.Proof.Type)
+    }
+    parts := strings.Split(cred.Proof.JWS, ".")
+    if len(parts) != 3 || parts[1] != "" {
+        return nil, errors.New("签名格式错误")
+    }
+    var header struct {
+        Alg string `json:"alg"`
+    }
+    if err := decodeSegment(parts[0], &header); err != nil {
+        return nil, fmt.Errorf("解析签名头失败: %v", err)
+    }
+    sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, fmt.Errorf("签名编码错误: %v", err)
+    }
+    digest, err := credentialSigningDigest(&cred, parts[0])
+    if err != nil {
+        return nil, err
+    }
+    switch k := pub.(type) {
+    case *ecdsa.PublicKey:
+        if header.Alg != "ES256" || len(sig) != 64 ||
+            !ecdsa.Verify(k, digest, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+            return nil, errors.New("凭证签名无效")
+        }
+    case *rsa.PublicKey:
+        if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig) != nil {
+            return nil, errors.New("凭证签名无效")
+        }
+    default:
+        return nil, fmt.Errorf("不支持的公钥类型 %T", pub)
+    }
+    return &cred, nil
+}
+
+// VerifyApprovalCredentialCert 同 VerifyApprovalCredential，公钥取自签发方证书
+func VerifyApprovalCredentialCert(data []byte, cert *x509.Certificate) (*ApprovalCredential, error) {
+    if cert == nil {
+        return nil, errors.New("签发方证书为空")
+    }
+    return VerifyApprovalCredential(data, cert.PublicKey)
+}
+
+// credentialApprover 校验一条审批记录属于该更新且留有签名凭证
+func credentialApprover(update *LedgerUpdate, appr *LedgerApproval) (*CredentialApprover, error) {
+    if appr == nil {
+        return nil, fmt.Errorf("更新 %s 的审批记录为空", update.UpdateID)
+    }
+    if appr.ApproveResult != bundleApproved {
+        return nil, fmt.Errorf("审批人 %s 的审批结果为 %s", appr.Approver, appr.ApproveResult)
+    }
+    if appr.UpdateID != update.UpdateID || appr.ModelID != update.ModelID || appr.Version != update.Version {
+        return nil, fmt.Errorf("审批人 %s 的审批记录与更新 %s 不一致", appr.Approver, update.UpdateID)
+    }
+    sig, ok := appr.Proof[appr.Approver]
+    if !ok || sig.Signature == "" {
+        return nil, fmt.Errorf("更新 %s 缺少审批人 %s 的签名", update.UpdateID, appr.Approver)
+    }
+    return &CredentialApprover{
+        Approver:    appr.Approver,
+        MSPID:       sig.MSPID,
+        CertSubject: sig.CertSubject,
+        CertIssuer:  sig.CertIssuer,
+        CertSerial:  sig.CertSerial,
+        TxID:        sig.TxID,
+        ApprovedAt:  appr.Timestamp,
+    }, nil
+}
+
+// signDetachedJWS 对凭证签名，返回 "<header>..<signature>"
+func signDetachedJWS(cred *ApprovalCredential, signer crypto.Signer) (string, error) {
+    var alg string
+    switch signer.Public().(type) {
+    case *ecdsa.PublicKey:
+        alg = "ES256"
+    case *rsa.PublicKey:
+        alg = "RS256"
+    default:
+        return "", fmt.Errorf("不支持的公钥类型 %T", signer.Public())
+    }
+    headerJSON, err := json.Marshal(map[string]interface{}{"alg": alg, "b64": false, "crit": []string{"b64"}})
+    if err != nil {
+        return "", err
+    }
+    header := base64.RawURLEncoding.EncodeToString(headerJSON)
+    digest, err := credentialSigningDigest(cred, header)
+    if err != nil {
+        return "", err
+    }
+    sig, err := signer.Sign(rand.Reader, digest, crypto.SHA256)
+    if err != nil {
+        return "", fmt.Errorf("凭证签名失败: %v", err)
+    }
+    if alg == "ES256" {
+        // JWS 使用定长 r||s，而 crypto.Signer 返回 ASN.1
+        var rs struct{ R, S *big.Int }
+        if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+            return "", fmt.Errorf("解析 ECDSA 签名失败: %v", err)
+        }
+        raw := make([]byte, 64)
+        rs.R.FillBytes(raw[:32])
+        rs.S.FillBytes(raw[32:])
+        sig = raw
+    }
+    return header + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// credentialSigningDigest 计算 JWS 签名输入 "<header>.<规范化凭证>" 的 SHA-256，
+// 规范化凭证不含 proof.jws
+func credentialSigningDigest(cred *ApprovalCredential, header string) ([]byte, error) {
+    unsigned := *cred
+    if cred.Proof != nil {
+        proof := *cred.Proof
+        proof.JWS = ""
+        unsigned.Proof = &proof
+    }
+    canonical, err := canonicalJSON(&unsigned)
+    if err != nil {
+        return nil, fmt.Errorf("凭证序列化失败: %v", err)
+    }
+    h := sha256.New()
+    h.Write([]byte(header + "."))
+    h.Write(canonical)
+    return h.Sum(nil), nil
+}
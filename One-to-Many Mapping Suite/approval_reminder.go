@@ -0,0 +1,196 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  审批提醒与超时升级
+// -------------------------------
+
+// LeadDirectory 查询模型的 BIM 负责人（role=bim_lead），审批超时后通知
+type LeadDirectory interface {
+    BIMLeads(modelID string) ([]Recipient, error)
+}
+
+// PendingApproval 一个待审批（INITIALIZED）的更新
+type PendingApproval struct {
+    UpdateID  string    `json:"updateId"`
+    ModelID   string    `json:"modelId"`
+    Version   string    `json:"version"`
+    Since     time.Time `json:"since"`
+    Reminded  bool      `json:"reminded"`
+    Escalated bool      `json:"escalated"`
+}
+
+// ReminderScheduler 跟踪待审批的更新：超过 RemindAfter 提醒审批人，超过 EscalateAfter 通知 BIM 负责人。
+// 与 Dispatcher 一样由事件监听服务调用 HandleEvent；服务重启后重放事件即可恢复状态，
+// 等待时长按链上记录的提交时间计算。
+type ReminderScheduler struct {
+    Dispatcher *Dispatcher
+    Leads      LeadDirectory
+
+    RemindAfter   time.Duration // 默认 24 小时
+    EscalateAfter time.Duration // 默认 72 小时
+    Interval      time.Duration // 扫描间隔，默认 10 分钟
+
+    // Now 当前时间，默认 time.Now
+    Now func() time.Time
+
+    mu      sync.Mutex
+    pending map[string]*pendingEntry
+
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+type pendingEntry struct {
+    PendingApproval
+    txID   string
+    update LedgerUpdate
+}
+
+// NewReminderScheduler 创建提醒调度器，通知经 dispatcher 投递
+func NewReminderScheduler(dispatcher *Dispatcher, leads LeadDirectory) *ReminderScheduler {
+    return &ReminderScheduler{
+        Dispatcher:    dispatcher,
+        Leads:         leads,
+        RemindAfter:   24 * time.Hour,
+        EscalateAfter: 72 * time.Hour,
+        Interval:      10 * time.Minute,
+        Now:           time.Now,
+        pending:       map[string]*pendingEntry{},
+    }
+}
+
+// Start 启动定期扫描，直到 ctx 取消或调用 Stop
+func (s *ReminderScheduler) Start(ctx context.Context) {
+    ctx, s.cancel = context.WithCancel(ctx)
+    s.wg.Add(1)
+    go func() {
+        defer s.wg.Done()
+        ticker := time.NewTicker(s.Interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                s.Tick()
+            }
+        }
+    }()
+}
+
+// Stop 停止扫描
+func (s *ReminderScheduler) Stop() {
+    if s.cancel != nil {
+        s.cancel()
+    }
+    s.wg.Wait()
+}
+
+// HandleEvent 新更新开始跟踪；审批、驳回、发布事件结束跟踪；其他事件忽略
+func (s *ReminderScheduler) HandleEvent(eventName string, txID string, payload []byte) error {
+    switch eventName {
+    case EventBIMInit:
+        var u LedgerUpdate
+        if err := json.Unmarshal(payload, &u); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        since, err := time.Parse(time.RFC3339, u.Timestamp)
+        if err != nil {
+            since = s.Now()
+        }
+        s.mu.Lock()
+        s.pending[u.UpdateID] = &pendingEntry{
+            PendingApproval: PendingApproval{UpdateID: u.UpdateID, ModelID: u.ModelID, Version: u.Version, Since: since},
+            txID:            txID,
+            update:          u,
+        }
+        s.mu.Unlock()
+    case EventBIMApprove, EventBIMReject:
+        var a LedgerApproval
+        if err := json.Unmarshal(payload, &a); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        s.resolve(a.UpdateID)
+    case EventBIMPublish:
+        var u LedgerUpdate
+        if err := json.Unmarshal(payload, &u); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        s.resolve(u.UpdateID)
+    }
+    return nil
+}
+
+func (s *ReminderScheduler) resolve(updateID string) {
+    s.mu.Lock()
+    delete(s.pending, updateID)
+    s.mu.Unlock()
+}
+
+// Tick 检查一次所有待审批更新并发送到期的提醒与升级通知；通常由 Start 定期调用
+func (s *ReminderScheduler) Tick() {
+    now := s.Now()
+    s.mu.Lock()
+    var remind, escalate []*pendingEntry
+    for _, p := range s.pending {
+        waiting := now.Sub(p.Since)
+        if !p.Reminded && waiting >= s.RemindAfter {
+            p.Reminded = true
+            remind = append(remind, p)
+        }
+        if !p.Escalated && waiting >= s.EscalateAfter {
+            p.Escalated = true
+            escalate = append(escalate, p)
+        }
+    }
+    s.mu.Unlock()
+
+    for _, p := range remind {
+        approvers, err := s.Dispatcher.Directory.Approvers(p.ModelID)
+        s.notify(NoticeApprovalReminder, p, now, approvers, err)
+    }
+    for _, p := range escalate {
+        if s.Leads == nil {
+            continue
+        }
+        leads, err := s.Leads.BIMLeads(p.ModelID)
+        s.notify(NoticeApprovalEscalation, p, now, leads, err)
+    }
+}
+
+// notify 发送提醒或升级通知；失败只记录日志，不再重复提醒
+func (s *ReminderScheduler) notify(kind string, p *pendingEntry, now time.Time, recipients []Recipient, lookupErr error) {
+    log := txLog(p.txID).With("updateId", p.UpdateID, "notice", kind)
+    if lookupErr != nil {
+        log.Error("查询收件人失败", "err", lookupErr)
+        return
+    }
+    update := p.update
+    data := &TemplateData{TxID: p.txID, Update: &update, Waiting: now.Sub(p.Since).Round(time.Minute)}
+    if err := s.Dispatcher.Notify(kind, data, recipients); err != nil {
+        log.Error("发送通知失败", "err", err)
+        return
+    }
+    log.Info("已发送审批通知", "recipients", len(recipients))
+}
+
+// Pending 返回所有待审批更新（按提交时间排序的副本）
+func (s *ReminderScheduler) Pending() []PendingApproval {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := make([]PendingApproval, 0, len(s.pending))
+    for _, p := range s.pending {
+        out = append(out, p.PendingApproval)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Since.Before(out[j].Since) })
+    return out
+}
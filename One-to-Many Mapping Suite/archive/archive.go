@@ -0,0 +1,329 @@
+// Package archive 将已完结项目的链上记录（更新、审批及其签名凭证、评论、申诉等）导出为
+// 自校验的归档文件，满足通道下线后的文档留存要求。
+//
+// 归档为 JSON Lines：首行为头部，随后每行一条记录，末行为尾部。尾部记录记录数、
+// 各记录行 SHA-256 的 Merkle 根，以及导出者对（头部哈希 || 根哈希）的签名和签名证书，
+// 因此无需访问账本即可用 Verify 校验归档未被篡改。
+package archive
+
+import (
+    "bufio"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "io"
+    "time"
+)
+
+// -------------------------------
+//  归档格式
+// -------------------------------
+
+// Format 当前归档格式版本
+const Format = "bim-archive/1"
+
+// 行类型
+const (
+    lineHeader  = "header"
+    lineRecord  = "record"
+    lineTrailer = "trailer"
+)
+
+// maxLineBytes 单行上限，链码单条记录远小于此值
+const maxLineBytes = 16 << 20
+
+// Header 归档头部
+type Header struct {
+    Type      string `json:"type"`
+    Format    string `json:"format"`
+    ProjectID string `json:"projectId"`
+    Channel   string `json:"channel"`
+    Chaincode string `json:"chaincode"`
+    CreatedAt string `json:"createdAt"` // RFC3339
+}
+
+// Record 一条链上记录，与链码 ExportedRecord 对应
+type Record struct {
+    Type       string          `json:"type"`
+    Seq        int             `json:"seq"`
+    ObjectType string          `json:"objectType,omitempty"` // 为空表示仍以 UpdateID 为键的旧版 BIMUpdate
+    Attrs      []string        `json:"attrs"`
+    Value      json.RawMessage `json:"value"` // 账本中存储的原始 JSON
+}
+
+// Trailer 归档尾部
+type Trailer struct {
+    Type       string `json:"type"`
+    Count      int    `json:"count"`
+    HeaderHash string `json:"headerHash"` // 头部行的 SHA-256
+    RootHash   string `json:"rootHash"`   // 记录行 SHA-256 的 Merkle 根，奇数层复制最后一个节点，无记录时为 sha256("")
+    SignerCert string `json:"signerCert"` // PEM 证书
+    Signature  string `json:"signature"`  // base64，签名对象为 sha256(headerHash || rootHash)
+}
+
+// -------------------------------
+//  写入
+// -------------------------------
+
+// Writer 逐条写入记录，Close 时写入签名尾部
+type Writer struct {
+    w          *bufio.Writer
+    headerHash []byte
+    leaves     [][]byte
+    closed     bool
+}
+
+// NewWriter 写入头部并返回 Writer；header.Type、Format 与空的 CreatedAt 会自动填写
+func NewWriter(out io.Writer, header Header) (*Writer, error) {
+    header.Type = lineHeader
+    header.Format = Format
+    if header.CreatedAt == "" {
+        header.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+    }
+    w := &Writer{w: bufio.NewWriter(out)}
+    line, err := w.writeLine(header)
+    if err != nil {
+        return nil, err
+    }
+    sum := sha256.Sum256(line)
+    w.headerHash = sum[:]
+    return w, nil
+}
+
+// Add 写入一条记录；value 必须是合法 JSON
+func (w *Writer) Add(objectType string, attrs []string, value []byte) error {
+    if w.closed {
+        return errors.New("归档已关闭")
+    }
+    if !json.Valid(value) {
+        return fmt.Errorf("记录 %s %v 不是合法 JSON", objectType, attrs)
+    }
+    if attrs == nil {
+        attrs = []string{}
+    }
+    line, err := w.writeLine(Record{Type: lineRecord, Seq: len(w.leaves), ObjectType: objectType, Attrs: attrs, Value: value})
+    if err != nil {
+        return err
+    }
+    sum := sha256.Sum256(line)
+    w.leaves = append(w.leaves, sum[:])
+    return nil
+}
+
+// Close 用 signer 对归档签名并写入尾部；certPEM 为 signer 对应的 X.509 证书
+func (w *Writer) Close(signer crypto.Signer, certPEM []byte) (*Trailer, error) {
+    if w.closed {
+        return nil, errors.New("归档已关闭")
+    }
+    w.closed = true
+    root := merkleRoot(w.leaves)
+    sig, err := signer.Sign(rand.Reader, signedDigest(w.headerHash, root), crypto.SHA256)
+    if err != nil {
+        return nil, fmt.Errorf("归档签名失败: %v", err)
+    }
+    t := &Trailer{
+        Type:       lineTrailer,
+        Count:      len(w.leaves),
+        HeaderHash: hex.EncodeToString(w.headerHash),
+        RootHash:   hex.EncodeToString(root),
+        SignerCert: string(certPEM),
+        Signature:  base64.StdEncoding.EncodeToString(sig),
+    }
+    if _, err := w.writeLine(t); err != nil {
+        return nil, err
+    }
+    if err := w.w.Flush(); err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// writeLine 序列化 v 并写入一行，返回不含换行符的行内容
+func (w *Writer) writeLine(v interface{}) ([]byte, error) {
+    line, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    if len(line) > maxLineBytes {
+        return nil, fmt.Errorf("归档行超过上限 %d 字节", maxLineBytes)
+    }
+    if _, err := w.w.Write(append(line, '\n')); err != nil {
+        return nil, err
+    }
+    return line, nil
+}
+
+// -------------------------------
+//  校验
+// -------------------------------
+
+// Summary 校验通过的归档概要
+type Summary struct {
+    Header   Header
+    Trailer  Trailer
+    Signer   *x509.Certificate // 调用方应再核对签名证书是否由可信 CA 签发
+    Counts   map[string]int    // objectType -> 记录数，旧版 BIMUpdate 记为 ""
+    Verified time.Time
+}
+
+// Verify 读取整个归档，重新计算 Merkle 根并校验尾部签名；
+// each 不为空时对每条记录调用一次（如导入只读数据库），返回错误则中止校验
+func Verify(r io.Reader, each func(*Record) error) (*Summary, error) {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64<<10), maxLineBytes+1)
+
+    s := &Summary{Counts: map[string]int{}}
+    var headerHash []byte
+    var leaves [][]byte
+    var trailer *Trailer
+    for n := 0; scanner.Scan(); n++ {
+        line := scanner.Bytes()
+        if trailer != nil {
+            return nil, fmt.Errorf("第 %d 行：尾部之后仍有内容", n+1)
+        }
+        var kind struct {
+            Type string `json:"type"`
+        }
+        if err := json.Unmarshal(line, &kind); err != nil {
+            return nil, fmt.Errorf("第 %d 行：解析失败: %v", n+1, err)
+        }
+        sum := sha256.Sum256(line)
+        switch {
+        case n == 0:
+            if kind.Type != lineHeader {
+                return nil, errors.New("第 1 行不是归档头部")
+            }
+            if err := json.Unmarshal(line, &s.Header); err != nil {
+                return nil, fmt.Errorf("解析头部失败: %v", err)
+            }
+            if s.Header.Format != Format {
+                return nil, fmt.Errorf("不支持的归档格式 %q", s.Header.Format)
+            }
+            headerHash = sum[:]
+        case kind.Type == lineRecord:
+            var rec Record
+            if err := json.Unmarshal(line, &rec); err != nil {
+                return nil, fmt.Errorf("第 %d 行：解析记录失败: %v", n+1, err)
+            }
+            if rec.Seq != len(leaves) {
+                return nil, fmt.Errorf("第 %d 行：记录序号为 %d，应为 %d", n+1, rec.Seq, len(leaves))
+            }
+            leaves = append(leaves, sum[:])
+            s.Counts[rec.ObjectType]++
+            if each != nil {
+                if err := each(&rec); err != nil {
+                    return nil, err
+                }
+            }
+        case kind.Type == lineTrailer:
+            trailer = &Trailer{}
+            if err := json.Unmarshal(line, trailer); err != nil {
+                return nil, fmt.Errorf("解析尾部失败: %v", err)
+            }
+        default:
+            return nil, fmt.Errorf("第 %d 行：未知行类型 %q", n+1, kind.Type)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("读取归档失败: %v", err)
+    }
+    if headerHash == nil {
+        return nil, errors.New("归档为空")
+    }
+    if trailer == nil {
+        return nil, errors.New("归档缺少尾部，可能被截断")
+    }
+
+    root := merkleRoot(leaves)
+    if trailer.Count != len(leaves) {
+        return nil, fmt.Errorf("尾部记录数为 %d，实际为 %d", trailer.Count, len(leaves))
+    }
+    if trailer.HeaderHash != hex.EncodeToString(headerHash) {
+        return nil, errors.New("头部哈希与尾部不符")
+    }
+    if trailer.RootHash != hex.EncodeToString(root) {
+        return nil, fmt.Errorf("Merkle 根不匹配: 计算得 %s，尾部为 %s", hex.EncodeToString(root), trailer.RootHash)
+    }
+    cert, err := parseCert(trailer.SignerCert)
+    if err != nil {
+        return nil, err
+    }
+    sig, err := base64.StdEncoding.DecodeString(trailer.Signature)
+    if err != nil {
+        return nil, fmt.Errorf("签名编码无效: %v", err)
+    }
+    if err := verifySignature(cert.PublicKey, signedDigest(headerHash, root), sig); err != nil {
+        return nil, err
+    }
+    s.Trailer = *trailer
+    s.Signer = cert
+    s.Verified = time.Now().UTC()
+    return s, nil
+}
+
+// signedDigest 签名对象：sha256(headerHash || rootHash)
+func signedDigest(headerHash, root []byte) []byte {
+    sum := sha256.Sum256(append(append([]byte{}, headerHash...), root...))
+    return sum[:]
+}
+
+func parseCert(certPEM string) (*x509.Certificate, error) {
+    block, _ := pem.Decode([]byte(certPEM))
+    if block == nil || block.Type != "CERTIFICATE" {
+        return nil, errors.New("尾部缺少签名证书")
+    }
+    cert, err := x509.ParseCertificate(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("解析签名证书失败: %v", err)
+    }
+    return cert, nil
+}
+
+func verifySignature(pub crypto.PublicKey, digest, sig []byte) error {
+    ok := false
+    switch key := pub.(type) {
+    case *ecdsa.PublicKey:
+        ok = ecdsa.VerifyASN1(key, digest, sig)
+    case *rsa.PublicKey:
+        ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) == nil
+    case ed25519.PublicKey:
+        ok = ed25519.Verify(key, digest, sig)
+    default:
+        return fmt.Errorf("不支持的签名公钥类型 %T", pub)
+    }
+    if !ok {
+        return errors.New("归档签名无效")
+    }
+    return nil
+}
+
+// merkleRoot 与 manifest 包相同的构造：奇数层复制最后一个节点，无叶子时为 sha256("")
+func merkleRoot(leaves [][]byte) []byte {
+    if len(leaves) == 0 {
+        sum := sha256.Sum256(nil)
+        return sum[:]
+    }
+    level := leaves
+    for len(level) > 1 {
+        if len(level)%2 == 1 {
+            level = append(level[:len(level):len(level)], level[len(level)-1])
+        }
+        next := make([][]byte, 0, len(level)/2)
+        for i := 0; i < len(level); i += 2 {
+            sum := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+            next = append(next, sum[:])
+        }
+        level = next
+    }
+    return level[0]
+}
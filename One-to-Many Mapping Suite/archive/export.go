@@ -0,0 +1,83 @@
+package archive
+
+import (
+    "context"
+    "crypto"
+    "fmt"
+)
+
+// -------------------------------
+//  从账本导出
+// -------------------------------
+
+// ObjectTypes 归档包含的链上记录类型，与链码 archivableObjectTypes 一致；"" 为仍以 UpdateID 为键的旧版 BIMUpdate
+var ObjectTypes = []string{
+    "",
+    "BIMUpdate",
+    "BIMApproval",
+    "BIMApprovalVote",
+    "BIMApprovalPolicy",
+    "BIMComment",
+    "BIMAppeal",
+    "BIMReviewerAssignment",
+    "BIMModel",
+    "BIMBaseline",
+    "BIMRollback",
+    "BIMBlocker",
+    "BIMDeviation",
+    "BCFIssue",
+    "BIMAccessLog",
+    "BIMComponentPackage",
+    "BIMUpdateTags",
+    "BIMValidationResult",
+    "BIMNetworkConfig",
+    "BIMModelWatch",
+    "BIMRoleGrant",
+    "BIMResponsibility",
+    "BIMModelLock",
+}
+
+// Page 链码 ExportRecords 的一页结果
+type Page struct {
+    Records []struct {
+        ObjectType string   `json:"ObjectType"`
+        Attrs      []string `json:"Attrs"`
+        Value      string   `json:"Value"`
+    } `json:"Records"`
+    FetchedCount int32  `json:"FetchedCount"`
+    Bookmark     string `json:"Bookmark"`
+}
+
+// Source 分页读取链上记录，由 Fabric Gateway / SDK 适配实现（以 admin 身份查询 ExportRecords）
+type Source interface {
+    ExportRecords(ctx context.Context, objectType string, pageSize int32, bookmark string) (*Page, error)
+}
+
+// DefaultPageSize 每次查询的记录数
+const DefaultPageSize = 200
+
+// Export 按 ObjectTypes 顺序导出全部记录到 w 并签名，返回尾部
+func Export(ctx context.Context, src Source, w *Writer, signer crypto.Signer, certPEM []byte) (*Trailer, error) {
+    for _, objectType := range ObjectTypes {
+        bookmark := ""
+        for {
+            if err := ctx.Err(); err != nil {
+                return nil, err
+            }
+            page, err := src.ExportRecords(ctx, objectType, DefaultPageSize, bookmark)
+            if err != nil {
+                return nil, fmt.Errorf("导出 %q 记录失败: %v", objectType, err)
+            }
+            for _, rec := range page.Records {
+                if err := w.Add(rec.ObjectType, rec.Attrs, []byte(rec.Value)); err != nil {
+                    return nil, err
+                }
+            }
+            if page.FetchedCount < DefaultPageSize || page.Bookmark == "" {
+                break
+            }
+            bookmark = page.Bookmark
+        }
+    }
+    return w.Close(signer, certPEM)
+}
@@ -0,0 +1,60 @@
+package bcf
+
+import (
+    "encoding/json"
+)
+
+// -------------------------------
+//  链上锚定
+// -------------------------------
+
+// Issue 链上 BCFIssue 的镜像（见 Smart Contract Group/bim_bcf_contract.go）
+type Issue struct {
+    TopicGUID       string   `json:"TopicGUID"`
+    Title           string   `json:"Title"`
+    Status          string   `json:"Status"`
+    Priority        string   `json:"Priority,omitempty"`
+    AssignedTo      string   `json:"AssignedTo,omitempty"`
+    TopicHash       string   `json:"TopicHash"`
+    ViewpointHashes []string `json:"ViewpointHashes"`
+    Open            bool     `json:"Open"`
+
+    // 以下字段由链码填写
+    ModelID    string `json:"ModelID,omitempty"`
+    Version    string `json:"Version,omitempty"`
+    UpdateID   string `json:"UpdateID,omitempty"`
+    SourceCID  string `json:"SourceCID,omitempty"`
+    AnchoredBy string `json:"AnchoredBy,omitempty"`
+    AnchoredAt string `json:"AnchoredAt,omitempty"`
+}
+
+// Issues 将议题转换为链上记录（Open 由链码按 Status 重新判断）
+func (a *Archive) Issues() []Issue {
+    issues := make([]Issue, 0, len(a.Topics))
+    for _, t := range a.Topics {
+        hashes := make([]string, 0, len(t.Viewpoints))
+        for _, vp := range t.Viewpoints {
+            hashes = append(hashes, vp.Hash)
+        }
+        issues = append(issues, Issue{
+            TopicGUID:       t.GUID,
+            Title:           t.Title,
+            Status:          t.Status,
+            Priority:        t.Priority,
+            AssignedTo:      t.AssignedTo,
+            TopicHash:       t.Hash,
+            ViewpointHashes: hashes,
+            Open:            t.IsOpen(),
+        })
+    }
+    return issues
+}
+
+// AnchorArgs 生成 AnchorBCFIssues 的参数：updateID、BCFzip 在 IPFS 上的 CID 与议题 JSON
+func (a *Archive) AnchorArgs(updateID string, sourceCID string) ([]string, error) {
+    data, err := json.Marshal(a.Issues())
+    if err != nil {
+        return nil, err
+    }
+    return []string{updateID, sourceCID, string(data)}, nil
+}
@@ -0,0 +1,256 @@
+// Package bcf 解析 BCFzip（BIM Collaboration Format 2.1 / 3.0）问题包，提取议题（topic）与视点（viewpoint）
+// 并计算其哈希。哈希随 UpdateID 锚定到链上（BCFContract.AnchorBCFIssues），
+// 审批人可按模型版本查询仍未关闭的议题，未关闭的议题会阻止更新发布。
+package bcf
+
+import (
+    "archive/zip"
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "path"
+    "sort"
+    "strings"
+)
+
+// -------------------------------
+//  BCFzip 解析
+// -------------------------------
+
+// MaxEntryBytes 单个压缩包条目的解压上限，防止压缩炸弹
+const MaxEntryBytes = 64 << 20
+
+// Archive 一个 BCFzip 问题包
+type Archive struct {
+    Version string   `json:"version"` // bcf.version 中的 VersionId，如 2.1 / 3.0
+    Topics  []*Topic `json:"topics"`  // 按 GUID 排序
+}
+
+// Topic 一个 BCF 议题
+type Topic struct {
+    GUID        string   `json:"guid"`
+    Title       string   `json:"title"`
+    Type        string   `json:"type,omitempty"`
+    Status      string   `json:"status,omitempty"`
+    Priority    string   `json:"priority,omitempty"`
+    Labels      []string `json:"labels,omitempty"`
+    Author      string   `json:"author,omitempty"`
+    CreatedAt   string   `json:"createdAt,omitempty"`
+    ModifiedAt  string   `json:"modifiedAt,omitempty"`
+    AssignedTo  string   `json:"assignedTo,omitempty"`
+    Description string   `json:"description,omitempty"`
+    Comments    int      `json:"comments"`
+
+    Viewpoints []*Viewpoint `json:"viewpoints"`
+    // MarkupHash markup.bcf 原文的 SHA-256
+    MarkupHash string `json:"markupHash"`
+    // Hash 议题哈希：MarkupHash 与各视点哈希（按视点 GUID 排序）拼接后的 SHA-256
+    Hash string `json:"hash"`
+}
+
+// Viewpoint 议题的一个视点
+type Viewpoint struct {
+    GUID     string `json:"guid"`
+    File     string `json:"file"`
+    Snapshot string `json:"snapshot,omitempty"`
+    // Hash 视点文件（.bcfv）与快照图片拼接后的 SHA-256；文件缺失时为空
+    Hash string `json:"hash"`
+}
+
+// closedStatuses BCF 的 TopicStatus 由各项目扩展定义，这些取值（不区分大小写）视为已关闭
+var closedStatuses = map[string]bool{"closed": true, "resolved": true, "done": true}
+
+// IsOpen 议题是否仍未关闭
+func (t *Topic) IsOpen() bool {
+    return !closedStatuses[strings.ToLower(strings.TrimSpace(t.Status))]
+}
+
+// ParseZip 解析 BCFzip 内容
+func ParseZip(data []byte) (*Archive, error) {
+    zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+    if err != nil {
+        return nil, fmt.Errorf("不是有效的 BCFzip: %v", err)
+    }
+    files := map[string]*zip.File{}
+    for _, f := range zr.File {
+        files[path.Clean(f.Name)] = f
+    }
+
+    archive := &Archive{Topics: []*Topic{}}
+    if f, ok := files["bcf.version"]; ok {
+        raw, err := readEntry(f)
+        if err != nil {
+            return nil, err
+        }
+        var v struct {
+            VersionID string `xml:"VersionId,attr"`
+        }
+        if err := xml.Unmarshal(raw, &v); err != nil {
+            return nil, fmt.Errorf("解析 bcf.version 失败: %v", err)
+        }
+        archive.Version = v.VersionID
+    }
+
+    for name, f := range files {
+        dir, base := path.Split(name)
+        if base != "markup.bcf" {
+            continue
+        }
+        topic, err := parseTopic(files, strings.TrimSuffix(dir, "/"), f)
+        if err != nil {
+            return nil, err
+        }
+        archive.Topics = append(archive.Topics, topic)
+    }
+    if len(archive.Topics) == 0 {
+        return nil, fmt.Errorf("BCFzip 中没有议题（markup.bcf）")
+    }
+    sort.Slice(archive.Topics, func(i, j int) bool { return archive.Topics[i].GUID < archive.Topics[j].GUID })
+    return archive, nil
+}
+
+// OpenTopics 返回未关闭的议题
+func (a *Archive) OpenTopics() []*Topic {
+    var open []*Topic
+    for _, t := range a.Topics {
+        if t.IsOpen() {
+            open = append(open, t)
+        }
+    }
+    return open
+}
+
+// markup markup.bcf 中用到的字段；BCF 2.1 的 Comment / Viewpoints 位于 Markup 下，
+// BCF 3.0 位于 Topic/Comments 与 Topic/Viewpoints 下
+type markup struct {
+    Topic struct {
+        GUID           string         `xml:"Guid,attr"`
+        TopicType      string         `xml:"TopicType,attr"`
+        TopicStatus    string         `xml:"TopicStatus,attr"`
+        Title          string         `xml:"Title"`
+        Priority       string         `xml:"Priority"`
+        Labels         []labels       `xml:"Labels"`
+        CreationDate   string         `xml:"CreationDate"`
+        CreationAuthor string         `xml:"CreationAuthor"`
+        ModifiedDate   string         `xml:"ModifiedDate"`
+        AssignedTo     string         `xml:"AssignedTo"`
+        Description    string         `xml:"Description"`
+        Comments       []struct{}     `xml:"Comments>Comment"`
+        Viewpoints     []viewpointRef `xml:"Viewpoints>ViewPoint"`
+    } `xml:"Topic"`
+    Comments   []struct{}     `xml:"Comment"`
+    Viewpoints []viewpointRef `xml:"Viewpoints"`
+}
+
+// labels BCF 2.1 每个标签一个 <Labels>，BCF 3.0 为 <Labels><Label>..</Label></Labels>
+type labels struct {
+    Text  string   `xml:",chardata"`
+    Label []string `xml:"Label"`
+}
+
+type viewpointRef struct {
+    GUID      string `xml:"Guid,attr"`
+    Viewpoint string `xml:"Viewpoint"`
+    Snapshot  string `xml:"Snapshot"`
+}
+
+func parseTopic(files map[string]*zip.File, dir string, f *zip.File) (*Topic, error) {
+    raw, err := readEntry(f)
+    if err != nil {
+        return nil, err
+    }
+    var m markup
+    if err := xml.Unmarshal(raw, &m); err != nil {
+        return nil, fmt.Errorf("解析 %s 失败: %v", f.Name, err)
+    }
+    guid := m.Topic.GUID
+    if guid == "" {
+        guid = path.Base(dir)
+    }
+    var topicLabels []string
+    for _, l := range m.Topic.Labels {
+        if len(l.Label) > 0 {
+            topicLabels = append(topicLabels, l.Label...)
+        } else if text := strings.TrimSpace(l.Text); text != "" {
+            topicLabels = append(topicLabels, text)
+        }
+    }
+    topic := &Topic{
+        GUID:        guid,
+        Title:       strings.TrimSpace(m.Topic.Title),
+        Type:        m.Topic.TopicType,
+        Status:      m.Topic.TopicStatus,
+        Priority:    strings.TrimSpace(m.Topic.Priority),
+        Labels:      topicLabels,
+        Author:      m.Topic.CreationAuthor,
+        CreatedAt:   m.Topic.CreationDate,
+        ModifiedAt:  m.Topic.ModifiedDate,
+        AssignedTo:  m.Topic.AssignedTo,
+        Description: strings.TrimSpace(m.Topic.Description),
+        Comments:    len(m.Comments) + len(m.Topic.Comments),
+        Viewpoints:  []*Viewpoint{},
+        MarkupHash:  hashOf(raw),
+    }
+
+    refs := append(m.Viewpoints, m.Topic.Viewpoints...)
+    for _, ref := range refs {
+        vp := &Viewpoint{GUID: ref.GUID, File: ref.Viewpoint, Snapshot: ref.Snapshot}
+        if vp.GUID == "" {
+            vp.GUID = strings.TrimSuffix(ref.Viewpoint, path.Ext(ref.Viewpoint))
+        }
+        h := sha256.New()
+        found := false
+        for _, name := range []string{ref.Viewpoint, ref.Snapshot} {
+            vf, ok := files[path.Join(dir, name)]
+            if name == "" || !ok {
+                continue
+            }
+            content, err := readEntry(vf)
+            if err != nil {
+                return nil, err
+            }
+            h.Write(content)
+            found = true
+        }
+        if found {
+            vp.Hash = hex.EncodeToString(h.Sum(nil))
+        }
+        topic.Viewpoints = append(topic.Viewpoints, vp)
+    }
+    sort.Slice(topic.Viewpoints, func(i, j int) bool { return topic.Viewpoints[i].GUID < topic.Viewpoints[j].GUID })
+
+    h := sha256.New()
+    h.Write([]byte(topic.MarkupHash))
+    for _, vp := range topic.Viewpoints {
+        h.Write([]byte(vp.Hash))
+    }
+    topic.Hash = hex.EncodeToString(h.Sum(nil))
+    return topic, nil
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+    if f.UncompressedSize64 > MaxEntryBytes {
+        return nil, fmt.Errorf("%s 超过 %d 字节", f.Name, MaxEntryBytes)
+    }
+    rc, err := f.Open()
+    if err != nil {
+        return nil, fmt.Errorf("读取 %s 失败: %v", f.Name, err)
+    }
+    defer rc.Close()
+    data, err := io.ReadAll(io.LimitReader(rc, MaxEntryBytes+1))
+    if err != nil {
+        return nil, fmt.Errorf("读取 %s 失败: %v", f.Name, err)
+    }
+    if len(data) > MaxEntryBytes {
+        return nil, fmt.Errorf("%s 超过 %d 字节", f.Name, MaxEntryBytes)
+    }
+    return data, nil
+}
+
+func hashOf(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,185 @@
+package mapping
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "errors"
+    "fmt"
+)
+
+// -------------------------------
+//  二进制差分（相邻版本模型文件）
+// -------------------------------
+
+// 差分格式（BIMD1）：
+//
+//	"BIMD1" | 上一版 SHA-256 (32) | 新版 SHA-256 (32) | 新版长度 uvarint | 操作...
+//	COPY   0x01 | 上一版偏移 uvarint | 长度 uvarint
+//	INSERT 0x02 | 长度 uvarint | 数据
+//
+// 新版按块（deltaBlockSize 字节）滚动哈希在上一版中查找相同内容，命中后向前后尽量延长，
+// 其余字节作为插入数据。IFC 等文本模型每日同步时大部分内容不变，差分远小于整个文件。
+
+const (
+    deltaMagic     = "BIMD1"
+    deltaBlockSize = 64
+    deltaOpCopy    = 0x01
+    deltaOpInsert  = 0x02
+    // deltaMaxCandidates 同一哈希最多比较的上一版块数，避免重复内容过多时退化
+    deltaMaxCandidates = 8
+    // rollingBase 滚动哈希的乘数
+    rollingBase uint32 = 16777619
+)
+
+// ComputeDelta 计算从 base 到 target 的差分
+func ComputeDelta(base, target []byte) []byte {
+    baseSum := sha256.Sum256(base)
+    targetSum := sha256.Sum256(target)
+    out := bytes.NewBufferString(deltaMagic)
+    out.Write(baseSum[:])
+    out.Write(targetSum[:])
+    writeUvarint(out, uint64(len(target)))
+
+    index := map[uint32][]int{}
+    for off := 0; off+deltaBlockSize <= len(base); off += deltaBlockSize {
+        h := rollingHash(base[off : off+deltaBlockSize])
+        if len(index[h]) < deltaMaxCandidates {
+            index[h] = append(index[h], off)
+        }
+    }
+
+    // pow = rollingBase^(deltaBlockSize-1)，用于移出窗口首字节
+    pow := uint32(1)
+    for i := 1; i < deltaBlockSize; i++ {
+        pow *= rollingBase
+    }
+
+    pending := 0 // 尚未输出的插入数据起点
+    pos := 0
+    var h uint32
+    if len(target) >= deltaBlockSize {
+        h = rollingHash(target[:deltaBlockSize])
+    }
+    for pos+deltaBlockSize <= len(target) {
+        baseOff, length := -1, 0
+        for _, cand := range index[h] {
+            if !bytes.Equal(base[cand:cand+deltaBlockSize], target[pos:pos+deltaBlockSize]) {
+                continue
+            }
+            n := deltaBlockSize
+            for cand+n < len(base) && pos+n < len(target) && base[cand+n] == target[pos+n] {
+                n++
+            }
+            if n > length {
+                baseOff, length = cand, n
+            }
+        }
+        if baseOff < 0 {
+            if pos+deltaBlockSize < len(target) {
+                h = (h-uint32(target[pos])*pow)*rollingBase + uint32(target[pos+deltaBlockSize])
+            }
+            pos++
+            continue
+        }
+        // 向前延长到尚未输出的插入数据中
+        for baseOff > 0 && pos > pending && base[baseOff-1] == target[pos-1] {
+            baseOff--
+            pos--
+            length++
+        }
+        if pos > pending {
+            writeInsert(out, target[pending:pos])
+        }
+        out.WriteByte(deltaOpCopy)
+        writeUvarint(out, uint64(baseOff))
+        writeUvarint(out, uint64(length))
+        pos += length
+        pending = pos
+        if pos+deltaBlockSize <= len(target) {
+            h = rollingHash(target[pos : pos+deltaBlockSize])
+        }
+    }
+    if pending < len(target) {
+        writeInsert(out, target[pending:])
+    }
+    return out.Bytes()
+}
+
+// ApplyDelta 由上一版与差分还原新版，并校验两者的 SHA-256
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+    if !bytes.HasPrefix(delta, []byte(deltaMagic)) || len(delta) < len(deltaMagic)+2*sha256.Size {
+        return nil, errors.New("差分格式无效")
+    }
+    r := bytes.NewReader(delta[len(deltaMagic):])
+    var baseSum, targetSum [sha256.Size]byte
+    r.Read(baseSum[:])
+    r.Read(targetSum[:])
+    if sha256.Sum256(base) != baseSum {
+        return nil, errors.New("上一版文件与差分记录的哈希不一致")
+    }
+    size, err := binary.ReadUvarint(r)
+    if err != nil || size > uint64(len(base))+uint64(len(delta)) {
+        return nil, errors.New("差分记录的文件长度无效")
+    }
+
+    out := make([]byte, 0, size)
+    for r.Len() > 0 {
+        op, _ := r.ReadByte()
+        switch op {
+        case deltaOpCopy:
+            off, err1 := binary.ReadUvarint(r)
+            n, err2 := binary.ReadUvarint(r)
+            if err1 != nil || err2 != nil || off > uint64(len(base)) || n > uint64(len(base))-off {
+                return nil, errors.New("差分中的复制操作越界")
+            }
+            out = append(out, base[off:off+n]...)
+        case deltaOpInsert:
+            n, err := binary.ReadUvarint(r)
+            if err != nil || n > uint64(r.Len()) {
+                return nil, errors.New("差分中的插入操作越界")
+            }
+            data := make([]byte, n)
+            r.Read(data)
+            out = append(out, data...)
+        default:
+            return nil, fmt.Errorf("差分中的未知操作 0x%02x", op)
+        }
+        if uint64(len(out)) > size {
+            return nil, errors.New("还原的文件超过差分记录的长度")
+        }
+    }
+    if uint64(len(out)) != size || sha256.Sum256(out) != targetSum {
+        return nil, errors.New("还原的文件与差分记录的哈希不一致")
+    }
+    return out, nil
+}
+
+// DeltaHashes 返回差分记录的上一版与新版 SHA-256
+func DeltaHashes(delta []byte) (base, target [sha256.Size]byte, err error) {
+    if !bytes.HasPrefix(delta, []byte(deltaMagic)) || len(delta) < len(deltaMagic)+2*sha256.Size {
+        return base, target, errors.New("差分格式无效")
+    }
+    copy(base[:], delta[len(deltaMagic):])
+    copy(target[:], delta[len(deltaMagic)+sha256.Size:])
+    return base, target, nil
+}
+
+func rollingHash(block []byte) uint32 {
+    var h uint32
+    for _, b := range block {
+        h = h*rollingBase + uint32(b)
+    }
+    return h
+}
+
+func writeInsert(out *bytes.Buffer, data []byte) {
+    out.WriteByte(deltaOpInsert)
+    writeUvarint(out, uint64(len(data)))
+    out.Write(data)
+}
+
+func writeUvarint(out *bytes.Buffer, v uint64) {
+    var buf [binary.MaxVarintLen64]byte
+    out.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
@@ -0,0 +1,215 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// -------------------------------
+//  多通道路由提交（一个项目一个通道）
+// -------------------------------
+
+// ChannelInvoker 通过指定节点在指定通道上提交链码交易，由 Fabric Gateway / SDK 适配实现；
+// 交易以 InvokeIdentity(ctx) 的身份签名
+type ChannelInvoker interface {
+    Invoke(ctx context.Context, node *NodeMapping, chaincode string, function string, args ...[]byte) ([]byte, error)
+}
+
+// identityKey 上下文键：交易应以其钱包身份签名的用户
+type identityKey struct{}
+
+// WithIdentity 指定本次提交的签名身份，label 为钱包 / Fabric CA 身份标签（即 GetUserInfo 的 userId）
+func WithIdentity(ctx context.Context, label string) context.Context {
+    return context.WithValue(ctx, identityKey{}, label)
+}
+
+// txIdentity 未用 WithIdentity 指定签名身份时以交易的操作人签名
+func txIdentity(ctx context.Context, tx *Transaction) context.Context {
+    if _, ok := ctx.Value(identityKey{}).(string); ok {
+        return ctx
+    }
+    return WithIdentity(ctx, tx.User.UserID)
+}
+
+// InvokeIdentity 返回交易应使用的签名身份：WithIdentity 指定的身份，否则为认证的调用方，都没有时为空。
+// ChannelInvoker 实现须以该身份签名交易：链码的角色检查、重复投票检测与 QueryUpdate 的组织范围都取自交易身份，
+// 所有请求共用一个身份时这些检查全部失效
+func InvokeIdentity(ctx context.Context) string {
+    if label, _ := ctx.Value(identityKey{}).(string); label != "" {
+        return label
+    }
+    if caller := CallerFromContext(ctx); caller != nil {
+        return caller.Label
+    }
+    return ""
+}
+
+// RoutedSubmitter 按交易的 (部门, 项目) 解析通道与节点后提交，
+// 使同一个映射服务实例可以服务多个项目通道
+type RoutedSubmitter struct {
+    Invoker   ChannelInvoker
+    Chaincode string
+    // Timeout 单次提交（背书、排序与等待提交）的超时，0 表示只受调用方 ctx 限制
+    Timeout time.Duration
+    // WaitForCommit 为真时每次提交都等到交易以 VALID 写入区块才返回，之后的查询即可读到本次写入；
+    // Invoker 须实现 CommitInvoker
+    WaitForCommit bool
+}
+
+// NewRoutedSubmitter 创建按通道路由的提交器
+func NewRoutedSubmitter(invoker ChannelInvoker, chaincode string) *RoutedSubmitter {
+    return &RoutedSubmitter{Invoker: invoker, Chaincode: chaincode}
+}
+
+// UpdateMeta 提交 InitBIMUpdate 时交易本身不携带、由调用方给出的模型信息
+type UpdateMeta struct {
+    ModelID     string
+    Version     string
+    Description string
+    DependsOn   []string // 其他模型中必须先批准的更新
+}
+
+// UpdateSubmission InitBIMUpdate 的参数：链码 BIMUpdate 中由提交方填写的字段，
+// 与 schemas/update.schema.json 一致；Initiator、Timestamp、Status 等由链码填写
+type UpdateSubmission struct {
+    UpdateID          string        `json:"UpdateID,omitempty"` // 为空时由链码生成
+    ModelID           string        `json:"ModelID"`
+    Version           string        `json:"Version"`
+    Description       string        `json:"Description,omitempty"`
+    Files             []LedgerFile  `json:"Files,omitempty"`
+    DetachedSignature string        `json:"DetachedSignature,omitempty"`
+    ExternalRefs      []ExternalRef `json:"ExternalRefs,omitempty"`
+    DependsOn         []string      `json:"DependsOn,omitempty"`
+    ClientRequestID   string        `json:"ClientRequestID,omitempty"`
+}
+
+// NewUpdateSubmission 将封装好的交易转换为 InitBIMUpdate 接收的 BIMUpdate：
+// 交付文件取自 BIM.Files，单文件交付时为主模型文件；交易 ID 作为 ClientRequestID，重复提交返回同一更新
+func NewUpdateSubmission(tx *Transaction, meta UpdateMeta) (*UpdateSubmission, error) {
+    if tx == nil {
+        return nil, errors.New("交易为空")
+    }
+    if meta.ModelID == "" || meta.Version == "" {
+        return nil, errors.New("缺少 ModelID 或 Version")
+    }
+    update := &UpdateSubmission{
+        ModelID:           meta.ModelID,
+        Version:           meta.Version,
+        Description:       meta.Description,
+        DependsOn:         meta.DependsOn,
+        DetachedSignature: tx.BIM.DetachedSignature,
+        ExternalRefs:      tx.BIM.ExternalRefs,
+        ClientRequestID:   tx.TxID,
+    }
+    for _, f := range tx.BIM.Files {
+        update.Files = append(update.Files, LedgerFile{
+            Name:          f.Name,
+            CID:           f.CID,
+            Hash:          f.Hash,
+            HashAlgorithm: f.HashAlgorithm,
+            Size:          f.Size,
+            MimeType:      f.MimeType,
+        })
+    }
+    if len(update.Files) == 0 {
+        if tx.BIM.CID == "" || tx.BIM.FileHash == "" {
+            return nil, errors.New("交易没有交付文件")
+        }
+        update.Files = []LedgerFile{{
+            Name:          tx.BIM.FileName,
+            CID:           tx.BIM.CID,
+            Hash:          tx.BIM.FileHash,
+            HashAlgorithm: tx.BIM.HashAlgorithm,
+        }}
+    }
+    return update, nil
+}
+
+// initPayload 解析交易的节点并生成 InitBIMUpdate 的参数
+func initPayload(tx *Transaction, meta UpdateMeta) (*NodeMapping, []byte, error) {
+    update, err := NewUpdateSubmission(tx, meta)
+    if err != nil {
+        return nil, nil, err
+    }
+    node, err := MapToProjectNode(tx.User.Department, tx.ProjectID)
+    if err != nil {
+        return nil, nil, err
+    }
+    payload, err := json.Marshal(update)
+    if err != nil {
+        return nil, nil, fmt.Errorf("更新序列化失败: %v", err)
+    }
+    return node, payload, nil
+}
+
+// Submit 将交易按 meta 转换为 BIMUpdate 后以交易操作人的身份调用 InitBIMUpdate，返回实际使用的节点与链码返回的 UpdateID
+func (s *RoutedSubmitter) Submit(ctx context.Context, tx *Transaction, meta UpdateMeta) (*NodeMapping, []byte, error) {
+    node, payload, err := initPayload(tx, meta)
+    if err != nil {
+        return nil, nil, err
+    }
+    return s.invoke(txIdentity(ctx, tx), tx.TxID, node, fnInitBIMUpdate, payload)
+}
+
+// SubmitArgs 以任意参数在 (部门, 项目) 对应的通道上提交 function，供审批等非封装交易使用
+func (s *RoutedSubmitter) SubmitArgs(ctx context.Context, department string, projectID string, function string, args ...[]byte) (*NodeMapping, []byte, error) {
+    node, err := MapToProjectNode(department, projectID)
+    if err != nil {
+        return nil, nil, err
+    }
+    return s.invoke(ctx, "", node, function, args...)
+}
+
+func (s *RoutedSubmitter) invoke(ctx context.Context, txID string, node *NodeMapping, function string, args ...[]byte) (*NodeMapping, []byte, error) {
+    result, _, err := s.send(ctx, txID, node, function, s.WaitForCommit, args...)
+    if err != nil {
+        return node, nil, err
+    }
+    return node, result, nil
+}
+
+// send 提交一次交易；commit 为真时经 CommitInvoker 等待交易提交并返回所在区块号，否则区块号为 0
+func (s *RoutedSubmitter) send(ctx context.Context, txID string, node *NodeMapping, function string, commit bool, args ...[]byte) ([]byte, uint64, error) {
+    if s.Invoker == nil {
+        return nil, 0, errors.New("未配置 ChannelInvoker")
+    }
+    committer, ok := s.Invoker.(CommitInvoker)
+    if commit && !ok {
+        return nil, 0, errors.New("等待交易提交需要实现 CommitInvoker 的 Invoker")
+    }
+    log := Logger().With("channel", node.Channel, "node", node.NodeURL, "function", function)
+    if txID != "" {
+        log = log.With("txID", txID)
+    }
+    ctx, cancel := s.submitContext(ctx)
+    defer cancel()
+    var result []byte
+    var block uint64
+    var err error
+    if commit {
+        result, block, err = committer.InvokeCommitted(ctx, node, s.Chaincode, function, args...)
+    } else {
+        result, err = s.Invoker.Invoke(ctx, node, s.Chaincode, function, args...)
+    }
+    if err != nil {
+        log.Error("交易提交失败", "err", err)
+        return nil, 0, fmt.Errorf("在通道 %s 上提交 %s 失败: %v", node.Channel, function, err)
+    }
+    if commit {
+        log.Info("交易已提交", "block", block)
+    } else {
+        log.Info("交易已提交")
+    }
+    return result, block, nil
+}
+
+// submitContext 按 Timeout 为一次提交加上超时
+func (s *RoutedSubmitter) submitContext(ctx context.Context) (context.Context, context.CancelFunc) {
+    if s.Timeout > 0 {
+        return context.WithTimeout(ctx, s.Timeout)
+    }
+    return context.WithCancel(ctx)
+}
@@ -0,0 +1,136 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+// testTransaction 返回部门 architecture 的一笔已封装交易
+func testTransaction(info BIMInitInfo) *Transaction {
+    return &Transaction{
+        TxID:      "TX-1700000000000000000",
+        Timestamp: 1700000000,
+        User:      UserInfo{UserID: "1001", Department: "architecture", Role: "modeler"},
+        BIM:       info,
+        Digest:    strings.Repeat("ab", 32),
+    }
+}
+
+func TestRoutedSubmitterSubmitsBIMUpdate(t *testing.T) {
+    cid := "Qm" + strings.Repeat("a", 44)
+    hash := strings.Repeat("0f", 32)
+    tests := []struct {
+        name  string
+        info  BIMInitInfo
+        files []LedgerFile
+    }{
+        {
+            "single file",
+            BIMInitInfo{FileName: "A.ifc", CID: cid, FileHash: hash, HashAlgorithm: HashSHA256},
+            []LedgerFile{{Name: "A.ifc", CID: cid, Hash: hash, HashAlgorithm: HashSHA256}},
+        },
+        {
+            "delivery",
+            BIMInitInfo{FileName: "A.ifc", CID: cid, FileHash: hash, Files: []FileEntry{
+                {Name: "A.ifc", CID: cid, Hash: hash, Size: 10, MimeType: "application/x-step", URI: "ipfs://" + cid},
+                {Name: "A.dwg", CID: cid, Hash: hash, Size: 20},
+            }},
+            []LedgerFile{
+                {Name: "A.ifc", CID: cid, Hash: hash, Size: 10, MimeType: "application/x-step"},
+                {Name: "A.dwg", CID: cid, Hash: hash, Size: 20},
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            invoker := &recordingInvoker{result: "u1"}
+            tx := testTransaction(tt.info)
+            meta := UpdateMeta{ModelID: "m1", Version: "1.0", Description: "first issue", DependsOn: []string{"s1"}}
+            _, result, err := NewRoutedSubmitter(invoker, "bim").Submit(context.Background(), tx, meta)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if string(result) != "u1" {
+                t.Errorf("result = %s, want u1", result)
+            }
+            if len(invoker.calls) != 1 || invoker.calls[0] != fnInitBIMUpdate || len(invoker.args[0]) != 1 {
+                t.Fatalf("calls = %v, want one %s with one argument", invoker.calls, fnInitBIMUpdate)
+            }
+
+            // 参数须是链码接受的 BIMUpdate，而不是交易本身
+            payload := invoker.args[0][0]
+            if err := ValidateRequest("update", payload); err != nil {
+                t.Fatalf("payload %s: %v", payload, err)
+            }
+            var update LedgerUpdate
+            if err := json.Unmarshal(payload, &update); err != nil {
+                t.Fatal(err)
+            }
+            if update.UpdateID != "" || update.ModelID != "m1" || update.Version != "1.0" || update.Description != "first issue" {
+                t.Errorf("update = %+v", update)
+            }
+            if len(update.DependsOn) != 1 || update.DependsOn[0] != "s1" {
+                t.Errorf("DependsOn = %v, want [s1]", update.DependsOn)
+            }
+            if update.ClientRequestID != tx.TxID {
+                t.Errorf("ClientRequestID = %q, want %q", update.ClientRequestID, tx.TxID)
+            }
+            got, _ := json.Marshal(update.Files)
+            want, _ := json.Marshal(tt.files)
+            if string(got) != string(want) {
+                t.Errorf("Files = %s, want %s", got, want)
+            }
+        })
+    }
+}
+
+func TestRoutedSubmitterRejectsIncompleteUpdate(t *testing.T) {
+    cid := "Qm" + strings.Repeat("a", 44)
+    tests := []struct {
+        name string
+        tx   *Transaction
+        meta UpdateMeta
+    }{
+        {"no transaction", nil, UpdateMeta{ModelID: "m1", Version: "1.0"}},
+        {"no ModelID", testTransaction(BIMInitInfo{FileName: "A.ifc", CID: cid, FileHash: "0f"}), UpdateMeta{Version: "1.0"}},
+        {"no Version", testTransaction(BIMInitInfo{FileName: "A.ifc", CID: cid, FileHash: "0f"}), UpdateMeta{ModelID: "m1"}},
+        {"no file", testTransaction(BIMInitInfo{}), UpdateMeta{ModelID: "m1", Version: "1.0"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            invoker := &recordingInvoker{}
+            if _, _, err := NewRoutedSubmitter(invoker, "bim").Submit(context.Background(), tt.tx, tt.meta); err == nil {
+                t.Fatal("Submit succeeded")
+            }
+            if len(invoker.calls) > 0 {
+                t.Fatalf("invoked %v", invoker.calls)
+            }
+        })
+    }
+}
+
+func TestInvokeIdentity(t *testing.T) {
+    ctx := context.Background()
+    if id := InvokeIdentity(ctx); id != "" {
+        t.Errorf("identity without caller = %q", id)
+    }
+    authed := context.WithValue(ctx, callerKey{}, &CallerIdentity{Label: "1002", MSPID: "Org2MSP"})
+    if id := InvokeIdentity(authed); id != "1002" {
+        t.Errorf("identity of authenticated caller = %q, want 1002", id)
+    }
+    if id := InvokeIdentity(WithIdentity(authed, "1003")); id != "1003" {
+        t.Errorf("explicit identity = %q, want 1003", id)
+    }
+
+    // 未指定身份时以交易的操作人签名
+    invoker := &recordingInvoker{result: "u1"}
+    tx := testTransaction(BIMInitInfo{FileName: "A.ifc", CID: "Qm" + strings.Repeat("a", 44), FileHash: "0f"})
+    if _, _, err := NewRoutedSubmitter(invoker, "bim").Submit(ctx, tx, UpdateMeta{ModelID: "m1", Version: "1.0"}); err != nil {
+        t.Fatal(err)
+    }
+    if len(invoker.identities) != 1 || invoker.identities[0] != "1001" {
+        t.Errorf("signing identities = %v, want [1001]", invoker.identities)
+    }
+}
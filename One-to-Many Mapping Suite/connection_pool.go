@@ -0,0 +1,321 @@
+package mapping
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "net/url"
+    "sort"
+    "sync"
+    "time"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/connectivity"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/credentials/insecure"
+)
+
+// -------------------------------
+//  节点连接池与健康检查
+// -------------------------------
+
+// NodeStatus 单个节点的连接与健康状态
+type NodeStatus struct {
+    NodeURL string `json:"nodeUrl"`
+    OrgName string `json:"orgName"`
+    // Routes 映射到该节点的路由：部门，或 项目/部门
+    Routes    []string  `json:"routes"`
+    Healthy   bool      `json:"healthy"`
+    State     string    `json:"state"` // gRPC 连接状态
+    LastCheck time.Time `json:"lastCheck"`
+    LastError string    `json:"lastError,omitempty"`
+    Failures  int       `json:"failures"` // 连续失败次数
+}
+
+// HealthChecker 检查一个节点是否可用（可基于服务发现或 ping 实现）
+type HealthChecker interface {
+    Check(ctx context.Context, conn *grpc.ClientConn, node NodeMapping) error
+}
+
+// ConnectivityChecker 默认检查：发起连接并等待进入 Ready 状态
+type ConnectivityChecker struct{}
+
+// Check 在 ctx 截止前连接就绪则视为健康
+func (ConnectivityChecker) Check(ctx context.Context, conn *grpc.ClientConn, node NodeMapping) error {
+    conn.Connect()
+    for {
+        state := conn.GetState()
+        switch state {
+        case connectivity.Ready:
+            return nil
+        case connectivity.Shutdown:
+            return errors.New("连接已关闭")
+        }
+        if !conn.WaitForStateChange(ctx, state) {
+            return fmt.Errorf("连接未就绪（%s）", state)
+        }
+    }
+}
+
+// ConnectionManager 为当前配置中的所有节点维护 gRPC 连接并定期检查健康状态。
+// 通过 UseConnectionManager 启用后，MapToProjectNode 不会返回不可用的节点。
+type ConnectionManager struct {
+    // Interval 健康检查间隔，默认 15 秒
+    Interval time.Duration
+    // Timeout 单次检查超时，默认 5 秒
+    Timeout time.Duration
+    // FailureThreshold 连续失败达到该次数后标记为不可用，默认 2
+    FailureThreshold int
+    // DialOptions 为空时 grpc:// 使用明文，grpcs:// 使用系统根证书 TLS
+    DialOptions []grpc.DialOption
+    Checker     HealthChecker
+
+    mu    sync.RWMutex
+    nodes map[string]*pooledNode // NodeURL -> 连接
+
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+type pooledNode struct {
+    conn   *grpc.ClientConn
+    status NodeStatus
+}
+
+// NewConnectionManager 创建连接管理器
+func NewConnectionManager() *ConnectionManager {
+    return &ConnectionManager{
+        Interval:         15 * time.Second,
+        Timeout:          5 * time.Second,
+        FailureThreshold: 2,
+        Checker:          ConnectivityChecker{},
+        nodes:            map[string]*pooledNode{},
+    }
+}
+
+// Start 立即检查一轮，之后按 Interval 定期同步节点表并检查，直到 ctx 取消或调用 Stop
+func (m *ConnectionManager) Start(ctx context.Context) {
+    ctx, m.cancel = context.WithCancel(ctx)
+    m.CheckNow(ctx)
+    m.wg.Add(1)
+    go func() {
+        defer m.wg.Done()
+        ticker := time.NewTicker(m.Interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                m.CheckNow(ctx)
+            }
+        }
+    }()
+}
+
+// Stop 停止健康检查并关闭所有连接
+func (m *ConnectionManager) Stop() {
+    if m.cancel != nil {
+        m.cancel()
+    }
+    m.wg.Wait()
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for nodeURL, n := range m.nodes {
+        n.conn.Close()
+        delete(m.nodes, nodeURL)
+    }
+}
+
+// CheckNow 按当前配置同步连接池，并并发检查所有节点
+func (m *ConnectionManager) CheckNow(ctx context.Context) {
+    m.sync(CurrentConfig())
+
+    m.mu.RLock()
+    targets := make(map[string]*pooledNode, len(m.nodes))
+    for nodeURL, n := range m.nodes {
+        targets[nodeURL] = n
+    }
+    m.mu.RUnlock()
+
+    var wg sync.WaitGroup
+    for nodeURL, n := range targets {
+        wg.Add(1)
+        go func(nodeURL string, n *pooledNode) {
+            defer wg.Done()
+            checkCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+            defer cancel()
+            err := m.Checker.Check(checkCtx, n.conn, NodeMapping{NodeURL: nodeURL, OrgName: n.status.OrgName})
+            m.record(nodeURL, n, err)
+        }(nodeURL, n)
+    }
+    wg.Wait()
+}
+
+// record 更新检查结果，健康状态变化时记录日志
+func (m *ConnectionManager) record(nodeURL string, n *pooledNode, err error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.nodes[nodeURL] != n {
+        return // 检查期间节点已从配置中移除
+    }
+    was := n.status.Healthy
+    n.status.LastCheck = time.Now()
+    n.status.State = n.conn.GetState().String()
+    if err == nil {
+        n.status.Failures = 0
+        n.status.LastError = ""
+        n.status.Healthy = true
+    } else {
+        n.status.Failures++
+        n.status.LastError = err.Error()
+        if n.status.Failures >= m.FailureThreshold {
+            n.status.Healthy = false
+        }
+    }
+    switch {
+    case was && !n.status.Healthy:
+        Logger().Warn("节点不可用", "node", nodeURL, "failures", n.status.Failures, "err", err)
+    case !was && n.status.Healthy:
+        Logger().Info("节点已恢复", "node", nodeURL)
+    }
+}
+
+// sync 为配置中新增的节点建立连接，关闭已移除节点的连接
+func (m *ConnectionManager) sync(cfg *Config) {
+    wanted := map[string]*NodeStatus{}
+    add := func(route string, node NodeMapping) {
+        s, ok := wanted[node.NodeURL]
+        if !ok {
+            s = &NodeStatus{NodeURL: node.NodeURL, OrgName: node.OrgName}
+            wanted[node.NodeURL] = s
+        }
+        s.Routes = append(s.Routes, route)
+    }
+    for _, dept := range sortedDepartments(cfg.Nodes) {
+        add(dept, cfg.Nodes[dept])
+    }
+    for _, id := range sortedKeys(cfg.Projects) {
+        nodes := cfg.Projects[id].Nodes
+        for _, dept := range sortedDepartments(nodes) {
+            add(id+"/"+dept, nodes[dept])
+        }
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for nodeURL, n := range m.nodes {
+        if _, ok := wanted[nodeURL]; !ok {
+            n.conn.Close()
+            delete(m.nodes, nodeURL)
+        }
+    }
+    for nodeURL, s := range wanted {
+        if n, ok := m.nodes[nodeURL]; ok {
+            n.status.OrgName, n.status.Routes = s.OrgName, s.Routes
+            continue
+        }
+        conn, err := m.dial(nodeURL)
+        if err != nil {
+            Logger().Error("节点连接创建失败", "node", nodeURL, "err", err)
+            continue
+        }
+        // 首次检查完成前视为可用，避免启动期间拒绝所有请求
+        s.Healthy = true
+        m.nodes[nodeURL] = &pooledNode{conn: conn, status: *s}
+    }
+}
+
+func (m *ConnectionManager) dial(nodeURL string) (*grpc.ClientConn, error) {
+    u, err := url.Parse(nodeURL)
+    if err != nil {
+        return nil, err
+    }
+    opts := m.DialOptions
+    if len(opts) == 0 {
+        var creds credentials.TransportCredentials = insecure.NewCredentials()
+        if u.Scheme == "grpcs" {
+            creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+        }
+        opts = []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+    }
+    return grpc.NewClient(u.Host, opts...)
+}
+
+// Conn 返回节点的池化连接；节点不可用或不在配置中时返回错误
+func (m *ConnectionManager) Conn(nodeURL string) (*grpc.ClientConn, error) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    n, ok := m.nodes[nodeURL]
+    if !ok {
+        return nil, fmt.Errorf("节点 %s 不在连接池中", nodeURL)
+    }
+    if !n.status.Healthy {
+        return nil, fmt.Errorf("节点 %s 不可用: %s", nodeURL, n.status.LastError)
+    }
+    return n.conn, nil
+}
+
+// Healthy 报告节点是否可用；尚未纳入连接池的节点视为可用
+func (m *ConnectionManager) Healthy(nodeURL string) bool {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    n, ok := m.nodes[nodeURL]
+    return !ok || n.status.Healthy
+}
+
+// Statuses 返回所有节点的状态（按地址排序的副本）
+func (m *ConnectionManager) Statuses() []NodeStatus {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    out := make([]NodeStatus, 0, len(m.nodes))
+    for _, n := range m.nodes {
+        s := n.status
+        s.Routes = append([]string(nil), s.Routes...)
+        out = append(out, s)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].NodeURL < out[j].NodeURL })
+    return out
+}
+
+var (
+    poolMu     sync.RWMutex
+    activePool *ConnectionManager
+)
+
+// UseConnectionManager 启用连接管理器，之后节点映射跳过不可用节点；传 nil 关闭检查
+func UseConnectionManager(m *ConnectionManager) {
+    poolMu.Lock()
+    activePool = m
+    poolMu.Unlock()
+}
+
+// CurrentConnectionManager 返回当前启用的连接管理器，未启用时为 nil
+func CurrentConnectionManager() *ConnectionManager {
+    poolMu.RLock()
+    defer poolMu.RUnlock()
+    return activePool
+}
+
+// avoidUnhealthy 节点不可用时改用同一组织的其他可用节点（先项目节点表，再全局节点表），
+// 通道保持不变；找不到时返回错误
+func avoidUnhealthy(cfg *Config, projectID string, node *NodeMapping) (*NodeMapping, error) {
+    pool := CurrentConnectionManager()
+    if pool == nil || pool.Healthy(node.NodeURL) {
+        return node, nil
+    }
+    tables := []map[string]NodeMapping{cfg.Projects[projectID].Nodes, cfg.Nodes}
+    for _, nodes := range tables {
+        for _, dept := range sortedDepartments(nodes) {
+            alt := nodes[dept]
+            if alt.OrgName != node.OrgName || alt.NodeURL == node.NodeURL || !pool.Healthy(alt.NodeURL) {
+                continue
+            }
+            Logger().Warn("节点不可用，改用同组织节点", "node", node.NodeURL, "fallback", alt.NodeURL, "org", node.OrgName)
+            alt.Channel = node.Channel
+            return &alt, nil
+        }
+    }
+    return nil, fmt.Errorf("节点 %s 不可用，组织 %s 没有其他可用节点", node.NodeURL, node.OrgName)
+}
@@ -0,0 +1,215 @@
+package mapping
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  基于内容寻址的文件去重
+// -------------------------------
+
+// Anchor 一个已上传（并可能已上链）的文件
+type Anchor struct {
+    FileHash string `json:"fileHash"` // SHA-256（十六进制小写），去重键，与配置的指纹算法无关
+    CID      string `json:"cid"`
+    FileName string `json:"fileName"`
+    // UpdateID 为空表示文件已上传 IPFS，但还没有更新引用它
+    UpdateID   string    `json:"updateId,omitempty"`
+    ModelID    string    `json:"modelId,omitempty"`
+    Version    string    `json:"version,omitempty"`
+    RecordedAt time.Time `json:"recordedAt"`
+}
+
+// Anchored 文件是否已被某个更新引用
+func (a *Anchor) Anchored() bool {
+    return a != nil && a.UpdateID != ""
+}
+
+// ContentIndex 本地内容哈希索引
+type ContentIndex interface {
+    Lookup(fileHash string) (*Anchor, error) // 未找到时返回 nil, nil
+    Put(a *Anchor) error
+}
+
+// AnchorRegistry 链上查询（如通过网关调用模型注册合约的 QueryUpdatesByContentHash），
+// 用于发现其他客户端已上链的相同文件
+type AnchorRegistry interface {
+    FindByFileHash(ctx context.Context, fileHash string) (*Anchor, error) // 未找到时返回 nil, nil
+}
+
+// FileContentIndex 以 JSON 文件保存的内容哈希索引
+type FileContentIndex struct {
+    Path string
+
+    mu      sync.Mutex
+    entries map[string]*Anchor
+}
+
+// Lookup 查询文件哈希
+func (f *FileContentIndex) Lookup(fileHash string) (*Anchor, error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if err := f.load(); err != nil {
+        return nil, err
+    }
+    a, ok := f.entries[strings.ToLower(fileHash)]
+    if !ok {
+        return nil, nil
+    }
+    c := *a
+    return &c, nil
+}
+
+// Put 写入或更新一条记录；已上链的记录不会被未上链的记录覆盖
+func (f *FileContentIndex) Put(a *Anchor) error {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if err := f.load(); err != nil {
+        return err
+    }
+    key := strings.ToLower(a.FileHash)
+    if existing, ok := f.entries[key]; ok && existing.Anchored() && !a.Anchored() {
+        return nil
+    }
+    c := *a
+    c.FileHash = key
+    f.entries[key] = &c
+
+    data, err := json.MarshalIndent(f.entries, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+        return err
+    }
+    tmp := f.Path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, f.Path)
+}
+
+func (f *FileContentIndex) load() error {
+    if f.entries != nil {
+        return nil
+    }
+    f.entries = map[string]*Anchor{}
+    data, err := os.ReadFile(f.Path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("读取内容索引失败: %v", err)
+    }
+    if err := json.Unmarshal(data, &f.entries); err != nil {
+        return fmt.Errorf("解析内容索引失败: %v", err)
+    }
+    return nil
+}
+
+// Deduplicator 上传前检查文件是否已上传 / 已上链，避免重复上传与重复更新
+type Deduplicator struct {
+    Index ContentIndex
+    // Registry 可选，本地未命中时查询链上
+    Registry AnchorRegistry
+}
+
+// NewDeduplicator 创建去重器，registry 可为 nil
+func NewDeduplicator(index ContentIndex, registry AnchorRegistry) *Deduplicator {
+    return &Deduplicator{Index: index, Registry: registry}
+}
+
+// Check 返回内容相同的已知文件；本地未命中时查询链上并缓存结果，仍未找到时返回 nil
+func (d *Deduplicator) Check(ctx context.Context, content []byte) (*Anchor, error) {
+    sum := sha256.Sum256(content)
+    fileHash := hex.EncodeToString(sum[:])
+
+    a, err := d.Index.Lookup(fileHash)
+    if err != nil {
+        return nil, err
+    }
+    if a.Anchored() || d.Registry == nil {
+        return a, nil
+    }
+    remote, err := d.Registry.FindByFileHash(ctx, fileHash)
+    if err != nil {
+        // 链上查询失败不阻塞上传，只是可能产生重复
+        Logger().Warn("链上去重查询失败", "fileHash", fileHash, "err", err)
+        return a, nil
+    }
+    if remote == nil {
+        return a, nil
+    }
+    if err := d.Index.Put(remote); err != nil {
+        return nil, err
+    }
+    return remote, nil
+}
+
+// Upload 处理初始信息：相同内容已上传时直接返回已有 CID 与记录，不再上传；
+// existing.Anchored() 为真时调用方应复用 existing.UpdateID，不要再创建更新
+func (d *Deduplicator) Upload(ctx context.Context, fileName string, content []byte) (info *BIMInitInfo, existing *Anchor, err error) {
+    existing, err = d.Check(ctx, content)
+    if err != nil {
+        return nil, nil, err
+    }
+    if existing != nil {
+        Logger().Info("文件内容已存在，跳过上传", "fileName", fileName, "cid", existing.CID, "updateId", existing.UpdateID)
+        algorithm := CurrentConfig().HashAlgorithm
+        if algorithm == "" {
+            algorithm = DefaultHashAlgorithm
+        }
+        fileHash, err := HashFile(algorithm, content)
+        if err != nil {
+            return nil, nil, err
+        }
+        return &BIMInitInfo{FileName: fileName, CID: existing.CID, FileHash: fileHash, HashAlgorithm: algorithm}, existing, nil
+    }
+    info, err = ProcessInitialInfo(ctx, fileName, content)
+    if err != nil {
+        return nil, nil, err
+    }
+    sum := sha256.Sum256(content)
+    err = d.Index.Put(&Anchor{FileHash: hex.EncodeToString(sum[:]), CID: info.CID, FileName: fileName, RecordedAt: time.Now()})
+    return info, nil, err
+}
+
+// HandleEvent 收到 BIMUpdateInitialized 事件后把更新引用的交付文件与附件记为已上链，
+// 其他客户端上链的文件也会因此进入本地索引
+func (d *Deduplicator) HandleEvent(eventName string, txID string, payload []byte) error {
+    if eventName != EventBIMInit {
+        return nil
+    }
+    var u LedgerUpdate
+    if err := json.Unmarshal(payload, &u); err != nil {
+        return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+    }
+    for _, att := range u.anchoredFiles() {
+        if att.SHA256 == "" {
+            continue
+        }
+        err := d.Index.Put(&Anchor{
+            FileHash:   strings.ToLower(att.SHA256),
+            CID:        att.CID,
+            FileName:   att.Name,
+            UpdateID:   u.UpdateID,
+            ModelID:    u.ModelID,
+            Version:    u.Version,
+            RecordedAt: time.Now(),
+        })
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
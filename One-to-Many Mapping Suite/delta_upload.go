@@ -0,0 +1,130 @@
+package mapping
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+)
+
+// -------------------------------
+//  差分上传（每日模型同步）
+// -------------------------------
+
+// DeltaRef 差分上传的记录：链上仍锚定完整文件的指纹（BIMInitInfo.FileHash），
+// 存储中只有上一版文件与本次差分，取回时由 Retriever 还原
+type DeltaRef struct {
+    BaseCID  string `json:"baseCid"`  // 上一版的 BIMInitInfo.CID
+    BaseHash string `json:"baseHash"` // 上一版完整文件的 SHA-256
+    CID      string `json:"cid"`      // 差分的 CID
+    URI      string `json:"uri"`      // 差分在存储后端中的地址
+    Size     int64  `json:"size"`     // 差分字节数
+    FullSize int64  `json:"fullSize"` // 完整文件字节数
+}
+
+// maxDeltaRatio 差分超过完整文件的这个比例时直接上传完整文件
+const maxDeltaRatio = 0.8
+
+// maxDeltaChain 还原时最多沿差分链回溯的版本数
+const maxDeltaChain = 64
+
+// UploadDelta 计算 content 相对上一版 previous（内容与 previousInfo 对应）的差分并只上传差分，
+// BIMInitInfo.CID 为完整文件按内容计算的 CID，FileHash 按配置的指纹算法计算。
+// 差分节省不明显（超过完整文件的 80%）时退回 ProcessInitialInfo 上传完整文件。
+func UploadDelta(ctx context.Context, fileName string, content []byte, previous []byte, previousInfo *BIMInitInfo) (*BIMInitInfo, error) {
+    if previousInfo == nil || len(previous) == 0 {
+        return ProcessInitialInfo(ctx, fileName, content)
+    }
+    delta := ComputeDelta(previous, content)
+    if float64(len(delta)) > maxDeltaRatio*float64(len(content)) {
+        Logger().Info("差分节省不足，上传完整文件", "fileName", fileName, "delta", len(delta), "size", len(content))
+        return ProcessInitialInfo(ctx, fileName, content)
+    }
+
+    algorithm := CurrentConfig().HashAlgorithm
+    if algorithm == "" {
+        algorithm = DefaultHashAlgorithm
+    }
+    fileHash, err := HashFile(algorithm, content)
+    if err != nil {
+        return nil, err
+    }
+    backend := CurrentStorageBackend()
+    obj, err := putFile(ctx, backend, fileName+".delta", delta)
+    if err != nil {
+        return nil, fmt.Errorf("上传差分失败: %v", err)
+    }
+
+    baseSum := sha256.Sum256(previous)
+    sum := sha256.Sum256(content)
+    Logger().Info("已上传差分", "fileName", fileName, "baseCid", previousInfo.CID, "delta", len(delta), "size", len(content))
+    return &BIMInitInfo{
+        FileName:       fileName,
+        CID:            contentCID(sum),
+        FileHash:       fileHash,
+        HashAlgorithm:  algorithm,
+        StorageBackend: backend.Type(),
+        Delta: &DeltaRef{
+            BaseCID:  previousInfo.CID,
+            BaseHash: hex.EncodeToString(baseSum[:]),
+            CID:      obj.CID,
+            URI:      obj.URI,
+            Size:     int64(len(delta)),
+            FullSize: int64(len(content)),
+        },
+    }, nil
+}
+
+// Retriever 取回文件，差分上传的版本沿差分链还原
+type Retriever struct {
+    Fetcher StorageFetcher
+    // Lookup 按 CID 查找某一版的 BIMInitInfo（如映射服务保存的提交记录），用于还原差分的上一版
+    Lookup func(ctx context.Context, cid string) (*BIMInitInfo, error)
+}
+
+// Retrieve 返回 info 对应的完整文件，并校验其 SHA-256 与 CID
+func (r *Retriever) Retrieve(ctx context.Context, info *BIMInitInfo) ([]byte, error) {
+    return r.retrieve(ctx, info, 0)
+}
+
+func (r *Retriever) retrieve(ctx context.Context, info *BIMInitInfo, depth int) ([]byte, error) {
+    if info.Delta == nil {
+        if info.StorageURI == "" {
+            return nil, fmt.Errorf("%s 没有存储地址", info.FileName)
+        }
+        return r.Fetcher.Get(ctx, info.StorageURI)
+    }
+    if depth >= maxDeltaChain {
+        return nil, fmt.Errorf("差分链超过 %d 个版本", maxDeltaChain)
+    }
+    if r.Lookup == nil {
+        return nil, errors.New("未配置 Lookup，无法还原差分的上一版")
+    }
+    baseInfo, err := r.Lookup(ctx, info.Delta.BaseCID)
+    if err != nil {
+        return nil, fmt.Errorf("查找上一版 %s 失败: %v", info.Delta.BaseCID, err)
+    }
+    if baseInfo == nil {
+        return nil, fmt.Errorf("上一版 %s 不存在", info.Delta.BaseCID)
+    }
+    base, err := r.retrieve(ctx, baseInfo, depth+1)
+    if err != nil {
+        return nil, err
+    }
+    delta, err := r.Fetcher.Get(ctx, info.Delta.URI)
+    if err != nil {
+        return nil, fmt.Errorf("下载差分失败: %v", err)
+    }
+    baseSum, targetSum, err := DeltaHashes(delta)
+    if err != nil {
+        return nil, err
+    }
+    if hex.EncodeToString(baseSum[:]) != info.Delta.BaseHash {
+        return nil, fmt.Errorf("差分 %s 不是基于上一版 %s 计算的", info.Delta.CID, info.Delta.BaseCID)
+    }
+    if contentCID(targetSum) != info.CID {
+        return nil, fmt.Errorf("差分 %s 还原的文件与 CID %s 不一致", info.Delta.CID, info.CID)
+    }
+    return ApplyDelta(base, delta)
+}
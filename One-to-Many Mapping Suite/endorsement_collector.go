@@ -0,0 +1,386 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  审批签名收集（BIMUpdateInitialized -> 审批人客户端决定并签名 -> 提交 ApproveBIMUpdate）
+// -------------------------------
+
+// 审批人的收集状态
+const (
+    CollectPending   = "PENDING"   // 已发出请求，等待审批人决定
+    CollectDecided   = "DECIDED"   // 审批人已决定，等待提交
+    CollectSubmitted = "SUBMITTED" // 审批已上链
+    CollectFailed    = "FAILED"
+    CollectCancelled = "CANCELLED" // 更新已有最终结果或服务停止
+)
+
+// ApprovalDecision 审批人的决定
+type ApprovalDecision struct {
+    Result     string `json:"result"` // APPROVED / REJECTED
+    ReasonCode string `json:"reasonCode,omitempty"`
+    Comment    string `json:"comment,omitempty"`
+}
+
+// SigningAPI 审批人客户端接口。审批人在自己的客户端上确认并用自己的私钥签名，私钥不离开客户端
+type SigningAPI interface {
+    // RequestDecision 请求审批人对更新作出决定，阻塞直到审批人答复或 ctx 取消
+    RequestDecision(ctx context.Context, approver Recipient, update *LedgerUpdate) (*ApprovalDecision, error)
+    // Sign 请求审批人客户端对交易提案摘要签名
+    Sign(ctx context.Context, approver Recipient, digest []byte) ([]byte, error)
+}
+
+// ApprovalSubmitter 以审批人身份提交 ApproveBIMUpdate。
+// 链码按调用者证书校验角色，因此提案须由审批人签名：实现方构造提案后把摘要交给 sign（离线签名），
+// 再背书并提交
+type ApprovalSubmitter interface {
+    SubmitApproval(ctx context.Context, approver Recipient, updateID string, decision *ApprovalDecision,
+        sign func(digest []byte) ([]byte, error)) error
+}
+
+// ApproverProgress 单个审批人的收集进度
+type ApproverProgress struct {
+    Approver  Recipient `json:"approver"`
+    State     string    `json:"state"`
+    Result    string    `json:"result,omitempty"`
+    Error     string    `json:"error,omitempty"`
+    UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// CollectionProgress 单个更新的收集进度
+type CollectionProgress struct {
+    UpdateID  string             `json:"updateId"`
+    ModelID   string             `json:"modelId"`
+    Version   string             `json:"version"`
+    StartedAt time.Time          `json:"startedAt"`
+    Approvers []ApproverProgress `json:"approvers"`
+    Outcome   string             `json:"outcome,omitempty"` // 收到审批 / 驳回事件后的最终结果
+}
+
+// EndorsementCollector 收到 BIMUpdateInitialized 事件后向模型的审批人请求决定与签名，
+// 并逐个提交审批，按更新记录进度
+type EndorsementCollector struct {
+    Directory Directory
+    Signing   SigningAPI
+    Submitter ApprovalSubmitter
+    // Timeout 等待单个审批人的上限，默认 72 小时
+    Timeout time.Duration
+
+    ctx    context.Context
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+
+    mu       sync.Mutex
+    progress map[string]*CollectionProgress
+    stops    map[string]context.CancelFunc
+    submitMu map[string]*sync.Mutex
+}
+
+// NewEndorsementCollector 创建审批签名收集器
+func NewEndorsementCollector(dir Directory, signing SigningAPI, submitter ApprovalSubmitter) *EndorsementCollector {
+    return &EndorsementCollector{
+        Directory: dir,
+        Signing:   signing,
+        Submitter: submitter,
+        Timeout:   72 * time.Hour,
+        progress:  map[string]*CollectionProgress{},
+        stops:     map[string]context.CancelFunc{},
+        submitMu:  map[string]*sync.Mutex{},
+    }
+}
+
+// Start 启动收集器；ctx 取消或调用 Stop 后未完成的收集全部取消
+func (c *EndorsementCollector) Start(ctx context.Context) {
+    c.ctx, c.cancel = context.WithCancel(ctx)
+}
+
+// Stop 取消未完成的收集并等待协程退出
+func (c *EndorsementCollector) Stop() {
+    c.cancel()
+    c.wg.Wait()
+}
+
+// HandleEvent 处理一条链码事件：事件监听服务收到事件后调用。
+// 新更新开始收集；审批 / 驳回事件结束该更新的收集；其他事件忽略
+func (c *EndorsementCollector) HandleEvent(eventName string, txID string, payload []byte) error {
+    switch eventName {
+    case EventBIMInit:
+        var u LedgerUpdate
+        if err := json.Unmarshal(payload, &u); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        return c.collect(txID, &u)
+    case EventBIMApprove, EventBIMReject:
+        var a LedgerApproval
+        if err := json.Unmarshal(payload, &a); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        c.finish(a.UpdateID, a.ApproveResult)
+    }
+    return nil
+}
+
+// Progress 返回更新的收集进度（副本）
+func (c *EndorsementCollector) Progress(updateID string) (*CollectionProgress, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    p, ok := c.progress[updateID]
+    if !ok {
+        return nil, false
+    }
+    cp := *p
+    cp.Approvers = append([]ApproverProgress(nil), p.Approvers...)
+    return &cp, true
+}
+
+// collect 为更新的每个审批人启动一个收集协程
+func (c *EndorsementCollector) collect(txID string, u *LedgerUpdate) error {
+    approvers, err := c.Directory.Approvers(u.ModelID)
+    if err != nil {
+        return fmt.Errorf("查询模型 %s 的审批人失败: %v", u.ModelID, err)
+    }
+
+    c.mu.Lock()
+    if _, ok := c.progress[u.UpdateID]; ok {
+        c.mu.Unlock()
+        return nil // 事件重放
+    }
+    now := time.Now()
+    p := &CollectionProgress{UpdateID: u.UpdateID, ModelID: u.ModelID, Version: u.Version, StartedAt: now}
+    for _, a := range approvers {
+        p.Approvers = append(p.Approvers, ApproverProgress{Approver: a, State: CollectPending, UpdatedAt: now})
+    }
+    ctx, cancel := context.WithCancel(c.ctx)
+    c.progress[u.UpdateID] = p
+    c.stops[u.UpdateID] = cancel
+    c.submitMu[u.UpdateID] = &sync.Mutex{}
+    c.mu.Unlock()
+
+    txLog(txID).Info("开始收集审批签名", "updateId", u.UpdateID, "approvers", len(approvers))
+    for i := range approvers {
+        c.wg.Add(1)
+        go func(i int) {
+            defer c.wg.Done()
+            c.collectOne(ctx, txID, u, i)
+        }(i)
+    }
+    return nil
+}
+
+// collectOne 请求一位审批人的决定并提交
+func (c *EndorsementCollector) collectOne(ctx context.Context, txID string, u *LedgerUpdate, i int) {
+    timeout := c.Timeout
+    if timeout <= 0 {
+        timeout = 72 * time.Hour
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    approver := c.approver(u.UpdateID, i)
+    log := txLog(txID).With("updateId", u.UpdateID, "approver", approver.UserID)
+
+    decision, err := c.Signing.RequestDecision(ctx, approver, u)
+    if err != nil {
+        c.fail(ctx, u.UpdateID, i, err)
+        log.Warn("未取得审批决定", "err", err)
+        return
+    }
+    c.setState(u.UpdateID, i, CollectDecided, decision.Result, "")
+
+    // 同一更新的审批逐个提交，避免并发写同一条记录导致 MVCC 冲突
+    c.mu.Lock()
+    submitMu := c.submitMu[u.UpdateID]
+    c.mu.Unlock()
+    submitMu.Lock()
+    defer submitMu.Unlock()
+    if ctx.Err() != nil {
+        c.fail(ctx, u.UpdateID, i, ctx.Err())
+        return
+    }
+    sign := func(digest []byte) ([]byte, error) {
+        return c.Signing.Sign(ctx, approver, digest)
+    }
+    if err := c.Submitter.SubmitApproval(ctx, approver, u.UpdateID, decision, sign); err != nil {
+        c.fail(ctx, u.UpdateID, i, err)
+        log.Error("提交审批失败", "err", err)
+        return
+    }
+    c.setState(u.UpdateID, i, CollectSubmitted, decision.Result, "")
+    log.Info("审批已提交", "result", decision.Result)
+}
+
+// finish 更新已有最终结果，取消其余审批人的收集
+func (c *EndorsementCollector) finish(updateID string, outcome string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if p, ok := c.progress[updateID]; ok {
+        p.Outcome = outcome
+    }
+    if cancel, ok := c.stops[updateID]; ok {
+        cancel()
+        delete(c.stops, updateID)
+    }
+}
+
+func (c *EndorsementCollector) approver(updateID string, i int) Recipient {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.progress[updateID].Approvers[i].Approver
+}
+
+func (c *EndorsementCollector) setState(updateID string, i int, state, result, errMsg string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    a := &c.progress[updateID].Approvers[i]
+    a.State, a.Result, a.Error, a.UpdatedAt = state, result, errMsg, time.Now()
+}
+
+// fail 记录失败；ctx 已取消（更新已有结果或服务停止）时记为取消
+func (c *EndorsementCollector) fail(ctx context.Context, updateID string, i int, err error) {
+    state := CollectFailed
+    if ctx.Err() == context.Canceled {
+        state = CollectCancelled
+    }
+    c.setState(updateID, i, state, "", err.Error())
+}
+
+// -------------------------------
+//  HTTP 签名接口
+// -------------------------------
+
+// HTTPSigningAPI 通过 HTTP 调用审批人客户端：
+//
+//	POST {endpoint}/approval-requests          提交审批请求，200 返回 ApprovalDecision，202 表示待决定
+//	GET  {endpoint}/approval-requests/{update} 查询决定，200 返回 ApprovalDecision，202 表示待决定
+//	POST {endpoint}/sign                       {"digest": base64} -> {"signature": base64}
+type HTTPSigningAPI struct {
+    // Endpoints 审批人 UserID -> 客户端地址
+    Endpoints map[string]string
+    // PollInterval 查询决定的间隔，默认 30 秒
+    PollInterval time.Duration
+    Client       *http.Client
+}
+
+// RequestDecision 提交审批请求并轮询直到审批人决定
+func (h *HTTPSigningAPI) RequestDecision(ctx context.Context, approver Recipient, update *LedgerUpdate) (*ApprovalDecision, error) {
+    endpoint, err := h.endpoint(approver)
+    if err != nil {
+        return nil, err
+    }
+    decision, err := h.decision(ctx, http.MethodPost, endpoint+"/approval-requests", update)
+    if err != nil || decision != nil {
+        return decision, err
+    }
+
+    interval := h.PollInterval
+    if interval <= 0 {
+        interval = 30 * time.Second
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        case <-ticker.C:
+        }
+        decision, err := h.decision(ctx, http.MethodGet, endpoint+"/approval-requests/"+url.PathEscape(update.UpdateID), nil)
+        if err != nil || decision != nil {
+            return decision, err
+        }
+    }
+}
+
+// Sign 请求审批人客户端签名
+func (h *HTTPSigningAPI) Sign(ctx context.Context, approver Recipient, digest []byte) ([]byte, error) {
+    endpoint, err := h.endpoint(approver)
+    if err != nil {
+        return nil, err
+    }
+    var result struct {
+        Signature string `json:"signature"`
+    }
+    status, err := h.do(ctx, http.MethodPost, endpoint+"/sign",
+        map[string]string{"digest": base64.StdEncoding.EncodeToString(digest)}, &result)
+    if err != nil {
+        return nil, err
+    }
+    if status != http.StatusOK {
+        return nil, fmt.Errorf("签名接口返回 %d", status)
+    }
+    sig, err := base64.StdEncoding.DecodeString(result.Signature)
+    if err != nil || len(sig) == 0 {
+        return nil, fmt.Errorf("签名接口返回的签名无效")
+    }
+    return sig, nil
+}
+
+// decision 调用审批请求接口；待决定时返回 nil, nil
+func (h *HTTPSigningAPI) decision(ctx context.Context, method, target string, body interface{}) (*ApprovalDecision, error) {
+    var d ApprovalDecision
+    status, err := h.do(ctx, method, target, body, &d)
+    if err != nil {
+        return nil, err
+    }
+    switch status {
+    case http.StatusAccepted:
+        return nil, nil
+    case http.StatusOK:
+        if d.Result != "APPROVED" && d.Result != "REJECTED" {
+            return nil, fmt.Errorf("审批结果无效: %q", d.Result)
+        }
+        return &d, nil
+    default:
+        return nil, fmt.Errorf("审批接口返回 %d", status)
+    }
+}
+
+// do 发送 JSON 请求，2xx 且有响应体时解析到 result
+func (h *HTTPSigningAPI) do(ctx context.Context, method, target string, body interface{}, result interface{}) (int, error) {
+    var rd io.Reader
+    if body != nil {
+        b, err := json.Marshal(body)
+        if err != nil {
+            return 0, err
+        }
+        rd = bytes.NewReader(b)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, target, rd)
+    if err != nil {
+        return 0, err
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+    resp, err := httpClient(h.Client).Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusOK {
+        if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+            return 0, fmt.Errorf("响应无法解析: %v", err)
+        }
+    }
+    return resp.StatusCode, nil
+}
+
+func (h *HTTPSigningAPI) endpoint(approver Recipient) (string, error) {
+    endpoint, ok := h.Endpoints[approver.UserID]
+    if !ok || endpoint == "" {
+        return "", fmt.Errorf("审批人 %s 未配置客户端地址", approver.UserID)
+    }
+    return strings.TrimSuffix(endpoint, "/"), nil
+}
@@ -0,0 +1,171 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+// -------------------------------
+//  WebSocket 事件推送
+// -------------------------------
+
+// EventHub 把链码事件经 WebSocket 推送给浏览器等客户端（HTTPGateway 的 GET /events）。
+// 注册到事件监听服务后由 HandleEvent 接收事件，每条事件以 BusEvent 的 JSON 作为一条文本消息发出。
+//
+// 客户端只收到自己能查询到的更新的事件：推送前以客户端的身份调用 Ledger.QueryUpdate（与 GET /updates/<UpdateID> 相同，
+// 应使用 CachedLedger 避免每条事件都查询 Peer），查询失败的事件与不带 UpdateID 的事件不推送。
+// 连接可带查询参数 modelId 只接收一个模型的事件。
+//
+// 每个客户端有独立的发送队列，推送不等待慢客户端；队列满的客户端被断开，重连后可经 GET /updates 补齐状态。
+type EventHub struct {
+    // Ledger 检查客户端能否查询事件所属的更新
+    Ledger LedgerQuerier
+    // Buffer 每个客户端排队的最大事件数，默认 64
+    Buffer int
+    // WriteTimeout 写一条消息的最长时间，默认 10s
+    WriteTimeout time.Duration
+    // Upgrader WebSocket 握手；默认只接受同源请求
+    Upgrader websocket.Upgrader
+
+    mu      sync.Mutex
+    clients map[*hubClient]struct{}
+}
+
+// hubConn 客户端连接，由 *websocket.Conn 实现
+type hubConn interface {
+    WriteMessage(messageType int, data []byte) error
+    ReadMessage() (messageType int, p []byte, err error)
+    SetWriteDeadline(t time.Time) error
+    Close() error
+}
+
+type hubClient struct {
+    conn    hubConn
+    ctx     context.Context // 携带客户端的查询身份
+    modelID string
+    events  chan *BusEvent
+
+    once sync.Once
+    done chan struct{}
+}
+
+// close 断开客户端，可重复调用
+func (c *hubClient) close() {
+    c.once.Do(func() {
+        close(c.done)
+        c.conn.Close()
+    })
+}
+
+// NewEventHub 创建事件推送
+func NewEventHub(ledger LedgerQuerier) *EventHub {
+    return &EventHub{Ledger: ledger, Buffer: 64, WriteTimeout: 10 * time.Second}
+}
+
+// HandleEvent 实现事件监听器接口，把事件交给全部客户端，不等待发送
+func (h *EventHub) HandleEvent(eventName string, txID string, payload []byte) error {
+    ev, err := NewBusEvent(eventName, txID, 0, payload)
+    if err != nil {
+        return err
+    }
+    if ev.UpdateID == "" {
+        return nil
+    }
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    for c := range h.clients {
+        if c.modelID != "" && ev.ModelID != "" && c.modelID != ev.ModelID {
+            continue
+        }
+        select {
+        case c.events <- ev:
+        default:
+            Logger().Warn("WebSocket 客户端跟不上事件，已断开", "identity", InvokeIdentity(c.ctx))
+            delete(h.clients, c)
+            c.close()
+        }
+    }
+    return nil
+}
+
+// Clients 返回已连接的客户端数
+func (h *EventHub) Clients() int {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    return len(h.clients)
+}
+
+// ServeHTTP 完成 WebSocket 握手并推送事件，直到客户端断开
+func (h *EventHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if h.Ledger == nil {
+        http.Error(w, "事件推送未配置账本查询", http.StatusNotImplemented)
+        return
+    }
+    conn, err := h.Upgrader.Upgrade(w, r, nil)
+    if err != nil {
+        // Upgrade 已写出错误响应
+        Logger().Warn("WebSocket 握手失败", "err", err)
+        return
+    }
+    h.serve(gatewayQueryContext(r), conn, r.URL.Query().Get("modelId"))
+}
+
+// serve 登记客户端并推送事件，直到连接断开
+func (h *EventHub) serve(ctx context.Context, conn hubConn, modelID string) {
+    size := h.Buffer
+    if size <= 0 {
+        size = 64
+    }
+    c := &hubClient{conn: conn, ctx: ctx, modelID: modelID, events: make(chan *BusEvent, size), done: make(chan struct{})}
+    h.mu.Lock()
+    if h.clients == nil {
+        h.clients = map[*hubClient]struct{}{}
+    }
+    h.clients[c] = struct{}{}
+    h.mu.Unlock()
+    defer func() {
+        h.mu.Lock()
+        delete(h.clients, c)
+        h.mu.Unlock()
+        c.close()
+    }()
+
+    // 客户端不发送消息；读取失败即连接已断开
+    go func() {
+        defer c.close()
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                return
+            }
+        }
+    }()
+
+    timeout := h.WriteTimeout
+    if timeout <= 0 {
+        timeout = 10 * time.Second
+    }
+    for {
+        select {
+        case <-c.done:
+            return
+        case ev := <-c.events:
+            // 与 GET /updates/<UpdateID> 相同的组织范围
+            if _, err := h.Ledger.QueryUpdate(ctx, ev.UpdateID); err != nil {
+                continue
+            }
+            data, err := json.Marshal(ev)
+            if err != nil {
+                continue
+            }
+            conn.SetWriteDeadline(time.Now().Add(timeout))
+            if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+                return
+            }
+        }
+    }
+}
@@ -0,0 +1,153 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeHubConn 内存中的 WebSocket 连接，Close 后读写失败，相当于客户端断开
+type fakeHubConn struct {
+    messages chan []byte
+    blocked  bool // 写入一直阻塞到断开，模拟跟不上的客户端
+    closed   chan struct{}
+    once     sync.Once
+}
+
+func newFakeHubConn() *fakeHubConn {
+    return &fakeHubConn{messages: make(chan []byte, 16), closed: make(chan struct{})}
+}
+
+func (c *fakeHubConn) WriteMessage(messageType int, data []byte) error {
+    if c.blocked {
+        <-c.closed
+        return errors.New("connection closed")
+    }
+    select {
+    case c.messages <- data:
+        return nil
+    case <-c.closed:
+        return errors.New("connection closed")
+    }
+}
+
+func (c *fakeHubConn) ReadMessage() (int, []byte, error) {
+    <-c.closed
+    return 0, nil, errors.New("connection closed")
+}
+
+func (c *fakeHubConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (c *fakeHubConn) Close() error {
+    c.once.Do(func() { close(c.closed) })
+    return nil
+}
+
+// next 返回客户端收到的下一条事件的 UpdateID，超时返回空串
+func (c *fakeHubConn) next(t *testing.T) string {
+    select {
+    case data := <-c.messages:
+        var ev BusEvent
+        if err := json.Unmarshal(data, &ev); err != nil {
+            t.Fatal(err)
+        }
+        return ev.UpdateID
+    case <-time.After(200 * time.Millisecond):
+        return ""
+    }
+}
+
+// denyingLedger 拒绝 deny 中列出的 "身份/更新" 的查询，模拟链码的组织范围
+type denyingLedger struct {
+    deny map[string]bool
+}
+
+func (l *denyingLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    if l.deny[InvokeIdentity(ctx)+"/"+updateID] {
+        return nil, errors.New(`{"Code":"UNAUTHORIZED"}`)
+    }
+    return []byte(`{}`), nil
+}
+
+func (l *denyingLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    return []byte(`{"Records":[]}`), nil
+}
+
+// connect 以 identity 连接 hub，等到客户端登记后返回
+func connect(t *testing.T, hub *EventHub, conn *fakeHubConn, identity string, modelID string) <-chan struct{} {
+    done := make(chan struct{})
+    before := hub.Clients()
+    go func() {
+        defer close(done)
+        hub.serve(WithIdentity(context.Background(), identity), conn, modelID)
+    }()
+    waitClients(t, hub, before+1)
+    return done
+}
+
+func waitClients(t *testing.T, hub *EventHub, want int) {
+    for deadline := time.Now().Add(time.Second); hub.Clients() != want; time.Sleep(time.Millisecond) {
+        if time.Now().After(deadline) {
+            t.Fatalf("%d clients connected, want %d", hub.Clients(), want)
+        }
+    }
+}
+
+func TestEventHubFansOutWithinScope(t *testing.T) {
+    hub := NewEventHub(&denyingLedger{deny: map[string]bool{"2001/u2": true}})
+    a, b, filtered := newFakeHubConn(), newFakeHubConn(), newFakeHubConn()
+    connect(t, hub, a, "1001", "")
+    connect(t, hub, b, "2001", "")
+    connect(t, hub, filtered, "1001", "m2")
+
+    hub.HandleEvent(EventBIMInit, "t1", []byte(`{"UpdateID":"u1","ModelID":"m1"}`))
+    hub.HandleEvent(EventBIMInit, "t2", []byte(`{"UpdateID":"u2","ModelID":"m1"}`))
+    hub.HandleEvent(EventModelWatchChanged, "t3", []byte(`{"ModelID":"m1","Watcher":"alice"}`))
+
+    if got := a.next(t) + "," + a.next(t); got != "u1,u2" {
+        t.Fatalf("1001 received %s, want u1,u2", got)
+    }
+    // u2 不在 2001 的组织范围内
+    if got := b.next(t) + "," + b.next(t); got != "u1," {
+        t.Fatalf("2001 received %s, want only u1", got)
+    }
+    if got := filtered.next(t); got != "" {
+        t.Fatalf("client of model m2 received %s", got)
+    }
+}
+
+func TestEventHubDropsDisconnectedClients(t *testing.T) {
+    hub := NewEventHub(&denyingLedger{})
+    hub.Buffer = 1
+    gone, slow, live := newFakeHubConn(), newFakeHubConn(), newFakeHubConn()
+    slow.blocked = true
+    goneDone := connect(t, hub, gone, "1001", "")
+    slowDone := connect(t, hub, slow, "1002", "")
+    connect(t, hub, live, "1003", "")
+
+    // 客户端断开后服务协程退出并注销
+    gone.Close()
+    select {
+    case <-goneDone:
+    case <-time.After(time.Second):
+        t.Fatal("serve did not return after the client disconnected")
+    }
+    waitClients(t, hub, 2)
+
+    // 跟不上的客户端在队列满后被断开，不拖慢其他客户端
+    for _, id := range []string{"u1", "u2", "u3"} {
+        hub.HandleEvent(EventBIMInit, "t-"+id, []byte(`{"UpdateID":"`+id+`","ModelID":"m1"}`))
+        if got := live.next(t); got != id {
+            t.Fatalf("live client received %q, want %s", got, id)
+        }
+    }
+    select {
+    case <-slowDone:
+    case <-time.After(time.Second):
+        t.Fatal("the slow client was not disconnected")
+    }
+    waitClients(t, hub, 1)
+}
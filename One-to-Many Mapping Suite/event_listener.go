@@ -0,0 +1,209 @@
+package mapping
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+// -------------------------------
+//  事件监听（检查点与重放）
+// -------------------------------
+
+// ChainEvent 已提交交易的一条链码事件
+type ChainEvent struct {
+    BlockNumber uint64
+    Name        string
+    TxID        string
+    Payload     []byte
+}
+
+// EventHandler 链码事件处理函数，与 Dispatcher、WatchList、CachedLedger 等的 HandleEvent 签名相同
+type EventHandler func(eventName string, txID string, payload []byte) error
+
+// CheckpointStore 保存事件监听的检查点：重启后从哪个区块（含）开始读取事件
+type CheckpointStore interface {
+    // LoadCheckpoint 没有检查点时返回 ok=false、err=nil
+    LoadCheckpoint() (next uint64, ok bool, err error)
+    SaveCheckpoint(next uint64) error
+}
+
+// FileCheckpoint 保存在本地文件中的检查点，先写临时文件再改名，崩溃时不会留下写了一半的检查点
+type FileCheckpoint struct {
+    Path string
+}
+
+// LoadCheckpoint 读取检查点，文件不存在时 ok 为 false
+func (f *FileCheckpoint) LoadCheckpoint() (uint64, bool, error) {
+    data, err := os.ReadFile(f.Path)
+    if errors.Is(err, os.ErrNotExist) {
+        return 0, false, nil
+    }
+    if err != nil {
+        return 0, false, fmt.Errorf("读取检查点失败: %v", err)
+    }
+    next, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+    if err != nil {
+        return 0, false, fmt.Errorf("检查点文件 %s 格式错误: %v", f.Path, err)
+    }
+    return next, true, nil
+}
+
+// SaveCheckpoint 写入检查点
+func (f *FileCheckpoint) SaveCheckpoint(next uint64) error {
+    if err := os.MkdirAll(filepath.Dir(f.Path), 0o700); err != nil {
+        return err
+    }
+    tmp := f.Path + ".tmp"
+    if err := os.WriteFile(tmp, []byte(strconv.FormatUint(next, 10)+"\n"), 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, f.Path)
+}
+
+// EventListener 事件监听服务：把链码事件按提交顺序依次交给各个处理器，一个区块的事件全部处理后保存检查点，
+// 重启后从检查点继续，不丢失停机期间提交的事件。
+//
+// 投递语义为至少一次：检查点之后、停机之前已处理的事件会重放，处理器须能承受重复事件
+// （各 HandleEvent 都按事件内容覆盖状态）。处理器返回错误时记录日志，不阻塞后续事件。
+//
+// 只在内存中保存状态的处理器（如 WatchList）经 Replay 添加：订阅从更早的区块开始，
+// 检查点之前的事件只交给它们，重建停机前的状态，其余处理器仍从检查点开始。
+//
+// 经 Publish 接入 EventPublisher 后，事件在处理器之后进入发布队列，检查点改为在总线确认后推进，
+// 未确认的事件重启后重放。
+type EventListener struct {
+    Checkpoint CheckpointStore
+
+    replays   []namedHandler // 检查点之前的事件也处理
+    handlers  []namedHandler
+    publisher *EventPublisher
+
+    mu    sync.Mutex
+    saved uint64 // 已保存的检查点，只增不减
+}
+
+type namedHandler struct {
+    name string
+    h    EventHandler
+}
+
+// NewEventListener 创建事件监听，checkpoint 为空时不保存检查点
+func NewEventListener(checkpoint CheckpointStore) *EventListener {
+    return &EventListener{Checkpoint: checkpoint}
+}
+
+// Handle 添加处理器，按添加顺序同步调用；name 用于日志。须在 Run 之前调用
+func (l *EventListener) Handle(name string, h EventHandler) {
+    l.handlers = append(l.handlers, namedHandler{name: name, h: h})
+}
+
+// Replay 添加重建内存状态的处理器，每条事件先交给它们再交给 Handle 添加的处理器。
+// 有此类处理器时订阅须从 SubscribeBlock 返回的区块开始。须在 Run 之前调用
+func (l *EventListener) Replay(name string, h EventHandler) {
+    l.replays = append(l.replays, namedHandler{name: name, h: h})
+}
+
+// Publish 把事件交给 p 发布，检查点随 p 的 OnPublished 推进（保留 p 原有的 OnPublished）。
+// 须在 p.Start 与 Run 之前调用
+func (l *EventListener) Publish(p *EventPublisher) {
+    published := p.OnPublished
+    p.OnPublished = func(last *BusEvent) {
+        if published != nil {
+            published(last)
+        }
+        // 同一区块后续的事件可能还在队列中，重启后从该区块重放
+        l.save(last.BlockNumber)
+    }
+    l.publisher = p
+}
+
+// StartBlock 返回订阅应开始的区块：有检查点时为检查点，否则为 from
+func (l *EventListener) StartBlock(from uint64) (uint64, error) {
+    if l.Checkpoint == nil {
+        return from, nil
+    }
+    next, ok, err := l.Checkpoint.LoadCheckpoint()
+    if err != nil || !ok {
+        return from, err
+    }
+    l.mu.Lock()
+    l.saved = next
+    l.mu.Unlock()
+    return next, nil
+}
+
+// SubscribeBlock 返回订阅应开始的区块：有 Replay 处理器时为 start（重建状态的起点），否则为 from
+func (l *EventListener) SubscribeBlock(start uint64, from uint64) uint64 {
+    if len(l.replays) > 0 && start < from {
+        return start
+    }
+    return from
+}
+
+// Run 处理 events 直到 ctx 结束（返回 nil）或 events 关闭（返回错误）。
+// 订阅源可能从更早的区块开始投递，from 之前的事件只交给 Replay 添加的处理器。
+func (l *EventListener) Run(ctx context.Context, from uint64, events <-chan ChainEvent) error {
+    var block uint64
+    started := false
+    for {
+        select {
+        case <-ctx.Done():
+            return nil
+        case ev, ok := <-events:
+            if !ok {
+                return errors.New("事件流已关闭")
+            }
+            if ev.BlockNumber < from {
+                l.handle(l.replays, ev)
+                continue
+            }
+            if started && ev.BlockNumber > block && l.publisher == nil {
+                // 区块按顺序投递，新区块的事件到达说明之前的区块已处理完
+                l.save(block + 1)
+            }
+            block, started = ev.BlockNumber, true
+            l.dispatch(ev)
+        }
+    }
+}
+
+// dispatch 把一条事件交给全部处理器，再交给发布器
+func (l *EventListener) dispatch(ev ChainEvent) {
+    l.handle(l.replays, ev)
+    l.handle(l.handlers, ev)
+    if l.publisher == nil {
+        return
+    }
+    if err := l.publisher.HandleBlockEvent(ev.BlockNumber, ev.Name, ev.TxID, ev.Payload); err != nil {
+        Logger().Warn("事件无法发布", "event", ev.Name, "txID", ev.TxID, "err", err)
+    }
+}
+
+// handle 把一条事件依次交给 handlers，错误只记录日志
+func (l *EventListener) handle(handlers []namedHandler, ev ChainEvent) {
+    for _, nh := range handlers {
+        if err := nh.h(ev.Name, ev.TxID, ev.Payload); err != nil {
+            Logger().Warn("事件处理失败", "handler", nh.name, "event", ev.Name, "txID", ev.TxID, "block", ev.BlockNumber, "err", err)
+        }
+    }
+}
+
+// save 保存检查点 next，不回退
+func (l *EventListener) save(next uint64) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.Checkpoint == nil || next <= l.saved {
+        return
+    }
+    if err := l.Checkpoint.SaveCheckpoint(next); err != nil {
+        Logger().Error("保存事件检查点失败", "block", next, "err", err)
+        return
+    }
+    l.saved = next
+}
@@ -0,0 +1,173 @@
+package mapping
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// eventStream 返回依次投递 events 后关闭的事件流
+func eventStream(events ...ChainEvent) <-chan ChainEvent {
+    ch := make(chan ChainEvent, len(events))
+    for _, ev := range events {
+        ch <- ev
+    }
+    close(ch)
+    return ch
+}
+
+func TestEventListenerResumesFromCheckpoint(t *testing.T) {
+    checkpoint := &FileCheckpoint{Path: filepath.Join(t.TempDir(), "listener", "checkpoint")}
+    chain := []ChainEvent{
+        {BlockNumber: 5, Name: "BIMUpdateInitialized", TxID: "t1"},
+        {BlockNumber: 5, Name: "BIMUpdateInitialized", TxID: "t2"},
+        {BlockNumber: 6, Name: "BIMUpdateApproved", TxID: "t3"},
+        {BlockNumber: 8, Name: "BIMUpdatePublished", TxID: "t4"},
+    }
+
+    var handled []string
+    l := NewEventListener(checkpoint)
+    l.Handle("record", func(eventName string, txID string, payload []byte) error {
+        handled = append(handled, txID)
+        return nil
+    })
+    l.Handle("failing", func(eventName string, txID string, payload []byte) error {
+        return errors.New("unavailable")
+    })
+    from, err := l.StartBlock(5)
+    if err != nil || from != 5 {
+        t.Fatalf("StartBlock without checkpoint = %d, %v; want 5", from, err)
+    }
+    if err := l.Run(context.Background(), from, eventStream(chain...)); err == nil {
+        t.Fatal("Run returned nil after the stream closed")
+    }
+    if got := strings.Join(handled, ","); got != "t1,t2,t3,t4" {
+        t.Fatalf("handled %s, want t1,t2,t3,t4 despite the failing handler", got)
+    }
+
+    // 区块 8 可能还有未到达的事件，检查点停在区块 6 之后
+    next, ok, err := checkpoint.LoadCheckpoint()
+    if err != nil || !ok || next != 7 {
+        t.Fatalf("checkpoint = %d, %v, %v; want 7", next, ok, err)
+    }
+
+    // 重启：订阅源从更早的区块重放，检查点之前的事件跳过
+    handled = nil
+    restarted := NewEventListener(checkpoint)
+    restarted.Handle("record", func(eventName string, txID string, payload []byte) error {
+        handled = append(handled, txID)
+        return nil
+    })
+    if from, err = restarted.StartBlock(0); err != nil || from != 7 {
+        t.Fatalf("StartBlock after restart = %d, %v; want 7", from, err)
+    }
+    restarted.Run(context.Background(), from, eventStream(chain...))
+    if got := strings.Join(handled, ","); got != "t4" {
+        t.Fatalf("handled after restart %s, want t4", got)
+    }
+}
+
+// recordingSink 记录发布的批次
+type recordingSink struct {
+    mu      sync.Mutex
+    batches [][]string
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) PublishBatch(ctx context.Context, events []*BusEvent) error {
+    var ids []string
+    for _, e := range events {
+        ids = append(ids, e.EventID)
+    }
+    s.mu.Lock()
+    s.batches = append(s.batches, ids)
+    s.mu.Unlock()
+    return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+// memoryCheckpoint 记录每次保存的检查点
+type memoryCheckpoint struct {
+    mu    sync.Mutex
+    saves []uint64
+}
+
+func (c *memoryCheckpoint) LoadCheckpoint() (uint64, bool, error) { return 0, false, nil }
+
+func (c *memoryCheckpoint) SaveCheckpoint(next uint64) error {
+    c.mu.Lock()
+    c.saves = append(c.saves, next)
+    c.mu.Unlock()
+    return nil
+}
+
+func TestEventListenerCheckpointFollowsPublisher(t *testing.T) {
+    checkpoint := &memoryCheckpoint{}
+    sink := &recordingSink{}
+    publisher := NewEventPublisher(sink)
+    publisher.BatchSize = 2
+
+    l := NewEventListener(checkpoint)
+    l.Publish(publisher)
+    publisher.Start(context.Background(), 10)
+    var events []ChainEvent
+    for i, block := range []uint64{3, 3, 4, 6} {
+        events = append(events, ChainEvent{BlockNumber: block, Name: "BIMUpdateInitialized", TxID: fmt.Sprintf("t%d", i+1), Payload: []byte(`{"UpdateID":"u1"}`)})
+    }
+    l.Run(context.Background(), 0, eventStream(events...))
+
+    if err := publisher.Stop(); err != nil {
+        t.Fatal(err)
+    }
+    if len(sink.batches) != 2 {
+        t.Fatalf("published %v, want two batches", sink.batches)
+    }
+    // 检查点只在每批确认后推进到批内最后一个事件的区块，不随处理进度推进
+    if got := fmt.Sprint(checkpoint.saves); got != "[3 6]" {
+        t.Fatalf("checkpoints %s, want [3 6]", got)
+    }
+}
+
+func TestEventListenerReplaysWatchList(t *testing.T) {
+    checkpoint := &FileCheckpoint{Path: filepath.Join(t.TempDir(), "checkpoint")}
+    if err := checkpoint.SaveCheckpoint(7); err != nil {
+        t.Fatal(err)
+    }
+    watches := NewWatchList(func(identity string) (*Recipient, error) {
+        return &Recipient{UserID: identity}, nil
+    })
+    var handled []string
+    l := NewEventListener(checkpoint)
+    l.Replay("watch list", watches.HandleEvent)
+    l.Handle("record", func(eventName string, txID string, payload []byte) error {
+        handled = append(handled, txID)
+        return nil
+    })
+
+    from, err := l.StartBlock(0)
+    if err != nil || from != 7 {
+        t.Fatalf("StartBlock = %d, %v; want 7", from, err)
+    }
+    if subscribe := l.SubscribeBlock(0, from); subscribe != 0 {
+        t.Fatalf("SubscribeBlock = %d, want 0 to rebuild the watch list", subscribe)
+    }
+    l.Run(context.Background(), from, eventStream(
+        ChainEvent{BlockNumber: 2, Name: EventModelWatchChanged, TxID: "t1", Payload: []byte(`{"ModelID":"m1","Watcher":"alice"}`)},
+        ChainEvent{BlockNumber: 8, Name: EventBIMApprove, TxID: "t2", Payload: []byte(`{"UpdateID":"u1","ModelID":"m1"}`)},
+    ))
+
+    // 检查点之前的关注变更只用于重建状态，不交给其他处理器
+    if got := strings.Join(handled, ","); got != "t2" {
+        t.Fatalf("handled %s, want t2", got)
+    }
+    watchers, err := watches.Watchers("m1", EventBIMApprove)
+    if err != nil || len(watchers) != 1 || watchers[0].UserID != "alice" {
+        t.Fatalf("watchers after restart = %v, %v; want alice", watchers, err)
+    }
+}
@@ -0,0 +1,373 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/nats-io/nats.go"
+    "github.com/segmentio/kafka-go"
+)
+
+// -------------------------------
+//  事件总线发布（Kafka / NATS JetStream）
+// -------------------------------
+
+// BusEvent 发往企业集成总线的 BIM 生命周期事件。
+//
+// 投递语义为至少一次：发布失败的批次会整批重发；经 EventListener.Publish 接入时，
+// 检查点在总线确认后才推进，监听服务重启后从检查点重放未确认的事件，同一事件可能到达多次。消费方应以 EventID 做幂等处理，例如以 EventID 为主键写库，
+// 或在同一事务中记录已处理的 EventID。同一 ModelID 的事件按链上提交顺序到达。
+type BusEvent struct {
+    EventID     string          `json:"eventId"` // <TxID>/<Event>，链码每笔交易只有一个事件
+    Event       string          `json:"event"`
+    TxID        string          `json:"txId"`
+    BlockNumber uint64          `json:"blockNumber,omitempty"`
+    ModelID     string          `json:"modelId,omitempty"`
+    UpdateID    string          `json:"updateId,omitempty"`
+    Payload     json.RawMessage `json:"payload"`
+}
+
+// NewBusEvent 由链码事件构造总线事件，ModelID / UpdateID 取自事件内容
+func NewBusEvent(eventName string, txID string, blockNumber uint64, payload []byte) (*BusEvent, error) {
+    if eventName == "" || txID == "" {
+        return nil, errors.New("事件名与交易 ID 不能为空")
+    }
+    var ids struct {
+        ModelID  string `json:"ModelID"`
+        UpdateID string `json:"UpdateID"`
+    }
+    if len(payload) > 0 {
+        if err := json.Unmarshal(payload, &ids); err != nil {
+            return nil, fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+    } else {
+        payload = []byte("null")
+    }
+    return &BusEvent{
+        EventID:     txID + "/" + eventName,
+        Event:       eventName,
+        TxID:        txID,
+        BlockNumber: blockNumber,
+        ModelID:     ids.ModelID,
+        UpdateID:    ids.UpdateID,
+        Payload:     json.RawMessage(payload),
+    }, nil
+}
+
+// orderingKey 分区 / 排序键：同一模型的事件落在同一分区
+func (e *BusEvent) orderingKey() string {
+    if e.ModelID != "" {
+        return e.ModelID
+    }
+    return e.UpdateID
+}
+
+// BusSink 消息总线
+type BusSink interface {
+    Name() string
+    // PublishBatch 按顺序发布整批事件，全部被总线确认后才返回 nil；返回错误时整批重发
+    PublishBatch(ctx context.Context, events []*BusEvent) error
+    Close() error
+}
+
+// EventPublisher 将链码事件分批、限速发布到消息总线。
+// 只有一个发布协程，批次按事件到达顺序依次发布，前一批确认前不会发布下一批。
+type EventPublisher struct {
+    Sink BusSink
+
+    BatchSize     int           // 每批最多事件数，默认 100
+    FlushInterval time.Duration // 未攒满一批时的最长等待，默认 1s
+    // RatePerSecond 每秒最多发布的事件数，0 表示不限
+    RatePerSecond int
+
+    // MaxAttempts 每批最多尝试次数；0 表示一直重试直到 Stop（保证至少一次），
+    // 大于 0 时重试耗尽的批次交给 OnDeadLetter 后继续发布后续事件
+    MaxAttempts int
+    Backoff     time.Duration // 首次重试间隔，之后翻倍，最长 1 分钟，默认 2s
+
+    // OnPublished 每批确认后调用，last 为批内最后一条事件。
+    // EventListener.Publish 在此保存区块检查点（last.BlockNumber），重启后从检查点重放。
+    OnPublished  func(last *BusEvent)
+    OnDeadLetter func(events []*BusEvent, err error)
+
+    queue chan *BusEvent
+    wg    sync.WaitGroup
+}
+
+// NewEventPublisher 创建发布器，使用默认批量与重试参数
+func NewEventPublisher(sink BusSink) *EventPublisher {
+    return &EventPublisher{
+        Sink:          sink,
+        BatchSize:     100,
+        FlushInterval: time.Second,
+        Backoff:       2 * time.Second,
+    }
+}
+
+// Start 启动发布协程，队列容量为 queueSize；队列满时 HandleEvent 阻塞，反压事件监听
+func (p *EventPublisher) Start(ctx context.Context, queueSize int) {
+    p.queue = make(chan *BusEvent, queueSize)
+    p.wg.Add(1)
+    go func() {
+        defer p.wg.Done()
+        p.run(ctx)
+    }()
+}
+
+// Stop 关闭队列，发布剩余事件后关闭总线连接
+func (p *EventPublisher) Stop() error {
+    close(p.queue)
+    p.wg.Wait()
+    return p.Sink.Close()
+}
+
+// HandleEvent 处理一条链码事件，签名与 Dispatcher.HandleEvent 相同，可挂在同一个事件监听上
+func (p *EventPublisher) HandleEvent(eventName string, txID string, payload []byte) error {
+    return p.HandleBlockEvent(0, eventName, txID, payload)
+}
+
+// HandleBlockEvent 同 HandleEvent，附带事件所在区块号，供 OnPublished 保存检查点；
+// 经 HandleEvent 进入的事件区块号为 0，不推进检查点
+func (p *EventPublisher) HandleBlockEvent(blockNumber uint64, eventName string, txID string, payload []byte) error {
+    e, err := NewBusEvent(eventName, txID, blockNumber, payload)
+    if err != nil {
+        return err
+    }
+    p.queue <- e
+    return nil
+}
+
+// run 攒批并依次发布
+func (p *EventPublisher) run(ctx context.Context) {
+    size := p.BatchSize
+    if size <= 0 {
+        size = 100
+    }
+    interval := p.FlushInterval
+    if interval <= 0 {
+        interval = time.Second
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    var next time.Time // 限速：下一批最早的发布时间
+    batch := make([]*BusEvent, 0, size)
+    flush := func() {
+        if len(batch) == 0 {
+            return
+        }
+        if wait := time.Until(next); wait > 0 {
+            select {
+            case <-ctx.Done():
+            case <-time.After(wait):
+            }
+        }
+        p.publish(ctx, batch)
+        if p.RatePerSecond > 0 {
+            next = time.Now().Add(time.Duration(len(batch)) * time.Second / time.Duration(p.RatePerSecond))
+        }
+        batch = make([]*BusEvent, 0, size)
+    }
+
+    for {
+        select {
+        case e, ok := <-p.queue:
+            if !ok {
+                flush()
+                return
+            }
+            batch = append(batch, e)
+            if len(batch) >= size {
+                flush()
+            }
+        case <-ticker.C:
+            flush()
+        }
+    }
+}
+
+// publish 发布一批事件，失败时按指数退避整批重发
+func (p *EventPublisher) publish(ctx context.Context, batch []*BusEvent) {
+    wait := p.Backoff
+    if wait <= 0 {
+        wait = 2 * time.Second
+    }
+    log := Logger().With("sink", p.Sink.Name(), "events", len(batch), "firstTx", batch[0].TxID)
+
+    var err error
+    for attempt := 1; ; attempt++ {
+        if err = p.Sink.PublishBatch(ctx, batch); err == nil {
+            log.Debug("事件已发布", "attempt", attempt)
+            if p.OnPublished != nil {
+                p.OnPublished(batch[len(batch)-1])
+            }
+            return
+        }
+        log.Warn("事件发布失败", "attempt", attempt, "err", err)
+        if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+            break
+        }
+        select {
+        case <-ctx.Done():
+            err = ctx.Err()
+            log.Error("停止重试，事件未发布，需从检查点重放", "err", err)
+            return
+        case <-time.After(wait):
+        }
+        if wait *= 2; wait > time.Minute {
+            wait = time.Minute
+        }
+    }
+    log.Error("事件发布重试耗尽", "err", err)
+    if p.OnDeadLetter != nil {
+        p.OnDeadLetter(batch, err)
+    }
+}
+
+// -------------------------------
+//  Kafka
+// -------------------------------
+
+// Kafka 消息头
+const (
+    KafkaHeaderEventID = "bim-event-id"
+    KafkaHeaderEvent   = "bim-event"
+)
+
+// KafkaSink 发布到 Kafka 主题：消息键为 ModelID（按哈希分区，同一模型有序），
+// 消息头 bim-event-id 供消费方去重
+type KafkaSink struct {
+    Writer *kafka.Writer
+}
+
+// NewKafkaSink 创建 Kafka 发布端，要求所有同步副本确认
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+    return &KafkaSink{Writer: &kafka.Writer{
+        Addr:         kafka.TCP(brokers...),
+        Topic:        topic,
+        Balancer:     &kafka.Hash{},
+        RequiredAcks: kafka.RequireAll,
+        // 重试由 EventPublisher 整批进行，避免批内部分重试打乱顺序
+        MaxAttempts: 1,
+        // 批次由 EventPublisher 组织，Writer 不再额外等待
+        BatchSize:    10000,
+        BatchTimeout: 10 * time.Millisecond,
+    }}
+}
+
+// Name 总线名
+func (k *KafkaSink) Name() string { return "kafka" }
+
+// PublishBatch 同步写入整批消息
+func (k *KafkaSink) PublishBatch(ctx context.Context, events []*BusEvent) error {
+    msgs := make([]kafka.Message, 0, len(events))
+    for _, e := range events {
+        value, err := json.Marshal(e)
+        if err != nil {
+            return err
+        }
+        msgs = append(msgs, kafka.Message{
+            Key:   []byte(e.orderingKey()),
+            Value: value,
+            Headers: []kafka.Header{
+                {Key: KafkaHeaderEventID, Value: []byte(e.EventID)},
+                {Key: KafkaHeaderEvent, Value: []byte(e.Event)},
+            },
+        })
+    }
+    return k.Writer.WriteMessages(ctx, msgs...)
+}
+
+// Close 关闭 Writer
+func (k *KafkaSink) Close() error { return k.Writer.Close() }
+
+// -------------------------------
+//  NATS JetStream
+// -------------------------------
+
+// NATS 消息头；Nats-Msg-Id 设为 EventID，JetStream 在去重窗口内丢弃重发的事件
+const (
+    NATSHeaderModelID = "Bim-Model-Id"
+    NATSHeaderBlock   = "Bim-Block"
+)
+
+// NATSSink 发布到 JetStream，主题为 <SubjectPrefix>.<事件名>，例如 bim.events.BIMUpdateApproved。
+// 流需覆盖 <SubjectPrefix>.>；同一连接上的异步发布按顺序到达。
+type NATSSink struct {
+    Conn          *nats.Conn
+    JS            nats.JetStreamContext
+    SubjectPrefix string
+    // AckTimeout 等待一批确认的最长时间，默认 10s
+    AckTimeout time.Duration
+}
+
+// NewNATSSink 连接 NATS 并创建 JetStream 发布端
+func NewNATSSink(url string, subjectPrefix string, opts ...nats.Option) (*NATSSink, error) {
+    if subjectPrefix == "" || strings.ContainsAny(subjectPrefix, "*> ") {
+        return nil, fmt.Errorf("无效的主题前缀 %q", subjectPrefix)
+    }
+    nc, err := nats.Connect(url, append([]nats.Option{nats.Name("bim-event-publisher")}, opts...)...)
+    if err != nil {
+        return nil, fmt.Errorf("连接 NATS 失败: %v", err)
+    }
+    js, err := nc.JetStream()
+    if err != nil {
+        nc.Close()
+        return nil, fmt.Errorf("获取 JetStream 上下文失败: %v", err)
+    }
+    return &NATSSink{Conn: nc, JS: js, SubjectPrefix: subjectPrefix, AckTimeout: 10 * time.Second}, nil
+}
+
+// Name 总线名
+func (n *NATSSink) Name() string { return "nats" }
+
+// PublishBatch 异步发布整批消息并等待全部确认
+func (n *NATSSink) PublishBatch(ctx context.Context, events []*BusEvent) error {
+    timeout := n.AckTimeout
+    if timeout <= 0 {
+        timeout = 10 * time.Second
+    }
+    futures := make([]nats.PubAckFuture, 0, len(events))
+    for _, e := range events {
+        data, err := json.Marshal(e)
+        if err != nil {
+            return err
+        }
+        msg := nats.NewMsg(n.SubjectPrefix + "." + e.Event)
+        msg.Header.Set(nats.MsgIdHdr, e.EventID)
+        msg.Header.Set(NATSHeaderModelID, e.orderingKey())
+        if e.BlockNumber > 0 {
+            msg.Header.Set(NATSHeaderBlock, strconv.FormatUint(e.BlockNumber, 10))
+        }
+        msg.Data = data
+        f, err := n.JS.PublishMsgAsync(msg)
+        if err != nil {
+            return fmt.Errorf("发布事件 %s 失败: %v", e.EventID, err)
+        }
+        futures = append(futures, f)
+    }
+
+    deadline := time.NewTimer(timeout)
+    defer deadline.Stop()
+    for i, f := range futures {
+        select {
+        case <-f.Ok():
+        case err := <-f.Err():
+            return fmt.Errorf("事件 %s 未被确认: %v", events[i].EventID, err)
+        case <-deadline.C:
+            return fmt.Errorf("等待事件 %s 确认超时", events[i].EventID)
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+    return nil
+}
+
+// Close 发送完缓冲中的消息后关闭连接
+func (n *NATSSink) Close() error { return n.Conn.Drain() }
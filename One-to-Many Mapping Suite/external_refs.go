@@ -0,0 +1,58 @@
+package mapping
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  外部 CDE 引用（Forge / BIM 360）
+// -------------------------------
+
+// ExternalRef 指向云端 CDE 条目的引用，字段与链码 ExternalRef 一致
+type ExternalRef struct {
+    System  string `json:"System"` // forge / bim360
+    ID      string `json:"ID"`
+    Project string `json:"Project,omitempty"` // BIM 360 项目 ID，bim360 引用必填
+    Version string `json:"Version,omitempty"`
+}
+
+// ExternalRefResolver 在提交时解析外部引用，条目不存在、无权访问或版本不符时返回错误；
+// forge.Client 即为 APS 实现
+type ExternalRefResolver interface {
+    ValidateRef(ctx context.Context, system, project, id, version string) error
+}
+
+// externalRefTimeout 解析全部引用的时限，避免 CDE 不可用时阻塞提交
+const externalRefTimeout = 15 * time.Second
+
+var (
+    refResolverMu     sync.RWMutex
+    activeRefResolver ExternalRefResolver
+)
+
+// UseExternalRefResolver 启用外部引用解析，之后 PackageProjectTransaction 在封装前校验 BIM.ExternalRefs；传 nil 关闭
+func UseExternalRefResolver(r ExternalRefResolver) {
+    refResolverMu.Lock()
+    activeRefResolver = r
+    refResolverMu.Unlock()
+}
+
+// CurrentExternalRefResolver 返回当前启用的外部引用解析器，未启用时为 nil
+func CurrentExternalRefResolver() ExternalRefResolver {
+    refResolverMu.RLock()
+    defer refResolverMu.RUnlock()
+    return activeRefResolver
+}
+
+// ResolveExternalRefs 逐个校验引用，返回第一个失败的引用及原因
+func ResolveExternalRefs(ctx context.Context, r ExternalRefResolver, refs []ExternalRef) error {
+    for i, ref := range refs {
+        if err := r.ValidateRef(ctx, ref.System, ref.Project, ref.ID, ref.Version); err != nil {
+            return fmt.Errorf("外部引用 %d（%s %s）无效: %v", i, ref.System, ref.ID, err)
+        }
+    }
+    return nil
+}
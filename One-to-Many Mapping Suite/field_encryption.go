@@ -0,0 +1,353 @@
+package mapping
+
+import (
+    "crypto"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/ecdh"
+    "crypto/ecdsa"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+)
+
+// -------------------------------
+//  链上字段加密（项目数据密钥，按组织封装）
+// -------------------------------
+
+// 同一通道内有竞争单位时，Description、审批 Comment 与变更清单内容在客户端用项目数据密钥
+// AES-256-GCM 加密后再上链 / 上传。数据密钥按组织用其公钥封装分发，链码只看到密文。
+//
+// 密文格式：enc:v1:<KeyID>:<base64url(nonce || ciphertext)>
+// 附加数据（AAD）为 "<项目ID>/<字段名>"，密文不能挪到其他项目或其他字段中使用。
+
+// SealedPrefix 加密字段的前缀
+const SealedPrefix = "enc:v1:"
+
+// 加密字段名，参与 AAD
+const (
+    FieldDescription = "Description"
+    FieldComment     = "Comment"
+    FieldManifest    = "Manifest"
+)
+
+// ErrUnknownDataKey 本地没有解密所需的项目数据密钥
+var ErrUnknownDataKey = errors.New("没有对应的项目数据密钥")
+
+// ProjectKey 项目数据密钥（AES-256）
+type ProjectKey struct {
+    ProjectID string
+    // KeyID 由密钥内容派生，随密文保存以便轮换后仍能解密旧数据
+    KeyID string
+    key   []byte
+}
+
+// NewProjectKey 为项目生成新的数据密钥
+func NewProjectKey(projectID string) (*ProjectKey, error) {
+    key := make([]byte, 32)
+    if _, err := rand.Read(key); err != nil {
+        return nil, err
+    }
+    return projectKeyFrom(projectID, key)
+}
+
+func projectKeyFrom(projectID string, key []byte) (*ProjectKey, error) {
+    if projectID == "" {
+        return nil, errors.New("项目 ID 不能为空")
+    }
+    if len(key) != 32 {
+        return nil, fmt.Errorf("数据密钥长度应为 32 字节，实际 %d", len(key))
+    }
+    sum := sha256.Sum256(append([]byte("bim-data-key-id:"), key...))
+    return &ProjectKey{ProjectID: projectID, KeyID: hex.EncodeToString(sum[:8]), key: key}, nil
+}
+
+// Seal 加密 field 字段的明文，返回 enc:v1: 格式字符串；空串原样返回
+func (k *ProjectKey) Seal(field string, plaintext string) (string, error) {
+    if plaintext == "" {
+        return "", nil
+    }
+    sealed, err := k.SealBytes(field, []byte(plaintext))
+    if err != nil {
+        return "", err
+    }
+    return string(sealed), nil
+}
+
+// SealBytes 加密任意数据（如变更清单 JSON），结果同样是 enc:v1: 格式
+func (k *ProjectKey) SealBytes(field string, data []byte) ([]byte, error) {
+    gcm, err := newGCM(k.key)
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, err
+    }
+    out := gcm.Seal(nonce, nonce, data, k.aad(field))
+    return []byte(SealedPrefix + k.KeyID + ":" + base64.RawURLEncoding.EncodeToString(out)), nil
+}
+
+// open 解密 enc:v1: 格式数据
+func (k *ProjectKey) open(field string, payload string) ([]byte, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(payload)
+    if err != nil {
+        return nil, fmt.Errorf("密文编码无效: %v", err)
+    }
+    gcm, err := newGCM(k.key)
+    if err != nil {
+        return nil, err
+    }
+    if len(raw) < gcm.NonceSize() {
+        return nil, errors.New("密文过短")
+    }
+    plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], k.aad(field))
+    if err != nil {
+        return nil, fmt.Errorf("%s 解密失败（密文被篡改或字段不匹配）", field)
+    }
+    return plain, nil
+}
+
+func (k *ProjectKey) aad(field string) []byte {
+    return []byte(k.ProjectID + "/" + field)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// IsSealed 判断字段值是否为加密格式
+func IsSealed(value string) bool {
+    return strings.HasPrefix(value, SealedPrefix)
+}
+
+// -------------------------------
+//  数据密钥按组织封装
+// -------------------------------
+
+// WrappedKey 用某个组织的公钥封装的项目数据密钥，可公开分发（如随项目配置下发）。
+// 算法：临时 ECDH P-256 + HKDF-SHA256 派生密钥 + AES-256-GCM
+type WrappedKey struct {
+    ProjectID string `json:"projectId"`
+    KeyID     string `json:"keyId"`
+    MSPID     string `json:"mspId"`
+    Algorithm string `json:"algorithm"`
+    Ephemeral []byte `json:"ephemeral"` // 临时公钥（未压缩点）
+    Sealed    []byte `json:"sealed"`    // nonce || 密文
+}
+
+const wrapAlgorithm = "ECDH-P256+HKDF-SHA256+A256GCM"
+
+// WrapProjectKey 用组织的加密公钥（*ecdsa.PublicKey 或 *ecdh.PublicKey，P-256）封装数据密钥
+func WrapProjectKey(k *ProjectKey, mspID string, orgKey crypto.PublicKey) (*WrappedKey, error) {
+    pub, err := toECDHPublic(orgKey)
+    if err != nil {
+        return nil, err
+    }
+    eph, err := ecdh.P256().GenerateKey(rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    secret, err := eph.ECDH(pub)
+    if err != nil {
+        return nil, err
+    }
+    w := &WrappedKey{
+        ProjectID: k.ProjectID,
+        KeyID:     k.KeyID,
+        MSPID:     mspID,
+        Algorithm: wrapAlgorithm,
+        Ephemeral: eph.PublicKey().Bytes(),
+    }
+    gcm, err := w.kek(secret)
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, err
+    }
+    w.Sealed = gcm.Seal(nonce, nonce, k.key, w.aad())
+    return w, nil
+}
+
+// UnwrapProjectKey 用组织私钥（*ecdsa.PrivateKey 或 *ecdh.PrivateKey）取回数据密钥。
+// HSM 中不可导出的签名密钥不能做 ECDH，组织应使用单独的加密密钥。
+func UnwrapProjectKey(w *WrappedKey, orgKey crypto.PrivateKey) (*ProjectKey, error) {
+    if w.Algorithm != wrapAlgorithm {
+        return nil, fmt.Errorf("不支持的封装算法 %s", w.Algorithm)
+    }
+    priv, err := toECDHPrivate(orgKey)
+    if err != nil {
+        return nil, err
+    }
+    eph, err := ecdh.P256().NewPublicKey(w.Ephemeral)
+    if err != nil {
+        return nil, fmt.Errorf("临时公钥无效: %v", err)
+    }
+    secret, err := priv.ECDH(eph)
+    if err != nil {
+        return nil, err
+    }
+    gcm, err := w.kek(secret)
+    if err != nil {
+        return nil, err
+    }
+    if len(w.Sealed) < gcm.NonceSize() {
+        return nil, errors.New("封装数据过短")
+    }
+    key, err := gcm.Open(nil, w.Sealed[:gcm.NonceSize()], w.Sealed[gcm.NonceSize():], w.aad())
+    if err != nil {
+        return nil, fmt.Errorf("数据密钥解封失败（私钥不匹配或数据被篡改）")
+    }
+    k, err := projectKeyFrom(w.ProjectID, key)
+    if err != nil {
+        return nil, err
+    }
+    if k.KeyID != w.KeyID {
+        return nil, fmt.Errorf("数据密钥 ID 不一致：%s != %s", k.KeyID, w.KeyID)
+    }
+    return k, nil
+}
+
+// kek 由 ECDH 共享密钥派生封装密钥
+func (w *WrappedKey) kek(secret []byte) (cipher.AEAD, error) {
+    return newGCM(hkdfSHA256(secret, w.Ephemeral, []byte("bim-project-key/"+w.ProjectID)))
+}
+
+// hkdfSHA256 RFC 5869 HKDF，输出 32 字节（单个块）
+func hkdfSHA256(secret, salt, info []byte) []byte {
+    extract := hmac.New(sha256.New, salt)
+    extract.Write(secret)
+    expand := hmac.New(sha256.New, extract.Sum(nil))
+    expand.Write(info)
+    expand.Write([]byte{1})
+    return expand.Sum(nil)
+}
+
+func (w *WrappedKey) aad() []byte {
+    return []byte(w.ProjectID + "/" + w.KeyID + "/" + w.MSPID)
+}
+
+func toECDHPublic(key crypto.PublicKey) (*ecdh.PublicKey, error) {
+    switch k := key.(type) {
+    case *ecdh.PublicKey:
+        return k, nil
+    case *ecdsa.PublicKey:
+        return k.ECDH()
+    }
+    return nil, fmt.Errorf("不支持的组织公钥类型 %T，需要 P-256 EC 公钥", key)
+}
+
+func toECDHPrivate(key crypto.PrivateKey) (*ecdh.PrivateKey, error) {
+    switch k := key.(type) {
+    case *ecdh.PrivateKey:
+        return k, nil
+    case *ecdsa.PrivateKey:
+        return k.ECDH()
+    }
+    return nil, fmt.Errorf("不支持的组织私钥类型 %T，需要 P-256 EC 私钥", key)
+}
+
+// -------------------------------
+//  密钥环与透明解密（供网关使用）
+// -------------------------------
+
+// KeyRing 本组织持有的项目数据密钥，按 KeyID 索引；同一项目可有多把（轮换后旧密钥保留用于解密）
+type KeyRing struct {
+    mu      sync.RWMutex
+    byID    map[string]*ProjectKey
+    current map[string]*ProjectKey // 项目 ID -> 加密使用的密钥
+}
+
+// NewKeyRing 创建空密钥环
+func NewKeyRing() *KeyRing {
+    return &KeyRing{byID: map[string]*ProjectKey{}, current: map[string]*ProjectKey{}}
+}
+
+// Add 加入密钥，并设为该项目新数据的加密密钥
+func (r *KeyRing) Add(k *ProjectKey) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.byID[k.KeyID] = k
+    r.current[k.ProjectID] = k
+}
+
+// AddWrapped 解封并加入发给本组织的数据密钥
+func (r *KeyRing) AddWrapped(w *WrappedKey, orgKey crypto.PrivateKey) error {
+    k, err := UnwrapProjectKey(w, orgKey)
+    if err != nil {
+        return err
+    }
+    r.Add(k)
+    return nil
+}
+
+// Key 返回项目当前的加密密钥
+func (r *KeyRing) Key(projectID string) (*ProjectKey, error) {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    k, ok := r.current[projectID]
+    if !ok {
+        return nil, fmt.Errorf("项目 %s: %w", projectID, ErrUnknownDataKey)
+    }
+    return k, nil
+}
+
+// Open 解密字段值；未加密的值原样返回
+func (r *KeyRing) Open(field string, value string) (string, error) {
+    plain, err := r.OpenBytes(field, []byte(value))
+    if err != nil {
+        return "", err
+    }
+    return string(plain), nil
+}
+
+// OpenBytes 解密 SealBytes 的输出；未加密的数据原样返回
+func (r *KeyRing) OpenBytes(field string, data []byte) ([]byte, error) {
+    s := string(data)
+    if !IsSealed(s) {
+        return data, nil
+    }
+    keyID, payload, ok := strings.Cut(strings.TrimPrefix(s, SealedPrefix), ":")
+    if !ok {
+        return nil, errors.New("密文格式无效")
+    }
+    r.mu.RLock()
+    k, found := r.byID[keyID]
+    r.mu.RUnlock()
+    if !found {
+        return nil, fmt.Errorf("密钥 %s: %w", keyID, ErrUnknownDataKey)
+    }
+    return k.open(field, payload)
+}
+
+// OpenUpdate 就地解密更新记录的 Description
+func (r *KeyRing) OpenUpdate(u *LedgerUpdate) error {
+    plain, err := r.Open(FieldDescription, u.Description)
+    if err != nil {
+        return fmt.Errorf("更新 %s: %w", u.UpdateID, err)
+    }
+    u.Description = plain
+    return nil
+}
+
+// OpenApproval 就地解密审批记录的 Comment
+func (r *KeyRing) OpenApproval(a *LedgerApproval) error {
+    plain, err := r.Open(FieldComment, a.Comment)
+    if err != nil {
+        return fmt.Errorf("审批 %s: %w", a.UpdateID, err)
+    }
+    a.Comment = plain
+    return nil
+}
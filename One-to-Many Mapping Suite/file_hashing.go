@@ -0,0 +1,84 @@
+package mapping
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "io"
+    "sort"
+
+    "github.com/zeebo/blake3"
+    "golang.org/x/crypto/sha3"
+)
+
+// -------------------------------
+//  文件指纹算法（部分国家 BIM 标准规定摘要算法）
+// -------------------------------
+
+// 支持的指纹算法名，与链码 Attachment.HashAlgorithm 一致
+const (
+    HashSHA256  = "sha256"
+    HashSHA3512 = "sha3-512"
+    HashBLAKE3  = "blake3"
+    // HashSHA256Tree 4 MiB 分块 SHA-256 的 Merkle 根，可并行计算，见 parallel_hashing.go
+    HashSHA256Tree = "sha256-tree"
+)
+
+// DefaultHashAlgorithm 未配置时使用的指纹算法
+const DefaultHashAlgorithm = HashSHA256
+
+var hashAlgorithms = map[string]func() hash.Hash{
+    HashSHA256:     sha256.New,
+    HashSHA3512:    sha3.New512,
+    HashBLAKE3:     func() hash.Hash { return blake3.New() }, // 32 字节输出
+    HashSHA256Tree: newTreeHash,
+}
+
+// HashAlgorithms 返回支持的指纹算法名
+func HashAlgorithms() []string {
+    names := make([]string, 0, len(hashAlgorithms))
+    for name := range hashAlgorithms {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// NewFileHash 创建指定算法的哈希
+func NewFileHash(algorithm string) (hash.Hash, error) {
+    newHash, ok := hashAlgorithms[algorithm]
+    if !ok {
+        return nil, fmt.Errorf("不支持的指纹算法 %q，可选 %v", algorithm, HashAlgorithms())
+    }
+    return newHash(), nil
+}
+
+// HashFile 计算内容指纹（十六进制小写）；sha256-tree 按块并行计算
+func HashFile(algorithm string, content []byte) (string, error) {
+    if algorithm == HashSHA256Tree {
+        m, err := NewParallelHasher(HashSHA256).HashBytes(content)
+        if err != nil {
+            return "", err
+        }
+        return m.RootHash, nil
+    }
+    h, err := NewFileHash(algorithm)
+    if err != nil {
+        return "", err
+    }
+    h.Write(content)
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashReader 流式计算指纹，适合大文件
+func HashReader(algorithm string, r io.Reader) (string, error) {
+    h, err := NewFileHash(algorithm)
+    if err != nil {
+        return "", err
+    }
+    if _, err := io.Copy(h, r); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
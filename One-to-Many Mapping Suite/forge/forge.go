@@ -0,0 +1,259 @@
+// Package forge 在提交时解析并校验 BIMUpdate 上的外部 CDE 引用（Autodesk Forge / APS
+// 模型衍生 URN、BIM 360 / ACC 条目 ID），确认引用的条目存在且可访问，
+// 使用云端 CDE 的团队可以在账本记录与 CDE 条目之间互相跳转。
+package forge
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  APS 客户端
+// -------------------------------
+
+// 引用类型，与链码 ExternalRef.System 一致
+const (
+    SystemForge  = "forge"
+    SystemBIM360 = "bim360"
+)
+
+// DefaultBaseURL APS 接口地址
+const DefaultBaseURL = "https://developer.api.autodesk.com"
+
+// ErrNotFound 引用的条目不存在或当前凭据无权访问
+var ErrNotFound = errors.New("CDE 条目不存在或无权访问")
+
+// TokenSource 返回访问 APS 的 Bearer 令牌
+type TokenSource interface {
+    Token(ctx context.Context) (string, error)
+}
+
+// Client APS 只读客户端
+type Client struct {
+    BaseURL string       // 为空时使用 DefaultBaseURL
+    HTTP    *http.Client // 为空时使用 30 秒超时的默认客户端
+    Tokens  TokenSource
+}
+
+// Derivative 模型衍生（Model Derivative）清单概要
+type Derivative struct {
+    URN      string `json:"urn"`
+    Status   string `json:"status"`   // pending / inprogress / success / failed / timeout
+    Progress string `json:"progress"` // 如 "complete"、"25% complete"
+    Region   string `json:"region"`
+}
+
+// Item BIM 360 / ACC 条目概要
+type Item struct {
+    ID          string `json:"id"`
+    Name        string `json:"name"`
+    TipVersion  string `json:"tipVersion"`  // 最新版本 ID
+    VersionNo   int    `json:"versionNo"`   // 最新版本号
+    LastUpdated string `json:"lastUpdated"` // RFC3339
+}
+
+// ValidateRef 按引用类型解析并校验；version 非空时要求与 CDE 中的版本一致。
+// 模型衍生转换失败的 URN 视为无效。
+func (c *Client) ValidateRef(ctx context.Context, system, project, id, version string) error {
+    switch system {
+    case SystemForge:
+        d, err := c.Derivative(ctx, id)
+        if err != nil {
+            return err
+        }
+        if d.Status == "failed" || d.Status == "timeout" {
+            return fmt.Errorf("URN %s 的模型衍生转换状态为 %s", id, d.Status)
+        }
+        return nil
+    case SystemBIM360:
+        item, err := c.Item(ctx, project, id)
+        if err != nil {
+            return err
+        }
+        if version != "" && version != item.TipVersion && version != fmt.Sprint(item.VersionNo) {
+            return fmt.Errorf("条目 %s 的最新版本为 %d（%s），与引用的版本 %s 不符", id, item.VersionNo, item.TipVersion, version)
+        }
+        return nil
+    default:
+        return fmt.Errorf("不支持的引用类型 %q", system)
+    }
+}
+
+// Derivative 查询 URN 的模型衍生清单
+func (c *Client) Derivative(ctx context.Context, urn string) (*Derivative, error) {
+    if _, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(urn, "=")); err != nil {
+        return nil, fmt.Errorf("URN 不是 base64url 编码: %v", err)
+    }
+    var d Derivative
+    if err := c.get(ctx, "/modelderivative/v2/designdata/"+url.PathEscape(urn)+"/manifest", &d); err != nil {
+        return nil, err
+    }
+    return &d, nil
+}
+
+// Item 查询 BIM 360 / ACC 项目中的条目及其最新版本
+func (c *Client) Item(ctx context.Context, project, itemID string) (*Item, error) {
+    if project == "" || itemID == "" {
+        return nil, errors.New("项目 ID 与条目 ID 不能为空")
+    }
+    var resp struct {
+        Data struct {
+            ID         string `json:"id"`
+            Attributes struct {
+                DisplayName      string `json:"displayName"`
+                LastModifiedTime string `json:"lastModifiedTime"`
+            } `json:"attributes"`
+            Relationships struct {
+                Tip struct {
+                    Data struct {
+                        ID string `json:"id"`
+                    } `json:"data"`
+                } `json:"tip"`
+            } `json:"relationships"`
+        } `json:"data"`
+        Included []struct {
+            Type       string `json:"type"`
+            ID         string `json:"id"`
+            Attributes struct {
+                VersionNumber int `json:"versionNumber"`
+            } `json:"attributes"`
+        } `json:"included"`
+    }
+    path := "/data/v1/projects/" + url.PathEscape(project) + "/items/" + url.PathEscape(itemID)
+    if err := c.get(ctx, path, &resp); err != nil {
+        return nil, err
+    }
+    item := &Item{
+        ID:          resp.Data.ID,
+        Name:        resp.Data.Attributes.DisplayName,
+        TipVersion:  resp.Data.Relationships.Tip.Data.ID,
+        LastUpdated: resp.Data.Attributes.LastModifiedTime,
+    }
+    for _, inc := range resp.Included {
+        if inc.Type == "versions" && inc.ID == item.TipVersion {
+            item.VersionNo = inc.Attributes.VersionNumber
+        }
+    }
+    return item, nil
+}
+
+// get 发送带令牌的 GET 请求并解析 JSON 响应
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+    if c.Tokens == nil {
+        return errors.New("未配置 APS 令牌来源")
+    }
+    token, err := c.Tokens.Token(ctx)
+    if err != nil {
+        return fmt.Errorf("获取 APS 令牌失败: %v", err)
+    }
+    base := c.BaseURL
+    if base == "" {
+        base = DefaultBaseURL
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+path, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    resp, err := c.httpClient().Do(req)
+    if err != nil {
+        return fmt.Errorf("请求 APS 失败: %v", err)
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+    if err != nil {
+        return err
+    }
+    switch {
+    case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden:
+        return fmt.Errorf("%w: %s", ErrNotFound, path)
+    case resp.StatusCode != http.StatusOK:
+        return fmt.Errorf("APS 返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+    }
+    if err := json.Unmarshal(body, out); err != nil {
+        return fmt.Errorf("解析 APS 响应失败: %v", err)
+    }
+    return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+    if c.HTTP != nil {
+        return c.HTTP
+    }
+    return &http.Client{Timeout: 30 * time.Second}
+}
+
+// -------------------------------
+//  两腿认证（client credentials）
+// -------------------------------
+
+// ClientCredentials 使用应用的 client ID / secret 获取令牌，并在过期前复用
+type ClientCredentials struct {
+    ClientID     string
+    ClientSecret string
+    Scope        string // 为空时使用 "data:read viewables:read"
+    BaseURL      string // 为空时使用 DefaultBaseURL
+    HTTP         *http.Client
+
+    mu      sync.Mutex
+    token   string
+    expires time.Time
+}
+
+// Token 返回缓存的令牌，剩余有效期不足 1 分钟时重新获取
+func (cc *ClientCredentials) Token(ctx context.Context) (string, error) {
+    cc.mu.Lock()
+    defer cc.mu.Unlock()
+    if cc.token != "" && time.Until(cc.expires) > time.Minute {
+        return cc.token, nil
+    }
+
+    scope := cc.Scope
+    if scope == "" {
+        scope = "data:read viewables:read"
+    }
+    base := cc.BaseURL
+    if base == "" {
+        base = DefaultBaseURL
+    }
+    form := url.Values{"grant_type": {"client_credentials"}, "scope": {scope}}
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(base, "/")+"/authentication/v2/token", strings.NewReader(form.Encode()))
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.SetBasicAuth(cc.ClientID, cc.ClientSecret)
+    client := cc.HTTP
+    if client == nil {
+        client = &http.Client{Timeout: 30 * time.Second}
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+        return "", fmt.Errorf("APS 认证返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+    }
+    var out struct {
+        AccessToken string `json:"access_token"`
+        ExpiresIn   int    `json:"expires_in"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+        return "", fmt.Errorf("解析 APS 令牌失败: %v", err)
+    }
+    cc.token = out.AccessToken
+    cc.expires = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+    return cc.token, nil
+}
@@ -0,0 +1,69 @@
+package mapping
+
+import (
+    "math"
+    "net/http"
+    "strconv"
+    "sync/atomic"
+    "time"
+)
+
+// -------------------------------
+//  REST 网关反压（并发上限与 Retry-After）
+// -------------------------------
+
+// 默认的 Retry-After
+const defaultGatewayRetryAfter = time.Second
+
+// GatewayLoad GET /health 的响应：网关正在处理的请求数与上限，供批量上传工具调整节奏
+type GatewayLoad struct {
+    InFlight    int64 `json:"inFlight"`
+    MaxInFlight int   `json:"maxInFlight"` // 0 表示不限
+    Saturated   bool  `json:"saturated"`   // 新请求会被以 503 拒绝
+}
+
+// inFlightLimiter 限制同时处理的请求数。超出上限的请求立即以 503 与 Retry-After 拒绝而不排队：
+// Peer 或 IPFS 饱和时排队的请求只会一起超时，拒绝后客户端按 Retry-After 放慢（见 bimclient.GatewayClient）
+type inFlightLimiter struct {
+    max        int
+    retryAfter time.Duration
+    inFlight   int64
+}
+
+func newInFlightLimiter(max int, retryAfter time.Duration) *inFlightLimiter {
+    if retryAfter <= 0 {
+        retryAfter = defaultGatewayRetryAfter
+    }
+    return &inFlightLimiter{max: max, retryAfter: retryAfter}
+}
+
+// wrap 计数经过的请求，达到上限时拒绝
+func (l *inFlightLimiter) wrap(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n := atomic.AddInt64(&l.inFlight, 1)
+        defer atomic.AddInt64(&l.inFlight, -1)
+        if l.max > 0 && n > int64(l.max) {
+            // Retry-After 只能是整秒
+            w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.retryAfter.Seconds()))))
+            http.Error(w, "网关繁忙，请稍后重试", http.StatusServiceUnavailable)
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// load 返回当前负载
+func (l *inFlightLimiter) load() GatewayLoad {
+    n := atomic.LoadInt64(&l.inFlight)
+    return GatewayLoad{InFlight: n, MaxInFlight: l.max, Saturated: l.max > 0 && n >= int64(l.max)}
+}
+
+// health 处理 GET /health
+func (l *inFlightLimiter) health(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        w.Header().Set("Allow", "GET, HEAD")
+        http.Error(w, "只支持 GET", http.StatusMethodNotAllowed)
+        return
+    }
+    writeGatewayJSON(w, http.StatusOK, l.load())
+}
@@ -0,0 +1,575 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// -------------------------------
+//  GraphQL 解析与执行（网关所需的子集）
+// -------------------------------
+
+// 支持查询与变更操作、操作名、变量（含默认值）、别名、参数（标量、枚举、列表、输入对象）、
+// 嵌套选择集与 __typename；不支持片段、指令、订阅与内省，遇到时返回错误。
+// 所有字段都可为 null：字段出错时置为 null 并在 errors 中记录路径，其余字段照常返回。
+
+// gqlResolver 解析一个字段，返回标量、[]interface{}、*gqlObject 或 nil
+type gqlResolver func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// gqlObject 对象类型的值：类型名与各字段的解析函数
+type gqlObject struct {
+    typeName string
+    fields   map[string]gqlResolver
+}
+
+// gqlDocument 解析后的请求文档
+type gqlDocument struct {
+    operations []*gqlOperation
+}
+
+type gqlOperation struct {
+    kind       string // query / mutation
+    name       string
+    variables  []gqlVariable
+    selections []*gqlField
+}
+
+type gqlVariable struct {
+    name       string
+    defaultVal interface{} // 未提供默认值时为 gqlNoValue
+}
+
+type gqlField struct {
+    alias      string
+    name       string
+    args       map[string]interface{} // 值中的变量为 gqlVarRef
+    selections []*gqlField
+}
+
+// gqlVarRef 参数中对变量的引用，执行时替换为变量值
+type gqlVarRef string
+
+type gqlNoValueType struct{}
+
+var gqlNoValue = gqlNoValueType{}
+
+// gqlError GraphQL 响应中的一条错误
+type gqlError struct {
+    Message string        `json:"message"`
+    Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlResult 按选择顺序输出的对象
+type gqlResult []gqlEntry
+
+type gqlEntry struct {
+    key   string
+    value interface{}
+}
+
+// MarshalJSON 保持字段的选择顺序
+func (r gqlResult) MarshalJSON() ([]byte, error) {
+    var b bytes.Buffer
+    b.WriteByte('{')
+    for i, e := range r {
+        if i > 0 {
+            b.WriteByte(',')
+        }
+        key, _ := json.Marshal(e.key)
+        b.Write(key)
+        b.WriteByte(':')
+        value, err := json.Marshal(e.value)
+        if err != nil {
+            return nil, err
+        }
+        b.Write(value)
+    }
+    b.WriteByte('}')
+    return b.Bytes(), nil
+}
+
+// -------------------------------
+//  词法与语法
+// -------------------------------
+
+type gqlParser struct {
+    src string
+    pos int
+    tok string // 当前记号；字符串记号保留引号
+}
+
+// parseGraphQL 解析请求文档
+func parseGraphQL(src string) (doc *gqlDocument, err error) {
+    p := &gqlParser{src: src}
+    defer func() {
+        if r := recover(); r != nil {
+            perr, ok := r.(gqlParseError)
+            if !ok {
+                panic(r)
+            }
+            doc, err = nil, perr
+        }
+    }()
+    p.next()
+    doc = &gqlDocument{}
+    for p.tok != "" {
+        doc.operations = append(doc.operations, p.operation())
+    }
+    if len(doc.operations) == 0 {
+        p.fail("文档中没有操作")
+    }
+    return doc, nil
+}
+
+type gqlParseError struct {
+    msg string
+}
+
+func (e gqlParseError) Error() string { return e.msg }
+
+func (p *gqlParser) fail(format string, args ...interface{}) {
+    panic(gqlParseError{fmt.Sprintf("GraphQL 语法错误（位置 %d）: ", p.pos) + fmt.Sprintf(format, args...)})
+}
+
+// next 读入下一个记号，跳过空白、逗号与注释
+func (p *gqlParser) next() {
+    for p.pos < len(p.src) {
+        c := p.src[p.pos]
+        if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+            p.pos++
+            continue
+        }
+        if c == '#' {
+            for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+                p.pos++
+            }
+            continue
+        }
+        break
+    }
+    if p.pos >= len(p.src) {
+        p.tok = ""
+        return
+    }
+    start := p.pos
+    c := p.src[p.pos]
+    switch {
+    case strings.HasPrefix(p.src[p.pos:], "..."):
+        p.pos += 3
+    case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+        p.pos++
+    case c == '"':
+        if strings.HasPrefix(p.src[p.pos:], `"""`) {
+            p.fail("不支持块字符串")
+        }
+        p.pos++
+        for {
+            if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+                p.fail("字符串未结束")
+            }
+            if p.src[p.pos] == '\\' {
+                p.pos += 2
+                continue
+            }
+            if p.src[p.pos] == '"' {
+                p.pos++
+                break
+            }
+            p.pos++
+        }
+    case c == '-' || (c >= '0' && c <= '9'):
+        p.pos++
+        for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+            p.pos++
+        }
+    case c == '_' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+        for p.pos < len(p.src) && isGraphQLNameByte(p.src[p.pos]) {
+            p.pos++
+        }
+    default:
+        r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+        p.fail("无法识别的字符 %q", r)
+    }
+    p.tok = p.src[start:p.pos]
+}
+
+func isGraphQLNameByte(c byte) bool {
+    return c == '_' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+func (p *gqlParser) isName() bool {
+    return p.tok != "" && (p.tok[0] == '_' || (p.tok[0]|0x20 >= 'a' && p.tok[0]|0x20 <= 'z'))
+}
+
+func (p *gqlParser) expect(tok string) {
+    if p.tok != tok {
+        p.fail("应为 %q，实际为 %q", tok, p.tok)
+    }
+    p.next()
+}
+
+func (p *gqlParser) name() string {
+    if !p.isName() {
+        p.fail("应为名称，实际为 %q", p.tok)
+    }
+    name := p.tok
+    p.next()
+    return name
+}
+
+func (p *gqlParser) operation() *gqlOperation {
+    op := &gqlOperation{kind: "query"}
+    if p.tok == "{" {
+        op.selections = p.selectionSet()
+        return op
+    }
+    switch kind := p.name(); kind {
+    case "query", "mutation":
+        op.kind = kind
+    case "subscription":
+        p.fail("不支持订阅，请使用 WebSocket GET /events")
+    case "fragment":
+        p.fail("不支持片段")
+    default:
+        p.fail("未知的操作类型 %q", kind)
+    }
+    if p.isName() {
+        op.name = p.name()
+    }
+    if p.tok == "(" {
+        p.next()
+        for p.tok != ")" {
+            p.expect("$")
+            v := gqlVariable{name: p.name(), defaultVal: gqlNoValue}
+            p.expect(":")
+            p.skipType()
+            if p.tok == "=" {
+                p.next()
+                v.defaultVal = p.value(true)
+            }
+            op.variables = append(op.variables, v)
+        }
+        p.next()
+    }
+    if p.tok == "@" {
+        p.fail("不支持指令")
+    }
+    op.selections = p.selectionSet()
+    return op
+}
+
+// skipType 跳过变量类型，类型由解析函数检查
+func (p *gqlParser) skipType() {
+    if p.tok == "[" {
+        p.next()
+        p.skipType()
+        p.expect("]")
+    } else {
+        p.name()
+    }
+    if p.tok == "!" {
+        p.next()
+    }
+}
+
+func (p *gqlParser) selectionSet() []*gqlField {
+    p.expect("{")
+    var fields []*gqlField
+    for p.tok != "}" {
+        if p.tok == "" {
+            p.fail("选择集未结束")
+        }
+        if p.tok == "..." {
+            p.fail("不支持片段")
+        }
+        f := &gqlField{name: p.name()}
+        if p.tok == ":" {
+            p.next()
+            f.alias, f.name = f.name, p.name()
+        }
+        if p.tok == "(" {
+            p.next()
+            f.args = map[string]interface{}{}
+            for p.tok != ")" {
+                name := p.name()
+                p.expect(":")
+                f.args[name] = p.value(false)
+            }
+            p.next()
+        }
+        if p.tok == "@" {
+            p.fail("不支持指令")
+        }
+        if p.tok == "{" {
+            f.selections = p.selectionSet()
+        }
+        fields = append(fields, f)
+    }
+    p.next()
+    if len(fields) == 0 {
+        p.fail("选择集不能为空")
+    }
+    return fields
+}
+
+// value 解析参数值；constant 为真时不允许变量（变量默认值）
+func (p *gqlParser) value(constant bool) interface{} {
+    tok := p.tok
+    switch {
+    case tok == "$":
+        if constant {
+            p.fail("默认值中不能引用变量")
+        }
+        p.next()
+        return gqlVarRef(p.name())
+    case tok == "[":
+        p.next()
+        list := []interface{}{}
+        for p.tok != "]" {
+            if p.tok == "" {
+                p.fail("列表未结束")
+            }
+            list = append(list, p.value(constant))
+        }
+        p.next()
+        return list
+    case tok == "{":
+        p.next()
+        obj := map[string]interface{}{}
+        for p.tok != "}" {
+            name := p.name()
+            p.expect(":")
+            obj[name] = p.value(constant)
+        }
+        p.next()
+        return obj
+    case strings.HasPrefix(tok, `"`):
+        p.next()
+        s, err := strconv.Unquote(tok)
+        if err != nil {
+            p.fail("字符串 %s 无效", tok)
+        }
+        return s
+    case tok != "" && (tok[0] == '-' || (tok[0] >= '0' && tok[0] <= '9')):
+        p.next()
+        if n, err := strconv.Atoi(tok); err == nil {
+            return n
+        }
+        f, err := strconv.ParseFloat(tok, 64)
+        if err != nil {
+            p.fail("数字 %s 无效", tok)
+        }
+        return f
+    case tok == "true" || tok == "false":
+        p.next()
+        return tok == "true"
+    case tok == "null":
+        p.next()
+        return nil
+    case p.isName():
+        // 枚举值按字符串传给解析函数
+        p.next()
+        return tok
+    }
+    p.fail("应为值，实际为 %q", tok)
+    return nil
+}
+
+// -------------------------------
+//  执行
+// -------------------------------
+
+// gqlExecution 一次请求的执行状态
+type gqlExecution struct {
+    variables map[string]interface{}
+    errors    []gqlError
+}
+
+// executeGraphQL 执行文档中名为 operationName 的操作（文档只有一个操作时可为空）；
+// root 按操作类型返回根对象，不支持该操作类型时返回错误
+func executeGraphQL(ctx context.Context, doc *gqlDocument, operationName string, variables map[string]interface{}, root func(kind string) (*gqlObject, error)) (gqlResult, []gqlError) {
+    var op *gqlOperation
+    for _, o := range doc.operations {
+        if o.name == operationName || (operationName == "" && len(doc.operations) == 1) {
+            op = o
+            break
+        }
+    }
+    if op == nil {
+        if operationName == "" {
+            return nil, []gqlError{{Message: "文档有多个操作，须指定 operationName"}}
+        }
+        return nil, []gqlError{{Message: fmt.Sprintf("没有名为 %s 的操作", operationName)}}
+    }
+    obj, err := root(op.kind)
+    if err != nil {
+        return nil, []gqlError{{Message: err.Error()}}
+    }
+
+    vars := map[string]interface{}{}
+    for _, v := range op.variables {
+        if value, ok := variables[v.name]; ok {
+            vars[v.name] = value
+        } else if v.defaultVal != gqlNoValue {
+            vars[v.name] = v.defaultVal
+        }
+    }
+    ex := &gqlExecution{variables: vars}
+    data := ex.object(ctx, obj, op.selections, nil)
+    return data, ex.errors
+}
+
+// object 按选择集解析对象的字段
+func (ex *gqlExecution) object(ctx context.Context, obj *gqlObject, selections []*gqlField, path []interface{}) gqlResult {
+    result := make(gqlResult, 0, len(selections))
+    for _, f := range selections {
+        key := f.name
+        if f.alias != "" {
+            key = f.alias
+        }
+        fieldPath := append(append([]interface{}{}, path...), key)
+        if f.name == "__typename" {
+            result = append(result, gqlEntry{key, obj.typeName})
+            continue
+        }
+        resolve, ok := obj.fields[f.name]
+        if !ok {
+            ex.fail(fieldPath, fmt.Errorf("类型 %s 没有字段 %s", obj.typeName, f.name))
+            result = append(result, gqlEntry{key, nil})
+            continue
+        }
+        args, err := ex.arguments(f.args)
+        var value interface{}
+        if err == nil {
+            value, err = resolve(ctx, args)
+        }
+        if err != nil {
+            ex.fail(fieldPath, err)
+            result = append(result, gqlEntry{key, nil})
+            continue
+        }
+        result = append(result, gqlEntry{key, ex.complete(ctx, f, value, fieldPath)})
+    }
+    return result
+}
+
+// complete 按选择集展开解析结果
+func (ex *gqlExecution) complete(ctx context.Context, f *gqlField, value interface{}, path []interface{}) interface{} {
+    switch v := value.(type) {
+    case nil:
+        return nil
+    case *gqlObject:
+        if v == nil {
+            return nil
+        }
+        if f.selections == nil {
+            ex.fail(path, fmt.Errorf("字段 %s 的类型为 %s，须指定选择集", f.name, v.typeName))
+            return nil
+        }
+        return ex.object(ctx, v, f.selections, path)
+    case []interface{}:
+        list := make([]interface{}, len(v))
+        for i, item := range v {
+            list[i] = ex.complete(ctx, f, item, append(append([]interface{}{}, path...), i))
+        }
+        return list
+    }
+    if f.selections != nil {
+        ex.fail(path, fmt.Errorf("字段 %s 为标量，不能有选择集", f.name))
+        return nil
+    }
+    return value
+}
+
+// arguments 用变量值替换参数中的变量引用
+func (ex *gqlExecution) arguments(args map[string]interface{}) (map[string]interface{}, error) {
+    resolved := make(map[string]interface{}, len(args))
+    for name, v := range args {
+        value, err := ex.substitute(v)
+        if err != nil {
+            return nil, err
+        }
+        resolved[name] = value
+    }
+    return resolved, nil
+}
+
+func (ex *gqlExecution) substitute(v interface{}) (interface{}, error) {
+    switch t := v.(type) {
+    case gqlVarRef:
+        value, ok := ex.variables[string(t)]
+        if !ok {
+            return nil, nil
+        }
+        return value, nil
+    case []interface{}:
+        list := make([]interface{}, len(t))
+        for i, item := range t {
+            value, err := ex.substitute(item)
+            if err != nil {
+                return nil, err
+            }
+            list[i] = value
+        }
+        return list, nil
+    case map[string]interface{}:
+        obj := make(map[string]interface{}, len(t))
+        for k, item := range t {
+            value, err := ex.substitute(item)
+            if err != nil {
+                return nil, err
+            }
+            obj[k] = value
+        }
+        return obj, nil
+    }
+    return v, nil
+}
+
+func (ex *gqlExecution) fail(path []interface{}, err error) {
+    ex.errors = append(ex.errors, gqlError{Message: err.Error(), Path: path})
+}
+
+// -------------------------------
+//  参数读取
+// -------------------------------
+
+// gqlString 读取字符串参数，缺少时返回空串；required 为真时缺少即报错
+func gqlString(args map[string]interface{}, name string, required bool) (string, error) {
+    v, ok := args[name]
+    if !ok || v == nil {
+        if required {
+            return "", fmt.Errorf("缺少参数 %s", name)
+        }
+        return "", nil
+    }
+    s, ok := v.(string)
+    if !ok {
+        return "", fmt.Errorf("参数 %s 须为字符串", name)
+    }
+    return s, nil
+}
+
+// gqlInt 读取整数参数，缺少时返回 def；变量中的数字为 float64 或 json.Number
+func gqlInt(args map[string]interface{}, name string, def int) (int, error) {
+    switch v := args[name].(type) {
+    case nil:
+        return def, nil
+    case int:
+        return v, nil
+    case float64:
+        if v == float64(int(v)) {
+            return int(v), nil
+        }
+    case json.Number:
+        if n, err := strconv.Atoi(v.String()); err == nil {
+            return n, nil
+        }
+    }
+    return 0, fmt.Errorf("参数 %s 须为整数", name)
+}
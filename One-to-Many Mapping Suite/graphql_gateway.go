@@ -0,0 +1,327 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+)
+
+// -------------------------------
+//  GraphQL 端点（POST /graphql）
+// -------------------------------
+
+// GraphQL 端点让界面一次请求取回更新、审批结论与模型历史，字段按需选择。查询经 Ledger 以调用方身份执行
+// （与 GET /updates/<UpdateID> 相同，链码按组织范围过滤）；变更的 input 与对应 REST 请求体相同，
+// 先按同一 Schema 校验，再经 Submitter 以操作人身份提交（与 POST /updates 等相同），
+// 操作人与项目取自查询参数 userId 与 project。
+//
+//	type Query {
+//	  update(id: ID!): Update
+//	  model(id: ID!): Model
+//	}
+//	type Mutation {
+//	  createUpdate(input: UpdateInput!): SubmitResult     # 同 POST /updates
+//	  approve(input: ApprovalInput!): SubmitResult        # 同 POST /approvals
+//	  addComment(input: CommentInput!): SubmitResult      # 同 POST /comments
+//	}
+//	type Update {
+//	  id modelId version description initiator initiatorDepartment timestamp status: String
+//	  dependsOn: [ID]
+//	  files: [File]            # 交付文件与附件，见 LedgerUpdate.anchoredFiles
+//	  approval: Approval
+//	  model: Model
+//	}
+//	type File { name cid hash hashAlgorithm mediaType: String  size: Int }
+//	type Approval { approver result reasonCode comment timestamp: String }
+//	type Model { id: ID  history(pageSize: Int, bookmark: String): UpdatePage }
+//	type UpdatePage { updates: [Update]  bookmark: String  fetchedCount: Int }
+//	type SubmitResult { updateId commentId: ID  update: Update }
+//
+// GET /graphql?query=... 只能执行查询；变更须用 POST，请求体为 {"query","variables","operationName"}。
+// 变更不处理 Idempotency-Key，需要安全重试时使用 REST 路由。
+
+// graphQLRequest POST /graphql 的请求体
+type graphQLRequest struct {
+    Query         string                 `json:"query"`
+    Variables     map[string]interface{} `json:"variables"`
+    OperationName string                 `json:"operationName"`
+}
+
+// graphQLResponse GraphQL 响应：请求本身无效时只有 errors
+type graphQLResponse struct {
+    Data   gqlResult  `json:"data,omitempty"`
+    Errors []gqlError `json:"errors,omitempty"`
+}
+
+// serveGraphQL 处理 /graphql：请求无法解析时返回 400，否则返回 200，字段错误在 errors 中
+func (g *HTTPGateway) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+    var req graphQLRequest
+    switch r.Method {
+    case http.MethodGet:
+        q := r.URL.Query()
+        req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+        if vars := q.Get("variables"); vars != "" {
+            dec := json.NewDecoder(strings.NewReader(vars))
+            dec.UseNumber()
+            if err := dec.Decode(&req.Variables); err != nil {
+                writeGatewayJSON(w, http.StatusBadRequest, graphQLResponse{Errors: []gqlError{{Message: "variables 不是 JSON 对象: " + err.Error()}}})
+                return
+            }
+        }
+    case http.MethodPost:
+        maxBytes := g.MaxBytes
+        if maxBytes <= 0 {
+            maxBytes = DefaultMaxRequestBytes
+        }
+        dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+        dec.UseNumber()
+        if err := dec.Decode(&req); err != nil {
+            writeGatewayJSON(w, http.StatusBadRequest, graphQLResponse{Errors: []gqlError{{Message: "请求体须为 {\"query\",\"variables\",\"operationName\"}: " + err.Error()}}})
+            return
+        }
+    default:
+        w.Header().Set("Allow", "GET, POST")
+        http.Error(w, "只支持 GET 与 POST", http.StatusMethodNotAllowed)
+        return
+    }
+
+    doc, err := parseGraphQL(req.Query)
+    if err != nil {
+        writeGatewayJSON(w, http.StatusBadRequest, graphQLResponse{Errors: []gqlError{{Message: err.Error()}}})
+        return
+    }
+    root := func(kind string) (*gqlObject, error) {
+        if kind == "mutation" {
+            if r.Method != http.MethodPost {
+                return nil, errors.New("变更须使用 POST")
+            }
+            return g.graphQLMutation(r), nil
+        }
+        return g.graphQLQuery(gatewayQueryContext(r)), nil
+    }
+    data, errs := executeGraphQL(r.Context(), doc, req.OperationName, req.Variables, root)
+    if data == nil {
+        writeGatewayJSON(w, http.StatusBadRequest, graphQLResponse{Errors: errs})
+        return
+    }
+    for _, e := range errs {
+        Logger().Warn("GraphQL 字段失败", "path", e.Path, "err", e.Message)
+    }
+    writeGatewayJSON(w, http.StatusOK, graphQLResponse{Data: data, Errors: errs})
+}
+
+// -------------------------------
+//  查询
+// -------------------------------
+
+// graphQLQuery 返回 Query 根对象；ctx 带查询身份，嵌套字段的查询都以它执行
+func (g *HTTPGateway) graphQLQuery(ctx context.Context) *gqlObject {
+    return &gqlObject{typeName: "Query", fields: map[string]gqlResolver{
+        "update": func(_ context.Context, args map[string]interface{}) (interface{}, error) {
+            id, err := gqlString(args, "id", true)
+            if err != nil {
+                return nil, err
+            }
+            return g.graphQLUpdate(ctx, id)
+        },
+        "model": func(_ context.Context, args map[string]interface{}) (interface{}, error) {
+            id, err := gqlString(args, "id", true)
+            if err != nil {
+                return nil, err
+            }
+            return g.graphQLModel(ctx, id), nil
+        },
+    }}
+}
+
+// graphQLUpdate 经 Ledger 查询更新
+func (g *HTTPGateway) graphQLUpdate(ctx context.Context, updateID string) (interface{}, error) {
+    if g.Ledger == nil {
+        return nil, errors.New("未配置账本查询")
+    }
+    data, err := g.Ledger.QueryUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    var rec LedgerRecord
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return nil, fmt.Errorf("解析更新 %s 失败: %v", updateID, err)
+    }
+    if rec.InitRecord == nil {
+        return nil, nil
+    }
+    return g.graphQLRecord(ctx, &rec), nil
+}
+
+// graphQLRecord 将链上记录转换为 Update 对象
+func (g *HTTPGateway) graphQLRecord(ctx context.Context, rec *LedgerRecord) *gqlObject {
+    u := rec.InitRecord
+    value := func(v interface{}) gqlResolver {
+        return func(context.Context, map[string]interface{}) (interface{}, error) { return v, nil }
+    }
+    return &gqlObject{typeName: "Update", fields: map[string]gqlResolver{
+        "id":                  value(u.UpdateID),
+        "modelId":             value(u.ModelID),
+        "version":             value(u.Version),
+        "description":         value(u.Description),
+        "initiator":           value(u.Initiator),
+        "initiatorDepartment": value(u.InitiatorDepartment),
+        "timestamp":           value(u.Timestamp),
+        "status":              value(u.Status),
+        "dependsOn": func(context.Context, map[string]interface{}) (interface{}, error) {
+            ids := make([]interface{}, len(u.DependsOn))
+            for i, id := range u.DependsOn {
+                ids[i] = id
+            }
+            return ids, nil
+        },
+        "files": func(context.Context, map[string]interface{}) (interface{}, error) {
+            files := u.anchoredFiles()
+            list := make([]interface{}, len(files))
+            for i, f := range files {
+                hash, algorithm := f.SHA256, HashSHA256
+                if f.Digest != "" {
+                    hash, algorithm = f.Digest, f.HashAlgorithm
+                }
+                list[i] = &gqlObject{typeName: "File", fields: map[string]gqlResolver{
+                    "name":          value(f.Name),
+                    "cid":           value(f.CID),
+                    "hash":          value(hash),
+                    "hashAlgorithm": value(algorithm),
+                    "mediaType":     value(f.MediaType),
+                    "size":          value(f.Size),
+                }}
+            }
+            return list, nil
+        },
+        "approval": func(context.Context, map[string]interface{}) (interface{}, error) {
+            a := rec.Approval
+            if a == nil {
+                return nil, nil
+            }
+            return &gqlObject{typeName: "Approval", fields: map[string]gqlResolver{
+                "approver":   value(a.Approver),
+                "result":     value(a.ApproveResult),
+                "reasonCode": value(a.ReasonCode),
+                "comment":    value(a.Comment),
+                "timestamp":  value(a.Timestamp),
+            }}, nil
+        },
+        "model": func(context.Context, map[string]interface{}) (interface{}, error) {
+            return g.graphQLModel(ctx, u.ModelID), nil
+        },
+    }}
+}
+
+// graphQLModel 返回 Model 对象，history 经 Ledger 分页查询
+func (g *HTTPGateway) graphQLModel(ctx context.Context, modelID string) *gqlObject {
+    return &gqlObject{typeName: "Model", fields: map[string]gqlResolver{
+        "id": func(context.Context, map[string]interface{}) (interface{}, error) { return modelID, nil },
+        "history": func(_ context.Context, args map[string]interface{}) (interface{}, error) {
+            if g.Ledger == nil {
+                return nil, errors.New("未配置账本查询")
+            }
+            pageSize, err := gqlInt(args, "pageSize", DefaultHistoryPageSize)
+            if err != nil {
+                return nil, err
+            }
+            bookmark, err := gqlString(args, "bookmark", false)
+            if err != nil {
+                return nil, err
+            }
+            data, err := g.Ledger.QueryModelHistory(ctx, modelID, pageSize, bookmark)
+            if err != nil {
+                return nil, err
+            }
+            var page struct {
+                Records      []LedgerRecord
+                FetchedCount int
+                Bookmark     string
+            }
+            if err := json.Unmarshal(data, &page); err != nil {
+                return nil, fmt.Errorf("解析模型 %s 的历史失败: %v", modelID, err)
+            }
+            updates := make([]interface{}, 0, len(page.Records))
+            for i := range page.Records {
+                if page.Records[i].InitRecord != nil {
+                    updates = append(updates, g.graphQLRecord(ctx, &page.Records[i]))
+                }
+            }
+            return &gqlObject{typeName: "UpdatePage", fields: map[string]gqlResolver{
+                "updates":      func(context.Context, map[string]interface{}) (interface{}, error) { return updates, nil },
+                "bookmark":     func(context.Context, map[string]interface{}) (interface{}, error) { return page.Bookmark, nil },
+                "fetchedCount": func(context.Context, map[string]interface{}) (interface{}, error) { return page.FetchedCount, nil },
+            }}, nil
+        },
+    }}
+}
+
+// -------------------------------
+//  变更
+// -------------------------------
+
+// graphQLMutation 返回 Mutation 根对象，三个变更分别对应 REST 的三个写路由
+func (g *HTTPGateway) graphQLMutation(r *http.Request) *gqlObject {
+    return &gqlObject{typeName: "Mutation", fields: map[string]gqlResolver{
+        "createUpdate": g.graphQLWrite(r, RequestUpdate, g.submitUpdate),
+        "approve":      g.graphQLWrite(r, RequestApproval, g.submitApproval),
+        "addComment":   g.graphQLWrite(r, RequestComment, g.submitComment),
+    }}
+}
+
+// graphQLWrite 将 input 编码为 REST 请求体，按 kind 的 Schema 校验后以操作人身份执行 submit
+func (g *HTTPGateway) graphQLWrite(r *http.Request, kind string, submit gatewaySubmit) gqlResolver {
+    return func(_ context.Context, args map[string]interface{}) (interface{}, error) {
+        input, ok := args["input"].(map[string]interface{})
+        if !ok {
+            return nil, errors.New("缺少对象参数 input")
+        }
+        body, err := json.Marshal(input)
+        if err != nil {
+            return nil, err
+        }
+        if err := ValidateRequest(kind, body); err != nil {
+            return nil, err
+        }
+        if g.Submitter == nil {
+            return nil, errors.New("未配置交易提交器")
+        }
+        user, _, err := gatewayUser(r)
+        if err != nil {
+            return nil, err
+        }
+        ctx := WithIdentity(r.Context(), user.UserID)
+        _, result, err := submit(ctx, user, r.URL.Query().Get("project"), body)
+        if err != nil {
+            Logger().Error("GraphQL 变更失败", "kind", kind, "userId", user.UserID, "err", err)
+            return nil, err
+        }
+        ids, _ := result.(map[string]string)
+        return &gqlObject{typeName: "SubmitResult", fields: map[string]gqlResolver{
+            "updateId": func(context.Context, map[string]interface{}) (interface{}, error) {
+                return nullableString(ids["updateId"]), nil
+            },
+            "commentId": func(context.Context, map[string]interface{}) (interface{}, error) {
+                return nullableString(ids["commentId"]), nil
+            },
+            "update": func(context.Context, map[string]interface{}) (interface{}, error) {
+                updateID := ids["updateId"]
+                if updateID == "" {
+                    updateID, _ = input["UpdateID"].(string)
+                }
+                return g.graphQLUpdate(ctx, updateID)
+            },
+        }}, nil
+    }
+}
+
+// nullableString 空串返回 nil，在 GraphQL 结果中为 null
+func nullableString(s string) interface{} {
+    if s == "" {
+        return nil
+    }
+    return s
+}
@@ -0,0 +1,172 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+)
+
+// graphQLLedger 模型 m1 有 u1（已批准）与 u2 两个更新，记录每次查询的身份；deny 中的更新不在组织范围内
+type graphQLLedger struct {
+    deny       map[string]bool
+    identities []string
+}
+
+func (l *graphQLLedger) record(updateID string) LedgerRecord {
+    rec := LedgerRecord{UpdateID: updateID, InitRecord: &LedgerUpdate{UpdateID: updateID, ModelID: "m1", Version: "1.0", Status: "INITIALIZED"}}
+    if updateID == "u1" {
+        rec.InitRecord.Status = "APPROVED"
+        rec.InitRecord.Files = []LedgerFile{{Name: "model.ifc", CID: "cidA", Hash: "aa", Size: 42}}
+        rec.Approval = &LedgerApproval{UpdateID: "u1", Approver: "1002", ApproveResult: "APPROVED"}
+    }
+    return rec
+}
+
+func (l *graphQLLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    l.identities = append(l.identities, InvokeIdentity(ctx))
+    if l.deny[updateID] {
+        return nil, errors.New(`{"Code":"UNAUTHORIZED","Message":"out of scope"}`)
+    }
+    return json.Marshal(l.record(updateID))
+}
+
+func (l *graphQLLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    l.identities = append(l.identities, InvokeIdentity(ctx))
+    return json.Marshal(map[string]interface{}{
+        "Records":      []LedgerRecord{l.record("u2"), l.record("u1")},
+        "FetchedCount": 2,
+        "Bookmark":     "next-" + bookmark,
+    })
+}
+
+// postGraphQL 以 userID 发送 GraphQL 请求，返回状态码与解析后的响应
+func postGraphQL(t *testing.T, h http.Handler, userID string, query string, variables map[string]interface{}) (int, map[string]interface{}) {
+    body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("POST", "/graphql?userId="+userID, strings.NewReader(string(body))))
+    var resp map[string]interface{}
+    if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+        t.Fatalf("response is not JSON: %v: %s", err, rec.Body.String())
+    }
+    return rec.Code, resp
+}
+
+func TestGraphQLQueryResolvesThroughLedger(t *testing.T) {
+    ledger := &graphQLLedger{}
+    h := NewHTTPGateway(nil, ledger).Handler()
+    query := `query Review($id: ID!, $size: Int = 10) {
+        current: update(id: $id) {
+            __typename id status
+            files { name cid hash hashAlgorithm size }
+            approval { approver result }
+            model { id history(pageSize: $size, bookmark: "b1") { bookmark updates { id } } }
+        }
+    }`
+    code, resp := postGraphQL(t, h, "2001", query, map[string]interface{}{"id": "u1"})
+    if code != http.StatusOK || resp["errors"] != nil {
+        t.Fatalf("status %d: %v", code, resp)
+    }
+
+    got, _ := json.Marshal(resp["data"])
+    want := `{"current":{"__typename":"Update","approval":{"approver":"1002","result":"APPROVED"},` +
+        `"files":[{"cid":"cidA","hash":"aa","hashAlgorithm":"sha256","name":"model.ifc","size":42}],"id":"u1",` +
+        `"model":{"history":{"bookmark":"next-b1","updates":[{"id":"u2"},{"id":"u1"}]},"id":"m1"},"status":"APPROVED"}}`
+    if string(got) != want {
+        t.Fatalf("data = %s\nwant   %s", got, want)
+    }
+    // 嵌套字段的查询也以调用方身份执行
+    if strings.Join(ledger.identities, ",") != "2001,2001" {
+        t.Fatalf("query identities = %v, want 2001 for both", ledger.identities)
+    }
+}
+
+func TestGraphQLFieldErrors(t *testing.T) {
+    ledger := &graphQLLedger{deny: map[string]bool{"u2": true}}
+    h := NewHTTPGateway(nil, ledger).Handler()
+
+    // 不在组织范围内的更新为 null，同一请求中的其他字段照常返回
+    code, resp := postGraphQL(t, h, "2001", `{ a: update(id: "u1") { id } b: update(id: "u2") { id } c: update(id: "u1") { owner } }`, nil)
+    if code != http.StatusOK {
+        t.Fatalf("status %d: %v", code, resp)
+    }
+    got, _ := json.Marshal(resp["data"])
+    if string(got) != `{"a":{"id":"u1"},"b":null,"c":{"owner":null}}` {
+        t.Fatalf("data = %s", got)
+    }
+    errs, _ := json.Marshal(resp["errors"])
+    if !strings.Contains(string(errs), `"path":["b"]`) || !strings.Contains(string(errs), `"path":["c","owner"]`) {
+        t.Fatalf("errors = %s, want entries for b and c.owner", errs)
+    }
+
+    // 语法错误与 GET 上的变更不执行任何字段
+    if code, _ := postGraphQL(t, h, "2001", `{ update(id: "u1") { id }`, nil); code != http.StatusBadRequest {
+        t.Fatalf("syntax error: status %d, want 400", code)
+    }
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql?userId=1001&query="+url.QueryEscape(`mutation { approve(input: {UpdateID: "u1", ApproveResult: "APPROVED"}) { updateId } }`), nil))
+    if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "POST") {
+        t.Fatalf("mutation over GET: status %d: %s", rec.Code, rec.Body.String())
+    }
+}
+
+func TestGraphQLMutationsUseSubmitter(t *testing.T) {
+    invoker := &recordingInvoker{result: "u3"}
+    ledger := &graphQLLedger{}
+    h := NewHTTPGateway(NewRoutedSubmitter(invoker, "bim"), ledger).Handler()
+
+    mutation := `mutation Create($in: UpdateInput!) { createUpdate(input: $in) { updateId update { id modelId } } }`
+    code, resp := postGraphQL(t, h, "1001", mutation, map[string]interface{}{"in": map[string]interface{}{"ModelID": "m1", "Version": "1.1"}})
+    if code != http.StatusOK || resp["errors"] != nil {
+        t.Fatalf("status %d: %v", code, resp)
+    }
+    got, _ := json.Marshal(resp["data"])
+    if string(got) != `{"createUpdate":{"update":{"id":"u3","modelId":"m1"},"updateId":"u3"}}` {
+        t.Fatalf("data = %s", got)
+    }
+
+    code, resp = postGraphQL(t, h, "1002", `mutation { approve(input: {UpdateID: "u1", ApproveResult: "REJECTED", Comment: "clash", ReasonCode: "CLASH"}) { updateId } }`, nil)
+    if code != http.StatusOK || resp["errors"] != nil {
+        t.Fatalf("status %d: %v", code, resp)
+    }
+    var args []string
+    for _, a := range invoker.args[1] {
+        args = append(args, string(a))
+    }
+    if strings.Join(args, "|") != "u1|REJECTED|clash|CLASH" {
+        t.Fatalf("approval args = %q", args)
+    }
+
+    // 与 REST 相同的链码函数与签名身份，结果中的更新以操作人身份查询
+    if strings.Join(invoker.calls, ",") != fnInitBIMUpdate+","+fnApproveBIMUpdate {
+        t.Fatalf("calls = %v", invoker.calls)
+    }
+    if strings.Join(invoker.identities, ",") != "1001,1002" {
+        t.Fatalf("signing identities = %v, want 1001,1002", invoker.identities)
+    }
+    if strings.Join(ledger.identities, ",") != "1001" {
+        t.Fatalf("query identities = %v, want 1001", ledger.identities)
+    }
+}
+
+func TestGraphQLMutationValidatesInput(t *testing.T) {
+    invoker := &recordingInvoker{result: "u1"}
+    h := NewHTTPGateway(NewRoutedSubmitter(invoker, "bim"), nil).Handler()
+
+    // 驳回必须带原因，与 POST /approvals 同一 Schema
+    code, resp := postGraphQL(t, h, "1002", `mutation { approve(input: {UpdateID: "u1", ApproveResult: "REJECTED"}) { updateId } }`, nil)
+    if code != http.StatusOK {
+        t.Fatalf("status %d: %v", code, resp)
+    }
+    errs, _ := json.Marshal(resp["errors"])
+    if !strings.Contains(string(errs), "Schema") || !strings.Contains(string(errs), `"path":["approve"]`) {
+        t.Fatalf("errors = %s, want a schema error on approve", errs)
+    }
+    if len(invoker.calls) > 0 {
+        t.Fatalf("invoked %v for an invalid input", invoker.calls)
+    }
+}
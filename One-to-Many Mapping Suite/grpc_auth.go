@@ -0,0 +1,248 @@
+package mapping
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+)
+
+// -------------------------------
+//  gRPC 调用方认证（mTLS 客户端证书 / OIDC Bearer 令牌）
+// -------------------------------
+
+// AuthConfig gRPC 服务的传输安全与调用方认证；全部为空时仅适合监听 localhost
+type AuthConfig struct {
+    // CertFile / KeyFile 服务端 TLS 证书与私钥
+    CertFile string `yaml:"certFile"`
+    KeyFile  string `yaml:"keyFile"`
+    // ClientCAFile 非空时启用 mTLS：校验客户端证书，证书主题 CN 即 Fabric 身份标签
+    ClientCAFile string `yaml:"clientCaFile"`
+    // CertMSP 客户端证书签发 CA 的 CN -> MSP ID，如 ca.org1.example.com: Org1MSP
+    CertMSP map[string]string `yaml:"certMsp"`
+    // OIDC Bearer 令牌认证，Issuer 为空时不启用
+    OIDC OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig OIDC 令牌校验与 声明 -> Fabric 身份 的映射
+type OIDCConfig struct {
+    Issuer   string `yaml:"issuer"`
+    Audience string `yaml:"audience"`
+    // JWKSURL 为空时通过 Issuer 的 /.well-known/openid-configuration 发现
+    JWKSURL string `yaml:"jwksUrl"`
+    // IdentityClaim 作为身份标签的声明，默认 sub
+    IdentityClaim string `yaml:"identityClaim"`
+    // MSPClaim 携带 MSP ID 的声明；为空或令牌中没有时使用 DefaultMSP
+    MSPClaim   string `yaml:"mspClaim"`
+    DefaultMSP string `yaml:"defaultMsp"`
+    // Identities 声明值 -> 钱包身份标签；为空时直接使用声明值，非空时未列出的声明值被拒绝
+    Identities map[string]string `yaml:"identities"`
+}
+
+// Enabled 是否配置了任一认证方式
+func (c AuthConfig) Enabled() bool {
+    return c.ClientCAFile != "" || c.OIDC.Issuer != ""
+}
+
+// CallerIdentity 已认证的调用方
+type CallerIdentity struct {
+    Label   string // 钱包 / Fabric CA 身份标签，即 GetUserInfo 的 user_id
+    MSPID   string
+    Subject string // 证书主题或令牌 sub
+    Method  string // mtls / oidc
+}
+
+type callerKey struct{}
+
+// CallerFromContext 返回拦截器写入的调用方；未启用认证时为 nil
+func CallerFromContext(ctx context.Context) *CallerIdentity {
+    id, _ := ctx.Value(callerKey{}).(*CallerIdentity)
+    return id
+}
+
+// Authenticator 认证 gRPC 调用并把调用方写入上下文
+type Authenticator struct {
+    cfg  AuthConfig
+    oidc *oidcVerifier
+}
+
+// NewAuthenticator 根据配置创建认证器
+func NewAuthenticator(cfg AuthConfig) (*Authenticator, error) {
+    a := &Authenticator{cfg: cfg}
+    if cfg.OIDC.Issuer != "" {
+        if cfg.OIDC.Audience == "" {
+            return nil, errors.New("auth.oidc.audience 不能为空")
+        }
+        a.oidc = newOIDCVerifier(cfg.OIDC)
+    }
+    return a, nil
+}
+
+// ServerOptions 返回 TLS 凭据与认证拦截器，传给 grpc.NewServer
+func (a *Authenticator) ServerOptions() ([]grpc.ServerOption, error) {
+    var opts []grpc.ServerOption
+    if a.cfg.CertFile != "" {
+        tlsCfg, err := a.tlsConfig()
+        if err != nil {
+            return nil, err
+        }
+        opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+    } else if a.cfg.ClientCAFile != "" {
+        return nil, errors.New("启用 mTLS 需要配置 auth.certFile 与 auth.keyFile")
+    }
+    opts = append(opts,
+        grpc.ChainUnaryInterceptor(a.UnaryInterceptor),
+        grpc.ChainStreamInterceptor(a.StreamInterceptor),
+    )
+    return opts, nil
+}
+
+func (a *Authenticator) tlsConfig() (*tls.Config, error) {
+    cert, err := tls.LoadX509KeyPair(a.cfg.CertFile, a.cfg.KeyFile)
+    if err != nil {
+        return nil, fmt.Errorf("加载服务端 TLS 证书失败: %v", err)
+    }
+    tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+    if a.cfg.ClientCAFile != "" {
+        pemData, err := os.ReadFile(a.cfg.ClientCAFile)
+        if err != nil {
+            return nil, fmt.Errorf("读取客户端 CA 失败: %v", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pemData) {
+            return nil, fmt.Errorf("%s 中没有有效的 CA 证书", a.cfg.ClientCAFile)
+        }
+        tlsCfg.ClientCAs = pool
+        tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+        if a.oidc != nil {
+            // 同时启用 OIDC 时允许只带令牌的客户端
+            tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+        }
+    }
+    return tlsCfg, nil
+}
+
+// Authenticate 依次尝试 Bearer 令牌与客户端证书；都没有时返回 Unauthenticated
+func (a *Authenticator) Authenticate(ctx context.Context) (*CallerIdentity, error) {
+    if a.oidc != nil {
+        if token := bearerToken(ctx); token != "" {
+            id, err := a.oidc.identity(ctx, token)
+            if err != nil {
+                return nil, status.Error(codes.Unauthenticated, err.Error())
+            }
+            return id, nil
+        }
+    }
+    if a.cfg.ClientCAFile != "" {
+        if id := a.certIdentity(ctx); id != nil {
+            return id, nil
+        }
+    }
+    return nil, status.Error(codes.Unauthenticated, "缺少客户端证书或 Bearer 令牌")
+}
+
+// AuthenticateHTTP 按与 gRPC 调用相同的规则认证 REST 网关的请求：先 Authorization: Bearer 令牌，再客户端证书
+func (a *Authenticator) AuthenticateHTTP(r *http.Request) (*CallerIdentity, error) {
+    if a.oidc != nil {
+        if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "bearer") {
+            return a.oidc.identity(r.Context(), strings.TrimSpace(token))
+        }
+    }
+    if a.cfg.ClientCAFile != "" && r.TLS != nil {
+        if id := a.chainIdentity(r.TLS.VerifiedChains); id != nil {
+            return id, nil
+        }
+    }
+    return nil, errors.New("缺少客户端证书或 Bearer 令牌")
+}
+
+// certIdentity 从 gRPC 连接已校验的客户端证书链取身份
+func (a *Authenticator) certIdentity(ctx context.Context) *CallerIdentity {
+    p, ok := peer.FromContext(ctx)
+    if !ok || p.AuthInfo == nil {
+        return nil
+    }
+    info, ok := p.AuthInfo.(credentials.TLSInfo)
+    if !ok {
+        return nil
+    }
+    return a.chainIdentity(info.State.VerifiedChains)
+}
+
+// chainIdentity 叶子证书 CN 为标签，签发 CA 的 CN 查 CertMSP；没有已校验的证书链时返回 nil
+func (a *Authenticator) chainIdentity(chains [][]*x509.Certificate) *CallerIdentity {
+    if len(chains) == 0 || len(chains[0]) == 0 {
+        return nil
+    }
+    leaf := chains[0][0]
+    return &CallerIdentity{
+        Label:   leaf.Subject.CommonName,
+        MSPID:   a.cfg.CertMSP[leaf.Issuer.CommonName],
+        Subject: leaf.Subject.String(),
+        Method:  "mtls",
+    }
+}
+
+// UnaryInterceptor 认证一元调用
+func (a *Authenticator) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+    id, err := a.Authenticate(ctx)
+    if err != nil {
+        Logger().Warn("gRPC 调用认证失败", "method", info.FullMethod, "err", err)
+        return nil, err
+    }
+    return handler(context.WithValue(ctx, callerKey{}, id), req)
+}
+
+// StreamInterceptor 认证流式调用
+func (a *Authenticator) StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+    id, err := a.Authenticate(ss.Context())
+    if err != nil {
+        Logger().Warn("gRPC 调用认证失败", "method", info.FullMethod, "err", err)
+        return err
+    }
+    return handler(srv, &authedStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), callerKey{}, id)})
+}
+
+// authedStream 替换流的上下文，使处理函数能取到调用方
+type authedStream struct {
+    grpc.ServerStream
+    ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+    return s.ctx
+}
+
+// bearerToken 读取 authorization: Bearer <token> 元数据
+func bearerToken(ctx context.Context) string {
+    md, ok := metadata.FromIncomingContext(ctx)
+    if !ok {
+        return ""
+    }
+    for _, v := range md.Get("authorization") {
+        if scheme, token, ok := strings.Cut(v, " "); ok && strings.EqualFold(scheme, "bearer") {
+            return strings.TrimSpace(token)
+        }
+    }
+    return ""
+}
+
+// authorizeUser 启用认证时，请求中的 userID 必须是调用方本人
+func authorizeUser(ctx context.Context, userID string) error {
+    caller := CallerFromContext(ctx)
+    if caller == nil || caller.Label == userID {
+        return nil
+    }
+    return status.Errorf(codes.PermissionDenied, "调用方 %s 不能以 %s 的身份操作", caller.Label, userID)
+}
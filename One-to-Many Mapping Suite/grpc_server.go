@@ -0,0 +1,294 @@
+package mapping
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mapping_service.proto
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "net"
+
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// -------------------------------
+//  gRPC 服务封装（定义见 mapping_service.proto）
+// -------------------------------
+
+// DefaultMaxUploadBytes 单个 BIM 文件的默认上传上限（1 GiB）
+const DefaultMaxUploadBytes = 1 << 30
+
+// DefaultHistoryPageSize StreamModelHistory 每次链码查询的默认记录数
+const DefaultHistoryPageSize = 100
+
+// MappingServer 将映射流程暴露为 gRPC 服务
+type MappingServer struct {
+    UnimplementedMappingServiceServer
+
+    // MaxUploadBytes 单个文件上传上限，<= 0 时使用 DefaultMaxUploadBytes
+    MaxUploadBytes int64
+    // Nodes 节点连接管理器，为空时 ListNodes 不可用
+    Nodes *ConnectionManager
+    // Dedup 内容去重器，为空时每次都上传
+    Dedup *Deduplicator
+    // Ledger 链码只读查询，为空时 StreamModelHistory 不可用
+    Ledger LedgerQuerier
+}
+
+// NewMappingServer 创建 gRPC 服务实现
+func NewMappingServer() *MappingServer {
+    return &MappingServer{MaxUploadBytes: DefaultMaxUploadBytes}
+}
+
+// UploadModel 接收分块上传的 BIM 文件并执行初始信息处理
+func (s *MappingServer) UploadModel(stream MappingService_UploadModelServer) error {
+    limit := s.MaxUploadBytes
+    if limit <= 0 {
+        limit = DefaultMaxUploadBytes
+    }
+
+    var fileName string
+    buf := &bytes.Buffer{}
+    for {
+        chunk, err := stream.Recv()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+        if fileName == "" {
+            fileName = chunk.GetFileName()
+        }
+        if int64(buf.Len()+len(chunk.GetData())) > limit {
+            return status.Errorf(codes.ResourceExhausted, "文件超过上传上限 %d 字节", limit)
+        }
+        buf.Write(chunk.GetData())
+    }
+    if fileName == "" {
+        return status.Error(codes.InvalidArgument, "第一个分块缺少文件名")
+    }
+    if buf.Len() == 0 {
+        return status.Error(codes.InvalidArgument, "文件内容为空")
+    }
+
+    var info *BIMInitInfo
+    var existing *Anchor
+    var err error
+    if s.Dedup != nil {
+        info, existing, err = s.Dedup.Upload(stream.Context(), fileName, buf.Bytes())
+    } else {
+        info, err = ProcessInitialInfo(stream.Context(), fileName, buf.Bytes())
+    }
+    if err != nil {
+        Logger().Error("UploadModel 处理失败", "fileName", fileName, "err", err)
+        return statusFromError(codes.Internal, err)
+    }
+    Logger().Info("模型已上传", "fileName", fileName, "cid", info.CID, "size", buf.Len(), "duplicate", existing != nil)
+    resp := &UploadModelResponse{
+        FileName:      info.FileName,
+        Cid:           info.CID,
+        FileHash:      info.FileHash,
+        Size:          int64(buf.Len()),
+        Duplicate:     existing != nil,
+        HashAlgorithm: info.HashAlgorithm,
+    }
+    if existing.Anchored() {
+        resp.ExistingUpdateId = existing.UpdateID
+    }
+    return stream.SendAndClose(resp)
+}
+
+// GetUserInfo 查询用户信息
+func (s *MappingServer) GetUserInfo(ctx context.Context, req *GetUserInfoRequest) (*GetUserInfoResponse, error) {
+    if req.GetUserId() == "" {
+        return nil, status.Error(codes.InvalidArgument, "user_id 不能为空")
+    }
+    if err := authorizeUser(ctx, req.GetUserId()); err != nil {
+        return nil, err
+    }
+    user, err := GetUserInfo(ctx, req.GetUserId())
+    if err != nil {
+        return nil, statusFromError(codes.NotFound, err)
+    }
+    return &GetUserInfoResponse{
+        UserId:     user.UserID,
+        Department: user.Department,
+        Role:       user.Role,
+    }, nil
+}
+
+// SubmitTransaction 封装交易（用户信息 + 初始信息）并映射到区块链节点
+func (s *MappingServer) SubmitTransaction(ctx context.Context, req *SubmitTransactionRequest) (*SubmitTransactionResponse, error) {
+    if req.GetCid() == "" || req.GetFileHash() == "" {
+        return nil, status.Error(codes.InvalidArgument, "cid 与 file_hash 不能为空，请先调用 UploadModel")
+    }
+    if err := authorizeUser(ctx, req.GetUserId()); err != nil {
+        return nil, err
+    }
+
+    user, err := GetUserInfo(ctx, req.GetUserId())
+    if err != nil {
+        return nil, statusFromError(codes.NotFound, err)
+    }
+    bim := &BIMInitInfo{
+        FileName:      req.GetFileName(),
+        CID:           req.GetCid(),
+        FileHash:      req.GetFileHash(),
+        HashAlgorithm: req.GetHashAlgorithm(),
+    }
+    if bim.HashAlgorithm == "" {
+        bim.HashAlgorithm = DefaultHashAlgorithm
+    }
+    tx, err := PackageProjectTransaction(ctx, user, bim, req.GetProjectId())
+    if IsQuotaExceeded(err) {
+        return nil, status.Error(codes.ResourceExhausted, err.Error())
+    }
+    if err != nil {
+        return nil, statusFromError(codes.InvalidArgument, err)
+    }
+    log := txLog(tx.TxID).With("userId", user.UserID)
+    node, err := MapToProjectNode(user.Department, req.GetProjectId())
+    if err != nil {
+        log.Error("节点映射失败", "department", user.Department, "projectId", req.GetProjectId(), "err", err)
+        return nil, status.Error(codes.FailedPrecondition, err.Error())
+    }
+    payload, err := json.Marshal(tx)
+    if err != nil {
+        log.Error("交易序列化失败", "err", err)
+        return nil, status.Error(codes.Internal, err.Error())
+    }
+    log.Info("交易已封装", "node", node.NodeURL, "org", node.OrgName, "channel", node.Channel)
+
+    return &SubmitTransactionResponse{
+        TxId:      tx.TxID,
+        Timestamp: tx.Timestamp,
+        NodeUrl:   node.NodeURL,
+        OrgName:   node.OrgName,
+        Payload:   payload,
+        Channel:   node.Channel,
+    }, nil
+}
+
+// ListNodes 返回各区块链节点的连接与健康状态
+func (s *MappingServer) ListNodes(ctx context.Context, req *ListNodesRequest) (*ListNodesResponse, error) {
+    if s.Nodes == nil {
+        return nil, status.Error(codes.FailedPrecondition, "未启用节点连接管理器")
+    }
+    resp := &ListNodesResponse{}
+    for _, n := range s.Nodes.Statuses() {
+        if req.GetUnhealthyOnly() && n.Healthy {
+            continue
+        }
+        resp.Nodes = append(resp.Nodes, &NodeStatusInfo{
+            NodeUrl:   n.NodeURL,
+            OrgName:   n.OrgName,
+            Routes:    n.Routes,
+            Healthy:   n.Healthy,
+            State:     n.State,
+            LastCheck: n.LastCheck.Unix(),
+            LastError: n.LastError,
+            Failures:  int32(n.Failures),
+        })
+    }
+    return resp, nil
+}
+
+// StreamModelHistory 以分页的 QueryModelHistory 逐页读取模型的全部更新，每读到一页即发送，
+// 上千条更新的模型不必等全部查完再一次性返回
+func (s *MappingServer) StreamModelHistory(req *StreamModelHistoryRequest, stream MappingService_StreamModelHistoryServer) error {
+    if req.GetModelId() == "" {
+        return status.Error(codes.InvalidArgument, "model_id 不能为空")
+    }
+    if s.Ledger == nil {
+        return status.Error(codes.FailedPrecondition, "未配置账本查询")
+    }
+    pageSize := int(req.GetPageSize())
+    if pageSize <= 0 {
+        pageSize = DefaultHistoryPageSize
+    }
+
+    ctx := stream.Context()
+    log := Logger().With("modelId", req.GetModelId())
+    bookmark := req.GetBookmark()
+    sent := 0
+    for {
+        data, err := s.Ledger.QueryModelHistory(ctx, req.GetModelId(), pageSize, bookmark)
+        if err != nil {
+            log.Error("StreamModelHistory 查询失败", "bookmark", bookmark, "sent", sent, "err", err)
+            return statusFromError(codes.Unavailable, err)
+        }
+        var page struct {
+            Records      []json.RawMessage `json:"Records"`
+            FetchedCount int               `json:"FetchedCount"`
+            Bookmark     string            `json:"Bookmark"`
+        }
+        if err := json.Unmarshal(data, &page); err != nil {
+            return status.Errorf(codes.Internal, "解析 QueryModelHistory 结果失败: %v", err)
+        }
+        // FetchedCount 为过滤前读到的索引条数，不足一页即已读完
+        last := page.Bookmark == "" || page.FetchedCount < pageSize
+        msg := &ModelHistoryPage{}
+        if !last {
+            msg.Bookmark = page.Bookmark
+        }
+        for _, rec := range page.Records {
+            msg.Records = append(msg.Records, rec)
+        }
+        if err := stream.Send(msg); err != nil {
+            return err
+        }
+        sent += len(msg.Records)
+        if last {
+            log.Debug("模型历史已发送", "records", sent)
+            return nil
+        }
+        bookmark = page.Bookmark
+    }
+}
+
+// ServeGRPC 在 addr 上启动映射 gRPC 服务，阻塞直到监听失败或服务停止。
+// 配置了 auth（见 AuthConfig）时启用 TLS 与调用方认证，UploadModel 之外的请求只能以调用方本人身份操作。
+// 需要 StreamModelHistory 时改用设置了 Ledger 的 MappingServer.Serve。
+func ServeGRPC(addr string, opts ...grpc.ServerOption) error {
+    server := NewMappingServer()
+    server.Nodes = CurrentConnectionManager()
+    return server.Serve(addr, opts...)
+}
+
+// Serve 在 addr 上以 s 启动映射 gRPC 服务，认证配置同 ServeGRPC
+func (s *MappingServer) Serve(addr string, opts ...grpc.ServerOption) error {
+    if cfg := CurrentConfig().Auth; cfg.Enabled() || cfg.CertFile != "" {
+        auth, err := NewAuthenticator(cfg)
+        if err != nil {
+            return err
+        }
+        authOpts, err := auth.ServerOptions()
+        if err != nil {
+            return err
+        }
+        opts = append(authOpts, opts...)
+    }
+    lis, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    srv := grpc.NewServer(opts...)
+    RegisterMappingServiceServer(srv, s)
+    return srv.Serve(lis)
+}
+
+// statusFromError 把调用方超时与取消转换为 DeadlineExceeded / Canceled，其他错误使用 code
+func statusFromError(code codes.Code, err error) error {
+    switch {
+    case errors.Is(err, context.DeadlineExceeded):
+        return status.Error(codes.DeadlineExceeded, err.Error())
+    case errors.Is(err, context.Canceled):
+        return status.Error(codes.Canceled, err.Error())
+    }
+    return status.Error(code, err.Error())
+}
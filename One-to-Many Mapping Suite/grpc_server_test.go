@@ -0,0 +1,115 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "testing"
+
+    "google.golang.org/grpc"
+)
+
+// pagedLedger 模拟链码分页：书签为下一条记录的序号，只有偶数序号的记录属于调用方组织
+type pagedLedger struct {
+    total     int
+    pageSizes []int
+}
+
+func (l *pagedLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    return nil, fmt.Errorf(`{"Code":"NOT_FOUND"}`)
+}
+
+func (l *pagedLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    l.pageSizes = append(l.pageSizes, pageSize)
+    start, _ := strconv.Atoi(bookmark)
+    end := start + pageSize
+    if end > l.total {
+        end = l.total
+    }
+    page := struct {
+        Records      []map[string]string
+        FetchedCount int
+        Bookmark     string
+    }{Records: []map[string]string{}, FetchedCount: end - start, Bookmark: strconv.Itoa(end)}
+    for i := start; i < end; i++ {
+        if i%2 == 0 {
+            page.Records = append(page.Records, map[string]string{"UpdateID": fmt.Sprintf("u%d", i), "ModelID": modelID})
+        }
+    }
+    return json.Marshal(page)
+}
+
+// historyStream 收集 StreamModelHistory 发送的页
+type historyStream struct {
+    grpc.ServerStream
+    pages []*ModelHistoryPage
+}
+
+func (s *historyStream) Send(page *ModelHistoryPage) error {
+    s.pages = append(s.pages, page)
+    return nil
+}
+
+func (s *historyStream) Context() context.Context {
+    return context.Background()
+}
+
+func TestStreamModelHistory(t *testing.T) {
+    tests := []struct {
+        name      string
+        total     int
+        pageSize  int32
+        bookmark  string
+        pages     int
+        records   int
+        pageSizes int // 期望每次查询使用的记录数
+    }{
+        {"several pages", 25, 10, "", 3, 13, 10},
+        {"exact multiple", 20, 10, "", 3, 10, 10},
+        {"default page size", 150, 0, "", 2, 75, DefaultHistoryPageSize},
+        {"resume from bookmark", 25, 10, "20", 1, 3, 10},
+        {"empty model", 0, 10, "", 1, 0, 10},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ledger := &pagedLedger{total: tt.total}
+            s := NewMappingServer()
+            s.Ledger = ledger
+            stream := &historyStream{}
+            if err := s.StreamModelHistory(&StreamModelHistoryRequest{ModelId: "m1", PageSize: tt.pageSize, Bookmark: tt.bookmark}, stream); err != nil {
+                t.Fatal(err)
+            }
+
+            if len(stream.pages) != tt.pages {
+                t.Fatalf("sent %d pages, want %d", len(stream.pages), tt.pages)
+            }
+            records := 0
+            for i, page := range stream.pages {
+                records += len(page.Records)
+                if last := i == len(stream.pages)-1; last != (page.Bookmark == "") {
+                    t.Fatalf("page %d has bookmark %q", i, page.Bookmark)
+                }
+            }
+            if records != tt.records {
+                t.Fatalf("sent %d records, want %d", records, tt.records)
+            }
+            for _, size := range ledger.pageSizes {
+                if size != tt.pageSizes {
+                    t.Fatalf("queried with page sizes %v, want %d", ledger.pageSizes, tt.pageSizes)
+                }
+            }
+        })
+    }
+}
+
+func TestStreamModelHistoryRequiresLedgerAndModel(t *testing.T) {
+    s := NewMappingServer()
+    if err := s.StreamModelHistory(&StreamModelHistoryRequest{ModelId: "m1"}, &historyStream{}); err == nil {
+        t.Fatal("streamed without a Ledger")
+    }
+    s.Ledger = &pagedLedger{}
+    if err := s.StreamModelHistory(&StreamModelHistoryRequest{}, &historyStream{}); err == nil {
+        t.Fatal("streamed without a model_id")
+    }
+}
@@ -0,0 +1,367 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// -------------------------------
+//  REST 网关（与 gRPC 服务并列）
+// -------------------------------
+
+// REST 网关供不便使用 gRPC 的客户端（浏览器、脚本）调用链码。写请求在调用链码前先经 ValidateJSONBody
+// 按 schemas/ 下的 Schema 校验，不合格的请求直接以 422 返回，不会成为交易：
+//
+//	POST /updates                    更新 JSON，调用 InitBIMUpdate，返回 201 与 {"updateId"}
+//	POST /approvals                  审批，调用 ApproveBIMUpdate，返回 {"updateId"}
+//	POST /comments                   评论，调用 AddComment，返回 {"commentId"}
+//	GET  /updates/<UpdateID>         经 LedgerQuerier 查询更新（QueryUpdate 的结果）
+//	POST /graphql                    GraphQL 查询与变更，与上面的路由共用校验、提交与查询（见 graphql_gateway.go）
+//	GET  /events                     WebSocket，推送调用方可查询的更新的链码事件（见 EventHub）
+//	POST /tokens                     {"UpdateID","CID"}，签发取回该文件的短期令牌（见 RetrievalTokens）
+//	GET  /files/<UpdateID>/<CID>     ?token=<令牌>，经 Files 代理读取文件，令牌即授权，无需认证
+//	GET  /schemas/<种类>.schema.json  发布请求 Schema，无需认证
+//	GET  /health                     网关负载（GatewayLoad），无需认证
+//
+// 写请求的查询参数 userId 为操作人（同 gRPC 的 user_id），决定交易路由到的部门节点；project 为项目 ID，
+// 为空时使用默认通道。启用认证时（见 AuthConfig）与 gRPC 服务相同，调用方只能以本人身份操作，省略 userId 时即为本人。
+// 交易与查询都以操作人本人的钱包身份签名（见 InvokeIdentity），链码据此检查角色、重复投票与组织范围；
+// GET 请求的操作人为调用方本人，未启用认证时为查询参数 userId。
+//
+// 写请求可带 Idempotency-Key（见 idempotency.go），键按调用方隔离；POST /updates 的请求体没有 ClientRequestID 时，
+// 网关填入由调用方与键派生的 ID，使响应未能保存的重试在链码中也不会产生第二个更新。
+//
+// 配置 MaxInFlight 后，写请求、GET /updates 与 /graphql 同时处理的数量超过上限时立即以 503 拒绝并带 Retry-After，
+// 客户端据此放慢，而不是在 Peer 或 IPFS 饱和时一起超时。
+//
+// Submitter.WaitForCommit 为真时写请求等交易以 VALID 写入区块后才响应；Ledger 带缓存（如 CachedLedger）时
+// 同时删除受影响的缓存条目，不等链码事件到达。这样响应之后的 GET 读到的就是提交后的状态，
+// 界面提交成功后立即查询不会得到“更新不存在”。
+
+// 网关调用的链码函数
+const (
+    fnInitBIMUpdate    = "SmartContract:InitBIMUpdate"
+    fnApproveBIMUpdate = "ApprovalContract:ApproveBIMUpdate"
+    fnAddComment       = "CommentContract:AddComment"
+)
+
+// HTTPGateway REST 网关
+type HTTPGateway struct {
+    // Submitter 提交写请求，为空时写请求不可用
+    Submitter *RoutedSubmitter
+    // Ledger 只读查询，为空时 GET /updates/<UpdateID> 不可用
+    Ledger LedgerQuerier
+    // Auth 调用方认证，为空时不认证（仅适合监听 localhost）
+    Auth *Authenticator
+    // MaxBytes 请求体上限，<= 0 时为 DefaultMaxRequestBytes
+    MaxBytes int64
+    // Idempotency 写请求的幂等中间件，为空时不处理 Idempotency-Key
+    Idempotency *IdempotencyGuard
+    // Events 链码事件推送，为空时 GET /events 不可用；须注册到事件监听服务
+    Events *EventHub
+    // Tokens 与 Files 都配置时提供 POST /tokens 与 GET /files/，Files 通常为 IPFSContentSource
+    Tokens *RetrievalTokens
+    Files  ContentSource
+    // MaxInFlight 同时处理的写请求与查询上限，<= 0 表示不限
+    MaxInFlight int
+    // RetryAfter 超过上限时建议客户端等待的时间，按整秒取上，默认 1s
+    RetryAfter time.Duration
+}
+
+// NewHTTPGateway 创建 REST 网关，幂等记录保存在内存中；需要重启后仍能重放时替换 Idempotency.Store
+func NewHTTPGateway(submitter *RoutedSubmitter, ledger LedgerQuerier) *HTTPGateway {
+    return &HTTPGateway{
+        Submitter:   submitter,
+        Ledger:      ledger,
+        Idempotency: NewIdempotencyGuard(&LocalIdempotencyStore{}, GatewayCaller),
+    }
+}
+
+// Handler 返回挂载了全部路由的 http.Handler
+func (g *HTTPGateway) Handler() http.Handler {
+    limiter := newInFlightLimiter(g.MaxInFlight, g.RetryAfter)
+    mux := http.NewServeMux()
+    mux.Handle("/schemas/", http.StripPrefix("/schemas", SchemaHandler()))
+    mux.HandleFunc("/health", limiter.health)
+    mux.Handle("/updates", limiter.wrap(g.authenticate(g.idempotent(g.write(RequestUpdate, g.submitUpdate)))))
+    mux.Handle("/approvals", limiter.wrap(g.authenticate(g.idempotent(g.write(RequestApproval, g.submitApproval)))))
+    mux.Handle("/comments", limiter.wrap(g.authenticate(g.idempotent(g.write(RequestComment, g.submitComment)))))
+    mux.Handle("/updates/", limiter.wrap(g.authenticate(http.HandlerFunc(g.getUpdate))))
+    mux.Handle("/graphql", limiter.wrap(g.authenticate(http.HandlerFunc(g.serveGraphQL))))
+    mux.Handle("/tokens", limiter.wrap(g.authenticate(http.HandlerFunc(g.issueToken))))
+    mux.Handle("/files/", limiter.wrap(http.HandlerFunc(g.serveFile)))
+    if g.Events != nil {
+        mux.Handle("/events", g.authenticate(g.Events))
+    }
+    return mux
+}
+
+// ServeHTTPGateway 在 addr 上启动 REST 网关，阻塞直到监听失败或服务停止。
+// TLS 与调用方认证使用与 ServeGRPC 相同的 auth 配置。
+func ServeHTTPGateway(addr string, g *HTTPGateway) error {
+    srv := &http.Server{Addr: addr, ReadHeaderTimeout: 10 * time.Second}
+    if cfg := CurrentConfig().Auth; cfg.Enabled() || cfg.CertFile != "" {
+        auth, err := NewAuthenticator(cfg)
+        if err != nil {
+            return err
+        }
+        if cfg.CertFile != "" {
+            if srv.TLSConfig, err = auth.tlsConfig(); err != nil {
+                return err
+            }
+        } else if cfg.ClientCAFile != "" {
+            return errors.New("启用 mTLS 需要配置 auth.certFile 与 auth.keyFile")
+        }
+        if g.Auth == nil {
+            g.Auth = auth
+        }
+    }
+    srv.Handler = g.Handler()
+    if srv.TLSConfig != nil {
+        return srv.ListenAndServeTLS("", "")
+    }
+    return srv.ListenAndServe()
+}
+
+// gatewaySubmit 以 user 的身份在 projectID 的通道上执行一个已通过 Schema 校验的写请求，返回响应状态码与 JSON 正文
+type gatewaySubmit func(ctx context.Context, user *UserInfo, projectID string, body []byte) (int, interface{}, error)
+
+// authenticate 配置了 Auth 时认证调用方并写入上下文，供 CallerFromContext 读取
+func (g *HTTPGateway) authenticate(next http.Handler) http.Handler {
+    if g.Auth == nil {
+        return next
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id, err := g.Auth.AuthenticateHTTP(r)
+        if err != nil {
+            Logger().Warn("REST 请求认证失败", "path", r.URL.Path, "err", err)
+            http.Error(w, err.Error(), http.StatusUnauthorized)
+            return
+        }
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, id)))
+    })
+}
+
+// GatewayCaller 返回 REST 请求的调用方，作为 IdempotencyGuard.Scope：启用认证时为 MSP ID 与身份标签，
+// 否则为查询参数 userId
+func GatewayCaller(r *http.Request) string {
+    if caller := CallerFromContext(r.Context()); caller != nil {
+        return caller.MSPID + "/" + caller.Label
+    }
+    return r.URL.Query().Get("userId")
+}
+
+// ledgerInvalidator 可选扩展：带缓存的 LedgerQuerier 在写请求提交后删除受影响的条目
+type ledgerInvalidator interface {
+    Invalidate(ctx context.Context, updateID string, modelID string) error
+}
+
+// committed 在写请求已等到提交时使 Ledger 中更新 updateID 与模型 modelID 的缓存失效；
+// 未等待提交时交易可能尚未写入区块，此时删除缓存只会再缓存旧状态，留给链码事件处理
+func (g *HTTPGateway) committed(ctx context.Context, updateID string, modelID string) {
+    if !g.Submitter.WaitForCommit {
+        return
+    }
+    invalidator, ok := g.Ledger.(ledgerInvalidator)
+    if !ok {
+        return
+    }
+    if err := invalidator.Invalidate(ctx, updateID, modelID); err != nil {
+        Logger().Warn("提交后删除查询缓存失败", "updateId", updateID, "modelId", modelID, "err", err)
+    }
+}
+
+// idempotent 配置了 Idempotency 时由其处理 Idempotency-Key
+func (g *HTTPGateway) idempotent(next http.Handler) http.Handler {
+    if g.Idempotency == nil {
+        return next
+    }
+    return g.Idempotency.Handler(next)
+}
+
+// write 只接受 POST，按 kind 的 Schema 校验请求体后执行 submit
+func (g *HTTPGateway) write(kind string, submit gatewaySubmit) http.Handler {
+    handler := ValidateJSONBody(kind, g.MaxBytes, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if g.Submitter == nil {
+            http.Error(w, "未配置交易提交器", http.StatusServiceUnavailable)
+            return
+        }
+        user, status, err := gatewayUser(r)
+        if err != nil {
+            http.Error(w, err.Error(), status)
+            return
+        }
+        body, err := io.ReadAll(r.Body)
+        if err != nil {
+            http.Error(w, "读取请求体失败", http.StatusBadRequest)
+            return
+        }
+        ctx := WithIdentity(r.Context(), user.UserID)
+        status, result, err := submit(ctx, user, r.URL.Query().Get("project"), body)
+        if err != nil {
+            Logger().Error("REST 写请求失败", "kind", kind, "userId", user.UserID, "err", err)
+            http.Error(w, err.Error(), chaincodeHTTPStatus(err))
+            return
+        }
+        writeGatewayJSON(w, status, result)
+    }))
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+            w.Header().Set("Allow", http.MethodPost)
+            http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+            return
+        }
+        handler.ServeHTTP(w, r)
+    })
+}
+
+// gatewayUser 返回写请求的操作人及失败时的状态码：查询参数 userId，启用认证时默认为且只能为调用方本人
+func gatewayUser(r *http.Request) (*UserInfo, int, error) {
+    userID := r.URL.Query().Get("userId")
+    if caller := CallerFromContext(r.Context()); caller != nil {
+        if userID == "" {
+            userID = caller.Label
+        }
+        if userID != caller.Label {
+            return nil, http.StatusForbidden, fmt.Errorf("调用方 %s 不能以 %s 的身份操作", caller.Label, userID)
+        }
+    }
+    if userID == "" {
+        return nil, http.StatusBadRequest, errors.New("缺少查询参数 userId")
+    }
+    user, err := GetUserInfo(r.Context(), userID)
+    if err != nil {
+        return nil, http.StatusNotFound, err
+    }
+    return user, 0, nil
+}
+
+// submitUpdate 将请求体作为更新 JSON 提交；带幂等键且未指定 ClientRequestID 时填入 ClientRequestIDFrom 的 ID
+func (g *HTTPGateway) submitUpdate(ctx context.Context, user *UserInfo, projectID string, body []byte) (int, interface{}, error) {
+    var update struct {
+        ModelID string
+    }
+    if err := json.Unmarshal(body, &update); err != nil {
+        return 0, nil, err
+    }
+    if id := ClientRequestIDFrom(ctx); id != "" {
+        var fields map[string]json.RawMessage
+        if err := json.Unmarshal(body, &fields); err != nil {
+            return 0, nil, err
+        }
+        if _, ok := fields["ClientRequestID"]; !ok {
+            fields["ClientRequestID"], _ = json.Marshal(id)
+            var err error
+            if body, err = json.Marshal(fields); err != nil {
+                return 0, nil, err
+            }
+        }
+    }
+    _, result, err := g.Submitter.SubmitArgs(ctx, user.Department, projectID, fnInitBIMUpdate, body)
+    if err != nil {
+        return 0, nil, err
+    }
+    updateID := strings.TrimSpace(string(result))
+    g.committed(ctx, updateID, update.ModelID)
+    return http.StatusCreated, map[string]string{"updateId": updateID}, nil
+}
+
+// submitApproval 按 approval Schema 的字段调用 ApproveBIMUpdate
+func (g *HTTPGateway) submitApproval(ctx context.Context, user *UserInfo, projectID string, body []byte) (int, interface{}, error) {
+    var req struct {
+        UpdateID      string
+        ApproveResult string
+        Comment       string
+        ReasonCode    string
+    }
+    if err := json.Unmarshal(body, &req); err != nil {
+        return 0, nil, err
+    }
+    _, _, err := g.Submitter.SubmitArgs(ctx, user.Department, projectID, fnApproveBIMUpdate,
+        []byte(req.UpdateID), []byte(req.ApproveResult), []byte(req.Comment), []byte(req.ReasonCode))
+    if err != nil {
+        return 0, nil, err
+    }
+    g.committed(ctx, req.UpdateID, "")
+    return http.StatusOK, map[string]string{"updateId": req.UpdateID}, nil
+}
+
+// submitComment 按 comment Schema 的字段调用 AddComment
+func (g *HTTPGateway) submitComment(ctx context.Context, user *UserInfo, projectID string, body []byte) (int, interface{}, error) {
+    var req struct {
+        UpdateID string
+        Text     string
+        ReplyTo  string
+    }
+    if err := json.Unmarshal(body, &req); err != nil {
+        return 0, nil, err
+    }
+    _, result, err := g.Submitter.SubmitArgs(ctx, user.Department, projectID, fnAddComment,
+        []byte(req.UpdateID), []byte(req.Text), []byte(req.ReplyTo))
+    if err != nil {
+        return 0, nil, err
+    }
+    g.committed(ctx, req.UpdateID, "")
+    return http.StatusCreated, map[string]string{"commentId": strings.TrimSpace(string(result))}, nil
+}
+
+// getUpdate 处理 GET /updates/<UpdateID>
+func (g *HTTPGateway) getUpdate(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        w.Header().Set("Allow", "GET, HEAD")
+        http.Error(w, "只支持 GET", http.StatusMethodNotAllowed)
+        return
+    }
+    updateID := strings.TrimPrefix(r.URL.Path, "/updates/")
+    if updateID == "" || strings.Contains(updateID, "/") {
+        http.NotFound(w, r)
+        return
+    }
+    if g.Ledger == nil {
+        http.Error(w, "未配置账本查询", http.StatusServiceUnavailable)
+        return
+    }
+    data, err := g.Ledger.QueryUpdate(gatewayQueryContext(r), updateID)
+    if err != nil {
+        http.Error(w, err.Error(), chaincodeHTTPStatus(err))
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.Write(data)
+}
+
+// gatewayQueryContext 返回以操作人身份查询的上下文：启用认证时为调用方本人，否则为查询参数 userId
+func gatewayQueryContext(r *http.Request) context.Context {
+    if userID := r.URL.Query().Get("userId"); userID != "" && CallerFromContext(r.Context()) == nil {
+        return WithIdentity(r.Context(), userID)
+    }
+    return r.Context()
+}
+
+// chaincodeHTTPStatus 按链码错误码（{"Code":...}）选择状态码；没有错误码的失败视为上游错误
+func chaincodeHTTPStatus(err error) int {
+    msg := err.Error()
+    switch {
+    case errors.Is(err, context.DeadlineExceeded):
+        return http.StatusGatewayTimeout
+    case strings.Contains(msg, `"Code":"NOT_FOUND"`):
+        return http.StatusNotFound
+    case strings.Contains(msg, `"Code":"UNAUTHORIZED"`):
+        return http.StatusForbidden
+    case strings.Contains(msg, `"Code":"INVALID_STATE"`), strings.Contains(msg, `"Code":"DUPLICATE"`):
+        return http.StatusConflict
+    }
+    return http.StatusBadGateway
+}
+
+func writeGatewayJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
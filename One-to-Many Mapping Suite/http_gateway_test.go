@@ -0,0 +1,280 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// recordingInvoker 记录调用及其签名身份并返回固定结果
+type recordingInvoker struct {
+    calls      []string
+    args       [][][]byte
+    identities []string
+    result     string
+}
+
+func (i *recordingInvoker) Invoke(ctx context.Context, node *NodeMapping, chaincode string, function string, args ...[]byte) ([]byte, error) {
+    i.calls = append(i.calls, function)
+    i.args = append(i.args, args)
+    i.identities = append(i.identities, InvokeIdentity(ctx))
+    return []byte(i.result), nil
+}
+
+func TestHTTPGatewayValidatesBeforeInvoking(t *testing.T) {
+    tests := []struct {
+        name     string
+        method   string
+        path     string
+        body     string
+        status   int
+        function string // 期望调用的链码函数，为空表示不调用
+    }{
+        {"update", "POST", "/updates?userId=1001", `{"UpdateID":"u1","ModelID":"m1","Version":"1.0"}`, http.StatusCreated, fnInitBIMUpdate},
+        {"update without ModelID", "POST", "/updates?userId=1001", `{"UpdateID":"u1","Version":"1.0"}`, http.StatusUnprocessableEntity, ""},
+        {"update with chaincode field", "POST", "/updates?userId=1001", `{"ModelID":"m1","Version":"1.0","Status":"APPROVED"}`, http.StatusUnprocessableEntity, ""},
+        {"update that is not JSON", "POST", "/updates?userId=1001", `ModelID=m1`, http.StatusUnprocessableEntity, ""},
+        {"approval", "POST", "/approvals?userId=1002", `{"UpdateID":"u1","ApproveResult":"APPROVED"}`, http.StatusOK, fnApproveBIMUpdate},
+        {"rejection without reason", "POST", "/approvals?userId=1002", `{"UpdateID":"u1","ApproveResult":"REJECTED","Comment":"clash"}`, http.StatusUnprocessableEntity, ""},
+        {"comment", "POST", "/comments?userId=1002", `{"UpdateID":"u1","Text":"see grid C"}`, http.StatusCreated, fnAddComment},
+        {"empty comment", "POST", "/comments?userId=1002", `{"UpdateID":"u1","Text":""}`, http.StatusUnprocessableEntity, ""},
+        {"GET on a write route", "GET", "/updates?userId=1001", ``, http.StatusMethodNotAllowed, ""},
+        {"unknown user", "POST", "/updates?userId=9999", `{"ModelID":"m1","Version":"1.0"}`, http.StatusNotFound, ""},
+        {"no user", "POST", "/updates", `{"ModelID":"m1","Version":"1.0"}`, http.StatusBadRequest, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            invoker := &recordingInvoker{result: "u1"}
+            g := NewHTTPGateway(NewRoutedSubmitter(invoker, "bim"), nil)
+            rec := httptest.NewRecorder()
+            g.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+            if rec.Code != tt.status {
+                t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+            }
+            if tt.function == "" {
+                if len(invoker.calls) > 0 {
+                    t.Fatalf("invoked %v", invoker.calls)
+                }
+                return
+            }
+            if len(invoker.calls) != 1 || invoker.calls[0] != tt.function {
+                t.Fatalf("calls = %v, want [%s]", invoker.calls, tt.function)
+            }
+        })
+    }
+}
+
+func TestHTTPGatewayValidationErrors(t *testing.T) {
+    g := NewHTTPGateway(NewRoutedSubmitter(&recordingInvoker{}, "bim"), nil)
+    rec := httptest.NewRecorder()
+    body := `{"UpdateID":"u 1","ModelID":"m1","Version":"1..0"}`
+    g.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/updates?userId=1001", strings.NewReader(body)))
+
+    var verr ValidationError
+    if err := json.Unmarshal(rec.Body.Bytes(), &verr); err != nil {
+        t.Fatalf("422 body is not a ValidationError: %v: %s", err, rec.Body.String())
+    }
+    var fields []string
+    for _, f := range verr.Fields {
+        fields = append(fields, f.Field)
+    }
+    if strings.Join(fields, ",") != "/UpdateID,/Version" {
+        t.Fatalf("fields = %v, want /UpdateID and /Version", fields)
+    }
+}
+
+func TestHTTPGatewayApprovalArgs(t *testing.T) {
+    invoker := &recordingInvoker{}
+    g := NewHTTPGateway(NewRoutedSubmitter(invoker, "bim"), nil)
+    body := `{"UpdateID":"u1","ApproveResult":"REJECTED","Comment":"clash at grid C","ReasonCode":"CLASH"}`
+    rec := httptest.NewRecorder()
+    g.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/approvals?userId=1002", strings.NewReader(body)))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+    }
+
+    want := []string{"u1", "REJECTED", "clash at grid C", "CLASH"}
+    var got []string
+    for _, a := range invoker.args[0] {
+        got = append(got, string(a))
+    }
+    if strings.Join(got, "|") != strings.Join(want, "|") {
+        t.Fatalf("args = %q, want %q", got, want)
+    }
+}
+
+func TestHTTPGatewayIdempotentUpdate(t *testing.T) {
+    invoker := &recordingInvoker{result: "u1"}
+    g := NewHTTPGateway(NewRoutedSubmitter(invoker, "bim"), nil)
+    h := g.Handler()
+    send := func() *httptest.ResponseRecorder {
+        req := httptest.NewRequest("POST", "/updates?userId=1001", strings.NewReader(`{"ModelID":"m1","Version":"1.0"}`))
+        req.Header.Set(IdempotencyKeyHeader, "req-1")
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, req)
+        return rec
+    }
+
+    first, retry := send(), send()
+    if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Header().Get(IdempotencyReplayHeader) != "true" {
+        t.Fatalf("statuses %d / %d, replayed %q", first.Code, retry.Code, retry.Header().Get(IdempotencyReplayHeader))
+    }
+    if len(invoker.calls) != 1 {
+        t.Fatalf("invoked %d times, want once", len(invoker.calls))
+    }
+    var update map[string]string
+    if err := json.Unmarshal(invoker.args[0][0], &update); err != nil {
+        t.Fatal(err)
+    }
+    if id := update["ClientRequestID"]; id == "" || id == "req-1" {
+        t.Fatalf("ClientRequestID = %q, want one derived from the caller and the key", id)
+    }
+}
+
+// committingInvoker 在 recordingInvoker 之上实现 CommitInvoker，提交时更新 ledger 中的状态
+type committingInvoker struct {
+    recordingInvoker
+    ledger *statusLedger
+}
+
+func (i *committingInvoker) InvokeCommitted(ctx context.Context, node *NodeMapping, chaincode string, function string, args ...[]byte) ([]byte, uint64, error) {
+    result, err := i.Invoke(ctx, node, chaincode, function, args...)
+    i.ledger.status = string(args[1])
+    return result, 7, err
+}
+
+// statusLedger 只有一个更新 u1 的账本，记录查询次数与最近一次查询的身份
+type statusLedger struct {
+    status   string
+    queries  int
+    identity string
+}
+
+func (l *statusLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    l.queries++
+    l.identity = InvokeIdentity(ctx)
+    return json.Marshal(map[string]interface{}{"InitRecord": map[string]string{"UpdateID": updateID, "ModelID": "m1", "Status": l.status}})
+}
+
+func (l *statusLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    return []byte(`{"Records":[]}`), nil
+}
+
+func TestHTTPGatewayReadYourWrites(t *testing.T) {
+    ledger := &statusLedger{status: "INITIALIZED"}
+    submitter := NewRoutedSubmitter(&committingInvoker{ledger: ledger}, "bim")
+    submitter.WaitForCommit = true
+    h := NewHTTPGateway(submitter, NewCachedLedger(ledger, NewMemoryCacheStore(16))).Handler()
+    get := func() string {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest("GET", "/updates/u1", nil))
+        return rec.Body.String()
+    }
+
+    if body := get(); !strings.Contains(body, "INITIALIZED") {
+        t.Fatalf("GET before approval: %s", body)
+    }
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("POST", "/approvals?userId=1002", strings.NewReader(`{"UpdateID":"u1","ApproveResult":"APPROVED"}`)))
+    if rec.Code != http.StatusOK {
+        t.Fatalf("approval status = %d: %s", rec.Code, rec.Body.String())
+    }
+    // 缓存在响应前已失效，不必等链码事件
+    if body := get(); !strings.Contains(body, "APPROVED") || ledger.queries != 2 {
+        t.Fatalf("GET after committed approval: %s (%d ledger queries)", body, ledger.queries)
+    }
+}
+
+func TestHTTPGatewayWaitForCommitNeedsCommitInvoker(t *testing.T) {
+    invoker := &recordingInvoker{result: "u1"}
+    submitter := NewRoutedSubmitter(invoker, "bim")
+    submitter.WaitForCommit = true
+    rec := httptest.NewRecorder()
+    NewHTTPGateway(submitter, nil).Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/updates?userId=1001", strings.NewReader(`{"ModelID":"m1","Version":"1.0"}`)))
+    if rec.Code == http.StatusCreated || len(invoker.calls) > 0 {
+        t.Fatalf("status %d with %d calls; want a failure before invoking", rec.Code, len(invoker.calls))
+    }
+}
+
+func TestHTTPGatewaySignsAsOperator(t *testing.T) {
+    invoker := &recordingInvoker{result: "u1"}
+    ledger := &statusLedger{status: "INITIALIZED"}
+    h := NewHTTPGateway(NewRoutedSubmitter(invoker, "bim"), ledger).Handler()
+    send := func(method, path, body string) {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+        if rec.Code >= 300 {
+            t.Fatalf("%s %s: status %d: %s", method, path, rec.Code, rec.Body.String())
+        }
+    }
+
+    // 建模人员提交、专业审核人员审批，各自以本人身份签名
+    send("POST", "/updates?userId=1001", `{"ModelID":"m1","Version":"1.0"}`)
+    send("POST", "/approvals?userId=1002", `{"UpdateID":"u1","ApproveResult":"APPROVED"}`)
+    send("POST", "/approvals?userId=1003", `{"UpdateID":"u1","ApproveResult":"APPROVED"}`)
+    if got := strings.Join(invoker.identities, ","); got != "1001,1002,1003" {
+        t.Fatalf("signing identities = %s, want 1001,1002,1003", got)
+    }
+    send("GET", "/updates/u1?userId=2001", "")
+    if ledger.identity != "2001" {
+        t.Fatalf("query identity = %q, want 2001", ledger.identity)
+    }
+}
+
+// blockingLedger 查询阻塞到 release 关闭，模拟饱和的 Peer
+type blockingLedger struct {
+    entered chan struct{}
+    release chan struct{}
+}
+
+func (l *blockingLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    l.entered <- struct{}{}
+    <-l.release
+    return []byte(`{}`), nil
+}
+
+func (l *blockingLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    return []byte(`{"Records":[]}`), nil
+}
+
+func TestHTTPGatewayShedsLoadWithRetryAfter(t *testing.T) {
+    ledger := &blockingLedger{entered: make(chan struct{}, 1), release: make(chan struct{})}
+    g := NewHTTPGateway(nil, ledger)
+    g.MaxInFlight = 1
+    g.RetryAfter = 1500 * time.Millisecond
+    h := g.Handler()
+    get := func(path string) *httptest.ResponseRecorder {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+        return rec
+    }
+
+    first := make(chan int)
+    go func() { first <- get("/updates/u1").Code }()
+    <-ledger.entered
+
+    rec := get("/updates/u2")
+    if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+        t.Fatalf("request over the limit: status %d, Retry-After %q; want 503 and 2", rec.Code, rec.Header().Get("Retry-After"))
+    }
+    var load GatewayLoad
+    if err := json.Unmarshal(get("/health").Body.Bytes(), &load); err != nil {
+        t.Fatal(err)
+    }
+    if load.InFlight != 1 || load.MaxInFlight != 1 || !load.Saturated {
+        t.Fatalf("health while saturated = %+v", load)
+    }
+
+    close(ledger.release)
+    if code := <-first; code != http.StatusOK {
+        t.Fatalf("first request status = %d", code)
+    }
+    if rec := get("/updates/u2"); rec.Code != http.StatusOK {
+        t.Fatalf("request after the load dropped: status %d", rec.Code)
+    }
+}
@@ -0,0 +1,423 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  网关幂等键（Idempotency-Key）
+// -------------------------------
+
+// 客户端对写请求带上 Idempotency-Key 头后，IdempotencyGuard 保存请求指纹与首次的响应，
+// 有效期内（默认 24 小时）同一调用方同一键的重试直接返回原响应，不再调用链码。
+// 键按调用方（IdempotencyGuard.Scope）隔离，不同调用方使用同名键互不影响。
+//
+// 网关只保存完成的响应：处理中崩溃、响应为 5xx 时不保存，重试会再次调用链码。为保证这种情况下
+// 也不会产生第二个更新，处理函数应把 ClientRequestIDFrom 返回的 ID 作为 ClientRequestID 提交，
+// 链码对同一发起人的同一 ClientRequestID 只创建一次更新并返回首次的 UpdateID。
+
+const (
+    IdempotencyKeyHeader     = "Idempotency-Key"
+    IdempotencyReplayHeader  = "Idempotent-Replayed" // 重放的响应带上 true
+    DefaultIdempotencyTTL    = 24 * time.Hour
+    maxIdempotencyKeyLength  = 128
+    idempotencyRetryAfterSec = "1"
+
+    // idempotencyPruneInterval 本地存储清理过期记录的最短间隔
+    idempotencyPruneInterval = time.Minute
+    // idempotencyCompactMin 日志行数超过存活记录数的两倍且不少于该值时重写日志
+    idempotencyCompactMin = 1024
+)
+
+// idempotencyKeyPattern 与链码 ClientRequestID 的 id 规则一致
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// IdempotencyRecord 一个幂等键对应的请求指纹与响应；Done 为假表示首个请求仍在处理
+type IdempotencyRecord struct {
+    Fingerprint string              `json:"fingerprint"`
+    Done        bool                `json:"done"`
+    Status      int                 `json:"status,omitempty"`
+    Header      map[string][]string `json:"header,omitempty"`
+    Body        []byte              `json:"body,omitempty"`
+    CreatedAt   time.Time           `json:"createdAt"`
+    // ExpiresAt 过期时间，之后同一键视为新请求
+    ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// IdempotencyStore 幂等记录存储
+type IdempotencyStore interface {
+    // Begin 键不存在或已过期时登记处理中的 rec 并返回 nil；否则不改动，返回已有记录
+    Begin(key string, rec *IdempotencyRecord) (*IdempotencyRecord, error)
+    // Complete 保存键的响应
+    Complete(key string, rec *IdempotencyRecord) error
+    // Abort 删除处理中的键，之后同一键的请求重新处理
+    Abort(key string) error
+}
+
+// LocalIdempotencyStore 本地幂等记录存储。Path 非空时完成的记录逐条追加到 JSON Lines 日志，
+// 重启后仍能重放；处理中的记录只在内存中，重启后没有响应可重放。
+// 过期记录在读写时按间隔清理，日志中失效的行超过一半时整体重写一次。
+type LocalIdempotencyStore struct {
+    Path string
+
+    // Now 当前时间，默认 time.Now
+    Now func() time.Time
+
+    mu           sync.Mutex
+    loaded       bool
+    records      map[string]*IdempotencyRecord
+    journalLines int
+    prunedAt     time.Time
+}
+
+// idempotencyJournalEntry 日志中的一行
+type idempotencyJournalEntry struct {
+    Key    string             `json:"key"`
+    Record *IdempotencyRecord `json:"record"`
+}
+
+// Begin 实现 IdempotencyStore
+func (s *LocalIdempotencyStore) Begin(key string, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := s.now()
+    if err := s.load(now); err != nil {
+        return nil, err
+    }
+    s.prune(now)
+    if existing, ok := s.records[key]; ok && now.Before(existing.ExpiresAt) {
+        c := *existing
+        return &c, nil
+    }
+    c := *rec
+    s.records[key] = &c
+    return nil, nil
+}
+
+// Complete 实现 IdempotencyStore
+func (s *LocalIdempotencyStore) Complete(key string, rec *IdempotencyRecord) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := s.now()
+    if err := s.load(now); err != nil {
+        return err
+    }
+    c := *rec
+    s.records[key] = &c
+    if err := s.appendJournal(key, &c); err != nil {
+        return err
+    }
+    s.prune(now)
+    return s.compact()
+}
+
+// Abort 实现 IdempotencyStore；处理中的记录没有写入日志，只需从内存删除
+func (s *LocalIdempotencyStore) Abort(key string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.load(s.now()); err != nil {
+        return err
+    }
+    if r, ok := s.records[key]; ok && !r.Done {
+        delete(s.records, key)
+    }
+    return nil
+}
+
+func (s *LocalIdempotencyStore) now() time.Time {
+    if s.Now != nil {
+        return s.Now()
+    }
+    return time.Now()
+}
+
+// load 首次使用时回放日志，后出现的行覆盖同一键的前一行，跳过已过期的记录
+func (s *LocalIdempotencyStore) load(now time.Time) error {
+    if s.loaded {
+        return nil
+    }
+    s.loaded = true
+    s.records = map[string]*IdempotencyRecord{}
+    s.prunedAt = now
+    if s.Path == "" {
+        return nil
+    }
+    f, err := os.Open(s.Path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("读取幂等记录失败: %v", err)
+    }
+    defer f.Close()
+    dec := json.NewDecoder(f)
+    for {
+        var entry idempotencyJournalEntry
+        err := dec.Decode(&entry)
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            // 写入中断留下的不完整末行，之前的记录仍然有效
+            Logger().Warn("幂等记录日志末尾不完整，已忽略", "path", s.Path, "err", err)
+            break
+        }
+        s.journalLines++
+        if entry.Key == "" || entry.Record == nil || !entry.Record.Done {
+            continue
+        }
+        if now.Before(entry.Record.ExpiresAt) {
+            s.records[entry.Key] = entry.Record
+        } else {
+            delete(s.records, entry.Key)
+        }
+    }
+    return nil
+}
+
+// prune 距上次清理超过 idempotencyPruneInterval 时删除过期的记录
+func (s *LocalIdempotencyStore) prune(now time.Time) {
+    if now.Sub(s.prunedAt) < idempotencyPruneInterval {
+        return
+    }
+    s.prunedAt = now
+    for k, r := range s.records {
+        if !now.Before(r.ExpiresAt) {
+            delete(s.records, k)
+        }
+    }
+}
+
+// appendJournal 向日志追加一行
+func (s *LocalIdempotencyStore) appendJournal(key string, rec *IdempotencyRecord) error {
+    if s.Path == "" {
+        return nil
+    }
+    line, err := json.Marshal(idempotencyJournalEntry{Key: key, Record: rec})
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+    if err != nil {
+        return err
+    }
+    _, err = f.Write(append(line, '\n'))
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err != nil {
+        return err
+    }
+    s.journalLines++
+    return nil
+}
+
+// compact 日志中失效的行（被覆盖或已过期）超过一半时，只写入完成的存活记录并替换日志
+func (s *LocalIdempotencyStore) compact() error {
+    if s.Path == "" || s.journalLines < idempotencyCompactMin || s.journalLines <= 2*len(s.records) {
+        return nil
+    }
+    var buf bytes.Buffer
+    lines := 0
+    for k, r := range s.records {
+        if !r.Done {
+            continue
+        }
+        line, err := json.Marshal(idempotencyJournalEntry{Key: k, Record: r})
+        if err != nil {
+            return err
+        }
+        buf.Write(line)
+        buf.WriteByte('\n')
+        lines++
+    }
+    tmp := s.Path + ".tmp"
+    if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+        return err
+    }
+    if err := os.Rename(tmp, s.Path); err != nil {
+        return err
+    }
+    s.journalLines = lines
+    return nil
+}
+
+// IdempotencyGuard 按 Idempotency-Key 重放写请求的 HTTP 中间件
+type IdempotencyGuard struct {
+    Store IdempotencyStore
+    TTL   time.Duration // 记录有效期，默认 DefaultIdempotencyTTL
+    // Scope 返回调用方标识（如认证得到的用户 ID），键只在同一调用方内有效。必须设置：
+    // 为空时 Handler 拒绝构造；返回 "" 的请求若带键则被拒绝，不会落入共用的键空间
+    Scope func(r *http.Request) string
+    // MaxBytes 请求体上限，<= 0 时为 DefaultMaxRequestBytes
+    MaxBytes int64
+}
+
+// NewIdempotencyGuard 创建使用 store、按 scope 隔离调用方的幂等中间件，有效期 24 小时
+func NewIdempotencyGuard(store IdempotencyStore, scope func(r *http.Request) string) *IdempotencyGuard {
+    return &IdempotencyGuard{Store: store, TTL: DefaultIdempotencyTTL, Scope: scope}
+}
+
+type idempotencyKeyContext struct{}
+
+// ClientRequestIDFrom 返回处理函数应作为 ClientRequestID 提交的 ID；请求没有带键时返回 ""。
+// ID 由调用方与 Idempotency-Key 派生：网关以同一身份提交所有调用方的交易，
+// 直接使用键会让不同调用方的同名键在链码中被当作同一请求。
+func ClientRequestIDFrom(ctx context.Context) string {
+    id, _ := ctx.Value(idempotencyKeyContext{}).(string)
+    return id
+}
+
+// Handler 包装 next：不带 Idempotency-Key 的请求与 GET / HEAD / OPTIONS 请求直接交给 next；
+// 同一键的重试若请求体与方法、路径都相同则重放首次的响应，不同时返回 422，首个请求仍在处理时返回 409。
+// 未设置 Scope 时 panic。
+func (g *IdempotencyGuard) Handler(next http.Handler) http.Handler {
+    if g.Scope == nil {
+        panic("IdempotencyGuard.Scope 未设置") // 共用键空间会把一个调用方的响应重放给另一个调用方
+    }
+    ttl := g.TTL
+    if ttl <= 0 {
+        ttl = DefaultIdempotencyTTL
+    }
+    maxBytes := g.MaxBytes
+    if maxBytes <= 0 {
+        maxBytes = DefaultMaxRequestBytes
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        key := r.Header.Get(IdempotencyKeyHeader)
+        if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+            next.ServeHTTP(w, r)
+            return
+        }
+        if len(key) > maxIdempotencyKeyLength || !idempotencyKeyPattern.MatchString(key) {
+            http.Error(w, fmt.Sprintf("%s 只能包含字母、数字与 . _ : -，最长 %d 个字符", IdempotencyKeyHeader, maxIdempotencyKeyLength), http.StatusBadRequest)
+            return
+        }
+        scope := g.Scope(r)
+        if scope == "" {
+            http.Error(w, "无法确定调用方，不能使用 "+IdempotencyKeyHeader, http.StatusUnauthorized)
+            return
+        }
+        body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+        r.Body.Close()
+        if err != nil {
+            http.Error(w, "读取请求体失败", http.StatusBadRequest)
+            return
+        }
+        if int64(len(body)) > maxBytes {
+            http.Error(w, fmt.Sprintf("请求体超过 %d 字节", maxBytes), http.StatusRequestEntityTooLarge)
+            return
+        }
+
+        storeKey := scope + "\x00" + key
+        log := Logger().With("idempotencyKey", key, "path", r.URL.Path)
+        fingerprint := requestFingerprint(r, body)
+        now := time.Now()
+        existing, err := g.Store.Begin(storeKey, &IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(ttl)})
+        if err != nil {
+            log.Error("读取幂等记录失败", "err", err)
+            http.Error(w, "幂等记录不可用", http.StatusServiceUnavailable)
+            return
+        }
+        switch {
+        case existing != nil && existing.Fingerprint != fingerprint:
+            http.Error(w, IdempotencyKeyHeader+" 已用于另一个请求", http.StatusUnprocessableEntity)
+            return
+        case existing != nil && !existing.Done:
+            w.Header().Set("Retry-After", idempotencyRetryAfterSec)
+            http.Error(w, "相同 "+IdempotencyKeyHeader+" 的请求仍在处理", http.StatusConflict)
+            return
+        case existing != nil:
+            log.Info("重放幂等请求的响应", "status", existing.Status)
+            for name, values := range existing.Header {
+                w.Header()[name] = values
+            }
+            w.Header().Set(IdempotencyReplayHeader, "true")
+            w.WriteHeader(existing.Status)
+            w.Write(existing.Body)
+            return
+        }
+
+        rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+        completed := false
+        defer func() {
+            if !completed {
+                g.Store.Abort(storeKey)
+            }
+        }()
+        r.Body = io.NopCloser(bytes.NewReader(body))
+        r.ContentLength = int64(len(body))
+        next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), idempotencyKeyContext{}, clientRequestID(storeKey))))
+
+        if rec.status >= 500 {
+            return // 不保存，重试时再次处理，由链码的 ClientRequestID 去重
+        }
+        done := time.Now()
+        err = g.Store.Complete(storeKey, &IdempotencyRecord{
+            Fingerprint: fingerprint,
+            Done:        true,
+            Status:      rec.status,
+            Header:      w.Header().Clone(),
+            Body:        rec.body.Bytes(),
+            CreatedAt:   done,
+            ExpiresAt:   done.Add(ttl),
+        })
+        if err != nil {
+            log.Error("保存幂等记录失败", "err", err)
+            return
+        }
+        completed = true
+    })
+}
+
+// clientRequestID 由调用方与键派生的 ClientRequestID，符合链码 id 规则
+func clientRequestID(storeKey string) string {
+    sum := sha256.Sum256([]byte(storeKey))
+    return "idem-" + hex.EncodeToString(sum[:16])
+}
+
+// requestFingerprint 方法、路径与请求体的 SHA-256
+func requestFingerprint(r *http.Request, body []byte) string {
+    h := sha256.New()
+    fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.RequestURI())
+    h.Write(body)
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder 转发响应的同时记下状态码与正文
+type responseRecorder struct {
+    http.ResponseWriter
+    status      int
+    wroteHeader bool
+    body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+    if !r.wroteHeader {
+        r.status = status
+        r.wroteHeader = true
+    }
+    r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+    r.wroteHeader = true
+    r.body.Write(p)
+    return r.ResponseWriter.Write(p)
+}
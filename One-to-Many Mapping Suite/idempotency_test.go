@@ -0,0 +1,143 @@
+package mapping
+
+import (
+    "bufio"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestIdempotencyGuardScopesKeys(t *testing.T) {
+    calls := 0
+    next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        fmt.Fprintf(w, "%d %s", calls, ClientRequestIDFrom(r.Context()))
+    })
+    h := NewIdempotencyGuard(&LocalIdempotencyStore{}, func(r *http.Request) string { return r.URL.Query().Get("userId") }).Handler(next)
+    send := func(user string, key string, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest("POST", "/updates?userId="+user, strings.NewReader(body))
+        req.Header.Set(IdempotencyKeyHeader, key)
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, req)
+        return rec
+    }
+
+    first := send("1001", "k1", "a")
+    replay := send("1001", "k1", "a")
+    if calls != 1 || replay.Body.String() != first.Body.String() || replay.Header().Get(IdempotencyReplayHeader) != "true" {
+        t.Fatalf("retry was not replayed: calls=%d, %q vs %q", calls, first.Body.String(), replay.Body.String())
+    }
+    if rec := send("1001", "k1", "b"); rec.Code != http.StatusUnprocessableEntity {
+        t.Fatalf("reused key with another body: status %d, want 422", rec.Code)
+    }
+
+    // 另一调用方的同名键是新请求，派生的 ClientRequestID 也不同
+    other := send("1002", "k1", "a")
+    if calls != 2 || other.Header().Get(IdempotencyReplayHeader) != "" {
+        t.Fatalf("key of another caller was replayed: calls=%d", calls)
+    }
+    idOf := func(rec *httptest.ResponseRecorder) string { return strings.Fields(rec.Body.String())[1] }
+    if idOf(first) == idOf(other) || !idempotencyKeyPattern.MatchString(idOf(first)) {
+        t.Fatalf("ClientRequestIDs %q and %q", idOf(first), idOf(other))
+    }
+
+    // 无法确定调用方时拒绝，而不是落入共用的键空间
+    if rec := send("", "k1", "a"); rec.Code != http.StatusUnauthorized || calls != 2 {
+        t.Fatalf("request without caller: status %d, calls %d", rec.Code, calls)
+    }
+}
+
+func TestIdempotencyGuardRequiresScope(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Fatal("Handler accepted a guard without Scope")
+        }
+    }()
+    (&IdempotencyGuard{Store: &LocalIdempotencyStore{}}).Handler(http.NotFoundHandler())
+}
+
+func TestLocalIdempotencyStoreJournal(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+    now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+    clock := func() time.Time { return now }
+    done := func(body string) *IdempotencyRecord {
+        return &IdempotencyRecord{Fingerprint: "f", Done: true, Status: 200, Body: []byte(body), CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+    }
+
+    s := &LocalIdempotencyStore{Path: path, Now: clock}
+    if _, err := s.Begin("a", &IdempotencyRecord{Fingerprint: "f", ExpiresAt: now.Add(time.Hour)}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(path); !os.IsNotExist(err) {
+        t.Fatalf("Begin wrote the journal: %v", err)
+    }
+    for _, key := range []string{"a", "b"} {
+        if err := s.Complete(key, done(key)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := s.Complete("a", done("a2")); err != nil {
+        t.Fatal(err)
+    }
+    if n := journalLines(t, path); n != 3 {
+        t.Fatalf("journal has %d lines, want one per Complete (3)", n)
+    }
+
+    // 重启后回放：后写的行覆盖前一行
+    s = &LocalIdempotencyStore{Path: path, Now: clock}
+    got, err := s.Begin("a", &IdempotencyRecord{Fingerprint: "f", ExpiresAt: now.Add(time.Hour)})
+    if err != nil || got == nil || string(got.Body) != "a2" {
+        t.Fatalf("after restart a = %+v, %v; want the last response a2", got, err)
+    }
+
+    // 过期后重启：记录不再回放
+    now = now.Add(2 * time.Hour)
+    s = &LocalIdempotencyStore{Path: path, Now: clock}
+    if got, err := s.Begin("b", &IdempotencyRecord{Fingerprint: "f", ExpiresAt: now.Add(time.Hour)}); err != nil || got != nil {
+        t.Fatalf("expired b = %+v, %v; want a new request", got, err)
+    }
+}
+
+func TestLocalIdempotencyStorePrunesAndCompacts(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+    now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+    s := &LocalIdempotencyStore{Path: path, Now: func() time.Time { return now }}
+    complete := func(key string) {
+        t.Helper()
+        rec := &IdempotencyRecord{Fingerprint: "f", Done: true, Status: 200, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+        if err := s.Complete(key, rec); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    for i := 0; i < idempotencyCompactMin; i++ {
+        complete(fmt.Sprintf("old-%d", i))
+    }
+    // 全部过期后，下一次 Complete 清理内存中的记录并重写日志
+    now = now.Add(2 * time.Hour)
+    complete("new")
+    if len(s.records) != 1 {
+        t.Fatalf("%d records after expiry, want 1", len(s.records))
+    }
+    if n := journalLines(t, path); n != 1 {
+        t.Fatalf("journal has %d lines after compaction, want 1", n)
+    }
+}
+
+func journalLines(t *testing.T, path string) int {
+    t.Helper()
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    n := 0
+    for sc := bufio.NewScanner(f); sc.Scan(); n++ {
+    }
+    return n
+}
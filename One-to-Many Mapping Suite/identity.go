@@ -0,0 +1,635 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/ThalesIgnite/crypto11"
+)
+
+// -------------------------------
+//  身份与钱包（Fabric CA / 文件钱包 / PKCS#11 HSM）
+// -------------------------------
+
+// SigningIdentity 带签名能力的 X.509 身份，实现 crypto.Signer，
+// 可直接用于 SignTransaction、BuildSubmissionBundle 等
+type SigningIdentity struct {
+    Label       string
+    MSPID       string
+    Certificate *x509.Certificate
+    CertPEM     []byte
+    Signer      crypto.Signer
+}
+
+// Public 返回证书公钥
+func (id *SigningIdentity) Public() crypto.PublicKey {
+    return id.Signer.Public()
+}
+
+// Sign 使用身份私钥签名
+func (id *SigningIdentity) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+    return id.Signer.Sign(r, digest, opts)
+}
+
+// ExpiresWithin 证书是否将在 d 内过期
+func (id *SigningIdentity) ExpiresWithin(d time.Duration) bool {
+    return id.Certificate == nil || time.Now().Add(d).After(id.Certificate.NotAfter)
+}
+
+// IdentityProvider 身份来源
+type IdentityProvider interface {
+    Identity(label string) (*SigningIdentity, error)
+}
+
+// -------------------------------
+//  文件钱包（与 Fabric SDK 的 <dir>/<label>.id 格式兼容）
+// -------------------------------
+
+// FileWallet 文件钱包
+type FileWallet struct {
+    Dir string
+}
+
+type walletEntry struct {
+    Credentials struct {
+        Certificate string `json:"certificate"`
+        PrivateKey  string `json:"privateKey"`
+    } `json:"credentials"`
+    MSPID   string `json:"mspId"`
+    Type    string `json:"type"`
+    Version int    `json:"version"`
+}
+
+// Identity 读取钱包中的身份
+func (w *FileWallet) Identity(label string) (*SigningIdentity, error) {
+    if strings.ContainsAny(label, "/\\") || label == "" {
+        return nil, fmt.Errorf("身份标签 %q 无效", label)
+    }
+    data, err := os.ReadFile(filepath.Join(w.Dir, label+".id"))
+    if err != nil {
+        return nil, fmt.Errorf("读取钱包身份 %s 失败: %v", label, err)
+    }
+    var entry walletEntry
+    if err := json.Unmarshal(data, &entry); err != nil {
+        return nil, fmt.Errorf("解析钱包身份 %s 失败: %v", label, err)
+    }
+    if entry.Type != "X.509" {
+        return nil, fmt.Errorf("钱包身份 %s 类型 %s 不受支持", label, entry.Type)
+    }
+    cert, err := parseCertPEM([]byte(entry.Credentials.Certificate))
+    if err != nil {
+        return nil, fmt.Errorf("钱包身份 %s: %v", label, err)
+    }
+    key, err := parseKeyPEM([]byte(entry.Credentials.PrivateKey))
+    if err != nil {
+        return nil, fmt.Errorf("钱包身份 %s: %v", label, err)
+    }
+    return &SigningIdentity{
+        Label:       label,
+        MSPID:       entry.MSPID,
+        Certificate: cert,
+        CertPEM:     []byte(entry.Credentials.Certificate),
+        Signer:      key,
+    }, nil
+}
+
+// Put 写入身份；只支持可导出的软件私钥（HSM 中的密钥不能写入钱包）
+func (w *FileWallet) Put(label string, id *SigningIdentity) error {
+    if strings.ContainsAny(label, "/\\") || label == "" {
+        return fmt.Errorf("身份标签 %q 无效", label)
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(id.Signer)
+    if err != nil {
+        return fmt.Errorf("私钥无法导出到钱包: %v", err)
+    }
+    var entry walletEntry
+    entry.Credentials.Certificate = string(id.CertPEM)
+    entry.Credentials.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+    entry.MSPID = id.MSPID
+    entry.Type = "X.509"
+    entry.Version = 1
+
+    data, err := json.Marshal(entry)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(w.Dir, 0o700); err != nil {
+        return err
+    }
+    return os.WriteFile(filepath.Join(w.Dir, label+".id"), data, 0o600)
+}
+
+// List 列出钱包中的身份标签
+func (w *FileWallet) List() ([]string, error) {
+    files, err := filepath.Glob(filepath.Join(w.Dir, "*.id"))
+    if err != nil {
+        return nil, err
+    }
+    labels := make([]string, 0, len(files))
+    for _, f := range files {
+        labels = append(labels, strings.TrimSuffix(filepath.Base(f), ".id"))
+    }
+    sort.Strings(labels)
+    return labels, nil
+}
+
+// -------------------------------
+//  Fabric CA 登记
+// -------------------------------
+
+// FabricCAClient Fabric CA REST 客户端
+type FabricCAClient struct {
+    URL    string // https://ca.org1.example.com:7054
+    CAName string
+    MSPID  string
+    Client *http.Client // 需要时配置 CA 的 TLS 根证书
+}
+
+// caResponse Fabric CA 的统一响应结构
+type caResponse struct {
+    Success bool            `json:"success"`
+    Result  json.RawMessage `json:"result"`
+    Errors  []struct {
+        Code    int    `json:"code"`
+        Message string `json:"message"`
+    } `json:"errors"`
+}
+
+// Enroll 使用登记 ID 与密码生成新密钥并签发证书；attrs 为希望写入证书的属性（如 role、department）
+func (c *FabricCAClient) Enroll(ctx context.Context, enrollID, secret string, attrs ...string) (*SigningIdentity, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+        Subject: pkix.Name{CommonName: enrollID},
+    }, key)
+    if err != nil {
+        return nil, fmt.Errorf("生成 CSR 失败: %v", err)
+    }
+
+    type attrReq struct {
+        Name     string `json:"name"`
+        Optional bool   `json:"optional"`
+    }
+    reqs := make([]attrReq, 0, len(attrs))
+    for _, a := range attrs {
+        reqs = append(reqs, attrReq{Name: a, Optional: true})
+    }
+    body, err := json.Marshal(map[string]interface{}{
+        "certificate_request": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+        "caname":              c.CAName,
+        "attr_reqs":           reqs,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+"/api/v1/enroll", bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    req.SetBasicAuth(enrollID, secret)
+    req.Header.Set("Content-Type", "application/json")
+
+    var result struct {
+        Cert string `json:"Cert"`
+    }
+    if err := c.do(req, &result); err != nil {
+        return nil, fmt.Errorf("登记 %s 失败: %v", enrollID, err)
+    }
+    certPEM, err := base64.StdEncoding.DecodeString(result.Cert)
+    if err != nil {
+        return nil, fmt.Errorf("CA 返回的证书格式错误: %v", err)
+    }
+    cert, err := parseCertPEM(certPEM)
+    if err != nil {
+        return nil, err
+    }
+    return &SigningIdentity{Label: enrollID, MSPID: c.MSPID, Certificate: cert, CertPEM: certPEM, Signer: key}, nil
+}
+
+// do 发送请求并解析 Fabric CA 响应的 result 字段
+func (c *FabricCAClient) do(req *http.Request, result interface{}) error {
+    resp, err := httpClient(c.Client).Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    var cr caResponse
+    if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+        return fmt.Errorf("CA 返回 %s，响应无法解析: %v", resp.Status, err)
+    }
+    if !cr.Success {
+        msgs := make([]string, 0, len(cr.Errors))
+        for _, e := range cr.Errors {
+            msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+        }
+        return fmt.Errorf("CA 错误: %s", strings.Join(msgs, "; "))
+    }
+    if result == nil {
+        return nil
+    }
+    return json.Unmarshal(cr.Result, result)
+}
+
+// ChaincodeRoles 链码 authorizeCallerRole 认可的 role 属性取值
+var ChaincodeRoles = []string{"modeler", "professional", "bim_lead", "auditor", "surveyor"}
+
+// CARegistration Fabric CA 注册请求
+type CARegistration struct {
+    EnrollID    string
+    Secret      string // 为空时由 CA 生成
+    Type        string // 默认 client
+    Affiliation string
+    Role        string // 写入证书的 role 属性，见 ChaincodeRoles
+    Department  string // 写入证书的 department 属性（审批策略按部门统计）
+}
+
+// Register 以 registrar 身份在 CA 注册用户，role/department 属性设置为 ecert 属性
+// （登记后自动写入证书）；返回登记密码
+func (c *FabricCAClient) Register(ctx context.Context, registrar *SigningIdentity, reg *CARegistration) (string, error) {
+    if reg.EnrollID == "" {
+        return "", errors.New("EnrollID 不能为空")
+    }
+    if !containsString(ChaincodeRoles, reg.Role) {
+        return "", fmt.Errorf("role %q 无效，应为 %s", reg.Role, strings.Join(ChaincodeRoles, "/"))
+    }
+    typ := reg.Type
+    if typ == "" {
+        typ = "client"
+    }
+    type attr struct {
+        Name  string `json:"name"`
+        Value string `json:"value"`
+        ECert bool   `json:"ecert"`
+    }
+    attrs := []attr{{Name: "role", Value: reg.Role, ECert: true}}
+    if reg.Department != "" {
+        attrs = append(attrs, attr{Name: "department", Value: reg.Department, ECert: true})
+    }
+    body, err := json.Marshal(map[string]interface{}{
+        "id":              reg.EnrollID,
+        "type":            typ,
+        "secret":          reg.Secret,
+        "affiliation":     reg.Affiliation,
+        "max_enrollments": -1,
+        "attrs":           attrs,
+        "caname":          c.CAName,
+    })
+    if err != nil {
+        return "", err
+    }
+
+    const uri = "/api/v1/register"
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+uri, bytes.NewReader(body))
+    if err != nil {
+        return "", err
+    }
+    token, err := caAuthToken(registrar, http.MethodPost, uri, body)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Authorization", token)
+    req.Header.Set("Content-Type", "application/json")
+
+    var result struct {
+        Secret string `json:"secret"`
+    }
+    if err := c.do(req, &result); err != nil {
+        return "", fmt.Errorf("注册 %s 失败: %v", reg.EnrollID, err)
+    }
+    return result.Secret, nil
+}
+
+// OnboardUser 注册用户、登记证书并写入钱包，返回新身份
+func OnboardUser(ctx context.Context, ca *FabricCAClient, registrar *SigningIdentity, wallet *FileWallet, reg *CARegistration) (*SigningIdentity, error) {
+    secret, err := ca.Register(ctx, registrar, reg)
+    if err != nil {
+        return nil, err
+    }
+    id, err := ca.Enroll(ctx, reg.EnrollID, secret, "role", "department")
+    if err != nil {
+        return nil, err
+    }
+    if err := wallet.Put(reg.EnrollID, id); err != nil {
+        return nil, err
+    }
+    return id, nil
+}
+
+// caAuthToken 生成 Fabric CA 令牌：<b64 证书>.<b64 签名>，
+// 签名内容为 method.b64(uri).b64(body).b64(证书)，ECDSA 签名需为 low-S 形式
+func caAuthToken(id *SigningIdentity, method, uri string, body []byte) (string, error) {
+    b64 := base64.StdEncoding.EncodeToString
+    b64cert := b64(id.CertPEM)
+    payload := method + "." + b64([]byte(uri)) + "." + b64(body) + "." + b64cert
+    digest := sha256.Sum256([]byte(payload))
+    sig, err := id.Sign(rand.Reader, digest[:], crypto.SHA256)
+    if err != nil {
+        return "", fmt.Errorf("生成 CA 令牌失败: %v", err)
+    }
+    if pub, ok := id.Public().(*ecdsa.PublicKey); ok {
+        if sig, err = lowS(pub, sig); err != nil {
+            return "", err
+        }
+    }
+    return b64cert + "." + b64(sig), nil
+}
+
+// lowS 将 ECDSA 签名的 s 规范为不大于 N/2（Fabric 拒绝 high-S 签名）
+func lowS(pub *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+    var rs struct{ R, S *big.Int }
+    if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+        return nil, fmt.Errorf("解析 ECDSA 签名失败: %v", err)
+    }
+    n := pub.Curve.Params().N
+    if rs.S.Cmp(new(big.Int).Rsh(n, 1)) <= 0 {
+        return sig, nil
+    }
+    rs.S.Sub(n, rs.S)
+    return asn1.Marshal(rs)
+}
+
+func containsString(list []string, v string) bool {
+    for _, s := range list {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
+
+// CAIdentityProvider 通过 Fabric CA 登记获取身份；设置 Wallet 时登记结果写入钱包，
+// 证书未临近过期前直接复用钱包中的身份
+type CAIdentityProvider struct {
+    CA          *FabricCAClient
+    Secrets     SecretSource // 以身份标签查找登记密码
+    Wallet      *FileWallet
+    Attrs       []string      // 登记时请求的证书属性
+    RenewBefore time.Duration // 证书剩余有效期低于该值时重新登记
+}
+
+// Identity 返回钱包中的有效身份，或向 CA 重新登记
+func (p *CAIdentityProvider) Identity(label string) (*SigningIdentity, error) {
+    if p.Wallet != nil {
+        if id, err := p.Wallet.Identity(label); err == nil && !id.ExpiresWithin(p.RenewBefore) {
+            return id, nil
+        }
+    }
+    secret, err := p.Secrets.Lookup(label)
+    if err != nil {
+        return nil, fmt.Errorf("查找 %s 的登记密码失败: %v", label, err)
+    }
+    id, err := p.CA.Enroll(context.Background(), label, secret, p.Attrs...)
+    if err != nil {
+        return nil, err
+    }
+    if p.Wallet != nil {
+        if err := p.Wallet.Put(label, id); err != nil {
+            return nil, err
+        }
+    }
+    return id, nil
+}
+
+// -------------------------------
+//  PKCS#11 HSM
+// -------------------------------
+
+// PKCS11IdentityProvider 从 HSM 读取签名密钥，私钥不出 HSM。
+// 证书优先从令牌读取，令牌中没有时读取 CertDir/<label>.pem
+type PKCS11IdentityProvider struct {
+    MSPID   string
+    CertDir string
+
+    ctx *crypto11.Context
+}
+
+// NewPKCS11IdentityProvider 打开 PKCS#11 令牌
+func NewPKCS11IdentityProvider(lib, tokenLabel, pin, mspID, certDir string) (*PKCS11IdentityProvider, error) {
+    ctx, err := crypto11.Configure(&crypto11.Config{Path: lib, TokenLabel: tokenLabel, Pin: pin})
+    if err != nil {
+        return nil, fmt.Errorf("打开 PKCS#11 令牌 %s 失败: %v", tokenLabel, err)
+    }
+    return &PKCS11IdentityProvider{MSPID: mspID, CertDir: certDir, ctx: ctx}, nil
+}
+
+// Identity 按密钥标签查找签名密钥与证书
+func (p *PKCS11IdentityProvider) Identity(label string) (*SigningIdentity, error) {
+    signer, err := p.ctx.FindKeyPair(nil, []byte(label))
+    if err != nil {
+        return nil, fmt.Errorf("查找 HSM 密钥 %s 失败: %v", label, err)
+    }
+    if signer == nil {
+        return nil, fmt.Errorf("HSM 中没有标签为 %s 的密钥", label)
+    }
+
+    cert, err := p.ctx.FindCertificate(nil, []byte(label), nil)
+    if err != nil {
+        return nil, fmt.Errorf("查找 HSM 证书 %s 失败: %v", label, err)
+    }
+    var certPEM []byte
+    if cert != nil {
+        certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+    } else {
+        if p.CertDir == "" {
+            return nil, fmt.Errorf("HSM 中没有 %s 的证书，且未配置证书目录", label)
+        }
+        certPEM, err = os.ReadFile(filepath.Join(p.CertDir, label+".pem"))
+        if err != nil {
+            return nil, fmt.Errorf("读取证书失败: %v", err)
+        }
+        if cert, err = parseCertPEM(certPEM); err != nil {
+            return nil, err
+        }
+    }
+    return &SigningIdentity{Label: label, MSPID: p.MSPID, Certificate: cert, CertPEM: certPEM, Signer: signer}, nil
+}
+
+// Close 关闭令牌会话
+func (p *PKCS11IdentityProvider) Close() error {
+    return p.ctx.Close()
+}
+
+// -------------------------------
+//  缓存
+// -------------------------------
+
+// CachingIdentityProvider 缓存身份，证书临近过期时重新从 Source 获取
+type CachingIdentityProvider struct {
+    Source      IdentityProvider
+    RenewBefore time.Duration
+
+    mu    sync.Mutex
+    cache map[string]*SigningIdentity
+}
+
+// NewCachingIdentityProvider 包装身份来源
+func NewCachingIdentityProvider(source IdentityProvider, renewBefore time.Duration) *CachingIdentityProvider {
+    return &CachingIdentityProvider{Source: source, RenewBefore: renewBefore, cache: map[string]*SigningIdentity{}}
+}
+
+// Identity 返回缓存中的有效身份，否则从 Source 获取
+func (c *CachingIdentityProvider) Identity(label string) (*SigningIdentity, error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if id, ok := c.cache[label]; ok && !id.ExpiresWithin(c.RenewBefore) {
+        return id, nil
+    }
+    id, err := c.Source.Identity(label)
+    if err != nil {
+        return nil, err
+    }
+    c.cache[label] = id
+    return id, nil
+}
+
+// -------------------------------
+//  按配置创建身份来源
+// -------------------------------
+
+// IdentityConfig 身份配置
+type IdentityConfig struct {
+    Source string `yaml:"source"` // wallet / ca / pkcs11，为空表示不使用
+    Label  string `yaml:"label"`  // 默认身份标签
+    MSPID  string `yaml:"mspId"`
+
+    WalletDir string `yaml:"walletDir"`
+
+    CAURL  string   `yaml:"caUrl"`
+    CAName string   `yaml:"caName"`
+    Attrs  []string `yaml:"attrs"`
+
+    PKCS11 PKCS11Config `yaml:"pkcs11"`
+
+    // RenewBefore 证书剩余有效期低于该值时重新获取，默认 24h
+    RenewBefore time.Duration `yaml:"renewBefore"`
+}
+
+// PKCS11Config HSM 配置
+type PKCS11Config struct {
+    Lib        string `yaml:"lib"`
+    TokenLabel string `yaml:"tokenLabel"`
+    // Pin 可写为 secret://<name>
+    Pin     string `yaml:"pin"`
+    CertDir string `yaml:"certDir"`
+}
+
+// NewIdentityProvider 按配置创建带缓存的身份来源；ca 来源以身份标签从 secrets 查找登记密码
+func NewIdentityProvider(cfg IdentityConfig, secrets SecretSource) (IdentityProvider, error) {
+    renew := cfg.RenewBefore
+    if renew <= 0 {
+        renew = 24 * time.Hour
+    }
+    var source IdentityProvider
+    switch cfg.Source {
+    case "wallet":
+        source = &FileWallet{Dir: cfg.WalletDir}
+    case "ca":
+        if secrets == nil {
+            secrets = EnvSecrets{}
+        }
+        p := &CAIdentityProvider{
+            CA:          &FabricCAClient{URL: cfg.CAURL, CAName: cfg.CAName, MSPID: cfg.MSPID},
+            Secrets:     secrets,
+            Attrs:       cfg.Attrs,
+            RenewBefore: renew,
+        }
+        if cfg.WalletDir != "" {
+            p.Wallet = &FileWallet{Dir: cfg.WalletDir}
+        }
+        source = p
+    case "pkcs11":
+        p, err := NewPKCS11IdentityProvider(cfg.PKCS11.Lib, cfg.PKCS11.TokenLabel, cfg.PKCS11.Pin, cfg.MSPID, cfg.PKCS11.CertDir)
+        if err != nil {
+            return nil, err
+        }
+        source = p
+    default:
+        return nil, fmt.Errorf("身份来源 %q 不受支持（wallet/ca/pkcs11）", cfg.Source)
+    }
+    return NewCachingIdentityProvider(source, renew), nil
+}
+
+// validate 校验身份配置，返回问题列表
+func (c *IdentityConfig) validate() []string {
+    var problems []string
+    switch c.Source {
+    case "":
+        return nil
+    case "wallet":
+        if c.WalletDir == "" {
+            problems = append(problems, "identity.walletDir 不能为空")
+        }
+    case "ca":
+        if err := checkEndpoint(c.CAURL, "http", "https"); err != nil {
+            problems = append(problems, "identity.caUrl: "+err.Error())
+        }
+    case "pkcs11":
+        if c.PKCS11.Lib == "" || c.PKCS11.TokenLabel == "" {
+            problems = append(problems, "identity.pkcs11.lib 与 tokenLabel 不能为空")
+        }
+    default:
+        problems = append(problems, fmt.Sprintf("identity.source 必须为 wallet/ca/pkcs11，当前为 %q", c.Source))
+    }
+    if c.MSPID == "" {
+        problems = append(problems, "identity.mspId 不能为空")
+    }
+    return problems
+}
+
+func parseCertPEM(data []byte) (*x509.Certificate, error) {
+    block, _ := pem.Decode(data)
+    if block == nil || block.Type != "CERTIFICATE" {
+        return nil, errors.New("证书不是 PEM 格式")
+    }
+    cert, err := x509.ParseCertificate(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("解析证书失败: %v", err)
+    }
+    return cert, nil
+}
+
+func parseKeyPEM(data []byte) (crypto.Signer, error) {
+    block, _ := pem.Decode(data)
+    if block == nil {
+        return nil, errors.New("私钥不是 PEM 格式")
+    }
+    if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+        if signer, ok := key.(crypto.Signer); ok {
+            return signer, nil
+        }
+        return nil, fmt.Errorf("私钥类型 %T 不支持签名", key)
+    }
+    if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+        return key, nil
+    }
+    if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+        return key, nil
+    }
+    return nil, errors.New("无法解析私钥")
+}
@@ -0,0 +1,70 @@
+package mapping
+
+import (
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "strings"
+    "sync/atomic"
+)
+
+// -------------------------------
+//  结构化日志
+// -------------------------------
+
+// LogConfig 日志配置
+type LogConfig struct {
+    Level  string `yaml:"level"`  // debug / info / warn / error
+    Format string `yaml:"format"` // json / text
+}
+
+var activeLogger atomic.Pointer[slog.Logger]
+
+func init() {
+    activeLogger.Store(NewLogger(os.Stderr, LogConfig{Level: "info", Format: "json"}))
+}
+
+// NewLogger 按配置创建写入 w 的结构化日志
+func NewLogger(w io.Writer, cfg LogConfig) *slog.Logger {
+    level, err := parseLogLevel(cfg.Level)
+    if err != nil {
+        level = slog.LevelInfo
+    }
+    opts := &slog.HandlerOptions{Level: level}
+    if strings.EqualFold(cfg.Format, "text") {
+        return slog.New(slog.NewTextHandler(w, opts))
+    }
+    return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// SetLogger 替换工具包使用的日志（UseConfig 会按 Config.Log 自动设置）
+func SetLogger(l *slog.Logger) {
+    if l != nil {
+        activeLogger.Store(l)
+    }
+}
+
+// Logger 返回当前日志
+func Logger() *slog.Logger {
+    return activeLogger.Load()
+}
+
+// txLog 返回带交易关联字段的日志，txID 与链码日志中的 txID 字段同名，便于跨服务检索
+func txLog(txID string) *slog.Logger {
+    return Logger().With("txID", txID)
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+    switch strings.ToLower(level) {
+    case "debug":
+        return slog.LevelDebug, nil
+    case "", "info":
+        return slog.LevelInfo, nil
+    case "warn", "warning":
+        return slog.LevelWarn, nil
+    case "error":
+        return slog.LevelError, nil
+    }
+    return slog.LevelInfo, fmt.Errorf("未知日志级别 %q", level)
+}
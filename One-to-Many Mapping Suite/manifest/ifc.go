@@ -0,0 +1,294 @@
+// Package manifest 从两版 IFC 模型计算构件级变更清单（新增 / 修改 / 删除的构件 GUID 及各自哈希），
+// 清单存入 IPFS，链上 BIMUpdate 只记录其 CID 与根哈希，审批人据此了解本次更新实际改动了什么。
+package manifest
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// -------------------------------
+//  IFC（STEP 物理文件）解析
+// -------------------------------
+
+// Element 模型构件及其属性
+type Element struct {
+    GUID string `json:"guid"`
+    Type string `json:"type"` // IFC 实体类型，如 IFCWALL
+    Name string `json:"name,omitempty"`
+    // Properties 属性值：Attr[i] 为实体第 i 个属性（引用的几何、定位等取被引用内容的哈希），
+    // Pset.Prop 为属性集与数量集中的值
+    Properties map[string]string `json:"-"`
+    Hash       string            `json:"hash"` // Properties 的 SHA-256
+}
+
+// entity STEP 文件中的一条实例，如 #12=IFCWALL('guid',#5,'Wall-01',$,...)
+type entity struct {
+    typ  string
+    args []string // 顶层参数原文
+}
+
+// ParseIFC 解析 IFC 文件，返回以 GUID 为键的构件
+func ParseIFC(data []byte) (map[string]*Element, error) {
+    entities, err := parseStep(data)
+    if err != nil {
+        return nil, err
+    }
+    h := &hasher{entities: entities, memo: map[int]string{}, busy: map[int]bool{}}
+
+    elements := map[string]*Element{}
+    byID := map[int]*Element{}
+    for id, e := range entities {
+        if !isElement(e) {
+            continue
+        }
+        guid := unquote(e.args[0])
+        el := &Element{GUID: guid, Type: e.typ, Properties: map[string]string{}}
+        if len(e.args) > 2 {
+            el.Name = unquote(e.args[2])
+        }
+        // 跳过 GlobalId 与 OwnerHistory（每次保存都会变化）
+        for i := 2; i < len(e.args); i++ {
+            el.Properties["Attr["+strconv.Itoa(i)+"]"] = h.value(e.args[i])
+        }
+        elements[guid] = el
+        byID[id] = el
+    }
+
+    // IFCRELDEFINESBYPROPERTIES(GlobalId, OwnerHistory, Name, Description, (RelatedObjects), RelatingPropertyDefinition)
+    for _, e := range entities {
+        if e.typ != "IFCRELDEFINESBYPROPERTIES" || len(e.args) < 6 {
+            continue
+        }
+        props := propertySet(entities, ref(e.args[5]))
+        for _, r := range splitList(e.args[4]) {
+            el, ok := byID[ref(r)]
+            if !ok {
+                continue
+            }
+            for k, v := range props {
+                el.Properties[k] = v
+            }
+        }
+    }
+
+    for _, el := range elements {
+        el.Hash = hashProperties(el.Type, el.Properties)
+    }
+    return elements, nil
+}
+
+// propertySet 展开 IFCPROPERTYSET / IFCELEMENTQUANTITY 为 Pset.Prop -> 值
+func propertySet(entities map[int]*entity, id int) map[string]string {
+    pset, ok := entities[id]
+    if !ok || len(pset.args) < 5 {
+        return nil
+    }
+    name := unquote(pset.args[2])
+    var items []string
+    switch pset.typ {
+    case "IFCPROPERTYSET":
+        items = splitList(pset.args[4])
+    case "IFCELEMENTQUANTITY":
+        if len(pset.args) < 6 {
+            return nil
+        }
+        items = splitList(pset.args[5])
+    default:
+        return nil
+    }
+
+    props := map[string]string{}
+    for _, r := range items {
+        p, ok := entities[ref(r)]
+        if !ok || len(p.args) < 3 {
+            continue
+        }
+        key := name + "." + unquote(p.args[0])
+        switch {
+        case p.typ == "IFCPROPERTYSINGLEVALUE":
+            props[key] = p.args[2] // NominalValue，如 IFCLABEL('C30')
+        case strings.HasPrefix(p.typ, "IFCQUANTITY") && len(p.args) > 3:
+            props[key] = p.args[3]
+        default:
+            props[key] = p.typ + "(" + strings.Join(p.args[1:], ",") + ")"
+        }
+    }
+    return props
+}
+
+// isElement 带 GlobalId 的对象实例（排除关系、属性定义与类型对象）
+func isElement(e *entity) bool {
+    if len(e.args) < 2 || !isGUID(unquote(e.args[0])) {
+        return false
+    }
+    switch {
+    case strings.HasPrefix(e.typ, "IFCREL"),
+        e.typ == "IFCPROPERTYSET",
+        e.typ == "IFCELEMENTQUANTITY",
+        strings.HasSuffix(e.typ, "TYPE"),
+        strings.HasSuffix(e.typ, "STYLE"):
+        return false
+    }
+    return true
+}
+
+// hasher 计算被引用实例的内容哈希：实例号（#12）在每次导出时可能不同，
+// 因此用被引用内容递归替换实例号后再哈希
+type hasher struct {
+    entities map[int]*entity
+    memo     map[int]string
+    busy     map[int]bool
+}
+
+// value 规范化一个参数：引用替换为内容哈希，列表逐项处理
+func (h *hasher) value(arg string) string {
+    switch {
+    case strings.HasPrefix(arg, "#"):
+        return h.hash(ref(arg))
+    case strings.HasPrefix(arg, "("):
+        items := splitList(arg)
+        for i, it := range items {
+            items[i] = h.value(it)
+        }
+        return "(" + strings.Join(items, ",") + ")"
+    }
+    return arg
+}
+
+func (h *hasher) hash(id int) string {
+    if v, ok := h.memo[id]; ok {
+        return v
+    }
+    e, ok := h.entities[id]
+    if !ok || h.busy[id] {
+        return "#?"
+    }
+    h.busy[id] = true
+    args := make([]string, len(e.args))
+    for i, a := range e.args {
+        args[i] = h.value(a)
+    }
+    delete(h.busy, id)
+    sum := sha256.Sum256([]byte(e.typ + "(" + strings.Join(args, ",") + ")"))
+    h.memo[id] = hex.EncodeToString(sum[:8])
+    return h.memo[id]
+}
+
+func hashProperties(typ string, props map[string]string) string {
+    keys := make([]string, 0, len(props))
+    for k := range props {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    var buf bytes.Buffer
+    buf.WriteString(typ + "\n")
+    for _, k := range keys {
+        buf.WriteString(k + "=" + props[k] + "\n")
+    }
+    sum := sha256.Sum256(buf.Bytes())
+    return hex.EncodeToString(sum[:])
+}
+
+// parseStep 解析 DATA 段中的实例
+func parseStep(data []byte) (map[int]*entity, error) {
+    text := string(data)
+    start := strings.Index(text, "DATA;")
+    if start < 0 {
+        return nil, fmt.Errorf("不是 IFC 文件：缺少 DATA 段")
+    }
+    text = text[start+len("DATA;"):]
+    if end := strings.Index(text, "ENDSEC;"); end >= 0 {
+        text = text[:end]
+    }
+
+    entities := map[int]*entity{}
+    for _, stmt := range splitTop(text, ';') {
+        stmt = strings.TrimSpace(stmt)
+        if stmt == "" {
+            continue
+        }
+        eq := strings.Index(stmt, "=")
+        open := strings.Index(stmt, "(")
+        if !strings.HasPrefix(stmt, "#") || eq < 0 || open < eq || !strings.HasSuffix(stmt, ")") {
+            return nil, fmt.Errorf("无法解析实例: %.80s", stmt)
+        }
+        id, err := strconv.Atoi(strings.TrimSpace(stmt[1:eq]))
+        if err != nil {
+            return nil, fmt.Errorf("无效的实例号: %.80s", stmt)
+        }
+        entities[id] = &entity{
+            typ:  strings.ToUpper(strings.TrimSpace(stmt[eq+1 : open])),
+            args: splitTop(stmt[open+1:len(stmt)-1], ','),
+        }
+    }
+    return entities, nil
+}
+
+// splitTop 按 sep 切分，忽略字符串与括号内的分隔符
+func splitTop(s string, sep byte) []string {
+    var parts []string
+    depth, last := 0, 0
+    inString := false
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case c == '\'':
+            inString = !inString // STEP 中的 '' 转义会切换两次，结果不变
+        case inString:
+        case c == '(':
+            depth++
+        case c == ')':
+            depth--
+        case c == sep && depth == 0:
+            parts = append(parts, strings.TrimSpace(s[last:i]))
+            last = i + 1
+        }
+    }
+    if tail := strings.TrimSpace(s[last:]); tail != "" || len(parts) > 0 {
+        parts = append(parts, tail)
+    }
+    return parts
+}
+
+// splitList 切分 (a,b,c) 形式的列表参数
+func splitList(arg string) []string {
+    arg = strings.TrimSpace(arg)
+    if !strings.HasPrefix(arg, "(") || !strings.HasSuffix(arg, ")") {
+        return nil
+    }
+    return splitTop(arg[1:len(arg)-1], ',')
+}
+
+// isGUID IFC GlobalId：22 个字符的压缩 GUID（0-9A-Za-z_$）
+func isGUID(s string) bool {
+    if len(s) != 22 {
+        return false
+    }
+    for _, c := range s {
+        if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '$') {
+            return false
+        }
+    }
+    return true
+}
+
+func ref(arg string) int {
+    id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(arg), "#"))
+    if err != nil {
+        return -1
+    }
+    return id
+}
+
+func unquote(arg string) string {
+    if len(arg) >= 2 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+        return strings.ReplaceAll(arg[1:len(arg)-1], "''", "'")
+    }
+    return ""
+}
@@ -0,0 +1,169 @@
+package manifest
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "sort"
+)
+
+// -------------------------------
+//  变更清单
+// -------------------------------
+
+// 变更类型
+const (
+    Added    = "ADDED"
+    Modified = "MODIFIED"
+    Deleted  = "DELETED"
+)
+
+// Change 单个构件的变更
+type Change struct {
+    Kind    string `json:"kind"`
+    GUID    string `json:"guid"`
+    Type    string `json:"type"`
+    Name    string `json:"name,omitempty"`
+    OldHash string `json:"oldHash,omitempty"`
+    NewHash string `json:"newHash,omitempty"`
+    // Properties 修改的属性键（仅 MODIFIED）
+    Properties []string `json:"properties,omitempty"`
+}
+
+// Manifest 变更清单，按 GUID 排序；存入 IPFS 的即为其 JSON
+type Manifest struct {
+    Changes  []Change `json:"changes"`
+    RootHash string   `json:"rootHash"` // 各变更叶子哈希的 Merkle 根，记录在链上
+}
+
+// Ref 链上 BIMUpdate.ChangeManifest 的镜像
+type Ref struct {
+    CID      string `json:"CID"`
+    RootHash string `json:"RootHash"`
+    Added    int    `json:"Added"`
+    Modified int    `json:"Modified"`
+    Deleted  int    `json:"Deleted"`
+    // Categories 变更构件的 IFC 实体类型（去重排序），链码据此按责任矩阵分派审核人
+    Categories []string `json:"Categories,omitempty"`
+}
+
+// Build 比较两版 IFC 文件生成变更清单；previous 为空时所有构件均为新增
+func Build(previous, current []byte) (*Manifest, error) {
+    var before map[string]*Element
+    if len(previous) > 0 {
+        var err error
+        if before, err = ParseIFC(previous); err != nil {
+            return nil, fmt.Errorf("解析上一版模型失败: %v", err)
+        }
+    }
+    after, err := ParseIFC(current)
+    if err != nil {
+        return nil, fmt.Errorf("解析当前模型失败: %v", err)
+    }
+    return Diff(before, after), nil
+}
+
+// Diff 比较两组构件
+func Diff(before, after map[string]*Element) *Manifest {
+    m := &Manifest{Changes: []Change{}}
+    for guid, el := range after {
+        old, ok := before[guid]
+        switch {
+        case !ok:
+            m.Changes = append(m.Changes, Change{Kind: Added, GUID: guid, Type: el.Type, Name: el.Name, NewHash: el.Hash})
+        case old.Hash != el.Hash:
+            m.Changes = append(m.Changes, Change{Kind: Modified, GUID: guid, Type: el.Type, Name: el.Name,
+                OldHash: old.Hash, NewHash: el.Hash, Properties: changedProperties(old, el)})
+        }
+    }
+    for guid, el := range before {
+        if _, ok := after[guid]; !ok {
+            m.Changes = append(m.Changes, Change{Kind: Deleted, GUID: guid, Type: el.Type, Name: el.Name, OldHash: el.Hash})
+        }
+    }
+    sort.Slice(m.Changes, func(i, j int) bool { return m.Changes[i].GUID < m.Changes[j].GUID })
+    m.RootHash = rootHash(m.Changes)
+    return m
+}
+
+// Ref 生成链上引用，cid 为清单 JSON 上传 IPFS 后的 CID
+func (m *Manifest) Ref(cid string) Ref {
+    r := Ref{CID: cid, RootHash: m.RootHash}
+    seen := map[string]bool{}
+    for _, c := range m.Changes {
+        if c.Type != "" && !seen[c.Type] {
+            seen[c.Type] = true
+            r.Categories = append(r.Categories, c.Type)
+        }
+        switch c.Kind {
+        case Added:
+            r.Added++
+        case Modified:
+            r.Modified++
+        case Deleted:
+            r.Deleted++
+        }
+    }
+    sort.Strings(r.Categories)
+    return r
+}
+
+// Marshal 序列化清单（上传 IPFS 的内容）
+func (m *Manifest) Marshal() ([]byte, error) {
+    return json.Marshal(m)
+}
+
+// Verify 解析从 IPFS 取回的清单，并校验其内容与链上根哈希一致
+func Verify(data []byte, expected string) (*Manifest, error) {
+    var m Manifest
+    if err := json.Unmarshal(data, &m); err != nil {
+        return nil, fmt.Errorf("解析变更清单失败: %v", err)
+    }
+    if got := rootHash(m.Changes); got != expected || m.RootHash != expected {
+        return nil, fmt.Errorf("变更清单根哈希不匹配: 计算得 %s，链上为 %s", got, expected)
+    }
+    return &m, nil
+}
+
+func changedProperties(before, after *Element) []string {
+    var keys []string
+    for k, v := range after.Properties {
+        if old, ok := before.Properties[k]; !ok || old != v {
+            keys = append(keys, k)
+        }
+    }
+    for k := range before.Properties {
+        if _, ok := after.Properties[k]; !ok {
+            keys = append(keys, k)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// rootHash 计算 Merkle 根：叶子为 sha256(kind|guid|oldHash|newHash)，奇数层复制最后一个节点；
+// 空清单的根为 sha256("")
+func rootHash(changes []Change) string {
+    if len(changes) == 0 {
+        sum := sha256.Sum256(nil)
+        return hex.EncodeToString(sum[:])
+    }
+    level := make([][]byte, len(changes))
+    for i, c := range changes {
+        sum := sha256.Sum256([]byte(c.Kind + "|" + c.GUID + "|" + c.OldHash + "|" + c.NewHash))
+        level[i] = sum[:]
+    }
+    for len(level) > 1 {
+        if len(level)%2 == 1 {
+            level = append(level, level[len(level)-1])
+        }
+        next := make([][]byte, 0, len(level)/2)
+        for i := 0; i < len(level); i += 2 {
+            sum := sha256.Sum256(append(append([]byte{}, level[i]...), level[i+1]...))
+            next = append(next, sum[:])
+        }
+        level = next
+    }
+    return hex.EncodeToString(level[0])
+}
@@ -0,0 +1,117 @@
+package mapping
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+    "sync"
+)
+
+// -------------------------------
+//  模型关注者
+// -------------------------------
+
+// EventModelWatchChanged 链码 WatchContract 的关注变更事件
+const EventModelWatchChanged = "BIMModelWatchChanged"
+
+// WatcherDirectory 返回关注模型某个事件的收件人
+type WatcherDirectory interface {
+    Watchers(modelID string, event string) ([]Recipient, error)
+}
+
+// ModelWatch 链上 ModelWatch 记录（WatchModel / UnwatchModel 的事件内容）
+type ModelWatch struct {
+    ModelID string   `json:"ModelID"`
+    Watcher string   `json:"Watcher"` // 链上身份
+    Events  []string `json:"Events"`  // 为空表示全部事件
+    Since   string   `json:"Since"`
+    Removed bool     `json:"Removed,omitempty"`
+}
+
+// Wants 是否关注 event
+func (w *ModelWatch) Wants(event string) bool {
+    if len(w.Events) == 0 {
+        return true
+    }
+    for _, e := range w.Events {
+        if e == event {
+            return true
+        }
+    }
+    return false
+}
+
+// WatchList 跟踪链上的模型关注记录，实现 WatcherDirectory。
+// 由事件监听服务调用 HandleEvent；启动时可先用 QueryModelWatchers 的结果经 Load 载入，
+// 或经 EventListener.Replay 重放事件恢复。
+type WatchList struct {
+    // Resolve 把链上身份解析为收件人（对接企业通讯录），返回 nil 表示该身份不接收通知
+    Resolve func(identity string) (*Recipient, error)
+
+    mu      sync.RWMutex
+    watches map[string]map[string]*ModelWatch // 模型 -> 身份 -> 关注
+}
+
+// NewWatchList 创建关注列表
+func NewWatchList(resolve func(identity string) (*Recipient, error)) *WatchList {
+    return &WatchList{Resolve: resolve, watches: map[string]map[string]*ModelWatch{}}
+}
+
+// Load 载入一个模型的全部关注，替换已有记录
+func (l *WatchList) Load(modelID string, watches []ModelWatch) {
+    m := map[string]*ModelWatch{}
+    for i := range watches {
+        w := watches[i]
+        m[w.Watcher] = &w
+    }
+    l.mu.Lock()
+    l.watches[modelID] = m
+    l.mu.Unlock()
+}
+
+// HandleEvent 处理 BIMModelWatchChanged 事件，其他事件忽略
+func (l *WatchList) HandleEvent(eventName string, txID string, payload []byte) error {
+    if eventName != EventModelWatchChanged {
+        return nil
+    }
+    var w ModelWatch
+    if err := json.Unmarshal(payload, &w); err != nil {
+        return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+    }
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if w.Removed {
+        delete(l.watches[w.ModelID], w.Watcher)
+        return nil
+    }
+    if l.watches[w.ModelID] == nil {
+        l.watches[w.ModelID] = map[string]*ModelWatch{}
+    }
+    l.watches[w.ModelID][w.Watcher] = &w
+    return nil
+}
+
+// Watchers 返回关注 modelID 的 event 的收件人，按身份排序
+func (l *WatchList) Watchers(modelID string, event string) ([]Recipient, error) {
+    l.mu.RLock()
+    var identities []string
+    for id, w := range l.watches[modelID] {
+        if w.Wants(event) {
+            identities = append(identities, id)
+        }
+    }
+    l.mu.RUnlock()
+    sort.Strings(identities)
+
+    var recipients []Recipient
+    for _, id := range identities {
+        r, err := l.Resolve(id)
+        if err != nil {
+            return nil, fmt.Errorf("解析关注者 %s 失败: %v", id, err)
+        }
+        if r != nil {
+            recipients = append(recipients, *r)
+        }
+    }
+    return recipients, nil
+}
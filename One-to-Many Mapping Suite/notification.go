@@ -0,0 +1,529 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/smtp"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "text/template"
+    "time"
+)
+
+// -------------------------------
+//  通知分发（事件 -> 收件人 -> 邮件 / Webhook / 钉钉 / 企业微信）
+// -------------------------------
+
+// 链码事件名（与链码常量保持一致）
+const (
+    EventBIMInit    = "BIMUpdateInitialized"
+    EventBIMApprove = "BIMUpdateApproved"
+    EventBIMReject  = "BIMUpdateRejected"
+    EventBIMPublish = "BIMUpdatePublished"
+)
+
+// 映射服务自身产生的通知类型（不是链码事件），模板同样放在 Dispatcher.Templates 中
+const (
+    NoticeApprovalReminder   = "ApprovalReminder"
+    NoticeApprovalEscalation = "ApprovalEscalation"
+    // NoticeModelWatch 发给模型关注者的链码事件通知，见 model_watch.go
+    NoticeModelWatch = "ModelWatch"
+    // NoticeFileIntegrity 锚定的文件缺失或与链上指纹不一致，见 reconciliation.go
+    NoticeFileIntegrity = "FileIntegrity"
+)
+
+// Recipient 通知收件人
+type Recipient struct {
+    UserID  string `json:"userId"`
+    Name    string `json:"name"`
+    Email   string `json:"email,omitempty"`
+    Mobile  string `json:"mobile,omitempty"`  // 钉钉 @ 提醒
+    WeComID string `json:"wecomId,omitempty"` // 企业微信 @ 提醒
+}
+
+// Directory 收件人目录（对接企业通讯录）
+type Directory interface {
+    // Approvers 返回模型的审批人
+    Approvers(modelID string) ([]Recipient, error)
+    // Initiator 返回更新的发起人，initiator 为链上记录的身份
+    Initiator(updateID string, initiator string) (*Recipient, error)
+}
+
+// Notification 发给单个收件人的一条通知
+type Notification struct {
+    Event     string    `json:"event"`
+    TxID      string    `json:"txId"`
+    UpdateID  string    `json:"updateId"`
+    Recipient Recipient `json:"recipient"`
+    Subject   string    `json:"subject"`
+    Body      string    `json:"body"`
+}
+
+// Notifier 通知渠道
+type Notifier interface {
+    Name() string
+    Send(ctx context.Context, n *Notification) error
+}
+
+// ErrNoAddress 收件人在该渠道没有地址，跳过且不重试
+var ErrNoAddress = errors.New("收件人在该渠道没有地址")
+
+// MessageTemplate 通知模板（text/template 语法，数据为 TemplateData）
+type MessageTemplate struct {
+    Subject *template.Template
+    Body    *template.Template
+}
+
+// TemplateData 模板数据
+type TemplateData struct {
+    Event     string
+    TxID      string
+    Update    *LedgerUpdate   // BIMUpdateInitialized / BIMUpdatePublished
+    Approval  *LedgerApproval // BIMUpdateApproved / BIMUpdateRejected
+    Recipient Recipient
+    // Waiting 更新已等待审批的时长（提醒 / 升级通知）
+    Waiting time.Duration
+    // Integrity 文件核对结果（完整性告警）
+    Integrity *IntegrityResult
+}
+
+// NewMessageTemplate 解析主题与正文模板
+func NewMessageTemplate(subject, body string) (*MessageTemplate, error) {
+    s, err := template.New("subject").Parse(subject)
+    if err != nil {
+        return nil, fmt.Errorf("解析主题模板失败: %v", err)
+    }
+    b, err := template.New("body").Parse(body)
+    if err != nil {
+        return nil, fmt.Errorf("解析正文模板失败: %v", err)
+    }
+    return &MessageTemplate{Subject: s, Body: b}, nil
+}
+
+func mustTemplate(subject, body string) *MessageTemplate {
+    t, err := NewMessageTemplate(subject, body)
+    if err != nil {
+        panic(err)
+    }
+    return t
+}
+
+// DefaultTemplates 默认通知模板
+func DefaultTemplates() map[string]*MessageTemplate {
+    return map[string]*MessageTemplate{
+        EventBIMInit: mustTemplate(
+            "[BIM] 待审批：{{.Update.ModelID}} {{.Update.Version}}",
+            "{{.Recipient.Name}}，模型 {{.Update.ModelID}} 提交了新版本 {{.Update.Version}}（更新 {{.Update.UpdateID}}），请审批。\n说明：{{.Update.Description}}"+
+                "{{with .Update.ChangeManifest}}\n构件变更：新增 {{.Added}}，修改 {{.Modified}}，删除 {{.Deleted}}（清单 {{.CID}}）{{end}}"),
+        EventBIMApprove: mustTemplate(
+            "[BIM] 已通过：{{.Approval.UpdateID}}",
+            "{{.Recipient.Name}}，您提交的更新 {{.Approval.UpdateID}}（{{.Approval.ModelID}} {{.Approval.Version}}）已审批通过。\n意见：{{.Approval.Comment}}"),
+        EventBIMReject: mustTemplate(
+            "[BIM] 已驳回：{{.Approval.UpdateID}}",
+            "{{.Recipient.Name}}，您提交的更新 {{.Approval.UpdateID}}（{{.Approval.ModelID}} {{.Approval.Version}}）被驳回，原因：{{.Approval.ReasonCode}}。\n意见：{{.Approval.Comment}}"),
+        EventBIMPublish: mustTemplate(
+            "[BIM] 已发布：{{.Update.ModelID}} {{.Update.Version}}",
+            "{{.Recipient.Name}}，您提交的更新 {{.Update.UpdateID}} 已发布为 {{.Update.ModelID}} {{.Update.Version}}。"),
+        NoticeApprovalReminder: mustTemplate(
+            "[BIM] 审批提醒：{{.Update.ModelID}} {{.Update.Version}}",
+            "{{.Recipient.Name}}，更新 {{.Update.UpdateID}}（{{.Update.ModelID}} {{.Update.Version}}）已等待审批 {{.Waiting}}，请尽快处理。"),
+        NoticeApprovalEscalation: mustTemplate(
+            "[BIM] 审批超时：{{.Update.ModelID}} {{.Update.Version}}",
+            "{{.Recipient.Name}}，更新 {{.Update.UpdateID}}（{{.Update.ModelID}} {{.Update.Version}}）已等待审批 {{.Waiting}} 仍未处理，请协调审批人。"),
+        NoticeModelWatch: mustTemplate(
+            "[BIM] 关注的模型动态：{{with .Update}}{{.ModelID}} {{.Version}}{{end}}{{with .Approval}}{{.ModelID}} {{.Version}}{{end}}",
+            "{{.Recipient.Name}}，您关注的模型有新动态 {{.Event}}："+
+                "{{with .Update}}更新 {{.UpdateID}}（{{.ModelID}} {{.Version}}），状态 {{.Status}}。\n说明：{{.Description}}{{end}}"+
+                "{{with .Approval}}更新 {{.UpdateID}}（{{.ModelID}} {{.Version}}）审批结果 {{.ApproveResult}}。\n意见：{{.Comment}}{{end}}"),
+        NoticeFileIntegrity: mustTemplate(
+            "[BIM] 文件完整性告警：{{.Integrity.ModelID}} {{.Integrity.Name}}",
+            "{{.Recipient.Name}}，更新 {{.Integrity.UpdateID}}（{{.Integrity.ModelID}} {{.Integrity.Version}}）锚定的文件 {{.Integrity.Name}}（CID {{.Integrity.CID}}）"+
+                "{{if eq .Integrity.Status \"MISSING\"}}已无法从存储取回{{else}}与链上记录不一致{{end}}：{{.Integrity.Detail}}"),
+    }
+}
+
+// Dispatcher 根据事件类型确定收件人、渲染模板，并通过各渠道异步投递（失败按指数退避重试）
+type Dispatcher struct {
+    Directory Directory
+    Channels  []Notifier
+    Templates map[string]*MessageTemplate
+    // Watchers 模型关注者，配置后事件同时按 NoticeModelWatch 模板通知关注者（已直接收到通知的除外）
+    Watchers WatcherDirectory
+
+    MaxAttempts int           // 每个渠道的最大投递次数，默认 5
+    Backoff     time.Duration // 首次重试间隔，之后翻倍，默认 2s
+    // OnDeadLetter 重试耗尽后调用，可用于落库或告警
+    OnDeadLetter func(channel string, n *Notification, err error)
+
+    queue chan delivery
+    wg    sync.WaitGroup
+}
+
+type delivery struct {
+    channel Notifier
+    n       *Notification
+}
+
+// NewDispatcher 创建通知分发器，使用默认模板
+func NewDispatcher(dir Directory, channels ...Notifier) *Dispatcher {
+    return &Dispatcher{
+        Directory:   dir,
+        Channels:    channels,
+        Templates:   DefaultTemplates(),
+        MaxAttempts: 5,
+        Backoff:     2 * time.Second,
+    }
+}
+
+// Start 启动 workers 个投递协程，队列容量为 queueSize；ctx 取消后不再重试
+func (d *Dispatcher) Start(ctx context.Context, workers int, queueSize int) {
+    if workers <= 0 {
+        workers = 1
+    }
+    d.queue = make(chan delivery, queueSize)
+    for i := 0; i < workers; i++ {
+        d.wg.Add(1)
+        go func() {
+            defer d.wg.Done()
+            for job := range d.queue {
+                d.deliver(ctx, job)
+            }
+        }()
+    }
+}
+
+// Stop 关闭队列并等待已入队的通知投递完成
+func (d *Dispatcher) Stop() {
+    close(d.queue)
+    d.wg.Wait()
+}
+
+// HandleEvent 处理一条链码事件：事件监听服务收到事件后调用
+// 不关心的事件类型直接忽略
+func (d *Dispatcher) HandleEvent(eventName string, txID string, payload []byte) error {
+    tmpl, ok := d.Templates[eventName]
+    if !ok {
+        return nil
+    }
+    data, recipients, err := d.resolve(eventName, txID, payload)
+    if err != nil {
+        return err
+    }
+    if err := d.send(eventName, tmpl, data, recipients); err != nil {
+        return err
+    }
+    return d.notifyWatchers(eventName, data, recipients)
+}
+
+// notifyWatchers 通知关注事件所属模型的收件人，跳过 notified 中已通知的
+func (d *Dispatcher) notifyWatchers(eventName string, data *TemplateData, notified []Recipient) error {
+    tmpl, ok := d.Templates[NoticeModelWatch]
+    if d.Watchers == nil || !ok {
+        return nil
+    }
+    var modelID string
+    switch {
+    case data.Update != nil:
+        modelID = data.Update.ModelID
+    case data.Approval != nil:
+        modelID = data.Approval.ModelID
+    }
+    watchers, err := d.Watchers.Watchers(modelID, eventName)
+    if err != nil {
+        return fmt.Errorf("查询模型 %s 的关注者失败: %v", modelID, err)
+    }
+    skip := map[string]bool{}
+    for _, r := range notified {
+        skip[r.UserID] = true
+    }
+    var recipients []Recipient
+    for _, r := range watchers {
+        if !skip[r.UserID] {
+            skip[r.UserID] = true
+            recipients = append(recipients, r)
+        }
+    }
+    return d.send(NoticeModelWatch, tmpl, data, recipients)
+}
+
+// Notify 按 kind 对应的模板向收件人发送通知，用于提醒、升级等非链码事件触发的通知
+func (d *Dispatcher) Notify(kind string, data *TemplateData, recipients []Recipient) error {
+    tmpl, ok := d.Templates[kind]
+    if !ok {
+        return fmt.Errorf("通知类型 %s 没有模板", kind)
+    }
+    data.Event = kind
+    return d.send(kind, tmpl, data, recipients)
+}
+
+// send 为每个收件人渲染模板并投递到所有渠道
+func (d *Dispatcher) send(kind string, tmpl *MessageTemplate, data *TemplateData, recipients []Recipient) error {
+    for _, r := range recipients {
+        data.Recipient = r
+        subject, err := render(tmpl.Subject, data)
+        if err != nil {
+            return err
+        }
+        body, err := render(tmpl.Body, data)
+        if err != nil {
+            return err
+        }
+        n := &Notification{Event: kind, TxID: data.TxID, UpdateID: updateIDOf(data), Recipient: r, Subject: subject, Body: body}
+        for _, ch := range d.Channels {
+            d.queue <- delivery{channel: ch, n: n}
+        }
+    }
+    return nil
+}
+
+// resolve 解析事件内容并确定收件人：新更新通知审批人，审批结果与发布通知发起人
+func (d *Dispatcher) resolve(eventName string, txID string, payload []byte) (*TemplateData, []Recipient, error) {
+    data := &TemplateData{Event: eventName, TxID: txID}
+    switch eventName {
+    case EventBIMInit, EventBIMPublish:
+        var u LedgerUpdate
+        if err := json.Unmarshal(payload, &u); err != nil {
+            return nil, nil, fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        data.Update = &u
+        if eventName == EventBIMInit {
+            approvers, err := d.Directory.Approvers(u.ModelID)
+            return data, approvers, err
+        }
+        r, err := d.Directory.Initiator(u.UpdateID, u.Initiator)
+        if err != nil || r == nil {
+            return data, nil, err
+        }
+        return data, []Recipient{*r}, nil
+    default:
+        var a LedgerApproval
+        if err := json.Unmarshal(payload, &a); err != nil {
+            return nil, nil, fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        data.Approval = &a
+        r, err := d.Directory.Initiator(a.UpdateID, "")
+        if err != nil || r == nil {
+            return data, nil, err
+        }
+        return data, []Recipient{*r}, nil
+    }
+}
+
+// deliver 投递一条通知，失败时按指数退避重试
+func (d *Dispatcher) deliver(ctx context.Context, job delivery) {
+    attempts := d.MaxAttempts
+    if attempts <= 0 {
+        attempts = 5
+    }
+    wait := d.Backoff
+    if wait <= 0 {
+        wait = 2 * time.Second
+    }
+    log := txLog(job.n.TxID).With("channel", job.channel.Name(), "event", job.n.Event, "userId", job.n.Recipient.UserID)
+
+    var err error
+retry:
+    for i := 1; i <= attempts; i++ {
+        err = job.channel.Send(ctx, job.n)
+        if err == nil || errors.Is(err, ErrNoAddress) {
+            return
+        }
+        log.Warn("通知投递失败", "attempt", i, "err", err)
+        if i == attempts {
+            break
+        }
+        select {
+        case <-ctx.Done():
+            err = ctx.Err()
+            break retry
+        case <-time.After(wait):
+            wait *= 2
+        }
+    }
+    log.Error("通知重试耗尽", "err", err)
+    if d.OnDeadLetter != nil {
+        d.OnDeadLetter(job.channel.Name(), job.n, err)
+    }
+}
+
+func render(t *template.Template, data *TemplateData) (string, error) {
+    var buf bytes.Buffer
+    if err := t.Execute(&buf, data); err != nil {
+        return "", fmt.Errorf("渲染模板 %s 失败: %v", t.Name(), err)
+    }
+    return buf.String(), nil
+}
+
+func updateIDOf(data *TemplateData) string {
+    if data.Update != nil {
+        return data.Update.UpdateID
+    }
+    if data.Approval != nil {
+        return data.Approval.UpdateID
+    }
+    return ""
+}
+
+// -------------------------------
+//  通知渠道
+// -------------------------------
+
+// SMTPNotifier 邮件通知
+type SMTPNotifier struct {
+    Addr string // host:port
+    From string
+    Auth smtp.Auth
+}
+
+// Name 渠道名
+func (s *SMTPNotifier) Name() string { return "smtp" }
+
+// Send 发送邮件
+func (s *SMTPNotifier) Send(ctx context.Context, n *Notification) error {
+    if n.Recipient.Email == "" {
+        return ErrNoAddress
+    }
+    msg := "From: " + s.From + "\r\n" +
+        "To: " + n.Recipient.Email + "\r\n" +
+        "Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte(n.Subject)) + "?=\r\n" +
+        "MIME-Version: 1.0\r\n" +
+        "Content-Type: text/plain; charset=UTF-8\r\n" +
+        "Content-Transfer-Encoding: base64\r\n\r\n" +
+        base64.StdEncoding.EncodeToString([]byte(n.Body))
+    return smtp.SendMail(s.Addr, s.Auth, s.From, []string{n.Recipient.Email}, []byte(msg))
+}
+
+// WebhookNotifier 通用 Webhook，以 JSON 形式 POST Notification
+type WebhookNotifier struct {
+    URL    string
+    Header http.Header
+    Client *http.Client
+}
+
+// Name 渠道名
+func (w *WebhookNotifier) Name() string { return "webhook" }
+
+// Send 推送通知
+func (w *WebhookNotifier) Send(ctx context.Context, n *Notification) error {
+    body, err := json.Marshal(n)
+    if err != nil {
+        return err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    for k, v := range w.Header {
+        req.Header[k] = v
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := httpClient(w.Client).Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        return fmt.Errorf("webhook 返回 %s", resp.Status)
+    }
+    return nil
+}
+
+// DingTalkNotifier 钉钉群机器人（Markdown 消息，可选加签）
+type DingTalkNotifier struct {
+    WebhookURL string // https://oapi.dingtalk.com/robot/send?access_token=...
+    Secret     string // 加签密钥，为空时不加签
+    Client     *http.Client
+}
+
+// Name 渠道名
+func (d *DingTalkNotifier) Name() string { return "dingtalk" }
+
+// Send 推送通知并 @ 收件人手机号
+func (d *DingTalkNotifier) Send(ctx context.Context, n *Notification) error {
+    target := d.WebhookURL
+    if d.Secret != "" {
+        ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+        mac := hmac.New(sha256.New, []byte(d.Secret))
+        mac.Write([]byte(ts + "\n" + d.Secret))
+        sign := url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+        target += "&timestamp=" + ts + "&sign=" + sign
+    }
+    text := "#### " + n.Subject + "\n\n" + n.Body
+    msg := map[string]interface{}{
+        "msgtype":  "markdown",
+        "markdown": map[string]string{"title": n.Subject, "text": text},
+    }
+    if n.Recipient.Mobile != "" {
+        msg["markdown"] = map[string]string{"title": n.Subject, "text": text + "\n\n@" + n.Recipient.Mobile}
+        msg["at"] = map[string][]string{"atMobiles": {n.Recipient.Mobile}}
+    }
+    return postRobot(ctx, httpClient(d.Client), target, msg)
+}
+
+// WeComNotifier 企业微信群机器人（Markdown 消息）
+type WeComNotifier struct {
+    WebhookURL string // https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=...
+    Client     *http.Client
+}
+
+// Name 渠道名
+func (w *WeComNotifier) Name() string { return "wecom" }
+
+// Send 推送通知并 @ 收件人
+func (w *WeComNotifier) Send(ctx context.Context, n *Notification) error {
+    content := "**" + n.Subject + "**\n" + n.Body
+    if n.Recipient.WeComID != "" {
+        content += "\n<@" + n.Recipient.WeComID + ">"
+    }
+    msg := map[string]interface{}{
+        "msgtype":  "markdown",
+        "markdown": map[string]string{"content": content},
+    }
+    return postRobot(ctx, httpClient(w.Client), w.WebhookURL, msg)
+}
+
+// postRobot 调用钉钉 / 企业微信机器人接口，两者均以 errcode 表示结果
+func postRobot(ctx context.Context, client *http.Client, target string, msg interface{}) error {
+    body, err := json.Marshal(msg)
+    if err != nil {
+        return err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    var result struct {
+        ErrCode int    `json:"errcode"`
+        ErrMsg  string `json:"errmsg"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        return fmt.Errorf("机器人接口返回 %s，响应无法解析: %v", resp.Status, err)
+    }
+    if result.ErrCode != 0 {
+        return fmt.Errorf("机器人接口错误 %d: %s", result.ErrCode, strings.TrimSpace(result.ErrMsg))
+    }
+    return nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+    if c != nil {
+        return c
+    }
+    return &http.Client{Timeout: 10 * time.Second}
+}
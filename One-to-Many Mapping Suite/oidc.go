@@ -0,0 +1,239 @@
+package mapping
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  OIDC 令牌校验（RS256 / ES256）
+// -------------------------------
+
+// jwksRefreshInterval 签名公钥缓存时间；遇到未知 kid 时提前刷新，但两次获取至少间隔 jwksMinInterval
+const (
+    jwksRefreshInterval = time.Hour
+    jwksMinInterval     = time.Minute
+)
+
+// oidcVerifier 校验 OIDC 签发的 JWT 并映射到 Fabric 身份
+type oidcVerifier struct {
+    cfg    OIDCConfig
+    client *http.Client
+    now    func() time.Time
+
+    mu      sync.Mutex
+    keys    map[string]crypto.PublicKey // kid -> 公钥
+    fetched time.Time
+}
+
+func newOIDCVerifier(cfg OIDCConfig) *oidcVerifier {
+    if cfg.IdentityClaim == "" {
+        cfg.IdentityClaim = "sub"
+    }
+    return &oidcVerifier{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}, now: time.Now}
+}
+
+// identity 校验令牌并按配置映射为调用方身份
+func (v *oidcVerifier) identity(ctx context.Context, token string) (*CallerIdentity, error) {
+    claims, err := v.verify(ctx, token)
+    if err != nil {
+        return nil, err
+    }
+    value, _ := claims[v.cfg.IdentityClaim].(string)
+    if value == "" {
+        return nil, fmt.Errorf("令牌缺少声明 %s", v.cfg.IdentityClaim)
+    }
+    label := value
+    if len(v.cfg.Identities) > 0 {
+        mapped, ok := v.cfg.Identities[value]
+        if !ok {
+            return nil, fmt.Errorf("%s=%s 未映射到 Fabric 身份", v.cfg.IdentityClaim, value)
+        }
+        label = mapped
+    }
+    msp := v.cfg.DefaultMSP
+    if v.cfg.MSPClaim != "" {
+        if m, _ := claims[v.cfg.MSPClaim].(string); m != "" {
+            msp = m
+        }
+    }
+    sub, _ := claims["sub"].(string)
+    return &CallerIdentity{Label: label, MSPID: msp, Subject: sub, Method: "oidc"}, nil
+}
+
+// verify 校验签名、iss、aud、exp、nbf，返回声明
+func (v *oidcVerifier) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, errors.New("令牌格式错误")
+    }
+    var header struct {
+        Alg string `json:"alg"`
+        Kid string `json:"kid"`
+    }
+    if err := decodeSegment(parts[0], &header); err != nil {
+        return nil, fmt.Errorf("解析令牌头失败: %v", err)
+    }
+    sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, fmt.Errorf("令牌签名编码错误: %v", err)
+    }
+    key, err := v.key(ctx, header.Kid)
+    if err != nil {
+        return nil, err
+    }
+    digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+    switch k := key.(type) {
+    case *rsa.PublicKey:
+        if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+            return nil, errors.New("令牌签名无效")
+        }
+    case *ecdsa.PublicKey:
+        if header.Alg != "ES256" || len(sig) != 64 ||
+            !ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+            return nil, errors.New("令牌签名无效")
+        }
+    default:
+        return nil, fmt.Errorf("不支持的签名算法 %s", header.Alg)
+    }
+
+    var claims map[string]interface{}
+    if err := decodeSegment(parts[1], &claims); err != nil {
+        return nil, fmt.Errorf("解析令牌声明失败: %v", err)
+    }
+    if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+        return nil, fmt.Errorf("令牌签发方 %q 不受信任", iss)
+    }
+    if !hasAudience(claims["aud"], v.cfg.Audience) {
+        return nil, errors.New("令牌受众不符")
+    }
+    now := v.now().Unix()
+    if exp, ok := claims["exp"].(float64); !ok || now >= int64(exp) {
+        return nil, errors.New("令牌已过期")
+    }
+    if nbf, ok := claims["nbf"].(float64); ok && now < int64(nbf) {
+        return nil, errors.New("令牌尚未生效")
+    }
+    return claims, nil
+}
+
+func decodeSegment(seg string, out interface{}) error {
+    data, err := base64.RawURLEncoding.DecodeString(seg)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(data, out)
+}
+
+func hasAudience(aud interface{}, want string) bool {
+    switch a := aud.(type) {
+    case string:
+        return a == want
+    case []interface{}:
+        for _, item := range a {
+            if s, _ := item.(string); s == want {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// key 返回 kid 对应的公钥，缓存过期或 kid 未知时重新获取 JWKS
+func (v *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+    v.mu.Lock()
+    defer v.mu.Unlock()
+    age := v.now().Sub(v.fetched)
+    if k, ok := v.keys[kid]; ok && age < jwksRefreshInterval {
+        return k, nil
+    }
+    if v.keys == nil || age >= jwksMinInterval {
+        if err := v.fetchKeys(ctx); err != nil {
+            return nil, err
+        }
+    }
+    k, ok := v.keys[kid]
+    if !ok {
+        return nil, fmt.Errorf("未知的签名公钥 kid=%s", kid)
+    }
+    return k, nil
+}
+
+// fetchKeys 获取 JWKS（必要时先做 OIDC 发现）；调用方持有 v.mu
+func (v *oidcVerifier) fetchKeys(ctx context.Context) error {
+    jwksURL := v.cfg.JWKSURL
+    if jwksURL == "" {
+        var discovery struct {
+            JWKSURI string `json:"jwks_uri"`
+        }
+        if err := v.getJSON(ctx, strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+            return fmt.Errorf("OIDC 发现失败: %v", err)
+        }
+        jwksURL = discovery.JWKSURI
+    }
+    var set struct {
+        Keys []struct {
+            Kty string `json:"kty"`
+            Kid string `json:"kid"`
+            N   string `json:"n"`
+            E   string `json:"e"`
+            Crv string `json:"crv"`
+            X   string `json:"x"`
+            Y   string `json:"y"`
+        } `json:"keys"`
+    }
+    if err := v.getJSON(ctx, jwksURL, &set); err != nil {
+        return fmt.Errorf("获取 JWKS 失败: %v", err)
+    }
+    keys := map[string]crypto.PublicKey{}
+    for _, k := range set.Keys {
+        switch {
+        case k.Kty == "RSA":
+            n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+            e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+            if err1 != nil || err2 != nil {
+                continue
+            }
+            keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+        case k.Kty == "EC" && k.Crv == "P-256":
+            x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+            y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+            if err1 != nil || err2 != nil {
+                continue
+            }
+            keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+        }
+    }
+    v.keys = keys
+    v.fetched = v.now()
+    return nil
+}
+
+func (v *oidcVerifier) getJSON(ctx context.Context, url string, out interface{}) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := v.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("%s 返回 %d", url, resp.StatusCode)
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
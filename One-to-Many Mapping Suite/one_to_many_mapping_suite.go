@@ -1,11 +1,15 @@
 package mapping
 
 import (
+    "context"
     "crypto/sha256"
     "encoding/hex"
     "encoding/json"
     "errors"
     "fmt"
+    "mime"
+    "path/filepath"
+    "strings"
     "time"
 )
 
@@ -20,11 +24,43 @@ type UserInfo struct {
     Role       string `json:"role"`
 }
 
-// BIMInitInfo 经过 IPFS 处理得到的 BIM 文件初始信息
+// BIMInitInfo 经过存储后端处理得到的 BIM 文件初始信息
 type BIMInitInfo struct {
     FileName string `json:"fileName"`
-    CID      string `json:"cid"` // 来自 IPFS
+    CID      string `json:"cid"` // 来自 IPFS；其他存储后端为按内容计算的 CID
     FileHash string `json:"fileHash"`
+    // StorageBackend 文件所在的存储后端（ipfs / s3 / fs），StorageURI 为主模型文件的地址，见 storage_backend.go
+    StorageBackend string `json:"storageBackend,omitempty"`
+    StorageURI     string `json:"storageUri,omitempty"`
+    // HashAlgorithm FileHash 使用的指纹算法，见 file_hashing.go
+    HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+    // ExternalRefs 对应的云端 CDE 条目（Forge URN、BIM 360 条目 ID），见 external_refs.go
+    ExternalRefs []ExternalRef `json:"externalRefs,omitempty"`
+    // Files 多文件交付时的全部文件（IFC 及链接的 DWG、点云、进度表等），
+    // FileName / CID / FileHash 为其中的主模型文件，见 ProcessInitialFiles
+    Files []FileEntry `json:"files,omitempty"`
+    // DetachedSignature 发起人对 Files 指纹的签名，见 SignDeliveryFiles
+    DetachedSignature string `json:"detachedSignature,omitempty"`
+    // Delta 只上传了相对上一版的差分时的差分信息，见 UploadDelta
+    Delta *DeltaRef `json:"delta,omitempty"`
+}
+
+// FileEntry 交付中的一个文件（字段与链码 FileEntry 对应）
+type FileEntry struct {
+    Name          string `json:"name"`
+    CID           string `json:"cid"`
+    Hash          string `json:"hash"`
+    HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+    Size          int64  `json:"size"`
+    MimeType      string `json:"mimeType,omitempty"`
+    URI           string `json:"uri,omitempty"` // 存储后端中的地址
+}
+
+// InputFile 待处理的一个交付文件
+type InputFile struct {
+    Name     string
+    Content  []byte
+    MimeType string // 为空时按扩展名推断
 }
 
 // Transaction 封装后的完整交易结构
@@ -33,12 +69,21 @@ type Transaction struct {
     Timestamp int64       `json:"timestamp"`
     User      UserInfo    `json:"user"`
     BIM       BIMInitInfo `json:"bim"`
+    // ProjectID 决定交易路由到哪个项目通道，为空时使用默认通道
+    ProjectID string `json:"projectId,omitempty"`
+
+    // Digest 规范化字节的 SHA-256，见 CanonicalBytes
+    Digest string `json:"digest,omitempty"`
+    // Signature 用户私钥对 Digest 的签名（Base64），见 SignTransaction
+    Signature string `json:"signature,omitempty"`
 }
 
 // NodeMapping 区块链节点映射结果
 type NodeMapping struct {
-    NodeURL string `json:"nodeUrl"`
-    OrgName string `json:"orgName"`
+    NodeURL string `json:"nodeUrl" yaml:"nodeUrl"`
+    OrgName string `json:"orgName" yaml:"orgName"`
+    // Channel 交易提交的通道；配置中为空时由项目或全局 channel 补全
+    Channel string `json:"channel,omitempty" yaml:"channel,omitempty"`
 }
 
 // -------------------------------
@@ -58,24 +103,151 @@ func SimulateIPFSUpload(fileContent []byte) (string, string) {
 // 1. 初始信息处理功能（调用 IPFS）
 // -------------------------------
 
-func ProcessInitialInfo(fileName string, content []byte) (*BIMInitInfo, error) {
-    cid, fileHash := SimulateIPFSUpload(content)
+// ProcessInitialInfo 经配置的存储后端（storage.backend，默认 IPFS）上传文件，
+// 并按配置的指纹算法（hashAlgorithm，默认 sha256）计算文件指纹。
+// 上传受 ctx 与 storage.uploadTimeout 限制，见 putFile。
+func ProcessInitialInfo(ctx context.Context, fileName string, content []byte) (*BIMInitInfo, error) {
+    return ProcessInitialInfoWith(ctx, fileName, content, CurrentConfig().HashAlgorithm)
+}
+
+// ProcessInitialInfoWith 使用指定指纹算法处理初始信息，algorithm 为空时使用 DefaultHashAlgorithm
+func ProcessInitialInfoWith(ctx context.Context, fileName string, content []byte, algorithm string) (*BIMInitInfo, error) {
+    if algorithm == "" {
+        algorithm = DefaultHashAlgorithm
+    }
+    fileHash, err := HashFile(algorithm, content)
+    if err != nil {
+        return nil, err
+    }
+    backend := CurrentStorageBackend()
+    obj, err := putFile(ctx, backend, fileName, content)
+    if err != nil {
+        return nil, err
+    }
 
     initInfo := BIMInitInfo{
-        FileName: fileName,
-        CID:      cid,
-        FileHash: fileHash,
+        FileName:       fileName,
+        CID:            obj.CID,
+        FileHash:       fileHash,
+        HashAlgorithm:  algorithm,
+        StorageBackend: backend.Type(),
+        StorageURI:     obj.URI,
     }
 
     return &initInfo, nil
 }
 
+// maxDeliveryFiles 单次交付的文件数上限，与链码 maxFiles 一致
+const maxDeliveryFiles = 64
+
+// bimMimeTypes 常见 BIM 交付文件的 MIME 类型，mime 包未收录
+var bimMimeTypes = map[string]string{
+    ".ifc":    "application/x-step",
+    ".ifcxml": "application/xml",
+    ".ifczip": "application/zip",
+    ".dwg":    "image/vnd.dwg",
+    ".dxf":    "image/vnd.dxf",
+    ".rvt":    "application/octet-stream",
+    ".nwd":    "application/octet-stream",
+    ".e57":    "application/octet-stream",
+    ".las":    "application/vnd.las",
+    ".laz":    "application/vnd.laszip",
+    ".xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+    ".csv":    "text/csv",
+    ".pdf":    "application/pdf",
+}
+
+// ProcessInitialFiles 处理多文件交付，指纹算法同 ProcessInitialInfo
+func ProcessInitialFiles(ctx context.Context, files []InputFile) (*BIMInitInfo, error) {
+    return ProcessInitialFilesWith(ctx, files, CurrentConfig().HashAlgorithm)
+}
+
+// ProcessInitialFilesWith 先校验并计算全部文件的指纹，全部成功后才逐个上传，
+// 任何一个文件不合格时不上传任何文件。主模型文件取第一个 .ifc 文件，没有时取第一个文件。
+// ctx 取消后不再计算指纹或上传后续文件，已上传的文件留在存储中。
+func ProcessInitialFilesWith(ctx context.Context, files []InputFile, algorithm string) (*BIMInitInfo, error) {
+    if len(files) == 0 {
+        return nil, errors.New("交付中没有文件")
+    }
+    if len(files) > maxDeliveryFiles {
+        return nil, fmt.Errorf("交付文件过多: %d（上限 %d）", len(files), maxDeliveryFiles)
+    }
+    if algorithm == "" {
+        algorithm = DefaultHashAlgorithm
+    }
+
+    entries := make([]FileEntry, len(files))
+    names := make(map[string]bool, len(files))
+    primary := -1
+    for i, f := range files {
+        if f.Name == "" {
+            return nil, fmt.Errorf("第 %d 个文件缺少文件名", i+1)
+        }
+        if names[f.Name] {
+            return nil, fmt.Errorf("文件名重复: %s", f.Name)
+        }
+        names[f.Name] = true
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        fileHash, err := HashFile(algorithm, f.Content)
+        if err != nil {
+            return nil, fmt.Errorf("计算 %s 的指纹失败: %v", f.Name, err)
+        }
+        ext := strings.ToLower(filepath.Ext(f.Name))
+        mimeType := f.MimeType
+        if mimeType == "" {
+            mimeType = bimMimeTypes[ext]
+        }
+        if mimeType == "" {
+            mimeType = mime.TypeByExtension(ext)
+        }
+        entries[i] = FileEntry{
+            Name:          f.Name,
+            Hash:          fileHash,
+            HashAlgorithm: algorithm,
+            Size:          int64(len(f.Content)),
+            MimeType:      mimeType,
+        }
+        if primary < 0 && ext == ".ifc" {
+            primary = i
+        }
+    }
+    if primary < 0 {
+        primary = 0
+    }
+
+    backend := CurrentStorageBackend()
+    for i, f := range files {
+        obj, err := putFile(ctx, backend, f.Name, f.Content)
+        if err != nil {
+            return nil, fmt.Errorf("上传 %s 失败: %v", f.Name, err)
+        }
+        entries[i].CID = obj.CID
+        entries[i].URI = obj.URI
+    }
+
+    primaryFile := entries[primary]
+    return &BIMInitInfo{
+        FileName:       primaryFile.Name,
+        CID:            primaryFile.CID,
+        FileHash:       primaryFile.Hash,
+        HashAlgorithm:  algorithm,
+        StorageBackend: backend.Type(),
+        StorageURI:     primaryFile.URI,
+        Files:          entries,
+    }, nil
+}
+
 // -------------------------------
 // 2. 获取用户信息功能
 // -------------------------------
 
-// GetUserInfo 模拟从企业系统获取用户信息
-func GetUserInfo(userID string) (*UserInfo, error) {
+// GetUserInfo 模拟从企业系统获取用户信息；对接实际目录服务时查询应遵循 ctx 的截止时间
+func GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
     // 模拟部门映射规则
     mapping := map[string]string{
         "1001": "architecture",
@@ -101,17 +273,49 @@ func GetUserInfo(userID string) (*UserInfo, error) {
 // 3. 交易封装功能（用户信息 + 初始信息）
 // -------------------------------
 
-func PackageTransaction(user *UserInfo, bim *BIMInitInfo) (*Transaction, error) {
+// PackageTransaction 封装交易并计算规范化摘要；需要用户签名时再调用 SignTransaction
+func PackageTransaction(ctx context.Context, user *UserInfo, bim *BIMInitInfo) (*Transaction, error) {
+    return PackageProjectTransaction(ctx, user, bim, "")
+}
+
+// PackageProjectTransaction 封装属于 projectID 的交易，ProjectID 参与摘要计算。
+// 启用了外部引用解析（见 UseExternalRefResolver）时先校验 bim.ExternalRefs；
+// 启用了配额限制（见 UseQuotaLimiter）时再扣减配额，超出时返回 *QuotaExceededError。
+// 外部引用的解析受 ctx 与 externalRefTimeout 中较早的截止时间限制。
+func PackageProjectTransaction(ctx context.Context, user *UserInfo, bim *BIMInitInfo, projectID string) (*Transaction, error) {
     if user == nil || bim == nil {
         return nil, errors.New("用户信息或 BIM 信息为空")
     }
+    if resolver := CurrentExternalRefResolver(); resolver != nil && len(bim.ExternalRefs) > 0 {
+        resolveCtx, cancel := context.WithTimeout(ctx, externalRefTimeout)
+        err := ResolveExternalRefs(resolveCtx, resolver, bim.ExternalRefs)
+        cancel()
+        if err != nil {
+            return nil, err
+        }
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if limiter := CurrentQuotaLimiter(); limiter != nil {
+        if err := limiter.Reserve(user); err != nil {
+            return nil, err
+        }
+    }
 
     tx := Transaction{
         TxID:      fmt.Sprintf("TX-%d", time.Now().UnixNano()),
         Timestamp: time.Now().Unix(),
         User:      *user,
         BIM:       *bim,
+        ProjectID: projectID,
+    }
+    digest, err := tx.ComputeDigest()
+    if err != nil {
+        return nil, err
     }
+    tx.Digest = digest
+    txLog(tx.TxID).Debug("交易已封装", "userId", user.UserID, "cid", bim.CID, "digest", digest)
     return &tx, nil
 }
 
@@ -119,55 +323,80 @@ func PackageTransaction(user *UserInfo, bim *BIMInitInfo) (*Transaction, error)
 // 4. 映射到区块链节点功能
 // -------------------------------
 
-// MapToBlockchainNode 根据部门选择对应区块链节点
+// MapToBlockchainNode 根据部门选择对应区块链节点（节点表来自当前配置，见 UseConfig），
+// 通道为全局默认通道
 func MapToBlockchainNode(department string) (*NodeMapping, error) {
-    nodeMap := map[string]NodeMapping{
-        "architecture": {NodeURL: "grpc://node1.arch.example.com:7051", OrgName: "Org1"},
-        "structure":    {NodeURL: "grpc://node2.struct.example.com:7051", OrgName: "Org2"},
-        "me":           {NodeURL: "grpc://node3.me.example.com:7051", OrgName: "Org3"},
-        "management":   {NodeURL: "grpc://node4.mgmt.example.com:7051", OrgName: "Org4"},
-    }
+    return MapToProjectNode(department, "")
+}
 
-    node, ok := nodeMap[department]
+// MapToProjectNode 根据 (部门, 项目) 选择通道与节点：
+// 项目在 projects 中配置了该部门时使用项目节点，否则沿用全局节点表；
+// 通道优先级为 节点 channel -> 项目 channel -> 全局 channel。projectID 为空时只查全局节点表。
+// 启用了连接管理器（见 UseConnectionManager）时，不可用的节点由同组织的可用节点代替。
+func MapToProjectNode(department string, projectID string) (*NodeMapping, error) {
+    cfg := CurrentConfig()
+    channel := cfg.Channel
+    node, ok := cfg.Nodes[department]
+    if projectID != "" {
+        project, found := cfg.Projects[projectID]
+        if !found {
+            Logger().Warn("项目未配置通道", "projectId", projectID)
+            return nil, fmt.Errorf("项目 %s 未配置通道", projectID)
+        }
+        if project.Channel != "" {
+            channel = project.Channel
+        }
+        if n, found := project.Nodes[department]; found {
+            node, ok = n, true
+        }
+    }
     if !ok {
+        Logger().Warn("部门未映射至任何区块链节点", "department", department, "projectId", projectID)
         return nil, errors.New("部门未映射至任何区块链节点")
     }
-    return &node, nil
+    if node.Channel == "" {
+        node.Channel = channel
+    }
+    return avoidUnhealthy(cfg, projectID, &node)
 }
 
 // -------------------------------
 // 工具包入口函数：完整一对多映射流程
 // -------------------------------
 
-func RunOneToManyMapping(fileName string, fileContent []byte, userID string) (string, error) {
+// RunOneToManyMapping 执行 初始信息处理 -> 用户信息 -> 交易封装 -> 节点映射，返回交易回执。
+// 本函数只模拟发送，回执的 UpdateID 与 BlockNumber 为空；实际提交请使用 RoutedSubmitter.SubmitForReceipt。
+// ctx 取消或超时后在当前步骤返回，不再执行后续步骤。
+func RunOneToManyMapping(ctx context.Context, fileName string, fileContent []byte, userID string) (*Receipt, error) {
     // 1. 处理 BIM 初始信息
-    bimInfo, err := ProcessInitialInfo(fileName, fileContent)
+    bimInfo, err := ProcessInitialInfo(ctx, fileName, fileContent)
     if err != nil {
-        return "", err
+        return nil, err
     }
 
     // 2. 获取用户信息
-    user, err := GetUserInfo(userID)
+    user, err := GetUserInfo(ctx, userID)
     if err != nil {
-        return "", err
+        return nil, err
     }
 
     // 3. 封装交易
-    tx, err := PackageTransaction(user, bimInfo)
+    tx, err := PackageTransaction(ctx, user, bimInfo)
     if err != nil {
-        return "", err
+        return nil, err
     }
 
     // 4. 映射节点
     node, err := MapToBlockchainNode(user.Department)
     if err != nil {
-        return "", err
+        txLog(tx.TxID).Error("节点映射失败", "department", user.Department, "err", err)
+        return nil, err
     }
+    txLog(tx.TxID).Info("交易已映射到节点", "node", node.NodeURL, "org", node.OrgName, "channel", node.Channel)
 
     // 模拟把交易发往区块链
-    payload, _ := json.MarshalIndent(tx, "", "  ")
-
-    result := fmt.Sprintf("发送至节点: %s (组织: %s)\n交易内容:\n%s", node.NodeURL, node.OrgName, string(payload))
+    payload, _ := json.Marshal(tx)
+    txLog(tx.TxID).Debug("交易内容", "payload", string(payload))
 
-    return result, nil
+    return NewReceipt(tx, node), nil
 }
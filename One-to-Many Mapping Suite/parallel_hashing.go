@@ -0,0 +1,320 @@
+package mapping
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "io"
+    "runtime"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  并行分块指纹（大模型文件）
+// -------------------------------
+
+// DefaultHashBlockSize 分块指纹的默认块大小（4 MiB）
+const DefaultHashBlockSize = 4 << 20
+
+// Merkle 树的域分隔前缀：叶子、内部节点与根各用一个，
+// 使叶子指纹不能冒充内部节点，也不能把某层节点拼接成另一个文件
+const (
+    merkleLeafPrefix = 0x00
+    merkleNodePrefix = 0x01
+    merkleRootPrefix = 0x02
+)
+
+// BlockManifest 分块指纹清单：各块指纹及其 Merkle 根
+type BlockManifest struct {
+    Algorithm string   `json:"algorithm"` // 块与内部节点使用的摘要算法
+    BlockSize int64    `json:"blockSize"`
+    Size      int64    `json:"size"`
+    Blocks    []string `json:"blocks"`   // 各块叶子指纹 hash(0x00||块)（十六进制），按块序
+    RootHash  string   `json:"rootHash"` // hash(0x02||文件大小||树顶)，内部节点为 hash(0x01||左||右)，奇数层末尾节点直接上移
+}
+
+// ParallelHasher 用固定数量的工作协程并行计算各块指纹，
+// 每块完成后立即向上合并 Merkle 节点，最后一块完成时树顶也已算出。
+// 根绑定了文件大小，且叶子与内部节点带不同前缀，因此 sha256-tree 与整文件 sha256 不同，
+// 即使文件只有一块。
+type ParallelHasher struct {
+    // Algorithm 摘要算法，为空时使用 sha256
+    Algorithm string
+    // BlockSize 块大小，<= 0 时使用 DefaultHashBlockSize
+    BlockSize int64
+    // Workers 工作协程数，<= 0 时使用 GOMAXPROCS
+    Workers int
+}
+
+// NewParallelHasher 创建使用默认块大小与 GOMAXPROCS 个工作协程的分块指纹器
+func NewParallelHasher(algorithm string) *ParallelHasher {
+    return &ParallelHasher{Algorithm: algorithm}
+}
+
+// blockResult 单块的计算结果
+type blockResult struct {
+    index int
+    sum   []byte
+    err   error
+}
+
+// Hash 并行计算 r 中前 size 字节的分块指纹清单。
+// 每个工作协程只持有一个块的缓冲，内存占用约为 Workers × BlockSize。
+func (p *ParallelHasher) Hash(r io.ReaderAt, size int64) (*BlockManifest, error) {
+    algorithm := p.Algorithm
+    if algorithm == "" {
+        algorithm = HashSHA256
+    }
+    if _, err := NewFileHash(algorithm); err != nil {
+        return nil, err
+    }
+    blockSize := p.BlockSize
+    if blockSize <= 0 {
+        blockSize = DefaultHashBlockSize
+    }
+    workers := p.Workers
+    if workers <= 0 {
+        workers = runtime.GOMAXPROCS(0)
+    }
+
+    count := int((size + blockSize - 1) / blockSize)
+    if count == 0 {
+        count = 1 // 空文件按一个空块计算
+    }
+    if workers > count {
+        workers = count
+    }
+
+    jobs := make(chan int)
+    results := make(chan blockResult)
+    done := make(chan struct{})
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            h, _ := NewFileHash(algorithm)
+            buf := make([]byte, blockSize)
+            for i := range jobs {
+                off := int64(i) * blockSize
+                n := blockSize
+                if off+n > size {
+                    n = size - off
+                }
+                res := blockResult{index: i}
+                if _, err := r.ReadAt(buf[:n], off); err != nil && err != io.EOF {
+                    res.err = fmt.Errorf("读取第 %d 块失败: %v", i, err)
+                } else {
+                    h.Reset()
+                    h.Write([]byte{merkleLeafPrefix})
+                    h.Write(buf[:n])
+                    res.sum = h.Sum(nil)
+                }
+                select {
+                case results <- res:
+                case <-done:
+                    return
+                }
+            }
+        }()
+    }
+    go func() {
+        defer close(jobs)
+        for i := 0; i < count; i++ {
+            select {
+            case jobs <- i:
+            case <-done:
+                return
+            }
+        }
+    }()
+    go func() {
+        wg.Wait()
+        close(results)
+    }()
+
+    m := &BlockManifest{Algorithm: algorithm, BlockSize: blockSize, Size: size, Blocks: make([]string, count)}
+    tree := newMerkleBuilder(hashAlgorithms[algorithm], count)
+    for res := range results {
+        if res.err != nil {
+            close(done)
+            return nil, res.err
+        }
+        m.Blocks[res.index] = hex.EncodeToString(res.sum)
+        tree.set(0, res.index, res.sum)
+    }
+    m.RootHash = hex.EncodeToString(tree.root(size))
+    return m, nil
+}
+
+// HashBytes 并行计算内存中内容的分块指纹清单
+func (p *ParallelHasher) HashBytes(content []byte) (*BlockManifest, error) {
+    return p.Hash(bytes.NewReader(content), int64(len(content)))
+}
+
+// merkleBuilder 叶子可按任意顺序到达；兄弟节点都就绪时立即计算父节点，
+// 奇数层的末尾节点不复制，原样上移一层
+type merkleBuilder struct {
+    newHash func() hash.Hash
+    levels  [][][]byte
+}
+
+func newMerkleBuilder(newHash func() hash.Hash, leaves int) *merkleBuilder {
+    b := &merkleBuilder{newHash: newHash}
+    for n := leaves; ; n = (n + 1) / 2 {
+        b.levels = append(b.levels, make([][]byte, n))
+        if n == 1 {
+            break
+        }
+    }
+    return b
+}
+
+// set 记录第 level 层第 i 个节点，并在兄弟节点就绪时向上合并
+func (b *merkleBuilder) set(level, i int, sum []byte) {
+    b.levels[level][i] = sum
+    if level == len(b.levels)-1 {
+        return
+    }
+    left, right := i&^1, i|1
+    nodes := b.levels[level]
+    if right == len(nodes) {
+        b.set(level+1, i/2, sum)
+        return
+    }
+    if nodes[left] == nil || nodes[right] == nil {
+        return
+    }
+    h := b.newHash()
+    h.Write([]byte{merkleNodePrefix})
+    h.Write(nodes[left])
+    h.Write(nodes[right])
+    b.set(level+1, i/2, h.Sum(nil))
+}
+
+// root 返回绑定文件大小的根 hash(0x02||大小（8 字节大端）||树顶)
+func (b *merkleBuilder) root(size int64) []byte {
+    var prefix [9]byte
+    prefix[0] = merkleRootPrefix
+    binary.BigEndian.PutUint64(prefix[1:], uint64(size))
+    h := b.newHash()
+    h.Write(prefix[:])
+    h.Write(b.levels[len(b.levels)-1][0])
+    return h.Sum(nil)
+}
+
+// treeHash 以 hash.Hash 形式顺序计算 sha256-tree，供 HashReader 等流式场景使用，
+// 结果与 ParallelHasher 相同
+type treeHash struct {
+    block  hash.Hash // 已写入叶子前缀
+    n      int64     // 当前块已写入的字节数
+    size   int64
+    leaves [][]byte
+}
+
+func newTreeHash() hash.Hash {
+    t := &treeHash{block: sha256.New()}
+    t.block.Write([]byte{merkleLeafPrefix})
+    return t
+}
+
+func (t *treeHash) Write(p []byte) (int, error) {
+    written := len(p)
+    for len(p) > 0 {
+        chunk := int64(len(p))
+        if room := DefaultHashBlockSize - t.n; chunk > room {
+            chunk = room
+        }
+        t.block.Write(p[:chunk])
+        t.n += chunk
+        t.size += chunk
+        p = p[chunk:]
+        if t.n == DefaultHashBlockSize {
+            t.leaves = append(t.leaves, t.block.Sum(nil))
+            t.block.Reset()
+            t.block.Write([]byte{merkleLeafPrefix})
+            t.n = 0
+        }
+    }
+    return written, nil
+}
+
+func (t *treeHash) Sum(b []byte) []byte {
+    leaves := t.leaves
+    if t.n > 0 || len(leaves) == 0 {
+        leaves = append(leaves[:len(leaves):len(leaves)], t.block.Sum(nil))
+    }
+    tree := newMerkleBuilder(sha256.New, len(leaves))
+    for i, leaf := range leaves {
+        tree.set(0, i, leaf)
+    }
+    return append(b, tree.root(t.size)...)
+}
+
+func (t *treeHash) Reset() {
+    t.block.Reset()
+    t.block.Write([]byte{merkleLeafPrefix})
+    t.n = 0
+    t.size = 0
+    t.leaves = nil
+}
+
+func (t *treeHash) Size() int      { return t.block.Size() }
+func (t *treeHash) BlockSize() int { return t.block.BlockSize() }
+
+// -------------------------------
+//  指纹吞吐量测量
+// -------------------------------
+
+// HashBenchmark 顺序与并行计算同一内容的耗时对比
+type HashBenchmark struct {
+    Algorithm  string        `json:"algorithm"`
+    Size       int64         `json:"size"`
+    Workers    int           `json:"workers"`
+    Sequential time.Duration `json:"sequential"` // HashFile 整文件顺序计算
+    Parallel   time.Duration `json:"parallel"`   // ParallelHasher 分块并行计算
+}
+
+// SequentialMBps 顺序计算吞吐量（MB/s）
+func (b HashBenchmark) SequentialMBps() float64 {
+    return mbps(b.Size, b.Sequential)
+}
+
+// ParallelMBps 并行计算吞吐量（MB/s）
+func (b HashBenchmark) ParallelMBps() float64 {
+    return mbps(b.Size, b.Parallel)
+}
+
+func mbps(size int64, d time.Duration) float64 {
+    if d <= 0 {
+        return 0
+    }
+    return float64(size) / 1e6 / d.Seconds()
+}
+
+// MeasureHashing 对 content 分别做顺序与并行指纹计算并记录耗时，
+// 用于在部署机器上确定 Workers 与块大小，例如：
+//
+//	b, _ := MeasureHashing(HashSHA256, content, 8)
+//	Logger().Info("指纹吞吐量", "sequential", b.SequentialMBps(), "parallel", b.ParallelMBps())
+func MeasureHashing(algorithm string, content []byte, workers int) (HashBenchmark, error) {
+    b := HashBenchmark{Algorithm: algorithm, Size: int64(len(content)), Workers: workers}
+
+    start := time.Now()
+    if _, err := HashFile(algorithm, content); err != nil {
+        return b, err
+    }
+    b.Sequential = time.Since(start)
+
+    start = time.Now()
+    p := &ParallelHasher{Algorithm: algorithm, Workers: workers}
+    if _, err := p.HashBytes(content); err != nil {
+        return b, err
+    }
+    b.Parallel = time.Since(start)
+    return b, nil
+}
@@ -0,0 +1,165 @@
+package mapping
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "testing"
+)
+
+// patternContent 生成 size 字节的确定性内容
+func patternContent(size int) []byte {
+    content := make([]byte, size)
+    for i := range content {
+        content[i] = byte(i*31 + i/7)
+    }
+    return content
+}
+
+func sha256Of(parts ...[]byte) []byte {
+    h := sha256.New()
+    for _, p := range parts {
+        h.Write(p)
+    }
+    return h.Sum(nil)
+}
+
+func TestParallelHasherRoot(t *testing.T) {
+    // 3 个叶子：前两个合并，第三个直接上移
+    content := []byte("aaaabbbbcc")
+    m, err := (&ParallelHasher{BlockSize: 4, Workers: 2}).HashBytes(content)
+    if err != nil {
+        t.Fatal(err)
+    }
+    l0 := sha256Of([]byte{merkleLeafPrefix}, []byte("aaaa"))
+    l1 := sha256Of([]byte{merkleLeafPrefix}, []byte("bbbb"))
+    l2 := sha256Of([]byte{merkleLeafPrefix}, []byte("cc"))
+    top := sha256Of([]byte{merkleNodePrefix}, sha256Of([]byte{merkleNodePrefix}, l0, l1), l2)
+    var size [8]byte
+    binary.BigEndian.PutUint64(size[:], uint64(len(content)))
+    want := hex.EncodeToString(sha256Of([]byte{merkleRootPrefix}, size[:], top))
+
+    if m.RootHash != want {
+        t.Fatalf("RootHash = %s, want %s", m.RootHash, want)
+    }
+    for i, leaf := range [][]byte{l0, l1, l2} {
+        if m.Blocks[i] != hex.EncodeToString(leaf) {
+            t.Errorf("Blocks[%d] = %s, want %s", i, m.Blocks[i], hex.EncodeToString(leaf))
+        }
+    }
+}
+
+func TestParallelHasherDistinguishesTrees(t *testing.T) {
+    twoBlocks := patternContent(128)
+    tests := []struct {
+        name      string
+        blockSize int64
+        a, b      []byte
+    }{
+        // 不复制奇数层末尾节点：[x y z] 与 [x y z z] 的根不同
+        {"duplicated last block", 4, []byte("xxxxyyyyzzzz"), []byte("xxxxyyyyzzzzzzzz")},
+        // 叶子带前缀：内容为两个块指纹拼接的单块文件不能冒充两块文件
+        {"interior node as content", 64, twoBlocks, append(sha256Of(twoBlocks[:64]), sha256Of(twoBlocks[64:])...)},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            hasher := &ParallelHasher{BlockSize: tt.blockSize, Workers: 2}
+            ma, err := hasher.HashBytes(tt.a)
+            if err != nil {
+                t.Fatal(err)
+            }
+            mb, err := hasher.HashBytes(tt.b)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if ma.RootHash == mb.RootHash {
+                t.Fatalf("both contents hash to %s", ma.RootHash)
+            }
+        })
+    }
+
+    // 单块文件的根也不等于整文件 sha256
+    single, err := HashFile(HashSHA256Tree, []byte("model"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if plain, _ := HashFile(HashSHA256, []byte("model")); single == plain {
+        t.Fatalf("sha256-tree of one block equals sha256: %s", single)
+    }
+}
+
+func TestTreeHashMatchesParallelHasher(t *testing.T) {
+    for _, size := range []int{0, 1, DefaultHashBlockSize, DefaultHashBlockSize + 1, 3*DefaultHashBlockSize + 5} {
+        t.Run(fmt.Sprint(size), func(t *testing.T) {
+            content := patternContent(size)
+            m, err := NewParallelHasher(HashSHA256).HashBytes(content)
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            // 分多次写入，跨越块边界
+            h := newTreeHash()
+            for rest := content; len(rest) > 0; {
+                n := 1 << 20
+                if n > len(rest) {
+                    n = len(rest)
+                }
+                h.Write(rest[:n])
+                rest = rest[n:]
+            }
+            if got := hex.EncodeToString(h.Sum(nil)); got != m.RootHash {
+                t.Fatalf("treeHash = %s, ParallelHasher = %s", got, m.RootHash)
+            }
+
+            h.Reset()
+            h.Write(content)
+            if got := hex.EncodeToString(h.Sum(nil)); got != m.RootHash {
+                t.Fatalf("treeHash after Reset = %s, ParallelHasher = %s", got, m.RootHash)
+            }
+        })
+    }
+}
+
+// benchmarkContentSize 基准测试内容大小（64 MiB，16 个默认块）
+const benchmarkContentSize = 64 << 20
+
+func BenchmarkHashFileSHA256(b *testing.B) {
+    content := patternContent(benchmarkContentSize)
+    b.SetBytes(int64(len(content)))
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if _, err := HashFile(HashSHA256, content); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkParallelHasher(b *testing.B) {
+    content := patternContent(benchmarkContentSize)
+    for _, workers := range []int{1, 2, 4, 8} {
+        b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+            hasher := &ParallelHasher{Algorithm: HashSHA256, Workers: workers}
+            b.SetBytes(int64(len(content)))
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                if _, err := hasher.Hash(bytes.NewReader(content), int64(len(content))); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
+
+func BenchmarkTreeHash(b *testing.B) {
+    content := patternContent(benchmarkContentSize)
+    h := newTreeHash()
+    b.SetBytes(int64(len(content)))
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        h.Reset()
+        h.Write(content)
+        h.Sum(nil)
+    }
+}
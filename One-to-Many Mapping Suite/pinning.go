@@ -0,0 +1,372 @@
+package mapping
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  IPFS 固定（pin）策略与垃圾回收协调
+// -------------------------------
+
+// PinningConfig IPFS Cluster 固定策略
+type PinningConfig struct {
+    // ClusterURL IPFS Cluster REST API 地址，为空时不启用固定管理
+    ClusterURL string `yaml:"clusterUrl"`
+    // APIToken 可写为 secret://<name>，由密钥后端解析
+    APIToken string `yaml:"apiToken"`
+    // ReplicationMin / ReplicationMax 每个 CID 的副本数，0 表示使用集群默认值
+    ReplicationMin int `yaml:"replicationMin"`
+    ReplicationMax int `yaml:"replicationMax"`
+    // Retention 更新被驳回或释放后保留文件的时长，默认 30 天
+    Retention time.Duration `yaml:"retention"`
+}
+
+// Enabled 是否配置了集群地址
+func (p PinningConfig) Enabled() bool {
+    return p.ClusterURL != ""
+}
+
+func (p PinningConfig) validate() []string {
+    var problems []string
+    if p.ClusterURL != "" {
+        if err := checkEndpoint(p.ClusterURL, "http", "https"); err != nil {
+            problems = append(problems, "pinning.clusterUrl: "+err.Error())
+        }
+    }
+    if p.ReplicationMin < 0 || p.ReplicationMax < 0 {
+        problems = append(problems, "pinning.replicationMin/replicationMax 不能为负数")
+    }
+    if p.ReplicationMax > 0 && p.ReplicationMin > p.ReplicationMax {
+        problems = append(problems, "pinning.replicationMin 不能大于 replicationMax")
+    }
+    if p.Retention < 0 {
+        problems = append(problems, "pinning.retention 不能为负数")
+    }
+    return problems
+}
+
+// PinCluster 固定服务
+type PinCluster interface {
+    Pin(ctx context.Context, cid, name string) error
+    Unpin(ctx context.Context, cid string) error
+}
+
+// ClusterPinAPI 调用 IPFS Cluster REST API：
+//
+//	POST   {clusterUrl}/pins/{cid}?name=&replication-min=&replication-max=
+//	DELETE {clusterUrl}/pins/{cid}
+type ClusterPinAPI struct {
+    Config PinningConfig
+    Client *http.Client
+}
+
+// Pin 在集群中固定 CID，重复固定只更新名称与副本数
+func (c *ClusterPinAPI) Pin(ctx context.Context, cid, name string) error {
+    q := url.Values{}
+    if name != "" {
+        q.Set("name", name)
+    }
+    if c.Config.ReplicationMin > 0 {
+        q.Set("replication-min", strconv.Itoa(c.Config.ReplicationMin))
+    }
+    if c.Config.ReplicationMax > 0 {
+        q.Set("replication-max", strconv.Itoa(c.Config.ReplicationMax))
+    }
+    return c.do(ctx, http.MethodPost, cid, q)
+}
+
+// Unpin 取消固定；集群中不存在的 CID 视为成功
+func (c *ClusterPinAPI) Unpin(ctx context.Context, cid string) error {
+    return c.do(ctx, http.MethodDelete, cid, nil)
+}
+
+func (c *ClusterPinAPI) do(ctx context.Context, method, cid string, q url.Values) error {
+    target := strings.TrimSuffix(c.Config.ClusterURL, "/") + "/pins/" + url.PathEscape(cid)
+    if len(q) > 0 {
+        target += "?" + q.Encode()
+    }
+    req, err := http.NewRequestWithContext(ctx, method, target, nil)
+    if err != nil {
+        return err
+    }
+    if c.Config.APIToken != "" {
+        req.Header.Set("Authorization", "Bearer "+c.Config.APIToken)
+    }
+    resp, err := httpClient(c.Client).Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if method == http.MethodDelete && resp.StatusCode == http.StatusNotFound {
+        return nil
+    }
+    if resp.StatusCode/100 != 2 {
+        var body struct {
+            Message string `json:"message"`
+        }
+        json.NewDecoder(resp.Body).Decode(&body)
+        return fmt.Errorf("IPFS Cluster 返回 %d: %s", resp.StatusCode, body.Message)
+    }
+    return nil
+}
+
+// PinnedUpdate 一个更新引用的 CID 及其固定状态
+type PinnedUpdate struct {
+    UpdateID   string    `json:"updateId"`
+    ModelID    string    `json:"modelId"`
+    CIDs       []string  `json:"cids"`
+    ReleasedAt time.Time `json:"releasedAt,omitempty"` // 零值表示仍被引用
+}
+
+// PinManager 让 IPFS 存储随链上更新的生命周期变化：未被驳回的更新引用的文件
+// （Files 与 Attachments）固定在集群中；更新被驳回或经 Release 释放后，超过保留期
+// 且不再被其他更新引用的 CID 取消固定，交由 IPFS 垃圾回收。
+//
+// 与 ReminderScheduler 一样由事件监听服务调用 HandleEvent，服务重启后重放事件即可
+// 恢复状态；固定与取消固定在 Tick 中执行，失败的操作下次扫描时重试。
+type PinManager struct {
+    Cluster   PinCluster
+    Retention time.Duration // 默认 30 天
+    Interval  time.Duration // 扫描间隔，默认 10 分钟
+
+    // Now 当前时间，默认 time.Now
+    Now func() time.Time
+
+    mu      sync.Mutex
+    updates map[string]*PinnedUpdate
+    pinned  map[string]bool   // 已在集群中固定的 CID
+    names   map[string]string // CID -> 固定名称（首个引用它的文件名）
+
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+// NewPinManager 按 cfg 创建固定管理器
+func NewPinManager(cluster PinCluster, cfg PinningConfig) *PinManager {
+    retention := cfg.Retention
+    if retention == 0 {
+        retention = 30 * 24 * time.Hour
+    }
+    return &PinManager{
+        Cluster:   cluster,
+        Retention: retention,
+        Interval:  10 * time.Minute,
+        Now:       time.Now,
+        updates:   map[string]*PinnedUpdate{},
+        pinned:    map[string]bool{},
+        names:     map[string]string{},
+    }
+}
+
+// Start 启动定期扫描，直到 ctx 取消或调用 Stop
+func (m *PinManager) Start(ctx context.Context) {
+    ctx, m.cancel = context.WithCancel(ctx)
+    m.wg.Add(1)
+    go func() {
+        defer m.wg.Done()
+        ticker := time.NewTicker(m.Interval)
+        defer ticker.Stop()
+        m.Tick(ctx)
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                m.Tick(ctx)
+            }
+        }
+    }()
+}
+
+// Stop 停止扫描
+func (m *PinManager) Stop() {
+    if m.cancel != nil {
+        m.cancel()
+    }
+    m.wg.Wait()
+}
+
+// HandleEvent 新更新登记其 CID；驳回事件按审批时间释放更新；其他事件忽略
+func (m *PinManager) HandleEvent(eventName string, txID string, payload []byte) error {
+    switch eventName {
+    case EventBIMInit:
+        var u LedgerUpdate
+        if err := json.Unmarshal(payload, &u); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        m.track(&u)
+    case EventBIMReject:
+        var a LedgerApproval
+        if err := json.Unmarshal(payload, &a); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        at, err := time.Parse(time.RFC3339, a.Timestamp)
+        if err != nil {
+            at = m.Now()
+        }
+        m.Release(a.UpdateID, at)
+    }
+    return nil
+}
+
+// track 登记更新引用的 CID
+func (m *PinManager) track(u *LedgerUpdate) {
+    p := &PinnedUpdate{UpdateID: u.UpdateID, ModelID: u.ModelID}
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for _, f := range u.Files {
+        p.CIDs = m.addCID(p.CIDs, f.CID, f.Name)
+    }
+    for _, a := range u.Attachments {
+        p.CIDs = m.addCID(p.CIDs, a.CID, a.Name)
+    }
+    m.updates[u.UpdateID] = p
+}
+
+func (m *PinManager) addCID(cids []string, cid, name string) []string {
+    if cid == "" {
+        return cids
+    }
+    for _, c := range cids {
+        if c == cid {
+            return cids
+        }
+    }
+    if _, ok := m.names[cid]; !ok {
+        m.names[cid] = name
+    }
+    return append(cids, cid)
+}
+
+// Release 释放更新引用的文件，保留期从 at 起算；用于被撤回或过期等不会产生驳回事件的更新。
+// 未登记的更新忽略，重复释放保留最早的时间。
+func (m *PinManager) Release(updateID string, at time.Time) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    p, ok := m.updates[updateID]
+    if !ok {
+        return
+    }
+    if p.ReleasedAt.IsZero() || at.Before(p.ReleasedAt) {
+        p.ReleasedAt = at
+    }
+}
+
+// Tick 固定尚未固定的在用 CID，并取消固定保留期已过且无人引用的 CID；通常由 Start 定期调用
+func (m *PinManager) Tick(ctx context.Context) {
+    now := m.Now()
+    m.mu.Lock()
+    live := map[string]bool{}
+    expired := map[string]bool{}
+    for _, p := range m.updates {
+        for _, cid := range p.CIDs {
+            switch {
+            case p.ReleasedAt.IsZero():
+                live[cid] = true
+            case now.Sub(p.ReleasedAt) >= m.Retention:
+                expired[cid] = true
+            default:
+                // 保留期内既不新固定，也不取消固定
+            }
+        }
+    }
+    var pin, unpin []string
+    for cid := range live {
+        if !m.pinned[cid] {
+            pin = append(pin, cid)
+        }
+    }
+    for cid := range expired {
+        if !live[cid] && !m.referencedInRetention(cid, now) {
+            unpin = append(unpin, cid)
+        }
+    }
+    names := make(map[string]string, len(pin))
+    for _, cid := range pin {
+        names[cid] = m.names[cid]
+    }
+    m.mu.Unlock()
+
+    sort.Strings(pin)
+    sort.Strings(unpin)
+    log := Logger().With("component", "pinning")
+    for _, cid := range pin {
+        if err := m.Cluster.Pin(ctx, cid, names[cid]); err != nil {
+            log.Error("固定 CID 失败", "cid", cid, "err", err)
+            continue
+        }
+        m.mu.Lock()
+        m.pinned[cid] = true
+        m.mu.Unlock()
+        log.Info("已固定 CID", "cid", cid)
+    }
+    for _, cid := range unpin {
+        if err := m.Cluster.Unpin(ctx, cid); err != nil {
+            log.Error("取消固定 CID 失败", "cid", cid, "err", err)
+            continue
+        }
+        m.forget(cid)
+        log.Info("已取消固定 CID", "cid", cid)
+    }
+}
+
+// referencedInRetention 是否还有处于保留期内的已释放更新引用 cid；调用方持有 m.mu
+func (m *PinManager) referencedInRetention(cid string, now time.Time) bool {
+    for _, p := range m.updates {
+        if p.ReleasedAt.IsZero() || now.Sub(p.ReleasedAt) >= m.Retention {
+            continue
+        }
+        for _, c := range p.CIDs {
+            if c == cid {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// forget 取消固定后删除 CID，并移除不再引用任何 CID 的已释放更新
+func (m *PinManager) forget(cid string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    delete(m.pinned, cid)
+    delete(m.names, cid)
+    for id, p := range m.updates {
+        if p.ReleasedAt.IsZero() {
+            continue
+        }
+        cids := p.CIDs[:0]
+        for _, c := range p.CIDs {
+            if c != cid {
+                cids = append(cids, c)
+            }
+        }
+        p.CIDs = cids
+        if len(p.CIDs) == 0 {
+            delete(m.updates, id)
+        }
+    }
+}
+
+// Updates 返回登记的更新（按 UpdateID 排序的副本）
+func (m *PinManager) Updates() []PinnedUpdate {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := make([]PinnedUpdate, 0, len(m.updates))
+    for _, p := range m.updates {
+        c := *p
+        c.CIDs = append([]string(nil), p.CIDs...)
+        out = append(out, c)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].UpdateID < out[j].UpdateID })
+    return out
+}
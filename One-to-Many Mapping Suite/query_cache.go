@@ -0,0 +1,391 @@
+package mapping
+
+import (
+    "container/list"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/redis/go-redis/v9"
+)
+
+// -------------------------------
+//  链下查询缓存（按链码事件失效）
+// -------------------------------
+
+// LedgerQuerier 链码只读查询，返回 QueryContract 的原始 JSON 结果（由 Fabric Gateway 客户端实现）
+type LedgerQuerier interface {
+    QueryUpdate(ctx context.Context, updateID string) ([]byte, error)
+    QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error)
+}
+
+// CacheStore 缓存存储
+type CacheStore interface {
+    // Get 未命中时返回 ok=false、err=nil
+    Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+    Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+    Delete(ctx context.Context, keys ...string) error
+    // DeletePrefix 删除以 prefix 开头的全部键（一个模型历史的全部分页）
+    DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// 默认的缓存过期时间：事件丢失或间接变化（如排队更新被放行）时的兜底
+const defaultQueryCacheTTL = 5 * time.Minute
+
+// CachedLedger 在 LedgerQuerier 前加一层缓存，减少看板类应用对 Peer 的查询压力。
+// 注册到事件监听服务后，链上事件到达即删除受影响的条目：
+// 携带 UpdateID 的事件（初始化、审批、投票、申诉等）删除该更新的缓存，
+// 能确定模型的事件删除该模型的全部历史分页。
+//
+// 查询以调用方的身份签名（见 InvokeIdentity），链码按其组织范围返回结果，缓存条目因此按身份分开保存，
+// 一个组织的查询结果不会返回给另一个组织；失效时删除该更新或模型在所有身份下的条目。
+type CachedLedger struct {
+    Ledger LedgerQuerier
+    Store  CacheStore
+    TTL    time.Duration // 0 使用默认值
+
+    // epoch 每次失效加一。查询期间发生过失效的结果不写入缓存，
+    // 避免慢查询把失效前读到的旧数据重新写回
+    epoch uint64
+
+    hits   uint64
+    misses uint64
+}
+
+// NewCachedLedger 创建带缓存的查询客户端，store 为 nil 时使用进程内缓存
+func NewCachedLedger(ledger LedgerQuerier, store CacheStore) *CachedLedger {
+    if store == nil {
+        store = NewMemoryCacheStore(10000)
+    }
+    return &CachedLedger{Ledger: ledger, Store: store}
+}
+
+// 缓存键。ID 中不会出现 "/"，以它分隔 ID 与查询身份，一个 ID 的前缀不会匹配另一个 ID
+func updateCachePrefix(updateID string) string {
+    return "bim:update:" + updateID + "/"
+}
+
+func updateCacheKey(updateID string, identity string) string {
+    return updateCachePrefix(updateID) + identity
+}
+
+func historyCachePrefix(modelID string) string {
+    return "bim:history:" + modelID + "/"
+}
+
+func historyCacheKey(modelID string, identity string, pageSize int, bookmark string) string {
+    return historyCachePrefix(modelID) + identity + ":" + strconv.Itoa(pageSize) + ":" + bookmark
+}
+
+// updateModelKey 更新所属的模型，供只带 UpdateID 的事件找到要失效的历史；模型不随更新变化，失效时不删除
+func updateModelKey(updateID string) string {
+    return "bim:update-model:" + updateID
+}
+
+// QueryUpdate 查询单个更新，优先读缓存
+func (c *CachedLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    if updateID == "" {
+        return nil, errors.New("updateID 不能为空")
+    }
+    return c.cached(ctx, updateCacheKey(updateID, InvokeIdentity(ctx)), func() ([]byte, error) {
+        value, err := c.Ledger.QueryUpdate(ctx, updateID)
+        if err == nil {
+            c.rememberModel(ctx, updateID, value)
+        }
+        return value, err
+    })
+}
+
+// QueryModelHistory 查询模型历史的一页，每个 (pageSize, bookmark) 单独缓存
+func (c *CachedLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    if modelID == "" {
+        return nil, errors.New("modelID 不能为空")
+    }
+    return c.cached(ctx, historyCacheKey(modelID, InvokeIdentity(ctx), pageSize, bookmark), func() ([]byte, error) {
+        return c.Ledger.QueryModelHistory(ctx, modelID, pageSize, bookmark)
+    })
+}
+
+func (c *CachedLedger) cached(ctx context.Context, key string, load func() ([]byte, error)) ([]byte, error) {
+    value, ok, err := c.Store.Get(ctx, key)
+    if err != nil {
+        // 缓存不可用时直接查询账本
+        Logger().Warn("读取查询缓存失败", "key", key, "error", err)
+    } else if ok {
+        atomic.AddUint64(&c.hits, 1)
+        return value, nil
+    }
+    atomic.AddUint64(&c.misses, 1)
+
+    epoch := atomic.LoadUint64(&c.epoch)
+    value, err = load()
+    if err != nil {
+        return nil, err
+    }
+    if atomic.LoadUint64(&c.epoch) != epoch {
+        return value, nil
+    }
+    ttl := c.TTL
+    if ttl <= 0 {
+        ttl = defaultQueryCacheTTL
+    }
+    if err := c.Store.Set(ctx, key, value, ttl); err != nil {
+        Logger().Warn("写入查询缓存失败", "key", key, "error", err)
+    }
+    return value, nil
+}
+
+// HandleEvent 实现事件监听器接口，按事件内容删除受影响的缓存条目
+func (c *CachedLedger) HandleEvent(eventName string, txID string, payload []byte) error {
+    var ids struct {
+        ModelID  string `json:"ModelID"`
+        UpdateID string `json:"UpdateID"`
+    }
+    if len(payload) > 0 {
+        if err := json.Unmarshal(payload, &ids); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+    }
+    if ids.UpdateID == "" && ids.ModelID == "" {
+        return nil
+    }
+    if err := c.Invalidate(context.Background(), ids.UpdateID, ids.ModelID); err != nil {
+        return err
+    }
+    txLog(txID).Debug("查询缓存已失效", "event", eventName, "modelId", ids.ModelID, "updateId", ids.UpdateID)
+    return nil
+}
+
+// Invalidate 删除更新 updateID 与模型 modelID 的缓存条目，任一可为空；
+// modelID 为空时从缓存中的更新记录取
+func (c *CachedLedger) Invalidate(ctx context.Context, updateID string, modelID string) error {
+    if modelID == "" {
+        // 审批类事件不带 ModelID
+        modelID = c.cachedModelOf(ctx, updateID)
+    }
+    atomic.AddUint64(&c.epoch, 1)
+
+    if updateID != "" {
+        if err := c.Store.DeletePrefix(ctx, updateCachePrefix(updateID)); err != nil {
+            return fmt.Errorf("删除更新 %s 的缓存失败: %v", updateID, err)
+        }
+    }
+    if modelID != "" {
+        if err := c.Store.DeletePrefix(ctx, historyCachePrefix(modelID)); err != nil {
+            return fmt.Errorf("删除模型 %s 的历史缓存失败: %v", modelID, err)
+        }
+    }
+    return nil
+}
+
+// rememberModel 记录 QueryUpdate 结果中更新所属的模型
+func (c *CachedLedger) rememberModel(ctx context.Context, updateID string, data []byte) {
+    var rec struct {
+        InitRecord *struct {
+            ModelID string `json:"ModelID"`
+        } `json:"InitRecord"`
+    }
+    if json.Unmarshal(data, &rec) != nil || rec.InitRecord == nil || rec.InitRecord.ModelID == "" {
+        return
+    }
+    ttl := c.TTL
+    if ttl <= 0 {
+        ttl = defaultQueryCacheTTL
+    }
+    if err := c.Store.Set(ctx, updateModelKey(updateID), []byte(rec.InitRecord.ModelID), ttl); err != nil {
+        Logger().Warn("写入查询缓存失败", "key", updateModelKey(updateID), "error", err)
+    }
+}
+
+// cachedModelOf 返回查询过的更新所属的模型 ID，未记录时返回空串
+func (c *CachedLedger) cachedModelOf(ctx context.Context, updateID string) string {
+    if updateID == "" {
+        return ""
+    }
+    data, ok, err := c.Store.Get(ctx, updateModelKey(updateID))
+    if err != nil || !ok {
+        return ""
+    }
+    return string(data)
+}
+
+// Stats 返回命中与未命中次数
+func (c *CachedLedger) Stats() (hits uint64, misses uint64) {
+    return atomic.LoadUint64(&c.hits), atomic.LoadUint64(&c.misses)
+}
+
+// -------------------------------
+//  进程内缓存
+// -------------------------------
+
+// MemoryCacheStore 进程内 LRU 缓存，适用于单实例部署
+type MemoryCacheStore struct {
+    maxEntries int
+
+    mu      sync.Mutex
+    order   *list.List // 最近使用的在前
+    entries map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+    key     string
+    value   []byte
+    expires time.Time
+}
+
+// NewMemoryCacheStore 创建最多保存 maxEntries 个条目的缓存，<=0 表示不限
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+    return &MemoryCacheStore{
+        maxEntries: maxEntries,
+        order:      list.New(),
+        entries:    make(map[string]*list.Element),
+    }
+}
+
+func (s *MemoryCacheStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    elem, ok := s.entries[key]
+    if !ok {
+        return nil, false, nil
+    }
+    entry := elem.Value.(*memoryCacheEntry)
+    if time.Now().After(entry.expires) {
+        s.removeElement(elem)
+        return nil, false, nil
+    }
+    s.order.MoveToFront(elem)
+    return entry.value, true, nil
+}
+
+func (s *MemoryCacheStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    expires := time.Now().Add(ttl)
+    if elem, ok := s.entries[key]; ok {
+        entry := elem.Value.(*memoryCacheEntry)
+        entry.value, entry.expires = value, expires
+        s.order.MoveToFront(elem)
+        return nil
+    }
+    s.entries[key] = s.order.PushFront(&memoryCacheEntry{key: key, value: value, expires: expires})
+    for s.maxEntries > 0 && s.order.Len() > s.maxEntries {
+        s.removeElement(s.order.Back())
+    }
+    return nil
+}
+
+func (s *MemoryCacheStore) Delete(_ context.Context, keys ...string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, key := range keys {
+        if elem, ok := s.entries[key]; ok {
+            s.removeElement(elem)
+        }
+    }
+    return nil
+}
+
+func (s *MemoryCacheStore) DeletePrefix(_ context.Context, prefix string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for key, elem := range s.entries {
+        if strings.HasPrefix(key, prefix) {
+            s.removeElement(elem)
+        }
+    }
+    return nil
+}
+
+func (s *MemoryCacheStore) removeElement(elem *list.Element) {
+    s.order.Remove(elem)
+    delete(s.entries, elem.Value.(*memoryCacheEntry).key)
+}
+
+// -------------------------------
+//  Redis 缓存
+// -------------------------------
+
+// RedisCacheStore 基于 Redis 的共享缓存，多个网关实例共用同一份缓存，
+// 任一实例收到事件即对全部实例生效
+type RedisCacheStore struct {
+    Client *redis.Client
+    Prefix string // 键前缀，多个网络共用一个 Redis 时区分
+}
+
+// NewRedisCacheStore 连接 Redis
+func NewRedisCacheStore(addr string, password string, db int) *RedisCacheStore {
+    return &RedisCacheStore{
+        Client: redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db}),
+    }
+}
+
+func (s *RedisCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+    value, err := s.Client.Get(ctx, s.Prefix+key).Bytes()
+    if errors.Is(err, redis.Nil) {
+        return nil, false, nil
+    }
+    if err != nil {
+        return nil, false, err
+    }
+    return value, true, nil
+}
+
+func (s *RedisCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+    return s.Client.Set(ctx, s.Prefix+key, value, ttl).Err()
+}
+
+func (s *RedisCacheStore) Delete(ctx context.Context, keys ...string) error {
+    if len(keys) == 0 {
+        return nil
+    }
+    prefixed := make([]string, len(keys))
+    for i, key := range keys {
+        prefixed[i] = s.Prefix + key
+    }
+    return s.Client.Del(ctx, prefixed...).Err()
+}
+
+// DeletePrefix 以 SCAN 遍历匹配的键后删除（不用 KEYS，避免阻塞 Redis）
+func (s *RedisCacheStore) DeletePrefix(ctx context.Context, prefix string) error {
+    match := redisGlobEscape(s.Prefix+prefix) + "*"
+    var cursor uint64
+    for {
+        keys, next, err := s.Client.Scan(ctx, cursor, match, 500).Result()
+        if err != nil {
+            return err
+        }
+        if len(keys) > 0 {
+            if err := s.Client.Del(ctx, keys...).Err(); err != nil {
+                return err
+            }
+        }
+        if next == 0 {
+            return nil
+        }
+        cursor = next
+    }
+}
+
+func (s *RedisCacheStore) Close() error {
+    return s.Client.Close()
+}
+
+// redisGlobEscape 转义 SCAN MATCH 模式中的通配字符，模型 ID 按字面匹配
+func redisGlobEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch r {
+        case '*', '?', '[', ']', '\\':
+            b.WriteByte('\\')
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
@@ -0,0 +1,78 @@
+package mapping
+
+import (
+    "context"
+    "fmt"
+    "testing"
+)
+
+// scopedLedger 按查询身份返回不同结果的账本，模拟链码的组织范围
+type scopedLedger struct {
+    updateQueries  int
+    historyQueries int
+}
+
+func (l *scopedLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    l.updateQueries++
+    return []byte(fmt.Sprintf(`{"InitRecord":{"UpdateID":%q,"ModelID":"m1"},"ScopedTo":%q}`, updateID, InvokeIdentity(ctx))), nil
+}
+
+func (l *scopedLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    l.historyQueries++
+    return []byte(fmt.Sprintf(`{"Records":[],"ScopedTo":%q}`, InvokeIdentity(ctx))), nil
+}
+
+func TestCachedLedgerScopesEntriesByIdentity(t *testing.T) {
+    ledger := &scopedLedger{}
+    cached := NewCachedLedger(ledger, nil)
+    query := func(identity string) string {
+        value, err := cached.QueryUpdate(WithIdentity(context.Background(), identity), "u1")
+        if err != nil {
+            t.Fatal(err)
+        }
+        return string(value)
+    }
+
+    first := query("1001")
+    if again := query("1001"); again != first || ledger.updateQueries != 1 {
+        t.Fatalf("second query by 1001 = %s after %d ledger queries, want a cache hit", again, ledger.updateQueries)
+    }
+    // 另一个身份的查询不能读到 1001 组织范围内的结果
+    if other := query("2001"); other == first || ledger.updateQueries != 2 {
+        t.Fatalf("query by 2001 = %s after %d ledger queries, want its own ledger query", other, ledger.updateQueries)
+    }
+}
+
+func TestCachedLedgerInvalidatedByListener(t *testing.T) {
+    ledger := &scopedLedger{}
+    cached := NewCachedLedger(ledger, nil)
+    identities := []context.Context{
+        WithIdentity(context.Background(), "1001"),
+        WithIdentity(context.Background(), "2001"),
+    }
+    fill := func() {
+        for _, ctx := range identities {
+            if _, err := cached.QueryUpdate(ctx, "u1"); err != nil {
+                t.Fatal(err)
+            }
+            if _, err := cached.QueryModelHistory(ctx, "m1", 10, ""); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+    fill()
+    fill()
+    if ledger.updateQueries != 2 || ledger.historyQueries != 2 {
+        t.Fatalf("ledger queries = %d/%d before the event, want 2/2", ledger.updateQueries, ledger.historyQueries)
+    }
+
+    l := NewEventListener(nil)
+    l.Handle("cache", cached.HandleEvent)
+    // 审批事件只带 UpdateID，模型取自先前的查询
+    l.Run(context.Background(), 0, eventStream(ChainEvent{BlockNumber: 9, Name: "BIMUpdateApproved", TxID: "t1", Payload: []byte(`{"UpdateID":"u1"}`)}))
+
+    fill()
+    if ledger.updateQueries != 4 || ledger.historyQueries != 4 {
+        t.Fatalf("ledger queries = %d/%d after the event, want every identity's entries reloaded (4/4)", ledger.updateQueries, ledger.historyQueries)
+    }
+}
@@ -0,0 +1,135 @@
+package mapping
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// -------------------------------
+//  交易回执与核验
+// -------------------------------
+
+// Receipt 一次提交的回执，可保存下来日后用 VerifyReceipt 核对账本
+type Receipt struct {
+    TxID string `json:"txId"`
+    // BlockNumber 交易所在区块，0 表示提交方未返回区块号（或交易尚未提交）
+    BlockNumber uint64 `json:"blockNumber,omitempty"`
+    // UpdateID 链码返回的更新 ID，为空表示交易尚未提交
+    UpdateID      string `json:"updateId,omitempty"`
+    CID           string `json:"cid"`
+    FileHash      string `json:"fileHash"`
+    HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+    Timestamp     int64  `json:"timestamp"`
+    NodeURL       string `json:"nodeUrl"`
+    OrgName       string `json:"orgName,omitempty"`
+    Channel       string `json:"channel,omitempty"`
+}
+
+// Submitted 交易是否已提交上链
+func (r *Receipt) Submitted() bool {
+    return r != nil && r.UpdateID != ""
+}
+
+// NewReceipt 根据封装好的交易与映射节点生成（尚未提交的）回执
+func NewReceipt(tx *Transaction, node *NodeMapping) *Receipt {
+    algorithm := tx.BIM.HashAlgorithm
+    if algorithm == "" {
+        algorithm = DefaultHashAlgorithm
+    }
+    return &Receipt{
+        TxID:          tx.TxID,
+        CID:           tx.BIM.CID,
+        FileHash:      tx.BIM.FileHash,
+        HashAlgorithm: algorithm,
+        Timestamp:     tx.Timestamp,
+        NodeURL:       node.NodeURL,
+        OrgName:       node.OrgName,
+        Channel:       node.Channel,
+    }
+}
+
+// CommitInvoker 可选扩展：ChannelInvoker 等待交易提交并返回所在区块号
+type CommitInvoker interface {
+    InvokeCommitted(ctx context.Context, node *NodeMapping, chaincode string, function string, args ...[]byte) (result []byte, blockNumber uint64, err error)
+}
+
+// SubmitForReceipt 将交易按 meta 转换为 BIMUpdate（见 NewUpdateSubmission）后调用 InitBIMUpdate 并返回回执；
+// 链码返回值作为 UpdateID。
+// Invoker 实现了 CommitInvoker 时等待交易提交，回执带区块号；WaitForCommit 为真而未实现时返回错误。
+func (s *RoutedSubmitter) SubmitForReceipt(ctx context.Context, tx *Transaction, meta UpdateMeta) (*Receipt, error) {
+    node, payload, err := initPayload(tx, meta)
+    if err != nil {
+        return nil, err
+    }
+    _, canCommit := s.Invoker.(CommitInvoker)
+    result, block, err := s.send(txIdentity(ctx, tx), tx.TxID, node, fnInitBIMUpdate, canCommit || s.WaitForCommit, payload)
+    if err != nil {
+        return nil, err
+    }
+    r := NewReceipt(tx, node)
+    r.UpdateID = strings.TrimSpace(string(result))
+    r.BlockNumber = block
+    return r, nil
+}
+
+// ReceiptLedger 核验回执所需的账本查询，由 Fabric Gateway / SDK 适配实现
+type ReceiptLedger interface {
+    // ReadUpdate 读取链上更新记录（如调用 ReadUpdate），不存在时返回错误
+    ReadUpdate(ctx context.Context, updateID string) (*LedgerUpdate, error)
+    // TransactionBlock 返回交易所在区块号（如通过 qscc GetTransactionByID）
+    TransactionBlock(ctx context.Context, channel string, txID string) (uint64, error)
+}
+
+// ErrReceiptMismatch 回执与账本记录不一致
+var ErrReceiptMismatch = errors.New("回执与账本不一致")
+
+// VerifyReceipt 重新查询账本，核对回执中的更新确实锚定了相同的 CID 与文件指纹；
+// 回执带区块号时同时核对交易所在区块。不一致时返回包装了 ErrReceiptMismatch 的错误。
+func VerifyReceipt(ctx context.Context, ledger ReceiptLedger, r *Receipt) error {
+    if !r.Submitted() {
+        return errors.New("回执没有 UpdateID，交易尚未提交")
+    }
+    update, err := ledger.ReadUpdate(ctx, r.UpdateID)
+    if err != nil {
+        return fmt.Errorf("查询更新 %s 失败: %v", r.UpdateID, err)
+    }
+
+    var anchored *LedgerAttachment
+    files := update.anchoredFiles()
+    for i := range files {
+        if files[i].CID == r.CID {
+            anchored = &files[i]
+            break
+        }
+    }
+    if anchored == nil {
+        return fmt.Errorf("%w: 更新 %s 没有引用 CID %s", ErrReceiptMismatch, r.UpdateID, r.CID)
+    }
+    if !strings.EqualFold(anchoredHash(anchored, r.HashAlgorithm), r.FileHash) {
+        return fmt.Errorf("%w: 更新 %s 中 %s 的指纹与回执不符", ErrReceiptMismatch, r.UpdateID, r.CID)
+    }
+
+    if r.BlockNumber > 0 {
+        block, err := ledger.TransactionBlock(ctx, r.Channel, r.TxID)
+        if err != nil {
+            return fmt.Errorf("查询交易 %s 所在区块失败: %v", r.TxID, err)
+        }
+        if block != r.BlockNumber {
+            return fmt.Errorf("%w: 交易 %s 位于区块 %d，回执记录为 %d", ErrReceiptMismatch, r.TxID, block, r.BlockNumber)
+        }
+    }
+    return nil
+}
+
+// anchoredHash 返回附件上与回执同一算法的指纹：sha256 存于 SHA256，其他算法存于 Digest
+func anchoredHash(att *LedgerAttachment, algorithm string) string {
+    if algorithm == "" || algorithm == HashSHA256 {
+        return att.SHA256
+    }
+    if att.HashAlgorithm != algorithm {
+        return ""
+    }
+    return att.Digest
+}
@@ -0,0 +1,34 @@
+package mapping
+
+import (
+    "context"
+    "strings"
+    "testing"
+)
+
+func TestSubmitForReceiptSubmitsBIMUpdate(t *testing.T) {
+    cid := "Qm" + strings.Repeat("a", 44)
+    hash := strings.Repeat("0f", 32)
+    invoker := &recordingInvoker{result: "u1\n"}
+    tx := testTransaction(BIMInitInfo{FileName: "A.ifc", CID: cid, FileHash: hash})
+    r, err := NewRoutedSubmitter(invoker, "bim").SubmitForReceipt(context.Background(), tx, UpdateMeta{ModelID: "m1", Version: "1.0"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(invoker.calls) != 1 || invoker.calls[0] != fnInitBIMUpdate {
+        t.Fatalf("calls = %v, want [%s]", invoker.calls, fnInitBIMUpdate)
+    }
+    if err := ValidateRequest("update", invoker.args[0][0]); err != nil {
+        t.Fatalf("payload %s: %v", invoker.args[0][0], err)
+    }
+    if r.UpdateID != "u1" || r.TxID != tx.TxID || r.CID != cid || r.FileHash != hash {
+        t.Errorf("receipt = %+v", r)
+    }
+
+    if _, err := NewRoutedSubmitter(invoker, "bim").SubmitForReceipt(context.Background(), tx, UpdateMeta{ModelID: "m1"}); err == nil {
+        t.Error("SubmitForReceipt without Version succeeded")
+    }
+    if len(invoker.calls) != 1 {
+        t.Errorf("invoked %v", invoker.calls)
+    }
+}
@@ -0,0 +1,471 @@
+package mapping
+
+import (
+    "context"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  IPFS 与账本一致性核对
+// -------------------------------
+
+// 文件核对状态
+const (
+    IntegrityOK       = "OK"
+    IntegrityMissing  = "MISSING"  // 存储中取不回该 CID
+    IntegrityMismatch = "MISMATCH" // 取回的内容与链上指纹或大小不一致
+    // IntegrityError 取回失败但不能断定文件缺失（如 IPFS 节点不可达），下次扫描重试，不发通知
+    IntegrityError = "ERROR"
+)
+
+// ErrContentMissing 存储确认 CID 不存在，或在超时内取不回
+var ErrContentMissing = errors.New("文件在存储中不存在")
+
+// ContentSource 按 CID 读取文件内容
+type ContentSource interface {
+    Open(ctx context.Context, cid string) (io.ReadCloser, error)
+}
+
+// IPFSContentSource 经 IPFS HTTP API 读取文件：
+//
+//	POST {apiUrl}/api/v0/cat?arg={cid}
+//
+// IPFS 找不到内容时通常不会报错而是一直等待，因此超时也视为缺失
+type IPFSContentSource struct {
+    Config  IPFSConfig
+    Client  *http.Client
+    Timeout time.Duration // 单个文件的读取超时，默认 10 分钟
+}
+
+// Open 读取 CID 对应的内容，调用方负责关闭；超时从 Open 起算，覆盖读取正文的过程
+func (s *IPFSContentSource) Open(ctx context.Context, cid string) (io.ReadCloser, error) {
+    timeout := s.Timeout
+    if timeout == 0 {
+        timeout = 10 * time.Minute
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    target := strings.TrimSuffix(s.Config.APIURL, "/") + "/api/v0/cat?arg=" + url.QueryEscape(cid)
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+    if err != nil {
+        cancel()
+        return nil, err
+    }
+    if s.Config.APIToken != "" {
+        req.Header.Set("Authorization", "Bearer "+s.Config.APIToken)
+    }
+    resp, err := httpClient(s.Client).Do(req)
+    if err != nil {
+        cancel()
+        return nil, s.classify(ctx, cid, timeout, err)
+    }
+    if resp.StatusCode/100 != 2 {
+        defer cancel()
+        defer resp.Body.Close()
+        var body struct {
+            Message string `json:"Message"`
+        }
+        json.NewDecoder(resp.Body).Decode(&body)
+        if resp.StatusCode == http.StatusNotFound || strings.Contains(body.Message, "not found") {
+            return nil, fmt.Errorf("%w: %s: %s", ErrContentMissing, cid, body.Message)
+        }
+        return nil, fmt.Errorf("IPFS 返回 %d: %s", resp.StatusCode, body.Message)
+    }
+    return &ipfsBody{ReadCloser: resp.Body, source: s, ctx: ctx, cancel: cancel, cid: cid, timeout: timeout}, nil
+}
+
+// classify 把读取超时转换为 ErrContentMissing
+func (s *IPFSContentSource) classify(ctx context.Context, cid string, timeout time.Duration, err error) error {
+    if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+        return fmt.Errorf("%w: %s 在 %s 内未能取回", ErrContentMissing, cid, timeout)
+    }
+    return err
+}
+
+// ipfsBody 读取结束或关闭时释放超时
+type ipfsBody struct {
+    io.ReadCloser
+    source  *IPFSContentSource
+    ctx     context.Context
+    cancel  context.CancelFunc
+    cid     string
+    timeout time.Duration
+}
+
+func (b *ipfsBody) Read(p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    if err != nil && err != io.EOF {
+        err = b.source.classify(b.ctx, b.cid, b.timeout, err)
+    }
+    return n, err
+}
+
+func (b *ipfsBody) Close() error {
+    defer b.cancel()
+    return b.ReadCloser.Close()
+}
+
+// IntegrityResult 一个锚定文件最近一次的核对结果
+type IntegrityResult struct {
+    UpdateID string `json:"updateId"`
+    ModelID  string `json:"modelId"`
+    Version  string `json:"version"`
+    Name     string `json:"name"`
+    CID      string `json:"cid"`
+
+    Status string `json:"status"`
+    // HashAlgorithm / Expected / Actual 不一致时的算法、链上指纹与实际指纹
+    HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+    Expected      string `json:"expected,omitempty"`
+    Actual        string `json:"actual,omitempty"`
+    Detail        string `json:"detail,omitempty"`
+
+    CheckedAt time.Time `json:"checkedAt"`
+    // Since 当前状态首次出现的时间
+    Since time.Time `json:"since"`
+}
+
+// Problem 文件是否缺失或不一致
+func (r *IntegrityResult) Problem() bool {
+    return r.Status == IntegrityMissing || r.Status == IntegrityMismatch
+}
+
+// Reconciler 定期核对链上锚定的文件：按 CID 从存储取回内容，重新计算链上记录的指纹
+// （Files 的 Hash、Attachments 的 SHA256 与 Digest）并核对大小。文件首次被判定缺失或
+// 不一致时调用 OnProblem 并通知模型的 BIM 负责人，状态不变时不重复通知。
+//
+// 与 PinManager 一样由事件监听服务调用 HandleEvent，服务重启后重放事件即可恢复要核对的
+// 文件；被驳回的更新不再核对，其文件可能已按固定策略被垃圾回收。
+type Reconciler struct {
+    Source     ContentSource
+    Dispatcher *Dispatcher
+    Leads      LeadDirectory
+
+    Interval    time.Duration // 扫描间隔，默认 6 小时
+    Concurrency int           // 同时读取的文件数，默认 4
+
+    // OnProblem 文件首次被判定缺失或不一致时调用（早于通知），可用于发布到事件总线或落库
+    OnProblem func(r IntegrityResult)
+
+    // Now 当前时间，默认 time.Now
+    Now func() time.Time
+
+    mu      sync.Mutex
+    entries map[string]*reconcileEntry // UpdateID + "\x00" + CID
+
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+type reconcileEntry struct {
+    IntegrityResult
+    file LedgerAttachment
+}
+
+// NewReconciler 创建核对任务，问题经 dispatcher 通知 leads 返回的 BIM 负责人
+func NewReconciler(source ContentSource, dispatcher *Dispatcher, leads LeadDirectory) *Reconciler {
+    return &Reconciler{
+        Source:      source,
+        Dispatcher:  dispatcher,
+        Leads:       leads,
+        Interval:    6 * time.Hour,
+        Concurrency: 4,
+        Now:         time.Now,
+        entries:     map[string]*reconcileEntry{},
+    }
+}
+
+// Start 启动定期核对，直到 ctx 取消或调用 Stop
+func (r *Reconciler) Start(ctx context.Context) {
+    ctx, r.cancel = context.WithCancel(ctx)
+    r.wg.Add(1)
+    go func() {
+        defer r.wg.Done()
+        ticker := time.NewTicker(r.Interval)
+        defer ticker.Stop()
+        r.Tick(ctx)
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                r.Tick(ctx)
+            }
+        }
+    }()
+}
+
+// Stop 停止核对
+func (r *Reconciler) Stop() {
+    if r.cancel != nil {
+        r.cancel()
+    }
+    r.wg.Wait()
+}
+
+// HandleEvent 新更新登记其锚定的文件；驳回事件移除更新的文件；其他事件忽略
+func (r *Reconciler) HandleEvent(eventName string, txID string, payload []byte) error {
+    switch eventName {
+    case EventBIMInit:
+        var u LedgerUpdate
+        if err := json.Unmarshal(payload, &u); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        r.track(&u)
+    case EventBIMReject:
+        var a LedgerApproval
+        if err := json.Unmarshal(payload, &a); err != nil {
+            return fmt.Errorf("解析事件 %s 失败: %v", eventName, err)
+        }
+        r.untrack(a.UpdateID)
+    }
+    return nil
+}
+
+// track 登记更新锚定的文件
+func (r *Reconciler) track(u *LedgerUpdate) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for _, f := range u.anchoredFiles() {
+        if f.CID == "" {
+            continue
+        }
+        key := u.UpdateID + "\x00" + f.CID
+        if _, ok := r.entries[key]; ok {
+            continue
+        }
+        r.entries[key] = &reconcileEntry{
+            IntegrityResult: IntegrityResult{UpdateID: u.UpdateID, ModelID: u.ModelID, Version: u.Version, Name: f.Name, CID: f.CID},
+            file:            f,
+        }
+    }
+}
+
+func (r *Reconciler) untrack(updateID string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    for key, e := range r.entries {
+        if e.UpdateID == updateID {
+            delete(r.entries, key)
+        }
+    }
+}
+
+// Tick 核对一次所有登记的文件，同一 CID 只读取一次；通常由 Start 定期调用
+func (r *Reconciler) Tick(ctx context.Context) {
+    r.mu.Lock()
+    byCID := map[string][]*reconcileEntry{}
+    for _, e := range r.entries {
+        byCID[e.CID] = append(byCID[e.CID], e)
+    }
+    r.mu.Unlock()
+    cids := make([]string, 0, len(byCID))
+    for cid := range byCID {
+        cids = append(cids, cid)
+    }
+    sort.Strings(cids)
+
+    workers := r.Concurrency
+    if workers <= 0 {
+        workers = 1
+    }
+    sem := make(chan struct{}, workers)
+    var wg sync.WaitGroup
+    for _, cid := range cids {
+        if ctx.Err() != nil {
+            break
+        }
+        sem <- struct{}{}
+        wg.Add(1)
+        go func(cid string, entries []*reconcileEntry) {
+            defer wg.Done()
+            defer func() { <-sem }()
+            r.check(ctx, cid, entries)
+        }(cid, byCID[cid])
+    }
+    wg.Wait()
+}
+
+// check 读取一个 CID 并核对引用它的每个文件
+func (r *Reconciler) check(ctx context.Context, cid string, entries []*reconcileEntry) {
+    algorithms := map[string]bool{}
+    for _, e := range entries {
+        for alg := range expectedHashes(&e.file) {
+            algorithms[alg] = true
+        }
+    }
+    digests, size, err := r.fetch(ctx, cid, algorithms)
+    if err != nil && ctx.Err() != nil {
+        return // 任务停止，不记录结果
+    }
+    now := r.Now()
+    for _, e := range entries {
+        result := IntegrityResult{Status: IntegrityOK}
+        switch {
+        case errors.Is(err, ErrContentMissing):
+            result.Status, result.Detail = IntegrityMissing, err.Error()
+        case err != nil:
+            result.Status, result.Detail = IntegrityError, err.Error()
+        default:
+            result = compareDigests(&e.file, digests, size)
+        }
+        r.record(e, result, now)
+    }
+}
+
+// fetch 读取 CID 的内容，同时计算各算法的指纹（十六进制小写）与大小
+func (r *Reconciler) fetch(ctx context.Context, cid string, algorithms map[string]bool) (map[string]string, int64, error) {
+    body, err := r.Source.Open(ctx, cid)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer body.Close()
+    hashes := map[string]hash.Hash{}
+    writers := make([]io.Writer, 0, len(algorithms))
+    for alg := range algorithms {
+        h, err := NewFileHash(alg)
+        if err != nil {
+            return nil, 0, err
+        }
+        hashes[alg] = h
+        writers = append(writers, h)
+    }
+    size, err := io.Copy(io.MultiWriter(writers...), body)
+    if err != nil {
+        return nil, 0, err
+    }
+    digests := make(map[string]string, len(hashes))
+    for alg, h := range hashes {
+        digests[alg] = hex.EncodeToString(h.Sum(nil))
+    }
+    return digests, size, nil
+}
+
+// expectedHashes 返回链上记录的指纹，按算法索引
+func expectedHashes(f *LedgerAttachment) map[string]string {
+    expected := map[string]string{}
+    if f.SHA256 != "" {
+        expected[HashSHA256] = strings.ToLower(f.SHA256)
+    }
+    if f.Digest != "" && f.HashAlgorithm != "" {
+        expected[f.HashAlgorithm] = strings.ToLower(f.Digest)
+    }
+    return expected
+}
+
+// compareDigests 核对大小与每个链上指纹，返回第一个不一致项
+func compareDigests(f *LedgerAttachment, digests map[string]string, size int64) IntegrityResult {
+    if f.Size > 0 && f.Size != size {
+        return IntegrityResult{Status: IntegrityMismatch, Detail: fmt.Sprintf("大小为 %d 字节，链上记录为 %d 字节", size, f.Size)}
+    }
+    expected := expectedHashes(f)
+    algs := make([]string, 0, len(expected))
+    for alg := range expected {
+        algs = append(algs, alg)
+    }
+    sort.Strings(algs)
+    for _, alg := range algs {
+        if digests[alg] != expected[alg] {
+            return IntegrityResult{
+                Status:        IntegrityMismatch,
+                HashAlgorithm: alg,
+                Expected:      expected[alg],
+                Actual:        digests[alg],
+                Detail:        alg + " 指纹与链上记录不一致",
+            }
+        }
+    }
+    return IntegrityResult{Status: IntegrityOK}
+}
+
+// record 保存核对结果；状态变为缺失或不一致时发出告警
+func (r *Reconciler) record(e *reconcileEntry, result IntegrityResult, now time.Time) {
+    r.mu.Lock()
+    previous := e.Status
+    e.HashAlgorithm, e.Expected, e.Actual, e.Detail = result.HashAlgorithm, result.Expected, result.Actual, result.Detail
+    e.CheckedAt = now
+    if result.Status != previous {
+        e.Status = result.Status
+        e.Since = now
+    }
+    snapshot := e.IntegrityResult
+    r.mu.Unlock()
+
+    log := Logger().With("component", "reconcile", "updateId", snapshot.UpdateID, "cid", snapshot.CID)
+    switch {
+    case snapshot.Status == IntegrityError:
+        log.Warn("读取文件失败，下次扫描重试", "err", snapshot.Detail)
+    case snapshot.Problem() && snapshot.Status != previous:
+        log.Error("文件与链上锚定不一致", "status", snapshot.Status, "detail", snapshot.Detail)
+        r.alert(snapshot)
+    case snapshot.Status == IntegrityOK && (previous == IntegrityMissing || previous == IntegrityMismatch):
+        log.Info("文件已恢复", "previous", previous)
+    }
+}
+
+// alert 调用 OnProblem 并通知 BIM 负责人；通知失败只记录日志
+func (r *Reconciler) alert(result IntegrityResult) {
+    if r.OnProblem != nil {
+        r.OnProblem(result)
+    }
+    if r.Dispatcher == nil || r.Leads == nil {
+        return
+    }
+    log := Logger().With("component", "reconcile", "updateId", result.UpdateID, "notice", NoticeFileIntegrity)
+    leads, err := r.Leads.BIMLeads(result.ModelID)
+    if err != nil {
+        log.Error("查询收件人失败", "err", err)
+        return
+    }
+    data := &TemplateData{
+        Update:    &LedgerUpdate{UpdateID: result.UpdateID, ModelID: result.ModelID, Version: result.Version},
+        Integrity: &result,
+    }
+    if err := r.Dispatcher.Notify(NoticeFileIntegrity, data, leads); err != nil {
+        log.Error("发送通知失败", "err", err)
+        return
+    }
+    log.Info("已发送文件完整性告警", "recipients", len(leads))
+}
+
+// Results 返回每个登记文件最近一次的核对结果（按 ModelID、UpdateID、Name 排序的副本），
+// 尚未核对的文件 Status 为空
+func (r *Reconciler) Results() []IntegrityResult {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]IntegrityResult, 0, len(r.entries))
+    for _, e := range r.entries {
+        out = append(out, e.IntegrityResult)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].ModelID != out[j].ModelID {
+            return out[i].ModelID < out[j].ModelID
+        }
+        if out[i].UpdateID != out[j].UpdateID {
+            return out[i].UpdateID < out[j].UpdateID
+        }
+        return out[i].Name < out[j].Name
+    })
+    return out
+}
+
+// Problems 返回当前缺失或不一致的文件
+func (r *Reconciler) Problems() []IntegrityResult {
+    var out []IntegrityResult
+    for _, result := range r.Results() {
+        if result.Problem() {
+            out = append(out, result)
+        }
+    }
+    return out
+}
@@ -0,0 +1,374 @@
+package mapping
+
+import (
+    "bytes"
+    "embed"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+)
+
+// -------------------------------
+//  网关请求校验（JSON Schema）
+// -------------------------------
+
+// schemas/ 下发布更新、审批、评论请求体的 JSON Schema（draft 2020-12）。
+// REST 网关（见 http_gateway.go）在调用链码前用 ValidateJSONBody 校验请求体，不合格的请求以 422 及逐字段错误返回，
+// 不再以交易形式到达节点。校验器只实现这些 Schema 用到的关键字：
+// type（单一类型）、required、properties、additionalProperties（布尔）、items、enum、
+// minLength / maxLength、pattern、format: date-time、minItems / maxItems、minimum / maximum、
+// if / then / else 以及指向 #/$defs/ 的 $ref。与链码的 validate 标签一致，空字符串不做 pattern 检查。
+
+//go:embed schemas/*.schema.json
+var schemaFiles embed.FS
+
+// 请求种类，对应 schemas/<种类>.schema.json
+const (
+    RequestUpdate   = "update"   // SmartContract.InitBIMUpdate 的更新 JSON
+    RequestApproval = "approval" // ApprovalContract.ApproveBIMUpdate 的参数
+    RequestComment  = "comment"  // CommentContract.AddComment 的参数
+)
+
+// DefaultMaxRequestBytes ValidateJSONBody 默认接受的请求体上限（1 MiB）
+const DefaultMaxRequestBytes = 1 << 20
+
+// FieldError 单个字段的校验错误，Field 为 JSON Pointer（如 /Files/0/CID），请求体本身为 ""
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+// ValidationError 请求体不符合 Schema
+type ValidationError struct {
+    Kind   string       `json:"kind"`
+    Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+    msgs := make([]string, len(e.Fields))
+    for i, f := range e.Fields {
+        msgs[i] = f.Field + ": " + f.Message
+        if f.Field == "" {
+            msgs[i] = f.Message
+        }
+    }
+    return fmt.Sprintf("%s 请求不符合 Schema: %s", e.Kind, strings.Join(msgs, "; "))
+}
+
+// RequestSchema 返回 kind 的 JSON Schema 原文，供网关对外发布
+func RequestSchema(kind string) ([]byte, error) {
+    data, err := schemaFiles.ReadFile("schemas/" + kind + ".schema.json")
+    if err != nil {
+        return nil, fmt.Errorf("未知的请求种类 %q", kind)
+    }
+    return data, nil
+}
+
+// ValidateRequest 按 kind 的 Schema 校验请求体；不是合法 JSON 或不符合 Schema 时返回 *ValidationError
+func ValidateRequest(kind string, body []byte) error {
+    schema, err := loadRequestSchema(kind)
+    if err != nil {
+        return err
+    }
+    dec := json.NewDecoder(bytes.NewReader(body))
+    dec.UseNumber()
+    var value interface{}
+    if err := dec.Decode(&value); err != nil {
+        return &ValidationError{Kind: kind, Fields: []FieldError{{Message: "请求体不是合法 JSON: " + err.Error()}}}
+    }
+    if dec.More() {
+        return &ValidationError{Kind: kind, Fields: []FieldError{{Message: "请求体只能包含一个 JSON 值"}}}
+    }
+    var errs []FieldError
+    schema.validate(schema, value, "", &errs)
+    if len(errs) > 0 {
+        sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+        return &ValidationError{Kind: kind, Fields: errs}
+    }
+    return nil
+}
+
+// ValidateJSONBody 返回在 next 之前校验请求体的 HTTP 中间件：
+// 不符合 kind 的 Schema 时以 422 Unprocessable Entity 返回 {"kind", "fields"}，
+// 超过 maxBytes（<= 0 时为 DefaultMaxRequestBytes）时返回 413；通过校验后 next 读到的请求体不变
+func ValidateJSONBody(kind string, maxBytes int64, next http.Handler) http.Handler {
+    if _, err := loadRequestSchema(kind); err != nil {
+        panic(err) // 种类写错属于编程错误
+    }
+    if maxBytes <= 0 {
+        maxBytes = DefaultMaxRequestBytes
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+        r.Body.Close()
+        if err != nil {
+            http.Error(w, "读取请求体失败", http.StatusBadRequest)
+            return
+        }
+        if int64(len(body)) > maxBytes {
+            http.Error(w, fmt.Sprintf("请求体超过 %d 字节", maxBytes), http.StatusRequestEntityTooLarge)
+            return
+        }
+        if err := ValidateRequest(kind, body); err != nil {
+            verr, ok := err.(*ValidationError)
+            if !ok {
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            }
+            Logger().Info("请求未通过 Schema 校验", "kind", kind, "path", r.URL.Path, "errors", len(verr.Fields))
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(http.StatusUnprocessableEntity)
+            json.NewEncoder(w).Encode(verr)
+            return
+        }
+        r.Body = io.NopCloser(bytes.NewReader(body))
+        r.ContentLength = int64(len(body))
+        next.ServeHTTP(w, r)
+    })
+}
+
+// SchemaHandler 以 application/schema+json 发布 schemas/ 下的文件，路径为 /<种类>.schema.json，
+// 挂载时用 http.StripPrefix 去掉前缀
+func SchemaHandler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        kind := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".schema.json")
+        data, err := RequestSchema(kind)
+        if err != nil {
+            http.NotFound(w, r)
+            return
+        }
+        w.Header().Set("Content-Type", "application/schema+json")
+        w.Write(data)
+    })
+}
+
+// -------------------------------
+//  Schema 解析与校验
+// -------------------------------
+
+// jsonSchema 已解析的 Schema 节点
+type jsonSchema struct {
+    Ref                  string                 `json:"$ref"`
+    Defs                 map[string]*jsonSchema `json:"$defs"`
+    Type                 string                 `json:"type"`
+    Required             []string               `json:"required"`
+    Properties           map[string]*jsonSchema `json:"properties"`
+    AdditionalProperties *bool                  `json:"additionalProperties"`
+    Items                *jsonSchema            `json:"items"`
+    Enum                 []interface{}          `json:"enum"`
+    MinLength            *int                   `json:"minLength"`
+    MaxLength            *int                   `json:"maxLength"`
+    Pattern              string                 `json:"pattern"`
+    Format               string                 `json:"format"`
+    MinItems             *int                   `json:"minItems"`
+    MaxItems             *int                   `json:"maxItems"`
+    Minimum              *float64               `json:"minimum"`
+    Maximum              *float64               `json:"maximum"`
+    If                   *jsonSchema            `json:"if"`
+    Then                 *jsonSchema            `json:"then"`
+    Else                 *jsonSchema            `json:"else"`
+
+    pattern *regexp.Regexp
+}
+
+var (
+    requestSchemasMu sync.Mutex
+    requestSchemas   = map[string]*jsonSchema{}
+)
+
+// loadRequestSchema 解析并缓存 kind 的 Schema
+func loadRequestSchema(kind string) (*jsonSchema, error) {
+    requestSchemasMu.Lock()
+    defer requestSchemasMu.Unlock()
+    if s, ok := requestSchemas[kind]; ok {
+        return s, nil
+    }
+    data, err := RequestSchema(kind)
+    if err != nil {
+        return nil, err
+    }
+    var s jsonSchema
+    if err := json.Unmarshal(data, &s); err != nil {
+        return nil, fmt.Errorf("解析 %s Schema 失败: %v", kind, err)
+    }
+    if err := s.compile(&s); err != nil {
+        return nil, fmt.Errorf("%s Schema 无效: %v", kind, err)
+    }
+    requestSchemas[kind] = &s
+    return &s, nil
+}
+
+// compile 编译各节点的 pattern 并检查 $ref 能够解析
+func (s *jsonSchema) compile(root *jsonSchema) error {
+    if s == nil {
+        return nil
+    }
+    if s.Pattern != "" {
+        re, err := regexp.Compile(s.Pattern)
+        if err != nil {
+            return fmt.Errorf("pattern %q: %v", s.Pattern, err)
+        }
+        s.pattern = re
+    }
+    if s.Ref != "" {
+        if _, err := root.resolve(s.Ref); err != nil {
+            return err
+        }
+    }
+    children := []*jsonSchema{s.Items, s.If, s.Then, s.Else}
+    for _, c := range s.Properties {
+        children = append(children, c)
+    }
+    for _, c := range s.Defs {
+        children = append(children, c)
+    }
+    for _, c := range children {
+        if err := c.compile(root); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// resolve 解析 "#/$defs/<名称>" 形式的引用
+func (s *jsonSchema) resolve(ref string) (*jsonSchema, error) {
+    name := strings.TrimPrefix(ref, "#/$defs/")
+    if def, ok := s.Defs[name]; ok && name != ref {
+        return def, nil
+    }
+    return nil, fmt.Errorf("无法解析 $ref %q", ref)
+}
+
+// validate 将 value 在 path 处的错误追加到 errs
+func (s *jsonSchema) validate(root *jsonSchema, value interface{}, path string, errs *[]FieldError) {
+    fail := func(format string, args ...interface{}) {
+        *errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+    }
+    if s.Ref != "" {
+        def, _ := root.resolve(s.Ref) // compile 已检查
+        def.validate(root, value, path, errs)
+    }
+    if s.Type != "" && !hasJSONType(value, s.Type) {
+        fail("应为 %s 类型", s.Type)
+        return
+    }
+    if len(s.Enum) > 0 {
+        allowed := make([]string, len(s.Enum))
+        match := false
+        for i, e := range s.Enum {
+            quoted, _ := json.Marshal(e)
+            allowed[i] = string(quoted)
+            match = match || fmt.Sprint(e) == fmt.Sprint(value)
+        }
+        if !match {
+            fail("取值须为 %s 之一", strings.Join(allowed, ", "))
+        }
+    }
+
+    switch v := value.(type) {
+    case string:
+        n := utf8.RuneCountInString(v)
+        if s.MinLength != nil && n < *s.MinLength {
+            if *s.MinLength == 1 {
+                fail("不能为空")
+            } else {
+                fail("长度不能少于 %d 个字符", *s.MinLength)
+            }
+        }
+        if s.MaxLength != nil && n > *s.MaxLength {
+            fail("长度不能超过 %d 个字符", *s.MaxLength)
+        }
+        if s.pattern != nil && v != "" && !s.pattern.MatchString(v) {
+            fail("格式不符合 %s", s.Pattern)
+        }
+        if s.Format == "date-time" {
+            if _, err := time.Parse(time.RFC3339, v); err != nil {
+                fail("应为 RFC3339 时间")
+            }
+        }
+    case json.Number:
+        f, _ := v.Float64()
+        if s.Minimum != nil && f < *s.Minimum {
+            fail("不能小于 %v", *s.Minimum)
+        }
+        if s.Maximum != nil && f > *s.Maximum {
+            fail("不能大于 %v", *s.Maximum)
+        }
+    case []interface{}:
+        if s.MinItems != nil && len(v) < *s.MinItems {
+            fail("至少需要 %d 项", *s.MinItems)
+        }
+        if s.MaxItems != nil && len(v) > *s.MaxItems {
+            fail("最多 %d 项", *s.MaxItems)
+        }
+        if s.Items != nil {
+            for i, item := range v {
+                s.Items.validate(root, item, fmt.Sprintf("%s/%d", path, i), errs)
+            }
+        }
+    case map[string]interface{}:
+        for _, name := range s.Required {
+            if _, ok := v[name]; !ok {
+                *errs = append(*errs, FieldError{Field: path + "/" + escapePointer(name), Message: "必填"})
+            }
+        }
+        names := make([]string, 0, len(v))
+        for name := range v {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            field := path + "/" + escapePointer(name)
+            if prop, ok := s.Properties[name]; ok {
+                prop.validate(root, v[name], field, errs)
+            } else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+                *errs = append(*errs, FieldError{Field: field, Message: "不允许的字段"})
+            }
+        }
+    }
+
+    if s.If != nil {
+        var probe []FieldError
+        s.If.validate(root, value, path, &probe)
+        if len(probe) == 0 && s.Then != nil {
+            s.Then.validate(root, value, path, errs)
+        } else if len(probe) > 0 && s.Else != nil {
+            s.Else.validate(root, value, path, errs)
+        }
+    }
+}
+
+// hasJSONType 判断 UseNumber 解码得到的值是否属于 JSON Schema 类型 typ
+func hasJSONType(value interface{}, typ string) bool {
+    switch v := value.(type) {
+    case nil:
+        return typ == "null"
+    case bool:
+        return typ == "boolean"
+    case string:
+        return typ == "string"
+    case json.Number:
+        if typ == "number" {
+            return true
+        }
+        _, err := v.Int64()
+        return typ == "integer" && err == nil
+    case []interface{}:
+        return typ == "array"
+    case map[string]interface{}:
+        return typ == "object"
+    }
+    return false
+}
+
+// escapePointer 按 RFC 6901 转义 JSON Pointer 中的一段
+func escapePointer(s string) string {
+    return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
@@ -0,0 +1,260 @@
+package mapping
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// -------------------------------
+//  文件取回令牌（经网关代理读取 IPFS）
+// -------------------------------
+
+// 默认的令牌有效期
+const defaultRetrievalTokenTTL = 15 * time.Minute
+
+// ErrRetrievalToken 令牌无效、过期或不属于请求的文件
+var ErrRetrievalToken = errors.New("取回令牌无效")
+
+// RetrievalClaims 令牌内容：签发给哪个身份、可取回哪个更新的哪个文件、何时过期
+type RetrievalClaims struct {
+    UpdateID  string `json:"u"`
+    CID       string `json:"c"`
+    Identity  string `json:"i"` // 签发时的查询身份，取回时以它重新检查组织范围
+    ExpiresAt int64  `json:"e"` // Unix 秒
+}
+
+// RetrievalTokens 签发与校验短期的文件取回令牌（HMAC-SHA256）。
+// 令牌格式为 base64url(声明 JSON) "." base64url(签名)，可放在 URL 中分享给没有账号的查看人，
+// 取回时网关代理 IPFS，不暴露 IPFS 节点。
+type RetrievalTokens struct {
+    Key []byte
+    TTL time.Duration // <= 0 时为 15 分钟
+
+    now func() time.Time // 测试替换时钟
+}
+
+// NewRetrievalTokens 以 key 签名；key 为空时生成随机密钥，进程重启后已签发的令牌失效
+func NewRetrievalTokens(key []byte) (*RetrievalTokens, error) {
+    if len(key) == 0 {
+        key = make([]byte, 32)
+        if _, err := rand.Read(key); err != nil {
+            return nil, err
+        }
+    }
+    if len(key) < 16 {
+        return nil, errors.New("取回令牌密钥至少 16 字节")
+    }
+    return &RetrievalTokens{Key: key, TTL: defaultRetrievalTokenTTL}, nil
+}
+
+func (t *RetrievalTokens) clock() time.Time {
+    if t.now != nil {
+        return t.now()
+    }
+    return time.Now()
+}
+
+// Issue 为 identity 签发取回 updateID 中文件 cid 的令牌
+func (t *RetrievalTokens) Issue(updateID string, cid string, identity string) (string, time.Time, error) {
+    ttl := t.TTL
+    if ttl <= 0 {
+        ttl = defaultRetrievalTokenTTL
+    }
+    expires := t.clock().Add(ttl).Truncate(time.Second)
+    payload, err := json.Marshal(RetrievalClaims{UpdateID: updateID, CID: cid, Identity: identity, ExpiresAt: expires.Unix()})
+    if err != nil {
+        return "", time.Time{}, err
+    }
+    enc := base64.RawURLEncoding
+    return enc.EncodeToString(payload) + "." + enc.EncodeToString(t.sign(payload)), expires, nil
+}
+
+// Verify 校验签名与有效期，返回令牌声明
+func (t *RetrievalTokens) Verify(token string) (*RetrievalClaims, error) {
+    enc := base64.RawURLEncoding
+    encoded, sig, ok := strings.Cut(token, ".")
+    if !ok {
+        return nil, ErrRetrievalToken
+    }
+    payload, err := enc.DecodeString(encoded)
+    if err != nil {
+        return nil, ErrRetrievalToken
+    }
+    mac, err := enc.DecodeString(sig)
+    if err != nil || !hmac.Equal(mac, t.sign(payload)) {
+        return nil, ErrRetrievalToken
+    }
+    var claims RetrievalClaims
+    if err := json.Unmarshal(payload, &claims); err != nil {
+        return nil, ErrRetrievalToken
+    }
+    if !t.clock().Before(time.Unix(claims.ExpiresAt, 0)) {
+        return nil, fmt.Errorf("%w: 已过期", ErrRetrievalToken)
+    }
+    return &claims, nil
+}
+
+func (t *RetrievalTokens) sign(payload []byte) []byte {
+    mac := hmac.New(sha256.New, t.Key)
+    mac.Write(payload)
+    return mac.Sum(nil)
+}
+
+// -------------------------------
+//  网关路由
+// -------------------------------
+
+// anchoredFile 以 ctx 的身份查询更新（链码按其组织范围返回），返回更新引用的文件 cid；
+// 查询失败时返回链码错误，文件不属于更新时返回 nil
+func (g *HTTPGateway) anchoredFile(ctx context.Context, updateID string, cid string) (*LedgerAttachment, error) {
+    data, err := g.Ledger.QueryUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    var rec LedgerRecord
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return nil, fmt.Errorf("解析更新 %s 失败: %v", updateID, err)
+    }
+    if rec.InitRecord == nil {
+        return nil, nil
+    }
+    for _, f := range rec.InitRecord.anchoredFiles() {
+        if f.CID == cid {
+            return &f, nil
+        }
+    }
+    return nil, nil
+}
+
+// issueToken 处理 POST /tokens：请求体 {"UpdateID","CID"}，调用方能查询该更新且文件属于该更新时
+// 签发令牌，返回 201 与 {"token","url","expiresAt"}
+func (g *HTTPGateway) issueToken(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+        return
+    }
+    if g.Tokens == nil || g.Ledger == nil || g.Files == nil {
+        http.Error(w, "未配置文件取回", http.StatusServiceUnavailable)
+        return
+    }
+    maxBytes := g.MaxBytes
+    if maxBytes <= 0 {
+        maxBytes = DefaultMaxRequestBytes
+    }
+    var req struct {
+        UpdateID string `json:"UpdateID"`
+        CID      string `json:"CID"`
+    }
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes)).Decode(&req); err != nil || req.UpdateID == "" || req.CID == "" {
+        http.Error(w, "请求体须为 {\"UpdateID\",\"CID\"}", http.StatusBadRequest)
+        return
+    }
+    ctx := gatewayQueryContext(r)
+    identity := InvokeIdentity(ctx)
+    if identity == "" {
+        http.Error(w, "缺少查询参数 userId", http.StatusBadRequest)
+        return
+    }
+    file, err := g.anchoredFile(ctx, req.UpdateID, req.CID)
+    if err != nil {
+        http.Error(w, err.Error(), chaincodeHTTPStatus(err))
+        return
+    }
+    if file == nil {
+        http.Error(w, fmt.Sprintf("更新 %s 没有文件 %s", req.UpdateID, req.CID), http.StatusNotFound)
+        return
+    }
+    token, expires, err := g.Tokens.Issue(req.UpdateID, req.CID, identity)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    Logger().Info("签发文件取回令牌", "updateId", req.UpdateID, "cid", req.CID, "identity", identity, "expiresAt", expires)
+    writeGatewayJSON(w, http.StatusCreated, map[string]string{
+        "token":     token,
+        "url":       "/files/" + url.PathEscape(req.UpdateID) + "/" + url.PathEscape(req.CID) + "?token=" + url.QueryEscape(token),
+        "expiresAt": expires.UTC().Format(time.RFC3339),
+    })
+}
+
+// serveFile 处理 GET /files/<UpdateID>/<CID>?token=<令牌>：无需认证，令牌即授权。
+// 令牌须属于该更新与文件且未过期；取回前以签发时的身份重新查询更新，
+// 身份失去组织范围或文件已不在更新中时拒绝，然后从 Files 读取内容转发给调用方。
+func (g *HTTPGateway) serveFile(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        w.Header().Set("Allow", "GET, HEAD")
+        http.Error(w, "只支持 GET", http.StatusMethodNotAllowed)
+        return
+    }
+    if g.Tokens == nil || g.Ledger == nil || g.Files == nil {
+        http.Error(w, "未配置文件取回", http.StatusServiceUnavailable)
+        return
+    }
+    updateID, cid, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+    if !ok || updateID == "" || cid == "" || strings.Contains(cid, "/") {
+        http.NotFound(w, r)
+        return
+    }
+    claims, err := g.Tokens.Verify(r.URL.Query().Get("token"))
+    if err == nil && (claims.UpdateID != updateID || claims.CID != cid) {
+        err = fmt.Errorf("%w: 令牌不属于该文件", ErrRetrievalToken)
+    }
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusForbidden)
+        return
+    }
+    file, err := g.anchoredFile(WithIdentity(r.Context(), claims.Identity), updateID, cid)
+    if err != nil {
+        status := chaincodeHTTPStatus(err)
+        if status == http.StatusForbidden || status == http.StatusNotFound {
+            Logger().Warn("取回令牌的身份已无法查询更新", "updateId", updateID, "identity", claims.Identity, "err", err)
+            http.Error(w, "令牌签发人已无权查询该更新", http.StatusForbidden)
+            return
+        }
+        http.Error(w, err.Error(), status)
+        return
+    }
+    if file == nil {
+        http.Error(w, fmt.Sprintf("更新 %s 没有文件 %s", updateID, cid), http.StatusNotFound)
+        return
+    }
+
+    body, err := g.Files.Open(r.Context(), cid)
+    if err != nil {
+        status := http.StatusBadGateway
+        if errors.Is(err, ErrContentMissing) {
+            status = http.StatusNotFound
+        }
+        http.Error(w, err.Error(), status)
+        return
+    }
+    defer body.Close()
+    mediaType := file.MediaType
+    if mediaType == "" {
+        mediaType = "application/octet-stream"
+    }
+    w.Header().Set("Content-Type", mediaType)
+    if file.Name != "" {
+        w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}))
+    }
+    w.Header().Set("Cache-Control", "private, no-store")
+    if r.Method == http.MethodHead {
+        return
+    }
+    if _, err := io.Copy(w, body); err != nil {
+        Logger().Warn("转发文件中断", "updateId", updateID, "cid", cid, "err", err)
+    }
+}
@@ -0,0 +1,150 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// fileLedger 两个带文件的更新，deny 中列出的 "身份/更新" 不在组织范围内
+type fileLedger struct {
+    deny map[string]bool
+}
+
+func (l *fileLedger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    if l.deny[InvokeIdentity(ctx)+"/"+updateID] {
+        return nil, errors.New(`{"Code":"UNAUTHORIZED","Message":"out of scope"}`)
+    }
+    rec := LedgerRecord{UpdateID: updateID, InitRecord: &LedgerUpdate{UpdateID: updateID, ModelID: "m1"}}
+    switch updateID {
+    case "u1":
+        rec.InitRecord.Files = []LedgerFile{{Name: "model.ifc", CID: "cidA", Hash: "aa", MimeType: "application/x-step"}}
+    case "u2":
+        rec.InitRecord.Attachments = []LedgerAttachment{{Name: "clash.pdf", CID: "cidB", SHA256: "bb"}}
+    default:
+        return nil, errors.New(`{"Code":"NOT_FOUND"}`)
+    }
+    return json.Marshal(rec)
+}
+
+func (l *fileLedger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    return []byte(`{"Records":[]}`), nil
+}
+
+// memoryContent 按 CID 返回内容的 ContentSource，记录读取次数
+type memoryContent struct {
+    files map[string]string
+    opens int
+}
+
+func (m *memoryContent) Open(ctx context.Context, cid string) (io.ReadCloser, error) {
+    m.opens++
+    content, ok := m.files[cid]
+    if !ok {
+        return nil, ErrContentMissing
+    }
+    return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func retrievalGateway(t *testing.T) (*HTTPGateway, *fileLedger, *memoryContent) {
+    ledger := &fileLedger{deny: map[string]bool{}}
+    content := &memoryContent{files: map[string]string{"cidA": "IFC model", "cidB": "clash report"}}
+    tokens, err := NewRetrievalTokens(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    g := NewHTTPGateway(nil, ledger)
+    g.Tokens, g.Files = tokens, content
+    return g, ledger, content
+}
+
+// issue 以 userID 申请 updateID 中 cid 的令牌，返回取回地址
+func issue(t *testing.T, h http.Handler, userID string, updateID string, cid string) string {
+    rec := httptest.NewRecorder()
+    body, _ := json.Marshal(map[string]string{"UpdateID": updateID, "CID": cid})
+    h.ServeHTTP(rec, httptest.NewRequest("POST", "/tokens?userId="+userID, bytes.NewReader(body)))
+    if rec.Code != http.StatusCreated {
+        t.Fatalf("POST /tokens: status %d: %s", rec.Code, rec.Body.String())
+    }
+    var resp struct {
+        URL string `json:"url"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+        t.Fatal(err)
+    }
+    return resp.URL
+}
+
+func TestRetrievalTokenProxiesFile(t *testing.T) {
+    g, _, _ := retrievalGateway(t)
+    h := g.Handler()
+    target := issue(t, h, "1001", "u1", "cidA")
+
+    // 查看人没有账号，只凭令牌取回
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+    if rec.Code != http.StatusOK || rec.Body.String() != "IFC model" {
+        t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body.String())
+    }
+    if ct := rec.Header().Get("Content-Type"); ct != "application/x-step" {
+        t.Fatalf("Content-Type = %q", ct)
+    }
+    if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "model.ifc") {
+        t.Fatalf("Content-Disposition = %q", cd)
+    }
+}
+
+func TestRetrievalTokenRejections(t *testing.T) {
+    g, ledger, content := retrievalGateway(t)
+    h := g.Handler()
+    target := issue(t, h, "1001", "u1", "cidA")
+    token := target[strings.Index(target, "?token="):]
+    get := func(path string) int {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+        return rec.Code
+    }
+
+    // 令牌属于 u1，不能用来取回 u2 的文件，也不能把 u1 的 CID 挂到 u2 下
+    if code := get("/files/u2/cidB" + token); code != http.StatusForbidden {
+        t.Fatalf("token of u1 on a file of u2: status %d, want 403", code)
+    }
+    if code := get("/files/u2/cidA" + token); code != http.StatusForbidden {
+        t.Fatalf("token of u1 under u2: status %d, want 403", code)
+    }
+    if code := get("/files/u1/cidA?token=" + strings.Replace(token[len("?token="):], ".", ".x", 1)); code != http.StatusForbidden {
+        t.Fatalf("tampered token: status %d, want 403", code)
+    }
+
+    // 签发人失去组织范围后令牌随之失效
+    ledger.deny["1001/u1"] = true
+    if code := get(target); code != http.StatusForbidden {
+        t.Fatalf("token after the issuer lost the scope: status %d, want 403", code)
+    }
+    delete(ledger.deny, "1001/u1")
+
+    // 过期
+    g.Tokens.now = func() time.Time { return time.Now().Add(defaultRetrievalTokenTTL + time.Second) }
+    if code := get(target); code != http.StatusForbidden {
+        t.Fatalf("expired token: status %d, want 403", code)
+    }
+    g.Tokens.now = nil
+    if content.opens != 0 {
+        t.Fatalf("the content source was read %d times for rejected tokens", content.opens)
+    }
+
+    // 不在组织范围内的调用方申请不到令牌
+    ledger.deny["2001/u1"] = true
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest("POST", "/tokens?userId=2001", strings.NewReader(`{"UpdateID":"u1","CID":"cidA"}`)))
+    if rec.Code != http.StatusForbidden {
+        t.Fatalf("POST /tokens out of scope: status %d, want 403", rec.Code)
+    }
+}
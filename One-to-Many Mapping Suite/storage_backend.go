@@ -0,0 +1,424 @@
+package mapping
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base32"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  文件存储后端（IPFS / S3 / MinIO / 本地文件系统）
+// -------------------------------
+
+// 存储后端类型，写入 BIMInitInfo.StorageBackend
+const (
+    StorageIPFS = "ipfs"
+    StorageS3   = "s3"
+    StorageFS   = "fs"
+    // StorageMemory 仅由 NewMemoryBackend 创建（模拟与测试），配置中不可选
+    StorageMemory = "memory"
+)
+
+// StorageConfig 文件存储后端配置，无法运行 IPFS 的站点可改用 s3（含 MinIO）或 fs
+type StorageConfig struct {
+    // Backend ipfs（默认）/ s3 / fs
+    Backend string   `yaml:"backend"`
+    S3      S3Config `yaml:"s3"`
+    // Dir fs 后端的存储目录
+    Dir string `yaml:"dir"`
+    // UploadTimeout 单个文件的上传超时，默认 10 分钟，调用方 ctx 的截止时间更早时以其为准
+    UploadTimeout time.Duration `yaml:"uploadTimeout"`
+}
+
+// defaultUploadTimeout storage.uploadTimeout 未配置时的上传超时
+const defaultUploadTimeout = 10 * time.Minute
+
+// S3Config S3 兼容对象存储（AWS S3、MinIO），对象按路径风格寻址
+type S3Config struct {
+    Endpoint string `yaml:"endpoint"` // 如 https://s3.eu-central-1.amazonaws.com、http://minio:9000
+    Region   string `yaml:"region"`   // 默认 us-east-1（MinIO 的默认区域）
+    Bucket   string `yaml:"bucket"`
+    // Prefix 对象键前缀，如 bim/
+    Prefix    string `yaml:"prefix"`
+    AccessKey string `yaml:"accessKey"`
+    // SecretKey 可写为 secret://<name>，由密钥后端解析
+    SecretKey string `yaml:"secretKey"`
+}
+
+// s3KeyPrefixPattern 对象键前缀只允许无需转义的字符
+var s3KeyPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9/_.-]*$`)
+
+func (s StorageConfig) validate() []string {
+    var problems []string
+    switch s.Backend {
+    case "", StorageIPFS:
+    case StorageS3:
+        // AWS 的地址通常不带端口，不能用 checkEndpoint
+        if u, err := url.Parse(s.S3.Endpoint); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+            problems = append(problems, fmt.Sprintf("storage.s3.endpoint 必须为 http/https 地址，当前为 %q", s.S3.Endpoint))
+        }
+        if s.S3.Bucket == "" {
+            problems = append(problems, "storage.s3.bucket 不能为空")
+        }
+        if s.S3.AccessKey == "" || s.S3.SecretKey == "" {
+            problems = append(problems, "storage.s3.accessKey 与 storage.s3.secretKey 不能为空")
+        }
+        if !s3KeyPrefixPattern.MatchString(s.S3.Prefix) {
+            problems = append(problems, fmt.Sprintf("storage.s3.prefix 只能包含字母、数字与 / _ . -，当前为 %q", s.S3.Prefix))
+        }
+    case StorageFS:
+        if s.Dir == "" {
+            problems = append(problems, "storage.dir 不能为空")
+        }
+    default:
+        problems = append(problems, fmt.Sprintf("storage.backend 必须为 ipfs/s3/fs，当前为 %q", s.Backend))
+    }
+    if s.UploadTimeout < 0 {
+        problems = append(problems, "storage.uploadTimeout 不能为负数")
+    }
+    return problems
+}
+
+// StoredObject 上传结果
+type StoredObject struct {
+    // CID 内容标识：IPFS 后端为 IPFS 返回的 CID，其他后端为按内容计算的 CIDv1（raw，sha2-256），
+    // 与链码的 cid 校验规则兼容
+    CID string
+    URI string // 如 ipfs://<cid>、s3://<bucket>/<key>、file:///<path>
+}
+
+// StorageBackend 文件存储后端
+type StorageBackend interface {
+    Type() string
+    Put(ctx context.Context, name string, content []byte) (*StoredObject, error)
+}
+
+// StorageFetcher 可按 URI 取回文件的存储后端（fs、s3、memory）
+type StorageFetcher interface {
+    Get(ctx context.Context, uri string) ([]byte, error)
+}
+
+// NewStorageBackend 按配置创建存储后端
+func NewStorageBackend(cfg StorageConfig) (StorageBackend, error) {
+    if problems := cfg.validate(); len(problems) > 0 {
+        return nil, fmt.Errorf("存储后端配置无效: %s", strings.Join(problems, "; "))
+    }
+    switch cfg.Backend {
+    case StorageS3:
+        return &S3Backend{Config: cfg.S3}, nil
+    case StorageFS:
+        return &FSBackend{Dir: cfg.Dir}, nil
+    default:
+        return IPFSBackend{}, nil
+    }
+}
+
+var (
+    storageMu     sync.RWMutex
+    activeStorage StorageBackend = IPFSBackend{}
+)
+
+// UseStorageBackend 启用存储后端，之后 ProcessInitialInfo 与 ProcessInitialFiles 经它上传文件；
+// 传 nil 恢复默认的 IPFS。UseConfig 会按 storage 配置调用。
+func UseStorageBackend(b StorageBackend) {
+    if b == nil {
+        b = IPFSBackend{}
+    }
+    storageMu.Lock()
+    activeStorage = b
+    storageMu.Unlock()
+}
+
+// CurrentStorageBackend 返回当前启用的存储后端
+func CurrentStorageBackend() StorageBackend {
+    storageMu.RLock()
+    defer storageMu.RUnlock()
+    return activeStorage
+}
+
+// putFile 经 backend 上传一个文件，受 ctx 与 storage.uploadTimeout 限制。
+// 不响应 ctx 的后端超时后仍在后台运行，但调用方立即返回，不会被卡住的上传一直阻塞。
+func putFile(ctx context.Context, backend StorageBackend, name string, content []byte) (*StoredObject, error) {
+    timeout := CurrentConfig().Storage.UploadTimeout
+    if timeout == 0 {
+        timeout = defaultUploadTimeout
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+
+    type result struct {
+        obj *StoredObject
+        err error
+    }
+    done := make(chan result, 1)
+    go func() {
+        obj, err := backend.Put(ctx, name, content)
+        done <- result{obj, err}
+    }()
+    select {
+    case r := <-done:
+        return r.obj, r.err
+    case <-ctx.Done():
+        Logger().Warn("上传未完成", "fileName", name, "backend", backend.Type(), "err", ctx.Err())
+        return nil, fmt.Errorf("上传 %s 未完成: %w", name, ctx.Err())
+    }
+}
+
+// IPFSBackend 上传到 IPFS（当前为 SimulateIPFSUpload 模拟）
+type IPFSBackend struct{}
+
+// Type 返回 ipfs
+func (IPFSBackend) Type() string { return StorageIPFS }
+
+// Put 上传文件
+func (IPFSBackend) Put(ctx context.Context, name string, content []byte) (*StoredObject, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    cid, _ := SimulateIPFSUpload(content)
+    return &StoredObject{CID: cid, URI: "ipfs://" + cid}, nil
+}
+
+// FSBackend 以内容 SHA-256 为文件名保存到本地目录，相同内容只保存一份
+type FSBackend struct {
+    Dir string
+}
+
+// Type 返回 fs
+func (f *FSBackend) Type() string { return StorageFS }
+
+// Put 写入 Dir/<sha256>，先写临时文件再改名，避免留下不完整的文件
+func (f *FSBackend) Put(ctx context.Context, name string, content []byte) (*StoredObject, error) {
+    dir, err := filepath.Abs(f.Dir)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.MkdirAll(dir, 0o750); err != nil {
+        return nil, fmt.Errorf("创建存储目录失败: %v", err)
+    }
+    sum := sha256.Sum256(content)
+    path := filepath.Join(dir, hex.EncodeToString(sum[:]))
+    obj := &StoredObject{CID: contentCID(sum), URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()}
+    if _, err := os.Stat(path); err == nil {
+        return obj, nil
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    tmp, err := os.CreateTemp(dir, ".upload-*")
+    if err != nil {
+        return nil, err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(content); err != nil {
+        tmp.Close()
+        return nil, fmt.Errorf("写入 %s 失败: %v", name, err)
+    }
+    if err := tmp.Close(); err != nil {
+        return nil, err
+    }
+    if err := os.Rename(tmp.Name(), path); err != nil {
+        return nil, fmt.Errorf("保存 %s 失败: %v", name, err)
+    }
+    return obj, nil
+}
+
+// Get 读取 Put 返回的 file:// 地址，只允许 Dir 下的文件
+func (f *FSBackend) Get(ctx context.Context, uri string) ([]byte, error) {
+    u, err := url.Parse(uri)
+    if err != nil || u.Scheme != "file" {
+        return nil, fmt.Errorf("不是 fs 后端的地址: %s", uri)
+    }
+    dir, err := filepath.Abs(f.Dir)
+    if err != nil {
+        return nil, err
+    }
+    path := filepath.FromSlash(u.Path)
+    if filepath.Dir(path) != dir {
+        return nil, fmt.Errorf("%s 不在存储目录 %s 中", uri, dir)
+    }
+    return os.ReadFile(path)
+}
+
+// MemoryBackend 把文件保存在内存中，供 testnet/simulation 的模拟运行等不需要持久化的场景使用，
+// 可并发调用。CID 与 fs / s3 后端相同，按内容计算。
+type MemoryBackend struct {
+    mu      sync.RWMutex
+    objects map[string][]byte // CID -> 内容
+}
+
+// NewMemoryBackend 创建空的内存存储
+func NewMemoryBackend() *MemoryBackend {
+    return &MemoryBackend{objects: map[string][]byte{}}
+}
+
+// Type 返回 memory
+func (m *MemoryBackend) Type() string { return StorageMemory }
+
+// Put 保存文件，相同内容只保存一份
+func (m *MemoryBackend) Put(ctx context.Context, name string, content []byte) (*StoredObject, error) {
+    cid := contentCID(sha256.Sum256(content))
+    m.mu.Lock()
+    if _, ok := m.objects[cid]; !ok {
+        m.objects[cid] = append([]byte(nil), content...)
+    }
+    m.mu.Unlock()
+    return &StoredObject{CID: cid, URI: "memory://" + cid}, nil
+}
+
+// Get 读取 Put 返回的 memory:// 地址
+func (m *MemoryBackend) Get(ctx context.Context, uri string) ([]byte, error) {
+    cid := strings.TrimPrefix(uri, "memory://")
+    m.mu.RLock()
+    content, ok := m.objects[cid]
+    m.mu.RUnlock()
+    if cid == uri || !ok {
+        return nil, fmt.Errorf("内存存储中没有 %s", uri)
+    }
+    return content, nil
+}
+
+// Len 返回保存的文件数
+func (m *MemoryBackend) Len() int {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    return len(m.objects)
+}
+
+// S3Backend 以内容 SHA-256 为对象键上传到 S3 兼容存储，请求使用 AWS Signature V4 签名
+type S3Backend struct {
+    Config S3Config
+    Client *http.Client
+
+    // Now 签名时间，默认 time.Now
+    Now func() time.Time
+}
+
+// Type 返回 s3
+func (s *S3Backend) Type() string { return StorageS3 }
+
+// Put 上传对象 {prefix}{sha256}
+func (s *S3Backend) Put(ctx context.Context, name string, content []byte) (*StoredObject, error) {
+    sum := sha256.Sum256(content)
+    payloadHash := hex.EncodeToString(sum[:])
+    key := s.Config.Prefix + payloadHash
+
+    endpoint, err := url.Parse(s.Config.Endpoint)
+    if err != nil {
+        return nil, err
+    }
+    target := *endpoint
+    target.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + url.PathEscape(s.Config.Bucket) + "/" + key
+    req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewReader(content))
+    if err != nil {
+        return nil, err
+    }
+    req.ContentLength = int64(len(content))
+    s.sign(req, payloadHash)
+
+    resp, err := httpClient(s.Client).Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        return nil, fmt.Errorf("上传 %s 到 S3 失败: 返回 %d", name, resp.StatusCode)
+    }
+    return &StoredObject{CID: contentCID(sum), URI: "s3://" + s.Config.Bucket + "/" + key}, nil
+}
+
+// Get 下载 Put 返回的 s3://<bucket>/<key> 对象
+func (s *S3Backend) Get(ctx context.Context, uri string) ([]byte, error) {
+    key, ok := strings.CutPrefix(uri, "s3://"+s.Config.Bucket+"/")
+    if !ok || !s3KeyPrefixPattern.MatchString(key) {
+        return nil, fmt.Errorf("不是存储桶 %s 中的对象: %s", s.Config.Bucket, uri)
+    }
+    endpoint, err := url.Parse(s.Config.Endpoint)
+    if err != nil {
+        return nil, err
+    }
+    target := *endpoint
+    target.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + url.PathEscape(s.Config.Bucket) + "/" + key
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+    if err != nil {
+        return nil, err
+    }
+    empty := sha256.Sum256(nil)
+    s.sign(req, hex.EncodeToString(empty[:]))
+
+    resp, err := httpClient(s.Client).Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("从 S3 下载 %s 失败: 返回 %d", uri, resp.StatusCode)
+    }
+    return io.ReadAll(resp.Body)
+}
+
+// sign 按 AWS Signature V4 为请求签名，签名头为 host、x-amz-content-sha256 与 x-amz-date
+func (s *S3Backend) sign(req *http.Request, payloadHash string) {
+    now := time.Now
+    if s.Now != nil {
+        now = s.Now
+    }
+    t := now().UTC()
+    amzDate := t.Format("20060102T150405Z")
+    date := t.Format("20060102")
+    region := s.Config.Region
+    if region == "" {
+        region = "us-east-1"
+    }
+
+    req.Header.Set("x-amz-content-sha256", payloadHash)
+    req.Header.Set("x-amz-date", amzDate)
+    const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+    canonicalRequest := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        req.URL.RawQuery,
+        "host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+        signedHeaders,
+        payloadHash,
+    }, "\n")
+    scope := date + "/" + region + "/s3/aws4_request"
+    requestHash := sha256.Sum256([]byte(canonicalRequest))
+    stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+    key := []byte("AWS4" + s.Config.SecretKey)
+    for _, part := range []string{date, region, "s3", "aws4_request"} {
+        key = hmacSHA256(key, part)
+    }
+    signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+    req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.Config.AccessKey+"/"+scope+
+        ", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    h := hmac.New(sha256.New, key)
+    h.Write([]byte(data))
+    return h.Sum(nil)
+}
+
+// contentCID 按内容 SHA-256 计算 CIDv1（raw 编码，base32 小写），与 IPFS 对单块 raw 文件给出的 CID 一致
+func contentCID(sum [sha256.Size]byte) string {
+    raw := append([]byte{0x01, 0x55, 0x12, 0x20}, sum[:]...)
+    return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+}
@@ -0,0 +1,409 @@
+package mapping
+
+import (
+    "archive/zip"
+    "bytes"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+)
+
+// -------------------------------
+//  报审资料包（审图 / 许可申报）
+// -------------------------------
+
+// LedgerUpdate 链上 BIMUpdate 记录（字段与链码 JSON 保持一致）
+type LedgerUpdate struct {
+    UpdateID    string                     `json:"UpdateID"`
+    ModelID     string                     `json:"ModelID"`
+    Version     string                     `json:"Version"`
+    Description string                     `json:"Description"`
+    Initiator   string                     `json:"Initiator"`
+    Timestamp   string                     `json:"Timestamp"`
+    Signatures  map[string]LedgerSignature `json:"Signatures"`
+    Status      string                     `json:"Status"`
+
+    Files             []LedgerFile          `json:"Files,omitempty"`
+    DetachedSignature string                `json:"DetachedSignature,omitempty"` // 发起人对 Files 的签名
+    Attachments       []LedgerAttachment    `json:"Attachments,omitempty"`
+    ChangeManifest    *LedgerChangeManifest `json:"ChangeManifest,omitempty"`
+
+    InitiatorDepartment string   `json:"InitiatorDepartment,omitempty"`
+    DependsOn           []string `json:"DependsOn,omitempty"` // 其他模型中必须先批准的更新
+
+    PendingAfter   string   `json:"PendingAfter,omitempty"`   // QUEUED 更新等待的同模型更新
+    ConcurrentWith []string `json:"ConcurrentWith,omitempty"` // 提交时同模型正在审批的更新
+
+    ExternalRefs []ExternalRef `json:"ExternalRefs,omitempty"`
+
+    ClientRequestID string `json:"ClientRequestID,omitempty"` // 提交时的幂等键，见 idempotency.go
+}
+
+// LedgerAttachment 链上引用的 IPFS 文件（模型文件、截图、碰撞报告等）
+type LedgerAttachment struct {
+    Name      string `json:"Name"`
+    CID       string `json:"CID"`
+    SHA256    string `json:"SHA256"`
+    MediaType string `json:"MediaType,omitempty"`
+    Size      int64  `json:"Size,omitempty"`
+
+    HashAlgorithm string `json:"HashAlgorithm,omitempty"` // Digest 的算法
+    Digest        string `json:"Digest,omitempty"`
+}
+
+// LedgerFile 链上多文件交付中的一个文件
+type LedgerFile struct {
+    Name          string `json:"Name"`
+    CID           string `json:"CID"`
+    Hash          string `json:"Hash"`
+    HashAlgorithm string `json:"HashAlgorithm,omitempty"` // 为空表示 sha256
+    Size          int64  `json:"Size"`
+    MimeType      string `json:"MimeType,omitempty"`
+}
+
+// anchoredFiles 返回更新引用的全部文件：交付文件在前（转换为附件形式），附件在后
+func (u *LedgerUpdate) anchoredFiles() []LedgerAttachment {
+    files := make([]LedgerAttachment, 0, len(u.Files)+len(u.Attachments))
+    for _, f := range u.Files {
+        att := LedgerAttachment{Name: f.Name, CID: f.CID, MediaType: f.MimeType, Size: f.Size}
+        if f.HashAlgorithm == "" || f.HashAlgorithm == HashSHA256 {
+            att.SHA256 = f.Hash
+        } else {
+            att.HashAlgorithm, att.Digest = f.HashAlgorithm, f.Hash
+        }
+        files = append(files, att)
+    }
+    return append(files, u.Attachments...)
+}
+
+// LedgerChangeManifest 链上的构件变更清单引用，清单内容见 manifest 包
+type LedgerChangeManifest struct {
+    CID      string `json:"CID"`
+    RootHash string `json:"RootHash"`
+    Added    int    `json:"Added"`
+    Modified int    `json:"Modified"`
+    Deleted  int    `json:"Deleted"`
+
+    Categories []string `json:"Categories,omitempty"`
+}
+
+// LedgerApproval 链上 BIMApproval 记录
+type LedgerApproval struct {
+    UpdateID      string                     `json:"UpdateID"`
+    ModelID       string                     `json:"ModelID"`
+    Version       string                     `json:"Version"`
+    Approver      string                     `json:"Approver"`
+    ApproveResult string                     `json:"ApproveResult"`
+    ReasonCode    string                     `json:"ReasonCode,omitempty"`
+    Comment       string                     `json:"Comment"`
+    Timestamp     string                     `json:"Timestamp"`
+    Proof         map[string]LedgerSignature `json:"Proof"`
+}
+
+// LedgerSignature 链码记录的签名提案元数据（提交者证书 + 客户端对提案的签名）
+type LedgerSignature struct {
+    TxID         string `json:"TxID"`
+    MSPID        string `json:"MSPID"`
+    CertSerial   string `json:"CertSerial"`
+    CertSubject  string `json:"CertSubject"`
+    CertIssuer   string `json:"CertIssuer"`
+    ProposalHash string `json:"ProposalHash"`
+    Signature    string `json:"Signature"`
+}
+
+// LedgerRecord QueryContract.QueryUpdate 的返回结构
+type LedgerRecord struct {
+    UpdateID   string          `json:"UpdateID"`
+    InitRecord *LedgerUpdate   `json:"InitRecord"`
+    Approval   *LedgerApproval `json:"ApprovalRecord"`
+}
+
+// ComplianceAttestation 合规性证明（规范审查报告、消防审查意见等）
+type ComplianceAttestation struct {
+    AttestationID string `json:"attestationId"`
+    UpdateID      string `json:"updateId"`
+    Standard      string `json:"standard"` // 例如 GB 50016
+    Result        string `json:"result"`
+    Issuer        string `json:"issuer"`
+    IssuedAt      string `json:"issuedAt"`
+    FileName      string `json:"fileName"`
+    Content       []byte `json:"-"`
+}
+
+// BundleFile 资料包内单个文件的完整性清单条目
+type BundleFile struct {
+    Path   string `json:"path"`
+    Size   int64  `json:"size"`
+    SHA256 string `json:"sha256"`
+}
+
+// BundleIndex 资料包索引（机器可校验）
+type BundleIndex struct {
+    BundleID     string       `json:"bundleId"`
+    Authority    string       `json:"authority"`
+    CreatedAt    string       `json:"createdAt"`
+    Signer       string       `json:"signer"`
+    Updates      []string     `json:"updates"`
+    Attestations []string     `json:"attestations"`
+    Files        []BundleFile `json:"files"`
+}
+
+// BundleRequest 生成资料包的输入
+type BundleRequest struct {
+    BundleID     string
+    Authority    string
+    Signer       string
+    Records      []*LedgerRecord
+    Attestations []*ComplianceAttestation
+    // VerifyApproval 校验审批签名，为空时使用 DefaultApprovalVerifier
+    VerifyApproval func(rec *LedgerRecord) error
+}
+
+const (
+    bundleStatusPublished = "PUBLISHED"
+    bundleApproved        = "APPROVED"
+
+    bundleIndexPath     = "index.json"
+    bundleSignaturePath = "index.sig"
+)
+
+// bundleModTime 固定 ZIP 条目时间，文件时间不参与校验
+var bundleModTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// DefaultApprovalVerifier 校验审批记录与更新记录一致，且审批人留有签名凭证
+func DefaultApprovalVerifier(rec *LedgerRecord) error {
+    appr := rec.Approval
+    if appr == nil {
+        return fmt.Errorf("更新 %s 缺少审批记录", rec.UpdateID)
+    }
+    if appr.ApproveResult != bundleApproved {
+        return fmt.Errorf("更新 %s 审批结果为 %s", rec.UpdateID, appr.ApproveResult)
+    }
+    init := rec.InitRecord
+    if appr.UpdateID != init.UpdateID || appr.ModelID != init.ModelID || appr.Version != init.Version {
+        return fmt.Errorf("更新 %s 的审批记录与更新记录不一致", rec.UpdateID)
+    }
+    sig, ok := appr.Proof[appr.Approver]
+    if !ok || sig.Signature == "" {
+        return fmt.Errorf("更新 %s 缺少审批人 %s 的签名", rec.UpdateID, appr.Approver)
+    }
+    return nil
+}
+
+// BuildSubmissionBundle 组装报审资料包并签名，返回 ZIP 字节
+func BuildSubmissionBundle(req *BundleRequest, signer crypto.Signer) ([]byte, error) {
+    if req == nil || signer == nil {
+        return nil, errors.New("资料包请求或签名者为空")
+    }
+    if req.BundleID == "" {
+        return nil, errors.New("BundleID 不能为空")
+    }
+    if len(req.Records) == 0 {
+        return nil, errors.New("资料包至少需要一条已发布的更新")
+    }
+    verify := req.VerifyApproval
+    if verify == nil {
+        verify = DefaultApprovalVerifier
+    }
+
+    files := map[string][]byte{}
+    index := BundleIndex{
+        BundleID:  req.BundleID,
+        Authority: req.Authority,
+        CreatedAt: time.Now().UTC().Format(time.RFC3339),
+        Signer:    req.Signer,
+    }
+
+    // 1. 已发布更新 + 审批记录
+    included := map[string]bool{}
+    for _, rec := range req.Records {
+        if rec == nil || rec.InitRecord == nil {
+            return nil, errors.New("更新记录为空")
+        }
+        if rec.InitRecord.Status != bundleStatusPublished {
+            return nil, fmt.Errorf("更新 %s 状态为 %s，只能提交已发布的更新", rec.UpdateID, rec.InitRecord.Status)
+        }
+        if included[rec.UpdateID] {
+            return nil, fmt.Errorf("更新 %s 重复", rec.UpdateID)
+        }
+        if err := verify(rec); err != nil {
+            return nil, err
+        }
+        data, err := json.MarshalIndent(rec, "", "  ")
+        if err != nil {
+            return nil, err
+        }
+        files["updates/"+rec.UpdateID+".json"] = data
+        included[rec.UpdateID] = true
+        index.Updates = append(index.Updates, rec.UpdateID)
+    }
+
+    // 2. 合规性证明
+    for _, att := range req.Attestations {
+        if att == nil || att.AttestationID == "" {
+            return nil, errors.New("合规性证明缺少 AttestationID")
+        }
+        if !included[att.UpdateID] {
+            return nil, fmt.Errorf("合规性证明 %s 关联的更新 %s 不在资料包中", att.AttestationID, att.UpdateID)
+        }
+        meta, err := json.MarshalIndent(att, "", "  ")
+        if err != nil {
+            return nil, err
+        }
+        dir := "attestations/" + att.AttestationID + "/"
+        files[dir+"attestation.json"] = meta
+        if len(att.Content) > 0 {
+            name := att.FileName
+            if name == "" || strings.ContainsAny(name, "/\\") {
+                return nil, fmt.Errorf("合规性证明 %s 的文件名无效", att.AttestationID)
+            }
+            files[dir+name] = att.Content
+        }
+        index.Attestations = append(index.Attestations, att.AttestationID)
+    }
+
+    // 3. 完整性清单
+    paths := make([]string, 0, len(files))
+    for p := range files {
+        paths = append(paths, p)
+    }
+    sort.Strings(paths)
+    for _, p := range paths {
+        index.Files = append(index.Files, BundleFile{
+            Path:   p,
+            Size:   int64(len(files[p])),
+            SHA256: sha256Hex(files[p]),
+        })
+    }
+
+    indexBytes, err := json.MarshalIndent(index, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+
+    // 4. 对索引签名
+    digest := sha256.Sum256(indexBytes)
+    sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+    if err != nil {
+        return nil, fmt.Errorf("资料包签名失败: %v", err)
+    }
+
+    // 5. 写出 ZIP
+    buf := &bytes.Buffer{}
+    zw := zip.NewWriter(buf)
+    write := func(name string, data []byte) error {
+        w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: bundleModTime})
+        if err != nil {
+            return err
+        }
+        _, err = w.Write(data)
+        return err
+    }
+    if err := write(bundleIndexPath, indexBytes); err != nil {
+        return nil, err
+    }
+    if err := write(bundleSignaturePath, []byte(hex.EncodeToString(sig))); err != nil {
+        return nil, err
+    }
+    for _, p := range paths {
+        if err := write(p, files[p]); err != nil {
+            return nil, err
+        }
+    }
+    if err := zw.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+// VerifySubmissionBundle 校验资料包签名以及清单中每个文件的哈希，返回索引
+func VerifySubmissionBundle(bundle []byte, pub crypto.PublicKey) (*BundleIndex, error) {
+    zr, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+    if err != nil {
+        return nil, fmt.Errorf("资料包格式错误: %v", err)
+    }
+
+    contents := map[string][]byte{}
+    for _, f := range zr.File {
+        rc, err := f.Open()
+        if err != nil {
+            return nil, err
+        }
+        data, err := io.ReadAll(rc)
+        rc.Close()
+        if err != nil {
+            return nil, err
+        }
+        contents[f.Name] = data
+    }
+
+    indexBytes, ok := contents[bundleIndexPath]
+    if !ok {
+        return nil, errors.New("资料包缺少 index.json")
+    }
+    sigHex, ok := contents[bundleSignaturePath]
+    if !ok {
+        return nil, errors.New("资料包缺少 index.sig")
+    }
+    sig, err := hex.DecodeString(string(sigHex))
+    if err != nil {
+        return nil, fmt.Errorf("签名格式错误: %v", err)
+    }
+    digest := sha256.Sum256(indexBytes)
+    if err := verifyDigest(pub, digest[:], sig); err != nil {
+        return nil, fmt.Errorf("资料包%v", err)
+    }
+
+    var index BundleIndex
+    if err := json.Unmarshal(indexBytes, &index); err != nil {
+        return nil, fmt.Errorf("索引解析失败: %v", err)
+    }
+    listed := map[string]bool{bundleIndexPath: true, bundleSignaturePath: true}
+    for _, bf := range index.Files {
+        data, ok := contents[bf.Path]
+        if !ok {
+            return nil, fmt.Errorf("资料包缺少文件 %s", bf.Path)
+        }
+        if int64(len(data)) != bf.Size || sha256Hex(data) != bf.SHA256 {
+            return nil, fmt.Errorf("文件 %s 哈希不匹配", bf.Path)
+        }
+        listed[bf.Path] = true
+    }
+    for name := range contents {
+        if !listed[name] {
+            return nil, fmt.Errorf("资料包包含未登记的文件 %s", name)
+        }
+    }
+    return &index, nil
+}
+
+func verifyDigest(pub crypto.PublicKey, digest, sig []byte) error {
+    switch k := pub.(type) {
+    case *ecdsa.PublicKey:
+        if !ecdsa.VerifyASN1(k, digest, sig) {
+            return errors.New("签名无效")
+        }
+    case *rsa.PublicKey:
+        if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+            return errors.New("签名无效")
+        }
+    default:
+        return fmt.Errorf("不支持的公钥类型 %T", pub)
+    }
+    return nil
+}
+
+func sha256Hex(data []byte) string {
+    sum := sha256.Sum256(data)
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,248 @@
+package mapping
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// -------------------------------
+//  提交配额（按用户 / 部门 / 天）
+// -------------------------------
+
+// QuotaConfig 每天允许封装的交易数，0 表示不限
+type QuotaConfig struct {
+    UserDaily       int `yaml:"userDaily"`
+    DepartmentDaily int `yaml:"departmentDaily"`
+    // Departments 个别部门的每日上限，覆盖 departmentDaily
+    Departments map[string]int `yaml:"departments"`
+    // StorePath 计数文件路径，为空时只保存在内存中（重启后清零）
+    StorePath string `yaml:"storePath"`
+}
+
+// Enabled 是否配置了任何上限
+func (q QuotaConfig) Enabled() bool {
+    if q.UserDaily > 0 || q.DepartmentDaily > 0 {
+        return true
+    }
+    for _, n := range q.Departments {
+        if n > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+func (q QuotaConfig) validate() []string {
+    var problems []string
+    if q.UserDaily < 0 {
+        problems = append(problems, "quota.userDaily 不能为负数")
+    }
+    if q.DepartmentDaily < 0 {
+        problems = append(problems, "quota.departmentDaily 不能为负数")
+    }
+    for _, dept := range sortedKeys(q.Departments) {
+        if q.Departments[dept] < 0 {
+            problems = append(problems, fmt.Sprintf("quota.departments.%s 不能为负数", dept))
+        }
+    }
+    return problems
+}
+
+// departmentLimit 部门的每日上限
+func (q QuotaConfig) departmentLimit(department string) int {
+    if n, ok := q.Departments[department]; ok {
+        return n
+    }
+    return q.DepartmentDaily
+}
+
+// 配额范围
+const (
+    QuotaScopeUser       = "user"
+    QuotaScopeDepartment = "department"
+)
+
+// QuotaExceededError 超出提交配额，调用方可据 ResetAt 决定何时重试
+type QuotaExceededError struct {
+    Scope   string    `json:"scope"`   // user / department
+    Subject string    `json:"subject"` // 用户 ID 或部门
+    Limit   int       `json:"limit"`
+    Used    int       `json:"used"`
+    Day     string    `json:"day"`
+    ResetAt time.Time `json:"resetAt"`
+}
+
+func (e *QuotaExceededError) Error() string {
+    scope := "用户"
+    if e.Scope == QuotaScopeDepartment {
+        scope = "部门"
+    }
+    return fmt.Sprintf("%s %s 在 %s 的提交已达上限 %d 次，%s 后重置", scope, e.Subject, e.Day, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// IsQuotaExceeded 判断 err 是否为超出配额
+func IsQuotaExceeded(err error) bool {
+    var qe *QuotaExceededError
+    return errors.As(err, &qe)
+}
+
+// QuotaStore 配额计数存储
+type QuotaStore interface {
+    // Reserve 若 limits 中所有计数都未达上限，则全部加一并返回 ""；
+    // 否则不计数，返回第一个已达上限的键及其已用次数
+    Reserve(day string, limits map[string]int) (exceeded string, used int, err error)
+}
+
+// LocalQuotaStore 本地计数存储，只保留当天计数；Path 非空时每次计数后写入 JSON 文件
+type LocalQuotaStore struct {
+    Path string
+
+    mu     sync.Mutex
+    loaded bool
+    state  quotaState
+}
+
+type quotaState struct {
+    Day    string         `json:"day"`
+    Counts map[string]int `json:"counts"`
+}
+
+// Reserve 实现 QuotaStore
+func (s *LocalQuotaStore) Reserve(day string, limits map[string]int) (string, int, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.load(); err != nil {
+        return "", 0, err
+    }
+    if s.state.Day != day {
+        s.state = quotaState{Day: day, Counts: map[string]int{}}
+    }
+    keys := sortedKeys(limits)
+    for _, key := range keys {
+        if limit := limits[key]; limit > 0 && s.state.Counts[key] >= limit {
+            return key, s.state.Counts[key], nil
+        }
+    }
+    for _, key := range keys {
+        s.state.Counts[key]++
+    }
+    return "", 0, s.save()
+}
+
+func (s *LocalQuotaStore) load() error {
+    if s.loaded {
+        return nil
+    }
+    s.loaded = true
+    s.state = quotaState{Counts: map[string]int{}}
+    if s.Path == "" {
+        return nil
+    }
+    data, err := os.ReadFile(s.Path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("读取配额计数失败: %v", err)
+    }
+    if err := json.Unmarshal(data, &s.state); err != nil {
+        return fmt.Errorf("解析配额计数失败: %v", err)
+    }
+    if s.state.Counts == nil {
+        s.state.Counts = map[string]int{}
+    }
+    return nil
+}
+
+func (s *LocalQuotaStore) save() error {
+    if s.Path == "" {
+        return nil
+    }
+    data, err := json.Marshal(s.state)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(s.Path), 0o700); err != nil {
+        return err
+    }
+    tmp := s.Path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, s.Path)
+}
+
+// QuotaLimiter 在封装交易前检查并扣减配额
+type QuotaLimiter struct {
+    Config QuotaConfig
+    Store  QuotaStore
+    // Now 当前时间，默认 time.Now；按其时区划分自然日
+    Now func() time.Time
+}
+
+// NewQuotaLimiter 按配置创建配额限制器，计数保存在 cfg.StorePath
+func NewQuotaLimiter(cfg QuotaConfig) *QuotaLimiter {
+    return &QuotaLimiter{Config: cfg, Store: &LocalQuotaStore{Path: cfg.StorePath}, Now: time.Now}
+}
+
+// Reserve 为用户的一次提交扣减用户与部门配额；超出时返回 *QuotaExceededError 且不扣减
+func (l *QuotaLimiter) Reserve(user *UserInfo) error {
+    limits := map[string]int{}
+    if l.Config.UserDaily > 0 {
+        limits[QuotaScopeUser+":"+user.UserID] = l.Config.UserDaily
+    }
+    if n := l.Config.departmentLimit(user.Department); n > 0 {
+        limits[QuotaScopeDepartment+":"+user.Department] = n
+    }
+    if len(limits) == 0 {
+        return nil
+    }
+
+    now := l.Now()
+    day := now.Format("2006-01-02")
+    key, used, err := l.Store.Reserve(day, limits)
+    if err != nil {
+        return fmt.Errorf("配额计数失败: %v", err)
+    }
+    if key == "" {
+        return nil
+    }
+    y, m, d := now.Date()
+    qe := &QuotaExceededError{
+        Scope:   QuotaScopeUser,
+        Subject: user.UserID,
+        Limit:   limits[key],
+        Used:    used,
+        Day:     day,
+        ResetAt: time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()),
+    }
+    if key != QuotaScopeUser+":"+user.UserID {
+        qe.Scope, qe.Subject = QuotaScopeDepartment, user.Department
+    }
+    Logger().Warn("提交超出配额", "userId", user.UserID, "department", user.Department, "scope", qe.Scope, "limit", qe.Limit)
+    return qe
+}
+
+var (
+    quotaMu     sync.RWMutex
+    activeQuota *QuotaLimiter
+)
+
+// UseQuotaLimiter 启用配额限制，之后 PackageProjectTransaction 在封装前扣减配额；传 nil 关闭
+func UseQuotaLimiter(l *QuotaLimiter) {
+    quotaMu.Lock()
+    activeQuota = l
+    quotaMu.Unlock()
+}
+
+// CurrentQuotaLimiter 返回当前启用的配额限制器，未启用时为 nil
+func CurrentQuotaLimiter() *QuotaLimiter {
+    quotaMu.RLock()
+    defer quotaMu.RUnlock()
+    return activeQuota
+}
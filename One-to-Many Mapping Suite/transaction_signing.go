@@ -0,0 +1,156 @@
+package mapping
+
+import (
+    "bytes"
+    "crypto"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// -------------------------------
+//  交易规范化序列化与签名
+// -------------------------------
+
+// CanonicalBytes 返回交易的规范化字节：JSON 对象键按字典序排列、无多余空白、
+// 不转义 HTML 字符、数字保持原样；Digest 与 Signature 字段不参与序列化。
+// 同一笔交易在任何平台上得到相同的字节，可用于提交前后独立校验。
+func (tx *Transaction) CanonicalBytes() ([]byte, error) {
+    unsigned := *tx
+    unsigned.Digest = ""
+    unsigned.Signature = ""
+
+    canonical, err := canonicalJSON(&unsigned)
+    if err != nil {
+        return nil, fmt.Errorf("交易序列化失败: %v", err)
+    }
+    return canonical, nil
+}
+
+// canonicalJSON 按 CanonicalBytes 的规则序列化任意值
+func canonicalJSON(value interface{}) ([]byte, error) {
+    raw, err := json.Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+    dec := json.NewDecoder(bytes.NewReader(raw))
+    dec.UseNumber()
+    var v interface{}
+    if err := dec.Decode(&v); err != nil {
+        return nil, err
+    }
+
+    // encoding/json 对 map 的键排序，重新编码即得到规范形式
+    buf := &bytes.Buffer{}
+    enc := json.NewEncoder(buf)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+    return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ComputeDigest 返回规范化字节的 SHA-256（十六进制）
+func (tx *Transaction) ComputeDigest() (string, error) {
+    canonical, err := tx.CanonicalBytes()
+    if err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256(canonical)
+    return hex.EncodeToString(sum[:]), nil
+}
+
+// SignTransaction 使用用户私钥对交易摘要签名，写入 Digest 与 Signature（Base64）
+// 支持 ECDSA（ASN.1）与 RSA（PKCS#1 v1.5）密钥
+func SignTransaction(tx *Transaction, signer crypto.Signer) error {
+    if tx == nil || signer == nil {
+        return errors.New("交易或签名者为空")
+    }
+    digest, err := tx.ComputeDigest()
+    if err != nil {
+        return err
+    }
+    sum, _ := hex.DecodeString(digest)
+    sig, err := signer.Sign(rand.Reader, sum, crypto.SHA256)
+    if err != nil {
+        return fmt.Errorf("交易签名失败: %v", err)
+    }
+    tx.Digest = digest
+    tx.Signature = base64.StdEncoding.EncodeToString(sig)
+    return nil
+}
+
+// VerifyTransaction 重新计算摘要并用用户公钥校验签名
+func VerifyTransaction(tx *Transaction, pub crypto.PublicKey) error {
+    if tx == nil {
+        return errors.New("交易为空")
+    }
+    digest, err := tx.ComputeDigest()
+    if err != nil {
+        return err
+    }
+    if tx.Digest != digest {
+        return fmt.Errorf("交易摘要不一致：记录为 %s，实际为 %s", tx.Digest, digest)
+    }
+    if tx.Signature == "" {
+        return errors.New("交易未签名")
+    }
+    sig, err := base64.StdEncoding.DecodeString(tx.Signature)
+    if err != nil {
+        return fmt.Errorf("签名格式错误: %v", err)
+    }
+    sum, _ := hex.DecodeString(digest)
+    return verifyDigest(pub, sum, sig)
+}
+
+// FilesDigest 返回交付文件的签名摘要，与链码 filesDigest 一致：
+// 按 Files 顺序对每个文件取一行 "<算法>:<小写十六进制指纹>\n"，整体做 SHA-256
+func FilesDigest(files []FileEntry) []byte {
+    h := sha256.New()
+    for _, f := range files {
+        algorithm := f.HashAlgorithm
+        if algorithm == "" {
+            algorithm = HashSHA256
+        }
+        fmt.Fprintf(h, "%s:%s\n", algorithm, strings.ToLower(f.Hash))
+    }
+    return h.Sum(nil)
+}
+
+// SignDeliveryFiles 使用发起人证书对应的私钥对 info.Files 签名，写入 DetachedSignature（Base64）。
+// 链码在 InitBIMUpdate 中用提交者证书的公钥校验，证明发起人签署的正是这些文件内容。
+func SignDeliveryFiles(info *BIMInitInfo, signer crypto.Signer) error {
+    if info == nil || signer == nil {
+        return errors.New("BIM 信息或签名者为空")
+    }
+    if len(info.Files) == 0 {
+        return errors.New("没有可签名的交付文件")
+    }
+    sig, err := signer.Sign(rand.Reader, FilesDigest(info.Files), crypto.SHA256)
+    if err != nil {
+        return fmt.Errorf("文件签名失败: %v", err)
+    }
+    info.DetachedSignature = base64.StdEncoding.EncodeToString(sig)
+    return nil
+}
+
+// VerifyDeliverySignature 用发起人公钥校验链上更新的 DetachedSignature
+func VerifyDeliverySignature(update *LedgerUpdate, pub crypto.PublicKey) error {
+    if update == nil || update.DetachedSignature == "" {
+        return errors.New("更新没有文件签名")
+    }
+    sig, err := base64.StdEncoding.DecodeString(update.DetachedSignature)
+    if err != nil {
+        return fmt.Errorf("签名格式错误: %v", err)
+    }
+    files := make([]FileEntry, len(update.Files))
+    for i, f := range update.Files {
+        files[i] = FileEntry{Name: f.Name, CID: f.CID, Hash: f.Hash, HashAlgorithm: f.HashAlgorithm}
+    }
+    return verifyDigest(pub, FilesDigest(files), sig)
+}
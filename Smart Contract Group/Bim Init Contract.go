@@ -3,6 +3,7 @@ package chaincode
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -16,22 +17,128 @@ type SmartContract struct {
 
 // BIMUpdate represents an initialization request for a BIM model update
 type BIMUpdate struct {
-	UpdateID    string            `json:"UpdateID"`
-	ModelID     string            `json:"ModelID"`
-	Version     string            `json:"Version"`
-	Description string            `json:"Description"`
-	Initiator   string            `json:"Initiator"`
-	Timestamp   string            `json:"Timestamp"`
-	Signatures  map[string]string `json:"Signatures"` // map[endorserID]signaturePlaceholder
-	Status      string            `json:"Status"`     // e.g., "INITIALIZED", "APPROVED", "REJECTED", "PUBLISHED"
+	UpdateID    string                       `json:"UpdateID" validate:"required,max=64,id"`
+	ModelID     string                       `json:"ModelID" validate:"required,max=64,id"`
+	Version     string                       `json:"Version" validate:"required,max=32,version"`
+	Description string                       `json:"Description" validate:"max=4096"`
+	Initiator   string                       `json:"Initiator"`
+	Timestamp   string                       `json:"Timestamp"`
+	Signatures  map[string]ProposalSignature `json:"Signatures"`                                       // map[creatorID]signed-proposal metadata
+	Status      string                       `json:"Status"`                                           // e.g., "INITIALIZED", "APPROVED", "REJECTED", "PUBLISHED"
+	ReviewMode  string                       `json:"ReviewMode,omitempty" validate:"oneof=OPEN|BLIND"` // "OPEN" (default) or "BLIND"
+
+	// initiator's department certificate attribute, set by the chaincode
+	InitiatorDepartment string `json:"InitiatorDepartment,omitempty"`
+
+	// ClientRequestID makes submission idempotent: a retry with the same ID from the same
+	// initiator returns the UpdateID of the first attempt
+	ClientRequestID string `json:"ClientRequestID,omitempty" validate:"max=128,id"`
+
+	// replay protection for payloads signed off-chain (see bim_payload_nonce.go): a nonce is
+	// accepted once per initiator, and only before ExpiresAt (RFC3339); the optional SignedAt
+	// (RFC3339) must lie within the network's clock skew of the transaction timestamp
+	Nonce     string `json:"Nonce,omitempty" validate:"max=128,id"`
+	ExpiresAt string `json:"ExpiresAt,omitempty"`
+	SignedAt  string `json:"SignedAt,omitempty"`
+
+	// the delivered files: the IFC model plus linked files such as DWG references,
+	// point clouds and schedules, all stored in IPFS and submitted together
+	Files []FileEntry `json:"Files,omitempty" validate:"dive"`
+
+	// optional base64 signature over the file hashes made with the initiator's certificate
+	// key, verified at submission (see bim_detached_signature.go)
+	DetachedSignature string `json:"DetachedSignature,omitempty"`
+
+	// large payloads (screenshots, clash reports) stay off-chain and are referenced here
+	Attachments []Attachment `json:"Attachments,omitempty" validate:"dive"`
+
+	// element-level changes against the previous version, produced by the mapping suite's manifest package
+	ChangeManifest *ChangeManifest `json:"ChangeManifest,omitempty" validate:"dive"`
+
+	// cross-links to items in a cloud CDE such as Autodesk Forge / BIM 360 (see bim_external_refs.go)
+	ExternalRefs []ExternalRef `json:"ExternalRefs,omitempty" validate:"dive"`
+
+	// coordination constraints: updates of other models that must be APPROVED or PUBLISHED
+	// before this one can be approved, e.g. an MEP revision depending on a structure revision
+	DependsOn []string `json:"DependsOn,omitempty"`
+
+	// concurrent submissions for the same model, set by the chaincode (see bim_concurrency.go)
+	PendingAfter   string   `json:"PendingAfter,omitempty"`   // open update this QUEUED update waits for
+	ConcurrentWith []string `json:"ConcurrentWith,omitempty"` // updates under review when this one was submitted
+
+	// resubmission lineage: set by ResubmitBIMUpdate, never by the client
+	PreviousUpdateID string `json:"PreviousUpdateID,omitempty"` // rejected update this one replaces
+	RevisionNumber   int    `json:"RevisionNumber,omitempty"`   // 0 for the original submission
+
+	SchemaVersion int `json:"SchemaVersion"` // see bim_schema.go
+}
+
+// Attachment references an off-chain payload stored in IPFS
+type Attachment struct {
+	Name      string `json:"Name" validate:"required,max=256"`
+	CID       string `json:"CID" validate:"required,cid"`
+	SHA256    string `json:"SHA256" validate:"required,sha256"` // hex digest of the payload, checked by clients after fetching
+	MediaType string `json:"MediaType,omitempty" validate:"max=128"`
+	Size      int64  `json:"Size,omitempty"`
+
+	// optional second fingerprint in an algorithm mandated by a national BIM standard
+	HashAlgorithm string `json:"HashAlgorithm,omitempty" validate:"oneof=sha256|sha3-512|blake3|sha256-tree"`
+	Digest        string `json:"Digest,omitempty" validate:"hex"` // hex digest of the payload in HashAlgorithm
+}
+
+// FileEntry is one file of a model delivery stored in IPFS
+type FileEntry struct {
+	Name     string `json:"Name" validate:"required,max=256"`
+	CID      string `json:"CID" validate:"required,cid"`
+	Hash     string `json:"Hash" validate:"required,hex"` // hex digest of the file in HashAlgorithm
+	Size     int64  `json:"Size"`
+	MimeType string `json:"MimeType,omitempty" validate:"max=128"`
+
+	HashAlgorithm string `json:"HashAlgorithm,omitempty" validate:"oneof=sha256|sha3-512|blake3|sha256-tree"` // default sha256
+}
+
+// digestHexLengths is the hex length of a digest per Attachment.HashAlgorithm
+var digestHexLengths = map[string]int{
+	"sha256":   64,
+	"sha3-512": 128,
+	"blake3":   64,
+
+	"sha256-tree": 64, // Merkle root over SHA-256 digests of 4 MiB blocks
+}
+
+// ChangeManifest references the list of added / modified / deleted element GUIDs
+// (with per-element hashes) stored in IPFS. RootHash is the Merkle root over the
+// entries, so approvers can check the fetched manifest against the ledger.
+type ChangeManifest struct {
+	CID      string `json:"CID" validate:"required,cid"`
+	RootHash string `json:"RootHash" validate:"required,sha256"`
+	Added    int    `json:"Added"`
+	Modified int    `json:"Modified"`
+	Deleted  int    `json:"Deleted"`
+
+	// IFC entity types of the changed elements (IFCWALL, IFCSLAB, IFCDUCTSEGMENT, ...);
+	// routes the update through the model's responsibility matrix (see bim_responsibility_matrix.go)
+	Categories []string `json:"Categories,omitempty"`
 }
 
+// maxAttachments limits the number of off-chain references per update
+const maxAttachments = 32
+
+// maxFiles limits the number of delivered files per update
+const maxFiles = 64
+
+// maxDependencies limits the number of DependsOn entries per update
+const maxDependencies = 16
+
 // Role constants (these should match attributes set in certificates)
 const (
 	RoleAttrName       = "role"
 	RoleModeler        = "modeler"
 	RoleProfessional   = "professional"
 	RoleBIMLead        = "bim_lead"
+	RoleAuditor        = "auditor"
+	RoleSurveyor       = "surveyor"
+	RoleAdmin          = "admin" // network settings, see ConfigContract
 	EventBIMInit       = "BIMUpdateInitialized"
 	StatusInitialized  = "INITIALIZED"
 )
@@ -44,99 +151,256 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 // InitBIMUpdate initializes a BIM model update transaction on the ledger.
 // - caller must have role=modeler (or other allowed roles per policy)
 // - validates incoming payload
-// - collects creator identity and a placeholder for endorsement/signature
-// - stores the BIMUpdate with status INITIALIZED and emits an event
-func (s *SmartContract) InitBIMUpdate(ctx contractapi.TransactionContextInterface, updateJSON string) error {
+// - collects creator identity and signed proposal metadata
+// - stores the BIMUpdate with status INITIALIZED, or PENDING_VALIDATION if the network requires it, and emits an event
+// - an empty UpdateID is generated server-side unless the network config sets UpdateIDStrategy none
+// - returns the UpdateID; a retry with the same ClientRequestID returns the first UpdateID
+func (s *SmartContract) InitBIMUpdate(ctx contractapi.TransactionContextInterface, updateJSON string) (updateID string, err error) {
+	log := txLogger(ctx)
+	defer func() { logOutcome(log, err) }()
+
 	// permission check
 	if err := authorizeCallerRole(ctx, RoleModeler); err != nil {
-		return fmt.Errorf("authorization failed: %v", err)
+		return "", fmt.Errorf("authorization failed: %v", err)
 	}
 
 	// parse input
 	var input BIMUpdate
 	if err := json.Unmarshal([]byte(updateJSON), &input); err != nil {
-		return fmt.Errorf("failed to parse update JSON: %v", err)
+		return "", fmt.Errorf("failed to parse update JSON: %v", err)
 	}
+	input.PreviousUpdateID = ""
+	input.RevisionNumber = 0
 
-	// basic validation
-	if input.UpdateID == "" {
-		return fmt.Errorf("UpdateID is required")
+	return s.initUpdate(ctx, &input)
+}
+
+// ResubmitBIMUpdate creates a new update replacing a REJECTED or VALIDATION_FAILED one.
+// - caller must have role=modeler
+// - the new update inherits ModelID (and Version, if none is given) from the rejected update
+// - PreviousUpdateID links back to the rejected update and RevisionNumber is incremented
+// - a rejected update can only be resubmitted once
+func (s *SmartContract) ResubmitBIMUpdate(ctx contractapi.TransactionContextInterface, previousUpdateID string, updateJSON string) (updateID string, err error) {
+	log := txLogger(ctx).With("previousUpdateID", previousUpdateID)
+	defer func() { logOutcome(log, err) }()
+
+	if err := authorizeCallerRole(ctx, RoleModeler); err != nil {
+		return "", fmt.Errorf("authorization failed: %v", err)
 	}
-	if input.ModelID == "" {
-		return fmt.Errorf("ModelID is required")
+
+	previous, err := updates.GetUpdate(ctx, previousUpdateID)
+	if err != nil {
+		return "", err
 	}
-	if input.Version == "" {
-		return fmt.Errorf("Version is required")
+	if previous.Status != StatusRejected && previous.Status != StatusValidationFailed {
+		return "", errInvalidState("update %s is %s, only REJECTED or VALIDATION_FAILED updates can be resubmitted", previousUpdateID, previous.Status)
 	}
 
-	// check existence
-	exists, err := s.UpdateExists(ctx, input.UpdateID)
+	var input BIMUpdate
+	if err := json.Unmarshal([]byte(updateJSON), &input); err != nil {
+		return "", fmt.Errorf("failed to parse update JSON: %v", err)
+	}
+
+	resubmitted, err := resubmissionsOf(ctx, previousUpdateID)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if exists {
-		return fmt.Errorf("update %s already exists", input.UpdateID)
+	if len(resubmitted) > 0 {
+		// a retried resubmission returns the update created by the first attempt
+		if input.ClientRequestID != "" {
+			creatorID, err := getSubmittingClientID(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to get creator identity: %v", err)
+			}
+			existing, err := updateStore{}.forClientRequest(ctx, creatorID, input.ClientRequestID)
+			if err != nil {
+				return "", err
+			}
+			if existing == resubmitted[0] {
+				return existing, nil
+			}
+		}
+		return "", errInvalidState("update %s was already resubmitted as %s", previousUpdateID, resubmitted[0])
+	}
+	if input.ModelID != "" && input.ModelID != previous.ModelID {
+		return "", fmt.Errorf("resubmission must keep ModelID %s", previous.ModelID)
+	}
+	input.ModelID = previous.ModelID
+	if input.Version == "" {
+		input.Version = previous.Version
+	}
+	if input.ReviewMode == "" {
+		input.ReviewMode = previous.ReviewMode
+	}
+	input.PreviousUpdateID = previous.UpdateID
+	input.RevisionNumber = previous.RevisionNumber + 1
+
+	return s.initUpdate(ctx, &input)
+}
+
+// initUpdate validates and stores a new update with status INITIALIZED, emits an event
+// and returns the UpdateID. A retried request with a known ClientRequestID returns the
+// UpdateID stored by the first attempt without writing anything.
+func (s *SmartContract) initUpdate(ctx contractapi.TransactionContextInterface, input *BIMUpdate) (string, error) {
+	// generate an UpdateID when the client did not choose one (see bim_update_id.go)
+	if input.UpdateID == "" {
+		id, err := newUpdateID(ctx)
+		if err != nil {
+			return "", err
+		}
+		input.UpdateID = id
+	}
+
+	// field validation (see the validate tags on BIMUpdate)
+	if err := validateStruct(input); err != nil {
+		return "", err
+	}
+	if len(input.Attachments) > maxAttachments {
+		return "", fmt.Errorf("too many attachments: %d (max %d)", len(input.Attachments), maxAttachments)
+	}
+	for i, att := range input.Attachments {
+		if (att.HashAlgorithm == "") != (att.Digest == "") {
+			return "", fmt.Errorf("attachment %d: HashAlgorithm and Digest must be set together", i)
+		}
+		if att.Digest != "" && len(att.Digest) != digestHexLengths[att.HashAlgorithm] {
+			return "", fmt.Errorf("attachment %d: %s digest must be %d hex characters", i, att.HashAlgorithm, digestHexLengths[att.HashAlgorithm])
+		}
+	}
+
+	if err := checkFiles(input.Files); err != nil {
+		return "", err
+	}
+	if err := verifyDetachedSignature(ctx, input); err != nil {
+		return "", err
+	}
+
+	if err := checkExternalRefs(input); err != nil {
+		return "", err
+	}
+	if err := checkDependencies(ctx, input); err != nil {
+		return "", err
 	}
 
 	// capture creator identity
 	creatorID, err := getSubmittingClientID(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get creator identity: %v", err)
+		return "", fmt.Errorf("failed to get creator identity: %v", err)
+	}
+
+	// idempotent retry: the same client request was already committed
+	if input.ClientRequestID != "" {
+		existing, err := updateStore{}.forClientRequest(ctx, creatorID, input.ClientRequestID)
+		if err != nil {
+			return "", err
+		}
+		if existing != "" {
+			return existing, nil
+		}
+	}
+
+	// design freeze: locked models accept no new updates (see bim_model_lock.go)
+	if err := checkModelLock(ctx, input.ModelID); err != nil {
+		return "", err
+	}
+
+	// pre-signed payloads: reject expired or replayed ones
+	if err := checkPayloadFreshness(ctx, input, creatorID); err != nil {
+		return "", err
+	}
+
+	// check existence
+	exists, err := s.UpdateExists(ctx, input.UpdateID)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", errDuplicate("update %s already exists", input.UpdateID)
 	}
 
 	// attach initiator and timestamp
+	department, err := getCallerDepartment(ctx)
+	if err != nil {
+		return "", err
+	}
 	input.Initiator = creatorID
-	input.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	input.InitiatorDepartment = department
+	txTime, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	input.Timestamp = txTime.Format(time.RFC3339)
 	input.Status = StatusInitialized
+	input.SchemaVersion = schemaVersion(schemaBIMUpdate)
+	input.PendingAfter = ""
+	input.ConcurrentWith = nil
+	if err := checkConcurrentUpdates(ctx, input); err != nil {
+		return "", err
+	}
+	if err := applyValidationPhase(ctx, input); err != nil {
+		return "", err
+	}
 
-	// gather endorsement signatures placeholder
+	// capture the creator's signed proposal metadata
 	// In Fabric chaincode we cannot directly collect peer endorsements; however,
-	// we can capture the client's identity and signed proposal metadata as a placeholder.
-	sigMap := map[string]string{}
-	sigMap[creatorID] = fmt.Sprintf("sig:%s", ctx.GetStub().GetTxID())
-	input.Signatures = sigMap
+	// the client's certificate and its signature over the proposal are available.
+	sig, err := captureProposalSignature(ctx)
+	if err != nil {
+		return "", err
+	}
+	input.Signatures = map[string]ProposalSignature{creatorID: sig}
 
 	// write to world state
-	data, err := json.Marshal(input)
+	data, err := updateStore{}.create(ctx, input)
 	if err != nil {
-		return fmt.Errorf("failed to marshal BIMUpdate: %v", err)
+		return "", err
 	}
 
-	if err := ctx.GetStub().PutState(input.UpdateID, data); err != nil {
-		return fmt.Errorf("failed to put BIMUpdate to world state: %v", err)
+	// assign the reviewers responsible for the changed element categories
+	if err := routeByResponsibility(ctx, input); err != nil {
+		return "", err
 	}
 
 	// emit event so off-chain components (endorsement collectors, UI) can react
 	if err := ctx.GetStub().SetEvent(EventBIMInit, data); err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return "", fmt.Errorf("failed to set event: %v", err)
 	}
 
+	return input.UpdateID, nil
+}
+
+// checkFiles enforces the file count, unique names and digest lengths of a delivery
+func checkFiles(files []FileEntry) error {
+	if len(files) > maxFiles {
+		return fmt.Errorf("too many files: %d (max %d)", len(files), maxFiles)
+	}
+	names := make(map[string]bool, len(files))
+	for i, f := range files {
+		if names[f.Name] {
+			return fmt.Errorf("file %d: duplicate name %q", i, f.Name)
+		}
+		names[f.Name] = true
+		if f.Size < 0 {
+			return fmt.Errorf("file %d: Size must not be negative", i)
+		}
+		algorithm := f.HashAlgorithm
+		if algorithm == "" {
+			algorithm = "sha256"
+		}
+		if len(f.Hash) != digestHexLengths[algorithm] {
+			return fmt.Errorf("file %d: %s digest must be %d hex characters", i, algorithm, digestHexLengths[algorithm])
+		}
+	}
 	return nil
 }
 
 // UpdateExists returns whether a BIMUpdate with given id exists
 func (s *SmartContract) UpdateExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
-	b, err := ctx.GetStub().GetState(id)
-	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	return b != nil, nil
+	return updateStore{}.exists(ctx, id)
 }
 
 // ReadUpdate retrieves a BIMUpdate from world state
 func (s *SmartContract) ReadUpdate(ctx contractapi.TransactionContextInterface, id string) (*BIMUpdate, error) {
-	data, err := ctx.GetStub().GetState(id)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
-	}
-	if data == nil {
-		return nil, fmt.Errorf("the update %s does not exist", id)
-	}
-	var update BIMUpdate
-	if err := json.Unmarshal(data, &update); err != nil {
-		return nil, err
-	}
-	return &update, nil
+	return updates.GetUpdate(ctx, id)
 }
 
 // Helper: getSubmittingClientID returns a human-readable ID for the transaction submitter
@@ -152,30 +416,57 @@ func getSubmittingClientID(ctx contractapi.TransactionContextInterface) (string,
 	return id, nil
 }
 
-// authorizeCallerRole checks the caller's certificate attribute 'role' equals expected
-func authorizeCallerRole(ctx contractapi.TransactionContextInterface, expected string) error {
+// getSubmittingClientMSPID returns the MSP ID of the transaction submitter's organization
+func getSubmittingClientMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
 	ci, err := cid.New(ctx.GetStub())
 	if err != nil {
-		return fmt.Errorf("failed to create client identity: %v", err)
+		return "", err
 	}
-	role, found, err := ci.GetAttributeValue(RoleAttrName)
+	return ci.GetMSPID()
+}
+
+// getCallerRole returns the caller's effective role, or "" if it is not set
+// An unexpired RoleGrant takes precedence over the 'role' certificate attribute, see RoleAdminContract.
+func getCallerRole(ctx contractapi.TransactionContextInterface) (string, error) {
+	ci, err := callerIdentity(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read attribute '%s': %v", RoleAttrName, err)
+		return "", err
 	}
-	if !found {
-		return fmt.Errorf("attribute '%s' not found in identity", RoleAttrName)
+	effective, err := effectiveRole(ctx, ci)
+	if err != nil {
+		return "", err
 	}
-	if role != expected {
-		return fmt.Errorf("caller role '%s' not authorized (expected '%s')", role, expected)
+	return effective.Role, nil
+}
+
+// authorizeCallerRole checks the caller's effective role equals one of the expected roles
+// The role comes from an unexpired RoleGrant, else from the certificate attribute 'role'.
+// The caller's certificate must also be unexpired and not revoked, see callerIdentity.
+func authorizeCallerRole(ctx contractapi.TransactionContextInterface, expected ...string) error {
+	ci, err := callerIdentity(ctx)
+	if err != nil {
+		return err
 	}
-	return nil
+	effective, err := effectiveRole(ctx, ci)
+	if err != nil {
+		return err
+	}
+	if effective.Role == "" {
+		return errUnauthorized("attribute '%s' not found in identity and no role granted", RoleAttrName)
+	}
+	for _, r := range expected {
+		if effective.Role == r {
+			return nil
+		}
+	}
+	return errUnauthorized("caller role '%s' not authorized (expected '%s')", effective.Role, strings.Join(expected, "' or '"))
 }
 
 // Note:
-// - This contract focuses on initialization. Approval, proof-generation, and query contracts
-//   should be implemented separately as described in your design.
+// - This contract focuses on initialization and owns the BIMUpdate records. Approval,
+//   proof-generation, and query contracts access them through the UpdateStatus interface.
 // - Endorsement collection in Fabric happens at the client/peer level. Chaincode can store
 //   endorsement metadata or placeholders; actual peer signatures are available in the
 //   proposal/endorsement objects but are typically processed outside chaincode logic.
-// - For production, extend validation (schema, business rules), better error handling,
-//   and logging, and integrate with off-chain services (notification/consensus helpers).
+// - For production, extend validation (schema, business rules) and error handling, and
+//   integrate with off-chain services (notification/consensus helpers).
@@ -0,0 +1,181 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AccessLogContract audits reads. The gateway invokes LogAccess on behalf of the
+// reader whenever someone fetches the history of a model; recording is optional
+// and left to the gateway, queries can never detect a read that was not logged.
+type AccessLogContract struct {
+    contractapi.Contract
+}
+
+// Purpose codes accepted by LogAccess
+const (
+    AccessPurposeReview       = "REVIEW"
+    AccessPurposeCoordination = "COORDINATION"
+    AccessPurposeAudit        = "AUDIT"
+    AccessPurposeHandover     = "HANDOVER"
+    AccessPurposeLegal        = "LEGAL"
+    AccessPurposeOther        = "OTHER"
+)
+
+// BIMAccessLog records that an identity read an update and why
+type BIMAccessLog struct {
+    AccessID   string `json:"AccessID"` // transaction ID of LogAccess
+    UpdateID   string `json:"UpdateID" validate:"required,max=64,id"`
+    ModelID    string `json:"ModelID"`
+    Reader     string `json:"Reader"`
+    ReaderMSP  string `json:"ReaderMSP"`
+    ReaderRole string `json:"ReaderRole,omitempty"`
+    Purpose    string `json:"Purpose" validate:"required,oneof=REVIEW|COORDINATION|AUDIT|HANDOVER|LEGAL|OTHER"`
+    Timestamp  string `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventAccessLogged = "BIMAccessLogged"
+)
+
+// LogAccess records that the caller read updateID for the given purpose and returns the AccessID
+// - Any enrolled identity may log its own reads; the reader is always the caller
+// - Purpose must be one of REVIEW, COORDINATION, AUDIT, HANDOVER, LEGAL, OTHER
+func (ac *AccessLogContract) LogAccess(ctx contractapi.TransactionContextInterface, updateID string, purpose string) (string, error) {
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return "", err
+    }
+    entry := BIMAccessLog{
+        AccessID:      ctx.GetStub().GetTxID(),
+        UpdateID:      updateID,
+        Purpose:       purpose,
+        Timestamp:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaBIMAccessLog),
+    }
+    if err := validateStruct(&entry); err != nil {
+        return "", err
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return "", err
+    }
+    entry.ModelID = update.ModelID
+
+    if entry.Reader, err = getSubmittingClientID(ctx); err != nil {
+        return "", fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if entry.ReaderMSP, err = getSubmittingClientMSPID(ctx); err != nil {
+        return "", fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    if entry.ReaderRole, err = getCallerRole(ctx); err != nil {
+        return "", err
+    }
+
+    if err := putSubRecord(ctx, accessLogObjectType, []string{entry.ModelID, entry.AccessID}, &entry, EventAccessLogged); err != nil {
+        return "", err
+    }
+    if err := putIndexEntry(ctx, accessReaderIndexType, entry.Reader, entry.ModelID, entry.AccessID); err != nil {
+        return "", err
+    }
+    return entry.AccessID, nil
+}
+
+// QueryModelAccess lists who read updates of a model, oldest first
+// - Caller must have role=bim_lead or role=auditor
+func (ac *AccessLogContract) QueryModelAccess(ctx contractapi.TransactionContextInterface, modelID string) ([]*BIMAccessLog, error) {
+    if err := authorizeCallerRole(ctx, RoleBIMLead, RoleAuditor); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accessLogObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query access log: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMAccessLog{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var entry BIMAccessLog
+        if err := decodeRecord(schemaBIMAccessLog, kv.Value, &entry); err != nil {
+            return nil, fmt.Errorf("failed to parse access log entry: %v", err)
+        }
+        result = append(result, &entry)
+    }
+    sortAccessLog(result)
+    return result, nil
+}
+
+// QueryReaderAccess lists which models a reader accessed, oldest first
+// - Caller must have role=bim_lead or role=auditor
+func (ac *AccessLogContract) QueryReaderAccess(ctx contractapi.TransactionContextInterface, readerID string) ([]*BIMAccessLog, error) {
+    if err := authorizeCallerRole(ctx, RoleBIMLead, RoleAuditor); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    if readerID == "" {
+        return nil, fmt.Errorf("readerID required")
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accessReaderIndexType, []string{readerID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query reader index: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMAccessLog{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, accessReaderIndexType)
+        if err != nil {
+            continue
+        }
+        entry, err := readAccessLog(ctx, attrs[1], attrs[2])
+        if err != nil {
+            return nil, err
+        }
+        if entry != nil {
+            result = append(result, entry)
+        }
+    }
+    sortAccessLog(result)
+    return result, nil
+}
+
+// sortAccessLog orders entries by time; keys are ordered by transaction ID
+func sortAccessLog(entries []*BIMAccessLog) {
+    sort.SliceStable(entries, func(i, j int) bool {
+        return entries[i].Timestamp < entries[j].Timestamp
+    })
+}
+
+func readAccessLog(ctx contractapi.TransactionContextInterface, modelID string, accessID string) (*BIMAccessLog, error) {
+    key, err := makeKey(ctx, accessLogObjectType, modelID, accessID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read access log entry: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var entry BIMAccessLog
+    if err := decodeRecord(schemaBIMAccessLog, data, &entry); err != nil {
+        return nil, fmt.Errorf("failed to parse access log entry: %v", err)
+    }
+    return &entry, nil
+}
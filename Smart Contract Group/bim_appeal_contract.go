@@ -0,0 +1,245 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// AppealContract lets the initiator contest a rejection. While an appeal is pending
+// the update is APPEALED; a bim_lead ruling either upholds the rejection (final, no
+// further appeal) or overturns it, which returns the update to INITIALIZED with the
+// earlier votes cleared so it is reviewed again. Appeals and the overturned decision
+// stay on the ledger as the trail.
+type AppealContract struct {
+    contractapi.Contract
+}
+
+// BIMAppeal is an appeal against the rejection of an update
+type BIMAppeal struct {
+    UpdateID      string `json:"UpdateID"`
+    AppealID      string `json:"AppealID"` // transaction ID of AppealRejection
+    Appellant     string `json:"Appellant"`
+    Justification string `json:"Justification" validate:"required,max=4096"`
+    FiledAt       string `json:"FiledAt"`
+    Status        string `json:"Status"` // PENDING / UPHELD / OVERTURNED
+
+    // Rejection is the decision being appealed
+    Rejection *BIMApproval `json:"Rejection,omitempty"`
+
+    RuledBy       string `json:"RuledBy,omitempty"`
+    RulingComment string `json:"RulingComment,omitempty"`
+    RuledAt       string `json:"RuledAt,omitempty"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    StatusAppealed = "APPEALED"
+
+    AppealPending    = "PENDING"
+    AppealUpheld     = "UPHELD"
+    AppealOverturned = "OVERTURNED"
+
+    EventRejectionAppealed = "BIMRejectionAppealed"
+    EventAppealRuled       = "BIMAppealRuled"
+)
+
+// AppealRejection contests the rejection of an update
+// - Caller must be the initiator of the update
+// - The update must be REJECTED, not resubmitted, and without an upheld appeal
+// - justification is required
+// - Emits BIMRejectionAppealed
+func (ac *AppealContract) AppealRejection(ctx contractapi.TransactionContextInterface, updateID string, justification string) (err error) {
+    log := txLogger(ctx).With("updateID", updateID)
+    defer func() { logOutcome(log, err) }()
+
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if callerID != update.Initiator {
+        return fmt.Errorf("only the initiator of update %s can appeal its rejection", updateID)
+    }
+    if update.Status != StatusRejected {
+        return errInvalidState("update %s is %s, only REJECTED updates can be appealed", updateID, update.Status)
+    }
+    resubmitted, err := resubmissionsOf(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if len(resubmitted) > 0 {
+        return errInvalidState("update %s was already resubmitted as %s", updateID, resubmitted[0])
+    }
+    previous, err := appealsOf(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    for _, a := range previous {
+        if a.Status == AppealUpheld {
+            return fmt.Errorf("rejection of update %s was upheld on appeal %s and is final", updateID, a.AppealID)
+        }
+    }
+    rejection, err := (&ApprovalContract{}).QueryApproval(ctx, updateID)
+    if err != nil {
+        return err
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    appeal := BIMAppeal{
+        UpdateID:      updateID,
+        AppealID:      ctx.GetStub().GetTxID(),
+        Appellant:     callerID,
+        Justification: justification,
+        FiledAt:       txTime.Format(time.RFC3339),
+        Status:        AppealPending,
+        Rejection:     rejection,
+        SchemaVersion: schemaVersion(schemaBIMAppeal),
+    }
+    if err := validateStruct(&appeal); err != nil {
+        return err
+    }
+    if _, err := updates.SetStatus(ctx, updateID, StatusAppealed); err != nil {
+        return fmt.Errorf("failed to update status: %v", err)
+    }
+    return putSubRecord(ctx, appealObjectType, []string{updateID, appeal.AppealID}, &appeal, EventRejectionAppealed)
+}
+
+// RuleOnAppeal decides a pending appeal
+//   - Caller must have role=bim_lead
+//   - ruling is UPHELD (the update returns to REJECTED for good) or OVERTURNED
+//     (the update returns to INITIALIZED and its votes and decision record are cleared)
+//   - Emits BIMAppealRuled
+func (ac *AppealContract) RuleOnAppeal(ctx contractapi.TransactionContextInterface,
+    updateID string, appealID string, ruling string, comment string) (err error) {
+    log := txLogger(ctx).With("updateID", updateID, "appealID", appealID, "ruling", ruling)
+    defer func() { logOutcome(log, err) }()
+
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if ruling != AppealUpheld && ruling != AppealOverturned {
+        return fmt.Errorf("invalid ruling: must be UPHELD or OVERTURNED")
+    }
+    if comment == "" {
+        return fmt.Errorf("comment required")
+    }
+    appeal, err := readAppeal(ctx, updateID, appealID)
+    if err != nil {
+        return err
+    }
+    if appeal.Status != AppealPending {
+        return errInvalidState("appeal %s was already ruled %s", appealID, appeal.Status)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    status := StatusRejected
+    if ruling == AppealOverturned {
+        status = StatusInitialized
+        if err := clearDecision(ctx, updateID); err != nil {
+            return err
+        }
+    }
+    if _, err := updates.SetStatus(ctx, updateID, status); err != nil {
+        return fmt.Errorf("failed to update status: %v", err)
+    }
+
+    appeal.Status = ruling
+    appeal.RuledBy = callerID
+    appeal.RulingComment = comment
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    appeal.RuledAt = txTime.Format(time.RFC3339)
+    return putSubRecord(ctx, appealObjectType, []string{updateID, appealID}, appeal, EventAppealRuled)
+}
+
+// QueryAppeals returns every appeal filed against the rejection of an update
+func (ac *AppealContract) QueryAppeals(ctx contractapi.TransactionContextInterface, updateID string) ([]*BIMAppeal, error) {
+    if updateID == "" {
+        return nil, fmt.Errorf("updateID required")
+    }
+    return appealsOf(ctx, updateID)
+}
+
+// clearDecision removes the votes and the decision record of an update so it can be reviewed again
+func clearDecision(ctx contractapi.TransactionContextInterface, updateID string) error {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(approvalVoteObjectType, []string{updateID})
+    if err != nil {
+        return fmt.Errorf("failed to query approval votes: %v", err)
+    }
+    var keys []string
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            iterator.Close()
+            return err
+        }
+        keys = append(keys, kv.Key)
+    }
+    iterator.Close()
+
+    decisionKey, err := approvalKey(ctx, updateID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    for _, key := range append(keys, decisionKey) {
+        if err := ctx.GetStub().DelState(key); err != nil {
+            return fmt.Errorf("failed to clear approval record: %v", err)
+        }
+    }
+    return nil
+}
+
+func readAppeal(ctx contractapi.TransactionContextInterface, updateID string, appealID string) (*BIMAppeal, error) {
+    key, err := makeKey(ctx, appealObjectType, updateID, appealID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read appeal: %v", err)
+    }
+    if data == nil {
+        return nil, errNotFound("appeal %s not found on update %s", appealID, updateID)
+    }
+    var appeal BIMAppeal
+    if err := decodeRecord(schemaBIMAppeal, data, &appeal); err != nil {
+        return nil, fmt.Errorf("failed to parse appeal: %v", err)
+    }
+    return &appeal, nil
+}
+
+func appealsOf(ctx contractapi.TransactionContextInterface, updateID string) ([]*BIMAppeal, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(appealObjectType, []string{updateID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query appeals: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMAppeal{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var appeal BIMAppeal
+        if err := decodeRecord(schemaBIMAppeal, kv.Value, &appeal); err != nil {
+            return nil, fmt.Errorf("failed to parse appeal: %v", err)
+        }
+        result = append(result, &appeal)
+    }
+    return result, nil
+}
@@ -1,12 +1,10 @@
 package chaincode
 
 import (
-    "encoding/json"
     "fmt"
     "time"
 
     "github.com/hyperledger/fabric-contract-api-go/contractapi"
-    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 )
 
 // ApprovalContract handles BIM model update approval workflow
@@ -16,33 +14,61 @@ type ApprovalContract struct {
 
 // BIMApproval extends update info with approval data
 type BIMApproval struct {
-    UpdateID      string            `json:"UpdateID"`
-    ModelID       string            `json:"ModelID"`
-    Version       string            `json:"Version"`
-    Approver      string            `json:"Approver"`
-    ApproveResult string            `json:"ApproveResult"` // APPROVED / REJECTED
-    Comment       string            `json:"Comment"`
-    Timestamp     string            `json:"Timestamp"`
-    Proof         map[string]string `json:"Proof"` // map[approverID]signaturePlaceholder
+    UpdateID      string                       `json:"UpdateID"`
+    ModelID       string                       `json:"ModelID"`
+    Version       string                       `json:"Version"`
+    Approver      string                       `json:"Approver"`
+    Department    string                       `json:"Department,omitempty"` // approver's department attribute
+    ApproveResult string                       `json:"ApproveResult"`        // APPROVED / REJECTED
+    ReasonCode    string                       `json:"ReasonCode,omitempty"` // set for REJECTED, see Reason* constants
+    Role          string                       `json:"Role,omitempty"`       // approver's role attribute
+    Weight        int                          `json:"Weight,omitempty"`     // vote weight under the model's approval policy
+    Comment       string                       `json:"Comment"`
+    Timestamp     string                       `json:"Timestamp"`
+    Proof         map[string]ProposalSignature `json:"Proof"` // map[approverID]signed-proposal metadata
+
+    SchemaVersion int `json:"SchemaVersion"`
 }
 
 const (
     StatusApproved = "APPROVED"
     StatusRejected = "REJECTED"
+    StatusPublished = "PUBLISHED"
     EventBIMApprove = "BIMUpdateApproved"
+    EventBIMReject  = "BIMUpdateRejected"
+    EventBIMPublish = "BIMUpdatePublished"
 )
 
-// ApproveBIMUpdate performs approval or rejection of an update
-// - Caller must have role=professional
-// - Requires UpdateID and approval decision
-// - Writes approval proof and updates status
-func (c *ApprovalContract) ApproveBIMUpdate(ctx contractapi.TransactionContextInterface,
-    updateID string, approveResult string, comment string) error {
+// Rejection reason codes, so downstream tooling can route rework automatically
+const (
+    ReasonClash             = "CLASH"
+    ReasonStandardViolation = "STANDARD_VIOLATION"
+    ReasonIncomplete        = "INCOMPLETE"
+    ReasonOther             = "OTHER"
+)
 
-    // --- Permission Check: only professional roles allowed ---
-    if err := authorizeCallerRole(ctx, RoleProfessional); err != nil {
-        return fmt.Errorf("authorization failed: %v", err)
+// validRejectionReason reports whether code is one of the Reason* constants
+func validRejectionReason(code string) bool {
+    switch code {
+    case ReasonClash, ReasonStandardViolation, ReasonIncomplete, ReasonOther:
+        return true
     }
+    return false
+}
+
+// ApproveBIMUpdate records an approval or rejection vote on an update
+// - Caller must have one of the roles of the model's approval policy (default role=professional)
+// - When reviewers are assigned to the update, caller must be one of them
+// - APPROVED votes are refused until every DependsOn update is APPROVED or PUBLISHED
+// - Requires UpdateID and approval decision; the update must be INITIALIZED
+// - REJECTED requires a reasonCode (CLASH, STANDARD_VIOLATION, INCOMPLETE, OTHER) and a comment
+// - Each approver votes once; a single rejection rejects the update
+// - The update becomes APPROVED once the approving votes satisfy the approval policy
+// - Emits BIMUpdateApproved, BIMUpdateRejected, or BIMApprovalVoteRecorded while approvals are pending
+func (c *ApprovalContract) ApproveBIMUpdate(ctx contractapi.TransactionContextInterface,
+    updateID string, approveResult string, comment string, reasonCode string) (err error) {
+    log := txLogger(ctx).With("updateID", updateID, "result", approveResult, "reasonCode", reasonCode)
+    defer func() { logOutcome(log, err) }()
 
     if updateID == "" {
         return fmt.Errorf("updateID required")
@@ -50,75 +76,226 @@ func (c *ApprovalContract) ApproveBIMUpdate(ctx contractapi.TransactionContextIn
     if approveResult != StatusApproved && approveResult != StatusRejected {
         return fmt.Errorf("invalid approveResult: must be APPROVED or REJECTED")
     }
+    if approveResult == StatusRejected {
+        if !validRejectionReason(reasonCode) {
+            return fmt.Errorf("invalid reasonCode: must be CLASH, STANDARD_VIOLATION, INCOMPLETE or OTHER")
+        }
+        if comment == "" {
+            return fmt.Errorf("comment required when rejecting")
+        }
+    } else if reasonCode != "" {
+        return fmt.Errorf("reasonCode only applies to REJECTED")
+    }
 
-    // --- Load existing update ---
-    updateBytes, err := ctx.GetStub().GetState(updateID)
+    // --- Load existing update (owned by the init contract) ---
+    initUpdate, err := updates.GetUpdate(ctx, updateID)
     if err != nil {
-        return fmt.Errorf("failed to read update: %v", err)
+        // an unknown update is checked against the default policy, so that callers
+        // without the role cannot tell from the error whether it exists
+        if err := authorizeCallerRole(ctx, RoleProfessional); err != nil {
+            return fmt.Errorf("authorization failed: %v", err)
+        }
+        return err
     }
-    if updateBytes == nil {
-        return fmt.Errorf("update %s does not exist", updateID)
+
+    // --- Permission Check: roles allowed by the model's approval policy, before the
+    // update's status or dependencies show up in an error ---
+    policy, err := approvalPolicyFor(ctx, initUpdate.ModelID)
+    if err != nil {
+        return err
+    }
+    if err := authorizeCallerRole(ctx, policy.RequiredRoles...); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    role, err := getCallerRole(ctx)
+    if err != nil {
+        return err
     }
 
-    var initUpdate BIMUpdate
-    if err := json.Unmarshal(updateBytes, &initUpdate); err != nil {
-        return fmt.Errorf("failed to parse update: %v", err)
+    if initUpdate.Status != StatusInitialized {
+        return errInvalidState("update %s is %s, only INITIALIZED updates can be reviewed", updateID, initUpdate.Status)
+    }
+    if approveResult == StatusApproved {
+        unmet, err := unmetDependencies(ctx, initUpdate)
+        if err != nil {
+            return err
+        }
+        if len(unmet) > 0 {
+            return fmt.Errorf("update %s depends on updates not yet approved: %s", updateID, describeDependencies(unmet))
+        }
     }
 
-    // --- Approver identity ---
+    // --- Approver identity: one vote per approver ---
     approverID, err := getSubmittingClientID(ctx)
     if err != nil {
         return fmt.Errorf("failed to get approver ID: %v", err)
     }
+    if err := authorizeAssignedReviewer(ctx, updateID, approverID); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    voted, err := hasVoted(ctx, updateID, approverID)
+    if err != nil {
+        return err
+    }
+    if voted {
+        return errDuplicate("caller already voted on update %s", updateID)
+    }
+    voterID := approverID
+    department, err := getCallerDepartment(ctx)
+    if err != nil {
+        return err
+    }
+
+    // --- Capture the approver's signed proposal as proof ---
+    sig, err := captureProposalSignature(ctx)
+    if err != nil {
+        return err
+    }
+
+    // --- Blind review: the approval is recorded under a pseudonym, and the proof,
+    // which names the approver's certificate, is kept with the pseudonym mapping ---
+    if initUpdate.ReviewMode == ReviewModeBlind {
+        approverID, err = recordReviewerIdentity(ctx, updateID, approverID, &sig)
+        if err != nil {
+            return err
+        }
+        sig = ProposalSignature{TxID: sig.TxID}
+    }
 
     // --- Build approval record ---
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
     approval := BIMApproval{
         UpdateID:      updateID,
         ModelID:       initUpdate.ModelID,
         Version:       initUpdate.Version,
         Approver:      approverID,
+        Department:    department,
+        Role:          role,
+        Weight:        policy.weightOf(role),
         ApproveResult: approveResult,
+        ReasonCode:    reasonCode,
         Comment:       comment,
-        Timestamp:     time.Now().UTC().Format(time.RFC3339),
-        Proof:         map[string]string{},
+        Timestamp:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaBIMApproval),
     }
+    approval.Proof = map[string]ProposalSignature{approverID: sig}
 
-    // --- Add approval signature placeholder ---
-    approval.Proof[approverID] = fmt.Sprintf("sig:%s", ctx.GetStub().GetTxID())
-
-    // --- Update original update status ---
-    initUpdate.Status = approveResult
-    merged, err := json.Marshal(initUpdate)
+    voteBytes, err := putVote(ctx, voterID, &approval)
     if err != nil {
-        return fmt.Errorf("failed to marshal updated update: %v", err)
+        return err
+    }
+
+    // --- Approvals still pending: the vote is recorded, the status is unchanged ---
+    if approveResult == StatusApproved {
+        votes, err := votesOf(ctx, updateID)
+        if err != nil {
+            return err
+        }
+        if !policy.satisfiedBy(votes) {
+            if err := ctx.GetStub().SetEvent(EventBIMApprovalVote, voteBytes); err != nil {
+                return fmt.Errorf("failed to set event: %v", err)
+            }
+            return nil
+        }
+        // the decision record carries the proofs of every approving vote
+        for _, v := range votes {
+            if v.ApproveResult != StatusApproved {
+                continue
+            }
+            for id, p := range v.Proof {
+                approval.Proof[id] = p
+            }
+        }
     }
 
-    if err := ctx.GetStub().PutState(updateID, merged); err != nil {
-        return fmt.Errorf("failed to write updated update: %v", err)
+    // --- Update original update status ---
+    if _, err := updates.SetStatus(ctx, updateID, approveResult); err != nil {
+        return fmt.Errorf("failed to update status: %v", err)
     }
 
     // --- Store approval record under composite key ---
-    key, err := ctx.GetStub().CreateCompositeKey("BIMApproval", []string{updateID})
+    key, err := approvalKey(ctx, updateID)
     if err != nil {
         return fmt.Errorf("failed to create composite key: %v", err)
     }
-    approvalBytes, _ := json.Marshal(approval)
+    approvalBytes, _ := marshalState(approval)
 
     if err := ctx.GetStub().PutState(key, approvalBytes); err != nil {
         return fmt.Errorf("failed to save approval record: %v", err)
     }
 
-    // --- Emit approval event ---
-    if err := ctx.GetStub().SetEvent(EventBIMApprove, approvalBytes); err != nil {
+    // --- Emit approval / rejection event ---
+    event := EventBIMApprove
+    if approveResult == StatusRejected {
+        event = EventBIMReject
+    }
+    if err := ctx.GetStub().SetEvent(event, approvalBytes); err != nil {
         return fmt.Errorf("failed to set event: %v", err)
     }
 
     return nil
 }
 
+// PublishBIMUpdate publishes an approved update
+// - Caller must have role=bim_lead
+// - Update must be APPROVED
+// - Rejected while any linked RFI / dispute / clash blocker is still open
+// - Rejected while any BCF issue anchored to the update is still open
+func (c *ApprovalContract) PublishBIMUpdate(ctx contractapi.TransactionContextInterface, updateID string) (err error) {
+    log := txLogger(ctx).With("updateID", updateID)
+    defer func() { logOutcome(log, err) }()
+
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if updateID == "" {
+        return fmt.Errorf("updateID required")
+    }
+
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if update.Status != StatusApproved {
+        return errInvalidState("update %s is %s, only APPROVED updates can be published", updateID, update.Status)
+    }
+
+    // --- Publish gating on open blockers ---
+    blockers, err := openBlockers(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if len(blockers) > 0 {
+        return fmt.Errorf("update %s has %d open blocker(s): %s", updateID, len(blockers), describeBlockers(blockers))
+    }
+    issues, err := openBCFIssuesOf(ctx, update)
+    if err != nil {
+        return err
+    }
+    if len(issues) > 0 {
+        return fmt.Errorf("update %s has %d open BCF issue(s), first: %s %q", updateID, len(issues), issues[0].TopicGUID, issues[0].Title)
+    }
+
+    published, err := updates.SetStatus(ctx, updateID, StatusPublished)
+    if err != nil {
+        return fmt.Errorf("failed to update status: %v", err)
+    }
+    publishedBytes, err := marshalState(published)
+    if err != nil {
+        return fmt.Errorf("failed to marshal update: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventBIMPublish, publishedBytes); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
 // QueryApproval returns approval record for an updateID
 func (c *ApprovalContract) QueryApproval(ctx contractapi.TransactionContextInterface, updateID string) (*BIMApproval, error) {
-    key, err := ctx.GetStub().CreateCompositeKey("BIMApproval", []string{updateID})
+    key, err := approvalKey(ctx, updateID)
     if err != nil {
         return nil, err
     }
@@ -130,7 +307,14 @@ func (c *ApprovalContract) QueryApproval(ctx contractapi.TransactionContextInter
         return nil, fmt.Errorf("no approval record for %s", updateID)
     }
     var approval BIMApproval
-    if err := json.Unmarshal(data, &approval); err != nil {
+    if err := decodeRecord(schemaBIMApproval, data, &approval); err != nil {
+        return nil, err
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if err := revealReviewer(ctx, update, &approval); err != nil {
         return nil, err
     }
     return &approval, nil
@@ -0,0 +1,363 @@
+package chaincode
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ApprovalPolicy defines who must approve updates of a model before they become APPROVED.
+// Models without a stored policy need the network's DefaultApprovalThreshold approvals
+// (one unless changed through ConfigContract) from role=professional.
+//
+// Every approval weighs 1 unless RoleWeights gives the approver's role another weight,
+// e.g. {"bim_lead": 2, "professional": 1}; Threshold is then the total weight needed.
+type ApprovalPolicy struct {
+    ModelID             string         `json:"ModelID"`
+    RequiredRoles       []string       `json:"RequiredRoles"`         // roles allowed to approve; empty means professional
+    RequiredDepartments []string       `json:"RequiredDepartments"`   // each needs at least one approval
+    Threshold           int            `json:"Threshold"`             // approval weight needed
+    RoleWeights         map[string]int `json:"RoleWeights,omitempty"` // vote weight per role, 1 when absent
+    UpdatedBy           string         `json:"UpdatedBy"`
+    Timestamp           string         `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    DepartmentAttrName = "department"
+
+    EventApprovalPolicySet = "BIMApprovalPolicySet"
+    EventBIMApprovalVote   = "BIMApprovalVoteRecorded"
+
+    maxRoleWeight = 10
+)
+
+// SetApprovalPolicy sets the approvals required for updates of a model
+// - Caller must have role=bim_lead
+// - threshold must be at least 1 and cover every required department
+// - requiredRoles must be among the network's AllowedRoles (see ConfigContract)
+// - applies to approvals recorded after the call; existing votes are kept
+// - role weights set with SetApprovalWeights are kept for roles that remain required
+func (c *ApprovalContract) SetApprovalPolicy(ctx contractapi.TransactionContextInterface,
+    modelID string, requiredRoles []string, requiredDepartments []string, threshold int) error {
+
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if modelID == "" {
+        return fmt.Errorf("modelID required")
+    }
+    if threshold < 1 {
+        return fmt.Errorf("threshold must be at least 1")
+    }
+    departments := uniqueSorted(requiredDepartments)
+    if threshold < len(departments) {
+        return fmt.Errorf("threshold %d is lower than the %d required departments", threshold, len(departments))
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return err
+    }
+    for _, role := range requiredRoles {
+        if role != "" && !cfg.roleAllowed(role) {
+            return fmt.Errorf("role %s is not among the allowed roles %v", role, cfg.AllowedRoles)
+        }
+    }
+
+    previous, err := approvalPolicyFor(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    policy := ApprovalPolicy{
+        ModelID:             modelID,
+        RequiredRoles:       uniqueSorted(requiredRoles),
+        RequiredDepartments: departments,
+        Threshold:           threshold,
+    }
+    if len(policy.RequiredRoles) == 0 {
+        policy.RequiredRoles = []string{RoleProfessional}
+    }
+    for role, weight := range previous.RoleWeights {
+        if policy.allowsRole(role) {
+            if policy.RoleWeights == nil {
+                policy.RoleWeights = map[string]int{}
+            }
+            policy.RoleWeights[role] = weight
+        }
+    }
+    return putApprovalPolicy(ctx, &policy)
+}
+
+// SetApprovalWeights sets the vote weight of each role for updates of a model.
+// weightsJSON is an object such as {"bim_lead": 2, "professional": 1}; roles left out weigh 1
+// and an empty object restores equal weights.
+// - Caller must have role=bim_lead
+// - every role must be one of the policy's RequiredRoles, with a weight between 1 and 10
+// - applies to approvals recorded after the call; existing votes keep their weight
+func (c *ApprovalContract) SetApprovalWeights(ctx contractapi.TransactionContextInterface, modelID string, weightsJSON string) error {
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if modelID == "" {
+        return fmt.Errorf("modelID required")
+    }
+    var weights map[string]int
+    if err := json.Unmarshal([]byte(weightsJSON), &weights); err != nil {
+        return fmt.Errorf("invalid weights JSON: %v", err)
+    }
+    policy, err := approvalPolicyFor(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    for role, weight := range weights {
+        if !policy.allowsRole(role) {
+            return fmt.Errorf("role %s cannot approve updates of model %s (allowed: %v)", role, modelID, policy.RequiredRoles)
+        }
+        if weight < 1 || weight > maxRoleWeight {
+            return fmt.Errorf("weight of %s must be between 1 and %d", role, maxRoleWeight)
+        }
+    }
+    policy.RoleWeights = nil
+    if len(weights) > 0 {
+        policy.RoleWeights = weights
+    }
+    return putApprovalPolicy(ctx, policy)
+}
+
+// putApprovalPolicy stamps and stores a policy and emits EventApprovalPolicySet
+func putApprovalPolicy(ctx contractapi.TransactionContextInterface, policy *ApprovalPolicy) error {
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    policy.UpdatedBy = callerID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    policy.Timestamp = txTime.Format(time.RFC3339)
+    policy.SchemaVersion = schemaVersion(schemaApprovalPolicy)
+
+    key, err := makeKey(ctx, approvalPolicyObjectType, policy.ModelID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(policy)
+    if err != nil {
+        return fmt.Errorf("failed to marshal approval policy: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save approval policy: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventApprovalPolicySet, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// QueryApprovalPolicy returns the approval policy in effect for a model
+func (c *ApprovalContract) QueryApprovalPolicy(ctx contractapi.TransactionContextInterface, modelID string) (*ApprovalPolicy, error) {
+    return approvalPolicyFor(ctx, modelID)
+}
+
+// approvalPolicyFor loads the stored policy of modelID or returns the default one
+func approvalPolicyFor(ctx contractapi.TransactionContextInterface, modelID string) (*ApprovalPolicy, error) {
+    key, err := makeKey(ctx, approvalPolicyObjectType, modelID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read approval policy: %v", err)
+    }
+    if data == nil {
+        cfg, err := networkConfig(ctx)
+        if err != nil {
+            return nil, err
+        }
+        return &ApprovalPolicy{ModelID: modelID, RequiredRoles: []string{RoleProfessional}, Threshold: cfg.DefaultApprovalThreshold, SchemaVersion: schemaVersion(schemaApprovalPolicy)}, nil
+    }
+    var policy ApprovalPolicy
+    if err := decodeRecord(schemaApprovalPolicy, data, &policy); err != nil {
+        return nil, fmt.Errorf("failed to parse approval policy: %v", err)
+    }
+    if len(policy.RequiredRoles) == 0 {
+        policy.RequiredRoles = []string{RoleProfessional}
+    }
+    return &policy, nil
+}
+
+// satisfiedBy reports whether the approving votes reach the weight threshold and cover
+// every required department
+func (p *ApprovalPolicy) satisfiedBy(votes []BIMApproval) bool {
+    return approvalScore(votes) >= p.Threshold && len(p.missingDepartments(votes)) == 0
+}
+
+// missingDepartments returns the required departments without an approving vote
+func (p *ApprovalPolicy) missingDepartments(votes []BIMApproval) []string {
+    covered := map[string]bool{}
+    for _, v := range votes {
+        if v.ApproveResult == StatusApproved {
+            covered[v.Department] = true
+        }
+    }
+    missing := []string{}
+    for _, d := range p.RequiredDepartments {
+        if !covered[d] {
+            missing = append(missing, d)
+        }
+    }
+    return missing
+}
+
+// allowsRole reports whether role is one of the policy's RequiredRoles
+func (p *ApprovalPolicy) allowsRole(role string) bool {
+    for _, r := range p.RequiredRoles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+// weightOf returns the vote weight of an approver with role
+func (p *ApprovalPolicy) weightOf(role string) int {
+    if w := p.RoleWeights[role]; w > 0 {
+        return w
+    }
+    return 1
+}
+
+// approvalScore sums the weights of the approving votes. Votes recorded before
+// weights existed carry no Weight and count as 1.
+func approvalScore(votes []BIMApproval) int {
+    score := 0
+    for _, v := range votes {
+        if v.ApproveResult != StatusApproved {
+            continue
+        }
+        if v.Weight > 0 {
+            score += v.Weight
+        } else {
+            score++
+        }
+    }
+    return score
+}
+
+// voterKey identifies one approver on one update without exposing the identity,
+// so blind-review votes can still be deduplicated
+func voterKey(updateID string, approverID string) string {
+    sum := sha256.Sum256([]byte(updateID + "|" + approverID))
+    return hex.EncodeToString(sum[:16])
+}
+
+// hasVoted reports whether approverID already recorded a vote on updateID
+func hasVoted(ctx contractapi.TransactionContextInterface, updateID string, approverID string) (bool, error) {
+    key, err := makeKey(ctx, approvalVoteObjectType, updateID, voterKey(updateID, approverID))
+    if err != nil {
+        return false, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return false, fmt.Errorf("failed to read approval vote: %v", err)
+    }
+    return data != nil, nil
+}
+
+// putVote stores the vote of approverID on the update
+func putVote(ctx contractapi.TransactionContextInterface, approverID string, vote *BIMApproval) ([]byte, error) {
+    key, err := makeKey(ctx, approvalVoteObjectType, vote.UpdateID, voterKey(vote.UpdateID, approverID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(vote)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal approval vote: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return nil, fmt.Errorf("failed to save approval vote: %v", err)
+    }
+    return data, nil
+}
+
+// votesOf returns every vote recorded on updateID
+func votesOf(ctx contractapi.TransactionContextInterface, updateID string) ([]BIMApproval, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(approvalVoteObjectType, []string{updateID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query approval votes: %v", err)
+    }
+    defer iterator.Close()
+
+    var votes []BIMApproval
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var vote BIMApproval
+        if err := decodeRecord(schemaBIMApproval, kv.Value, &vote); err != nil {
+            return nil, fmt.Errorf("failed to parse approval vote: %v", err)
+        }
+        votes = append(votes, vote)
+    }
+    return votes, nil
+}
+
+// getCallerDepartment returns the department of an unexpired RoleGrant, else the caller's
+// 'department' certificate attribute, or "" if neither is set.
+// The attribute is self-asserted by the issuing CA and the grant by an admin of the caller's
+// MSP, so either way a department listed in the network's DepartmentMSPs is only accepted
+// for callers of the MSPs mapped to it.
+func getCallerDepartment(ctx contractapi.TransactionContextInterface) (string, error) {
+    ci, err := cid.New(ctx.GetStub())
+    if err != nil {
+        return "", fmt.Errorf("failed to create client identity: %v", err)
+    }
+    effective, err := effectiveRole(ctx, ci)
+    if err != nil {
+        return "", err
+    }
+    department := effective.Department
+    if department == "" {
+        department, _, err = ci.GetAttributeValue(DepartmentAttrName)
+        if err != nil {
+            return "", fmt.Errorf("failed to read attribute '%s': %v", DepartmentAttrName, err)
+        }
+    }
+    if department == "" {
+        return "", nil
+    }
+    mspID, err := ci.GetMSPID()
+    if err != nil {
+        return "", fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return "", err
+    }
+    if !cfg.departmentAllowed(department, mspID) {
+        return "", fmt.Errorf("department %q is not permitted for callers of MSP %s", department, mspID)
+    }
+    return department, nil
+}
+
+func uniqueSorted(values []string) []string {
+    seen := map[string]bool{}
+    out := []string{}
+    for _, v := range values {
+        if v != "" && !seen[v] {
+            seen[v] = true
+            out = append(out, v)
+        }
+    }
+    sort.Strings(out)
+    return out
+}
@@ -0,0 +1,87 @@
+package chaincode
+
+import (
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ApprovalRecords lists every vote recorded on an update, where QueryApproval returns
+// only the final decision, together with what the update still waits for
+type ApprovalRecords struct {
+    UpdateID string        `json:"UpdateID"`
+    Status   string        `json:"Status"`
+    Votes    []BIMApproval `json:"Votes"` // oldest first
+
+    Score              int      `json:"Score"`     // summed weight of the approving votes
+    Threshold          int      `json:"Threshold"` // weight needed, from the approval policy
+    RemainingWeight    int      `json:"RemainingWeight"`
+    MissingDepartments []string `json:"MissingDepartments"`
+
+    // Assigned reports whether reviewers are assigned; without an assignment any caller
+    // holding a role of the approval policy may vote
+    Assigned bool `json:"Assigned"`
+    // OutstandingReviewers are the assigned reviewers without a vote. On blind-review
+    // updates only callers who may see reviewer identities get the list; the others
+    // get OutstandingCount alone.
+    OutstandingReviewers []string `json:"OutstandingReviewers"`
+    OutstandingCount     int      `json:"OutstandingCount"`
+}
+
+// QueryApprovals returns the individual votes recorded on an update and a summary of
+// the approvals still outstanding. Decided updates accept no more votes, so their
+// outstanding reviewers, departments and weight are empty.
+func (c *ApprovalContract) QueryApprovals(ctx contractapi.TransactionContextInterface, updateID string) (*ApprovalRecords, error) {
+    tally, err := tallyVotes(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    assignment, err := readReviewerAssignment(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    visible, err := reviewersVisible(ctx, tally.update)
+    if err != nil {
+        return nil, err
+    }
+
+    records := &ApprovalRecords{
+        UpdateID:             updateID,
+        Status:               tally.Status,
+        Votes:                []BIMApproval{},
+        Score:                tally.Score,
+        Threshold:            tally.Threshold,
+        MissingDepartments:   []string{},
+        Assigned:             assignment != nil,
+        OutstandingReviewers: []string{},
+    }
+    for _, vote := range tally.votes {
+        if err := revealReviewer(ctx, tally.update, &vote); err != nil {
+            return nil, err
+        }
+        records.Votes = append(records.Votes, vote)
+    }
+
+    if tally.Status != StatusInitialized {
+        return records, nil
+    }
+    if tally.Score < tally.Threshold {
+        records.RemainingWeight = tally.Threshold - tally.Score
+    }
+    records.MissingDepartments = tally.MissingDepartments
+    if assignment == nil {
+        return records, nil
+    }
+    for _, reviewer := range assignment.Reviewers {
+        voted, err := hasVoted(ctx, updateID, reviewer)
+        if err != nil {
+            return nil, err
+        }
+        if voted {
+            continue
+        }
+        records.OutstandingCount++
+        if visible {
+            records.OutstandingReviewers = append(records.OutstandingReviewers, reviewer)
+        }
+    }
+    return records, nil
+}
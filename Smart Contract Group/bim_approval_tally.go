@@ -0,0 +1,93 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ApprovalTally is the running vote count of an update against its model's approval policy
+type ApprovalTally struct {
+    UpdateID           string      `json:"UpdateID"`
+    Status             string      `json:"Status"`
+    Score              int         `json:"Score"`     // summed weight of the approving votes
+    Threshold          int         `json:"Threshold"` // weight needed, from the approval policy
+    MissingDepartments []string    `json:"MissingDepartments"`
+    Satisfied          bool        `json:"Satisfied"`
+    Votes              []TallyVote `json:"Votes"` // oldest first
+}
+
+// TallyVote is one vote in an ApprovalTally. On blind-review updates Approver is the pseudonym.
+type TallyVote struct {
+    Approver      string `json:"Approver"`
+    Role          string `json:"Role,omitempty"`
+    Department    string `json:"Department,omitempty"`
+    Weight        int    `json:"Weight"`
+    ApproveResult string `json:"ApproveResult"`
+    Timestamp     string `json:"Timestamp"`
+}
+
+// QueryApprovalTally returns the votes recorded on an update and the weighted score
+// they reach under the model's current approval policy
+func (c *ApprovalContract) QueryApprovalTally(ctx contractapi.TransactionContextInterface, updateID string) (*ApprovalTally, error) {
+    t, err := tallyVotes(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    return t.ApprovalTally, nil
+}
+
+// voteTally is an ApprovalTally together with what it was counted from
+type voteTally struct {
+    *ApprovalTally
+    update *BIMUpdate
+    policy *ApprovalPolicy
+    votes  []BIMApproval // as stored, in the order of Votes
+}
+
+// tallyVotes counts the votes recorded on an update against its model's current
+// approval policy. QueryApprovalTally and QueryApprovals both report from it.
+func tallyVotes(ctx contractapi.TransactionContextInterface, updateID string) (*voteTally, error) {
+    if updateID == "" {
+        return nil, fmt.Errorf("updateID required")
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    policy, err := approvalPolicyFor(ctx, update.ModelID)
+    if err != nil {
+        return nil, err
+    }
+    votes, err := votesOf(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    sort.SliceStable(votes, func(i, j int) bool { return votes[i].Timestamp < votes[j].Timestamp })
+
+    tally := &ApprovalTally{
+        UpdateID:           updateID,
+        Status:             update.Status,
+        Score:              approvalScore(votes),
+        Threshold:          policy.Threshold,
+        MissingDepartments: policy.missingDepartments(votes),
+        Satisfied:          policy.satisfiedBy(votes),
+        Votes:              []TallyVote{},
+    }
+    for _, v := range votes {
+        weight := v.Weight
+        if weight == 0 {
+            weight = 1
+        }
+        tally.Votes = append(tally.Votes, TallyVote{
+            Approver:      v.Approver,
+            Role:          v.Role,
+            Department:    v.Department,
+            Weight:        weight,
+            ApproveResult: v.ApproveResult,
+            Timestamp:     v.Timestamp,
+        })
+    }
+    return &voteTally{ApprovalTally: tally, update: update, policy: policy, votes: votes}, nil
+}
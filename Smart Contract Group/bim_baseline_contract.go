@@ -0,0 +1,292 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// BaselineContract tags published model states as named baselines ("Tender Issue",
+// "IFC Handover") and records decisions to roll a model back to one of them
+type BaselineContract struct {
+    contractapi.Contract
+}
+
+// BIMBaseline is a named reference to the published update that defines a model state
+type BIMBaseline struct {
+    ModelID   string `json:"ModelID" validate:"required,max=64,id"`
+    Label     string `json:"Label" validate:"required,max=128"`
+    UpdateID  string `json:"UpdateID" validate:"required,max=64,id"`
+    Version   string `json:"Version"`
+    CreatedBy string `json:"CreatedBy"`
+    CreatedAt string `json:"CreatedAt"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// BIMRollback records the decision to revert a model to a baseline.
+// The chaincode does not touch the updates themselves; consumers treat the
+// baseline's update as the current model state from this point on.
+type BIMRollback struct {
+    ModelID        string `json:"ModelID"`
+    RollbackID     string `json:"RollbackID"` // transaction ID of RollbackToBaseline
+    BaselineLabel  string `json:"BaselineLabel"`
+    TargetUpdateID string `json:"TargetUpdateID"`
+    TargetVersion  string `json:"TargetVersion"`
+    FromUpdateID   string `json:"FromUpdateID,omitempty"` // latest published update at the time, if any
+    FromVersion    string `json:"FromVersion,omitempty"`
+    Reason         string `json:"Reason" validate:"required,max=4096"`
+    DecidedBy      string `json:"DecidedBy"`
+    Timestamp      string `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventBaselineCreated = "BIMBaselineCreated"
+    EventModelRolledBack = "BIMModelRolledBack"
+)
+
+// CreateBaseline tags a published update of a model with a label
+// - Caller must have role=bim_lead
+// - The update must belong to modelID and be PUBLISHED
+// - Labels are unique per model
+func (bc *BaselineContract) CreateBaseline(ctx contractapi.TransactionContextInterface,
+    modelID string, updateID string, label string) error {
+
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    baseline := BIMBaseline{
+        ModelID:       modelID,
+        Label:         label,
+        UpdateID:      updateID,
+        CreatedAt:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaBIMBaseline),
+    }
+    if err := validateStruct(&baseline); err != nil {
+        return err
+    }
+
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if update.ModelID != modelID {
+        return fmt.Errorf("update %s belongs to model %s, not %s", updateID, update.ModelID, modelID)
+    }
+    if update.Status != StatusPublished {
+        return errInvalidState("update %s is %s, only PUBLISHED updates can be baselined", updateID, update.Status)
+    }
+
+    existing, err := readBaseline(ctx, modelID, label)
+    if err != nil {
+        return err
+    }
+    if existing != nil {
+        return errDuplicate("baseline %q already exists on model %s", label, modelID)
+    }
+
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    baseline.Version = update.Version
+    baseline.CreatedBy = callerID
+    return putSubRecord(ctx, baselineObjectType, []string{modelID, label}, &baseline, EventBaselineCreated)
+}
+
+// QueryBaseline returns one baseline of a model
+func (bc *BaselineContract) QueryBaseline(ctx contractapi.TransactionContextInterface, modelID string, label string) (*BIMBaseline, error) {
+    baseline, err := readBaseline(ctx, modelID, label)
+    if err != nil {
+        return nil, err
+    }
+    if baseline == nil {
+        return nil, errNotFound("baseline %q not found on model %s", label, modelID)
+    }
+    return baseline, nil
+}
+
+// QueryBaselines lists the baselines of a model
+func (bc *BaselineContract) QueryBaselines(ctx contractapi.TransactionContextInterface, modelID string) ([]*BIMBaseline, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(baselineObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query baselines: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMBaseline{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var baseline BIMBaseline
+        if err := decodeRecord(schemaBIMBaseline, kv.Value, &baseline); err != nil {
+            return nil, fmt.Errorf("failed to parse baseline: %v", err)
+        }
+        result = append(result, &baseline)
+    }
+    return result, nil
+}
+
+// RollbackToBaseline records the decision to revert a model to a baseline and
+// returns the RollbackID
+// - Caller must have role=bim_lead
+// - A reason is required
+func (bc *BaselineContract) RollbackToBaseline(ctx contractapi.TransactionContextInterface,
+    modelID string, label string, reason string) (string, error) {
+
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return "", fmt.Errorf("authorization failed: %v", err)
+    }
+    baseline, err := readBaseline(ctx, modelID, label)
+    if err != nil {
+        return "", err
+    }
+    if baseline == nil {
+        return "", errNotFound("baseline %q not found on model %s", label, modelID)
+    }
+
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return "", fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return "", err
+    }
+    rollback := BIMRollback{
+        ModelID:        modelID,
+        RollbackID:     ctx.GetStub().GetTxID(),
+        BaselineLabel:  label,
+        TargetUpdateID: baseline.UpdateID,
+        TargetVersion:  baseline.Version,
+        Reason:         reason,
+        DecidedBy:      callerID,
+        Timestamp:      txTime.Format(time.RFC3339),
+        SchemaVersion:  schemaVersion(schemaBIMRollback),
+    }
+    if err := validateStruct(&rollback); err != nil {
+        return "", err
+    }
+
+    latest, err := latestPublishedUpdate(ctx, modelID)
+    if err != nil {
+        return "", err
+    }
+    if latest != nil {
+        if latest.UpdateID == baseline.UpdateID {
+            return "", fmt.Errorf("model %s is already at baseline %q", modelID, label)
+        }
+        rollback.FromUpdateID = latest.UpdateID
+        rollback.FromVersion = latest.Version
+    }
+
+    if err := putSubRecord(ctx, rollbackObjectType, []string{modelID, rollback.RollbackID}, &rollback, EventModelRolledBack); err != nil {
+        return "", err
+    }
+    return rollback.RollbackID, nil
+}
+
+// QueryRollbacks lists the rollback decisions recorded for a model
+func (bc *BaselineContract) QueryRollbacks(ctx contractapi.TransactionContextInterface, modelID string) ([]*BIMRollback, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(rollbackObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query rollbacks: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMRollback{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var rollback BIMRollback
+        if err := decodeRecord(schemaBIMRollback, kv.Value, &rollback); err != nil {
+            return nil, fmt.Errorf("failed to parse rollback: %v", err)
+        }
+        result = append(result, &rollback)
+    }
+    return result, nil
+}
+
+// latestPublishedUpdate returns the most recently created PUBLISHED update of modelID, or nil
+func latestPublishedUpdate(ctx contractapi.TransactionContextInterface, modelID string) (*BIMUpdate, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndexObjectType, []string{StatusPublished})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query status index: %v", err)
+    }
+    defer iterator.Close()
+
+    var latest *BIMUpdate
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, statusIndexObjectType)
+        if err != nil {
+            continue
+        }
+        update, err := updates.GetUpdate(ctx, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        if update.ModelID == modelID && (latest == nil || update.Timestamp > latest.Timestamp) {
+            latest = update
+        }
+    }
+    return latest, nil
+}
+
+func readBaseline(ctx contractapi.TransactionContextInterface, modelID string, label string) (*BIMBaseline, error) {
+    key, err := makeKey(ctx, baselineObjectType, modelID, label)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read baseline: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var baseline BIMBaseline
+    if err := decodeRecord(schemaBIMBaseline, data, &baseline); err != nil {
+        return nil, fmt.Errorf("failed to parse baseline: %v", err)
+    }
+    return &baseline, nil
+}
+
+// putSubRecord stores record under (objectType, attrs...) and emits it as event
+func putSubRecord(ctx contractapi.TransactionContextInterface, objectType string, attrs []string, record interface{}, event string) error {
+    key, err := makeKey(ctx, objectType, attrs...)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(record)
+    if err != nil {
+        return fmt.Errorf("failed to marshal %s: %v", objectType, err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save %s: %v", objectType, err)
+    }
+    if err := ctx.GetStub().SetEvent(event, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,224 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// BCFContract anchors BIM Collaboration Format issues raised against an update.
+// The BCFzip itself stays off-chain (IPFS); only each topic's hash and viewpoint
+// hashes are recorded, keyed by model version so reviewers can list open issues.
+type BCFContract struct {
+    contractapi.Contract
+}
+
+// BCFIssue is the anchored state of one BCF topic for a model version
+type BCFIssue struct {
+    TopicGUID       string   `json:"TopicGUID" validate:"required,max=64,id"`
+    Title           string   `json:"Title" validate:"max=256"`
+    Status          string   `json:"Status" validate:"max=64"` // TopicStatus as written by the BCF tool
+    Priority        string   `json:"Priority,omitempty" validate:"max=64"`
+    AssignedTo      string   `json:"AssignedTo,omitempty" validate:"max=256"`
+    TopicHash       string   `json:"TopicHash" validate:"required,sha256"`
+    ViewpointHashes []string `json:"ViewpointHashes"`
+    Open            bool     `json:"Open"` // derived from Status, see bcfIssueOpen
+
+    ModelID    string `json:"ModelID"`
+    Version    string `json:"Version"`
+    UpdateID   string `json:"UpdateID"`
+    SourceCID  string `json:"SourceCID"` // BCFzip the hashes were computed from
+    AnchoredBy string `json:"AnchoredBy"`
+    AnchoredAt string `json:"AnchoredAt"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventBCFIssuesAnchored = "BCFIssuesAnchored"
+
+    maxBCFIssuesPerCall = 500
+)
+
+// bcfClosedStatuses are the TopicStatus values (case-insensitive) treated as closed
+var bcfClosedStatuses = map[string]bool{"closed": true, "resolved": true, "done": true}
+
+func bcfIssueOpen(status string) bool {
+    return !bcfClosedStatuses[strings.ToLower(strings.TrimSpace(status))]
+}
+
+// AnchorBCFIssues records the topics of a BCFzip against the model version of an update.
+// Anchoring a topic again (e.g. after it was closed) replaces its state; the earlier
+// states remain in the key history.
+//   - Caller must have role=modeler, role=professional or role=bim_lead
+//   - issuesJSON is a JSON array of BCFIssue with TopicGUID, Title, Status, Priority,
+//     AssignedTo, TopicHash and ViewpointHashes filled in
+//   - Published updates can no longer receive issues
+//   - Emits BCFIssuesAnchored with the stored issues
+func (bc *BCFContract) AnchorBCFIssues(ctx contractapi.TransactionContextInterface,
+    updateID string, sourceCID string, issuesJSON string) error {
+
+    if err := authorizeCallerRole(ctx, RoleModeler, RoleProfessional, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if errs := checkRules(sourceCID, "required,cid"); len(errs) > 0 {
+        return fmt.Errorf("sourceCID %s", strings.Join(errs, ", "))
+    }
+    var issues []*BCFIssue
+    if err := json.Unmarshal([]byte(issuesJSON), &issues); err != nil {
+        return fmt.Errorf("failed to parse issues: %v", err)
+    }
+    if len(issues) == 0 {
+        return fmt.Errorf("at least one issue required")
+    }
+    if len(issues) > maxBCFIssuesPerCall {
+        return fmt.Errorf("at most %d issues per call", maxBCFIssuesPerCall)
+    }
+
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if update.Status == StatusPublished {
+        return errInvalidState("update %s is already published", updateID)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    now := txTime.Format(time.RFC3339)
+
+    seen := map[string]bool{}
+    for i, issue := range issues {
+        if err := validateStruct(issue); err != nil {
+            return fmt.Errorf("issue %d: %v", i, err)
+        }
+        if seen[issue.TopicGUID] {
+            return fmt.Errorf("topic %s listed twice", issue.TopicGUID)
+        }
+        seen[issue.TopicGUID] = true
+        for _, h := range issue.ViewpointHashes {
+            if h != "" && !sha256Pattern.MatchString(h) {
+                return fmt.Errorf("issue %d: ViewpointHashes must be hex SHA-256 digests", i)
+            }
+        }
+
+        issue.Open = bcfIssueOpen(issue.Status)
+        issue.ModelID = update.ModelID
+        issue.Version = update.Version
+        issue.UpdateID = updateID
+        issue.SourceCID = sourceCID
+        issue.AnchoredBy = callerID
+        issue.AnchoredAt = now
+        issue.SchemaVersion = schemaVersion(schemaBCFIssue)
+
+        key, err := makeKey(ctx, bcfIssueObjectType, issue.ModelID, issue.Version, issue.TopicGUID)
+        if err != nil {
+            return fmt.Errorf("failed to create composite key: %v", err)
+        }
+        data, err := marshalState(issue)
+        if err != nil {
+            return fmt.Errorf("failed to marshal BCF issue: %v", err)
+        }
+        if err := ctx.GetStub().PutState(key, data); err != nil {
+            return fmt.Errorf("failed to save BCF issue: %v", err)
+        }
+    }
+
+    eventBytes, err := marshalState(issues)
+    if err != nil {
+        return fmt.Errorf("failed to marshal BCF issues: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventBCFIssuesAnchored, eventBytes); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// QueryOpenBCFIssues lists the open BCF issues of a model version, or of every
+// version of the model when version is empty
+func (bc *BCFContract) QueryOpenBCFIssues(ctx contractapi.TransactionContextInterface, modelID string, version string) ([]*BCFIssue, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    attrs := []string{modelID}
+    if version != "" {
+        attrs = append(attrs, version)
+    }
+    issues, err := bcfIssues(ctx, attrs...)
+    if err != nil {
+        return nil, err
+    }
+    open := []*BCFIssue{}
+    for _, issue := range issues {
+        if issue.Open {
+            open = append(open, issue)
+        }
+    }
+    return open, nil
+}
+
+// QueryBCFIssue returns the anchored state of one topic
+func (bc *BCFContract) QueryBCFIssue(ctx contractapi.TransactionContextInterface, modelID string, version string, topicGUID string) (*BCFIssue, error) {
+    key, err := makeKey(ctx, bcfIssueObjectType, modelID, version, topicGUID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read BCF issue: %v", err)
+    }
+    if data == nil {
+        return nil, fmt.Errorf("BCF topic %s not anchored for %s %s", topicGUID, modelID, version)
+    }
+    var issue BCFIssue
+    if err := decodeRecord(schemaBCFIssue, data, &issue); err != nil {
+        return nil, fmt.Errorf("failed to parse BCF issue: %v", err)
+    }
+    return &issue, nil
+}
+
+// openBCFIssuesOf lists the open BCF issues anchored to updateID
+func openBCFIssuesOf(ctx contractapi.TransactionContextInterface, update *BIMUpdate) ([]*BCFIssue, error) {
+    issues, err := bcfIssues(ctx, update.ModelID, update.Version)
+    if err != nil {
+        return nil, err
+    }
+    var open []*BCFIssue
+    for _, issue := range issues {
+        if issue.Open && issue.UpdateID == update.UpdateID {
+            open = append(open, issue)
+        }
+    }
+    return open, nil
+}
+
+// bcfIssues loads the BCF issues under a partial (modelID[, version]) key
+func bcfIssues(ctx contractapi.TransactionContextInterface, attrs ...string) ([]*BCFIssue, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bcfIssueObjectType, attrs)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query BCF issues: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BCFIssue{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var issue BCFIssue
+        if err := decodeRecord(schemaBCFIssue, kv.Value, &issue); err != nil {
+            return nil, fmt.Errorf("failed to parse BCF issue: %v", err)
+        }
+        result = append(result, &issue)
+    }
+    return result, nil
+}
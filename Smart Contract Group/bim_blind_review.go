@@ -0,0 +1,142 @@
+package chaincode
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Blind review mode hides approver identities from the initiator: approvals on
+// an update with ReviewMode=BLIND are recorded under a pseudonym, and the
+// pseudonym -> identity mapping is only resolved for bim_lead / auditor callers,
+// or for everyone once the decision is final (the update is published).
+// The signed-proposal proof names the approver's certificate, so on these updates
+// the approval carries only the proof's TxID; the full proof is kept with the
+// pseudonym mapping and revealed together with it.
+
+const (
+    ReviewModeOpen  = "OPEN"
+    ReviewModeBlind = "BLIND"
+)
+
+// ReviewerIdentity maps an approver pseudonym back to the real identity
+type ReviewerIdentity struct {
+    UpdateID   string `json:"UpdateID"`
+    Pseudonym  string `json:"Pseudonym"`
+    ApproverID string `json:"ApproverID"`
+    // Proof is the approver's signed-proposal proof, withheld from the approval record
+    Proof *ProposalSignature `json:"Proof,omitempty"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// ResolveReviewerPseudonym returns the identity behind a blind-review pseudonym
+// - Caller must have role=bim_lead or role=auditor
+func (c *ApprovalContract) ResolveReviewerPseudonym(ctx contractapi.TransactionContextInterface, updateID string, pseudonym string) (string, error) {
+    if err := authorizeCallerRole(ctx, RoleBIMLead, RoleAuditor); err != nil {
+        return "", fmt.Errorf("authorization failed: %v", err)
+    }
+    identity, err := readReviewerIdentity(ctx, updateID, pseudonym)
+    if err != nil {
+        return "", err
+    }
+    if identity == nil {
+        return "", fmt.Errorf("no reviewer %s on update %s", pseudonym, updateID)
+    }
+    return identity.ApproverID, nil
+}
+
+// recordReviewerIdentity derives the pseudonym for approverID on updateID,
+// stores the mapping, with the approver's proof if any, and returns the pseudonym
+func recordReviewerIdentity(ctx contractapi.TransactionContextInterface, updateID string, approverID string, proof *ProposalSignature) (string, error) {
+    sum := sha256.Sum256([]byte(updateID + "|" + approverID + "|" + ctx.GetStub().GetTxID()))
+    pseudonym := "reviewer-" + hex.EncodeToString(sum[:8])
+
+    key, err := makeKey(ctx, reviewerIdentityObjectType, updateID, pseudonym)
+    if err != nil {
+        return "", fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(ReviewerIdentity{
+        UpdateID:      updateID,
+        Pseudonym:     pseudonym,
+        ApproverID:    approverID,
+        Proof:         proof,
+        SchemaVersion: schemaVersion(schemaReviewerIdentity),
+    })
+    if err != nil {
+        return "", fmt.Errorf("failed to marshal reviewer identity: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return "", fmt.Errorf("failed to save reviewer identity: %v", err)
+    }
+    return pseudonym, nil
+}
+
+// revealReviewer replaces the pseudonyms in a blind-review approval with the real
+// approver identities, and their redacted proofs with the full ones, when the
+// caller is allowed to see them
+func revealReviewer(ctx contractapi.TransactionContextInterface, update *BIMUpdate, approval *BIMApproval) error {
+    if update.ReviewMode != ReviewModeBlind {
+        return nil
+    }
+    visible, err := reviewersVisible(ctx, update)
+    if err != nil || !visible {
+        return err
+    }
+
+    // the proof may hold several pseudonymous approvers (see ApprovalPolicy)
+    revealed := make(map[string]ProposalSignature, len(approval.Proof))
+    for pseudonym, sig := range approval.Proof {
+        identity, err := readReviewerIdentity(ctx, update.UpdateID, pseudonym)
+        if err != nil {
+            return err
+        }
+        if identity == nil {
+            revealed[pseudonym] = sig
+            continue
+        }
+        if identity.Proof != nil {
+            sig = *identity.Proof
+        }
+        revealed[identity.ApproverID] = sig
+        if approval.Approver == pseudonym {
+            approval.Approver = identity.ApproverID
+        }
+    }
+    approval.Proof = revealed
+    return nil
+}
+
+// reviewersVisible reports whether the caller may see the real identities behind
+// the pseudonyms of a blind-review update
+func reviewersVisible(ctx contractapi.TransactionContextInterface, update *BIMUpdate) (bool, error) {
+    if update.ReviewMode != ReviewModeBlind || update.Status == StatusPublished {
+        return true, nil
+    }
+    role, err := getCallerRole(ctx)
+    if err != nil {
+        return false, err
+    }
+    return role == RoleBIMLead || role == RoleAuditor, nil
+}
+
+func readReviewerIdentity(ctx contractapi.TransactionContextInterface, updateID string, pseudonym string) (*ReviewerIdentity, error) {
+    key, err := makeKey(ctx, reviewerIdentityObjectType, updateID, pseudonym)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read reviewer identity: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var identity ReviewerIdentity
+    if err := decodeRecord(schemaReviewerIdentity, data, &identity); err != nil {
+        return nil, fmt.Errorf("failed to parse reviewer identity: %v", err)
+    }
+    return &identity, nil
+}
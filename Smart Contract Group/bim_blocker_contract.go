@@ -0,0 +1,209 @@
+package chaincode
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// BlockerContract links open RFIs, disputes and clash records to an update
+// as explicit blockers that must be resolved before the update can be published
+type BlockerContract struct {
+    contractapi.Contract
+}
+
+// BIMBlocker is an issue standing in the way of publishing an update
+type BIMBlocker struct {
+    UpdateID    string `json:"UpdateID" validate:"required,max=64,id"`
+    BlockerID   string `json:"BlockerID" validate:"required,max=64,id"`
+    Kind        string `json:"Kind" validate:"required,oneof=RFI|DISPUTE|CLASH"`
+    Reference   string `json:"Reference" validate:"max=128"` // external RFI number, dispute or clash record ID
+    Description string `json:"Description" validate:"max=4096"`
+    Status      string `json:"Status"` // OPEN / RESOLVED
+    RaisedBy    string `json:"RaisedBy"`
+    RaisedAt    string `json:"RaisedAt"`
+    ResolvedBy  string `json:"ResolvedBy,omitempty"`
+    ResolvedAt  string `json:"ResolvedAt,omitempty"`
+    Resolution  string `json:"Resolution,omitempty"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    BlockerKindRFI      = "RFI"
+    BlockerKindDispute  = "DISPUTE"
+    BlockerKindClash    = "CLASH"
+    BlockerOpen         = "OPEN"
+    BlockerResolved     = "RESOLVED"
+    EventBlockerLinked  = "BIMBlockerLinked"
+    EventBlockerResolve = "BIMBlockerResolved"
+)
+
+// LinkBlocker records an open RFI, dispute or clash as a blocker on an update
+// - Caller must have role=professional or role=bim_lead
+// - Published updates can no longer be blocked
+func (bc *BlockerContract) LinkBlocker(ctx contractapi.TransactionContextInterface,
+    updateID string, blockerID string, kind string, reference string, description string) error {
+
+    if err := authorizeCallerRole(ctx, RoleProfessional, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    blocker := BIMBlocker{
+        UpdateID:      updateID,
+        BlockerID:     blockerID,
+        Kind:          kind,
+        Reference:     reference,
+        Description:   description,
+        Status:        BlockerOpen,
+        SchemaVersion: schemaVersion(schemaBIMBlocker),
+    }
+    if err := validateStruct(&blocker); err != nil {
+        return err
+    }
+
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if update.Status == StatusPublished {
+        return errInvalidState("update %s is already published", updateID)
+    }
+
+    existing, err := readBlocker(ctx, updateID, blockerID)
+    if err != nil {
+        return err
+    }
+    if existing != nil {
+        return errDuplicate("blocker %s already linked to update %s", blockerID, updateID)
+    }
+
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    blocker.RaisedBy = callerID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    blocker.RaisedAt = txTime.Format(time.RFC3339)
+    return putBlocker(ctx, &blocker, EventBlockerLinked)
+}
+
+// ResolveBlocker closes an open blocker with a resolution note
+// - Caller must have role=professional or role=bim_lead
+func (bc *BlockerContract) ResolveBlocker(ctx contractapi.TransactionContextInterface,
+    updateID string, blockerID string, resolution string) error {
+
+    if err := authorizeCallerRole(ctx, RoleProfessional, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+
+    blocker, err := readBlocker(ctx, updateID, blockerID)
+    if err != nil {
+        return err
+    }
+    if blocker == nil {
+        return errNotFound("blocker %s not found on update %s", blockerID, updateID)
+    }
+    if blocker.Status == BlockerResolved {
+        return errInvalidState("blocker %s already resolved", blockerID)
+    }
+
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    blocker.Status = BlockerResolved
+    blocker.ResolvedBy = callerID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    blocker.ResolvedAt = txTime.Format(time.RFC3339)
+    blocker.Resolution = resolution
+    return putBlocker(ctx, blocker, EventBlockerResolve)
+}
+
+// QueryBlockers returns the open blockers standing in the way of publishing an update
+func (bc *BlockerContract) QueryBlockers(ctx contractapi.TransactionContextInterface, updateID string) ([]*BIMBlocker, error) {
+    if updateID == "" {
+        return nil, fmt.Errorf("updateID required")
+    }
+    return openBlockers(ctx, updateID)
+}
+
+// openBlockers lists blockers with status OPEN linked to updateID
+func openBlockers(ctx contractapi.TransactionContextInterface, updateID string) ([]*BIMBlocker, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(blockerObjectType, []string{updateID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query blockers: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMBlocker{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var blocker BIMBlocker
+        if err := decodeRecord(schemaBIMBlocker, kv.Value, &blocker); err != nil {
+            return nil, fmt.Errorf("failed to parse blocker: %v", err)
+        }
+        if blocker.Status == BlockerOpen {
+            result = append(result, &blocker)
+        }
+    }
+    return result, nil
+}
+
+// describeBlockers formats blockers as "KIND reference (id)" for error messages
+func describeBlockers(blockers []*BIMBlocker) string {
+    parts := make([]string, 0, len(blockers))
+    for _, b := range blockers {
+        parts = append(parts, fmt.Sprintf("%s %s (%s)", b.Kind, b.Reference, b.BlockerID))
+    }
+    return strings.Join(parts, ", ")
+}
+
+func readBlocker(ctx contractapi.TransactionContextInterface, updateID string, blockerID string) (*BIMBlocker, error) {
+    key, err := makeKey(ctx, blockerObjectType, updateID, blockerID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read blocker: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var blocker BIMBlocker
+    if err := decodeRecord(schemaBIMBlocker, data, &blocker); err != nil {
+        return nil, fmt.Errorf("failed to parse blocker: %v", err)
+    }
+    return &blocker, nil
+}
+
+func putBlocker(ctx contractapi.TransactionContextInterface, blocker *BIMBlocker, event string) error {
+    key, err := makeKey(ctx, blockerObjectType, blocker.UpdateID, blocker.BlockerID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(blocker)
+    if err != nil {
+        return fmt.Errorf("failed to marshal blocker: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save blocker: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(event, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
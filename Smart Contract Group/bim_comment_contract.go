@@ -0,0 +1,178 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CommentContract keeps the review discussion of an update on-chain, so the
+// conversation leading to a decision is auditable alongside the decision itself
+type CommentContract struct {
+    contractapi.Contract
+}
+
+// BIMComment is one message in the discussion thread of an update
+type BIMComment struct {
+    UpdateID  string `json:"UpdateID"`
+    CommentID string `json:"CommentID"`         // transaction ID of AddComment
+    ReplyTo   string `json:"ReplyTo,omitempty"` // CommentID of the parent, empty for top-level comments
+    Text      string `json:"Text" validate:"required,max=4096"`
+    Author    string `json:"Author"` // pseudonym for reviewers of blind-review updates
+    AuthorMSP string `json:"AuthorMSP"`
+    Timestamp string `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventCommentAdded = "BIMCommentAdded"
+)
+
+// AddComment posts a comment on an update, optionally as a reply to an earlier comment,
+// and returns the new CommentID
+// - Caller must have role=modeler, role=professional or role=bim_lead
+// - On blind-review updates, comments by anyone but the initiator are recorded under a reviewer pseudonym
+func (cc *CommentContract) AddComment(ctx contractapi.TransactionContextInterface,
+    updateID string, text string, replyTo string) (string, error) {
+
+    if err := authorizeCallerRole(ctx, RoleModeler, RoleProfessional, RoleBIMLead); err != nil {
+        return "", fmt.Errorf("authorization failed: %v", err)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return "", err
+    }
+    comment := BIMComment{
+        UpdateID:      updateID,
+        CommentID:     ctx.GetStub().GetTxID(),
+        ReplyTo:       replyTo,
+        Text:          text,
+        Timestamp:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaBIMComment),
+    }
+    if err := validateStruct(&comment); err != nil {
+        return "", err
+    }
+
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return "", err
+    }
+    if replyTo != "" {
+        parent, err := readComment(ctx, updateID, replyTo)
+        if err != nil {
+            return "", err
+        }
+        if parent == nil {
+            return "", errNotFound("comment %s not found on update %s", replyTo, updateID)
+        }
+    }
+
+    authorID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return "", fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    comment.AuthorMSP, err = ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return "", fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    comment.Author = authorID
+    if update.ReviewMode == ReviewModeBlind && authorID != update.Initiator {
+        comment.Author, err = recordReviewerIdentity(ctx, updateID, authorID, nil)
+        if err != nil {
+            return "", err
+        }
+    }
+
+    key, err := makeKey(ctx, commentObjectType, updateID, comment.CommentID)
+    if err != nil {
+        return "", fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(comment)
+    if err != nil {
+        return "", fmt.Errorf("failed to marshal comment: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return "", fmt.Errorf("failed to save comment: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventCommentAdded, data); err != nil {
+        return "", fmt.Errorf("failed to set event: %v", err)
+    }
+    return comment.CommentID, nil
+}
+
+// QueryComments returns the discussion thread of an update in posting order.
+// Replies reference their parent through ReplyTo.
+// Reviewer pseudonyms on blind-review updates are resolved for bim_lead / auditor
+// callers, or for everyone once the update is published.
+func (cc *CommentContract) QueryComments(ctx contractapi.TransactionContextInterface, updateID string) ([]*BIMComment, error) {
+    if updateID == "" {
+        return nil, fmt.Errorf("updateID required")
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(commentObjectType, []string{updateID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query comments: %v", err)
+    }
+    defer iterator.Close()
+
+    comments := []*BIMComment{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var comment BIMComment
+        if err := decodeRecord(schemaBIMComment, kv.Value, &comment); err != nil {
+            return nil, fmt.Errorf("failed to parse comment: %v", err)
+        }
+        comments = append(comments, &comment)
+    }
+    // keys are ordered by transaction ID, not by time
+    sort.SliceStable(comments, func(i, j int) bool {
+        return comments[i].Timestamp < comments[j].Timestamp
+    })
+
+    visible, err := reviewersVisible(ctx, update)
+    if err != nil {
+        return nil, err
+    }
+    if visible && update.ReviewMode == ReviewModeBlind {
+        for _, comment := range comments {
+            identity, err := readReviewerIdentity(ctx, updateID, comment.Author)
+            if err != nil {
+                return nil, err
+            }
+            if identity != nil {
+                comment.Author = identity.ApproverID
+            }
+        }
+    }
+    return comments, nil
+}
+
+func readComment(ctx contractapi.TransactionContextInterface, updateID string, commentID string) (*BIMComment, error) {
+    key, err := makeKey(ctx, commentObjectType, updateID, commentID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read comment: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var comment BIMComment
+    if err := decodeRecord(schemaBIMComment, data, &comment); err != nil {
+        return nil, fmt.Errorf("failed to parse comment: %v", err)
+    }
+    return &comment, nil
+}
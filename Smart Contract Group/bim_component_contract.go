@@ -0,0 +1,278 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ComponentContract records who is responsible for which components of a model.
+// A component package groups IFC elements, by explicit GlobalIds or by GlobalId ranges,
+// under one owner, like a token with a single holder. Ownership moves with
+// TransferComponentPackage, and RouteUpdateByComponents turns the elements an update
+// touches into the reviewer assignment enforced by ApproveBIMUpdate.
+type ComponentContract struct {
+    contractapi.Contract
+}
+
+// GUIDRange is an inclusive range of IFC GlobalIds compared as strings
+type GUIDRange struct {
+    From string `json:"From" validate:"required,max=64"`
+    To   string `json:"To" validate:"required,max=64"`
+}
+
+// ComponentPackage is a set of model elements with a responsible owner
+type ComponentPackage struct {
+    ModelID    string      `json:"ModelID" validate:"required,max=64,id"`
+    PackageID  string      `json:"PackageID" validate:"required,max=64,id"`
+    Discipline string      `json:"Discipline" validate:"max=64"` // e.g. structure, me, architecture
+    GUIDs      []string    `json:"GUIDs"`
+    Ranges     []GUIDRange `json:"Ranges" validate:"dive"`
+    Owner      string      `json:"Owner" validate:"required,max=512"` // client ID of the responsible professional
+    OwnerMSP   string      `json:"OwnerMSP" validate:"required,max=64"`
+
+    UpdatedBy string              `json:"UpdatedBy"`
+    Timestamp string              `json:"Timestamp"`
+    Transfers []ComponentTransfer `json:"Transfers"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// ComponentTransfer records a change of a package's owner
+type ComponentTransfer struct {
+    FromOwner string `json:"FromOwner"`
+    ToOwner   string `json:"ToOwner"`
+    TxID      string `json:"TxID"`
+    Timestamp string `json:"Timestamp"`
+}
+
+const (
+    EventComponentPackageSet         = "BIMComponentPackageSet"
+    EventComponentPackageTransferred = "BIMComponentPackageTransferred"
+
+    maxPackageGUIDs   = 2000
+    maxRoutedElements = 5000
+)
+
+// SetComponentPackage creates or redefines a component package
+// - Caller must have role=bim_lead, or be the registered owner of the model
+// - packageJSON is a ComponentPackage with at least one GUID or range
+// - Redefining keeps the transfer history
+func (cc *ComponentContract) SetComponentPackage(ctx contractapi.TransactionContextInterface, packageJSON string) error {
+    var pkg ComponentPackage
+    if err := json.Unmarshal([]byte(packageJSON), &pkg); err != nil {
+        return fmt.Errorf("failed to parse component package: %v", err)
+    }
+    if err := validateStruct(&pkg); err != nil {
+        return err
+    }
+    pkg.GUIDs = uniqueSorted(pkg.GUIDs)
+    if len(pkg.GUIDs) == 0 && len(pkg.Ranges) == 0 {
+        return fmt.Errorf("package needs at least one GUID or range")
+    }
+    if len(pkg.GUIDs) > maxPackageGUIDs {
+        return fmt.Errorf("too many GUIDs: %d (max %d), use ranges", len(pkg.GUIDs), maxPackageGUIDs)
+    }
+    for i, r := range pkg.Ranges {
+        if r.To < r.From {
+            return fmt.Errorf("Ranges[%d]: To sorts before From", i)
+        }
+    }
+    if err := authorizeAssigner(ctx, pkg.ModelID); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+
+    existing, err := readComponentPackage(ctx, pkg.ModelID, pkg.PackageID)
+    if err != nil {
+        return err
+    }
+    pkg.Transfers = []ComponentTransfer{}
+    if existing != nil {
+        pkg.Transfers = existing.Transfers
+    }
+    return putComponentPackage(ctx, &pkg, EventComponentPackageSet)
+}
+
+// TransferComponentPackage hands a package over to a new owner
+// - Caller must be the current owner, have role=bim_lead, or be the registered owner of the model
+func (cc *ComponentContract) TransferComponentPackage(ctx contractapi.TransactionContextInterface,
+    modelID string, packageID string, newOwner string, newOwnerMSP string) error {
+
+    if newOwner == "" || newOwnerMSP == "" {
+        return fmt.Errorf("newOwner and newOwnerMSP required")
+    }
+    pkg, err := readComponentPackage(ctx, modelID, packageID)
+    if err != nil {
+        return err
+    }
+    if pkg == nil {
+        return errNotFound("component package %s not found in model %s", packageID, modelID)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if callerID != pkg.Owner {
+        if err := authorizeAssigner(ctx, modelID); err != nil {
+            return fmt.Errorf("authorization failed: %v", err)
+        }
+    }
+    if newOwner == pkg.Owner && newOwnerMSP == pkg.OwnerMSP {
+        return fmt.Errorf("%s already owns package %s", newOwner, packageID)
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    pkg.Transfers = append(pkg.Transfers, ComponentTransfer{
+        FromOwner: pkg.Owner,
+        ToOwner:   newOwner,
+        TxID:      ctx.GetStub().GetTxID(),
+        Timestamp: txTime.Format(time.RFC3339),
+    })
+    pkg.Owner = newOwner
+    pkg.OwnerMSP = newOwnerMSP
+    return putComponentPackage(ctx, pkg, EventComponentPackageTransferred)
+}
+
+// QueryComponentPackages lists the component packages of a model
+func (cc *ComponentContract) QueryComponentPackages(ctx contractapi.TransactionContextInterface, modelID string) ([]*ComponentPackage, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    return componentPackagesOf(ctx, modelID)
+}
+
+// QueryComponentOwners returns the owners responsible for the given elements of a model, sorted
+func (cc *ComponentContract) QueryComponentOwners(ctx contractapi.TransactionContextInterface, modelID string, guids []string) ([]string, error) {
+    packages, err := componentPackagesOf(ctx, modelID)
+    if err != nil {
+        return nil, err
+    }
+    return ownersOf(packages, guids), nil
+}
+
+// RouteUpdateByComponents assigns the owners of the touched elements as reviewers of an update.
+// touchedGUIDs are the element GlobalIds of the update's change manifest.
+// - Caller must have role=bim_lead, or be the registered owner of the model
+// - The update must be INITIALIZED; the assignment replaces any earlier one
+// - Fails when none of the elements belongs to a package
+func (cc *ComponentContract) RouteUpdateByComponents(ctx contractapi.TransactionContextInterface,
+    updateID string, touchedGUIDs []string) (*ReviewerAssignment, error) {
+
+    if len(touchedGUIDs) == 0 {
+        return nil, fmt.Errorf("touchedGUIDs required")
+    }
+    if len(touchedGUIDs) > maxRoutedElements {
+        return nil, fmt.Errorf("too many elements: %d (max %d)", len(touchedGUIDs), maxRoutedElements)
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if update.Status != StatusInitialized {
+        return nil, errInvalidState("update %s is %s, reviewers can only be assigned to INITIALIZED updates", updateID, update.Status)
+    }
+    if err := authorizeAssigner(ctx, update.ModelID); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+
+    packages, err := componentPackagesOf(ctx, update.ModelID)
+    if err != nil {
+        return nil, err
+    }
+    owners := ownersOf(packages, touchedGUIDs)
+    if len(owners) == 0 {
+        return nil, fmt.Errorf("no component package of model %s covers the touched elements; assign reviewers manually", update.ModelID)
+    }
+    return writeReviewerAssignment(ctx, update, owners)
+}
+
+// covers reports whether guid belongs to the package
+func (p *ComponentPackage) covers(guid string) bool {
+    i := sort.SearchStrings(p.GUIDs, guid)
+    if i < len(p.GUIDs) && p.GUIDs[i] == guid {
+        return true
+    }
+    for _, r := range p.Ranges {
+        if guid >= r.From && guid <= r.To {
+            return true
+        }
+    }
+    return false
+}
+
+// ownersOf returns the sorted, unique owners of the packages covering any of guids
+func ownersOf(packages []*ComponentPackage, guids []string) []string {
+    var owners []string
+    for _, p := range packages {
+        for _, g := range guids {
+            if p.covers(g) {
+                owners = append(owners, p.Owner)
+                break
+            }
+        }
+    }
+    return uniqueSorted(owners)
+}
+
+func readComponentPackage(ctx contractapi.TransactionContextInterface, modelID string, packageID string) (*ComponentPackage, error) {
+    key, err := makeKey(ctx, componentPackageObjectType, modelID, packageID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read component package: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var pkg ComponentPackage
+    if err := decodeRecord(schemaComponentPackage, data, &pkg); err != nil {
+        return nil, fmt.Errorf("failed to parse component package: %v", err)
+    }
+    return &pkg, nil
+}
+
+func componentPackagesOf(ctx contractapi.TransactionContextInterface, modelID string) ([]*ComponentPackage, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(componentPackageObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query component packages: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*ComponentPackage{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var pkg ComponentPackage
+        if err := decodeRecord(schemaComponentPackage, kv.Value, &pkg); err != nil {
+            return nil, fmt.Errorf("failed to parse component package: %v", err)
+        }
+        result = append(result, &pkg)
+    }
+    return result, nil
+}
+
+// putComponentPackage stamps and stores a package and emits event
+func putComponentPackage(ctx contractapi.TransactionContextInterface, pkg *ComponentPackage, event string) error {
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    pkg.UpdatedBy = callerID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    pkg.Timestamp = txTime.Format(time.RFC3339)
+    pkg.SchemaVersion = schemaVersion(schemaComponentPackage)
+    return putSubRecord(ctx, componentPackageObjectType, []string{pkg.ModelID, pkg.PackageID}, pkg, event)
+}
@@ -0,0 +1,153 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Concurrent update handling: what InitBIMUpdate does when the model already has an
+// update under review. The policy is network-wide, see ConfigContract.SetConcurrentUpdatePolicy.
+const (
+    ConcurrencyAllow  = "ALLOW"  // accept the update as before (default)
+    ConcurrencyReject = "REJECT" // refuse the new submission
+    ConcurrencyQueue  = "QUEUE"  // store it as QUEUED behind the latest open update
+    ConcurrencyFlag   = "FLAG"   // accept it for review, listing the open updates in ConcurrentWith
+
+    // StatusQueued is an update waiting for its PendingAfter update to be decided.
+    // It becomes INITIALIZED when that update leaves review.
+    StatusQueued = "QUEUED"
+)
+
+// validConcurrencyPolicy reports whether policy is one of the Concurrency* values
+func validConcurrencyPolicy(policy string) bool {
+    switch policy {
+    case ConcurrencyAllow, ConcurrencyReject, ConcurrencyQueue, ConcurrencyFlag:
+        return true
+    }
+    return false
+}
+
+// isOpenStatus reports whether an update in status still blocks concurrent submissions
+func isOpenStatus(status string) bool {
+    return status == StatusInitialized || status == StatusQueued || status == StatusPendingValidation
+}
+
+// checkConcurrentUpdates applies the network's concurrent update policy to a new
+// INITIALIZED update, possibly changing its Status, PendingAfter and ConcurrentWith
+func checkConcurrentUpdates(ctx contractapi.TransactionContextInterface, input *BIMUpdate) error {
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return err
+    }
+    if cfg.ConcurrentUpdatePolicy == ConcurrencyAllow {
+        return nil
+    }
+    open, err := openUpdatesOf(ctx, input.ModelID)
+    if err != nil {
+        return err
+    }
+    if len(open) == 0 {
+        return nil
+    }
+
+    switch cfg.ConcurrentUpdatePolicy {
+    case ConcurrencyReject:
+        ids := make([]string, len(open))
+        for i, u := range open {
+            ids[i] = u.UpdateID
+        }
+        return fmt.Errorf("model %s already has updates under review: %s", input.ModelID, describeDependencies(ids))
+    case ConcurrencyQueue:
+        // queue behind the newest open update, so queued updates are released one at a time
+        input.Status = StatusQueued
+        input.PendingAfter = open[len(open)-1].UpdateID
+    case ConcurrencyFlag:
+        for _, u := range open {
+            input.ConcurrentWith = append(input.ConcurrentWith, u.UpdateID)
+        }
+    }
+    return nil
+}
+
+// openUpdatesOf returns the INITIALIZED, QUEUED and PENDING_VALIDATION updates of a model, oldest first
+func openUpdatesOf(ctx contractapi.TransactionContextInterface, modelID string) ([]*BIMUpdate, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(openUpdateObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query open update index: %v", err)
+    }
+    defer iterator.Close()
+
+    var open []*BIMUpdate
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, openUpdateObjectType)
+        if err != nil {
+            continue
+        }
+        update, err := updates.GetUpdate(ctx, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        open = append(open, update)
+    }
+    sort.Slice(open, func(i, j int) bool {
+        if open[i].Timestamp != open[j].Timestamp {
+            return open[i].Timestamp < open[j].Timestamp
+        }
+        return open[i].UpdateID < open[j].UpdateID
+    })
+    return open, nil
+}
+
+// setOpenIndex keeps the open update and pending-after indexes in step with a status change
+func setOpenIndex(ctx contractapi.TransactionContextInterface, update *BIMUpdate, previous string) error {
+    wasOpen, isOpen := isOpenStatus(previous), isOpenStatus(update.Status)
+    if !wasOpen && isOpen {
+        if err := putIndexEntry(ctx, openUpdateObjectType, update.ModelID, update.UpdateID); err != nil {
+            return err
+        }
+    }
+    if wasOpen && !isOpen {
+        if err := delIndexEntry(ctx, openUpdateObjectType, update.ModelID, update.UpdateID); err != nil {
+            return err
+        }
+    }
+    if update.PendingAfter == "" {
+        return nil
+    }
+    if previous != StatusQueued && update.Status == StatusQueued {
+        return putIndexEntry(ctx, pendingAfterObjectType, update.PendingAfter, update.UpdateID)
+    }
+    if previous == StatusQueued && update.Status != StatusQueued {
+        return delIndexEntry(ctx, pendingAfterObjectType, update.PendingAfter, update.UpdateID)
+    }
+    return nil
+}
+
+// queuedBehind returns the IDs of the QUEUED updates waiting for updateID
+func queuedBehind(ctx contractapi.TransactionContextInterface, updateID string) ([]string, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingAfterObjectType, []string{updateID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query pending-after index: %v", err)
+    }
+    defer iterator.Close()
+
+    var ids []string
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, pendingAfterObjectType)
+        if err != nil {
+            continue
+        }
+        ids = append(ids, attrs[1])
+    }
+    return ids, nil
+}
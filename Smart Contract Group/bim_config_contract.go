@@ -0,0 +1,295 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ConfigContract stores network-wide settings on the ledger so that policy changes
+// take effect with a transaction instead of a chaincode upgrade. Until a setting is
+// written, the compiled-in default applies.
+type ConfigContract struct {
+    contractapi.Contract
+}
+
+// NetworkConfig holds the network-wide settings
+type NetworkConfig struct {
+    // AllowedRoles are the role attribute values that approval policies may require
+    AllowedRoles []string `json:"AllowedRoles"`
+    // DefaultApprovalThreshold is the approvals needed for models without an approval policy
+    DefaultApprovalThreshold int `json:"DefaultApprovalThreshold"`
+    // MaxUpdateRecordBytes caps the serialized size of a new BIMUpdate
+    MaxUpdateRecordBytes int `json:"MaxUpdateRecordBytes"`
+    // ReviewDeadlineHours is how long an INITIALIZED update may wait for review
+    // before off-chain reminder services escalate it
+    ReviewDeadlineHours int `json:"ReviewDeadlineHours"`
+    // ConcurrentUpdatePolicy is what InitBIMUpdate does when the model already has an
+    // update under review: ALLOW, REJECT, QUEUE or FLAG (see bim_concurrency.go)
+    ConcurrentUpdatePolicy string `json:"ConcurrentUpdatePolicy"`
+    // DepartmentMSPs maps a department attribute value to the MSP IDs whose
+    // certificates may claim it. Departments without an entry are not restricted.
+    DepartmentMSPs map[string][]string `json:"DepartmentMSPs,omitempty"`
+    // StorageQuotaBytes caps the total declared size of the files anchored on the
+    // channel, i.e. by the project. 0 means no quota.
+    StorageQuotaBytes int64 `json:"StorageQuotaBytes,omitempty"`
+    // RequireValidation holds new updates in PENDING_VALIDATION until a validator
+    // records automated check results (see bim_validation_results.go)
+    RequireValidation bool `json:"RequireValidation,omitempty"`
+    // ClockSkewSeconds is how far client supplied timestamps, such as the SignedAt and
+    // ExpiresAt of pre-signed payloads, may lie off the transaction timestamp
+    ClockSkewSeconds int `json:"ClockSkewSeconds"`
+    // UpdateIDStrategy is how InitBIMUpdate generates a missing UpdateID: ulid, txid or
+    // none (see bim_update_id.go)
+    UpdateIDStrategy string `json:"UpdateIDStrategy,omitempty"`
+
+    Revision  int    `json:"Revision"` // incremented on every change, 0 for the defaults
+    UpdatedBy string `json:"UpdatedBy,omitempty"`
+    Timestamp string `json:"Timestamp,omitempty"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// NetworkConfigChange is the payload of EventNetworkConfigChanged
+type NetworkConfigChange struct {
+    Setting string        `json:"Setting"`
+    Config  NetworkConfig `json:"Config"`
+}
+
+const (
+    EventNetworkConfigChanged = "BIMNetworkConfigChanged"
+
+    defaultReviewDeadlineHours = 72
+    defaultClockSkewSeconds    = 300
+    maxClockSkewSeconds        = 3600
+)
+
+// SetAllowedRoles sets the roles approval policies may require
+// - Caller must have role=admin
+// - roles must contain at least one value
+func (cc *ConfigContract) SetAllowedRoles(ctx contractapi.TransactionContextInterface, roles []string) error {
+    roles = uniqueSorted(roles)
+    if len(roles) == 0 {
+        return fmt.Errorf("at least one role required")
+    }
+    return changeNetworkConfig(ctx, "AllowedRoles", func(c *NetworkConfig) { c.AllowedRoles = roles })
+}
+
+// SetDefaultApprovalThreshold sets the approvals needed for models without an approval policy
+// - Caller must have role=admin
+// - threshold must be at least 1
+func (cc *ConfigContract) SetDefaultApprovalThreshold(ctx contractapi.TransactionContextInterface, threshold int) error {
+    if threshold < 1 {
+        return fmt.Errorf("threshold must be at least 1")
+    }
+    return changeNetworkConfig(ctx, "DefaultApprovalThreshold", func(c *NetworkConfig) { c.DefaultApprovalThreshold = threshold })
+}
+
+// SetMaxUpdateRecordBytes sets the size limit of new BIMUpdate records
+// - Caller must have role=admin
+// - limit must be between 1 KiB and 1 MiB
+func (cc *ConfigContract) SetMaxUpdateRecordBytes(ctx contractapi.TransactionContextInterface, limit int) error {
+    if limit < 1<<10 || limit > 1<<20 {
+        return fmt.Errorf("limit must be between %d and %d bytes", 1<<10, 1<<20)
+    }
+    return changeNetworkConfig(ctx, "MaxUpdateRecordBytes", func(c *NetworkConfig) { c.MaxUpdateRecordBytes = limit })
+}
+
+// SetReviewDeadline sets how many hours an update may wait for review
+// - Caller must have role=admin
+// - hours must be at least 1
+func (cc *ConfigContract) SetReviewDeadline(ctx contractapi.TransactionContextInterface, hours int) error {
+    if hours < 1 {
+        return fmt.Errorf("hours must be at least 1")
+    }
+    return changeNetworkConfig(ctx, "ReviewDeadlineHours", func(c *NetworkConfig) { c.ReviewDeadlineHours = hours })
+}
+
+// SetConcurrentUpdatePolicy sets how new updates are handled while the model has one under review
+// - Caller must have role=admin
+// - policy must be ALLOW, REJECT, QUEUE or FLAG
+func (cc *ConfigContract) SetConcurrentUpdatePolicy(ctx contractapi.TransactionContextInterface, policy string) error {
+    if !validConcurrencyPolicy(policy) {
+        return fmt.Errorf("invalid policy: must be ALLOW, REJECT, QUEUE or FLAG")
+    }
+    return changeNetworkConfig(ctx, "ConcurrentUpdatePolicy", func(c *NetworkConfig) { c.ConcurrentUpdatePolicy = policy })
+}
+
+// SetDepartmentMSPs sets the MSP IDs whose certificates may claim department
+// - Caller must have role=admin
+// - an empty mspIDs removes the restriction for department
+func (cc *ConfigContract) SetDepartmentMSPs(ctx contractapi.TransactionContextInterface, department string, mspIDs []string) error {
+    if department == "" {
+        return fmt.Errorf("department is required")
+    }
+    mspIDs = uniqueSorted(mspIDs)
+    return changeNetworkConfig(ctx, "DepartmentMSPs", func(c *NetworkConfig) {
+        departments := map[string][]string{}
+        for d, ids := range c.DepartmentMSPs {
+            departments[d] = ids
+        }
+        if len(mspIDs) == 0 {
+            delete(departments, department)
+        } else {
+            departments[department] = mspIDs
+        }
+        c.DepartmentMSPs = departments
+    })
+}
+
+// SetStorageQuota sets the total file size the project may anchor
+// - Caller must have role=admin
+// - quotaBytes 0 removes the quota; usage already recorded is not checked
+func (cc *ConfigContract) SetStorageQuota(ctx contractapi.TransactionContextInterface, quotaBytes int64) error {
+    if quotaBytes < 0 {
+        return fmt.Errorf("quotaBytes must not be negative")
+    }
+    return changeNetworkConfig(ctx, "StorageQuotaBytes", func(c *NetworkConfig) { c.StorageQuotaBytes = quotaBytes })
+}
+
+// SetClockSkew sets the tolerance for client supplied timestamps
+// - Caller must have role=admin
+// - seconds must be between 1 and 3600
+func (cc *ConfigContract) SetClockSkew(ctx contractapi.TransactionContextInterface, seconds int) error {
+    if seconds < 1 || seconds > maxClockSkewSeconds {
+        return fmt.Errorf("seconds must be between 1 and %d", maxClockSkewSeconds)
+    }
+    return changeNetworkConfig(ctx, "ClockSkewSeconds", func(c *NetworkConfig) { c.ClockSkewSeconds = seconds })
+}
+
+// SetUpdateIDStrategy sets how InitBIMUpdate generates a missing UpdateID
+// - Caller must have role=admin
+// - strategy must be ulid, txid or none
+func (cc *ConfigContract) SetUpdateIDStrategy(ctx contractapi.TransactionContextInterface, strategy string) error {
+    if !validUpdateIDStrategy(strategy) {
+        return fmt.Errorf("invalid strategy: must be ulid, txid or none")
+    }
+    return changeNetworkConfig(ctx, "UpdateIDStrategy", func(c *NetworkConfig) { c.UpdateIDStrategy = strategy })
+}
+
+// SetValidationRequired turns the automated validation phase for new updates on or off
+// - Caller must have role=admin
+// - updates already pending validation stay pending until a result is recorded
+func (cc *ConfigContract) SetValidationRequired(ctx contractapi.TransactionContextInterface, required bool) error {
+    return changeNetworkConfig(ctx, "RequireValidation", func(c *NetworkConfig) { c.RequireValidation = required })
+}
+
+// QueryNetworkConfig returns the settings in effect, with defaults for unset values
+func (cc *ConfigContract) QueryNetworkConfig(ctx contractapi.TransactionContextInterface) (*NetworkConfig, error) {
+    return networkConfig(ctx)
+}
+
+// changeNetworkConfig applies one setter, bumps the revision and emits EventNetworkConfigChanged
+func changeNetworkConfig(ctx contractapi.TransactionContextInterface, setting string, apply func(c *NetworkConfig)) error {
+    if err := authorizeCallerRole(ctx, RoleAdmin); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return err
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    apply(cfg)
+    cfg.Revision++
+    cfg.UpdatedBy = callerID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    cfg.Timestamp = txTime.Format(time.RFC3339)
+    cfg.SchemaVersion = schemaVersion(schemaNetworkConfig)
+
+    data, err := marshalState(cfg)
+    if err != nil {
+        return fmt.Errorf("failed to marshal network config: %v", err)
+    }
+    key, err := makeKey(ctx, networkConfigObjectType)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save network config: %v", err)
+    }
+    eventBytes, err := marshalState(NetworkConfigChange{Setting: setting, Config: *cfg})
+    if err != nil {
+        return fmt.Errorf("failed to marshal network config change: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventNetworkConfigChanged, eventBytes); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// networkConfig loads the stored settings and fills unset values with the defaults
+func networkConfig(ctx contractapi.TransactionContextInterface) (*NetworkConfig, error) {
+    cfg := &NetworkConfig{SchemaVersion: schemaVersion(schemaNetworkConfig)}
+    key, err := makeKey(ctx, networkConfigObjectType)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read network config: %v", err)
+    }
+    if data != nil {
+        if err := decodeRecord(schemaNetworkConfig, data, cfg); err != nil {
+            return nil, fmt.Errorf("failed to parse network config: %v", err)
+        }
+    }
+    if len(cfg.AllowedRoles) == 0 {
+        cfg.AllowedRoles = []string{RoleAuditor, RoleBIMLead, RoleModeler, RoleProfessional, RoleSurveyor}
+    }
+    if cfg.DefaultApprovalThreshold == 0 {
+        cfg.DefaultApprovalThreshold = 1
+    }
+    if cfg.MaxUpdateRecordBytes == 0 {
+        cfg.MaxUpdateRecordBytes = maxUpdateRecordBytes
+    }
+    if cfg.ReviewDeadlineHours == 0 {
+        cfg.ReviewDeadlineHours = defaultReviewDeadlineHours
+    }
+    if cfg.ConcurrentUpdatePolicy == "" {
+        cfg.ConcurrentUpdatePolicy = ConcurrencyAllow
+    }
+    if cfg.ClockSkewSeconds == 0 {
+        cfg.ClockSkewSeconds = defaultClockSkewSeconds
+    }
+    if cfg.UpdateIDStrategy == "" {
+        cfg.UpdateIDStrategy = UpdateIDStrategyULID
+    }
+    return cfg, nil
+}
+
+// clockSkew returns ClockSkewSeconds as a duration
+func (c *NetworkConfig) clockSkew() time.Duration {
+    return time.Duration(c.ClockSkewSeconds) * time.Second
+}
+
+// roleAllowed reports whether role is one of cfg.AllowedRoles
+func (c *NetworkConfig) roleAllowed(role string) bool {
+    for _, r := range c.AllowedRoles {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+// departmentAllowed reports whether a certificate issued by mspID may claim department
+func (c *NetworkConfig) departmentAllowed(department string, mspID string) bool {
+    ids, ok := c.DepartmentMSPs[department]
+    if !ok {
+        return true
+    }
+    for _, id := range ids {
+        if id == mspID {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,29 @@
+package chaincode
+
+import (
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Contracts returns every contract of the BIM chaincode, in the order they are
+// registered with contractapi.NewChaincode. SmartContract comes first and is therefore
+// the default contract for function names without a "Contract:" prefix.
+func Contracts() []contractapi.ContractInterface {
+    return []contractapi.ContractInterface{
+        &SmartContract{},
+        &ApprovalContract{},
+        &QueryContract{},
+        &ConfigContract{},
+        &ModelRegistryContract{},
+        &BaselineContract{},
+        &CommentContract{},
+        &BlockerContract{},
+        &BCFContract{},
+        &AppealContract{},
+        &DeviationContract{},
+        &AccessLogContract{},
+        &ComponentContract{},
+        &TagContract{},
+        &WatchContract{},
+        &RoleAdminContract{},
+    }
+}
@@ -0,0 +1,59 @@
+package chaincode
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// checkDependencies validates DependsOn at init time: every entry must be an existing
+// update of another model, listed once, and not REJECTED
+func checkDependencies(ctx contractapi.TransactionContextInterface, input *BIMUpdate) error {
+    if len(input.DependsOn) > maxDependencies {
+        return fmt.Errorf("too many dependencies: %d (max %d)", len(input.DependsOn), maxDependencies)
+    }
+    seen := map[string]bool{}
+    for i, depID := range input.DependsOn {
+        if depID == "" || depID == input.UpdateID {
+            return fmt.Errorf("DependsOn[%d]: invalid dependency %q", i, depID)
+        }
+        if seen[depID] {
+            return fmt.Errorf("DependsOn[%d]: %s listed twice", i, depID)
+        }
+        seen[depID] = true
+
+        dep, err := updates.GetUpdate(ctx, depID)
+        if err != nil {
+            return fmt.Errorf("DependsOn[%d]: %v", i, err)
+        }
+        if dep.ModelID == input.ModelID {
+            return fmt.Errorf("DependsOn[%d]: %s belongs to the same model %s", i, depID, input.ModelID)
+        }
+        if dep.Status == StatusRejected {
+            return fmt.Errorf("DependsOn[%d]: %s was rejected", i, depID)
+        }
+    }
+    return nil
+}
+
+// unmetDependencies returns the dependencies of update that are not yet APPROVED or PUBLISHED,
+// formatted as "updateID (STATUS)"
+func unmetDependencies(ctx contractapi.TransactionContextInterface, update *BIMUpdate) ([]string, error) {
+    var unmet []string
+    for _, depID := range update.DependsOn {
+        dep, err := updates.GetUpdate(ctx, depID)
+        if err != nil {
+            return nil, err
+        }
+        if dep.Status != StatusApproved && dep.Status != StatusPublished {
+            unmet = append(unmet, fmt.Sprintf("%s (%s)", depID, dep.Status))
+        }
+    }
+    return unmet, nil
+}
+
+// describeDependencies joins unmetDependencies output for error messages
+func describeDependencies(unmet []string) string {
+    return strings.Join(unmet, ", ")
+}
@@ -0,0 +1,81 @@
+package chaincode
+
+import (
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "fmt"
+    "strings"
+
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Detached signatures over the delivered files. The proposal signature only shows that
+// the initiator submitted the transaction; a DetachedSignature made with the same key
+// over the file hashes shows they signed the exact content, which matters when a
+// gateway builds the transaction for them.
+//
+// The signed digest is SHA-256 over one line per entry of Files, in order:
+//
+//	<HashAlgorithm>:<lower-case hex Hash>\n
+//
+// with HashAlgorithm "sha256" when empty. ECDSA signatures are ASN.1 encoded, RSA
+// signatures use PKCS#1 v1.5; the mapping suite's SignDeliveryFiles produces both.
+
+// filesDigest returns the digest a DetachedSignature signs
+func filesDigest(files []FileEntry) []byte {
+    h := sha256.New()
+    for _, f := range files {
+        algorithm := f.HashAlgorithm
+        if algorithm == "" {
+            algorithm = "sha256"
+        }
+        fmt.Fprintf(h, "%s:%s\n", algorithm, strings.ToLower(f.Hash))
+    }
+    return h.Sum(nil)
+}
+
+// verifyDetachedSignature checks input.DetachedSignature against the public key of the
+// submitter's certificate. Updates without a DetachedSignature pass unchanged.
+func verifyDetachedSignature(ctx contractapi.TransactionContextInterface, input *BIMUpdate) error {
+    if input.DetachedSignature == "" {
+        return nil
+    }
+    if len(input.Files) == 0 {
+        return fmt.Errorf("DetachedSignature requires Files")
+    }
+    sig, err := base64.StdEncoding.DecodeString(input.DetachedSignature)
+    if err != nil {
+        return fmt.Errorf("DetachedSignature must be base64 encoded: %v", err)
+    }
+
+    ci, err := cid.New(ctx.GetStub())
+    if err != nil {
+        return fmt.Errorf("failed to create client identity: %v", err)
+    }
+    cert, err := ci.GetX509Certificate()
+    if err != nil {
+        return fmt.Errorf("failed to get creator certificate: %v", err)
+    }
+    if cert == nil {
+        return fmt.Errorf("creator identity has no X.509 certificate to verify DetachedSignature")
+    }
+
+    digest := filesDigest(input.Files)
+    switch pub := cert.PublicKey.(type) {
+    case *ecdsa.PublicKey:
+        if !ecdsa.VerifyASN1(pub, digest, sig) {
+            return fmt.Errorf("DetachedSignature does not match the files and the submitter's certificate")
+        }
+    case *rsa.PublicKey:
+        if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig); err != nil {
+            return fmt.Errorf("DetachedSignature does not match the files and the submitter's certificate")
+        }
+    default:
+        return fmt.Errorf("unsupported certificate key type %T for DetachedSignature", cert.PublicKey)
+    }
+    return nil
+}
@@ -0,0 +1,196 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DeviationContract records as-built deviations measured on site against
+// published design updates, for construction verification
+type DeviationContract struct {
+    contractapi.Contract
+}
+
+// BIMDeviation links surveyed / as-built data to an element of a published update
+type BIMDeviation struct {
+    DeviationID    string  `json:"DeviationID" validate:"required,max=64,id"`
+    UpdateID       string  `json:"UpdateID" validate:"required,max=64,id"`
+    ModelID        string  `json:"ModelID"`
+    ElementID      string  `json:"ElementID" validate:"required,max=64"` // IFC GUID of the design element
+    PointCloudHash string  `json:"PointCloudHash" validate:"max=128"`    // hash of the point-cloud extract
+    ReportCID      string  `json:"ReportCID" validate:"max=128"`         // IPFS CID of the deviation report
+    MagnitudeMM    float64 `json:"MagnitudeMM"`                          // measured deviation in millimetres
+    Severity       string  `json:"Severity"`                             // derived from MagnitudeMM
+    Description    string  `json:"Description" validate:"max=4096"`
+    Surveyor       string  `json:"Surveyor"`
+    Timestamp      string  `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    SeverityMinor    = "MINOR"
+    SeverityModerate = "MODERATE"
+    SeverityMajor    = "MAJOR"
+    SeverityCritical = "CRITICAL"
+
+    EventDeviationRecorded = "BIMDeviationRecorded"
+)
+
+// classifyDeviation maps a deviation magnitude (mm) to a severity class
+func classifyDeviation(mm float64) string {
+    switch {
+    case mm <= 10:
+        return SeverityMinor
+    case mm <= 25:
+        return SeverityModerate
+    case mm <= 50:
+        return SeverityMajor
+    default:
+        return SeverityCritical
+    }
+}
+
+// RecordDeviation stores an as-built deviation against a published update
+// - Caller must have role=surveyor or role=professional
+// - The referenced update must be PUBLISHED
+// - Severity is derived from MagnitudeMM
+func (dc *DeviationContract) RecordDeviation(ctx contractapi.TransactionContextInterface, deviationJSON string) error {
+    if err := authorizeCallerRole(ctx, RoleSurveyor, RoleProfessional); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+
+    var input BIMDeviation
+    if err := json.Unmarshal([]byte(deviationJSON), &input); err != nil {
+        return fmt.Errorf("failed to parse deviation JSON: %v", err)
+    }
+    if err := validateStruct(&input); err != nil {
+        return err
+    }
+    if input.PointCloudHash == "" && input.ReportCID == "" {
+        return fmt.Errorf("PointCloudHash or ReportCID is required")
+    }
+    if input.MagnitudeMM < 0 {
+        return fmt.Errorf("MagnitudeMM must not be negative")
+    }
+
+    update, err := updates.GetUpdate(ctx, input.UpdateID)
+    if err != nil {
+        return err
+    }
+    if update.Status != StatusPublished {
+        return errInvalidState("update %s is %s, deviations can only be recorded against PUBLISHED updates", input.UpdateID, update.Status)
+    }
+
+    key, err := makeKey(ctx, deviationObjectType, input.DeviationID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    existing, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return fmt.Errorf("failed to read deviation: %v", err)
+    }
+    if existing != nil {
+        return errDuplicate("deviation %s already exists", input.DeviationID)
+    }
+
+    surveyorID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get surveyor identity: %v", err)
+    }
+    input.ModelID = update.ModelID
+    input.Severity = classifyDeviation(input.MagnitudeMM)
+    input.Surveyor = surveyorID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    input.Timestamp = txTime.Format(time.RFC3339)
+    input.SchemaVersion = schemaVersion(schemaBIMDeviation)
+
+    data, err := marshalState(input)
+    if err != nil {
+        return fmt.Errorf("failed to marshal deviation: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save deviation: %v", err)
+    }
+    if err := putIndexEntry(ctx, deviationElementIndexObjectType, input.ElementID, input.DeviationID); err != nil {
+        return err
+    }
+    if err := putIndexEntry(ctx, deviationSeverityIndexObjectType, input.Severity, input.DeviationID); err != nil {
+        return err
+    }
+
+    if err := ctx.GetStub().SetEvent(EventDeviationRecorded, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// QueryDeviation returns a single deviation record
+func (dc *DeviationContract) QueryDeviation(ctx contractapi.TransactionContextInterface, deviationID string) (*BIMDeviation, error) {
+    key, err := makeKey(ctx, deviationObjectType, deviationID)
+    if err != nil {
+        return nil, err
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, err
+    }
+    if data == nil {
+        return nil, fmt.Errorf("no deviation record %s", deviationID)
+    }
+    var deviation BIMDeviation
+    if err := decodeRecord(schemaBIMDeviation, data, &deviation); err != nil {
+        return nil, err
+    }
+    return &deviation, nil
+}
+
+// QueryDeviationsByElement lists all deviations recorded for an element (IFC GUID)
+func (dc *DeviationContract) QueryDeviationsByElement(ctx contractapi.TransactionContextInterface, elementID string) ([]*BIMDeviation, error) {
+    if elementID == "" {
+        return nil, fmt.Errorf("elementID required")
+    }
+    return dc.queryDeviationIndex(ctx, deviationElementIndexObjectType, elementID)
+}
+
+// QueryDeviationsBySeverity lists all deviations of a severity class
+func (dc *DeviationContract) QueryDeviationsBySeverity(ctx contractapi.TransactionContextInterface, severity string) ([]*BIMDeviation, error) {
+    switch severity {
+    case SeverityMinor, SeverityModerate, SeverityMajor, SeverityCritical:
+    default:
+        return nil, fmt.Errorf("invalid severity: must be MINOR, MODERATE, MAJOR or CRITICAL")
+    }
+    return dc.queryDeviationIndex(ctx, deviationSeverityIndexObjectType, severity)
+}
+
+func (dc *DeviationContract) queryDeviationIndex(ctx contractapi.TransactionContextInterface, indexType string, value string) ([]*BIMDeviation, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(indexType, []string{value})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query %s: %v", indexType, err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMDeviation{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, indexType)
+        if err != nil {
+            continue
+        }
+        deviation, err := dc.QueryDeviation(ctx, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        result = append(result, deviation)
+    }
+    return result, nil
+}
@@ -0,0 +1,110 @@
+package chaincode
+
+import (
+    "errors"
+
+    "github.com/hyperledger/fabric-chaincode-go/shim"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// DryRunResult reports what a transaction would do without changing the ledger
+type DryRunResult struct {
+    Result           string           `json:"Result,omitempty"` // return value of the simulated call, e.g. the UpdateID
+    Error            string           `json:"Error,omitempty"`  // why the transaction would fail
+    ValidationErrors ValidationErrors `json:"ValidationErrors,omitempty"`
+    Writes           []StateChange    `json:"Writes"`
+    Event            *DryRunEvent     `json:"Event,omitempty"`
+}
+
+// StateChange is one projected world-state write
+type StateChange struct {
+    ObjectType string   `json:"ObjectType,omitempty"` // empty for simple keys such as BIMUpdate records
+    Attrs      []string `json:"Attrs"`
+    Value      string   `json:"Value,omitempty"`
+    Deleted    bool     `json:"Deleted,omitempty"`
+}
+
+// DryRunEvent is the chaincode event the transaction would emit
+type DryRunEvent struct {
+    Name    string `json:"Name"`
+    Payload string `json:"Payload"`
+}
+
+// DryRunInitBIMUpdate runs InitBIMUpdate without writing anything and returns the would-be
+// UpdateID, validation errors and state changes. Meant to be evaluated, not submitted;
+// even a submitted dry run leaves the ledger unchanged.
+func (s *SmartContract) DryRunInitBIMUpdate(ctx contractapi.TransactionContextInterface, updateJSON string) (*DryRunResult, error) {
+    return dryRun(ctx, func(sim contractapi.TransactionContextInterface) (string, error) {
+        return s.InitBIMUpdate(sim, updateJSON)
+    })
+}
+
+// DryRunApproveBIMUpdate runs ApproveBIMUpdate without writing anything and returns the
+// projected approval records and status change
+func (c *ApprovalContract) DryRunApproveBIMUpdate(ctx contractapi.TransactionContextInterface,
+    updateID string, approveResult string, comment string, reasonCode string) (*DryRunResult, error) {
+
+    return dryRun(ctx, func(sim contractapi.TransactionContextInterface) (string, error) {
+        return "", c.ApproveBIMUpdate(sim, updateID, approveResult, comment, reasonCode)
+    })
+}
+
+// dryRun calls fn with a context whose stub records writes and events instead of applying them.
+// Failures of fn are reported in the result; only infrastructure errors are returned.
+func dryRun(ctx contractapi.TransactionContextInterface, fn func(contractapi.TransactionContextInterface) (string, error)) (*DryRunResult, error) {
+    rec := &recordingStub{ChaincodeStubInterface: ctx.GetStub()}
+    sim := &contractapi.TransactionContext{}
+    sim.SetStub(rec)
+    sim.SetClientIdentity(ctx.GetClientIdentity())
+
+    out, err := fn(sim)
+    result := &DryRunResult{Writes: []StateChange{}}
+    if err != nil {
+        result.Error = err.Error()
+        var verrs ValidationErrors
+        if errors.As(err, &verrs) {
+            result.ValidationErrors = verrs
+        }
+        return result, nil
+    }
+    result.Result = out
+    result.Writes = rec.writes
+    result.Event = rec.event
+    return result, nil
+}
+
+// recordingStub passes reads through to the real stub and captures writes and events
+type recordingStub struct {
+    shim.ChaincodeStubInterface
+    writes []StateChange
+    event  *DryRunEvent
+}
+
+func (r *recordingStub) PutState(key string, value []byte) error {
+    r.record(key, value, false)
+    return nil
+}
+
+func (r *recordingStub) DelState(key string) error {
+    r.record(key, nil, true)
+    return nil
+}
+
+func (r *recordingStub) SetEvent(name string, payload []byte) error {
+    // as on a peer, only the last event of a transaction is emitted
+    r.event = &DryRunEvent{Name: name, Payload: string(payload)}
+    return nil
+}
+
+func (r *recordingStub) record(key string, value []byte, deleted bool) {
+    change := StateChange{Attrs: []string{key}, Deleted: deleted}
+    if len(value) != 1 || value[0] != 0x00 { // index entries hold an empty marker
+        change.Value = string(value)
+    }
+    if isCompositeKey(key) {
+        if objectType, attrs, err := r.SplitCompositeKey(key); err == nil {
+            change.ObjectType, change.Attrs = objectType, attrs
+        }
+    }
+    r.writes = append(r.writes, change)
+}
@@ -0,0 +1,69 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+)
+
+// Typed errors.
+//
+// Fabric hands clients nothing but the message string of a failed transaction, so
+// errors clients need to branch on are returned as *ChaincodeError, whose message is
+// the JSON payload {"Code":"NOT_FOUND","Message":"the update u1 does not exist"}.
+// Wrapping one with fmt.Errorf("...: %v", err) keeps the payload intact inside the
+// longer message; clients look for the first {"Code": object in the message (see
+// bimclient). Other errors keep their plain English messages.
+
+// Error codes of the structured error payload
+const (
+    CodeNotFound     = "NOT_FOUND"     // the update or record does not exist
+    CodeUnauthorized = "UNAUTHORIZED"  // the caller's role or identity may not do this
+    CodeInvalidState = "INVALID_STATE" // the record's status does not allow the operation
+    CodeDuplicate    = "DUPLICATE"     // the record, vote or nonce already exists
+)
+
+// Sentinels for errors.Is; a *ChaincodeError matches the sentinel of its Code
+var (
+    ErrNotFound     = &ChaincodeError{Code: CodeNotFound}
+    ErrUnauthorized = &ChaincodeError{Code: CodeUnauthorized}
+    ErrInvalidState = &ChaincodeError{Code: CodeInvalidState}
+    ErrDuplicate    = &ChaincodeError{Code: CodeDuplicate}
+)
+
+// ChaincodeError is an error with a code clients can branch on
+type ChaincodeError struct {
+    Code    string `json:"Code"`
+    Message string `json:"Message"`
+}
+
+// Error returns the JSON payload
+func (e *ChaincodeError) Error() string {
+    data, err := json.Marshal(e)
+    if err != nil {
+        return e.Code + ": " + e.Message
+    }
+    return string(data)
+}
+
+// Is matches the sentinel of e.Code
+func (e *ChaincodeError) Is(target error) bool {
+    var t *ChaincodeError
+    return errors.As(target, &t) && t.Message == "" && t.Code == e.Code
+}
+
+func errNotFound(format string, args ...interface{}) error {
+    return &ChaincodeError{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func errUnauthorized(format string, args ...interface{}) error {
+    return &ChaincodeError{Code: CodeUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+func errInvalidState(format string, args ...interface{}) error {
+    return &ChaincodeError{Code: CodeInvalidState, Message: fmt.Sprintf(format, args...)}
+}
+
+func errDuplicate(format string, args ...interface{}) error {
+    return &ChaincodeError{Code: CodeDuplicate, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,101 @@
+package chaincode
+
+import (
+    "encoding/base64"
+    "fmt"
+    "regexp"
+    "strings"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ExternalRef cross-links an update with an item in a cloud common data environment (CDE).
+// The chaincode only checks the format; the mapping suite's forge package resolves the
+// reference against Autodesk Platform Services before submitting.
+type ExternalRef struct {
+    System  string `json:"System" validate:"required,oneof=forge|bim360"`
+    ID      string `json:"ID" validate:"required,max=512"`
+    Project string `json:"Project,omitempty" validate:"max=128,id"` // BIM 360 / ACC project ID ("b.<guid>"), required for bim360
+    Version string `json:"Version,omitempty" validate:"max=64"`     // CDE item version the ledger record refers to
+}
+
+// Supported ExternalRef.System values
+const (
+    ExternalRefForge  = "forge"  // Model Derivative URN: base64url of an adsk object or version URN
+    ExternalRefBIM360 = "bim360" // Data Management item lineage ID
+)
+
+// maxExternalRefs limits the CDE references per update
+const maxExternalRefs = 8
+
+var (
+    bim360ItemPattern    = regexp.MustCompile(`^urn:adsk\.wip[a-z]+:dm\.lineage:[A-Za-z0-9_-]+$`)
+    bim360ProjectPattern = regexp.MustCompile(`^b\.[0-9a-fA-F-]{36}$`)
+)
+
+// checkExternalRefs validates the system-specific format of input.ExternalRefs
+func checkExternalRefs(input *BIMUpdate) error {
+    if len(input.ExternalRefs) > maxExternalRefs {
+        return fmt.Errorf("too many external references: %d (max %d)", len(input.ExternalRefs), maxExternalRefs)
+    }
+    seen := map[string]bool{}
+    for i, ref := range input.ExternalRefs {
+        switch ref.System {
+        case ExternalRefForge:
+            urn, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(ref.ID, "="))
+            if err != nil || !strings.HasPrefix(string(urn), "urn:adsk.") {
+                return fmt.Errorf("ExternalRefs[%d]: ID must be a base64url encoded Autodesk URN", i)
+            }
+        case ExternalRefBIM360:
+            if !bim360ItemPattern.MatchString(ref.ID) {
+                return fmt.Errorf("ExternalRefs[%d]: ID must be an item lineage URN (urn:adsk.wipprod:dm.lineage:...)", i)
+            }
+            if !bim360ProjectPattern.MatchString(ref.Project) {
+                return fmt.Errorf("ExternalRefs[%d]: Project must be a BIM 360 project ID (b.<guid>)", i)
+            }
+        }
+        key := ref.System + "|" + ref.ID
+        if seen[key] {
+            return fmt.Errorf("ExternalRefs[%d]: %s %s listed twice", i, ref.System, ref.ID)
+        }
+        seen[key] = true
+    }
+    return nil
+}
+
+// QueryUpdatesByExternalRef lists the updates referencing a CDE item, e.g. to show the
+// ledger history of a BIM 360 document
+func (qc *QueryContract) QueryUpdatesByExternalRef(ctx contractapi.TransactionContextInterface, system string, id string) ([]*BIMHistoryRecord, error) {
+    if system == "" || id == "" {
+        return nil, fmt.Errorf("system and id required")
+    }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(externalRefObjectType, []string{system, id})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query external reference index: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMHistoryRecord{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, externalRefObjectType)
+        if err != nil {
+            continue
+        }
+        rec, err := visibleRecord(ctx, scope, attrs[2])
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            result = append(result, rec)
+        }
+    }
+    return result, nil
+}
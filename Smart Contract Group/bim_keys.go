@@ -0,0 +1,181 @@
+package chaincode
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// World state key layout.
+//
+// Every record and index entry is stored under a composite key of one of the object
+// types below, built with makeKey and read back with parseKey; keyFormats names the
+// attributes of each type in order. Records of one type can be listed with a partial
+// composite key query on the type, so no query has to tell records apart by the shape
+// of their JSON.
+//
+// BIMUpdate records written before updates moved to ("BIMUpdate", updateID) are still
+// stored under their plain UpdateID. updateStore reads them from there and moves them
+// to the composite key the next time they are written; plain keys hold nothing else.
+
+// Object types of stored records
+const (
+    updateObjectType             = "BIMUpdate"             // ("BIMUpdate", updateID)
+    approvalObjectType           = "BIMApproval"           // ("BIMApproval", updateID) final decision
+    approvalVoteObjectType       = "BIMApprovalVote"       // ("BIMApprovalVote", updateID, voterKey)
+    approvalPolicyObjectType     = "BIMApprovalPolicy"     // ("BIMApprovalPolicy", modelID)
+    reviewerAssignmentObjectType = "BIMReviewerAssignment" // ("BIMReviewerAssignment", updateID)
+    reviewerIdentityObjectType   = "BIMReviewerIdentity"   // ("BIMReviewerIdentity", updateID, pseudonym)
+    commentObjectType            = "BIMComment"            // ("BIMComment", updateID, commentID)
+    appealObjectType             = "BIMAppeal"             // ("BIMAppeal", updateID, appealID)
+    blockerObjectType            = "BIMBlocker"            // ("BIMBlocker", updateID, blockerID)
+    updateTagsObjectType         = "BIMUpdateTags"         // ("BIMUpdateTags", updateID)
+    validationResultObjectType   = "BIMValidationResult"   // ("BIMValidationResult", updateID)
+    modelObjectType              = "BIMModel"              // ("BIMModel", modelID)
+    baselineObjectType           = "BIMBaseline"           // ("BIMBaseline", modelID, label)
+    rollbackObjectType           = "BIMRollback"           // ("BIMRollback", modelID, rollbackID)
+    componentPackageObjectType   = "BIMComponentPackage"   // ("BIMComponentPackage", modelID, packageID)
+    bcfIssueObjectType           = "BCFIssue"              // ("BCFIssue", modelID, version, topicGUID)
+    accessLogObjectType          = "BIMAccessLog"          // ("BIMAccessLog", modelID, accessID)
+    storageStatsObjectType       = "BIMStorageStats"       // ("BIMStorageStats", modelID)
+    deviationObjectType          = "BIMDeviation"          // ("BIMDeviation", deviationID)
+    networkConfigObjectType      = "BIMNetworkConfig"      // single record, no attributes
+    crlObjectType                = "BIMCertRevocationList" // ("BIMCertRevocationList", mspID, issuerDN)
+    payloadNonceObjectType       = "PayloadNonce"          // ("PayloadNonce", initiator, nonce) -> updateID
+    clientRequestObjectType      = "ClientRequestIndex"    // ("ClientRequestIndex", initiator, clientRequestID) -> updateID
+    modelWatchObjectType         = "BIMModelWatch"         // ("BIMModelWatch", modelID, watcher)
+    roleGrantObjectType          = "BIMRoleGrant"          // ("BIMRoleGrant", identity)
+    responsibilityObjectType     = "BIMResponsibility"     // ("BIMResponsibility", modelID)
+    modelLockObjectType          = "BIMModelLock"          // ("BIMModelLock", modelID)
+)
+
+// Object types of index entries; the value is a marker byte and the last attribute the indexed record's ID
+const (
+    statusIndexObjectType            = "StatusIndex"             // ("StatusIndex", status, updateID)
+    initiatorIndexObjectType         = "InitiatorIndex"          // ("InitiatorIndex", initiator, updateID)
+    modelIndexObjectType             = "ModelIndex"              // ("ModelIndex", modelID, updateID)
+    timeIndexObjectType              = "TimeIndex"               // ("TimeIndex", "YYYY-MM", RFC3339 timestamp, updateID)
+    resubmissionObjectType           = "ResubmissionIndex"       // ("ResubmissionIndex", previousUpdateID, updateID)
+    contentHashObjectType            = "ContentHashIndex"        // ("ContentHashIndex", lower-case attachment / file SHA256, updateID)
+    externalRefObjectType            = "ExternalRefIndex"        // ("ExternalRefIndex", system, ID, updateID)
+    openUpdateObjectType             = "OpenUpdateIndex"         // ("OpenUpdateIndex", modelID, updateID) for INITIALIZED, QUEUED and PENDING_VALIDATION updates
+    pendingAfterObjectType           = "PendingAfterIndex"       // ("PendingAfterIndex", pendingAfterID, updateID)
+    reviewerIndexObjectType          = "ReviewerAssignmentIndex" // ("ReviewerAssignmentIndex", reviewerID, updateID)
+    tagIndexObjectType               = "TagIndex"                // ("TagIndex", folded tag, updateID)
+    accessReaderIndexType            = "AccessReaderIndex"       // ("AccessReaderIndex", reader, modelID, accessID)
+    deviationElementIndexObjectType  = "DeviationElementIndex"   // ("DeviationElementIndex", elementID, deviationID)
+    deviationSeverityIndexObjectType = "DeviationSeverityIndex"  // ("DeviationSeverityIndex", severity, deviationID)
+    watcherIndexObjectType           = "WatcherIndex"            // ("WatcherIndex", watcher, modelID)
+)
+
+// keyFormats names the attributes of the keys of each object type
+var keyFormats = map[string][]string{
+    updateObjectType:             {"updateID"},
+    approvalObjectType:           {"updateID"},
+    approvalVoteObjectType:       {"updateID", "voterKey"},
+    approvalPolicyObjectType:     {"modelID"},
+    reviewerAssignmentObjectType: {"updateID"},
+    reviewerIdentityObjectType:   {"updateID", "pseudonym"},
+    commentObjectType:            {"updateID", "commentID"},
+    appealObjectType:             {"updateID", "appealID"},
+    blockerObjectType:            {"updateID", "blockerID"},
+    updateTagsObjectType:         {"updateID"},
+    validationResultObjectType:   {"updateID"},
+    modelObjectType:              {"modelID"},
+    baselineObjectType:           {"modelID", "label"},
+    rollbackObjectType:           {"modelID", "rollbackID"},
+    componentPackageObjectType:   {"modelID", "packageID"},
+    bcfIssueObjectType:           {"modelID", "version", "topicGUID"},
+    accessLogObjectType:          {"modelID", "accessID"},
+    storageStatsObjectType:       {"modelID"},
+    deviationObjectType:          {"deviationID"},
+    networkConfigObjectType:      {},
+    crlObjectType:                {"mspID", "issuerDN"},
+    payloadNonceObjectType:       {"initiator", "nonce"},
+    clientRequestObjectType:      {"initiator", "clientRequestID"},
+    modelWatchObjectType:         {"modelID", "watcher"},
+    roleGrantObjectType:          {"identity"},
+    responsibilityObjectType:     {"modelID"},
+    modelLockObjectType:          {"modelID"},
+
+    statusIndexObjectType:            {"status", "updateID"},
+    initiatorIndexObjectType:         {"initiator", "updateID"},
+    modelIndexObjectType:             {"modelID", "updateID"},
+    timeIndexObjectType:              {"month", "timestamp", "updateID"},
+    resubmissionObjectType:           {"previousUpdateID", "updateID"},
+    contentHashObjectType:            {"sha256", "updateID"},
+    externalRefObjectType:            {"system", "ID", "updateID"},
+    openUpdateObjectType:             {"modelID", "updateID"},
+    pendingAfterObjectType:           {"pendingAfterID", "updateID"},
+    reviewerIndexObjectType:          {"reviewerID", "updateID"},
+    tagIndexObjectType:               {"tag", "updateID"},
+    accessReaderIndexType:            {"reader", "modelID", "accessID"},
+    deviationElementIndexObjectType:  {"elementID", "deviationID"},
+    deviationSeverityIndexObjectType: {"severity", "deviationID"},
+    watcherIndexObjectType:           {"watcher", "modelID"},
+}
+
+// makeKey builds the composite key of a record or index entry of objectType.
+// The attributes must match the type's format in keyFormats.
+func makeKey(ctx contractapi.TransactionContextInterface, objectType string, attrs ...string) (string, error) {
+    format, ok := keyFormats[objectType]
+    if !ok {
+        return "", fmt.Errorf("unknown object type %q", objectType)
+    }
+    if len(attrs) != len(format) {
+        return "", fmt.Errorf("%s key takes %d attributes (%s), got %d", objectType, len(format), strings.Join(format, ", "), len(attrs))
+    }
+    return ctx.GetStub().CreateCompositeKey(objectType, attrs)
+}
+
+// parseKey returns the attributes of a key of objectType. Plain keys, keys of another
+// object type and keys with the wrong number of attributes are errors.
+func parseKey(ctx contractapi.TransactionContextInterface, key string, objectType string) ([]string, error) {
+    if !isCompositeKey(key) {
+        return nil, fmt.Errorf("key %q is not a composite key", key)
+    }
+    keyType, attrs, err := ctx.GetStub().SplitCompositeKey(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to split key: %v", err)
+    }
+    if keyType != objectType {
+        return nil, fmt.Errorf("key of type %s, expected %s", keyType, objectType)
+    }
+    if format, ok := keyFormats[objectType]; ok && len(attrs) != len(format) {
+        return nil, fmt.Errorf("%s key has %d attributes, expected %d", objectType, len(attrs), len(format))
+    }
+    return attrs, nil
+}
+
+// isCompositeKey reports whether key was built with CreateCompositeKey.
+// SplitCompositeKey must not be called on simple keys.
+func isCompositeKey(key string) bool {
+    return strings.HasPrefix(key, "\x00")
+}
+
+// updateIDFromKey returns the UpdateID of a key holding a BIMUpdate record, either its
+// composite key or a legacy plain key; ok is false for keys of other records
+func updateIDFromKey(ctx contractapi.TransactionContextInterface, key string) (updateID string, ok bool) {
+    if !isCompositeKey(key) {
+        return key, true
+    }
+    attrs, err := parseKey(ctx, key, updateObjectType)
+    if err != nil {
+        return "", false
+    }
+    return attrs[0], true
+}
+
+// updateKey returns the key a BIMUpdate is stored under
+func updateKey(ctx contractapi.TransactionContextInterface, updateID string) (string, error) {
+    if updateID == "" {
+        return "", fmt.Errorf("updateID required")
+    }
+    return makeKey(ctx, updateObjectType, updateID)
+}
+
+// approvalKey returns the key of the final decision record of an update
+func approvalKey(ctx contractapi.TransactionContextInterface, updateID string) (string, error) {
+    return makeKey(ctx, approvalObjectType, updateID)
+}
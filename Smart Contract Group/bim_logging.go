@@ -0,0 +1,53 @@
+package chaincode
+
+import (
+    "log/slog"
+    "os"
+    "strings"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// logger writes structured logs to stderr, where the peer collects chaincode output.
+//
+// The level follows CORE_CHAINCODE_LOGGING_LEVEL (DEBUG, INFO, WARNING, ERROR; default INFO)
+// and BIM_LOG_FORMAT selects "json" (default) or "text" output.
+var logger = newLogger(os.Getenv("CORE_CHAINCODE_LOGGING_LEVEL"), os.Getenv("BIM_LOG_FORMAT"))
+
+func newLogger(level string, format string) *slog.Logger {
+    opts := &slog.HandlerOptions{Level: parseLogLevel(level)}
+    if strings.EqualFold(format, "text") {
+        return slog.New(slog.NewTextHandler(os.Stderr, opts))
+    }
+    return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+}
+
+func parseLogLevel(level string) slog.Level {
+    switch strings.ToUpper(level) {
+    case "DEBUG":
+        return slog.LevelDebug
+    case "WARN", "WARNING":
+        return slog.LevelWarn
+    case "ERROR", "CRITICAL", "PANIC", "FATAL":
+        return slog.LevelError
+    }
+    return slog.LevelInfo
+}
+
+// txLogger returns a logger carrying the transaction correlation fields:
+// txID and channel match the peer's own log lines, function is "Contract:Function".
+func txLogger(ctx contractapi.TransactionContextInterface) *slog.Logger {
+    stub := ctx.GetStub()
+    fn, _ := stub.GetFunctionAndParameters()
+    return logger.With("txID", stub.GetTxID(), "channel", stub.GetChannelID(), "function", fn)
+}
+
+// logOutcome records how a transaction finished. It is deferred with the named
+// error result so every return path is logged with the same context.
+func logOutcome(log *slog.Logger, err error) {
+    if err != nil {
+        log.Error("transaction failed", "err", err)
+        return
+    }
+    log.Info("transaction succeeded")
+}
@@ -0,0 +1,224 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Migrate brings the world state written by earlier chaincode versions up to date after
+// an upgrade. It walks the state in phases: first the BIMUpdate records still under
+// their legacy plain keys are moved to ("BIMUpdate", updateID), then each record type of
+// migrationTypes in turn has its records stored below the current schema version
+// rewritten. BIMUpdate records also get their status, model, initiator and open update
+// index entries written again.
+//
+// Records are upgraded on read anyway (see bim_schema.go); Migrate makes the stored bytes
+// and the indexes match without waiting for the next write of every record.
+
+// MigrationReport counts what one Migrate batch changed
+type MigrationReport struct {
+    Scanned   int            `json:"Scanned"`
+    Moved     int            `json:"Moved"`     // updates moved off their legacy plain key
+    Upgraded  map[string]int `json:"Upgraded"`  // records rewritten at the current schema version, per object type
+    Reindexed int            `json:"Reindexed"` // updates whose index entries were written
+
+    // pass both to the next call; Done is set once every phase is complete
+    NextObjectType string `json:"NextObjectType"`
+    NextKey        string `json:"NextKey"`
+    Done           bool   `json:"Done"`
+}
+
+// migrationType ties an object type to the schema kind and Go type of its records
+type migrationType struct {
+    objectType string
+    kind       string
+    record     func() interface{}
+}
+
+// migrationTypes are the record types Migrate upgrades, in phase order
+var migrationTypes = []migrationType{
+    {updateObjectType, schemaBIMUpdate, func() interface{} { return &BIMUpdate{} }},
+    {approvalObjectType, schemaBIMApproval, func() interface{} { return &BIMApproval{} }},
+    {approvalVoteObjectType, schemaBIMApproval, func() interface{} { return &BIMApproval{} }},
+    {approvalPolicyObjectType, schemaApprovalPolicy, func() interface{} { return &ApprovalPolicy{} }},
+    {reviewerAssignmentObjectType, schemaReviewerAssignment, func() interface{} { return &ReviewerAssignment{} }},
+    {reviewerIdentityObjectType, schemaReviewerIdentity, func() interface{} { return &ReviewerIdentity{} }},
+    {commentObjectType, schemaBIMComment, func() interface{} { return &BIMComment{} }},
+    {appealObjectType, schemaBIMAppeal, func() interface{} { return &BIMAppeal{} }},
+    {blockerObjectType, schemaBIMBlocker, func() interface{} { return &BIMBlocker{} }},
+    {updateTagsObjectType, schemaUpdateTags, func() interface{} { return &UpdateTags{} }},
+    {validationResultObjectType, schemaValidationResult, func() interface{} { return &ValidationResult{} }},
+    {modelObjectType, schemaBIMModel, func() interface{} { return &BIMModel{} }},
+    {baselineObjectType, schemaBIMBaseline, func() interface{} { return &BIMBaseline{} }},
+    {rollbackObjectType, schemaBIMRollback, func() interface{} { return &BIMRollback{} }},
+    {componentPackageObjectType, schemaComponentPackage, func() interface{} { return &ComponentPackage{} }},
+    {bcfIssueObjectType, schemaBCFIssue, func() interface{} { return &BCFIssue{} }},
+    {accessLogObjectType, schemaBIMAccessLog, func() interface{} { return &BIMAccessLog{} }},
+    {storageStatsObjectType, schemaStorageStats, func() interface{} { return &StorageStats{} }},
+    {deviationObjectType, schemaBIMDeviation, func() interface{} { return &BIMDeviation{} }},
+    {networkConfigObjectType, schemaNetworkConfig, func() interface{} { return &NetworkConfig{} }},
+    {crlObjectType, schemaCertRevocationList, func() interface{} { return &CertRevocationList{} }},
+    {modelWatchObjectType, schemaModelWatch, func() interface{} { return &ModelWatch{} }},
+    {roleGrantObjectType, schemaRoleGrant, func() interface{} { return &RoleGrant{} }},
+    {responsibilityObjectType, schemaResponsibility, func() interface{} { return &ResponsibilityMatrix{} }},
+    {modelLockObjectType, schemaModelLock, func() interface{} { return &ModelLock{} }},
+}
+
+// Migrate runs one batch of the post-upgrade migration, scanning at most limit keys.
+// Start with an empty objectType and startKey and repeat with the returned NextObjectType
+// and NextKey until Done; migrating a record twice is harmless.
+// - Caller must have role=admin
+func (s *SmartContract) Migrate(ctx contractapi.TransactionContextInterface, objectType string, startKey string, limit int) (report *MigrationReport, err error) {
+    log := txLogger(ctx).With("objectType", objectType, "startKey", startKey)
+    defer func() { logOutcome(log, err) }()
+
+    if err := authorizeCallerRole(ctx, RoleAdmin); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    if limit <= 0 || limit > maxBackfillBatch {
+        return nil, fmt.Errorf("limit must be between 1 and %d", maxBackfillBatch)
+    }
+    phase := -1
+    if objectType != "" {
+        for i, t := range migrationTypes {
+            if t.objectType == objectType {
+                phase = i
+            }
+        }
+        if phase < 0 {
+            return nil, fmt.Errorf("object type %q is not migrated", objectType)
+        }
+    }
+
+    report = &MigrationReport{Upgraded: map[string]int{}}
+    for ; phase < len(migrationTypes); phase++ {
+        var next string
+        if phase < 0 {
+            next, err = migrateLegacyUpdates(ctx, report, startKey, limit)
+        } else {
+            next, err = migrateRecords(ctx, report, migrationTypes[phase], startKey, limit)
+        }
+        if err != nil {
+            return nil, err
+        }
+        if next != "" {
+            if phase >= 0 {
+                report.NextObjectType = migrationTypes[phase].objectType
+            }
+            report.NextKey = next
+            break
+        }
+        startKey = ""
+    }
+    report.Done = phase == len(migrationTypes)
+    log.Info("migration batch", "scanned", report.Scanned, "moved", report.Moved, "reindexed", report.Reindexed, "done", report.Done)
+    return report, nil
+}
+
+// migrateLegacyUpdates moves the updates under plain keys from startKey onward to their
+// composite key. It returns the key to resume at once report.Scanned reaches limit.
+func migrateLegacyUpdates(ctx contractapi.TransactionContextInterface, report *MigrationReport, startKey string, limit int) (string, error) {
+    // paginated range queries are not allowed in update transactions, so stop after limit keys
+    iterator, err := ctx.GetStub().GetStateByRange(startKey, "")
+    if err != nil {
+        return "", fmt.Errorf("failed to scan world state: %v", err)
+    }
+    defer iterator.Close()
+
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return "", err
+        }
+        if isCompositeKey(kv.Key) {
+            continue
+        }
+        if report.Scanned == limit {
+            return kv.Key, nil
+        }
+        report.Scanned++
+
+        var update BIMUpdate
+        if err := decodeRecord(schemaBIMUpdate, kv.Value, &update); err != nil || update.UpdateID != kv.Key {
+            continue
+        }
+        if _, err := (updateStore{}).put(ctx, &update); err != nil {
+            return "", err
+        }
+        report.Moved++
+    }
+    return "", nil
+}
+
+// migrateRecords rewrites the records of t from startKey onward that are stored below the
+// current schema version, and reindexes updates. It returns the key to resume at once
+// report.Scanned reaches limit.
+func migrateRecords(ctx contractapi.TransactionContextInterface, report *MigrationReport, t migrationType, startKey string, limit int) (string, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(t.objectType, []string{})
+    if err != nil {
+        return "", fmt.Errorf("failed to query %s records: %v", t.objectType, err)
+    }
+    defer iterator.Close()
+
+    current := schemaVersion(t.kind)
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return "", err
+        }
+        if kv.Key < startKey {
+            continue
+        }
+        if report.Scanned == limit {
+            return kv.Key, nil
+        }
+        report.Scanned++
+
+        var header struct {
+            SchemaVersion int `json:"SchemaVersion"`
+        }
+        if err := json.Unmarshal(kv.Value, &header); err != nil {
+            return "", fmt.Errorf("failed to parse %s record: %v", t.objectType, err)
+        }
+        record := t.record()
+        if err := decodeRecord(t.kind, kv.Value, record); err != nil {
+            return "", fmt.Errorf("failed to parse %s record: %v", t.objectType, err)
+        }
+        if header.SchemaVersion < current {
+            data, err := marshalState(record)
+            if err != nil {
+                return "", fmt.Errorf("failed to marshal %s: %v", t.objectType, err)
+            }
+            if err := ctx.GetStub().PutState(kv.Key, data); err != nil {
+                return "", fmt.Errorf("failed to save %s: %v", t.objectType, err)
+            }
+            report.Upgraded[t.objectType]++
+        }
+        if update, ok := record.(*BIMUpdate); ok {
+            if err := reindexUpdate(ctx, update); err != nil {
+                return "", err
+            }
+            report.Reindexed++
+        }
+    }
+    return "", nil
+}
+
+// reindexUpdate writes the status, model, initiator and open update index entries of an update
+func reindexUpdate(ctx contractapi.TransactionContextInterface, update *BIMUpdate) error {
+    if err := putIndexEntry(ctx, statusIndexObjectType, update.Status, update.UpdateID); err != nil {
+        return err
+    }
+    if err := putIndexEntry(ctx, modelIndexObjectType, update.ModelID, update.UpdateID); err != nil {
+        return err
+    }
+    if err := putIndexEntry(ctx, initiatorIndexObjectType, update.Initiator, update.UpdateID); err != nil {
+        return err
+    }
+    if isOpenStatus(update.Status) {
+        return putIndexEntry(ctx, openUpdateObjectType, update.ModelID, update.UpdateID)
+    }
+    return nil
+}
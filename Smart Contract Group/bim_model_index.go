@@ -0,0 +1,66 @@
+package chaincode
+
+import (
+    "fmt"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ModelIndexBackfill reports one batch of BackfillModelIndex
+type ModelIndexBackfill struct {
+    Scanned int    `json:"Scanned"`
+    Indexed int    `json:"Indexed"`
+    NextKey string `json:"NextKey"` // pass as startKey to continue; empty when the scan is complete
+}
+
+// maxBackfillBatch bounds the keys one BackfillModelIndex transaction may scan
+const maxBackfillBatch = 500
+
+// BackfillModelIndex adds model index entries, and open update index entries for updates
+// still under review, for updates created before those indexes existed.
+// Updates are scanned in key order from startKey, at most limit keys per transaction;
+// repeat with the returned NextKey until it is empty. Re-indexing an update is harmless.
+// - Caller must have role=admin
+func (s *SmartContract) BackfillModelIndex(ctx contractapi.TransactionContextInterface, startKey string, limit int) (*ModelIndexBackfill, error) {
+    if err := authorizeCallerRole(ctx, RoleAdmin); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    if limit <= 0 || limit > maxBackfillBatch {
+        return nil, fmt.Errorf("limit must be between 1 and %d", maxBackfillBatch)
+    }
+
+    // paginated range queries are not allowed in update transactions, so stop after limit keys
+    iterator, err := ctx.GetStub().GetStateByRange(startKey, "")
+    if err != nil {
+        return nil, fmt.Errorf("failed to scan world state: %v", err)
+    }
+    defer iterator.Close()
+
+    result := &ModelIndexBackfill{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        if result.Scanned == limit {
+            result.NextKey = kv.Key
+            break
+        }
+        result.Scanned++
+
+        var update BIMUpdate
+        if err := decodeRecord(schemaBIMUpdate, kv.Value, &update); err != nil || update.UpdateID != kv.Key || update.ModelID == "" {
+            continue
+        }
+        if err := putIndexEntry(ctx, modelIndexObjectType, update.ModelID, update.UpdateID); err != nil {
+            return nil, err
+        }
+        if isOpenStatus(update.Status) {
+            if err := putIndexEntry(ctx, openUpdateObjectType, update.ModelID, update.UpdateID); err != nil {
+                return nil, err
+            }
+        }
+        result.Indexed++
+    }
+    return result, nil
+}
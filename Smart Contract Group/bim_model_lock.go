@@ -0,0 +1,173 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Model locks. Before a milestone a BIM lead freezes the design of a model: while the
+// lock holds, InitBIMUpdate and ResubmitBIMUpdate refuse new updates of the model with
+// an INVALID_STATE error. Updates already submitted can still be reviewed, approved and
+// published. A lock ends with UnlockModel or when its Until time passes; expiry is
+// judged by the transaction timestamp so every endorser decides alike.
+
+// ModelLock freezes a model
+type ModelLock struct {
+    ModelID  string `json:"ModelID"`
+    Reason   string `json:"Reason"`
+    Until    string `json:"Until,omitempty"` // RFC3339; empty until UnlockModel
+    LockedBy string `json:"LockedBy"`
+    LockedAt string `json:"LockedAt"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventModelLocked   = "BIMModelLocked"
+    EventModelUnlocked = "BIMModelUnlocked"
+
+    maxLockReasonLength = 500
+)
+
+// LockModel freezes a model, replacing any lock it already has
+// - Caller must have role=bim_lead
+// - until is an RFC3339 time after the transaction timestamp, or empty to lock until UnlockModel
+func (mc *ModelRegistryContract) LockModel(ctx contractapi.TransactionContextInterface, modelID string, reason string, until string) (*ModelLock, error) {
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    if reason == "" {
+        return nil, fmt.Errorf("reason required")
+    }
+    if len(reason) > maxLockReasonLength {
+        return nil, fmt.Errorf("reason too long: %d characters (max %d)", len(reason), maxLockReasonLength)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if until != "" {
+        end, err := time.Parse(time.RFC3339, until)
+        if err != nil {
+            return nil, fmt.Errorf("invalid until %q: must be RFC3339", until)
+        }
+        if !end.After(txTime) {
+            return nil, fmt.Errorf("until %s must lie after the transaction timestamp %s", until, txTime.Format(time.RFC3339))
+        }
+        until = end.UTC().Format(time.RFC3339)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    lock := ModelLock{
+        ModelID:       modelID,
+        Reason:        reason,
+        Until:         until,
+        LockedBy:      callerID,
+        LockedAt:      txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaModelLock),
+    }
+    if err := putSubRecord(ctx, modelLockObjectType, []string{modelID}, &lock, EventModelLocked); err != nil {
+        return nil, err
+    }
+    return &lock, nil
+}
+
+// UnlockModel lifts the lock of a model, including an expired one
+// - Caller must have role=bim_lead
+func (mc *ModelRegistryContract) UnlockModel(ctx contractapi.TransactionContextInterface, modelID string) error {
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if modelID == "" {
+        return fmt.Errorf("modelID required")
+    }
+    lock, err := readModelLock(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    if lock == nil {
+        return errNotFound("model %s is not locked", modelID)
+    }
+    key, err := makeKey(ctx, modelLockObjectType, modelID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    if err := ctx.GetStub().DelState(key); err != nil {
+        return fmt.Errorf("failed to delete model lock: %v", err)
+    }
+    data, err := marshalState(lock)
+    if err != nil {
+        return fmt.Errorf("failed to marshal model lock: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventModelUnlocked, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// QueryModelLock returns the lock holding a model, or nil if it has none or it expired
+func (mc *ModelRegistryContract) QueryModelLock(ctx contractapi.TransactionContextInterface, modelID string) (*ModelLock, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    return activeModelLock(ctx, modelID)
+}
+
+// checkModelLock refuses new updates of a locked model
+func checkModelLock(ctx contractapi.TransactionContextInterface, modelID string) error {
+    lock, err := activeModelLock(ctx, modelID)
+    if err != nil || lock == nil {
+        return err
+    }
+    if lock.Until == "" {
+        return errInvalidState("model %s is locked until unlocked: %s", modelID, lock.Reason)
+    }
+    return errInvalidState("model %s is locked until %s: %s", modelID, lock.Until, lock.Reason)
+}
+
+// activeModelLock returns the lock of a model unless it expired by the transaction timestamp
+func activeModelLock(ctx contractapi.TransactionContextInterface, modelID string) (*ModelLock, error) {
+    lock, err := readModelLock(ctx, modelID)
+    if err != nil || lock == nil || lock.Until == "" {
+        return lock, err
+    }
+    until, err := time.Parse(time.RFC3339, lock.Until)
+    if err != nil {
+        return nil, fmt.Errorf("invalid until of model lock %s: %v", modelID, err)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if !txTime.Before(until) {
+        return nil, nil
+    }
+    return lock, nil
+}
+
+func readModelLock(ctx contractapi.TransactionContextInterface, modelID string) (*ModelLock, error) {
+    key, err := makeKey(ctx, modelLockObjectType, modelID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read model lock: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var lock ModelLock
+    if err := decodeRecord(schemaModelLock, data, &lock); err != nil {
+        return nil, fmt.Errorf("failed to parse model lock: %v", err)
+    }
+    return &lock, nil
+}
@@ -0,0 +1,277 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ModelRegistryContract keeps the registry of BIM models and who is responsible for them
+type ModelRegistryContract struct {
+    contractapi.Contract
+}
+
+// BIMModel is a registered model and its current owner (lead responsibility)
+type BIMModel struct {
+    ModelID   string `json:"ModelID"`
+    Name      string `json:"Name"`
+    Owner     string `json:"Owner"`
+    OwnerMSP  string `json:"OwnerMSP"`
+    CreatedAt string `json:"CreatedAt"`
+
+    // pending two-step transfer, cleared on accept or cancel
+    PendingOwner       string `json:"PendingOwner,omitempty"`
+    PendingOwnerMSP    string `json:"PendingOwnerMSP,omitempty"`
+    TransferProposedAt string `json:"TransferProposedAt,omitempty"`
+
+    OwnershipHistory []OwnershipTransfer `json:"OwnershipHistory"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// OwnershipTransfer records a completed handover of a model
+type OwnershipTransfer struct {
+    FromOwner string `json:"FromOwner"`
+    FromMSP   string `json:"FromMSP"`
+    ToOwner   string `json:"ToOwner"`
+    ToMSP     string `json:"ToMSP"`
+    TxID      string `json:"TxID"`
+    Timestamp string `json:"Timestamp"`
+}
+
+const (
+    EventModelRegistered        = "BIMModelRegistered"
+    EventModelTransferProposed  = "BIMModelTransferProposed"
+    EventModelTransferCancelled = "BIMModelTransferCancelled"
+    EventModelTransferred       = "BIMModelTransferred"
+)
+
+// RegisterModel registers a model with the caller as owner
+// - Caller must have role=bim_lead
+func (mc *ModelRegistryContract) RegisterModel(ctx contractapi.TransactionContextInterface, modelID string, name string) error {
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if modelID == "" {
+        return fmt.Errorf("modelID required")
+    }
+    existing, err := readModel(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    if existing != nil {
+        return errDuplicate("model %s already registered", modelID)
+    }
+
+    ownerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    ownerMSP, err := getSubmittingClientMSPID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    model := BIMModel{
+        ModelID:          modelID,
+        Name:             name,
+        Owner:            ownerID,
+        OwnerMSP:         ownerMSP,
+        CreatedAt:        txTime.Format(time.RFC3339),
+        OwnershipHistory: []OwnershipTransfer{},
+        SchemaVersion:    schemaVersion(schemaBIMModel),
+    }
+    return putModel(ctx, &model, EventModelRegistered)
+}
+
+// TransferModelOwnership proposes handing a model over to another identity / org.
+// The transfer only takes effect once the new owner calls AcceptModelOwnership.
+// - Caller must have role=bim_lead and be the current owner
+func (mc *ModelRegistryContract) TransferModelOwnership(ctx contractapi.TransactionContextInterface,
+    modelID string, newOwnerID string, newOwnerMSP string) error {
+
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    if newOwnerID == "" || newOwnerMSP == "" {
+        return fmt.Errorf("newOwnerID and newOwnerMSP required")
+    }
+    model, err := requireModelOwner(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    if model.Owner == newOwnerID && model.OwnerMSP == newOwnerMSP {
+        return fmt.Errorf("%s already owns model %s", newOwnerID, modelID)
+    }
+
+    model.PendingOwner = newOwnerID
+    model.PendingOwnerMSP = newOwnerMSP
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    model.TransferProposedAt = txTime.Format(time.RFC3339)
+    return putModel(ctx, model, EventModelTransferProposed)
+}
+
+// CancelModelOwnershipTransfer withdraws a pending transfer
+// - Caller must be the current owner
+func (mc *ModelRegistryContract) CancelModelOwnershipTransfer(ctx contractapi.TransactionContextInterface, modelID string) error {
+    model, err := requireModelOwner(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    if model.PendingOwner == "" {
+        return fmt.Errorf("no pending transfer for model %s", modelID)
+    }
+    clearPendingTransfer(model)
+    return putModel(ctx, model, EventModelTransferCancelled)
+}
+
+// AcceptModelOwnership completes a pending transfer
+// - Caller must be the proposed new owner, from the proposed MSP
+func (mc *ModelRegistryContract) AcceptModelOwnership(ctx contractapi.TransactionContextInterface, modelID string) error {
+    model, err := readModel(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    if model == nil {
+        return errNotFound("model %s not registered", modelID)
+    }
+    if model.PendingOwner == "" {
+        return fmt.Errorf("no pending transfer for model %s", modelID)
+    }
+
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    callerMSP, err := getSubmittingClientMSPID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    if callerID != model.PendingOwner || callerMSP != model.PendingOwnerMSP {
+        return fmt.Errorf("caller is not the proposed owner of model %s", modelID)
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    model.OwnershipHistory = append(model.OwnershipHistory, OwnershipTransfer{
+        FromOwner: model.Owner,
+        FromMSP:   model.OwnerMSP,
+        ToOwner:   callerID,
+        ToMSP:     callerMSP,
+        TxID:      ctx.GetStub().GetTxID(),
+        Timestamp: txTime.Format(time.RFC3339),
+    })
+    model.Owner = callerID
+    model.OwnerMSP = callerMSP
+    clearPendingTransfer(model)
+    return putModel(ctx, model, EventModelTransferred)
+}
+
+// QueryModel returns a registered model
+func (mc *ModelRegistryContract) QueryModel(ctx contractapi.TransactionContextInterface, modelID string) (*BIMModel, error) {
+    model, err := readModel(ctx, modelID)
+    if err != nil {
+        return nil, err
+    }
+    if model == nil {
+        return nil, errNotFound("model %s not registered", modelID)
+    }
+    return model, nil
+}
+
+// QueryUpdatesByContentHash returns the updates that anchored a file with the given
+// SHA-256 as an attachment, so clients can reuse an existing anchor instead of
+// submitting the same file twice
+func (mc *ModelRegistryContract) QueryUpdatesByContentHash(ctx contractapi.TransactionContextInterface, sha256Hex string) ([]*BIMUpdate, error) {
+    if !sha256Pattern.MatchString(sha256Hex) {
+        return nil, fmt.Errorf("sha256 must be a hex SHA-256 digest")
+    }
+    ids, err := updatesWithContent(ctx, sha256Hex)
+    if err != nil {
+        return nil, err
+    }
+    result := []*BIMUpdate{}
+    for _, id := range ids {
+        update, err := updates.GetUpdate(ctx, id)
+        if err != nil {
+            return nil, err
+        }
+        result = append(result, update)
+    }
+    return result, nil
+}
+
+// requireModelOwner loads a model and checks the caller is its current owner
+func requireModelOwner(ctx contractapi.TransactionContextInterface, modelID string) (*BIMModel, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    model, err := readModel(ctx, modelID)
+    if err != nil {
+        return nil, err
+    }
+    if model == nil {
+        return nil, errNotFound("model %s not registered", modelID)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if callerID != model.Owner {
+        return nil, errUnauthorized("caller is not the owner of model %s", modelID)
+    }
+    return model, nil
+}
+
+func clearPendingTransfer(model *BIMModel) {
+    model.PendingOwner = ""
+    model.PendingOwnerMSP = ""
+    model.TransferProposedAt = ""
+}
+
+func readModel(ctx contractapi.TransactionContextInterface, modelID string) (*BIMModel, error) {
+    key, err := makeKey(ctx, modelObjectType, modelID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read model: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var model BIMModel
+    if err := decodeRecord(schemaBIMModel, data, &model); err != nil {
+        return nil, fmt.Errorf("failed to parse model: %v", err)
+    }
+    return &model, nil
+}
+
+func putModel(ctx contractapi.TransactionContextInterface, model *BIMModel, event string) error {
+    key, err := makeKey(ctx, modelObjectType, model.ModelID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(model)
+    if err != nil {
+        return fmt.Errorf("failed to marshal model: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save model: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(event, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,110 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Replay protection for update payloads signed off-chain and submitted later by a
+// gateway. The client puts a Nonce and an ExpiresAt in the signed BIMUpdate JSON;
+// the chaincode refuses payloads past their expiry (by transaction timestamp, so
+// every endorser agrees) and remembers each (initiator, nonce) pair so a captured
+// payload cannot create a second update.
+//
+// Client clocks may differ from the submitter's by up to the network's ClockSkewSeconds.
+// A SignedAt later than that, or earlier than the payload lifetime allows, is refused so
+// a payload cannot be backdated or postdated in the audit trail.
+
+const (
+    // maxPayloadLifetime bounds ExpiresAt so nonces need not be kept meaningful forever
+    maxPayloadLifetime = 24 * time.Hour
+)
+
+// checkPayloadFreshness validates Nonce / ExpiresAt of a pre-signed payload from creatorID.
+// Payloads without a nonce are not pre-signed and pass unchanged.
+func checkPayloadFreshness(ctx contractapi.TransactionContextInterface, input *BIMUpdate, creatorID string) error {
+    if input.Nonce == "" {
+        if input.ExpiresAt != "" || input.SignedAt != "" {
+            return fmt.Errorf("ExpiresAt and SignedAt require a Nonce")
+        }
+        return nil
+    }
+    if input.ExpiresAt == "" {
+        return fmt.Errorf("ExpiresAt required with a Nonce")
+    }
+    expires, err := time.Parse(time.RFC3339, input.ExpiresAt)
+    if err != nil {
+        return fmt.Errorf("invalid ExpiresAt %q: must be RFC3339", input.ExpiresAt)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return err
+    }
+    skew := cfg.clockSkew()
+    if !txTime.Before(expires.Add(skew)) {
+        return fmt.Errorf("signed payload expired at %s", expires.UTC().Format(time.RFC3339))
+    }
+    if expires.Sub(txTime) > maxPayloadLifetime+skew {
+        return fmt.Errorf("ExpiresAt may be at most %s after submission", maxPayloadLifetime)
+    }
+    if input.SignedAt != "" {
+        signed, err := time.Parse(time.RFC3339, input.SignedAt)
+        if err != nil {
+            return fmt.Errorf("invalid SignedAt %q: must be RFC3339", input.SignedAt)
+        }
+        if signed.Sub(txTime) > skew {
+            return fmt.Errorf("SignedAt %s is later than the transaction timestamp %s beyond the allowed clock skew of %s",
+                input.SignedAt, txTime.Format(time.RFC3339), skew)
+        }
+        if txTime.Sub(signed) > maxPayloadLifetime+skew {
+            return fmt.Errorf("SignedAt %s is more than %s before the transaction timestamp %s", input.SignedAt, maxPayloadLifetime, txTime.Format(time.RFC3339))
+        }
+        if !signed.Before(expires) {
+            return fmt.Errorf("SignedAt must be before ExpiresAt")
+        }
+    }
+
+    key, err := makeKey(ctx, payloadNonceObjectType, creatorID, input.Nonce)
+    if err != nil {
+        return fmt.Errorf("failed to create %s key: %v", payloadNonceObjectType, err)
+    }
+    used, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return fmt.Errorf("failed to read %s entry: %v", payloadNonceObjectType, err)
+    }
+    if used != nil {
+        return errDuplicate("nonce %s was already used for update %s", input.Nonce, string(used))
+    }
+    return nil
+}
+
+// txTimestamp returns the transaction timestamp set by the submitting client, which
+// every endorser sees alike
+func txTimestamp(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+    ts, err := ctx.GetStub().GetTxTimestamp()
+    if err != nil {
+        return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+    }
+    return time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(), nil
+}
+
+// recordPayloadNonce marks the nonce of a stored update as used
+func recordPayloadNonce(ctx contractapi.TransactionContextInterface, update *BIMUpdate) error {
+    if update.Nonce == "" {
+        return nil
+    }
+    key, err := makeKey(ctx, payloadNonceObjectType, update.Initiator, update.Nonce)
+    if err != nil {
+        return fmt.Errorf("failed to create %s key: %v", payloadNonceObjectType, err)
+    }
+    if err := ctx.GetStub().PutState(key, []byte(update.UpdateID)); err != nil {
+        return fmt.Errorf("failed to write %s entry: %v", payloadNonceObjectType, err)
+    }
+    return nil
+}
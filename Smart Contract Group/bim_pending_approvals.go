@@ -0,0 +1,140 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PendingApproval is an INITIALIZED update waiting for the caller's vote
+type PendingApproval struct {
+    Update   *BIMUpdate `json:"Update"`
+    Deadline string     `json:"Deadline"` // Timestamp plus the network's ReviewDeadlineHours
+    Overdue  bool       `json:"Overdue"`  // the deadline passed before this transaction
+    Assigned bool       `json:"Assigned"` // the caller is an assigned reviewer of the update
+
+    // DepartmentNeeded is set when the policy requires the caller's department and no
+    // approving vote from it exists yet
+    DepartmentNeeded bool `json:"DepartmentNeeded"`
+}
+
+// QueryPendingApprovalsForCaller returns the INITIALIZED updates the caller may still vote
+// on, earliest deadline first
+// - Updates with assigned reviewers are only listed for those reviewers
+// - Otherwise the caller's role must be allowed by the model's approval policy
+// - Updates the caller already voted on are left out
+func (c *ApprovalContract) QueryPendingApprovalsForCaller(ctx contractapi.TransactionContextInterface) ([]*PendingApproval, error) {
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    role, err := getCallerRole(ctx)
+    if err != nil {
+        return nil, err
+    }
+    department, err := getCallerDepartment(ctx)
+    if err != nil {
+        return nil, err
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return nil, err
+    }
+    ts, err := ctx.GetStub().GetTxTimestamp()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+    }
+    txTime := time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC()
+
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndexObjectType, []string{StatusInitialized})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query status index: %v", err)
+    }
+    defer iterator.Close()
+
+    policies := map[string]*ApprovalPolicy{}
+    result := []*PendingApproval{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, statusIndexObjectType)
+        if err != nil {
+            continue
+        }
+        update, err := updates.GetUpdate(ctx, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        if update.Status != StatusInitialized {
+            continue
+        }
+
+        policy, ok := policies[update.ModelID]
+        if !ok {
+            if policy, err = approvalPolicyFor(ctx, update.ModelID); err != nil {
+                return nil, err
+            }
+            policies[update.ModelID] = policy
+        }
+        if !policy.allowsRole(role) {
+            continue
+        }
+        assignment, err := readReviewerAssignment(ctx, update.UpdateID)
+        if err != nil {
+            return nil, err
+        }
+        assigned := false
+        if assignment != nil {
+            if !containsString(assignment.Reviewers, callerID) {
+                continue
+            }
+            assigned = true
+        }
+        voted, err := hasVoted(ctx, update.UpdateID, callerID)
+        if err != nil {
+            return nil, err
+        }
+        if voted {
+            continue
+        }
+        votes, err := votesOf(ctx, update.UpdateID)
+        if err != nil {
+            return nil, err
+        }
+
+        created, err := time.Parse(time.RFC3339, update.Timestamp)
+        if err != nil {
+            return nil, fmt.Errorf("update %s has invalid Timestamp %q: %v", update.UpdateID, update.Timestamp, err)
+        }
+        deadline := created.Add(time.Duration(cfg.ReviewDeadlineHours) * time.Hour).UTC()
+        result = append(result, &PendingApproval{
+            Update:           update,
+            Deadline:         deadline.Format(time.RFC3339),
+            Overdue:          txTime.After(deadline),
+            Assigned:         assigned,
+            DepartmentNeeded: department != "" && containsString(policy.missingDepartments(votes), department),
+        })
+    }
+
+    sort.Slice(result, func(i, j int) bool {
+        if result[i].Deadline != result[j].Deadline {
+            return result[i].Deadline < result[j].Deadline
+        }
+        return result[i].Update.UpdateID < result[j].Update.UpdateID
+    })
+    return result, nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,156 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ProjectStats aggregates the updates of a set of models
+type ProjectStats struct {
+    Models   []string       `json:"Models,omitempty"` // empty for the whole project
+    Updates  int            `json:"Updates"`
+    ByStatus map[string]int `json:"ByStatus"`
+    ByMonth  map[string]int `json:"ByMonth"` // "YYYY-MM" of the update Timestamp
+
+    // AvgHoursToApproval averages the time from InitBIMUpdate to the approving decision
+    // over the Approved updates that have a decision record
+    Approved           int     `json:"Approved"`
+    AvgHoursToApproval float64 `json:"AvgHoursToApproval"`
+
+    Departments []*DepartmentStats `json:"Departments"` // by InitiatorDepartment, sorted
+}
+
+// DepartmentStats counts the decided and rejected updates initiated by one department
+type DepartmentStats struct {
+    Department    string  `json:"Department"` // empty for initiators without a department attribute
+    Updates       int     `json:"Updates"`
+    Decided       int     `json:"Decided"`
+    Rejected      int     `json:"Rejected"`
+    RejectionRate float64 `json:"RejectionRate"` // Rejected / Decided, 0 while nothing is decided
+}
+
+// QueryProjectStats returns counts by status and month, the average time to approval and
+// the rejection rate per initiating department over the updates of modelIDs, or of all
+// models when modelIDs is empty
+func (qc *QueryContract) QueryProjectStats(ctx contractapi.TransactionContextInterface, modelIDs []string) (*ProjectStats, error) {
+    models := uniqueSorted(modelIDs)
+    var ids []string
+    if len(models) == 0 {
+        all, err := updateStore{}.listIDs(ctx)
+        if err != nil {
+            return nil, err
+        }
+        ids = all
+    }
+    for _, modelID := range models {
+        modelUpdates, err := modelUpdateIDs(ctx, modelID)
+        if err != nil {
+            return nil, err
+        }
+        ids = append(ids, modelUpdates...)
+    }
+
+    stats := &ProjectStats{Models: models, ByStatus: map[string]int{}, ByMonth: map[string]int{}, Departments: []*DepartmentStats{}}
+    departments := map[string]*DepartmentStats{}
+    var approvalHours float64
+    for _, id := range ids {
+        update, err := updates.GetUpdate(ctx, id)
+        if err != nil {
+            return nil, err
+        }
+        stats.Updates++
+        stats.ByStatus[update.Status]++
+        created, err := time.Parse(time.RFC3339, update.Timestamp)
+        if err != nil {
+            return nil, fmt.Errorf("update %s has invalid Timestamp %q: %v", update.UpdateID, update.Timestamp, err)
+        }
+        stats.ByMonth[created.UTC().Format(timeIndexBucketLayout)]++
+
+        dept, ok := departments[update.InitiatorDepartment]
+        if !ok {
+            dept = &DepartmentStats{Department: update.InitiatorDepartment}
+            departments[update.InitiatorDepartment] = dept
+            stats.Departments = append(stats.Departments, dept)
+        }
+        dept.Updates++
+
+        approval, err := readDecision(ctx, update.UpdateID)
+        if err != nil {
+            return nil, err
+        }
+        if approval == nil {
+            continue
+        }
+        dept.Decided++
+        switch approval.ApproveResult {
+        case StatusRejected:
+            dept.Rejected++
+        case StatusApproved:
+            decided, err := time.Parse(time.RFC3339, approval.Timestamp)
+            if err != nil {
+                continue
+            }
+            stats.Approved++
+            approvalHours += decided.Sub(created).Hours()
+        }
+    }
+
+    if stats.Approved > 0 {
+        stats.AvgHoursToApproval = approvalHours / float64(stats.Approved)
+    }
+    for _, d := range stats.Departments {
+        if d.Decided > 0 {
+            d.RejectionRate = float64(d.Rejected) / float64(d.Decided)
+        }
+    }
+    sort.Slice(stats.Departments, func(i, j int) bool {
+        return stats.Departments[i].Department < stats.Departments[j].Department
+    })
+    return stats, nil
+}
+
+// modelUpdateIDs returns the IDs of a model's updates from the model index
+func modelUpdateIDs(ctx contractapi.TransactionContextInterface, modelID string) ([]string, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(modelIndexObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query model index: %v", err)
+    }
+    defer iterator.Close()
+
+    var ids []string
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, modelIndexObjectType)
+        if err != nil {
+            continue
+        }
+        ids = append(ids, attrs[1])
+    }
+    return ids, nil
+}
+
+// readDecision loads the final decision record of an update, or nil while undecided
+func readDecision(ctx contractapi.TransactionContextInterface, updateID string) (*BIMApproval, error) {
+    key, err := approvalKey(ctx, updateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read approval record: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var approval BIMApproval
+    if err := decodeRecord(schemaBIMApproval, data, &approval); err != nil {
+        return nil, fmt.Errorf("failed to parse approval record of %s: %v", updateID, err)
+    }
+    return &approval, nil
+}
@@ -0,0 +1,63 @@
+package chaincode
+
+import (
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ProposalSignature is the signed-proposal metadata captured for the submitter of a
+// transaction. It records who signed (MSP and certificate) and what they signed, so the
+// client signature can be checked later against the proposal kept in the block.
+type ProposalSignature struct {
+    TxID         string `json:"TxID"`
+    MSPID        string `json:"MSPID"`
+    CertSerial   string `json:"CertSerial"`   // hex-encoded certificate serial number
+    CertSubject  string `json:"CertSubject"`  // certificate subject DN
+    CertIssuer   string `json:"CertIssuer"`   // certificate issuer DN
+    ProposalHash string `json:"ProposalHash"` // hex SHA-256 of the signed proposal bytes
+    Signature    string `json:"Signature"`    // base64 client signature over the proposal bytes
+}
+
+// captureProposalSignature reads the creator's certificate and the client signature
+// from the signed proposal of the current transaction
+func captureProposalSignature(ctx contractapi.TransactionContextInterface) (ProposalSignature, error) {
+    stub := ctx.GetStub()
+    ci, err := cid.New(stub)
+    if err != nil {
+        return ProposalSignature{}, fmt.Errorf("failed to create client identity: %v", err)
+    }
+    mspID, err := ci.GetMSPID()
+    if err != nil {
+        return ProposalSignature{}, fmt.Errorf("failed to get creator MSP ID: %v", err)
+    }
+    cert, err := ci.GetX509Certificate()
+    if err != nil {
+        return ProposalSignature{}, fmt.Errorf("failed to get creator certificate: %v", err)
+    }
+    if cert == nil {
+        return ProposalSignature{}, fmt.Errorf("creator identity has no X.509 certificate")
+    }
+    signed, err := stub.GetSignedProposal()
+    if err != nil {
+        return ProposalSignature{}, fmt.Errorf("failed to get signed proposal: %v", err)
+    }
+    if signed == nil || len(signed.Signature) == 0 {
+        return ProposalSignature{}, fmt.Errorf("signed proposal carries no client signature")
+    }
+
+    proposalHash := sha256.Sum256(signed.ProposalBytes)
+    return ProposalSignature{
+        TxID:         stub.GetTxID(),
+        MSPID:        mspID,
+        CertSerial:   hex.EncodeToString(cert.SerialNumber.Bytes()),
+        CertSubject:  cert.Subject.String(),
+        CertIssuer:   cert.Issuer.String(),
+        ProposalHash: hex.EncodeToString(proposalHash[:]),
+        Signature:    base64.StdEncoding.EncodeToString(signed.Signature),
+    }, nil
+}
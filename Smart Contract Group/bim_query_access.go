@@ -0,0 +1,106 @@
+package chaincode
+
+import (
+    "fmt"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Organization-scoped reads. Every query returning updates, from QueryUpdate to the
+// list, filter and tag queries, only returns updates the caller's org takes part in:
+//   - updates initiated by a member of the caller's MSP
+//   - updates on models owned by the caller's MSP (see ModelRegistryContract)
+//   - updates on models whose approval policy requires the caller's department
+// bim_lead and auditor callers see everything. Paginated queries drop the records
+// outside the scope from each page, so a page may hold fewer than pageSize records.
+
+// accessScope decides which updates the caller may read
+type accessScope struct {
+    all        bool
+    mspID      string
+    department string
+    models     map[string]bool // modelID -> caller's org participates, cached per transaction
+}
+
+// callerScope builds the access scope of the submitting client
+func callerScope(ctx contractapi.TransactionContextInterface) (*accessScope, error) {
+    role, err := getCallerRole(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if role == RoleBIMLead || role == RoleAuditor {
+        return &accessScope{all: true}, nil
+    }
+    mspID, err := getSubmittingClientMSPID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    department, err := getCallerDepartment(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return &accessScope{mspID: mspID, department: department, models: map[string]bool{}}, nil
+}
+
+// canSee reports whether update is within the scope
+func (s *accessScope) canSee(ctx contractapi.TransactionContextInterface, update *BIMUpdate) (bool, error) {
+    if s.all {
+        return true, nil
+    }
+    // records created before proposal signatures carried the MSP ID fall through to the model check
+    if sig, ok := update.Signatures[update.Initiator]; ok && sig.MSPID == s.mspID {
+        return true, nil
+    }
+    if visible, ok := s.models[update.ModelID]; ok {
+        return visible, nil
+    }
+    visible, err := s.participates(ctx, update.ModelID)
+    if err != nil {
+        return false, err
+    }
+    s.models[update.ModelID] = visible
+    return visible, nil
+}
+
+// participates reports whether the caller's org owns modelID or reviews it
+func (s *accessScope) participates(ctx contractapi.TransactionContextInterface, modelID string) (bool, error) {
+    model, err := readModel(ctx, modelID)
+    if err != nil {
+        return false, err
+    }
+    if model != nil && model.OwnerMSP == s.mspID {
+        return true, nil
+    }
+    if s.department == "" {
+        return false, nil
+    }
+    policy, err := approvalPolicyFor(ctx, modelID)
+    if err != nil {
+        return false, err
+    }
+    for _, d := range policy.RequiredDepartments {
+        if d == s.department {
+            return true, nil
+        }
+    }
+    return false, nil
+}
+
+// record combines update with its approval record, or returns nil when update is outside the scope
+func (s *accessScope) record(ctx contractapi.TransactionContextInterface, update *BIMUpdate) (*BIMHistoryRecord, error) {
+    visible, err := s.canSee(ctx, update)
+    if err != nil || !visible {
+        return nil, err
+    }
+    return historyRecordOf(ctx, update)
+}
+
+// visibleRecord reads updateID and combines it with its approval record, or returns nil
+// when the update is outside the scope
+func visibleRecord(ctx contractapi.TransactionContextInterface, scope *accessScope, updateID string) (*BIMHistoryRecord, error) {
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    return scope.record(ctx, update)
+}
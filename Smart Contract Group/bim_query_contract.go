@@ -1,8 +1,8 @@
 package chaincode
 
 import (
-    "encoding/json"
     "fmt"
+    "time"
 
     "github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -19,28 +19,42 @@ type BIMHistoryRecord struct {
     Approval   *BIMApproval `json:"ApprovalRecord"`
 }
 
+// HistoryPage is one page of combined records plus the bookmark for the next page
+type HistoryPage struct {
+    Records      []*BIMHistoryRecord `json:"Records"`
+    FetchedCount int32              `json:"FetchedCount"`
+    Bookmark     string             `json:"Bookmark"`
+}
+
 // QueryUpdate returns full information of a BIM update transaction
 // Includes initialization info + approval record (if exists)
+// - The update must be within the caller's organization scope, see callerScope
 func (qc *QueryContract) QueryUpdate(ctx contractapi.TransactionContextInterface, updateID string) (*BIMHistoryRecord, error) {
     if updateID == "" {
         return nil, fmt.Errorf("updateID required")
     }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
 
     // --- Query initialization record ---
-    initBytes, err := ctx.GetStub().GetState(updateID)
+    rec, err := visibleRecord(ctx, scope, updateID)
     if err != nil {
-        return nil, fmt.Errorf("failed to read init record: %v", err)
-    }
-    if initBytes == nil {
-        return nil, fmt.Errorf("no record for update %s", updateID)
+        return nil, err
     }
-    var initRec BIMUpdate
-    if err := json.Unmarshal(initBytes, &initRec); err != nil {
-        return nil, fmt.Errorf("failed to parse init record: %v", err)
+    if rec == nil {
+        return nil, errUnauthorized("update %s is outside the caller's organization scope", updateID)
     }
+    return rec, nil
+}
+
+// historyRecordOf combines a loaded update with its approval record (if exists)
+func historyRecordOf(ctx contractapi.TransactionContextInterface, initRec *BIMUpdate) (*BIMHistoryRecord, error) {
+    updateID := initRec.UpdateID
 
     // --- Query approval record (may not exist yet) ---
-    compKey, err := ctx.GetStub().CreateCompositeKey("BIMApproval", []string{updateID})
+    compKey, err := approvalKey(ctx, updateID)
     if err != nil {
         return nil, fmt.Errorf("failed composite key: %v", err)
     }
@@ -53,103 +67,327 @@ func (qc *QueryContract) QueryUpdate(ctx contractapi.TransactionContextInterface
     var approvalRec *BIMApproval = nil
     if apprBytes != nil { // approval record exists
         var tmp BIMApproval
-        if err := json.Unmarshal(apprBytes, &tmp); err != nil {
+        if err := decodeRecord(schemaBIMApproval, apprBytes, &tmp); err != nil {
             return nil, fmt.Errorf("failed to parse approval record: %v", err)
         }
+        if err := revealReviewer(ctx, initRec, &tmp); err != nil {
+            return nil, err
+        }
         approvalRec = &tmp
     }
 
     // --- Build output structure ---
     history := BIMHistoryRecord{
         UpdateID:   updateID,
-        InitRecord: &initRec,
+        InitRecord: initRec,
         Approval:   approvalRec,
     }
 
     return &history, nil
 }
 
-// QueryModelHistory lists all updates associated with a BIM model
-// Returns a list of init+approval combined results
-func (qc *QueryContract) QueryModelHistory(ctx contractapi.TransactionContextInterface, modelID string) ([]*BIMHistoryRecord, error) {
+// QueryModelHistory lists the updates of a BIM model using the model index
+// Returns a page of init+approval combined results; pass the returned Bookmark to fetch the next page
+func (qc *QueryContract) QueryModelHistory(ctx contractapi.TransactionContextInterface, modelID string, pageSize int32, bookmark string) (*HistoryPage, error) {
     if modelID == "" {
         return nil, fmt.Errorf("modelID required")
     }
-
-    // Scan all updates (prefix-scan all updates stored directly under keys)
-    iterator, err := ctx.GetStub().GetStateByRange("", "")
+    if pageSize <= 0 {
+        return nil, fmt.Errorf("pageSize must be positive")
+    }
+    scope, err := callerScope(ctx)
     if err != nil {
         return nil, err
     }
-    defer iterator.Close()
 
-    var result []*BIMHistoryRecord
+    iterator, meta, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(modelIndexObjectType, []string{modelID}, pageSize, bookmark)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query model index: %v", err)
+    }
+    defer iterator.Close()
 
+    page := &HistoryPage{Records: []*BIMHistoryRecord{}}
     for iterator.HasNext() {
         kv, err := iterator.Next()
         if err != nil {
             return nil, err
         }
-
-        // Skip approval composite keys (they include null bytes, filtered out)
-        if _, comp := ctx.GetStub().SplitCompositeKey(kv.Key); comp != nil {
+        attrs, err := parseKey(ctx, kv.Key, modelIndexObjectType)
+        if err != nil {
             continue
         }
 
-        var maybeInit BIMUpdate
-        if err := json.Unmarshal(kv.Value, &maybeInit); err != nil {
-            continue // skip invalid JSON
+        // read the update once and its approval in the same pass
+        initRec, err := updates.GetUpdate(ctx, attrs[1])
+        if err != nil {
+            return nil, err
         }
-
-        if maybeInit.ModelID != modelID {
-            continue
+        rec, err := scope.record(ctx, initRec)
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            page.Records = append(page.Records, rec)
         }
+    }
 
-        // fetch approval if exists
-        rec, err := qc.QueryUpdate(ctx, maybeInit.UpdateID)
-        if err != nil {
+    if meta != nil {
+        page.FetchedCount = meta.FetchedRecordsCount
+        page.Bookmark = meta.Bookmark
+    }
+    return page, nil
+}
+
+// QueryAllUpdates returns all BIM updates within the caller's organization scope
+func (qc *QueryContract) QueryAllUpdates(ctx contractapi.TransactionContextInterface) ([]*BIMHistoryRecord, error) {
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
+    ids, err := updateStore{}.listIDs(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    var result []*BIMHistoryRecord
+
+    for _, id := range ids {
+        // full record
+        rec, err := visibleRecord(ctx, scope, id)
+        if err != nil || rec == nil {
             continue
         }
+
         result = append(result, rec)
     }
 
     return result, nil
 }
 
-// QueryAllUpdates returns all BIM updates
-func (qc *QueryContract) QueryAllUpdates(ctx contractapi.TransactionContextInterface) ([]*BIMHistoryRecord, error) {
-    iterator, err := ctx.GetStub().GetStateByRange("", "")
+// QueryUpdatesByStatus lists updates with the given status using the status index
+// Results are paginated; pass the returned Bookmark to fetch the next page
+func (qc *QueryContract) QueryUpdatesByStatus(ctx contractapi.TransactionContextInterface, status string, pageSize int32, bookmark string) (*HistoryPage, error) {
+    if status == "" {
+        return nil, fmt.Errorf("status required")
+    }
+    if pageSize <= 0 {
+        return nil, fmt.Errorf("pageSize must be positive")
+    }
+    scope, err := callerScope(ctx)
     if err != nil {
         return nil, err
     }
-    defer iterator.Close()
 
-    var result []*BIMHistoryRecord
+    iterator, meta, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(statusIndexObjectType, []string{status}, pageSize, bookmark)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query status index: %v", err)
+    }
+    defer iterator.Close()
 
+    page := &HistoryPage{Records: []*BIMHistoryRecord{}}
     for iterator.HasNext() {
         kv, err := iterator.Next()
         if err != nil {
             return nil, err
         }
-
-        // skip approval keys
-        if _, comp := ctx.GetStub().SplitCompositeKey(kv.Key); comp != nil {
+        attrs, err := parseKey(ctx, kv.Key, statusIndexObjectType)
+        if err != nil {
             continue
         }
+        rec, err := visibleRecord(ctx, scope, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            page.Records = append(page.Records, rec)
+        }
+    }
 
-        var initRec BIMUpdate
-        if err := json.Unmarshal(kv.Value, &initRec); err != nil {
-            continue
+    if meta != nil {
+        page.FetchedCount = meta.FetchedRecordsCount
+        page.Bookmark = meta.Bookmark
+    }
+    return page, nil
+}
+
+// QueryUpdatesByInitiator lists all updates submitted by initiatorID using the initiator index
+// An empty initiatorID lists the caller's own submissions
+func (qc *QueryContract) QueryUpdatesByInitiator(ctx contractapi.TransactionContextInterface, initiatorID string) ([]*BIMHistoryRecord, error) {
+    if initiatorID == "" {
+        callerID, err := getSubmittingClientID(ctx)
+        if err != nil {
+            return nil, fmt.Errorf("failed to get caller identity: %v", err)
         }
+        initiatorID = callerID
+    }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
 
-        // full record
-        rec, err := qc.QueryUpdate(ctx, initRec.UpdateID)
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(initiatorIndexObjectType, []string{initiatorID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query initiator index: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMHistoryRecord{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, initiatorIndexObjectType)
         if err != nil {
             continue
         }
+        rec, err := visibleRecord(ctx, scope, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            result = append(result, rec)
+        }
+    }
+    return result, nil
+}
 
-        result = append(result, rec)
+// QueryUpdatesByTimeRange lists updates created within [start, end] (RFC3339)
+// using the month-bucketed time index, ordered by creation time
+// - The range may touch at most maxTimeRangeMonths calendar months
+func (qc *QueryContract) QueryUpdatesByTimeRange(ctx contractapi.TransactionContextInterface, start string, end string) ([]*BIMHistoryRecord, error) {
+    startTime, err := time.Parse(time.RFC3339, start)
+    if err != nil {
+        return nil, fmt.Errorf("invalid start %q: must be RFC3339", start)
+    }
+    endTime, err := time.Parse(time.RFC3339, end)
+    if err != nil {
+        return nil, fmt.Errorf("invalid end %q: must be RFC3339", end)
+    }
+    startTime, endTime = startTime.UTC(), endTime.UTC()
+    if endTime.Before(startTime) {
+        return nil, fmt.Errorf("end must not be before start")
+    }
+    months := (endTime.Year()-startTime.Year())*12 + int(endTime.Month()) - int(startTime.Month()) + 1
+    if months > maxTimeRangeMonths {
+        return nil, fmt.Errorf("time range spans %d months (max %d); split it into smaller ranges", months, maxTimeRangeMonths)
+    }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    result := []*BIMHistoryRecord{}
+    lastBucket := endTime.Format(timeIndexBucketLayout)
+    for month := time.Date(startTime.Year(), startTime.Month(), 1, 0, 0, 0, 0, time.UTC); ; month = month.AddDate(0, 1, 0) {
+        bucket := month.Format(timeIndexBucketLayout)
+        records, err := qc.queryTimeBucket(ctx, scope, bucket, startTime, endTime)
+        if err != nil {
+            return nil, err
+        }
+        result = append(result, records...)
+        if bucket == lastBucket {
+            break
+        }
     }
+    return result, nil
+}
+
+// maxTimeRangeMonths bounds the month buckets one QueryUpdatesByTimeRange call scans
+const maxTimeRangeMonths = 24
 
+// queryTimeBucket returns the records in one month bucket created within [start, end] and within scope
+func (qc *QueryContract) queryTimeBucket(ctx contractapi.TransactionContextInterface, scope *accessScope, bucket string, start time.Time, end time.Time) ([]*BIMHistoryRecord, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(timeIndexObjectType, []string{bucket})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query time index: %v", err)
+    }
+    defer iterator.Close()
+
+    var result []*BIMHistoryRecord
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, timeIndexObjectType)
+        if err != nil {
+            continue
+        }
+        created, err := time.Parse(time.RFC3339, attrs[1])
+        if err != nil || created.Before(start) || created.After(end) {
+            continue
+        }
+        rec, err := visibleRecord(ctx, scope, attrs[2])
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            result = append(result, rec)
+        }
+    }
     return result, nil
 }
+
+// QueryResubmissionChain returns the full rejection -> resubmission chain containing updateID,
+// ordered from the original submission to the latest revision
+// - updateID must be within the caller's organization scope; revisions outside it are left out
+func (qc *QueryContract) QueryResubmissionChain(ctx contractapi.TransactionContextInterface, updateID string) ([]*BIMHistoryRecord, error) {
+    if updateID == "" {
+        return nil, fmt.Errorf("updateID required")
+    }
+    if _, err := qc.QueryUpdate(ctx, updateID); err != nil {
+        return nil, err
+    }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    // --- Walk back to the original submission ---
+    rootID := updateID
+    seen := map[string]bool{}
+    for {
+        if seen[rootID] {
+            return nil, fmt.Errorf("resubmission cycle at update %s", rootID)
+        }
+        seen[rootID] = true
+        update, err := updates.GetUpdate(ctx, rootID)
+        if err != nil {
+            return nil, err
+        }
+        if update.PreviousUpdateID == "" {
+            break
+        }
+        rootID = update.PreviousUpdateID
+    }
+
+    // --- Walk forward through the resubmission index ---
+    var chain []*BIMHistoryRecord
+    currentID := rootID
+    for depth := 0; currentID != ""; depth++ {
+        if depth >= maxResubmissionDepth {
+            return nil, fmt.Errorf("resubmission chain of %s too long", updateID)
+        }
+        rec, err := visibleRecord(ctx, scope, currentID)
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            chain = append(chain, rec)
+        }
+
+        next, err := resubmissionsOf(ctx, currentID)
+        if err != nil {
+            return nil, err
+        }
+        currentID = ""
+        if len(next) > 0 {
+            currentID = next[0]
+        }
+    }
+    return chain, nil
+}
+
+// maxResubmissionDepth bounds the forward walk of a resubmission chain
+const maxResubmissionDepth = 1000
@@ -0,0 +1,243 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// UpdateFilter selects updates for QueryUpdatesFiltered; empty fields do not filter
+type UpdateFilter struct {
+    ModelID             string   `json:"ModelID"`
+    Statuses            []string `json:"Statuses"`            // any of these statuses
+    InitiatorDepartment string   `json:"InitiatorDepartment"` // department attribute of the initiator
+    From                string   `json:"From"`                // RFC3339, inclusive
+    To                  string   `json:"To"`                  // RFC3339, inclusive
+    VersionPrefix       string   `json:"VersionPrefix"`
+}
+
+// indexBookmarkPrefix marks bookmarks of the composite-key fallback; CouchDB bookmarks never start with it
+const indexBookmarkPrefix = "idx:"
+
+// QueryUpdatesFiltered lists the updates matching filterJSON (an UpdateFilter), one page at a time.
+// With CouchDB as state database the filter runs as a rich query (see META-INF/statedb/couchdb/indexes);
+// otherwise candidates come from the status index, or a key scan, and are filtered in chaincode.
+// Pass the returned Bookmark to fetch the next page.
+func (qc *QueryContract) QueryUpdatesFiltered(ctx contractapi.TransactionContextInterface, filterJSON string, pageSize int32, bookmark string) (*HistoryPage, error) {
+    if pageSize <= 0 {
+        return nil, fmt.Errorf("pageSize must be positive")
+    }
+    var filter UpdateFilter
+    if filterJSON != "" {
+        if err := json.Unmarshal([]byte(filterJSON), &filter); err != nil {
+            return nil, fmt.Errorf("failed to parse filter: %v", err)
+        }
+    }
+    if err := filter.normalize(); err != nil {
+        return nil, err
+    }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    if !strings.HasPrefix(bookmark, indexBookmarkPrefix) {
+        page, err := qc.queryFilteredCouch(ctx, scope, &filter, pageSize, bookmark)
+        if err == nil {
+            return page, nil
+        }
+        if bookmark != "" {
+            return nil, err
+        }
+        // rich queries are not supported by LevelDB; fall back to the indexes
+    }
+    return qc.queryFilteredIndexes(ctx, scope, &filter, pageSize, strings.TrimPrefix(bookmark, indexBookmarkPrefix))
+}
+
+// normalize validates the date range and rewrites it in UTC so it compares as text
+func (f *UpdateFilter) normalize() error {
+    for _, bound := range []*string{&f.From, &f.To} {
+        if *bound == "" {
+            continue
+        }
+        t, err := time.Parse(time.RFC3339, *bound)
+        if err != nil {
+            return fmt.Errorf("invalid date %q: must be RFC3339", *bound)
+        }
+        *bound = t.UTC().Format(time.RFC3339)
+    }
+    if f.From != "" && f.To != "" && f.To < f.From {
+        return fmt.Errorf("To must not be before From")
+    }
+    f.Statuses = uniqueSorted(f.Statuses)
+    return nil
+}
+
+// selector builds the CouchDB selector for the filter
+func (f *UpdateFilter) selector() map[string]interface{} {
+    sel := map[string]interface{}{
+        "UpdateID":  map[string]interface{}{"$exists": true},
+        "Initiator": map[string]interface{}{"$exists": true},
+    }
+    if f.ModelID != "" {
+        sel["ModelID"] = f.ModelID
+    }
+    if len(f.Statuses) > 0 {
+        sel["Status"] = map[string]interface{}{"$in": f.Statuses}
+    }
+    if f.InitiatorDepartment != "" {
+        sel["InitiatorDepartment"] = f.InitiatorDepartment
+    }
+    if f.From != "" || f.To != "" {
+        ts := map[string]interface{}{}
+        if f.From != "" {
+            ts["$gte"] = f.From
+        }
+        if f.To != "" {
+            ts["$lte"] = f.To
+        }
+        sel["Timestamp"] = ts
+    }
+    if f.VersionPrefix != "" {
+        sel["Version"] = map[string]interface{}{"$regex": "^" + regexp.QuoteMeta(f.VersionPrefix)}
+    }
+    return sel
+}
+
+// matches applies the filter to a stored update
+func (f *UpdateFilter) matches(u *BIMUpdate) bool {
+    if f.ModelID != "" && u.ModelID != f.ModelID {
+        return false
+    }
+    if len(f.Statuses) > 0 {
+        i := sort.SearchStrings(f.Statuses, u.Status)
+        if i == len(f.Statuses) || f.Statuses[i] != u.Status {
+            return false
+        }
+    }
+    if f.InitiatorDepartment != "" && u.InitiatorDepartment != f.InitiatorDepartment {
+        return false
+    }
+    if f.From != "" || f.To != "" {
+        t, err := time.Parse(time.RFC3339, u.Timestamp)
+        if err != nil {
+            return false
+        }
+        ts := t.UTC().Format(time.RFC3339)
+        if f.From != "" && ts < f.From || f.To != "" && ts > f.To {
+            return false
+        }
+    }
+    return strings.HasPrefix(u.Version, f.VersionPrefix)
+}
+
+func (qc *QueryContract) queryFilteredCouch(ctx contractapi.TransactionContextInterface, scope *accessScope, f *UpdateFilter, pageSize int32, bookmark string) (*HistoryPage, error) {
+    query, err := json.Marshal(map[string]interface{}{"selector": f.selector()})
+    if err != nil {
+        return nil, fmt.Errorf("failed to build query: %v", err)
+    }
+    iterator, meta, err := ctx.GetStub().GetQueryResultWithPagination(string(query), pageSize, bookmark)
+    if err != nil {
+        return nil, fmt.Errorf("rich query failed: %v", err)
+    }
+    defer iterator.Close()
+
+    page := &HistoryPage{Records: []*BIMHistoryRecord{}}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        updateID, ok := updateIDFromKey(ctx, kv.Key)
+        if !ok {
+            continue
+        }
+        rec, err := visibleRecord(ctx, scope, updateID)
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            page.Records = append(page.Records, rec)
+        }
+    }
+    if meta != nil {
+        page.FetchedCount = meta.FetchedRecordsCount
+        page.Bookmark = meta.Bookmark
+    }
+    return page, nil
+}
+
+// queryFilteredIndexes pages through the matching updates within scope in UpdateID order;
+// after is the last UpdateID of the previous page
+func (qc *QueryContract) queryFilteredIndexes(ctx contractapi.TransactionContextInterface, scope *accessScope, f *UpdateFilter, pageSize int32, after string) (*HistoryPage, error) {
+    ids, err := filterCandidates(ctx, f)
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(ids)
+
+    page := &HistoryPage{Records: []*BIMHistoryRecord{}}
+    for _, id := range ids[sort.SearchStrings(ids, after):] {
+        if id == after {
+            continue
+        }
+        update, err := updates.GetUpdate(ctx, id)
+        if err != nil {
+            return nil, err
+        }
+        if !f.matches(update) {
+            continue
+        }
+        visible, err := scope.canSee(ctx, update)
+        if err != nil {
+            return nil, err
+        }
+        if !visible {
+            continue
+        }
+        if int32(len(page.Records)) == pageSize {
+            page.Bookmark = indexBookmarkPrefix + page.Records[len(page.Records)-1].UpdateID
+            break
+        }
+        rec, err := historyRecordOf(ctx, update)
+        if err != nil {
+            return nil, err
+        }
+        page.Records = append(page.Records, rec)
+    }
+    page.FetchedCount = int32(len(page.Records))
+    return page, nil
+}
+
+// filterCandidates returns a superset of the matching UpdateIDs: the status index entries
+// when statuses are given, otherwise every update key
+func filterCandidates(ctx contractapi.TransactionContextInterface, f *UpdateFilter) ([]string, error) {
+    var ids []string
+    if len(f.Statuses) > 0 {
+        for _, status := range f.Statuses {
+            iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statusIndexObjectType, []string{status})
+            if err != nil {
+                return nil, fmt.Errorf("failed to query status index: %v", err)
+            }
+            for iterator.HasNext() {
+                kv, err := iterator.Next()
+                if err != nil {
+                    iterator.Close()
+                    return nil, err
+                }
+                attrs, err := parseKey(ctx, kv.Key, statusIndexObjectType)
+                if err == nil {
+                    ids = append(ids, attrs[1])
+                }
+            }
+            iterator.Close()
+        }
+        return ids, nil
+    }
+    return updateStore{}.listIDs(ctx)
+}
@@ -0,0 +1,181 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Responsibility matrix. Where component packages make owners responsible for individual
+// elements, the matrix makes departments responsible for element categories: walls and
+// slabs to structure, ducts to me, and so on. When an update's ChangeManifest lists the
+// categories it changes, initUpdate assigns the reviewers of the responsible departments,
+// so the update is routed without a separate AssignReviewers call.
+
+// ResponsibilityMatrix maps the element categories of a model to departments and names
+// the reviewers of each department
+type ResponsibilityMatrix struct {
+    ModelID    string              `json:"ModelID" validate:"required,max=64,id"`
+    Categories map[string]string   `json:"Categories"` // IFC entity type, upper case (IFCWALL) -> department
+    Reviewers  map[string][]string `json:"Reviewers"`  // department -> client IDs of its reviewers
+
+    UpdatedBy string `json:"UpdatedBy"`
+    Timestamp string `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventResponsibilityMatrixSet = "BIMResponsibilityMatrixSet"
+
+    maxMatrixCategories   = 500
+    maxManifestCategories = 500
+)
+
+// SetResponsibilityMatrix creates or replaces the responsibility matrix of a model
+// - Caller must have role=bim_lead
+// - matrixJSON is a ResponsibilityMatrix; categories are matched case-insensitively
+// - Every department a category maps to needs at least one reviewer
+func (cc *ComponentContract) SetResponsibilityMatrix(ctx contractapi.TransactionContextInterface, matrixJSON string) (*ResponsibilityMatrix, error) {
+    if err := authorizeCallerRole(ctx, RoleBIMLead); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    var input ResponsibilityMatrix
+    if err := json.Unmarshal([]byte(matrixJSON), &input); err != nil {
+        return nil, fmt.Errorf("failed to parse responsibility matrix: %v", err)
+    }
+    if err := validateStruct(&input); err != nil {
+        return nil, err
+    }
+    if len(input.Categories) == 0 {
+        return nil, fmt.Errorf("at least one category required")
+    }
+    if len(input.Categories) > maxMatrixCategories {
+        return nil, fmt.Errorf("too many categories: %d (max %d)", len(input.Categories), maxMatrixCategories)
+    }
+
+    matrix := ResponsibilityMatrix{
+        ModelID:    input.ModelID,
+        Categories: map[string]string{},
+        Reviewers:  map[string][]string{},
+    }
+    for category, department := range input.Categories {
+        key := strings.ToUpper(strings.TrimSpace(category))
+        if key == "" || len(key) > 64 {
+            return nil, fmt.Errorf("category %q must have 1 to 64 characters", category)
+        }
+        if errs := checkRules(department, "required,max=64,id"); len(errs) > 0 {
+            return nil, fmt.Errorf("department of category %s %s", key, strings.Join(errs, ", "))
+        }
+        if previous, ok := matrix.Categories[key]; ok && previous != department {
+            return nil, fmt.Errorf("category %s maps to both %s and %s", key, previous, department)
+        }
+        matrix.Categories[key] = department
+    }
+    for _, department := range matrix.Categories {
+        reviewers := uniqueSorted(input.Reviewers[department])
+        if len(reviewers) == 0 {
+            return nil, fmt.Errorf("department %s has no reviewers", department)
+        }
+        matrix.Reviewers[department] = reviewers
+    }
+
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    matrix.UpdatedBy = callerID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    matrix.Timestamp = txTime.Format(time.RFC3339)
+    matrix.SchemaVersion = schemaVersion(schemaResponsibility)
+    if err := putSubRecord(ctx, responsibilityObjectType, []string{matrix.ModelID}, &matrix, EventResponsibilityMatrixSet); err != nil {
+        return nil, err
+    }
+    return &matrix, nil
+}
+
+// QueryResponsibilityMatrix returns the responsibility matrix of a model, or nil if it has none
+func (cc *ComponentContract) QueryResponsibilityMatrix(ctx contractapi.TransactionContextInterface, modelID string) (*ResponsibilityMatrix, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    return readResponsibilityMatrix(ctx, modelID)
+}
+
+// QueryResponsibleReviewers returns the reviewers the matrix of a model assigns to an
+// update changing the given categories, sorted
+func (cc *ComponentContract) QueryResponsibleReviewers(ctx contractapi.TransactionContextInterface, modelID string, categories []string) ([]string, error) {
+    matrix, err := readResponsibilityMatrix(ctx, modelID)
+    if err != nil {
+        return nil, err
+    }
+    if matrix == nil {
+        return nil, errNotFound("model %s has no responsibility matrix", modelID)
+    }
+    return matrix.reviewersFor(categories), nil
+}
+
+// reviewersFor returns the sorted, unique reviewers of the departments responsible for
+// any of categories; categories the matrix does not list are ignored
+func (m *ResponsibilityMatrix) reviewersFor(categories []string) []string {
+    var reviewers []string
+    seen := map[string]bool{}
+    for _, c := range categories {
+        department, ok := m.Categories[strings.ToUpper(strings.TrimSpace(c))]
+        if !ok || seen[department] {
+            continue
+        }
+        seen[department] = true
+        reviewers = append(reviewers, m.Reviewers[department]...)
+    }
+    return uniqueSorted(reviewers)
+}
+
+// routeByResponsibility assigns the reviewers responsible for the categories of a new
+// update's change manifest. Updates without categories, models without a matrix and
+// categories the matrix does not cover leave the update unassigned, open to any caller
+// the approval policy admits. The BIMInit event set afterwards replaces the
+// BIMReviewersAssigned event; the assignment is read with QueryReviewerAssignment.
+func routeByResponsibility(ctx contractapi.TransactionContextInterface, update *BIMUpdate) error {
+    if update.ChangeManifest == nil || len(update.ChangeManifest.Categories) == 0 {
+        return nil
+    }
+    if n := len(update.ChangeManifest.Categories); n > maxManifestCategories {
+        return fmt.Errorf("too many change manifest categories: %d (max %d)", n, maxManifestCategories)
+    }
+    matrix, err := readResponsibilityMatrix(ctx, update.ModelID)
+    if err != nil || matrix == nil {
+        return err
+    }
+    reviewers := matrix.reviewersFor(update.ChangeManifest.Categories)
+    if len(reviewers) == 0 {
+        return nil
+    }
+    _, err = writeReviewerAssignment(ctx, update, reviewers)
+    return err
+}
+
+func readResponsibilityMatrix(ctx contractapi.TransactionContextInterface, modelID string) (*ResponsibilityMatrix, error) {
+    key, err := makeKey(ctx, responsibilityObjectType, modelID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read responsibility matrix: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var matrix ResponsibilityMatrix
+    if err := decodeRecord(schemaResponsibility, data, &matrix); err != nil {
+        return nil, fmt.Errorf("failed to parse responsibility matrix: %v", err)
+    }
+    return &matrix, nil
+}
@@ -0,0 +1,204 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Reviewer assignment narrows who may vote on an update: once reviewers are assigned,
+// ApproveBIMUpdate only accepts votes from them. Updates without an assignment can be
+// approved by any caller holding a role of the model's approval policy.
+
+// ReviewerAssignment lists the reviewers assigned to an update
+type ReviewerAssignment struct {
+    UpdateID   string   `json:"UpdateID"`
+    ModelID    string   `json:"ModelID"`
+    Reviewers  []string `json:"Reviewers"` // client IDs as returned by the client identity library
+    AssignedBy string   `json:"AssignedBy"`
+    Timestamp  string   `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventReviewersAssigned = "BIMReviewersAssigned"
+)
+
+// AssignReviewers assigns the reviewers of an update, replacing any earlier assignment
+// - Caller must have role=bim_lead, or be the registered owner of the update's model
+// - The update must be INITIALIZED
+// - Reviewers that already voted keep their vote
+func (c *ApprovalContract) AssignReviewers(ctx contractapi.TransactionContextInterface, updateID string, reviewerIDs []string) error {
+    if updateID == "" {
+        return fmt.Errorf("updateID required")
+    }
+    reviewers := uniqueSorted(reviewerIDs)
+    if len(reviewers) == 0 {
+        return fmt.Errorf("at least one reviewer required")
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if update.Status != StatusInitialized {
+        return errInvalidState("update %s is %s, reviewers can only be assigned to INITIALIZED updates", updateID, update.Status)
+    }
+    if err := authorizeAssigner(ctx, update.ModelID); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    _, err = writeReviewerAssignment(ctx, update, reviewers)
+    return err
+}
+
+// writeReviewerAssignment replaces the assignment of update with reviewers (sorted, unique)
+// and emits EventReviewersAssigned
+func writeReviewerAssignment(ctx contractapi.TransactionContextInterface, update *BIMUpdate, reviewers []string) (*ReviewerAssignment, error) {
+    updateID := update.UpdateID
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    previous, err := readReviewerAssignment(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if previous != nil {
+        for _, r := range previous.Reviewers {
+            if err := delIndexEntry(ctx, reviewerIndexObjectType, r, updateID); err != nil {
+                return nil, err
+            }
+        }
+    }
+    for _, r := range reviewers {
+        if err := putIndexEntry(ctx, reviewerIndexObjectType, r, updateID); err != nil {
+            return nil, err
+        }
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    assignment := ReviewerAssignment{
+        UpdateID:      updateID,
+        ModelID:       update.ModelID,
+        Reviewers:     reviewers,
+        AssignedBy:    callerID,
+        Timestamp:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaReviewerAssignment),
+    }
+    if err := putSubRecord(ctx, reviewerAssignmentObjectType, []string{updateID}, &assignment, EventReviewersAssigned); err != nil {
+        return nil, err
+    }
+    return &assignment, nil
+}
+
+// QueryReviewerAssignment returns the reviewers assigned to an update, or nil if none are
+func (c *ApprovalContract) QueryReviewerAssignment(ctx contractapi.TransactionContextInterface, updateID string) (*ReviewerAssignment, error) {
+    return readReviewerAssignment(ctx, updateID)
+}
+
+// QueryMyAssignments returns the INITIALIZED updates assigned to the caller that the
+// caller has not voted on yet
+func (c *ApprovalContract) QueryMyAssignments(ctx contractapi.TransactionContextInterface) ([]*BIMUpdate, error) {
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(reviewerIndexObjectType, []string{callerID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query reviewer index: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*BIMUpdate{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, reviewerIndexObjectType)
+        if err != nil {
+            continue
+        }
+        update, err := updates.GetUpdate(ctx, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        if update.Status != StatusInitialized {
+            continue
+        }
+        voted, err := hasVoted(ctx, update.UpdateID, callerID)
+        if err != nil {
+            return nil, err
+        }
+        if !voted {
+            result = append(result, update)
+        }
+    }
+    return result, nil
+}
+
+// authorizeAssigner allows bim_lead callers and the registered owner of the model
+func authorizeAssigner(ctx contractapi.TransactionContextInterface, modelID string) error {
+    roleErr := authorizeCallerRole(ctx, RoleBIMLead)
+    if roleErr == nil {
+        return nil
+    }
+    model, err := readModel(ctx, modelID)
+    if err != nil {
+        return err
+    }
+    if model == nil {
+        return roleErr
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if callerID != model.Owner {
+        return errUnauthorized("caller neither has role=%s nor owns model %s", RoleBIMLead, modelID)
+    }
+    return nil
+}
+
+// authorizeAssignedReviewer rejects callerID when reviewers are assigned to the update
+// and callerID is not one of them
+func authorizeAssignedReviewer(ctx contractapi.TransactionContextInterface, updateID string, callerID string) error {
+    assignment, err := readReviewerAssignment(ctx, updateID)
+    if err != nil {
+        return err
+    }
+    if assignment == nil {
+        return nil
+    }
+    for _, r := range assignment.Reviewers {
+        if r == callerID {
+            return nil
+        }
+    }
+    return fmt.Errorf("caller is not an assigned reviewer of update %s", updateID)
+}
+
+// readReviewerAssignment loads the assignment of an update, or nil if there is none
+func readReviewerAssignment(ctx contractapi.TransactionContextInterface, updateID string) (*ReviewerAssignment, error) {
+    key, err := makeKey(ctx, reviewerAssignmentObjectType, updateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read reviewer assignment: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var assignment ReviewerAssignment
+    if err := decodeRecord(schemaReviewerAssignment, data, &assignment); err != nil {
+        return nil, fmt.Errorf("failed to parse reviewer assignment: %v", err)
+    }
+    return &assignment, nil
+}
@@ -0,0 +1,186 @@
+package chaincode
+
+import (
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/pem"
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Certificate checks on the transaction submitter.
+//
+// Peers validate the creator against the MSP definition in the channel config, but the
+// chaincode cannot read that config, and a CRL added to an MSP only takes effect after a
+// channel config update. Organizations therefore also publish their CRLs here with
+// LoadCRL; callerIdentity rejects expired certificates and certificates whose serial is
+// on the CRL of their issuing CA before any role check.
+
+// CertRevocationList is the revoked serial set of one CA of an MSP
+type CertRevocationList struct {
+    MSPID      string            `json:"MSPID"`
+    Issuer     string            `json:"Issuer"`               // issuer DN, matched against the caller certificate's issuer
+    Number     string            `json:"Number,omitempty"`     // CRL number extension, decimal
+    ThisUpdate string            `json:"ThisUpdate"`           // RFC3339
+    NextUpdate string            `json:"NextUpdate,omitempty"` // RFC3339
+    Revoked    map[string]string `json:"Revoked"`              // hex serial -> revocation time (RFC3339)
+    LoadedBy   string            `json:"LoadedBy"`
+    Timestamp  string            `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// LoadCRL stores a PEM or DER encoded X.509 CRL for the caller's own MSP, replacing the
+// previously loaded CRL of the same issuer
+// - Caller must have role=admin
+// - mspID must be the caller's MSP: organizations only publish revocations for their own CAs
+// - a CRL older than the stored one (by ThisUpdate) is refused
+func (cc *ConfigContract) LoadCRL(ctx contractapi.TransactionContextInterface, mspID string, crlData string) (*CertRevocationList, error) {
+    if err := authorizeCallerRole(ctx, RoleAdmin); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    callerMSP, err := getSubmittingClientMSPID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller MSP: %v", err)
+    }
+    if mspID != callerMSP {
+        return nil, errUnauthorized("caller of %s may not load CRLs for %s", callerMSP, mspID)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+
+    der := []byte(crlData)
+    if block, _ := pem.Decode(der); block != nil {
+        if block.Type != "X509 CRL" {
+            return nil, fmt.Errorf("unexpected PEM block %q, want X509 CRL", block.Type)
+        }
+        der = block.Bytes
+    }
+    parsed, err := x509.ParseRevocationList(der)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse CRL: %v", err)
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    crl := &CertRevocationList{
+        MSPID:         mspID,
+        Issuer:        parsed.Issuer.String(),
+        ThisUpdate:    parsed.ThisUpdate.UTC().Format(time.RFC3339),
+        Revoked:       map[string]string{},
+        LoadedBy:      callerID,
+        Timestamp:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaCertRevocationList),
+    }
+    if parsed.Number != nil {
+        crl.Number = parsed.Number.String()
+    }
+    if !parsed.NextUpdate.IsZero() {
+        crl.NextUpdate = parsed.NextUpdate.UTC().Format(time.RFC3339)
+    }
+    for _, entry := range parsed.RevokedCertificateEntries {
+        crl.Revoked[hex.EncodeToString(entry.SerialNumber.Bytes())] = entry.RevocationTime.UTC().Format(time.RFC3339)
+    }
+
+    previous, err := readCRL(ctx, mspID, crl.Issuer)
+    if err != nil {
+        return nil, err
+    }
+    if previous != nil && previous.ThisUpdate > crl.ThisUpdate {
+        return nil, fmt.Errorf("CRL of %s issued at %s is older than the stored one (%s)", crl.Issuer, crl.ThisUpdate, previous.ThisUpdate)
+    }
+
+    key, err := makeKey(ctx, crlObjectType, mspID, crl.Issuer)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(crl)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal CRL: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return nil, fmt.Errorf("failed to save CRL: %v", err)
+    }
+    return crl, nil
+}
+
+// QueryCRL returns the stored CRL of an MSP's CA, or nil if none was loaded
+func (cc *ConfigContract) QueryCRL(ctx contractapi.TransactionContextInterface, mspID string, issuer string) (*CertRevocationList, error) {
+    if mspID == "" || issuer == "" {
+        return nil, fmt.Errorf("mspID and issuer required")
+    }
+    return readCRL(ctx, mspID, issuer)
+}
+
+// readCRL loads the CRL of one issuer, returning nil if none is stored
+func readCRL(ctx contractapi.TransactionContextInterface, mspID string, issuer string) (*CertRevocationList, error) {
+    key, err := makeKey(ctx, crlObjectType, mspID, issuer)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CRL: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var crl CertRevocationList
+    if err := decodeRecord(schemaCertRevocationList, data, &crl); err != nil {
+        return nil, fmt.Errorf("failed to parse CRL: %v", err)
+    }
+    return &crl, nil
+}
+
+// callerIdentity returns the submitter's client identity after checking that its
+// certificate is within its validity window at the transaction timestamp and is not
+// on the stored CRL of its issuer
+func callerIdentity(ctx contractapi.TransactionContextInterface) (cid.ClientIdentity, error) {
+    ci, err := cid.New(ctx.GetStub())
+    if err != nil {
+        return nil, fmt.Errorf("failed to create client identity: %v", err)
+    }
+    cert, err := ci.GetX509Certificate()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller certificate: %v", err)
+    }
+    if cert == nil {
+        // idemix identities carry no certificate; the MSP validates them
+        return ci, nil
+    }
+
+    ts, err := ctx.GetStub().GetTxTimestamp()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+    }
+    txTime := time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC()
+    if txTime.After(cert.NotAfter) {
+        return nil, errUnauthorized("caller certificate expired at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+    }
+    if txTime.Before(cert.NotBefore) {
+        return nil, errUnauthorized("caller certificate not valid before %s", cert.NotBefore.UTC().Format(time.RFC3339))
+    }
+
+    mspID, err := ci.GetMSPID()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller MSP: %v", err)
+    }
+    crl, err := readCRL(ctx, mspID, cert.Issuer.String())
+    if err != nil {
+        return nil, err
+    }
+    if crl != nil {
+        serial := hex.EncodeToString(cert.SerialNumber.Bytes())
+        if revokedAt, ok := crl.Revoked[serial]; ok {
+            return nil, errUnauthorized("caller certificate %s was revoked at %s", serial, revokedAt)
+        }
+    }
+    return ci, nil
+}
@@ -0,0 +1,291 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RoleAdminContract lets network admins assign application roles and departments to
+// identities on-chain, for organisations whose CA cannot issue the role and department
+// certificate attributes or when an attribute has to be corrected before a certificate
+// is reissued.
+//
+// Grants are keyed by the client identity, which does not name the MSP, so each grant
+// records the MSP of the admin who made it and applies only to callers of that MSP:
+// an admin can assign roles within their own organisation only.
+//
+// The effective role of a caller is resolved in this order:
+//  1. an unexpired RoleGrant for the caller's identity and MSP
+//  2. the caller's 'role' certificate attribute
+//
+// The department follows the same order, falling back to the certificate attribute when
+// the grant leaves Department empty. Either way the department must be permitted for the
+// caller's MSP, see getCallerDepartment. The certificate itself must still be valid and
+// not revoked, see callerIdentity.
+type RoleAdminContract struct {
+    contractapi.Contract
+}
+
+// RoleGrant assigns a role and department to one identity
+type RoleGrant struct {
+    Identity   string `json:"Identity"` // client identity as returned by GetID
+    MSPID      string `json:"MSPID"`    // MSP of the granting admin and of identity
+    Role       string `json:"Role"`
+    Department string `json:"Department,omitempty"`
+    ExpiresAt  string `json:"ExpiresAt,omitempty"` // RFC3339; empty never expires
+    GrantedBy  string `json:"GrantedBy"`
+    GrantedAt  string `json:"GrantedAt"`
+    Revoked    bool   `json:"Revoked,omitempty"` // set only in the event of RevokeRole
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventRoleGranted = "BIMRoleGranted"
+    EventRoleRevoked = "BIMRoleRevoked"
+)
+
+// grantableRoles are the roles a RoleGrant may assign
+var grantableRoles = []string{RoleModeler, RoleProfessional, RoleBIMLead, RoleAuditor, RoleSurveyor, RoleValidator, RoleAdmin}
+
+// GrantRole assigns role and department to identity, replacing an earlier grant
+// - Caller must have role=admin
+// - The grant applies to identity only in the caller's own MSP
+// - department must be permitted for the caller's MSP by the network's DepartmentMSPs
+// - Admins cannot change their own grant
+// - expiresAt is RFC3339 and must lie after the transaction timestamp; empty never expires
+func (rc *RoleAdminContract) GrantRole(ctx contractapi.TransactionContextInterface, identity string, role string, department string, expiresAt string) (*RoleGrant, error) {
+    if err := authorizeCallerRole(ctx, RoleAdmin); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    if identity == "" {
+        return nil, fmt.Errorf("identity required")
+    }
+    if !containsString(grantableRoles, role) {
+        return nil, fmt.Errorf("role %q cannot be granted", role)
+    }
+    if department != "" {
+        if errs := checkRules(department, "max=64,id"); len(errs) > 0 {
+            return nil, fmt.Errorf("department %s", strings.Join(errs, ", "))
+        }
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if identity == callerID {
+        return nil, fmt.Errorf("admins cannot change their own role grant")
+    }
+    callerMSP, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    if department != "" {
+        cfg, err := networkConfig(ctx)
+        if err != nil {
+            return nil, err
+        }
+        if !cfg.departmentAllowed(department, callerMSP) {
+            return nil, fmt.Errorf("department %q is not permitted for identities of MSP %s", department, callerMSP)
+        }
+    }
+    existing, err := readRoleGrant(ctx, identity)
+    if err != nil {
+        return nil, err
+    }
+    if existing != nil && existing.MSPID != "" && existing.MSPID != callerMSP {
+        return nil, errUnauthorized("identity %s holds a grant of MSP %s", identity, existing.MSPID)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if expiresAt != "" {
+        expires, err := time.Parse(time.RFC3339, expiresAt)
+        if err != nil {
+            return nil, fmt.Errorf("invalid expiresAt %q: must be RFC3339", expiresAt)
+        }
+        if !expires.After(txTime) {
+            return nil, fmt.Errorf("expiresAt must be in the future")
+        }
+    }
+
+    grant := &RoleGrant{
+        Identity:      identity,
+        MSPID:         callerMSP,
+        Role:          role,
+        Department:    department,
+        ExpiresAt:     expiresAt,
+        GrantedBy:     callerID,
+        GrantedAt:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaRoleGrant),
+    }
+    if err := putSubRecord(ctx, roleGrantObjectType, []string{identity}, grant, EventRoleGranted); err != nil {
+        return nil, err
+    }
+    return grant, nil
+}
+
+// RevokeRole removes the grant of identity, so its certificate attributes apply again
+// - Caller must have role=admin in the MSP of the grant
+// - Admins cannot revoke their own grant
+func (rc *RoleAdminContract) RevokeRole(ctx contractapi.TransactionContextInterface, identity string) error {
+    if err := authorizeCallerRole(ctx, RoleAdmin); err != nil {
+        return fmt.Errorf("authorization failed: %v", err)
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if identity == callerID {
+        return fmt.Errorf("admins cannot change their own role grant")
+    }
+    grant, err := readRoleGrant(ctx, identity)
+    if err != nil {
+        return err
+    }
+    if grant == nil {
+        return errNotFound("identity %s has no role grant", identity)
+    }
+    callerMSP, err := ctx.GetClientIdentity().GetMSPID()
+    if err != nil {
+        return fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    if grant.MSPID != "" && grant.MSPID != callerMSP {
+        return errUnauthorized("the grant of %s belongs to MSP %s", identity, grant.MSPID)
+    }
+    key, err := makeKey(ctx, roleGrantObjectType, identity)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    if err := ctx.GetStub().DelState(key); err != nil {
+        return fmt.Errorf("failed to delete role grant: %v", err)
+    }
+    grant.Revoked = true
+    data, err := marshalState(grant)
+    if err != nil {
+        return fmt.Errorf("failed to marshal role grant: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventRoleRevoked, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// QueryRoleGrants returns all grants, including expired ones, sorted by identity
+// - Caller must have role=admin or role=auditor
+func (rc *RoleAdminContract) QueryRoleGrants(ctx contractapi.TransactionContextInterface) ([]*RoleGrant, error) {
+    if err := authorizeCallerRole(ctx, RoleAdmin, RoleAuditor); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(roleGrantObjectType, []string{})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query role grants: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*RoleGrant{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var grant RoleGrant
+        if err := decodeRecord(schemaRoleGrant, kv.Value, &grant); err != nil {
+            return nil, fmt.Errorf("failed to parse role grant: %v", err)
+        }
+        result = append(result, &grant)
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Identity < result[j].Identity })
+    return result, nil
+}
+
+// QueryMyRole returns the caller's effective role and department and where they come from
+func (rc *RoleAdminContract) QueryMyRole(ctx contractapi.TransactionContextInterface) (*EffectiveRole, error) {
+    ci, err := callerIdentity(ctx)
+    if err != nil {
+        return nil, err
+    }
+    effective, err := effectiveRole(ctx, ci)
+    if err != nil {
+        return nil, err
+    }
+    if effective.Department == "" {
+        if effective.Department, err = getCallerDepartment(ctx); err != nil {
+            return nil, err
+        }
+    }
+    return effective, nil
+}
+
+// EffectiveRole is the outcome of the role resolution for one caller
+type EffectiveRole struct {
+    Role       string `json:"Role"`
+    Department string `json:"Department,omitempty"`
+    Source     string `json:"Source"` // "grant" or "certificate"
+    ExpiresAt  string `json:"ExpiresAt,omitempty"`
+}
+
+// effectiveRole resolves the role of ci: an unexpired grant of its MSP first, then the
+// certificate attribute. Role is "" when neither is set. Grants written before grants
+// recorded their MSP have none and no longer apply; admins must grant them again.
+func effectiveRole(ctx contractapi.TransactionContextInterface, ci cid.ClientIdentity) (*EffectiveRole, error) {
+    id, err := ci.GetID()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    mspID, err := ci.GetMSPID()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller MSP ID: %v", err)
+    }
+    grant, err := readRoleGrant(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if grant != nil && grant.MSPID == mspID {
+        active := grant.ExpiresAt == ""
+        if !active {
+            expires, err := time.Parse(time.RFC3339, grant.ExpiresAt)
+            if err != nil {
+                return nil, fmt.Errorf("role grant has invalid ExpiresAt %q", grant.ExpiresAt)
+            }
+            txTime, err := txTimestamp(ctx)
+            if err != nil {
+                return nil, err
+            }
+            active = txTime.Before(expires)
+        }
+        if active {
+            return &EffectiveRole{Role: grant.Role, Department: grant.Department, Source: "grant", ExpiresAt: grant.ExpiresAt}, nil
+        }
+    }
+    role, _, err := ci.GetAttributeValue(RoleAttrName)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read attribute '%s': %v", RoleAttrName, err)
+    }
+    return &EffectiveRole{Role: role, Source: "certificate"}, nil
+}
+
+func readRoleGrant(ctx contractapi.TransactionContextInterface, identity string) (*RoleGrant, error) {
+    key, err := makeKey(ctx, roleGrantObjectType, identity)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read role grant: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var grant RoleGrant
+    if err := decodeRecord(schemaRoleGrant, data, &grant); err != nil {
+        return nil, fmt.Errorf("failed to parse role grant: %v", err)
+    }
+    return &grant, nil
+}
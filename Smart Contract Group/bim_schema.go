@@ -0,0 +1,139 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+// Soft schema migration for stored records.
+//
+// Every on-chain struct carries a SchemaVersion. Records are upgraded on read by
+// decodeRecord, which applies the registered migrations from the stored version to
+// the current one; the upgraded struct is written back in the new format the next
+// time the record is saved, so no bulk rewrite of the ledger is needed.
+//
+// To change a record's shape, append a migration to its kind in schemaMigrations.
+// Migrations work on the raw JSON object so they can read fields that no longer
+// exist in the Go struct.
+
+// Record kinds with versioned schemas
+const (
+    schemaBIMUpdate          = "BIMUpdate"
+    schemaBIMApproval        = "BIMApproval"
+    schemaApprovalPolicy     = "ApprovalPolicy"
+    schemaReviewerIdentity   = "ReviewerIdentity"
+    schemaBIMBlocker         = "BIMBlocker"
+    schemaBIMDeviation       = "BIMDeviation"
+    schemaBIMModel           = "BIMModel"
+    schemaBIMComment         = "BIMComment"
+    schemaBIMBaseline        = "BIMBaseline"
+    schemaBIMRollback        = "BIMRollback"
+    schemaBIMAccessLog       = "BIMAccessLog"
+    schemaReviewerAssignment = "ReviewerAssignment"
+    schemaBCFIssue           = "BCFIssue"
+    schemaNetworkConfig      = "NetworkConfig"
+    schemaBIMAppeal          = "BIMAppeal"
+    schemaComponentPackage   = "ComponentPackage"
+    schemaUpdateTags         = "UpdateTags"
+    schemaCertRevocationList = "CertRevocationList"
+    schemaStorageStats       = "StorageStats"
+    schemaValidationResult   = "ValidationResult"
+    schemaModelWatch         = "ModelWatch"
+    schemaRoleGrant          = "RoleGrant"
+    schemaResponsibility     = "ResponsibilityMatrix"
+    schemaModelLock          = "ModelLock"
+)
+
+// migration upgrades a raw record by one version
+type migration func(rec map[string]interface{}) error
+
+// schemaMigrations lists per kind the migrations from version 0 (records written
+// before SchemaVersion existed) upward; the current version is the list length.
+// A nil migration only bumps the version.
+var schemaMigrations = map[string][]migration{
+    schemaBIMUpdate:          {migrateSignaturePlaceholders("Signatures")},
+    schemaBIMApproval:        {migrateSignaturePlaceholders("Proof")},
+    schemaApprovalPolicy:     {nil},
+    schemaReviewerIdentity:   {nil},
+    schemaBIMBlocker:         {nil},
+    schemaBIMDeviation:       {nil},
+    schemaBIMModel:           {nil},
+    schemaBIMComment:         {nil},
+    schemaBIMBaseline:        {nil},
+    schemaBIMRollback:        {nil},
+    schemaBIMAccessLog:       {nil},
+    schemaReviewerAssignment: {nil},
+    schemaBCFIssue:           {nil},
+    schemaNetworkConfig:      {nil},
+    schemaBIMAppeal:          {nil},
+    schemaComponentPackage:   {nil},
+    schemaUpdateTags:         {nil},
+    schemaCertRevocationList: {nil},
+    schemaStorageStats:       {nil},
+    schemaValidationResult:   {nil},
+    schemaModelWatch:         {nil},
+    schemaRoleGrant:          {nil, nil}, // v2 adds MSPID
+    schemaResponsibility:     {nil},
+    schemaModelLock:          {nil},
+}
+
+// schemaVersion returns the current schema version of a record kind
+func schemaVersion(kind string) int {
+    return len(schemaMigrations[kind])
+}
+
+// decodeRecord unmarshals a stored record of the given kind into out, upgrading it
+// to the current schema version first when it was written by an older chaincode
+func decodeRecord(kind string, data []byte, out interface{}) error {
+    current := schemaVersion(kind)
+
+    var header struct {
+        SchemaVersion int `json:"SchemaVersion"`
+    }
+    if err := json.Unmarshal(data, &header); err != nil {
+        return err
+    }
+    if header.SchemaVersion == current {
+        return json.Unmarshal(data, out)
+    }
+    if header.SchemaVersion > current {
+        return fmt.Errorf("%s record has schema version %d, this chaincode supports up to %d", kind, header.SchemaVersion, current)
+    }
+
+    var rec map[string]interface{}
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return err
+    }
+    for v := header.SchemaVersion; v < current; v++ {
+        if m := schemaMigrations[kind][v]; m != nil {
+            if err := m(rec); err != nil {
+                return fmt.Errorf("failed to migrate %s record from schema version %d: %v", kind, v, err)
+            }
+        }
+    }
+    rec["SchemaVersion"] = current
+
+    upgraded, err := json.Marshal(rec)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(upgraded, out)
+}
+
+// migrateSignaturePlaceholders converts the "sig:<txid>" strings of the original
+// chaincode into ProposalSignature objects that only carry the TxID
+func migrateSignaturePlaceholders(field string) migration {
+    return func(rec map[string]interface{}) error {
+        sigs, ok := rec[field].(map[string]interface{})
+        if !ok {
+            return nil
+        }
+        for id, v := range sigs {
+            if s, ok := v.(string); ok {
+                sigs[id] = map[string]interface{}{"TxID": strings.TrimPrefix(s, "sig:")}
+            }
+        }
+        return nil
+    }
+}
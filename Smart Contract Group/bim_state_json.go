@@ -0,0 +1,27 @@
+package chaincode
+
+import (
+    "bytes"
+    "encoding/json"
+)
+
+// marshalState is the single encoder for everything written to world state or
+// emitted as an event, so that every endorsing peer produces byte-identical write sets.
+//
+// Map keys (Signatures, Proof) are written in sorted order and struct fields in
+// declaration order, independent of map iteration. HTML escaping is disabled so
+// that free text such as descriptions and comments containing < > & is stored as
+// submitted rather than as \u003c sequences.
+//
+// The encoding alone does not make the values agree: timestamps stored in records
+// must come from txTimestamp, never from the peer's clock.
+func marshalState(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := json.NewEncoder(&buf)
+    enc.SetEscapeHTML(false)
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+    // Encode terminates the value with a newline that json.Marshal does not add
+    return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,157 @@
+package chaincode
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Storage accounting. Every new update adds the sizes of its Files and Attachments to
+// a stats record of its model. The mapping suite routes each project to its own
+// channel, so the sum over all models of the channel is the project's consumption,
+// which ConfigContract.SetStorageQuota can cap.
+//
+// Project totals are summed at read time instead of kept in one counter record, which
+// would make every pair of concurrent submissions collide. With a quota set, InitBIMUpdate
+// reads all model stats and therefore still conflicts with concurrent submissions.
+
+// StorageStats is the anchored file volume of one model, or of the whole project when
+// ModelID is empty. Updates submitted before storage accounting existed are not counted.
+type StorageStats struct {
+    ModelID      string `json:"ModelID,omitempty"`
+    Updates      int    `json:"Updates"`
+    Files        int    `json:"Files"`
+    Bytes        int64  `json:"Bytes"`
+    LastUpdateID string `json:"LastUpdateID,omitempty"`
+    UpdatedAt    string `json:"UpdatedAt,omitempty"`
+
+    // project totals only
+    Models     int   `json:"Models,omitempty"`
+    QuotaBytes int64 `json:"QuotaBytes,omitempty"` // 0 when no quota is set
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// QueryStorageStats returns the storage used by a model, or by the whole project when modelID is empty
+func (qc *QueryContract) QueryStorageStats(ctx contractapi.TransactionContextInterface, modelID string) (*StorageStats, error) {
+    if modelID != "" {
+        return modelStorageStats(ctx, modelID)
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return nil, err
+    }
+    stats, err := projectStorageStats(ctx)
+    if err != nil {
+        return nil, err
+    }
+    stats.QuotaBytes = cfg.StorageQuotaBytes
+    return stats, nil
+}
+
+// anchoredSize returns the number and total declared size of the files an update references
+func anchoredSize(update *BIMUpdate) (int, int64) {
+    var bytes int64
+    for _, f := range update.Files {
+        bytes += f.Size
+    }
+    for _, att := range update.Attachments {
+        bytes += att.Size
+    }
+    return len(update.Files) + len(update.Attachments), bytes
+}
+
+// recordStorage adds a new update's files to its model's stats, rejecting the update
+// when it would take the project over the network's storage quota
+func recordStorage(ctx contractapi.TransactionContextInterface, update *BIMUpdate, cfg *NetworkConfig) error {
+    files, bytes := anchoredSize(update)
+    if cfg.StorageQuotaBytes > 0 && bytes > 0 {
+        project, err := projectStorageStats(ctx)
+        if err != nil {
+            return err
+        }
+        if project.Bytes+bytes > cfg.StorageQuotaBytes {
+            return fmt.Errorf("update adds %d bytes, project storage quota of %d bytes has %d bytes left",
+                bytes, cfg.StorageQuotaBytes, cfg.StorageQuotaBytes-project.Bytes)
+        }
+    }
+
+    stats, err := modelStorageStats(ctx, update.ModelID)
+    if err != nil {
+        return err
+    }
+    stats.Updates++
+    stats.Files += files
+    stats.Bytes += bytes
+    stats.LastUpdateID = update.UpdateID
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return err
+    }
+    stats.UpdatedAt = txTime.Format(time.RFC3339)
+    stats.SchemaVersion = schemaVersion(schemaStorageStats)
+
+    key, err := makeKey(ctx, storageStatsObjectType, update.ModelID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := marshalState(stats)
+    if err != nil {
+        return fmt.Errorf("failed to marshal storage stats: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return fmt.Errorf("failed to save storage stats: %v", err)
+    }
+    return nil
+}
+
+// modelStorageStats loads the stats of a model, returning empty stats if none are stored
+func modelStorageStats(ctx contractapi.TransactionContextInterface, modelID string) (*StorageStats, error) {
+    key, err := makeKey(ctx, storageStatsObjectType, modelID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read storage stats: %v", err)
+    }
+    stats := &StorageStats{ModelID: modelID, SchemaVersion: schemaVersion(schemaStorageStats)}
+    if data == nil {
+        return stats, nil
+    }
+    if err := decodeRecord(schemaStorageStats, data, stats); err != nil {
+        return nil, fmt.Errorf("failed to parse storage stats: %v", err)
+    }
+    return stats, nil
+}
+
+// projectStorageStats sums the stats of all models
+func projectStorageStats(ctx contractapi.TransactionContextInterface) (*StorageStats, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(storageStatsObjectType, []string{})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query storage stats: %v", err)
+    }
+    defer iterator.Close()
+
+    total := &StorageStats{SchemaVersion: schemaVersion(schemaStorageStats)}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var stats StorageStats
+        if err := decodeRecord(schemaStorageStats, kv.Value, &stats); err != nil {
+            return nil, fmt.Errorf("failed to parse storage stats: %v", err)
+        }
+        total.Models++
+        total.Updates += stats.Updates
+        total.Files += stats.Files
+        total.Bytes += stats.Bytes
+        if stats.UpdatedAt > total.UpdatedAt {
+            total.UpdatedAt = stats.UpdatedAt
+            total.LastUpdateID = stats.LastUpdateID
+        }
+    }
+    return total, nil
+}
@@ -0,0 +1,209 @@
+package chaincode
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TagContract labels updates with free-form tags such as milestones ("50% DD", "As-Built")
+// or deliverables ("IFC2x3 export"), so related updates can be found across models
+type TagContract struct {
+    contractapi.Contract
+}
+
+// UpdateTags holds the tags of one update
+type UpdateTags struct {
+    UpdateID string     `json:"UpdateID"`
+    ModelID  string     `json:"ModelID"`
+    Tags     []TagEntry `json:"Tags"` // in the order they were added
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// TagEntry is one tag with who added it
+type TagEntry struct {
+    Tag     string `json:"Tag"`
+    AddedBy string `json:"AddedBy"`
+    AddedAt string `json:"AddedAt"`
+}
+
+const (
+    EventUpdateTagged = "BIMUpdateTagged"
+
+    maxTagLength     = 64
+    maxTagsPerUpdate = 32
+)
+
+// AddTags adds tags to an update; tags already present (ignoring case) are skipped
+// - Caller must be the initiator of the update, have role=bim_lead, or own the model
+// - A tag is 1-64 characters after trimming; inner whitespace is collapsed to single spaces
+func (tc *TagContract) AddTags(ctx contractapi.TransactionContextInterface, updateID string, tags []string) (*UpdateTags, error) {
+    if len(tags) == 0 {
+        return nil, fmt.Errorf("tags required")
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    if callerID != update.Initiator {
+        if err := authorizeAssigner(ctx, update.ModelID); err != nil {
+            return nil, fmt.Errorf("authorization failed: %v", err)
+        }
+    }
+
+    record, err := readUpdateTags(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if record == nil {
+        record = &UpdateTags{UpdateID: updateID, ModelID: update.ModelID, Tags: []TagEntry{}}
+    }
+    present := map[string]bool{}
+    for _, t := range record.Tags {
+        present[foldTag(t.Tag)] = true
+    }
+
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    now := txTime.Format(time.RFC3339)
+    for i, raw := range tags {
+        tag, err := normalizeTag(raw)
+        if err != nil {
+            return nil, fmt.Errorf("tags[%d]: %v", i, err)
+        }
+        folded := foldTag(tag)
+        if present[folded] {
+            continue
+        }
+        present[folded] = true
+        record.Tags = append(record.Tags, TagEntry{Tag: tag, AddedBy: callerID, AddedAt: now})
+        if err := putIndexEntry(ctx, tagIndexObjectType, folded, updateID); err != nil {
+            return nil, err
+        }
+    }
+    if len(record.Tags) > maxTagsPerUpdate {
+        return nil, fmt.Errorf("too many tags: %d (max %d)", len(record.Tags), maxTagsPerUpdate)
+    }
+
+    record.SchemaVersion = schemaVersion(schemaUpdateTags)
+    if err := putSubRecord(ctx, updateTagsObjectType, []string{updateID}, record, EventUpdateTagged); err != nil {
+        return nil, err
+    }
+    return record, nil
+}
+
+// QueryTags returns the tags of an update (empty when it has none)
+func (tc *TagContract) QueryTags(ctx contractapi.TransactionContextInterface, updateID string) (*UpdateTags, error) {
+    if updateID == "" {
+        return nil, fmt.Errorf("updateID required")
+    }
+    record, err := readUpdateTags(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if record == nil {
+        return &UpdateTags{UpdateID: updateID, Tags: []TagEntry{}}, nil
+    }
+    return record, nil
+}
+
+// QueryUpdatesByTag lists the updates carrying tag across all models, ignoring case
+// Results are paginated; pass the returned Bookmark to fetch the next page
+// - Only updates within the caller's organization scope are listed, see callerScope
+func (tc *TagContract) QueryUpdatesByTag(ctx contractapi.TransactionContextInterface, tag string, pageSize int32, bookmark string) (*HistoryPage, error) {
+    tag, err := normalizeTag(tag)
+    if err != nil {
+        return nil, err
+    }
+    if pageSize <= 0 {
+        return nil, fmt.Errorf("pageSize must be positive")
+    }
+    scope, err := callerScope(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    iterator, meta, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(tagIndexObjectType, []string{foldTag(tag)}, pageSize, bookmark)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query tag index: %v", err)
+    }
+    defer iterator.Close()
+
+    page := &HistoryPage{Records: []*BIMHistoryRecord{}}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, tagIndexObjectType)
+        if err != nil {
+            continue
+        }
+        update, err := updates.GetUpdate(ctx, attrs[1])
+        if err != nil {
+            return nil, err
+        }
+        rec, err := scope.record(ctx, update)
+        if err != nil {
+            return nil, err
+        }
+        if rec != nil {
+            page.Records = append(page.Records, rec)
+        }
+    }
+
+    if meta != nil {
+        page.FetchedCount = meta.FetchedRecordsCount
+        page.Bookmark = meta.Bookmark
+    }
+    return page, nil
+}
+
+// normalizeTag trims a tag and collapses inner whitespace
+func normalizeTag(raw string) (string, error) {
+    tag := strings.Join(strings.Fields(raw), " ")
+    if tag == "" {
+        return "", fmt.Errorf("tag must not be empty")
+    }
+    if !utf8.ValidString(tag) {
+        return "", fmt.Errorf("tag must be valid UTF-8")
+    }
+    if utf8.RuneCountInString(tag) > maxTagLength {
+        return "", fmt.Errorf("tag %q longer than %d characters", tag, maxTagLength)
+    }
+    return tag, nil
+}
+
+// foldTag is the case-insensitive form used in the tag index
+func foldTag(tag string) string {
+    return strings.ToLower(tag)
+}
+
+func readUpdateTags(ctx contractapi.TransactionContextInterface, updateID string) (*UpdateTags, error) {
+    key, err := makeKey(ctx, updateTagsObjectType, updateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read tags: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var record UpdateTags
+    if err := decodeRecord(schemaUpdateTags, data, &record); err != nil {
+        return nil, fmt.Errorf("failed to parse tags: %v", err)
+    }
+    return &record, nil
+}
@@ -0,0 +1,78 @@
+package chaincode
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "math/big"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Server-side UpdateID generation, used when the client leaves UpdateID empty.
+//
+// The network config's UpdateIDStrategy (ConfigContract.SetUpdateIDStrategy) selects
+// the format:
+//
+//	ulid  (default) 26-character ULID; sorts by creation time
+//	txid  the 64-character transaction ID
+//	none  clients must always supply UpdateID
+//
+// The strategy is read from the ledger in each transaction, and both generated formats
+// only depend on the transaction ID and timestamp, so every endorsing peer derives the
+// same ID.
+
+const (
+    UpdateIDStrategyULID = "ulid"
+    UpdateIDStrategyTxID = "txid"
+    UpdateIDStrategyNone = "none"
+)
+
+// validUpdateIDStrategy reports whether s is one of the UpdateIDStrategy* values
+func validUpdateIDStrategy(s string) bool {
+    return s == UpdateIDStrategyULID || s == UpdateIDStrategyTxID || s == UpdateIDStrategyNone
+}
+
+// newUpdateID derives an UpdateID for the current transaction, or returns "" when
+// generation is disabled
+func newUpdateID(ctx contractapi.TransactionContextInterface) (string, error) {
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return "", err
+    }
+    txID := ctx.GetStub().GetTxID()
+    switch cfg.UpdateIDStrategy {
+    case UpdateIDStrategyNone:
+        return "", nil
+    case UpdateIDStrategyTxID:
+        return txID, nil
+    }
+    ts, err := ctx.GetStub().GetTxTimestamp()
+    if err != nil {
+        return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+    }
+    ms := ts.GetSeconds()*1000 + int64(ts.GetNanos())/1e6
+    return ulid(uint64(ms), txID), nil
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulid encodes a 48-bit millisecond timestamp followed by 80 bits taken from
+// sha256(seed) in place of random entropy
+func ulid(ms uint64, seed string) string {
+    var raw [16]byte
+    for i := 0; i < 6; i++ {
+        raw[i] = byte(ms >> (40 - 8*i))
+    }
+    sum := sha256.Sum256([]byte(seed))
+    copy(raw[6:], sum[:10])
+
+    n := new(big.Int).SetBytes(raw[:])
+    mask := big.NewInt(31)
+    out := make([]byte, 26)
+    for i := len(out) - 1; i >= 0; i-- {
+        out[i] = crockford[new(big.Int).And(n, mask).Int64()]
+        n.Rsh(n, 5)
+    }
+    return string(out)
+}
@@ -0,0 +1,360 @@
+package chaincode
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// UpdateStatus is the interface other contracts use to read BIMUpdate records
+// and move them through their lifecycle. The init contract owns the records;
+// approval and query contracts must not read or rewrite the stored blobs directly.
+type UpdateStatus interface {
+    // GetUpdate loads the BIMUpdate stored under updateID
+    GetUpdate(ctx contractapi.TransactionContextInterface, updateID string) (*BIMUpdate, error)
+    // SetStatus changes the status of an existing update and returns the stored record
+    SetStatus(ctx contractapi.TransactionContextInterface, updateID string, status string) (*BIMUpdate, error)
+}
+
+// maxUpdateRecordBytes is the default cap on the serialized size of a new BIMUpdate record,
+// used until ConfigContract.SetMaxUpdateRecordBytes stores one on the ledger. Only the
+// ledger may override it, so that every peer applies the same limit.
+const maxUpdateRecordBytes = 32 << 10
+
+// updates is the shared storage layer used by every contract in this chaincode
+var updates UpdateStatus = updateStore{}
+
+// updateStore serializes BIMUpdate records in one place so every contract
+// reads and writes the same representation.
+type updateStore struct{}
+
+// GetUpdate loads the BIMUpdate stored under updateID
+func (s updateStore) GetUpdate(ctx contractapi.TransactionContextInterface, updateID string) (*BIMUpdate, error) {
+    data, err := s.read(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if data == nil {
+        return nil, errNotFound("the update %s does not exist", updateID)
+    }
+    var update BIMUpdate
+    if err := decodeRecord(schemaBIMUpdate, data, &update); err != nil {
+        return nil, fmt.Errorf("failed to parse update %s: %v", updateID, err)
+    }
+    return &update, nil
+}
+
+// SetStatus changes the status of an existing update and returns the stored record
+func (s updateStore) SetStatus(ctx contractapi.TransactionContextInterface, updateID string, status string) (*BIMUpdate, error) {
+    update, err := s.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    previous := update.Status
+    update.Status = status
+    if _, err := s.put(ctx, update); err != nil {
+        return nil, err
+    }
+    if err := setStatusIndex(ctx, updateID, previous, status); err != nil {
+        return nil, err
+    }
+    if err := setOpenIndex(ctx, update, previous); err != nil {
+        return nil, err
+    }
+    // an update leaving review releases the updates queued behind it
+    if isOpenStatus(previous) && !isOpenStatus(status) {
+        queued, err := queuedBehind(ctx, updateID)
+        if err != nil {
+            return nil, err
+        }
+        for _, id := range queued {
+            if _, err := s.SetStatus(ctx, id, StatusInitialized); err != nil {
+                return nil, fmt.Errorf("failed to release queued update %s: %v", id, err)
+            }
+        }
+    }
+    return update, nil
+}
+
+// create stores a new update and adds it to the status, open update, initiator, model, time, resubmission,
+// client request, payload nonce, external reference and attachment / file content hash indexes.
+// Records larger than the network's MaxUpdateRecordBytes, and updates exceeding the project
+// storage quota, are rejected; the model's storage stats are updated (see bim_storage_stats.go).
+func (s updateStore) create(ctx contractapi.TransactionContextInterface, update *BIMUpdate) ([]byte, error) {
+    data, err := marshalState(update)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal BIMUpdate: %v", err)
+    }
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return nil, err
+    }
+    if len(data) > cfg.MaxUpdateRecordBytes {
+        return nil, fmt.Errorf("update record is %d bytes, exceeds the limit of %d; move large payloads to Attachments", len(data), cfg.MaxUpdateRecordBytes)
+    }
+    if err := recordStorage(ctx, update, cfg); err != nil {
+        return nil, err
+    }
+    data, err = s.put(ctx, update)
+    if err != nil {
+        return nil, err
+    }
+    if err := setStatusIndex(ctx, update.UpdateID, "", update.Status); err != nil {
+        return nil, err
+    }
+    if err := setOpenIndex(ctx, update, ""); err != nil {
+        return nil, err
+    }
+    if err := putIndexEntry(ctx, initiatorIndexObjectType, update.Initiator, update.UpdateID); err != nil {
+        return nil, err
+    }
+    if err := putIndexEntry(ctx, modelIndexObjectType, update.ModelID, update.UpdateID); err != nil {
+        return nil, err
+    }
+    if err := putTimeIndexEntry(ctx, update); err != nil {
+        return nil, err
+    }
+    if update.PreviousUpdateID != "" {
+        if err := putIndexEntry(ctx, resubmissionObjectType, update.PreviousUpdateID, update.UpdateID); err != nil {
+            return nil, err
+        }
+    }
+    for _, att := range update.Attachments {
+        if err := putIndexEntry(ctx, contentHashObjectType, strings.ToLower(att.SHA256), update.UpdateID); err != nil {
+            return nil, err
+        }
+    }
+    for _, f := range update.Files {
+        if f.HashAlgorithm != "" && f.HashAlgorithm != "sha256" {
+            continue
+        }
+        if err := putIndexEntry(ctx, contentHashObjectType, strings.ToLower(f.Hash), update.UpdateID); err != nil {
+            return nil, err
+        }
+    }
+    for _, ref := range update.ExternalRefs {
+        if err := putIndexEntry(ctx, externalRefObjectType, ref.System, ref.ID, update.UpdateID); err != nil {
+            return nil, err
+        }
+    }
+    if err := recordPayloadNonce(ctx, update); err != nil {
+        return nil, err
+    }
+    if update.ClientRequestID != "" {
+        key, err := makeKey(ctx, clientRequestObjectType, update.Initiator, update.ClientRequestID)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create %s key: %v", clientRequestObjectType, err)
+        }
+        if err := ctx.GetStub().PutState(key, []byte(update.UpdateID)); err != nil {
+            return nil, fmt.Errorf("failed to write %s entry: %v", clientRequestObjectType, err)
+        }
+    }
+    return data, nil
+}
+
+// forClientRequest returns the UpdateID created for clientRequestID by initiator, or "" if none
+func (updateStore) forClientRequest(ctx contractapi.TransactionContextInterface, initiator string, clientRequestID string) (string, error) {
+    key, err := makeKey(ctx, clientRequestObjectType, initiator, clientRequestID)
+    if err != nil {
+        return "", fmt.Errorf("failed to create %s key: %v", clientRequestObjectType, err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return "", fmt.Errorf("failed to read %s entry: %v", clientRequestObjectType, err)
+    }
+    return string(data), nil
+}
+
+// exists reports whether a BIMUpdate is stored under updateID
+func (s updateStore) exists(ctx contractapi.TransactionContextInterface, updateID string) (bool, error) {
+    b, err := s.read(ctx, updateID)
+    if err != nil {
+        return false, err
+    }
+    return b != nil, nil
+}
+
+// listIDs returns the IDs of all stored updates, those under their composite key first,
+// then those still under a legacy plain key
+func (updateStore) listIDs(ctx contractapi.TransactionContextInterface) ([]string, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(updateObjectType, []string{})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query updates: %v", err)
+    }
+    defer iterator.Close()
+
+    ids := []string{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, updateObjectType)
+        if err != nil {
+            continue
+        }
+        ids = append(ids, attrs[0])
+    }
+
+    legacy, err := ctx.GetStub().GetStateByRange("", "")
+    if err != nil {
+        return nil, fmt.Errorf("failed to scan legacy update keys: %v", err)
+    }
+    defer legacy.Close()
+    for legacy.HasNext() {
+        kv, err := legacy.Next()
+        if err != nil {
+            return nil, err
+        }
+        if !isCompositeKey(kv.Key) {
+            ids = append(ids, kv.Key)
+        }
+    }
+    return ids, nil
+}
+
+// read returns the stored bytes of an update, or nil if there is none. Updates not yet
+// moved to their composite key are read from the legacy plain key (see bim_keys.go).
+func (updateStore) read(ctx contractapi.TransactionContextInterface, updateID string) ([]byte, error) {
+    key, err := updateKey(ctx, updateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read from world state: %v", err)
+    }
+    if data != nil {
+        return data, nil
+    }
+    data, err = ctx.GetStub().GetState(updateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read from world state: %v", err)
+    }
+    return data, nil
+}
+
+// put writes the update to world state under its composite key and returns the
+// serialized bytes; a copy under the legacy plain key is removed
+func (updateStore) put(ctx contractapi.TransactionContextInterface, update *BIMUpdate) ([]byte, error) {
+    data, err := marshalState(update)
+    if err != nil {
+        return nil, fmt.Errorf("failed to marshal BIMUpdate: %v", err)
+    }
+    key, err := updateKey(ctx, update.UpdateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    if err := ctx.GetStub().PutState(key, data); err != nil {
+        return nil, fmt.Errorf("failed to put BIMUpdate to world state: %v", err)
+    }
+    legacy, err := ctx.GetStub().GetState(update.UpdateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read from world state: %v", err)
+    }
+    if legacy != nil {
+        if err := ctx.GetStub().DelState(update.UpdateID); err != nil {
+            return nil, fmt.Errorf("failed to delete legacy key of update %s: %v", update.UpdateID, err)
+        }
+    }
+    return data, nil
+}
+
+// setStatusIndex moves updateID from the previous status index entry to the new one
+func setStatusIndex(ctx contractapi.TransactionContextInterface, updateID string, previous string, status string) error {
+    if previous == status {
+        return nil
+    }
+    if previous != "" {
+        if err := delIndexEntry(ctx, statusIndexObjectType, previous, updateID); err != nil {
+            return err
+        }
+    }
+    return putIndexEntry(ctx, statusIndexObjectType, status, updateID)
+}
+
+// putTimeIndexEntry indexes the update by creation time, bucketed by month so that
+// range queries only scan the months overlapping the requested window
+func putTimeIndexEntry(ctx contractapi.TransactionContextInterface, update *BIMUpdate) error {
+    ts, err := time.Parse(time.RFC3339, update.Timestamp)
+    if err != nil {
+        return fmt.Errorf("invalid Timestamp %q: %v", update.Timestamp, err)
+    }
+    ts = ts.UTC()
+    return putIndexEntry(ctx, timeIndexObjectType, ts.Format(timeIndexBucketLayout), ts.Format(time.RFC3339), update.UpdateID)
+}
+
+// timeIndexBucketLayout is the month bucket used as the first time index attribute
+const timeIndexBucketLayout = "2006-01"
+
+// putIndexEntry writes an (objectType, attrs...) index key with an empty-marker value
+func putIndexEntry(ctx contractapi.TransactionContextInterface, objectType string, attrs ...string) error {
+    key, err := makeKey(ctx, objectType, attrs...)
+    if err != nil {
+        return fmt.Errorf("failed to create %s key: %v", objectType, err)
+    }
+    if err := ctx.GetStub().PutState(key, []byte{0x00}); err != nil {
+        return fmt.Errorf("failed to write %s entry: %v", objectType, err)
+    }
+    return nil
+}
+
+// delIndexEntry removes an (objectType, attrs...) index key
+func delIndexEntry(ctx contractapi.TransactionContextInterface, objectType string, attrs ...string) error {
+    key, err := makeKey(ctx, objectType, attrs...)
+    if err != nil {
+        return fmt.Errorf("failed to create %s key: %v", objectType, err)
+    }
+    if err := ctx.GetStub().DelState(key); err != nil {
+        return fmt.Errorf("failed to delete %s entry: %v", objectType, err)
+    }
+    return nil
+}
+
+// updatesWithContent returns the IDs of updates carrying an attachment with the given SHA-256
+func updatesWithContent(ctx contractapi.TransactionContextInterface, sha256Hex string) ([]string, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(contentHashObjectType, []string{strings.ToLower(sha256Hex)})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query content hash index: %v", err)
+    }
+    defer iterator.Close()
+
+    var ids []string
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, contentHashObjectType)
+        if err != nil {
+            continue
+        }
+        ids = append(ids, attrs[1])
+    }
+    return ids, nil
+}
+
+// resubmissionsOf returns the IDs of updates created by resubmitting previousUpdateID
+func resubmissionsOf(ctx contractapi.TransactionContextInterface, previousUpdateID string) ([]string, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(resubmissionObjectType, []string{previousUpdateID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query resubmission index: %v", err)
+    }
+    defer iterator.Close()
+
+    var ids []string
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, resubmissionObjectType)
+        if err != nil {
+            continue
+        }
+        ids = append(ids, attrs[1])
+    }
+    return ids, nil
+}
@@ -0,0 +1,168 @@
+package chaincode
+
+import (
+    "fmt"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Declarative input validation for on-chain records.
+//
+// String fields carry a `validate` tag with comma-separated rules:
+//
+//	required     value must not be empty
+//	max=N        at most N characters; client-encrypted values ("enc:v1:...") may be as long
+//	             as the ciphertext of N characters of UTF-8 text
+//	id           only letters, digits and . _ : - (no spaces or separators used in keys)
+//	version      version label such as 1.2, v1.2.3, R03 or 2.0-rc1
+//	oneof=A|B    value must be one of the listed options (empty allowed unless required)
+//	cid          IPFS content identifier (CIDv0 "Qm..." or base32 CIDv1 "b...")
+//	sha256       64 hex characters
+//	hex          hex characters only
+//
+// Slice-of-struct fields tagged `validate:"dive"` have each element validated, with
+// errors reported as Field[i].Name; non-nil struct pointers tagged `dive` report Field.Name.
+//
+// validateStruct checks every field and returns all problems at once as ValidationErrors.
+
+// FieldError describes a problem with a single input field
+type FieldError struct {
+    Field   string `json:"Field"`
+    Message string `json:"Message"`
+}
+
+// ValidationErrors aggregates all field-level problems of one input
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+    parts := make([]string, 0, len(v))
+    for _, fe := range v {
+        parts = append(parts, fe.Field+": "+fe.Message)
+    }
+    return "validation failed: " + strings.Join(parts, "; ")
+}
+
+var (
+    idPattern      = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+    versionPattern = regexp.MustCompile(`^[A-Za-z]{0,3}[0-9]+(\.[0-9]+){0,3}([-+][A-Za-z0-9.]+)?$`)
+    cidPattern     = regexp.MustCompile(`^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{50,})$`)
+    sha256Pattern  = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+    hexPattern     = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+)
+
+// sealedValuePrefix marks a field value encrypted client-side with a project data key:
+// enc:v1:<16 hex key ID>:<base64url(12-byte nonce || ciphertext || 16-byte tag)>
+const sealedValuePrefix = "enc:v1:"
+
+// sealedMaxLen is the length of the encrypted form of n characters of at most 4 UTF-8 bytes each
+func sealedMaxLen(n int) int {
+    raw := 12 + 4*n + 16
+    return len(sealedValuePrefix) + 16 + 1 + (raw*4+2)/3
+}
+
+// validateStruct validates the tagged fields of the struct pointed to by v
+func validateStruct(v interface{}) error {
+    rv := reflect.Indirect(reflect.ValueOf(v))
+    if rv.Kind() != reflect.Struct {
+        return fmt.Errorf("validateStruct: expected struct, got %s", rv.Kind())
+    }
+    errs := validateFields(rv, "")
+    if len(errs) > 0 {
+        return errs
+    }
+    return nil
+}
+
+// validateFields checks the tagged fields of struct value rv, prefixing field names with prefix
+func validateFields(rv reflect.Value, prefix string) ValidationErrors {
+    rt := rv.Type()
+    var errs ValidationErrors
+    for i := 0; i < rt.NumField(); i++ {
+        field := rt.Field(i)
+        tag := field.Tag.Get("validate")
+        if tag == "" {
+            continue
+        }
+        switch {
+        case field.Type.Kind() == reflect.String:
+            for _, msg := range checkRules(rv.Field(i).String(), tag) {
+                errs = append(errs, FieldError{Field: prefix + field.Name, Message: msg})
+            }
+        case tag == "dive" && field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+            items := rv.Field(i)
+            for j := 0; j < items.Len(); j++ {
+                errs = append(errs, validateFields(items.Index(j), fmt.Sprintf("%s%s[%d].", prefix, field.Name, j))...)
+            }
+        case tag == "dive" && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct:
+            if !rv.Field(i).IsNil() {
+                errs = append(errs, validateFields(rv.Field(i).Elem(), prefix+field.Name+".")...)
+            }
+        }
+    }
+    return errs
+}
+
+// checkRules applies the rules of one tag to value and returns the failure messages
+func checkRules(value string, tag string) []string {
+    var msgs []string
+    for _, rule := range strings.Split(tag, ",") {
+        name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+        if value == "" {
+            if name == "required" {
+                return []string{"is required"}
+            }
+            continue
+        }
+        switch name {
+        case "required":
+        case "max":
+            n, err := strconv.Atoi(arg)
+            if err != nil {
+                break
+            }
+            if strings.HasPrefix(value, sealedValuePrefix) {
+                if len(value) > sealedMaxLen(n) {
+                    msgs = append(msgs, fmt.Sprintf("encrypted value must hold at most %d characters", n))
+                }
+            } else if utf8.RuneCountInString(value) > n {
+                msgs = append(msgs, fmt.Sprintf("must be at most %d characters", n))
+            }
+        case "id":
+            if !idPattern.MatchString(value) {
+                msgs = append(msgs, "may only contain letters, digits and . _ : -")
+            }
+        case "version":
+            if !versionPattern.MatchString(value) {
+                msgs = append(msgs, "must be a version label such as 1.2, v1.2.3 or R03")
+            }
+        case "cid":
+            if !cidPattern.MatchString(value) {
+                msgs = append(msgs, "must be an IPFS CID")
+            }
+        case "sha256":
+            if !sha256Pattern.MatchString(value) {
+                msgs = append(msgs, "must be a hex SHA-256 digest")
+            }
+        case "hex":
+            if !hexPattern.MatchString(value) {
+                msgs = append(msgs, "must be hex encoded")
+            }
+        case "oneof":
+            options := strings.Split(arg, "|")
+            found := false
+            for _, o := range options {
+                if value == o {
+                    found = true
+                    break
+                }
+            }
+            if !found {
+                msgs = append(msgs, "must be one of "+strings.Join(options, ", "))
+            }
+        }
+    }
+    return msgs
+}
@@ -0,0 +1,184 @@
+package chaincode
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Automated validation phase. With ConfigContract.SetValidationRequired(true), new
+// updates are stored as PENDING_VALIDATION and the BIMUpdateInitialized event tells
+// validation services (model checkers, IFC validators) to fetch the files. A service
+// identity with role=validator then records its results with RecordValidationResult,
+// which moves the update to INITIALIZED, ready for review, or to VALIDATION_FAILED.
+// Updates cannot be approved while they are pending validation.
+const (
+    StatusPendingValidation = "PENDING_VALIDATION"
+    StatusValidationFailed  = "VALIDATION_FAILED"
+
+    RoleValidator = "validator"
+
+    EventValidationRecorded = "BIMValidationRecorded"
+
+    maxValidationChecks = 64
+)
+
+// Outcomes of a ValidationCheck; any FAIL fails the validation
+const (
+    CheckPass = "PASS"
+    CheckWarn = "WARN"
+    CheckFail = "FAIL"
+)
+
+// ValidationResult is the outcome of the automated checks run on an update
+type ValidationResult struct {
+    UpdateID     string            `json:"UpdateID"`
+    Checks       []ValidationCheck `json:"Checks" validate:"dive"`
+    Passed       bool              `json:"Passed"`
+    Validator    string            `json:"Validator"`
+    ValidatorMSP string            `json:"ValidatorMSP"`
+    Timestamp    string            `json:"Timestamp"`
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+// ValidationCheck is the result of one tool, e.g. an IFC schema validator or a model checker rule set
+type ValidationCheck struct {
+    Tool        string `json:"Tool" validate:"required,max=128"`
+    ToolVersion string `json:"ToolVersion,omitempty" validate:"max=64"`
+    Outcome     string `json:"Outcome" validate:"required,oneof=PASS|WARN|FAIL"`
+    Issues      int    `json:"Issues,omitempty"`
+    Summary     string `json:"Summary,omitempty" validate:"max=1024"`
+
+    // full report kept off-chain
+    ReportCID    string `json:"ReportCID,omitempty" validate:"cid"`
+    ReportSHA256 string `json:"ReportSHA256,omitempty" validate:"sha256"`
+}
+
+// RecordValidationResult attaches automated check results to an update pending validation
+// - Caller must have role=validator
+// - checksJSON is a JSON array of ValidationCheck; the update fails validation if any check FAILs
+// - a passed update becomes INITIALIZED, or QUEUED while the update it waits for is under review
+// - a failed update becomes VALIDATION_FAILED and may be resubmitted
+func (s *SmartContract) RecordValidationResult(ctx contractapi.TransactionContextInterface, updateID string, checksJSON string) (result *ValidationResult, err error) {
+    log := txLogger(ctx).With("updateID", updateID)
+    defer func() { logOutcome(log, err) }()
+
+    if err := authorizeCallerRole(ctx, RoleValidator); err != nil {
+        return nil, fmt.Errorf("authorization failed: %v", err)
+    }
+    update, err := updates.GetUpdate(ctx, updateID)
+    if err != nil {
+        return nil, err
+    }
+    if update.Status != StatusPendingValidation {
+        return nil, errInvalidState("update %s is %s, not %s", updateID, update.Status, StatusPendingValidation)
+    }
+
+    var checks []ValidationCheck
+    if err := json.Unmarshal([]byte(checksJSON), &checks); err != nil {
+        return nil, fmt.Errorf("failed to parse checks JSON: %v", err)
+    }
+    if len(checks) == 0 {
+        return nil, fmt.Errorf("at least one check required")
+    }
+    if len(checks) > maxValidationChecks {
+        return nil, fmt.Errorf("too many checks: %d (max %d)", len(checks), maxValidationChecks)
+    }
+
+    validatorID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get validator identity: %v", err)
+    }
+    validatorMSP, err := getSubmittingClientMSPID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get validator MSP ID: %v", err)
+    }
+    txTime, err := txTimestamp(ctx)
+    if err != nil {
+        return nil, err
+    }
+    result = &ValidationResult{
+        UpdateID:      updateID,
+        Checks:        checks,
+        Passed:        true,
+        Validator:     validatorID,
+        ValidatorMSP:  validatorMSP,
+        Timestamp:     txTime.Format(time.RFC3339),
+        SchemaVersion: schemaVersion(schemaValidationResult),
+    }
+    if err := validateStruct(result); err != nil {
+        return nil, err
+    }
+    for _, c := range checks {
+        if c.Outcome == CheckFail {
+            result.Passed = false
+        }
+    }
+
+    status := StatusValidationFailed
+    if result.Passed {
+        status, err = statusAfterValidation(ctx, update)
+        if err != nil {
+            return nil, err
+        }
+    }
+    if _, err := updates.SetStatus(ctx, updateID, status); err != nil {
+        return nil, err
+    }
+    if err := putSubRecord(ctx, validationResultObjectType, []string{updateID}, result, EventValidationRecorded); err != nil {
+        return nil, err
+    }
+    return result, nil
+}
+
+// QueryValidationResult returns the automated check results of an update, or nil if none were recorded
+func (s *SmartContract) QueryValidationResult(ctx contractapi.TransactionContextInterface, updateID string) (*ValidationResult, error) {
+    key, err := makeKey(ctx, validationResultObjectType, updateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read validation result: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var result ValidationResult
+    if err := decodeRecord(schemaValidationResult, data, &result); err != nil {
+        return nil, fmt.Errorf("failed to parse validation result: %v", err)
+    }
+    return &result, nil
+}
+
+// applyValidationPhase holds a new update for automated validation when the network requires it.
+// It runs after checkConcurrentUpdates, so a QUEUED update keeps its PendingAfter for statusAfterValidation.
+func applyValidationPhase(ctx contractapi.TransactionContextInterface, input *BIMUpdate) error {
+    cfg, err := networkConfig(ctx)
+    if err != nil {
+        return err
+    }
+    if cfg.RequireValidation {
+        input.Status = StatusPendingValidation
+    }
+    return nil
+}
+
+// statusAfterValidation is the review status of an update that passed validation:
+// QUEUED while the update it was queued behind at submission is still open, else INITIALIZED
+func statusAfterValidation(ctx contractapi.TransactionContextInterface, update *BIMUpdate) (string, error) {
+    if update.PendingAfter == "" {
+        return StatusInitialized, nil
+    }
+    blocking, err := updates.GetUpdate(ctx, update.PendingAfter)
+    if err != nil {
+        return "", err
+    }
+    if isOpenStatus(blocking.Status) {
+        return StatusQueued, nil
+    }
+    return StatusInitialized, nil
+}
@@ -0,0 +1,219 @@
+package chaincode
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// WatchContract lets any participant subscribe to the lifecycle of a model. The
+// notification dispatcher of the mapping service reads the watch records (or follows
+// EventModelWatchChanged) and sends the model's events to its watchers as well as to
+// the initiators and approvers it already notifies.
+type WatchContract struct {
+    contractapi.Contract
+}
+
+// ModelWatch is one participant's subscription to a model
+type ModelWatch struct {
+    ModelID string `json:"ModelID"`
+    Watcher string `json:"Watcher"` // client identity
+    // Events the watcher wants to hear about; empty means all of watchableEvents
+    Events  []string `json:"Events"`
+    Since   string   `json:"Since"`
+    Removed bool     `json:"Removed,omitempty"` // set only in the event of UnwatchModel
+
+    SchemaVersion int `json:"SchemaVersion"`
+}
+
+const (
+    EventModelWatchChanged = "BIMModelWatchChanged"
+
+    // maxWatchersPerModel keeps QueryModelWatchers within one response
+    maxWatchersPerModel = 500
+)
+
+// watchableEvents are the chaincode events a watch can select
+var watchableEvents = []string{
+    EventBIMInit,
+    EventBIMApprove,
+    EventBIMReject,
+    EventBIMPublish,
+    EventBIMApprovalVote,
+    EventCommentAdded,
+    EventRejectionAppealed,
+    EventBaselineCreated,
+    EventModelRolledBack,
+}
+
+// WatchModel subscribes the caller to a model, or replaces the event selection of an
+// existing watch
+// - Any enrolled identity may watch any model
+// - events must be chaincode event names from watchableEvents; empty selects all
+func (wc *WatchContract) WatchModel(ctx contractapi.TransactionContextInterface, modelID string, events []string) (*ModelWatch, error) {
+    if errs := checkRules(modelID, "required,max=64,id"); len(errs) > 0 {
+        return nil, fmt.Errorf("modelID %s", strings.Join(errs, ", "))
+    }
+    selected := uniqueSorted(events)
+    for _, e := range selected {
+        if !containsString(watchableEvents, e) {
+            return nil, fmt.Errorf("event %q cannot be watched (allowed: %s)", e, strings.Join(watchableEvents, ", "))
+        }
+    }
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    existing, err := readModelWatch(ctx, modelID, callerID)
+    if err != nil {
+        return nil, err
+    }
+
+    watch := &ModelWatch{ModelID: modelID, Watcher: callerID, Events: selected}
+    if existing != nil {
+        watch.Since = existing.Since
+    } else {
+        watchers, err := modelWatchers(ctx, modelID)
+        if err != nil {
+            return nil, err
+        }
+        if len(watchers) >= maxWatchersPerModel {
+            return nil, fmt.Errorf("model %s already has %d watchers (max %d)", modelID, len(watchers), maxWatchersPerModel)
+        }
+        txTime, err := txTimestamp(ctx)
+        if err != nil {
+            return nil, err
+        }
+        watch.Since = txTime.Format(time.RFC3339)
+    }
+    watch.SchemaVersion = schemaVersion(schemaModelWatch)
+    if err := putSubRecord(ctx, modelWatchObjectType, []string{modelID, callerID}, watch, EventModelWatchChanged); err != nil {
+        return nil, err
+    }
+    if err := putIndexEntry(ctx, watcherIndexObjectType, callerID, modelID); err != nil {
+        return nil, err
+    }
+    return watch, nil
+}
+
+// UnwatchModel removes the caller's watch on a model
+// - Fails if the caller does not watch the model
+func (wc *WatchContract) UnwatchModel(ctx contractapi.TransactionContextInterface, modelID string) error {
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    watch, err := readModelWatch(ctx, modelID, callerID)
+    if err != nil {
+        return err
+    }
+    if watch == nil {
+        return errNotFound("you do not watch model %s", modelID)
+    }
+    key, err := makeKey(ctx, modelWatchObjectType, modelID, callerID)
+    if err != nil {
+        return fmt.Errorf("failed to create composite key: %v", err)
+    }
+    if err := ctx.GetStub().DelState(key); err != nil {
+        return fmt.Errorf("failed to delete watch: %v", err)
+    }
+    if err := delIndexEntry(ctx, watcherIndexObjectType, callerID, modelID); err != nil {
+        return err
+    }
+    watch.Removed = true
+    data, err := marshalState(watch)
+    if err != nil {
+        return fmt.Errorf("failed to marshal watch: %v", err)
+    }
+    if err := ctx.GetStub().SetEvent(EventModelWatchChanged, data); err != nil {
+        return fmt.Errorf("failed to set event: %v", err)
+    }
+    return nil
+}
+
+// QueryModelWatchers returns the watches on a model, sorted by watcher
+func (wc *WatchContract) QueryModelWatchers(ctx contractapi.TransactionContextInterface, modelID string) ([]*ModelWatch, error) {
+    if modelID == "" {
+        return nil, fmt.Errorf("modelID required")
+    }
+    return modelWatchers(ctx, modelID)
+}
+
+// QueryWatchedModels returns the caller's watches, sorted by model
+func (wc *WatchContract) QueryWatchedModels(ctx contractapi.TransactionContextInterface) ([]*ModelWatch, error) {
+    callerID, err := getSubmittingClientID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get caller identity: %v", err)
+    }
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(watcherIndexObjectType, []string{callerID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query watcher index: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*ModelWatch{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        attrs, err := parseKey(ctx, kv.Key, watcherIndexObjectType)
+        if err != nil {
+            continue
+        }
+        watch, err := readModelWatch(ctx, attrs[1], callerID)
+        if err != nil {
+            return nil, err
+        }
+        if watch != nil {
+            result = append(result, watch)
+        }
+    }
+    return result, nil
+}
+
+// modelWatchers lists the watches stored under a model
+func modelWatchers(ctx contractapi.TransactionContextInterface, modelID string) ([]*ModelWatch, error) {
+    iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(modelWatchObjectType, []string{modelID})
+    if err != nil {
+        return nil, fmt.Errorf("failed to query watches: %v", err)
+    }
+    defer iterator.Close()
+
+    result := []*ModelWatch{}
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, err
+        }
+        var watch ModelWatch
+        if err := decodeRecord(schemaModelWatch, kv.Value, &watch); err != nil {
+            return nil, fmt.Errorf("failed to parse watch: %v", err)
+        }
+        result = append(result, &watch)
+    }
+    sort.Slice(result, func(i, j int) bool { return result[i].Watcher < result[j].Watcher })
+    return result, nil
+}
+
+func readModelWatch(ctx contractapi.TransactionContextInterface, modelID string, watcher string) (*ModelWatch, error) {
+    key, err := makeKey(ctx, modelWatchObjectType, modelID, watcher)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create composite key: %v", err)
+    }
+    data, err := ctx.GetStub().GetState(key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read watch: %v", err)
+    }
+    if data == nil {
+        return nil, nil
+    }
+    var watch ModelWatch
+    if err := decodeRecord(schemaModelWatch, data, &watch); err != nil {
+        return nil, fmt.Errorf("failed to parse watch: %v", err)
+    }
+    return &watch, nil
+}
@@ -0,0 +1,156 @@
+package chaincodetest_test
+
+import (
+    "testing"
+
+    "bim/chaincode"
+    "bim/chaincodetest"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// requireTwoApprovals makes updates of modelID wait for two professional approvals
+func requireTwoApprovals(t testing.TB, h *chaincodetest.Harness, modelID string) {
+    t.Helper()
+    mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) error {
+        return new(chaincode.ApprovalContract).SetApprovalPolicy(ctx, modelID, []string{chaincode.RoleProfessional}, nil, 2)
+    })
+}
+
+func TestApproveBIMUpdate(t *testing.T) {
+    type vote struct {
+        caller chaincodetest.Identity
+        result string
+    }
+    tests := []struct {
+        name      string
+        threshold int
+        before    []vote // recorded before the vote under test
+        vote      vote
+        comment   string
+        reason    string
+        wantErr   string
+        status    string // status of the update afterwards
+        event     string
+    }{
+        {name: "approval", vote: vote{reviewer, chaincode.StatusApproved},
+            status: chaincode.StatusApproved, event: chaincode.EventBIMApprove},
+        {name: "rejection", vote: vote{reviewer, chaincode.StatusRejected}, comment: "clashes with the slab", reason: chaincode.ReasonClash,
+            status: chaincode.StatusRejected, event: chaincode.EventBIMReject},
+        {name: "first of two approvals", threshold: 2, vote: vote{reviewer, chaincode.StatusApproved},
+            status: chaincode.StatusInitialized, event: chaincode.EventBIMApprovalVote},
+        {name: "second of two approvals", threshold: 2, before: []vote{{reviewer, chaincode.StatusApproved}}, vote: vote{reviewer2, chaincode.StatusApproved},
+            status: chaincode.StatusApproved, event: chaincode.EventBIMApprove},
+        {name: "rejection after an approval", threshold: 2, before: []vote{{reviewer, chaincode.StatusApproved}}, vote: vote{reviewer2, chaincode.StatusRejected}, comment: "missing sleeves", reason: chaincode.ReasonIncomplete,
+            status: chaincode.StatusRejected, event: chaincode.EventBIMReject},
+        {name: "modeler", vote: vote{modeler, chaincode.StatusApproved},
+            wantErr: chaincode.CodeUnauthorized, status: chaincode.StatusInitialized},
+        {name: "bim_lead outside the policy", vote: vote{lead, chaincode.StatusApproved},
+            wantErr: chaincode.CodeUnauthorized, status: chaincode.StatusInitialized},
+        {name: "no role attribute", vote: vote{noRole, chaincode.StatusApproved},
+            wantErr: chaincode.CodeUnauthorized, status: chaincode.StatusInitialized},
+        {name: "second vote of the same reviewer", threshold: 2, before: []vote{{reviewer, chaincode.StatusApproved}}, vote: vote{reviewer, chaincode.StatusApproved},
+            wantErr: chaincode.CodeDuplicate, status: chaincode.StatusInitialized},
+        {name: "modeler on a decided update", before: []vote{{reviewer, chaincode.StatusApproved}}, vote: vote{modeler, chaincode.StatusApproved},
+            wantErr: chaincode.CodeUnauthorized, status: chaincode.StatusApproved},
+        {name: "vote on a decided update", before: []vote{{reviewer, chaincode.StatusApproved}}, vote: vote{reviewer2, chaincode.StatusApproved},
+            wantErr: chaincode.CodeInvalidState, status: chaincode.StatusApproved},
+        {name: "invalid result", vote: vote{reviewer, "MAYBE"},
+            wantErr: "invalid approveResult", status: chaincode.StatusInitialized},
+        {name: "rejection without reason", vote: vote{reviewer, chaincode.StatusRejected}, comment: "clashes with the slab",
+            wantErr: "invalid reasonCode", status: chaincode.StatusInitialized},
+        {name: "rejection without comment", vote: vote{reviewer, chaincode.StatusRejected}, reason: chaincode.ReasonClash,
+            wantErr: "comment required", status: chaincode.StatusInitialized},
+        {name: "approval with reason", vote: vote{reviewer, chaincode.StatusApproved}, reason: chaincode.ReasonOther,
+            wantErr: "reasonCode only applies to REJECTED", status: chaincode.StatusInitialized},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := chaincodetest.New()
+            if tt.threshold > 1 {
+                requireTwoApprovals(t, h, "m1")
+            }
+            initUpdate(t, h, modeler, "u1", "m1")
+            for _, v := range tt.before {
+                mustTx(t, h, v.caller, func(ctx contractapi.TransactionContextInterface) error {
+                    return approve(ctx, "u1", v.result)
+                })
+            }
+
+            err := tx(t, h, tt.vote.caller, func(ctx contractapi.TransactionContextInterface) error {
+                return new(chaincode.ApprovalContract).ApproveBIMUpdate(ctx, "u1", tt.vote.result, tt.comment, tt.reason)
+            })
+            checkErr(t, err, tt.wantErr)
+            if tt.wantErr != "" {
+                if event := h.Event(); event != nil {
+                    t.Errorf("failed vote emitted %s", event.EventName)
+                }
+            } else if event := h.Event(); event == nil || event.EventName != tt.event {
+                t.Errorf("event = %v, want %s", event, tt.event)
+            }
+
+            var rec *chaincode.BIMHistoryRecord
+            mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) (err error) {
+                rec, err = new(chaincode.QueryContract).QueryUpdate(ctx, "u1")
+                return err
+            })
+            if rec.InitRecord.Status != tt.status {
+                t.Errorf("Status = %s, want %s", rec.InitRecord.Status, tt.status)
+            }
+        })
+    }
+}
+
+// A caller without the approving role learns nothing about the update from the error
+func TestApproveBIMUpdateChecksRoleFirst(t *testing.T) {
+    h := chaincodetest.New()
+    initUpdate(t, h, modeler, "u1", "m1")
+    tests := []struct {
+        name     string
+        caller   chaincodetest.Identity
+        updateID string
+        wantErr  string
+    }{
+        {"modeler on an unknown update", modeler, "missing", chaincode.CodeUnauthorized},
+        {"modeler on an existing update", modeler, "u1", chaincode.CodeUnauthorized},
+        {"reviewer on an unknown update", reviewer, "missing", chaincode.CodeNotFound},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := tx(t, h, tt.caller, func(ctx contractapi.TransactionContextInterface) error {
+                return new(chaincode.ApprovalContract).ApproveBIMUpdate(ctx, tt.updateID, chaincode.StatusApproved, "", "")
+            })
+            checkErr(t, err, tt.wantErr)
+        })
+    }
+}
+
+func TestApproveBIMUpdateWithAssignedReviewers(t *testing.T) {
+    tests := []struct {
+        name    string
+        caller  chaincodetest.Identity
+        wantErr string
+    }{
+        {"assigned reviewer", reviewer, ""},
+        {"professional not assigned", reviewer2, "not an assigned reviewer"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := chaincodetest.New()
+            initUpdate(t, h, modeler, "u1", "m1")
+            var reviewerID string
+            mustTx(t, h, reviewer, func(ctx contractapi.TransactionContextInterface) (err error) {
+                reviewerID, err = ctx.GetClientIdentity().GetID()
+                return err
+            })
+            mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) error {
+                return new(chaincode.ApprovalContract).AssignReviewers(ctx, "u1", []string{reviewerID})
+            })
+
+            err := tx(t, h, tt.caller, func(ctx contractapi.TransactionContextInterface) error {
+                return approve(ctx, "u1", chaincode.StatusApproved)
+            })
+            checkErr(t, err, tt.wantErr)
+        })
+    }
+}
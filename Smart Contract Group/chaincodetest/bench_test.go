@@ -0,0 +1,109 @@
+package chaincodetest_test
+
+import (
+    "fmt"
+    "testing"
+
+    "bim/chaincode"
+    "bim/chaincodetest"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The benchmarks time the contracts on the in-memory ledger, one transaction per
+// iteration. Every transaction signs a proposal, as a client would, so the numbers are
+// an upper bound on what the contracts cost a peer; for the network as a whole see
+// cmd/bim-bench.
+
+func BenchmarkInitBIMUpdate(b *testing.B) {
+    h := chaincodetest.New()
+    contract := new(chaincode.SmartContract)
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        mustTx(b, h, modeler, func(ctx contractapi.TransactionContextInterface) error {
+            _, err := contract.InitBIMUpdate(ctx, updateJSON(fmt.Sprintf("u%d", i), "m1"))
+            return err
+        })
+    }
+}
+
+func BenchmarkApproveBIMUpdate(b *testing.B) {
+    for _, threshold := range []int{1, 2} {
+        b.Run(fmt.Sprintf("threshold=%d", threshold), func(b *testing.B) {
+            h := chaincodetest.New()
+            if threshold > 1 {
+                requireTwoApprovals(b, h, "m1")
+            }
+            for i := 0; i < b.N; i++ {
+                initUpdate(b, h, modeler, fmt.Sprintf("u%d", i), "m1")
+            }
+            contract := new(chaincode.ApprovalContract)
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                mustTx(b, h, reviewer, func(ctx contractapi.TransactionContextInterface) error {
+                    return contract.ApproveBIMUpdate(ctx, fmt.Sprintf("u%d", i), chaincode.StatusApproved, "", "")
+                })
+            }
+        })
+    }
+}
+
+func BenchmarkQueryUpdate(b *testing.B) {
+    h := seedLedger(b)
+    contract := new(chaincode.QueryContract)
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        mustTx(b, h, reviewer, func(ctx contractapi.TransactionContextInterface) error {
+            _, err := contract.QueryUpdate(ctx, "u1")
+            return err
+        })
+    }
+}
+
+func BenchmarkQueryModelHistory(b *testing.B) {
+    for _, updates := range []int{10, 100, 1000} {
+        b.Run(fmt.Sprintf("updates=%d", updates), func(b *testing.B) {
+            h := chaincodetest.New()
+            for i := 0; i < updates; i++ {
+                initUpdate(b, h, modeler, fmt.Sprintf("u%04d", i), "m1")
+            }
+            benchmarkPages(b, h, func(ctx contractapi.TransactionContextInterface, bookmark string) (*chaincode.HistoryPage, error) {
+                return new(chaincode.QueryContract).QueryModelHistory(ctx, "m1", 100, bookmark)
+            })
+        })
+    }
+}
+
+func BenchmarkQueryUpdatesByStatus(b *testing.B) {
+    h := chaincodetest.New()
+    for i := 0; i < 1000; i++ {
+        initUpdate(b, h, modeler, fmt.Sprintf("u%04d", i), "m1")
+    }
+    benchmarkPages(b, h, func(ctx contractapi.TransactionContextInterface, bookmark string) (*chaincode.HistoryPage, error) {
+        return new(chaincode.QueryContract).QueryUpdatesByStatus(ctx, chaincode.StatusInitialized, 100, bookmark)
+    })
+}
+
+// benchmarkPages times reading every page of a paginated query, one transaction per page,
+// as an Org1 reviewer so the organization scope is applied to every record
+func benchmarkPages(b *testing.B, h *chaincodetest.Harness, query func(ctx contractapi.TransactionContextInterface, bookmark string) (*chaincode.HistoryPage, error)) {
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        bookmark := ""
+        for {
+            var page *chaincode.HistoryPage
+            mustTx(b, h, reviewer, func(ctx contractapi.TransactionContextInterface) (err error) {
+                page, err = query(ctx, bookmark)
+                return err
+            })
+            if page.Bookmark == "" {
+                break
+            }
+            bookmark = page.Bookmark
+        }
+    }
+}
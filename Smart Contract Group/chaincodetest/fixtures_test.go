@@ -0,0 +1,98 @@
+package chaincodetest_test
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+
+    "bim/chaincode"
+    "bim/chaincodetest"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Identities of the tests. Roles and departments are certificate attributes, the way
+// Fabric CA issues them.
+var (
+    modeler   = member("Org1MSP", "alice", chaincode.RoleModeler, "architecture")
+    modeler2  = member("Org2MSP", "dave", chaincode.RoleModeler, "mep")
+    reviewer  = member("Org1MSP", "bob", chaincode.RoleProfessional, "structure")
+    reviewer2 = member("Org1MSP", "erin", chaincode.RoleProfessional, "mep")
+    outsider  = member("Org2MSP", "frank", chaincode.RoleProfessional, "facade")
+    lead      = member("Org1MSP", "carol", chaincode.RoleBIMLead, "architecture")
+    auditor   = member("Org2MSP", "grace", chaincode.RoleAuditor, "")
+    noRole    = chaincodetest.Identity{MSPID: "Org1MSP", Name: "mallory"}
+)
+
+func member(mspID string, name string, role string, department string) chaincodetest.Identity {
+    attrs := map[string]string{"role": role}
+    if department != "" {
+        attrs["department"] = department
+    }
+    return chaincodetest.Identity{MSPID: mspID, Name: name, Attrs: attrs}
+}
+
+// updateJSON returns the InitBIMUpdate payload of a minimal update
+func updateJSON(updateID string, modelID string) string {
+    data, _ := json.Marshal(chaincode.BIMUpdate{UpdateID: updateID, ModelID: modelID, Version: "1.0", Description: "test update"})
+    return string(data)
+}
+
+// tx runs fn in a new transaction submitted by id
+func tx(t testing.TB, h *chaincodetest.Harness, id chaincodetest.Identity, fn func(ctx contractapi.TransactionContextInterface) error) error {
+    t.Helper()
+    ctx, err := h.Tx(id)
+    if err != nil {
+        t.Fatalf("failed to start transaction as %s: %v", id.Name, err)
+    }
+    return fn(ctx)
+}
+
+// mustTx is tx for steps that set up a test and must succeed
+func mustTx(t testing.TB, h *chaincodetest.Harness, id chaincodetest.Identity, fn func(ctx contractapi.TransactionContextInterface) error) {
+    t.Helper()
+    if err := tx(t, h, id, fn); err != nil {
+        t.Fatalf("%s: %v", id.Name, err)
+    }
+}
+
+// initUpdate submits a minimal update as modeler
+func initUpdate(t testing.TB, h *chaincodetest.Harness, id chaincodetest.Identity, updateID string, modelID string) {
+    t.Helper()
+    mustTx(t, h, id, func(ctx contractapi.TransactionContextInterface) error {
+        _, err := new(chaincode.SmartContract).InitBIMUpdate(ctx, updateJSON(updateID, modelID))
+        return err
+    })
+}
+
+// approve records a vote as id
+func approve(ctx contractapi.TransactionContextInterface, updateID string, result string) error {
+    comment, reason := "", ""
+    if result == chaincode.StatusRejected {
+        comment, reason = "clashes with the slab", "CLASH"
+    }
+    return new(chaincode.ApprovalContract).ApproveBIMUpdate(ctx, updateID, result, comment, reason)
+}
+
+// checkErr fails the test unless err matches want: nil for "", else an error whose
+// message contains want, such as a chaincode error code
+func checkErr(t testing.TB, err error, want string) {
+    t.Helper()
+    switch {
+    case want == "" && err != nil:
+        t.Fatalf("unexpected error: %v", err)
+    case want != "" && err == nil:
+        t.Fatalf("expected error containing %q, got none", want)
+    case want != "" && !strings.Contains(err.Error(), want):
+        t.Fatalf("expected error containing %q, got %v", want, err)
+    }
+}
+
+// updateIDs lists the UpdateIDs of records in order
+func updateIDs(records []*chaincode.BIMHistoryRecord) []string {
+    ids := []string{}
+    for _, rec := range records {
+        ids = append(ids, rec.UpdateID)
+    }
+    return ids
+}
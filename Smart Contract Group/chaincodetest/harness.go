@@ -0,0 +1,117 @@
+// Package chaincodetest runs the BIM contracts against an in-memory ledger.
+//
+// It wires shimtest.MockStub into a contractapi.TransactionContext and fills in the parts
+// the contracts depend on that MockStub leaves out: a creator certificate carrying
+// Fabric CA attributes (role, department) so cid-based role checks work, a signed
+// proposal, deterministic transaction IDs and timestamps, Fabric's one-event-per-
+// transaction rule and paginated partial composite key queries.
+//
+//	h := chaincodetest.New()
+//	modeler := chaincodetest.Identity{MSPID: "Org1MSP", Name: "alice", Attrs: map[string]string{"role": "modeler"}}
+//	ctx, err := h.Tx(modeler)
+//	...
+//	id, err := new(chaincode.SmartContract).InitBIMUpdate(ctx, input)
+//	event := h.Event()
+package chaincodetest
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/golang/protobuf/ptypes/timestamp"
+    "github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+    pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Harness drives a sequence of transactions against one in-memory ledger.
+// World state persists across transactions, as it does on a peer.
+type Harness struct {
+    Stub *Stub
+    // Now is the timestamp of the next transaction
+    Now time.Time
+    // Step is how far Now advances after every transaction
+    Step time.Duration
+
+    seq   int
+    certs map[string]*Credential
+}
+
+// New returns a harness on an empty ledger with a fixed start time, so timestamps
+// and everything derived from them are the same on every run
+func New() *Harness {
+    return &Harness{
+        Stub:  NewStub("bim"),
+        Now:   time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+        Step:  time.Second,
+        certs: map[string]*Credential{},
+    }
+}
+
+// Tx ends the current transaction, if any, and starts the next one as the given
+// identity. The returned context is valid until the next call to Tx.
+func (h *Harness) Tx(id Identity) (*contractapi.TransactionContext, error) {
+    cred, err := h.credential(id)
+    if err != nil {
+        return nil, err
+    }
+    if h.Stub.TxID != "" {
+        h.Stub.MockTransactionEnd(h.Stub.TxID)
+    }
+
+    h.seq++
+    txID := fmt.Sprintf("tx%06d", h.seq)
+    h.Stub.MockTransactionStart(txID)
+    h.Stub.TxTimestamp = &timestamp.Timestamp{Seconds: h.Now.Unix(), Nanos: int32(h.Now.Nanosecond())}
+    h.Now = h.Now.Add(h.Step)
+    h.Stub.Creator = cred.creator
+    h.Stub.event = nil
+    h.Stub.signed, err = cred.SignProposal(txID)
+    if err != nil {
+        return nil, err
+    }
+
+    ci, err := cid.New(h.Stub)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create client identity for %s: %v", id.Name, err)
+    }
+    ctx := new(contractapi.TransactionContext)
+    ctx.SetStub(h.Stub)
+    ctx.SetClientIdentity(ci)
+    return ctx, nil
+}
+
+// TxID returns the ID of the current transaction
+func (h *Harness) TxID() string {
+    return h.Stub.TxID
+}
+
+// Event returns the event the current transaction will emit, or nil.
+// Like a peer, only the last SetEvent call of a transaction is kept.
+func (h *Harness) Event() *pb.ChaincodeEvent {
+    return h.Stub.event
+}
+
+// Events returns the events of all transactions so far, in order
+func (h *Harness) Events() []*pb.ChaincodeEvent {
+    events := h.Stub.events
+    if h.Stub.event != nil {
+        events = append(events, h.Stub.event)
+    }
+    return events
+}
+
+// credential returns the cached certificate and key of id, creating them on first use.
+// Reusing the certificate keeps cid.GetID stable for the same identity.
+func (h *Harness) credential(id Identity) (*Credential, error) {
+    key := id.key()
+    if c, ok := h.certs[key]; ok {
+        return c, nil
+    }
+    c, err := NewCredential(id)
+    if err != nil {
+        return nil, err
+    }
+    h.certs[key] = c
+    return c, nil
+}
@@ -0,0 +1,113 @@
+package chaincodetest
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "math/big"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/golang/protobuf/proto"
+    "github.com/hyperledger/fabric-protos-go/msp"
+    pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// attrsOID is the certificate extension Fabric CA stores enrollment attributes in
+var attrsOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// Identity is a mocked transaction submitter. Attrs become Fabric CA certificate
+// attributes, e.g. {"role": "bim_lead", "department": "structure"}.
+type Identity struct {
+    MSPID string
+    Name  string
+    Attrs map[string]string
+}
+
+// key identifies the certificate cached for the identity
+func (id Identity) key() string {
+    names := make([]string, 0, len(id.Attrs))
+    for k := range id.Attrs {
+        names = append(names, k+"="+id.Attrs[k])
+    }
+    sort.Strings(names)
+    return id.MSPID + "/" + id.Name + "/" + strings.Join(names, ",")
+}
+
+// Credential is the serialized creator and signing key of an Identity
+type Credential struct {
+    creator []byte
+    key     *ecdsa.PrivateKey
+}
+
+// NewCredential issues a self-signed certificate for id with its attributes
+func NewCredential(id Identity) (*Credential, error) {
+    if id.MSPID == "" || id.Name == "" {
+        return nil, fmt.Errorf("identity needs MSPID and Name")
+    }
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    attrs := id.Attrs
+    if attrs == nil {
+        attrs = map[string]string{}
+    }
+    ext, err := json.Marshal(map[string]interface{}{"attrs": attrs})
+    if err != nil {
+        return nil, err
+    }
+    serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+    if err != nil {
+        return nil, err
+    }
+    // the validity window must cover the harness clock, which starts in the past:
+    // chaincode rejects certificates that are not valid at the transaction timestamp
+    tmpl := &x509.Certificate{
+        SerialNumber:    serial,
+        Subject:         pkix.Name{CommonName: id.Name, Organization: []string{id.MSPID}},
+        NotBefore:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+        NotAfter:        time.Now().AddDate(10, 0, 0),
+        KeyUsage:        x509.KeyUsageDigitalSignature,
+        ExtraExtensions: []pkix.Extension{{Id: attrsOID, Value: ext}},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create certificate for %s: %v", id.Name, err)
+    }
+    creator, err := proto.Marshal(&msp.SerializedIdentity{
+        Mspid:   id.MSPID,
+        IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to serialize identity %s: %v", id.Name, err)
+    }
+    return &Credential{creator: creator, key: key}, nil
+}
+
+// Creator returns the serialized identity the stub hands to cid
+func (c *Credential) Creator() []byte {
+    return c.creator
+}
+
+// SignProposal returns a proposal for txID signed with the credential's key
+func (c *Credential) SignProposal(txID string) (*pb.SignedProposal, error) {
+    proposal, err := proto.Marshal(&pb.Proposal{Payload: []byte(txID)})
+    if err != nil {
+        return nil, err
+    }
+    digest := sha256.Sum256(proposal)
+    sig, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+    if err != nil {
+        return nil, err
+    }
+    return &pb.SignedProposal{ProposalBytes: proposal, Signature: sig}, nil
+}
@@ -0,0 +1,231 @@
+package chaincodetest_test
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+    "time"
+
+    "bim/chaincode"
+    "bim/chaincodetest"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestInitBIMUpdate(t *testing.T) {
+    tests := []struct {
+        name    string
+        caller  chaincodetest.Identity
+        payload string
+        wantErr string
+    }{
+        {"modeler", modeler, updateJSON("u1", "m1"), ""},
+        {"modeler of another org", modeler2, updateJSON("u1", "m1"), ""},
+        {"professional", reviewer, updateJSON("u1", "m1"), chaincode.CodeUnauthorized},
+        {"bim_lead", lead, updateJSON("u1", "m1"), chaincode.CodeUnauthorized},
+        {"no role attribute", noRole, updateJSON("u1", "m1"), chaincode.CodeUnauthorized},
+        {"malformed JSON", modeler, `{"UpdateID":`, "failed to parse update JSON"},
+        {"missing ModelID", modeler, `{"UpdateID":"u1","Version":"1.0"}`, "ModelID"},
+        {"invalid version", modeler, `{"UpdateID":"u1","ModelID":"m1","Version":"1..0"}`, "Version"},
+        {"invalid review mode", modeler, `{"UpdateID":"u1","ModelID":"m1","Version":"1.0","ReviewMode":"SECRET"}`, "ReviewMode"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := chaincodetest.New()
+            submittedAt := h.Now
+            var updateID string
+            err := tx(t, h, tt.caller, func(ctx contractapi.TransactionContextInterface) (err error) {
+                updateID, err = new(chaincode.SmartContract).InitBIMUpdate(ctx, tt.payload)
+                return err
+            })
+            checkErr(t, err, tt.wantErr)
+            if tt.wantErr != "" {
+                if event := h.Event(); event != nil {
+                    t.Errorf("failed submission emitted %s", event.EventName)
+                }
+                return
+            }
+
+            event := h.Event()
+            if event == nil || event.EventName != chaincode.EventBIMInit {
+                t.Fatalf("event = %v, want %s", event, chaincode.EventBIMInit)
+            }
+            var update chaincode.BIMUpdate
+            if err := json.Unmarshal(event.Payload, &update); err != nil {
+                t.Fatal(err)
+            }
+            if update.UpdateID != updateID || update.Status != chaincode.StatusInitialized {
+                t.Errorf("event carries %s in %s, want %s in %s", update.UpdateID, update.Status, updateID, chaincode.StatusInitialized)
+            }
+            if want := submittedAt.Format(time.RFC3339); update.Timestamp != want {
+                t.Errorf("Timestamp = %s, want the transaction timestamp %s", update.Timestamp, want)
+            }
+            if update.InitiatorDepartment != tt.caller.Attrs["department"] {
+                t.Errorf("InitiatorDepartment = %q, want %q", update.InitiatorDepartment, tt.caller.Attrs["department"])
+            }
+            if sig, ok := update.Signatures[update.Initiator]; !ok || sig.MSPID != tt.caller.MSPID || sig.TxID != h.TxID() {
+                t.Errorf("Signatures = %+v, want the proposal of %s in %s", update.Signatures, tt.caller.MSPID, h.TxID())
+            }
+        })
+    }
+}
+
+func TestInitBIMUpdateAgainstLedger(t *testing.T) {
+    tests := []struct {
+        name    string
+        setup   func(t *testing.T, h *chaincodetest.Harness)
+        payload string
+        wantErr string
+        wantID  string
+    }{
+        {
+            name:    "duplicate UpdateID",
+            setup:   func(t *testing.T, h *chaincodetest.Harness) { initUpdate(t, h, modeler, "u1", "m1") },
+            payload: updateJSON("u1", "m2"),
+            wantErr: chaincode.CodeDuplicate,
+        },
+        {
+            name: "retry with the same ClientRequestID",
+            setup: func(t *testing.T, h *chaincodetest.Harness) {
+                mustTx(t, h, modeler, func(ctx contractapi.TransactionContextInterface) error {
+                    _, err := new(chaincode.SmartContract).InitBIMUpdate(ctx, `{"UpdateID":"u1","ModelID":"m1","Version":"1.0","ClientRequestID":"req-1"}`)
+                    return err
+                })
+            },
+            payload: `{"UpdateID":"u2","ModelID":"m1","Version":"1.0","ClientRequestID":"req-1"}`,
+            wantID:  "u1",
+        },
+        {
+            name: "locked model",
+            setup: func(t *testing.T, h *chaincodetest.Harness) {
+                mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) error {
+                    _, err := new(chaincode.ModelRegistryContract).LockModel(ctx, "m1", "tender issue", "")
+                    return err
+                })
+            },
+            payload: updateJSON("u1", "m1"),
+            wantErr: chaincode.CodeInvalidState,
+        },
+        {
+            name: "expired model lock",
+            setup: func(t *testing.T, h *chaincodetest.Harness) {
+                until := h.Now.Add(time.Minute).Format(time.RFC3339)
+                mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) error {
+                    _, err := new(chaincode.ModelRegistryContract).LockModel(ctx, "m1", "tender issue", until)
+                    return err
+                })
+                h.Now = h.Now.Add(time.Hour)
+            },
+            payload: updateJSON("u1", "m1"),
+            wantID:  "u1",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := chaincodetest.New()
+            tt.setup(t, h)
+            var updateID string
+            err := tx(t, h, modeler, func(ctx contractapi.TransactionContextInterface) (err error) {
+                updateID, err = new(chaincode.SmartContract).InitBIMUpdate(ctx, tt.payload)
+                return err
+            })
+            checkErr(t, err, tt.wantErr)
+            if tt.wantID != "" && updateID != tt.wantID {
+                t.Errorf("UpdateID = %s, want %s", updateID, tt.wantID)
+            }
+        })
+    }
+}
+
+func TestInitBIMUpdateWithRoleGrant(t *testing.T) {
+    admin := member("Org1MSP", "root", chaincode.RoleAdmin, "")
+    foreignAdmin := member("Org2MSP", "root2", chaincode.RoleAdmin, "")
+
+    tests := []struct {
+        name    string
+        granter chaincodetest.Identity
+        role    string
+        wantErr string
+    }{
+        {"granted modeler", admin, chaincode.RoleModeler, ""},
+        {"granted professional", admin, chaincode.RoleProfessional, chaincode.CodeUnauthorized},
+        {"grant of another org's admin", foreignAdmin, chaincode.RoleModeler, chaincode.CodeUnauthorized},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := chaincodetest.New()
+            var identity string
+            mustTx(t, h, noRole, func(ctx contractapi.TransactionContextInterface) (err error) {
+                identity, err = ctx.GetClientIdentity().GetID()
+                return err
+            })
+            mustTx(t, h, tt.granter, func(ctx contractapi.TransactionContextInterface) error {
+                _, err := new(chaincode.RoleAdminContract).GrantRole(ctx, identity, tt.role, "", "")
+                return err
+            })
+
+            err := tx(t, h, noRole, func(ctx contractapi.TransactionContextInterface) error {
+                _, err := new(chaincode.SmartContract).InitBIMUpdate(ctx, updateJSON("u1", "m1"))
+                return err
+            })
+            checkErr(t, err, tt.wantErr)
+        })
+    }
+}
+
+func TestInitBIMUpdateGeneratesUpdateID(t *testing.T) {
+    admin := member("Org1MSP", "root", chaincode.RoleAdmin, "")
+    tests := []struct {
+        strategy string // "" keeps the default
+        want     func(h *chaincodetest.Harness, updateID string) bool
+        wantErr  string
+    }{
+        {"", func(h *chaincodetest.Harness, id string) bool { return len(id) == 26 }, ""},
+        {chaincode.UpdateIDStrategyTxID, func(h *chaincodetest.Harness, id string) bool { return id == h.TxID() }, ""},
+        {chaincode.UpdateIDStrategyNone, nil, "UpdateID"},
+    }
+    for _, tt := range tests {
+        t.Run("strategy="+tt.strategy, func(t *testing.T) {
+            h := chaincodetest.New()
+            if tt.strategy != "" {
+                mustTx(t, h, admin, func(ctx contractapi.TransactionContextInterface) error {
+                    return new(chaincode.ConfigContract).SetUpdateIDStrategy(ctx, tt.strategy)
+                })
+            }
+            var updateID string
+            err := tx(t, h, modeler, func(ctx contractapi.TransactionContextInterface) (err error) {
+                updateID, err = new(chaincode.SmartContract).InitBIMUpdate(ctx, updateJSON("", "m1"))
+                return err
+            })
+            checkErr(t, err, tt.wantErr)
+            if tt.want != nil && !tt.want(h, updateID) {
+                t.Errorf("UpdateID = %q", updateID)
+            }
+        })
+    }
+
+    h := chaincodetest.New()
+    err := tx(t, h, admin, func(ctx contractapi.TransactionContextInterface) error {
+        return new(chaincode.ConfigContract).SetUpdateIDStrategy(ctx, "uuid")
+    })
+    checkErr(t, err, "invalid strategy")
+}
+
+func TestInitBIMUpdateRecordSizeLimit(t *testing.T) {
+    admin := member("Org1MSP", "root", chaincode.RoleAdmin, "")
+    payload, _ := json.Marshal(chaincode.BIMUpdate{UpdateID: "u1", ModelID: "m1", Version: "1.0", Description: strings.Repeat("x", 4096)})
+    submit := func(h *chaincodetest.Harness) error {
+        return tx(t, h, modeler, func(ctx contractapi.TransactionContextInterface) error {
+            _, err := new(chaincode.SmartContract).InitBIMUpdate(ctx, string(payload))
+            return err
+        })
+    }
+
+    // the compiled-in default holds the record; a lower ledger setting refuses it
+    checkErr(t, submit(chaincodetest.New()), "")
+    h := chaincodetest.New()
+    mustTx(t, h, admin, func(ctx contractapi.TransactionContextInterface) error {
+        return new(chaincode.ConfigContract).SetMaxUpdateRecordBytes(ctx, 2048)
+    })
+    checkErr(t, submit(h), "exceeds the limit of 2048")
+}
@@ -0,0 +1,247 @@
+package chaincodetest_test
+
+import (
+    "reflect"
+    "testing"
+    "time"
+
+    "bim/chaincode"
+    "bim/chaincodetest"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// seedLedger records three updates:
+//   - u1 on m1 by Org1's modeler in January, APPROVED by an Org1 reviewer
+//   - u2 on m2 by Org2's modeler in January
+//   - u3 on m1 by Org1's modeler in February
+func seedLedger(t testing.TB) *chaincodetest.Harness {
+    t.Helper()
+    h := chaincodetest.New()
+    initUpdate(t, h, modeler, "u1", "m1")
+    initUpdate(t, h, modeler2, "u2", "m2")
+    mustTx(t, h, reviewer, func(ctx contractapi.TransactionContextInterface) error {
+        return approve(ctx, "u1", chaincode.StatusApproved)
+    })
+    h.Now = time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+    initUpdate(t, h, modeler, "u3", "m1")
+    return h
+}
+
+func TestQueryUpdate(t *testing.T) {
+    tests := []struct {
+        name     string
+        caller   chaincodetest.Identity
+        updateID string
+        wantErr  string
+        approved bool
+    }{
+        {"own org's update", reviewer, "u1", "", true},
+        {"unapproved update", modeler, "u3", "", false},
+        {"other org's update", outsider, "u1", chaincode.CodeUnauthorized, false},
+        {"other org's modeler", modeler2, "u3", chaincode.CodeUnauthorized, false},
+        {"update of the caller's org", outsider, "u2", "", false},
+        {"bim_lead sees every org", lead, "u2", "", false},
+        {"auditor sees every org", auditor, "u1", "", true},
+        {"unknown update", lead, "u9", chaincode.CodeNotFound, false},
+        {"no updateID", lead, "", "updateID required", false},
+    }
+    h := seedLedger(t)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var rec *chaincode.BIMHistoryRecord
+            err := tx(t, h, tt.caller, func(ctx contractapi.TransactionContextInterface) (err error) {
+                rec, err = new(chaincode.QueryContract).QueryUpdate(ctx, tt.updateID)
+                return err
+            })
+            checkErr(t, err, tt.wantErr)
+            if tt.wantErr != "" {
+                return
+            }
+            if rec.UpdateID != tt.updateID || rec.InitRecord == nil || rec.InitRecord.UpdateID != tt.updateID {
+                t.Fatalf("record = %+v, want %s", rec, tt.updateID)
+            }
+            if got := rec.Approval != nil; got != tt.approved {
+                t.Fatalf("has approval record = %v, want %v", got, tt.approved)
+            }
+            if tt.approved && rec.Approval.ApproveResult != chaincode.StatusApproved {
+                t.Errorf("ApproveResult = %s, want %s", rec.Approval.ApproveResult, chaincode.StatusApproved)
+            }
+        })
+    }
+}
+
+func TestQueryListings(t *testing.T) {
+    query := new(chaincode.QueryContract)
+    allUpdates := func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+        return query.QueryAllUpdates(ctx)
+    }
+    byStatus := func(status string) func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+        return func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+            page, err := query.QueryUpdatesByStatus(ctx, status, 10, "")
+            if err != nil {
+                return nil, err
+            }
+            return page.Records, nil
+        }
+    }
+    ownSubmissions := func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+        return query.QueryUpdatesByInitiator(ctx, "")
+    }
+    modelHistory := func(modelID string) func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+        return func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+            page, err := query.QueryModelHistory(ctx, modelID, 10, "")
+            if err != nil {
+                return nil, err
+            }
+            return page.Records, nil
+        }
+    }
+    timeRange := func(start string, end string) func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+        return func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error) {
+            return query.QueryUpdatesByTimeRange(ctx, start, end)
+        }
+    }
+
+    tests := []struct {
+        name    string
+        caller  chaincodetest.Identity
+        query   func(ctx contractapi.TransactionContextInterface) ([]*chaincode.BIMHistoryRecord, error)
+        want    []string
+        wantErr string
+    }{
+        {name: "all updates as bim_lead", caller: lead, query: allUpdates, want: []string{"u1", "u2", "u3"}},
+        {name: "all updates as auditor", caller: auditor, query: allUpdates, want: []string{"u1", "u2", "u3"}},
+        {name: "all updates as Org1 reviewer", caller: reviewer, query: allUpdates, want: []string{"u1", "u3"}},
+        {name: "all updates as Org2 professional", caller: outsider, query: allUpdates, want: []string{"u2"}},
+        {name: "all updates without role", caller: noRole, query: allUpdates, want: []string{"u1", "u3"}},
+
+        {name: "approved", caller: lead, query: byStatus(chaincode.StatusApproved), want: []string{"u1"}},
+        {name: "initialized", caller: lead, query: byStatus(chaincode.StatusInitialized), want: []string{"u2", "u3"}},
+        {name: "initialized in Org1's scope", caller: reviewer, query: byStatus(chaincode.StatusInitialized), want: []string{"u3"}},
+        {name: "approved in Org2's scope", caller: outsider, query: byStatus(chaincode.StatusApproved), want: []string{}},
+        {name: "no status", caller: lead, query: byStatus(""), wantErr: "status required"},
+
+        {name: "own submissions", caller: modeler, query: ownSubmissions, want: []string{"u1", "u3"}},
+        {name: "own submissions of Org2", caller: modeler2, query: ownSubmissions, want: []string{"u2"}},
+        {name: "own submissions of a reviewer", caller: reviewer, query: ownSubmissions, want: []string{}},
+
+        {name: "model history", caller: lead, query: modelHistory("m1"), want: []string{"u1", "u3"}},
+        {name: "model history outside the scope", caller: outsider, query: modelHistory("m1"), want: []string{}},
+        {name: "no model", caller: lead, query: modelHistory(""), wantErr: "modelID required"},
+
+        {name: "January", caller: lead, query: timeRange("2024-01-01T00:00:00Z", "2024-01-31T23:59:59Z"), want: []string{"u1", "u2"}},
+        {name: "January and February", caller: lead, query: timeRange("2024-01-01T00:00:00Z", "2024-02-29T23:59:59Z"), want: []string{"u1", "u2", "u3"}},
+        {name: "January in Org2's scope", caller: outsider, query: timeRange("2024-01-01T00:00:00Z", "2024-01-31T23:59:59Z"), want: []string{"u2"}},
+        {name: "range within a month", caller: lead, query: timeRange("2024-01-01T09:00:01Z", "2024-01-01T09:00:01Z"), want: []string{"u2"}},
+        {name: "range of 24 months", caller: lead, query: timeRange("2023-03-01T00:00:00Z", "2025-02-28T00:00:00Z"), want: []string{"u1", "u2", "u3"}},
+        {name: "range of 25 months", caller: lead, query: timeRange("2023-02-01T00:00:00Z", "2025-02-28T00:00:00Z"), wantErr: "spans 25 months"},
+        {name: "reversed range", caller: lead, query: timeRange("2024-02-01T00:00:00Z", "2024-01-01T00:00:00Z"), wantErr: "end must not be before start"},
+        {name: "invalid start", caller: lead, query: timeRange("2024-01-01", "2024-02-01T00:00:00Z"), wantErr: "invalid start"},
+    }
+    h := seedLedger(t)
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var records []*chaincode.BIMHistoryRecord
+            err := tx(t, h, tt.caller, func(ctx contractapi.TransactionContextInterface) (err error) {
+                records, err = tt.query(ctx)
+                return err
+            })
+            checkErr(t, err, tt.wantErr)
+            if tt.wantErr != "" {
+                return
+            }
+            if got := updateIDs(records); !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("updates = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestQueryModelHistoryPages(t *testing.T) {
+    h := seedLedger(t)
+    initUpdate(t, h, modeler, "u4", "m1")
+
+    var got []string
+    bookmark := ""
+    for pages := 1; ; pages++ {
+        if pages > 3 {
+            t.Fatalf("more pages than updates, bookmark %q", bookmark)
+        }
+        var page *chaincode.HistoryPage
+        mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) (err error) {
+            page, err = new(chaincode.QueryContract).QueryModelHistory(ctx, "m1", 2, bookmark)
+            return err
+        })
+        if len(page.Records) > 2 {
+            t.Fatalf("page %d holds %d records, page size 2", pages, len(page.Records))
+        }
+        got = append(got, updateIDs(page.Records)...)
+        if len(page.Records) < 2 || page.Bookmark == "" {
+            break
+        }
+        bookmark = page.Bookmark
+    }
+    if want := []string{"u1", "u3", "u4"}; !reflect.DeepEqual(got, want) {
+        t.Fatalf("updates = %v, want %v", got, want)
+    }
+}
+
+func TestQueryApprovals(t *testing.T) {
+    tests := []struct {
+        name      string
+        votes     []chaincodetest.Identity
+        status    string
+        score     int
+        remaining int
+        satisfied bool
+    }{
+        {"no votes", nil, chaincode.StatusInitialized, 0, 2, false},
+        {"one of two approvals", []chaincodetest.Identity{reviewer}, chaincode.StatusInitialized, 1, 1, false},
+        {"two of two approvals", []chaincodetest.Identity{reviewer, reviewer2}, chaincode.StatusApproved, 2, 0, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h := chaincodetest.New()
+            requireTwoApprovals(t, h, "m1")
+            initUpdate(t, h, modeler, "u1", "m1")
+            for _, voter := range tt.votes {
+                mustTx(t, h, voter, func(ctx contractapi.TransactionContextInterface) error {
+                    return approve(ctx, "u1", chaincode.StatusApproved)
+                })
+            }
+
+            var records *chaincode.ApprovalRecords
+            var tally *chaincode.ApprovalTally
+            mustTx(t, h, lead, func(ctx contractapi.TransactionContextInterface) (err error) {
+                contract := new(chaincode.ApprovalContract)
+                if records, err = contract.QueryApprovals(ctx, "u1"); err != nil {
+                    return err
+                }
+                tally, err = contract.QueryApprovalTally(ctx, "u1")
+                return err
+            })
+
+            if records.Status != tt.status || tally.Status != tt.status {
+                t.Errorf("Status = %s / %s, want %s", records.Status, tally.Status, tt.status)
+            }
+            if records.Score != tt.score || tally.Score != tt.score || records.Threshold != 2 || tally.Threshold != 2 {
+                t.Errorf("Score = %d/%d, %d/%d, want %d/2", records.Score, records.Threshold, tally.Score, tally.Threshold, tt.score)
+            }
+            if records.RemainingWeight != tt.remaining {
+                t.Errorf("RemainingWeight = %d, want %d", records.RemainingWeight, tt.remaining)
+            }
+            if tally.Satisfied != tt.satisfied {
+                t.Errorf("Satisfied = %v, want %v", tally.Satisfied, tt.satisfied)
+            }
+            if len(records.Votes) != len(tt.votes) || len(tally.Votes) != len(tt.votes) {
+                t.Fatalf("votes = %d / %d, want %d", len(records.Votes), len(tally.Votes), len(tt.votes))
+            }
+            for i, vote := range records.Votes {
+                if vote.Approver != tally.Votes[i].Approver {
+                    t.Errorf("vote %d: QueryApprovals has %s, QueryApprovalTally %s", i, vote.Approver, tally.Votes[i].Approver)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,105 @@
+package chaincodetest
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/hyperledger/fabric-chaincode-go/shim"
+    "github.com/hyperledger/fabric-chaincode-go/shimtest"
+    "github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+    pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Stub is a shimtest.MockStub with the behaviour the contracts rely on filled in
+type Stub struct {
+    *shimtest.MockStub
+
+    signed *pb.SignedProposal
+    // event is the event of the current transaction; events holds those of earlier ones
+    event  *pb.ChaincodeEvent
+    events []*pb.ChaincodeEvent
+}
+
+// NewStub returns an empty in-memory ledger
+func NewStub(name string) *Stub {
+    return &Stub{MockStub: shimtest.NewMockStub(name, nil)}
+}
+
+// MockTransactionEnd ends the transaction and archives its event
+func (s *Stub) MockTransactionEnd(uuid string) {
+    if s.event != nil {
+        s.events = append(s.events, s.event)
+        s.event = nil
+    }
+    s.MockStub.MockTransactionEnd(uuid)
+}
+
+// GetSignedProposal returns the proposal signed by the transaction's creator
+func (s *Stub) GetSignedProposal() (*pb.SignedProposal, error) {
+    return s.signed, nil
+}
+
+// SetEvent replaces the transaction's event; a peer only keeps the last one.
+// MockStub would instead queue every event on a channel that blocks when full.
+func (s *Stub) SetEvent(name string, payload []byte) error {
+    if name == "" {
+        return fmt.Errorf("event name can not be empty string")
+    }
+    s.event = &pb.ChaincodeEvent{TxId: s.TxID, EventName: name, Payload: payload}
+    return nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination pages through a partial composite key
+// query. The bookmark is the first key of the next page, "" after the last page.
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+    iterator, err := s.MockStub.GetStateByPartialCompositeKey(objectType, keys)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer iterator.Close()
+
+    var all []*queryresult.KV
+    for iterator.HasNext() {
+        kv, err := iterator.Next()
+        if err != nil {
+            return nil, nil, err
+        }
+        all = append(all, kv)
+    }
+    start := 0
+    if bookmark != "" {
+        start = sort.Search(len(all), func(i int) bool { return all[i].Key >= bookmark })
+    }
+    end := start + int(pageSize)
+    if pageSize <= 0 || end > len(all) {
+        end = len(all)
+    }
+    meta := &pb.QueryResponseMetadata{FetchedRecordsCount: int32(end - start)}
+    if end < len(all) {
+        meta.Bookmark = all[end].Key
+    }
+    return &sliceIterator{kvs: all[start:end]}, meta, nil
+}
+
+// sliceIterator iterates over results already read into memory
+type sliceIterator struct {
+    kvs []*queryresult.KV
+    pos int
+}
+
+func (it *sliceIterator) HasNext() bool {
+    return it.pos < len(it.kvs)
+}
+
+func (it *sliceIterator) Next() (*queryresult.KV, error) {
+    if !it.HasNext() {
+        return nil, fmt.Errorf("no more results")
+    }
+    kv := it.kvs[it.pos]
+    it.pos++
+    return kv, nil
+}
+
+func (it *sliceIterator) Close() error {
+    return nil
+}
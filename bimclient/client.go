@@ -0,0 +1,377 @@
+// Package bimclient is a Go client for the BIM model update chaincode.
+//
+// It wraps the Fabric gateway plumbing the command-line tools repeat (wallet, connection
+// profile, channel and contract names) behind typed methods:
+//
+//	c, err := bimclient.New(bimclient.Config{
+//	    Profile:  "connection.yaml",
+//	    Wallet:   "wallet",
+//	    Identity: "appUser",
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	defer c.Close()
+//	updateID, err := c.InitUpdate(ctx, bimclient.UpdateInput{ModelID: "M-1", Version: "1.0"})
+//
+// Transactions that lost an MVCC race are retried according to Config.Retry. Failures
+// are returned as *Error, which can be matched with errors.Is against ErrNotFound,
+// ErrPermission, ErrInvalid, ErrConflict and ErrUnavailable.
+//
+// Tools without a wallet use GatewayClient instead, which calls the REST gateway over
+// HTTP and slows down when the gateway answers 503 with Retry-After.
+package bimclient
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "strconv"
+    "sync"
+    "time"
+
+    pb "github.com/hyperledger/fabric-protos-go/peer"
+    "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+    "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+)
+
+// Contract names as registered in the chaincode
+const (
+    initContract     = "SmartContract"
+    approvalContract = "ApprovalContract"
+    queryContract    = "QueryContract"
+)
+
+// Config selects the network, identity and chaincode a Client talks to
+type Config struct {
+    Profile   string // connection profile file
+    Wallet    string // filesystem wallet directory
+    Identity  string // wallet label
+    Channel   string // default "mychannel"
+    Chaincode string // default "bim"
+
+    Retry RetryPolicy
+
+    // WaitForCommit makes submissions wait for the transaction's commit event and fail
+    // unless it was committed VALID. Later queries go to the peer that delivered the event,
+    // which has committed the block, so a GetUpdate right after InitUpdate finds the update.
+    WaitForCommit bool
+
+    // EventStartBlock makes SubscribeEvents replay the events from this block on before the
+    // live ones, e.g. from a saved checkpoint; nil sees only events committed after subscribing
+    EventStartBlock *uint64
+}
+
+// RetryPolicy controls how failed calls are retried. Submissions are only retried when the
+// transaction certainly did not commit (MVCC or phantom read conflicts), except InitUpdate,
+// which is idempotent through its ClientRequestID and is also retried when the peer was
+// unavailable. Queries are retried on both.
+type RetryPolicy struct {
+    MaxAttempts int           // attempts per call including the first; default 3, 1 disables retries
+    Backoff     time.Duration // wait before the second attempt, doubled after each retry; default 500ms
+}
+
+// Client is a connection to the chaincode as one wallet identity. It is safe for
+// concurrent use; Close releases the gateway connection.
+type Client struct {
+    gw            *gateway.Gateway
+    network       *gateway.Network
+    chaincode     string
+    retry         RetryPolicy
+    waitForCommit bool
+
+    mu       sync.Mutex
+    readPeer string // peer of the last commit event, queried when WaitForCommit is set
+}
+
+// New connects to the gateway using the connection profile and wallet identity
+func New(cfg Config) (*Client, error) {
+    if cfg.Channel == "" {
+        cfg.Channel = "mychannel"
+    }
+    if cfg.Chaincode == "" {
+        cfg.Chaincode = "bim"
+    }
+    if cfg.Retry.MaxAttempts <= 0 {
+        cfg.Retry.MaxAttempts = 3
+    }
+    if cfg.Retry.Backoff <= 0 {
+        cfg.Retry.Backoff = 500 * time.Millisecond
+    }
+
+    wallet, err := gateway.NewFileSystemWallet(cfg.Wallet)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open wallet %s: %v", cfg.Wallet, err)
+    }
+    if !wallet.Exists(cfg.Identity) {
+        return nil, fmt.Errorf("identity %q not found in wallet %s", cfg.Identity, cfg.Wallet)
+    }
+    opts := []gateway.ConnectOption{
+        gateway.WithConfig(config.FromFile(filepath.Clean(cfg.Profile))),
+        gateway.WithIdentity(wallet, cfg.Identity),
+    }
+    if cfg.EventStartBlock != nil {
+        opts = append(opts, gateway.WithBlockNum(*cfg.EventStartBlock))
+    }
+    gw, err := gateway.Connect(opts...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to gateway: %v", err)
+    }
+    network, err := gw.GetNetwork(cfg.Channel)
+    if err != nil {
+        gw.Close()
+        return nil, fmt.Errorf("failed to get channel %s: %v", cfg.Channel, err)
+    }
+    return &Client{gw: gw, network: network, chaincode: cfg.Chaincode, retry: cfg.Retry, waitForCommit: cfg.WaitForCommit}, nil
+}
+
+// Close releases the gateway connection
+func (c *Client) Close() {
+    c.gw.Close()
+}
+
+// InitUpdate submits a new model update and returns its UpdateID. When in.ClientRequestID
+// is empty a random one is set, so that retries of this call cannot create a second update.
+func (c *Client) InitUpdate(ctx context.Context, in UpdateInput) (string, error) {
+    if in.ClientRequestID == "" {
+        id, err := newRequestID()
+        if err != nil {
+            return "", err
+        }
+        in.ClientRequestID = id
+    }
+    payload, err := json.Marshal(in)
+    if err != nil {
+        return "", err
+    }
+    result, err := c.call(ctx, true, true, initContract, "InitBIMUpdate", string(payload))
+    if err != nil {
+        return "", err
+    }
+    return string(result), nil
+}
+
+// Approve records the caller's vote on an update. result is StatusApproved or StatusRejected;
+// a rejection needs a comment and one of the Reason* codes.
+func (c *Client) Approve(ctx context.Context, updateID string, result string, comment string, reasonCode string) error {
+    _, err := c.call(ctx, true, false, approvalContract, "ApproveBIMUpdate", updateID, result, comment, reasonCode)
+    return err
+}
+
+// Publish publishes an approved update
+func (c *Client) Publish(ctx context.Context, updateID string) error {
+    _, err := c.call(ctx, true, false, approvalContract, "PublishBIMUpdate", updateID)
+    return err
+}
+
+// GetUpdate returns an update with its approval record
+func (c *Client) GetUpdate(ctx context.Context, updateID string) (*HistoryRecord, error) {
+    data, err := c.call(ctx, false, true, queryContract, "QueryUpdate", updateID)
+    if err != nil {
+        return nil, err
+    }
+    var rec HistoryRecord
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return nil, fmt.Errorf("failed to parse QueryUpdate result: %v", err)
+    }
+    return &rec, nil
+}
+
+// PendingApprovals returns the updates waiting for the caller's vote, earliest deadline first
+func (c *Client) PendingApprovals(ctx context.Context) ([]PendingApproval, error) {
+    data, err := c.call(ctx, false, true, approvalContract, "QueryPendingApprovalsForCaller")
+    if err != nil {
+        return nil, err
+    }
+    var pending []PendingApproval
+    if err := json.Unmarshal(data, &pending); err != nil {
+        return nil, fmt.Errorf("failed to parse QueryPendingApprovalsForCaller result: %v", err)
+    }
+    return pending, nil
+}
+
+// ProjectStats returns aggregate statistics over the updates of modelIDs, or of every model when empty
+func (c *Client) ProjectStats(ctx context.Context, modelIDs []string) (*ProjectStats, error) {
+    if modelIDs == nil {
+        modelIDs = []string{}
+    }
+    arg, err := json.Marshal(modelIDs)
+    if err != nil {
+        return nil, err
+    }
+    data, err := c.call(ctx, false, true, queryContract, "QueryProjectStats", string(arg))
+    if err != nil {
+        return nil, err
+    }
+    var stats ProjectStats
+    if err := json.Unmarshal(data, &stats); err != nil {
+        return nil, fmt.Errorf("failed to parse QueryProjectStats result: %v", err)
+    }
+    return &stats, nil
+}
+
+// GetHistory returns one page of a model's updates; pass the returned Bookmark to get the next
+func (c *Client) GetHistory(ctx context.Context, modelID string, pageSize int, bookmark string) (*HistoryPage, error) {
+    data, err := c.call(ctx, false, true, queryContract, "QueryModelHistory", modelID, strconv.Itoa(pageSize), bookmark)
+    if err != nil {
+        return nil, err
+    }
+    var page HistoryPage
+    if err := json.Unmarshal(data, &page); err != nil {
+        return nil, fmt.Errorf("failed to parse QueryModelHistory result: %v", err)
+    }
+    return &page, nil
+}
+
+// AllHistory returns every update of a model, fetching pageSize records per query
+func (c *Client) AllHistory(ctx context.Context, modelID string, pageSize int) ([]HistoryRecord, error) {
+    var recs []HistoryRecord
+    bookmark := ""
+    for {
+        page, err := c.GetHistory(ctx, modelID, pageSize, bookmark)
+        if err != nil {
+            return nil, err
+        }
+        recs = append(recs, page.Records...)
+        if page.FetchedCount < pageSize || page.Bookmark == "" {
+            return recs, nil
+        }
+        bookmark = page.Bookmark
+    }
+}
+
+// Submit submits fn of contract ("" for the default SmartContract) with string arguments,
+// for functions without a typed method. Conflicts are retried according to Config.Retry.
+// block is the block the transaction was committed in when Config.WaitForCommit is set,
+// 0 otherwise.
+func (c *Client) Submit(ctx context.Context, contract string, fn string, args ...string) (result []byte, block uint64, err error) {
+    return c.callBlock(ctx, true, false, contract, fn, args...)
+}
+
+// Evaluate runs the query fn of contract ("" for the default SmartContract) with string
+// arguments, for functions without a typed method
+func (c *Client) Evaluate(ctx context.Context, contract string, fn string, args ...string) ([]byte, error) {
+    return c.call(ctx, false, true, contract, fn, args...)
+}
+
+// call runs one chaincode function with retries. submit selects SubmitTransaction over
+// EvaluateTransaction; idempotent allows retrying after unavailability errors.
+//
+// The gateway API takes no context: when ctx ends first, call returns ctx.Err() while
+// the pending request finishes in the background, so a cancelled submission may still commit.
+func (c *Client) call(ctx context.Context, submit bool, idempotent bool, contract string, fn string, args ...string) ([]byte, error) {
+    result, _, err := c.callBlock(ctx, submit, idempotent, contract, fn, args...)
+    return result, err
+}
+
+// callBlock is call that also returns the commit block of a submission made with
+// WaitForCommit
+func (c *Client) callBlock(ctx context.Context, submit bool, idempotent bool, contract string, fn string, args ...string) ([]byte, uint64, error) {
+    backoff := c.retry.Backoff
+    for attempt := 1; ; attempt++ {
+        result, block, err := c.invoke(ctx, submit, contract, fn, args)
+        if err == nil {
+            return result, block, nil
+        }
+        if ctx.Err() != nil {
+            return nil, 0, &Error{Op: fn, Kind: KindUnavailable, Err: ctx.Err()}
+        }
+        e := classify(fn, err)
+        retryable := e.Kind == KindConflict || (e.Kind == KindUnavailable && (!submit || idempotent))
+        if !retryable || attempt >= c.retry.MaxAttempts {
+            return nil, 0, e
+        }
+        select {
+        case <-time.After(backoff):
+        case <-ctx.Done():
+            return nil, 0, &Error{Op: fn, Kind: KindUnavailable, Err: ctx.Err()}
+        }
+        backoff *= 2
+    }
+}
+
+// invoke runs one attempt, giving up when ctx ends
+func (c *Client) invoke(ctx context.Context, submit bool, contract string, fn string, args []string) ([]byte, uint64, error) {
+    type outcome struct {
+        result []byte
+        block  uint64
+        err    error
+    }
+    done := make(chan outcome, 1)
+    go func() {
+        cc := c.network.GetContractWithName(c.chaincode, contract)
+        target := c.committedPeer()
+        var o outcome
+        switch {
+        case submit && c.waitForCommit:
+            o.result, o.block, o.err = c.submitCommitted(cc, fn, args)
+        case submit:
+            o.result, o.err = cc.SubmitTransaction(fn, args...)
+        case target != "":
+            o.result, o.err = c.evaluateOn(cc, target, fn, args)
+        default:
+            o.result, o.err = cc.EvaluateTransaction(fn, args...)
+        }
+        done <- o
+    }()
+    select {
+    case o := <-done:
+        return o.result, o.block, o.err
+    case <-ctx.Done():
+        return nil, 0, ctx.Err()
+    }
+}
+
+// submitCommitted submits a transaction and waits for its commit event, failing unless the
+// transaction was committed VALID. The peer that delivered the event serves later queries.
+func (c *Client) submitCommitted(cc *gateway.Contract, fn string, args []string) ([]byte, uint64, error) {
+    tx, err := cc.CreateTransaction(fn)
+    if err != nil {
+        return nil, 0, err
+    }
+    commit := tx.RegisterCommitEvent()
+    result, err := tx.Submit(args...)
+    if err != nil {
+        return nil, 0, err
+    }
+    ev, ok := <-commit
+    if !ok || ev == nil {
+        return nil, 0, fmt.Errorf("no commit event received")
+    }
+    if ev.TxValidationCode != pb.TxValidationCode_VALID {
+        // the code name, e.g. MVCC_READ_CONFLICT, is what classify matches
+        return nil, 0, fmt.Errorf("transaction %s was not committed: %s", ev.TxID, ev.TxValidationCode)
+    }
+    c.mu.Lock()
+    c.readPeer = ev.SourceURL
+    c.mu.Unlock()
+    return result, ev.BlockNumber, nil
+}
+
+// evaluateOn evaluates a query on the given peer
+func (c *Client) evaluateOn(cc *gateway.Contract, target string, fn string, args []string) ([]byte, error) {
+    tx, err := cc.CreateTransaction(fn, gateway.WithEndorsingPeers(target))
+    if err != nil {
+        return nil, err
+    }
+    return tx.Evaluate(args...)
+}
+
+// committedPeer returns the peer of the last commit event, or "" before the first
+func (c *Client) committedPeer() string {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.readPeer
+}
+
+// newRequestID returns a random ClientRequestID
+func newRequestID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("failed to generate ClientRequestID: %v", err)
+    }
+    return "req-" + hex.EncodeToString(b), nil
+}
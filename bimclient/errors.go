@@ -0,0 +1,150 @@
+package bimclient
+
+import (
+    "encoding/json"
+    "errors"
+    "strings"
+)
+
+// Kind classifies a failed call
+type Kind int
+
+const (
+    KindUnknown     Kind = iota
+    KindNotFound         // the update or record does not exist
+    KindPermission       // the identity's role or organization may not do this
+    KindInvalid          // the chaincode rejected the input or the update's current state
+    KindConflict         // the transaction lost an MVCC race and did not commit
+    KindUnavailable      // no peer answered, or the context ended
+    KindDuplicate        // the record, vote or nonce already exists
+)
+
+func (k Kind) String() string {
+    switch k {
+    case KindNotFound:
+        return "not found"
+    case KindPermission:
+        return "permission denied"
+    case KindInvalid:
+        return "invalid"
+    case KindConflict:
+        return "conflict"
+    case KindUnavailable:
+        return "unavailable"
+    case KindDuplicate:
+        return "duplicate"
+    }
+    return "unknown"
+}
+
+// Sentinels for errors.Is; an *Error matches the sentinel of its Kind
+var (
+    ErrNotFound    = errors.New("bimclient: not found")
+    ErrPermission  = errors.New("bimclient: permission denied")
+    ErrInvalid     = errors.New("bimclient: invalid")
+    ErrConflict    = errors.New("bimclient: conflict")
+    ErrUnavailable = errors.New("bimclient: unavailable")
+    ErrDuplicate   = errors.New("bimclient: duplicate")
+)
+
+// Error is a failed chaincode call
+type Error struct {
+    Op   string // chaincode function
+    Kind Kind
+    Code string // code of the chaincode's structured error, e.g. "NOT_FOUND"; empty for plain errors
+    Err  error  // error returned by the gateway
+}
+
+func (e *Error) Error() string {
+    return e.Op + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+    return e.Err
+}
+
+// Is matches the sentinel of e.Kind
+func (e *Error) Is(target error) bool {
+    switch target {
+    case ErrNotFound:
+        return e.Kind == KindNotFound
+    case ErrPermission:
+        return e.Kind == KindPermission
+    case ErrInvalid:
+        return e.Kind == KindInvalid
+    case ErrConflict:
+        return e.Kind == KindConflict
+    case ErrUnavailable:
+        return e.Kind == KindUnavailable
+    case ErrDuplicate:
+        return e.Kind == KindDuplicate
+    }
+    return false
+}
+
+// codeKinds map the codes of the chaincode's structured errors to a Kind
+var codeKinds = map[string]Kind{
+    "NOT_FOUND":     KindNotFound,
+    "UNAUTHORIZED":  KindPermission,
+    "INVALID_STATE": KindInvalid,
+    "DUPLICATE":     KindDuplicate,
+}
+
+// errorPatterns map message fragments of the gateway and the chaincode to a Kind, checked in order
+var errorPatterns = []struct {
+    fragment string
+    kind     Kind
+}{
+    {"MVCC_READ_CONFLICT", KindConflict},
+    {"PHANTOM_READ_CONFLICT", KindConflict},
+    {"authorization failed", KindPermission},
+    {"not authorized", KindPermission},
+    {"access denied", KindPermission},
+    {"does not exist", KindNotFound},
+    {"not found", KindNotFound},
+    {"deadline exceeded", KindUnavailable},
+    {"connection refused", KindUnavailable},
+    {"Unavailable", KindUnavailable},
+    {"timed out", KindUnavailable},
+    {"timeout", KindUnavailable},
+    {"failed to parse", KindInvalid},
+    {"required", KindInvalid},
+    {"must be", KindInvalid},
+    {"invalid", KindInvalid},
+    {"already", KindInvalid},
+}
+
+// classify wraps a gateway error in an *Error. The code of a structured chaincode error
+// decides the Kind; the message patterns apply to chaincode errors without a code and to
+// gateway errors.
+func classify(op string, err error) *Error {
+    msg := err.Error()
+    if code := errorCode(msg); code != "" {
+        kind, ok := codeKinds[code]
+        if !ok {
+            kind = KindUnknown
+        }
+        return &Error{Op: op, Kind: kind, Code: code, Err: err}
+    }
+    for _, p := range errorPatterns {
+        if strings.Contains(msg, p.fragment) {
+            return &Error{Op: op, Kind: p.kind, Err: err}
+        }
+    }
+    return &Error{Op: op, Kind: KindUnknown, Err: err}
+}
+
+// errorCode returns the code of the first {"Code":...} payload in msg, or ""
+func errorCode(msg string) string {
+    i := strings.Index(msg, `{"Code":`)
+    if i < 0 {
+        return ""
+    }
+    var payload struct {
+        Code string `json:"Code"`
+    }
+    if err := json.NewDecoder(strings.NewReader(msg[i:])).Decode(&payload); err != nil {
+        return ""
+    }
+    return payload.Code
+}
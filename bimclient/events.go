@@ -0,0 +1,64 @@
+package bimclient
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+)
+
+// Event is a chaincode event from a committed transaction
+type Event struct {
+    Name        string
+    TxID        string
+    BlockNumber uint64
+    Payload     []byte
+
+    // taken from the payload when present
+    ModelID  string
+    UpdateID string
+}
+
+// SubscribeEvents delivers the chaincode events whose name matches filter, a regular
+// expression such as "BIMUpdate.*" ("" for all), until ctx ends. The channel is closed
+// after ctx ends. Events are delivered in commit order; only events committed after the
+// subscription are seen unless Config.EventStartBlock is set, which replays from that block.
+func (c *Client) SubscribeEvents(ctx context.Context, filter string) (<-chan Event, error) {
+    if filter == "" {
+        filter = ".*"
+    }
+    cc := c.network.GetContract(c.chaincode)
+    reg, source, err := cc.RegisterEvent(filter)
+    if err != nil {
+        return nil, &Error{Op: "SubscribeEvents", Kind: KindUnavailable, Err: fmt.Errorf("failed to register for events: %v", err)}
+    }
+
+    events := make(chan Event)
+    go func() {
+        defer close(events)
+        defer cc.Unregister(reg)
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case ev, ok := <-source:
+                if !ok {
+                    return
+                }
+                e := Event{Name: ev.EventName, TxID: ev.TxID, BlockNumber: ev.BlockNumber, Payload: ev.Payload}
+                var ids struct {
+                    ModelID  string `json:"ModelID"`
+                    UpdateID string `json:"UpdateID"`
+                }
+                if json.Unmarshal(ev.Payload, &ids) == nil {
+                    e.ModelID, e.UpdateID = ids.ModelID, ids.UpdateID
+                }
+                select {
+                case events <- e:
+                case <-ctx.Done():
+                    return
+                }
+            }
+        }
+    }()
+    return events, nil
+}
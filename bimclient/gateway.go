@@ -0,0 +1,198 @@
+package bimclient
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// GatewayClient calls the REST gateway (bim-gateway) over HTTP, for tools that hold no
+// wallet. The gateway signs as UserID.
+//
+// A saturated gateway answers 503 or 429 with Retry-After. The client then waits that
+// long and retries, and until then every other call through the same GatewayClient waits
+// as well, so a bulk upload slows down as a whole instead of timing out request by request.
+type GatewayClient struct {
+    BaseURL string // e.g. "http://localhost:8080"
+    UserID  string
+    HTTP    *http.Client // default http.DefaultClient
+
+    // MaxWait bounds the time one call waits for Retry-After in total, default 2 minutes;
+    // the call then fails with ErrUnavailable
+    MaxWait time.Duration
+
+    mu        sync.Mutex
+    notBefore time.Time // no request is sent before this time
+}
+
+// NewGatewayClient returns a client of the gateway at baseURL acting as userID
+func NewGatewayClient(baseURL string, userID string) *GatewayClient {
+    return &GatewayClient{BaseURL: strings.TrimRight(baseURL, "/"), UserID: userID, MaxWait: 2 * time.Minute}
+}
+
+// InitUpdate submits a new model update through POST /updates and returns its UpdateID.
+// in.ClientRequestID is set when empty and also sent as Idempotency-Key, so a retry cannot
+// create a second update.
+func (g *GatewayClient) InitUpdate(ctx context.Context, in UpdateInput) (string, error) {
+    if in.ClientRequestID == "" {
+        id, err := newRequestID()
+        if err != nil {
+            return "", err
+        }
+        in.ClientRequestID = id
+    }
+    body, err := json.Marshal(in)
+    if err != nil {
+        return "", err
+    }
+    data, err := g.do(ctx, "InitBIMUpdate", http.MethodPost, "/updates", body, in.ClientRequestID)
+    if err != nil {
+        return "", err
+    }
+    var result struct {
+        UpdateID string `json:"updateId"`
+    }
+    if err := json.Unmarshal(data, &result); err != nil {
+        return "", fmt.Errorf("failed to parse the gateway response: %v", err)
+    }
+    return result.UpdateID, nil
+}
+
+// GetUpdate returns an update with its approval record through GET /updates/<UpdateID>
+func (g *GatewayClient) GetUpdate(ctx context.Context, updateID string) (*HistoryRecord, error) {
+    data, err := g.do(ctx, "QueryUpdate", http.MethodGet, "/updates/"+url.PathEscape(updateID), nil, "")
+    if err != nil {
+        return nil, err
+    }
+    var rec HistoryRecord
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return nil, fmt.Errorf("failed to parse QueryUpdate result: %v", err)
+    }
+    return &rec, nil
+}
+
+// do sends one request, waiting out Retry-After on 503 and 429
+func (g *GatewayClient) do(ctx context.Context, op string, method string, path string, body []byte, idempotencyKey string) ([]byte, error) {
+    maxWait := g.MaxWait
+    if maxWait <= 0 {
+        maxWait = 2 * time.Minute
+    }
+    deadline := time.Now().Add(maxWait)
+    target := g.BaseURL + path + "?userId=" + url.QueryEscape(g.UserID)
+    for {
+        if err := g.pace(ctx, deadline); err != nil {
+            return nil, &Error{Op: op, Kind: KindUnavailable, Err: err}
+        }
+        req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+        if err != nil {
+            return nil, err
+        }
+        if body != nil {
+            req.Header.Set("Content-Type", "application/json")
+        }
+        if idempotencyKey != "" {
+            req.Header.Set("Idempotency-Key", idempotencyKey)
+        }
+        client := g.HTTP
+        if client == nil {
+            client = http.DefaultClient
+        }
+        resp, err := client.Do(req)
+        if err != nil {
+            return nil, &Error{Op: op, Kind: KindUnavailable, Err: err}
+        }
+        data, err := io.ReadAll(resp.Body)
+        resp.Body.Close()
+        if err != nil {
+            return nil, &Error{Op: op, Kind: KindUnavailable, Err: err}
+        }
+        switch {
+        case resp.StatusCode/100 == 2:
+            return data, nil
+        case resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests:
+            g.backOff(retryAfter(resp.Header.Get("Retry-After")))
+            continue
+        }
+        return nil, gatewayError(op, resp.StatusCode, data)
+    }
+}
+
+// pace waits until the gateway accepts requests again; it fails without waiting when
+// that is after deadline or ctx ends first
+func (g *GatewayClient) pace(ctx context.Context, deadline time.Time) error {
+    g.mu.Lock()
+    notBefore := g.notBefore
+    g.mu.Unlock()
+    wait := time.Until(notBefore)
+    if wait <= 0 {
+        return nil
+    }
+    if notBefore.After(deadline) {
+        return errors.New("the gateway is busy")
+    }
+    if d, ok := ctx.Deadline(); ok && notBefore.After(d) {
+        return fmt.Errorf("the gateway is busy for %v: %w", wait.Round(time.Second), context.DeadlineExceeded)
+    }
+    t := time.NewTimer(wait)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
+
+// backOff holds every call back for wait
+func (g *GatewayClient) backOff(wait time.Duration) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    if until := time.Now().Add(wait); until.After(g.notBefore) {
+        g.notBefore = until
+    }
+}
+
+// retryAfter parses a Retry-After header, seconds or an HTTP date; 1s when missing
+func retryAfter(header string) time.Duration {
+    if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && secs >= 0 {
+        return time.Duration(secs) * time.Second
+    }
+    if t, err := http.ParseTime(header); err == nil {
+        if d := time.Until(t); d > 0 {
+            return d
+        }
+        return 0
+    }
+    return time.Second
+}
+
+// gatewayError classifies a failed gateway response by the chaincode error in its body,
+// else by its status
+func gatewayError(op string, status int, body []byte) *Error {
+    err := classify(op, fmt.Errorf("gateway returned %d: %s", status, strings.TrimSpace(string(body))))
+    if err.Kind != KindUnknown {
+        return err
+    }
+    switch status {
+    case http.StatusNotFound:
+        err.Kind = KindNotFound
+    case http.StatusUnauthorized, http.StatusForbidden:
+        err.Kind = KindPermission
+    case http.StatusBadRequest, http.StatusUnprocessableEntity:
+        err.Kind = KindInvalid
+    case http.StatusConflict:
+        err.Kind = KindConflict
+    case http.StatusBadGateway, http.StatusGatewayTimeout:
+        err.Kind = KindUnavailable
+    }
+    return err
+}
@@ -0,0 +1,94 @@
+package bimclient
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestGatewayClientHonoursRetryAfter(t *testing.T) {
+    var (
+        mu       sync.Mutex
+        keys     []string
+        rejected time.Time
+        queried  time.Time
+    )
+    shed := make(chan struct{})
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        mu.Lock()
+        defer mu.Unlock()
+        if r.URL.Path == "/updates/u1" {
+            queried = time.Now()
+            w.Write([]byte(`{"InitRecord":{"UpdateID":"u1"}}`))
+            return
+        }
+        keys = append(keys, r.Header.Get("Idempotency-Key"))
+        if len(keys) == 1 {
+            rejected = time.Now()
+            w.Header().Set("Retry-After", "1")
+            http.Error(w, "busy", http.StatusServiceUnavailable)
+            close(shed)
+            return
+        }
+        w.WriteHeader(http.StatusCreated)
+        w.Write([]byte(`{"updateId":"u1"}`))
+    }))
+    defer srv.Close()
+    c := NewGatewayClient(srv.URL, "1001")
+
+    created := make(chan error, 1)
+    go func() {
+        id, err := c.InitUpdate(context.Background(), UpdateInput{ModelID: "M-1", Version: "1.0"})
+        if err == nil && id != "u1" {
+            err = errors.New("unexpected update ID " + id)
+        }
+        created <- err
+    }()
+    // a call started during the back-off waits as well
+    <-shed
+    for backingOff := false; !backingOff; time.Sleep(time.Millisecond) {
+        c.mu.Lock()
+        backingOff = !c.notBefore.IsZero()
+        c.mu.Unlock()
+    }
+    if _, err := c.GetUpdate(context.Background(), "u1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := <-created; err != nil {
+        t.Fatal(err)
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+        t.Fatalf("Idempotency-Keys %q, want the same key on the retry", keys)
+    }
+    if waited := queried.Sub(rejected); waited < 900*time.Millisecond {
+        t.Fatalf("GetUpdate was sent %v after the 503, want the Retry-After of 1s", waited)
+    }
+}
+
+func TestGatewayClientGivesUpBeforeContextDeadline(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Retry-After", "30")
+        http.Error(w, "busy", http.StatusServiceUnavailable)
+    }))
+    defer srv.Close()
+    c := NewGatewayClient(srv.URL, "1001")
+
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    start := time.Now()
+    _, err := c.InitUpdate(ctx, UpdateInput{ModelID: "M-1", Version: "1.0"})
+    if !errors.Is(err, ErrUnavailable) {
+        t.Fatalf("err = %v, want ErrUnavailable", err)
+    }
+    // a Retry-After past the deadline fails at once instead of sleeping into the timeout
+    if elapsed := time.Since(start); elapsed > time.Second {
+        t.Fatalf("InitUpdate returned after %v", elapsed)
+    }
+}
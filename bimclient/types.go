@@ -0,0 +1,141 @@
+package bimclient
+
+// Update statuses as stored by the chaincode
+const (
+    StatusPendingValidation = "PENDING_VALIDATION"
+    StatusValidationFailed  = "VALIDATION_FAILED"
+    StatusQueued            = "QUEUED"
+    StatusInitialized       = "INITIALIZED"
+    StatusApproved          = "APPROVED"
+    StatusRejected          = "REJECTED"
+    StatusPublished         = "PUBLISHED"
+)
+
+// Rejection reason codes accepted by Approve
+const (
+    ReasonClash             = "CLASH"
+    ReasonStandardViolation = "STANDARD_VIOLATION"
+    ReasonIncomplete        = "INCOMPLETE"
+    ReasonOther             = "OTHER"
+)
+
+// Chaincode event names
+const (
+    EventInitialized = "BIMUpdateInitialized"
+    EventApproved    = "BIMUpdateApproved"
+    EventRejected    = "BIMUpdateRejected"
+    EventPublished   = "BIMUpdatePublished"
+    EventVote        = "BIMApprovalVoteRecorded"
+)
+
+// UpdateInput is the InitBIMUpdate payload
+type UpdateInput struct {
+    UpdateID    string `json:"UpdateID,omitempty"` // generated by the chaincode if empty
+    ModelID     string `json:"ModelID"`
+    Version     string `json:"Version"`
+    Description string `json:"Description"`
+    ReviewMode  string `json:"ReviewMode,omitempty"` // OPEN (default) or BLIND
+
+    Files       []FileEntry  `json:"Files,omitempty"`
+    Attachments []Attachment `json:"Attachments,omitempty"`
+    DependsOn   []string     `json:"DependsOn,omitempty"`
+
+    // base64 signature over the file hashes with the identity's key, see the
+    // chaincode's bim_detached_signature.go for the signed digest
+    DetachedSignature string `json:"DetachedSignature,omitempty"`
+
+    // idempotency key, set by InitUpdate when empty
+    ClientRequestID string `json:"ClientRequestID,omitempty"`
+}
+
+// FileEntry is one delivered file stored in IPFS
+type FileEntry struct {
+    Name          string `json:"Name"`
+    CID           string `json:"CID"`
+    Hash          string `json:"Hash"`
+    HashAlgorithm string `json:"HashAlgorithm,omitempty"`
+    Size          int64  `json:"Size"`
+    MimeType      string `json:"MimeType,omitempty"`
+}
+
+// Attachment is an off-chain payload such as a screenshot or clash report
+type Attachment struct {
+    Name      string `json:"Name"`
+    CID       string `json:"CID"`
+    SHA256    string `json:"SHA256"`
+    MediaType string `json:"MediaType,omitempty"`
+    Size      int64  `json:"Size,omitempty"`
+}
+
+// Update is a stored BIMUpdate
+type Update struct {
+    UpdateID            string       `json:"UpdateID"`
+    ModelID             string       `json:"ModelID"`
+    Version             string       `json:"Version"`
+    Description         string       `json:"Description"`
+    Initiator           string       `json:"Initiator"`
+    InitiatorDepartment string       `json:"InitiatorDepartment,omitempty"`
+    Timestamp           string       `json:"Timestamp"`
+    Status              string       `json:"Status"`
+    ReviewMode          string       `json:"ReviewMode,omitempty"`
+    Files               []FileEntry  `json:"Files,omitempty"`
+    Attachments         []Attachment `json:"Attachments,omitempty"`
+    DependsOn           []string     `json:"DependsOn,omitempty"`
+    PendingAfter        string       `json:"PendingAfter,omitempty"`
+    ConcurrentWith      []string     `json:"ConcurrentWith,omitempty"`
+    PreviousUpdateID    string       `json:"PreviousUpdateID,omitempty"`
+    RevisionNumber      int          `json:"RevisionNumber,omitempty"`
+}
+
+// Approval is the decision record of an update
+type Approval struct {
+    UpdateID      string `json:"UpdateID"`
+    Approver      string `json:"Approver"`
+    ApproveResult string `json:"ApproveResult"`
+    ReasonCode    string `json:"ReasonCode,omitempty"`
+    Comment       string `json:"Comment"`
+    Timestamp     string `json:"Timestamp"`
+}
+
+// PendingApproval is an update waiting for the caller's vote
+type PendingApproval struct {
+    Update           *Update `json:"Update"`
+    Deadline         string  `json:"Deadline"`
+    Overdue          bool    `json:"Overdue"`
+    Assigned         bool    `json:"Assigned"`         // the caller is an assigned reviewer
+    DepartmentNeeded bool    `json:"DepartmentNeeded"` // the policy still needs the caller's department
+}
+
+// ProjectStats aggregates the updates of a set of models
+type ProjectStats struct {
+    Models             []string          `json:"Models,omitempty"`
+    Updates            int               `json:"Updates"`
+    ByStatus           map[string]int    `json:"ByStatus"`
+    ByMonth            map[string]int    `json:"ByMonth"` // "YYYY-MM"
+    Approved           int               `json:"Approved"`
+    AvgHoursToApproval float64           `json:"AvgHoursToApproval"`
+    Departments        []DepartmentStats `json:"Departments"`
+}
+
+// DepartmentStats counts the decided and rejected updates initiated by one department
+type DepartmentStats struct {
+    Department    string  `json:"Department"`
+    Updates       int     `json:"Updates"`
+    Decided       int     `json:"Decided"`
+    Rejected      int     `json:"Rejected"`
+    RejectionRate float64 `json:"RejectionRate"`
+}
+
+// HistoryRecord is an update with its approval record, nil while undecided
+type HistoryRecord struct {
+    UpdateID string    `json:"UpdateID"`
+    Update   *Update   `json:"InitRecord"`
+    Approval *Approval `json:"ApprovalRecord"`
+}
+
+// HistoryPage is one page of GetHistory
+type HistoryPage struct {
+    Records      []HistoryRecord `json:"Records"`
+    FetchedCount int             `json:"FetchedCount"`
+    Bookmark     string          `json:"Bookmark"`
+}
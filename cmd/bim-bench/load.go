@@ -0,0 +1,242 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math/rand"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// Operations of a mix
+const (
+    opInit    = "init"
+    opApprove = "approve"
+    opQuery   = "query"
+)
+
+// mixEntry is one operation of --mix and its weight
+type mixEntry struct {
+    op     string
+    weight int
+}
+
+// parseMix parses "init=40,approve=40,query=20"; the weights need not add up to 100
+func parseMix(s string) ([]mixEntry, error) {
+    var mix []mixEntry
+    total := 0
+    for _, part := range strings.Split(s, ",") {
+        op, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+        if !ok {
+            return nil, fmt.Errorf("--mix: %q is not op=weight", part)
+        }
+        if op != opInit && op != opApprove && op != opQuery {
+            return nil, fmt.Errorf("--mix: unknown operation %q (init, approve or query)", op)
+        }
+        weight, err := strconv.Atoi(value)
+        if err != nil || weight < 0 {
+            return nil, fmt.Errorf("--mix: weight of %s must be a non-negative integer", op)
+        }
+        mix = append(mix, mixEntry{op: op, weight: weight})
+        total += weight
+    }
+    if total == 0 {
+        return nil, fmt.Errorf("--mix: no operation has a weight")
+    }
+    return mix, nil
+}
+
+// maxKnown bounds the updates remembered for query operations
+const maxKnown = 10000
+
+// bench runs the workers of one load run
+type bench struct {
+    opts     *options
+    mix      []mixEntry
+    total    int
+    modeler  *session
+    reviewer *session
+    runID    string
+
+    seq     uint64      // init operations started, numbers the versions
+    started int64       // operations started, for --ops
+    pending chan string // initialized updates waiting for an approve operation
+
+    mu    sync.Mutex
+    known []string // updates a query operation may read
+    stats *stats
+}
+
+func newBench(opts *options, mix []mixEntry, modeler *session, reviewer *session) *bench {
+    total := 0
+    for _, m := range mix {
+        total += m.weight
+    }
+    return &bench{
+        opts:     opts,
+        mix:      mix,
+        total:    total,
+        modeler:  modeler,
+        reviewer: reviewer,
+        runID:    strconv.FormatInt(time.Now().Unix(), 36),
+        pending:  make(chan string, maxKnown),
+        stats:    newStats(),
+    }
+}
+
+// run starts the workers and returns the report once ctx is done or --ops operations
+// were started, and the operations in flight have finished
+func (b *bench) run(ctx context.Context) *report {
+    tokens := limiter(ctx, b.opts.rate)
+    var wg sync.WaitGroup
+    start := time.Now()
+    for w := 0; w < b.opts.workers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            b.worker(ctx, w, tokens)
+        }(w)
+    }
+    wg.Wait()
+    return b.stats.report(b.opts, time.Since(start))
+}
+
+func (b *bench) worker(ctx context.Context, w int, tokens <-chan struct{}) {
+    rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)))
+    for {
+        if tokens != nil {
+            select {
+            case <-ctx.Done():
+                return
+            case <-tokens:
+            }
+        } else if ctx.Err() != nil {
+            return
+        }
+        if b.opts.ops > 0 && atomic.AddInt64(&b.started, 1) > int64(b.opts.ops) {
+            return
+        }
+        b.do(w, b.pick(rng), rng)
+    }
+}
+
+// pick draws an operation according to the weights of the mix
+func (b *bench) pick(rng *rand.Rand) string {
+    n := rng.Intn(b.total)
+    for _, m := range b.mix {
+        if n < m.weight {
+            return m.op
+        }
+        n -= m.weight
+    }
+    return b.mix[len(b.mix)-1].op
+}
+
+// do runs one operation and records it. approve and query fall back to init while no
+// update is available to them.
+func (b *bench) do(w int, op string, rng *rand.Rand) {
+    var updateID string
+    switch op {
+    case opApprove:
+        select {
+        case updateID = <-b.pending:
+        default:
+            op = opInit
+        }
+    case opQuery:
+        if updateID = b.knownUpdate(rng); updateID == "" {
+            op = opInit
+        }
+    }
+
+    switch op {
+    case opInit:
+        payload, err := b.initPayload(w)
+        if err != nil {
+            b.stats.record(op, 0, err)
+            return
+        }
+        start := time.Now()
+        result, err := b.modeler.submit(initContract, "InitBIMUpdate", string(payload))
+        b.stats.record(op, time.Since(start), err)
+        if err == nil {
+            b.created(strings.TrimSpace(string(result)))
+        }
+    case opApprove:
+        start := time.Now()
+        _, err := b.reviewer.submit(approvalContract, "ApproveBIMUpdate", updateID, "APPROVED", "bim-bench", "")
+        b.stats.record(op, time.Since(start), err)
+    case opQuery:
+        start := time.Now()
+        _, err := b.modeler.evaluate(queryContract, "QueryUpdate", updateID)
+        b.stats.record(op, time.Since(start), err)
+    }
+}
+
+// initPayload returns an InitBIMUpdate payload for a new version of the worker's model.
+// Every worker has a model of its own, so init operations do not conflict with each other.
+func (b *bench) initPayload(w int) ([]byte, error) {
+    seq := atomic.AddUint64(&b.seq, 1)
+    return json.Marshal(map[string]string{
+        "ModelID":     fmt.Sprintf("BENCH-%s-%03d", b.runID, w+1),
+        "Version":     fmt.Sprintf("1.%d", seq),
+        "Description": "bim-bench load update",
+    })
+}
+
+// created makes a new update available to approve and query operations
+func (b *bench) created(updateID string) {
+    if updateID == "" {
+        return
+    }
+    select {
+    case b.pending <- updateID:
+    default:
+    }
+    b.mu.Lock()
+    if len(b.known) < maxKnown {
+        b.known = append(b.known, updateID)
+    } else {
+        b.known[rand.Intn(maxKnown)] = updateID
+    }
+    b.mu.Unlock()
+}
+
+func (b *bench) knownUpdate(rng *rand.Rand) string {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if len(b.known) == 0 {
+        return ""
+    }
+    return b.known[rng.Intn(len(b.known))]
+}
+
+// limiter returns a channel that yields rate tokens per second until ctx is done, or
+// nil for an unlimited rate
+func limiter(ctx context.Context, rate float64) <-chan struct{} {
+    if rate <= 0 {
+        return nil
+    }
+    tokens := make(chan struct{})
+    go func() {
+        ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                select {
+                case tokens <- struct{}{}:
+                case <-ctx.Done():
+                    return
+                }
+            }
+        }
+    }()
+    return tokens
+}
@@ -0,0 +1,33 @@
+// Command bim-bench generates load on a deployed BIM chaincode through the Fabric
+// gateway and reports throughput, latency percentiles and failures per operation.
+//
+// Workers run a weighted mix of operations for a fixed duration or number of
+// operations, optionally capped at a rate:
+//
+//	bim-bench --mix init=40,approve=40,query=20 --workers 16 --duration 60s
+//	bim-bench --mix query=100 --ops 20000 --rate 500 --output json
+//
+// init submits InitBIMUpdate as the modeler identity; approve votes APPROVED on an
+// update an earlier init created, as the reviewer identity; query evaluates QueryUpdate
+// on one of them. approve and query run an init instead while no update is available.
+// Failed operations are counted by kind: endorsement (the peers refused or disagreed),
+// chaincode (a contract returned an error), mvcc (the transaction lost a read conflict
+// at commit), timeout and other.
+//
+// The numbers include the gateway, endorsement, ordering and commit. For the contracts
+// alone, without a network, see make simulate and the benchmarks of chaincodetest:
+//
+//	make test TEST_ARGS="-run NONE -bench ."
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
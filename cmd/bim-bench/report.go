@@ -0,0 +1,210 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "time"
+)
+
+// Failure kinds of the report
+const (
+    failMVCC        = "mvcc"
+    failChaincode   = "chaincode"
+    failEndorsement = "endorsement"
+    failTimeout     = "timeout"
+    failOther       = "other"
+)
+
+// failurePatterns map message fragments of gateway errors to a failure kind, checked in
+// order. A contract error reaches the gateway as a failed proposal, so it is matched
+// before the endorsement patterns.
+var failurePatterns = []struct {
+    fragment string
+    kind     string
+}{
+    {"MVCC_READ_CONFLICT", failMVCC},
+    {"PHANTOM_READ_CONFLICT", failMVCC},
+    {"Chaincode status Code: (500)", failChaincode},
+    {"chaincode response 500", failChaincode},
+    {"ENDORSEMENT_POLICY_FAILURE", failEndorsement},
+    {"ProposalResponsePayloads do not match", failEndorsement},
+    {"endorsement", failEndorsement},
+    {"Endorser", failEndorsement},
+    {"deadline exceeded", failTimeout},
+    {"timed out", failTimeout},
+    {"timeout", failTimeout},
+}
+
+func failureKind(err error) string {
+    msg := err.Error()
+    for _, p := range failurePatterns {
+        if strings.Contains(msg, p.fragment) {
+            return p.kind
+        }
+    }
+    return failOther
+}
+
+// maxErrors bounds the error messages kept for the report
+const maxErrors = 20
+
+// stats collects the outcome of every operation
+type stats struct {
+    mu       sync.Mutex
+    samples  map[string][]time.Duration // latencies of successful operations
+    failures map[string]map[string]int  // operation -> failure kind -> count
+    errors   []string
+}
+
+func newStats() *stats {
+    return &stats{samples: map[string][]time.Duration{}, failures: map[string]map[string]int{}}
+}
+
+func (s *stats) record(op string, d time.Duration, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err == nil {
+        s.samples[op] = append(s.samples[op], d)
+        return
+    }
+    if s.failures[op] == nil {
+        s.failures[op] = map[string]int{}
+    }
+    s.failures[op][failureKind(err)]++
+    if len(s.errors) < maxErrors {
+        s.errors = append(s.errors, fmt.Sprintf("%s: %v", op, err))
+    }
+}
+
+// report is the result of a run. Latencies are those of successful operations, TPS
+// counts successful operations per second of the run.
+type report struct {
+    Elapsed    time.Duration
+    Workers    int
+    Rate       float64
+    Mix        string
+    Total      opReport
+    Operations []opReport
+    Errors     []string `json:",omitempty"`
+}
+
+// opReport summarizes one operation, or all of them
+type opReport struct {
+    Operation string
+    Count     int
+    OK        int
+    Failures  map[string]int `json:",omitempty"`
+    TPS       float64
+    Mean      time.Duration
+    P50       time.Duration
+    P95       time.Duration
+    P99       time.Duration
+    Max       time.Duration
+}
+
+func (s *stats) report(opts *options, elapsed time.Duration) *report {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    r := &report{Elapsed: elapsed, Workers: opts.workers, Rate: opts.rate, Mix: opts.mix, Errors: s.errors}
+
+    ops := map[string]bool{}
+    for op := range s.samples {
+        ops[op] = true
+    }
+    for op := range s.failures {
+        ops[op] = true
+    }
+    names := make([]string, 0, len(ops))
+    for op := range ops {
+        names = append(names, op)
+    }
+    sort.Strings(names)
+
+    var all []time.Duration
+    allFailures := map[string]int{}
+    for _, op := range names {
+        r.Operations = append(r.Operations, newOpReport(op, s.samples[op], s.failures[op], elapsed))
+        all = append(all, s.samples[op]...)
+        for kind, n := range s.failures[op] {
+            allFailures[kind] += n
+        }
+    }
+    r.Total = newOpReport("all", all, allFailures, elapsed)
+    return r
+}
+
+func newOpReport(op string, samples []time.Duration, failures map[string]int, elapsed time.Duration) opReport {
+    r := opReport{Operation: op, OK: len(samples), Count: len(samples)}
+    if len(failures) > 0 {
+        r.Failures = failures
+        for _, n := range failures {
+            r.Count += n
+        }
+    }
+    if elapsed > 0 {
+        r.TPS = float64(len(samples)) / elapsed.Seconds()
+    }
+    if len(samples) == 0 {
+        return r
+    }
+    sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+    var total time.Duration
+    for _, d := range samples {
+        total += d
+    }
+    at := func(q float64) time.Duration { return samples[int(q*float64(len(samples)-1))] }
+    r.Mean = total / time.Duration(len(samples))
+    r.P50, r.P95, r.P99 = at(0.50), at(0.95), at(0.99)
+    r.Max = samples[len(samples)-1]
+    return r
+}
+
+func printReport(opts *options, r *report) error {
+    if opts.output == "json" {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        return enc.Encode(r)
+    }
+
+    rate := "unlimited"
+    if r.Rate > 0 {
+        rate = fmt.Sprintf("%g/s", r.Rate)
+    }
+    fmt.Printf("elapsed %v, %d workers, rate %s, mix %s\n\n", r.Elapsed.Round(time.Millisecond), r.Workers, rate, r.Mix)
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "OPERATION\tCOUNT\tOK\tTPS\tMEAN\tP50\tP95\tP99\tMAX\tFAILURES")
+    for _, op := range append(r.Operations, r.Total) {
+        fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%v\t%v\t%v\t%v\t%v\t%s\n", op.Operation, op.Count, op.OK, op.TPS,
+            op.Mean.Round(time.Millisecond), op.P50.Round(time.Millisecond), op.P95.Round(time.Millisecond),
+            op.P99.Round(time.Millisecond), op.Max.Round(time.Millisecond), formatFailures(op.Failures))
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    for _, e := range r.Errors {
+        fmt.Println("error:", e)
+    }
+    return nil
+}
+
+// formatFailures renders failure counts as "endorsement=2 mvcc=5", or "-"
+func formatFailures(failures map[string]int) string {
+    if len(failures) == 0 {
+        return "-"
+    }
+    kinds := make([]string, 0, len(failures))
+    for kind := range failures {
+        kinds = append(kinds, kind)
+    }
+    sort.Strings(kinds)
+    parts := make([]string, len(kinds))
+    for i, kind := range kinds {
+        parts[i] = fmt.Sprintf("%s=%d", kind, failures[kind])
+    }
+    return strings.Join(parts, " ")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "time"
+
+    "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+    "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+    "github.com/spf13/cobra"
+)
+
+// Contract names as registered in the chaincode
+const (
+    initContract     = "SmartContract"
+    approvalContract = "ApprovalContract"
+    queryContract    = "QueryContract"
+)
+
+type options struct {
+    profile   string
+    wallet    string
+    channel   string
+    chaincode string
+    modeler   string
+    reviewer  string
+
+    mix      string
+    workers  int
+    duration time.Duration
+    ops      int
+    rate     float64
+    output   string
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "bim-bench",
+        Short:         "Generate load on the BIM chaincode and report throughput and latencies",
+        Args:          cobra.NoArgs,
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if opts.output != "json" && opts.output != "table" {
+                return fmt.Errorf("--output must be json or table")
+            }
+            if opts.workers <= 0 {
+                return fmt.Errorf("--workers must be positive")
+            }
+            mix, err := parseMix(opts.mix)
+            if err != nil {
+                return err
+            }
+            return run(opts, mix)
+        },
+    }
+
+    flags := root.Flags()
+    flags.StringVar(&opts.profile, "profile", envOr("BIM_BENCH_PROFILE", "testnet/_gateways/org1gateway.json"), "connection profile (env BIM_BENCH_PROFILE)")
+    flags.StringVar(&opts.wallet, "wallet", envOr("BIM_BENCH_WALLET", "testnet/_wallets/Org1"), "filesystem wallet directory (env BIM_BENCH_WALLET)")
+    flags.StringVar(&opts.channel, "channel", envOr("BIM_BENCH_CHANNEL", "mychannel"), "channel name (env BIM_BENCH_CHANNEL)")
+    flags.StringVar(&opts.chaincode, "chaincode", envOr("BIM_BENCH_CHAINCODE", "bim"), "chaincode name (env BIM_BENCH_CHAINCODE)")
+    flags.StringVar(&opts.modeler, "modeler", envOr("BIM_BENCH_MODELER", "e2e-modeler"), "wallet identity with role=modeler, runs init and query (env BIM_BENCH_MODELER)")
+    flags.StringVar(&opts.reviewer, "reviewer", envOr("BIM_BENCH_REVIEWER", "e2e-reviewer"), "wallet identity with role=professional, runs approve (env BIM_BENCH_REVIEWER)")
+    flags.StringVar(&opts.mix, "mix", "init=40,approve=40,query=20", "operation weights")
+    flags.IntVar(&opts.workers, "workers", 8, "concurrent workers")
+    flags.DurationVar(&opts.duration, "duration", 30*time.Second, "run time, unless --ops is given")
+    flags.IntVar(&opts.ops, "ops", 0, "stop after this many operations instead of after --duration")
+    flags.Float64Var(&opts.rate, "rate", 0, "operations per second over all workers (0: as fast as possible)")
+    flags.StringVarP(&opts.output, "output", "o", "table", "output format: json or table")
+    return root
+}
+
+func run(opts *options, mix []mixEntry) error {
+    modeler, err := connect(opts, opts.modeler)
+    if err != nil {
+        return err
+    }
+    defer modeler.Close()
+    reviewer, err := connect(opts, opts.reviewer)
+    if err != nil {
+        return err
+    }
+    defer reviewer.Close()
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    if opts.ops <= 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, opts.duration)
+        defer cancel()
+    }
+
+    b := newBench(opts, mix, modeler, reviewer)
+    report := b.run(ctx)
+    if err := printReport(opts, report); err != nil {
+        return err
+    }
+    if report.Total.OK == 0 {
+        return fmt.Errorf("no operation succeeded")
+    }
+    return nil
+}
+
+// session is an open gateway connection of one identity, bound to the configured channel.
+// The gateway may be used by several workers at once.
+type session struct {
+    gw      *gateway.Gateway
+    network *gateway.Network
+    opts    *options
+}
+
+// connect opens the gateway using the connection profile and the wallet identity label
+func connect(opts *options, identity string) (*session, error) {
+    wallet, err := gateway.NewFileSystemWallet(opts.wallet)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open wallet %s: %v", opts.wallet, err)
+    }
+    if !wallet.Exists(identity) {
+        return nil, fmt.Errorf("identity %q not found in wallet %s", identity, opts.wallet)
+    }
+
+    gw, err := gateway.Connect(
+        gateway.WithConfig(config.FromFile(filepath.Clean(opts.profile))),
+        gateway.WithIdentity(wallet, identity),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to gateway as %s: %v", identity, err)
+    }
+    network, err := gw.GetNetwork(opts.channel)
+    if err != nil {
+        gw.Close()
+        return nil, fmt.Errorf("failed to get channel %s: %v", opts.channel, err)
+    }
+    return &session{gw: gw, network: network, opts: opts}, nil
+}
+
+func (s *session) Close() {
+    s.gw.Close()
+}
+
+// submit sends a transaction to be endorsed and committed
+func (s *session) submit(contract string, fn string, args ...string) ([]byte, error) {
+    return s.network.GetContractWithName(s.opts.chaincode, contract).SubmitTransaction(fn, args...)
+}
+
+// evaluate runs a read-only query on a peer
+func (s *session) evaluate(contract string, fn string, args ...string) ([]byte, error) {
+    return s.network.GetContractWithName(s.opts.chaincode, contract).EvaluateTransaction(fn, args...)
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "fmt"
+    "math/big"
+    "net/http"
+    "strings"
+)
+
+// caClient is a minimal Fabric CA REST client covering register and enroll
+type caClient struct {
+    url    string
+    caName string
+    http   *http.Client
+}
+
+// credential is a PEM certificate and private key pair
+type credential struct {
+    certPEM string
+    keyPEM  string
+}
+
+// registration is a new CA user and the attributes the chaincode checks
+type registration struct {
+    ID          string
+    Secret      string
+    Type        string
+    Affiliation string
+    Role        string
+    Department  string
+}
+
+type caResponse struct {
+    Success bool            `json:"success"`
+    Result  json.RawMessage `json:"result"`
+    Errors  []struct {
+        Code    int    `json:"code"`
+        Message string `json:"message"`
+    } `json:"errors"`
+}
+
+// register creates the user with role/department as ecert attributes, so they are
+// embedded in every certificate enrolled for it. Returns the enrollment secret.
+func (c *caClient) register(ctx context.Context, registrar *credential, reg *registration) (string, error) {
+    type attr struct {
+        Name  string `json:"name"`
+        Value string `json:"value"`
+        ECert bool   `json:"ecert"`
+    }
+    attrs := []attr{{Name: "role", Value: reg.Role, ECert: true}}
+    if reg.Department != "" {
+        attrs = append(attrs, attr{Name: "department", Value: reg.Department, ECert: true})
+    }
+    body, err := json.Marshal(map[string]interface{}{
+        "id":              reg.ID,
+        "type":            reg.Type,
+        "secret":          reg.Secret,
+        "affiliation":     reg.Affiliation,
+        "max_enrollments": -1,
+        "attrs":           attrs,
+        "caname":          c.caName,
+    })
+    if err != nil {
+        return "", err
+    }
+
+    const uri = "/api/v1/register"
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+uri, bytes.NewReader(body))
+    if err != nil {
+        return "", err
+    }
+    token, err := authToken(registrar, http.MethodPost, uri, body)
+    if err != nil {
+        return "", err
+    }
+    req.Header.Set("Authorization", token)
+
+    var result struct {
+        Secret string `json:"secret"`
+    }
+    if err := c.do(req, &result); err != nil {
+        return "", fmt.Errorf("register %s failed: %v", reg.ID, err)
+    }
+    return result.Secret, nil
+}
+
+// enroll generates a P-256 key and has the CA sign a certificate for it
+func (c *caClient) enroll(ctx context.Context, id string, secret string) (*credential, error) {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        return nil, err
+    }
+    csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: id}}, key)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create CSR: %v", err)
+    }
+    body, err := json.Marshal(map[string]interface{}{
+        "certificate_request": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+        "caname":              c.caName,
+    })
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/api/v1/enroll", bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    req.SetBasicAuth(id, secret)
+
+    var result struct {
+        Cert string `json:"Cert"`
+    }
+    if err := c.do(req, &result); err != nil {
+        return nil, fmt.Errorf("enroll %s failed: %v", id, err)
+    }
+    certPEM, err := base64.StdEncoding.DecodeString(result.Cert)
+    if err != nil {
+        return nil, fmt.Errorf("invalid certificate in CA response: %v", err)
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(key)
+    if err != nil {
+        return nil, err
+    }
+    return &credential{
+        certPEM: string(certPEM),
+        keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+    }, nil
+}
+
+func (c *caClient) do(req *http.Request, result interface{}) error {
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := c.http.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    var cr caResponse
+    if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+        return fmt.Errorf("CA returned %s with an unreadable body: %v", resp.Status, err)
+    }
+    if !cr.Success {
+        msgs := make([]string, 0, len(cr.Errors))
+        for _, e := range cr.Errors {
+            msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+        }
+        return fmt.Errorf("CA error: %s", strings.Join(msgs, "; "))
+    }
+    return json.Unmarshal(cr.Result, result)
+}
+
+// authToken builds the Fabric CA token "<b64 cert>.<b64 signature>" where the
+// signature covers method.b64(uri).b64(body).b64(cert) and must be low-S
+func authToken(cred *credential, method string, uri string, body []byte) (string, error) {
+    block, _ := pem.Decode([]byte(cred.keyPEM))
+    if block == nil {
+        return "", fmt.Errorf("registrar key is not PEM encoded")
+    }
+    parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+        if parsed, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+            return "", fmt.Errorf("failed to parse registrar key: %v", err)
+        }
+    }
+    key, ok := parsed.(*ecdsa.PrivateKey)
+    if !ok {
+        return "", fmt.Errorf("registrar key must be ECDSA, got %T", parsed)
+    }
+
+    b64 := base64.StdEncoding.EncodeToString
+    b64cert := b64([]byte(cred.certPEM))
+    digest := sha256.Sum256([]byte(method + "." + b64([]byte(uri)) + "." + b64(body) + "." + b64cert))
+    sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+    if err != nil {
+        return "", err
+    }
+
+    var rs struct{ R, S *big.Int }
+    if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+        return "", err
+    }
+    n := key.Curve.Params().N
+    if rs.S.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+        rs.S.Sub(n, rs.S)
+        if sig, err = asn1.Marshal(rs); err != nil {
+            return "", err
+        }
+    }
+    return b64cert + "." + b64(sig), nil
+}
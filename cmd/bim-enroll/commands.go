@@ -0,0 +1,181 @@
+package main
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+    "github.com/spf13/cobra"
+)
+
+// Roles accepted by the chaincode's authorizeCallerRole
+var chaincodeRoles = []string{"modeler", "professional", "bim_lead", "auditor", "surveyor"}
+
+type options struct {
+    caURL   string
+    caName  string
+    tlsCert string
+    mspID   string
+    wallet  string
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "bim-enroll",
+        Short:         "Register and enroll BIM chaincode users with Fabric CA",
+        SilenceUsage:  true,
+        SilenceErrors: true,
+    }
+    flags := root.PersistentFlags()
+    flags.StringVar(&opts.caURL, "ca-url", envOr("BIM_CA_URL", "https://localhost:7054"), "Fabric CA URL (env BIM_CA_URL)")
+    flags.StringVar(&opts.caName, "ca-name", envOr("BIM_CA_NAME", ""), "CA name when the server hosts several CAs (env BIM_CA_NAME)")
+    flags.StringVar(&opts.tlsCert, "tls-cert", envOr("BIM_CA_TLS_CERT", ""), "PEM file with the CA's TLS root certificate (env BIM_CA_TLS_CERT)")
+    flags.StringVar(&opts.mspID, "msp-id", envOr("BIM_MSP_ID", "Org1MSP"), "MSP ID written to wallet entries (env BIM_MSP_ID)")
+    flags.StringVar(&opts.wallet, "wallet", envOr("BIMCTL_WALLET", "wallet"), "filesystem wallet directory (env BIMCTL_WALLET)")
+
+    root.AddCommand(newEnrollCommand(opts), newRegisterCommand(opts))
+    return root
+}
+
+func newEnrollCommand(opts *options) *cobra.Command {
+    var id, secret, label string
+    cmd := &cobra.Command{
+        Use:   "enroll",
+        Short: "Enroll an existing CA registration (e.g. the bootstrap admin) into the wallet",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if id == "" || secret == "" {
+                return fmt.Errorf("--id and --secret are required")
+            }
+            ca, wallet, err := setup(opts)
+            if err != nil {
+                return err
+            }
+            if label == "" {
+                label = id
+            }
+            cred, err := ca.enroll(context.Background(), id, secret)
+            if err != nil {
+                return err
+            }
+            if err := wallet.Put(label, gateway.NewX509Identity(opts.mspID, cred.certPEM, cred.keyPEM)); err != nil {
+                return fmt.Errorf("failed to write wallet entry: %v", err)
+            }
+            fmt.Printf("enrolled %s into wallet %s as %q\n", id, opts.wallet, label)
+            return nil
+        },
+    }
+    cmd.Flags().StringVar(&id, "id", "", "enrollment ID")
+    cmd.Flags().StringVar(&secret, "secret", "", "enrollment secret")
+    cmd.Flags().StringVar(&label, "label", "", "wallet label (defaults to --id)")
+    return cmd
+}
+
+func newRegisterCommand(opts *options) *cobra.Command {
+    var reg registration
+    var registrar string
+    cmd := &cobra.Command{
+        Use:   "register",
+        Short: "Register a user with role/department attributes, enroll it and add it to the wallet",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if reg.ID == "" {
+                return fmt.Errorf("--id is required")
+            }
+            if !contains(chaincodeRoles, reg.Role) {
+                return fmt.Errorf("--role must be one of %s", strings.Join(chaincodeRoles, ", "))
+            }
+            ca, wallet, err := setup(opts)
+            if err != nil {
+                return err
+            }
+            if wallet.Exists(reg.ID) {
+                return fmt.Errorf("wallet %s already holds an identity %q", opts.wallet, reg.ID)
+            }
+            admin, err := loadCredential(wallet, registrar)
+            if err != nil {
+                return err
+            }
+
+            ctx := context.Background()
+            secret, err := ca.register(ctx, admin, &reg)
+            if err != nil {
+                return err
+            }
+            cred, err := ca.enroll(ctx, reg.ID, secret)
+            if err != nil {
+                return err
+            }
+            if err := wallet.Put(reg.ID, gateway.NewX509Identity(opts.mspID, cred.certPEM, cred.keyPEM)); err != nil {
+                return fmt.Errorf("failed to write wallet entry: %v", err)
+            }
+            fmt.Printf("registered %s (role=%s department=%s) and added it to wallet %s\n", reg.ID, reg.Role, reg.Department, opts.wallet)
+            return nil
+        },
+    }
+    cmd.Flags().StringVar(&registrar, "registrar", "admin", "wallet label of the registrar identity")
+    cmd.Flags().StringVar(&reg.ID, "id", "", "enrollment ID of the new user")
+    cmd.Flags().StringVar(&reg.Secret, "secret", "", "enrollment secret (generated by the CA when empty)")
+    cmd.Flags().StringVar(&reg.Role, "role", "", "chaincode role: "+strings.Join(chaincodeRoles, ", "))
+    cmd.Flags().StringVar(&reg.Department, "department", "", "department attribute used by approval policies")
+    cmd.Flags().StringVar(&reg.Affiliation, "affiliation", "", "CA affiliation, e.g. org1.department1")
+    cmd.Flags().StringVar(&reg.Type, "type", "client", "identity type")
+    return cmd
+}
+
+// setup builds the CA client and opens the wallet
+func setup(opts *options) (*caClient, *gateway.Wallet, error) {
+    client := &http.Client{Timeout: 30 * time.Second}
+    if opts.tlsCert != "" {
+        pemData, err := os.ReadFile(opts.tlsCert)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to read TLS certificate: %v", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pemData) {
+            return nil, nil, fmt.Errorf("no certificates found in %s", opts.tlsCert)
+        }
+        client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+    }
+    wallet, err := gateway.NewFileSystemWallet(opts.wallet)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to open wallet %s: %v", opts.wallet, err)
+    }
+    return &caClient{url: strings.TrimSuffix(opts.caURL, "/"), caName: opts.caName, http: client}, wallet, nil
+}
+
+// loadCredential reads the certificate and key of a wallet identity
+func loadCredential(wallet *gateway.Wallet, label string) (*credential, error) {
+    id, err := wallet.Get(label)
+    if err != nil {
+        return nil, fmt.Errorf("registrar %q not found in wallet: %v", label, err)
+    }
+    x, ok := id.(*gateway.X509Identity)
+    if !ok {
+        return nil, fmt.Errorf("registrar %q is not an X.509 identity", label)
+    }
+    return &credential{certPEM: x.Certificate(), keyPEM: x.Key()}, nil
+}
+
+func contains(list []string, v string) bool {
+    for _, s := range list {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
@@ -0,0 +1,21 @@
+// Command bim-enroll onboards users of the BIM chaincode with Fabric CA.
+//
+// It registers users with the role and department attributes that the chaincode's
+// authorizeCallerRole and approval policies read, enrolls them and writes the
+// resulting identities into a filesystem wallet that bimctl can use:
+//
+//	bim-enroll enroll --id admin --secret adminpw
+//	bim-enroll register --id alice --role modeler --department architecture
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/golang/protobuf/proto"
+    "github.com/hyperledger/fabric-protos-go/common"
+    "github.com/hyperledger/fabric-protos-go/ledger/rwset"
+    "github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+    "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// stateWrite is one key written or deleted by a committed transaction
+type stateWrite struct {
+    TxID     string
+    Key      string
+    Value    []byte
+    IsDelete bool
+}
+
+// blockWrites returns the world-state writes of namespace made by the valid
+// endorser transactions of block, in commit order
+func blockWrites(block *common.Block, namespace string) ([]stateWrite, error) {
+    var filter []byte
+    if md := block.GetMetadata().GetMetadata(); len(md) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+        filter = md[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+    }
+
+    var writes []stateWrite
+    for i, data := range block.GetData().GetData() {
+        // invalid transactions (MVCC conflicts, endorsement failures) never touched the state
+        if i >= len(filter) || peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+            continue
+        }
+        txWrites, err := transactionWrites(data, namespace)
+        if err != nil {
+            return nil, fmt.Errorf("transaction %d: %v", i, err)
+        }
+        writes = append(writes, txWrites...)
+    }
+    return writes, nil
+}
+
+// transactionWrites unpacks one envelope down to the key/value writes of namespace
+func transactionWrites(data []byte, namespace string) ([]stateWrite, error) {
+    env := &common.Envelope{}
+    if err := proto.Unmarshal(data, env); err != nil {
+        return nil, fmt.Errorf("envelope: %v", err)
+    }
+    payload := &common.Payload{}
+    if err := proto.Unmarshal(env.Payload, payload); err != nil {
+        return nil, fmt.Errorf("payload: %v", err)
+    }
+    if payload.Header == nil {
+        return nil, nil
+    }
+    chdr := &common.ChannelHeader{}
+    if err := proto.Unmarshal(payload.Header.ChannelHeader, chdr); err != nil {
+        return nil, fmt.Errorf("channel header: %v", err)
+    }
+    if chdr.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+        return nil, nil // config updates and the like
+    }
+
+    tx := &peer.Transaction{}
+    if err := proto.Unmarshal(payload.Data, tx); err != nil {
+        return nil, fmt.Errorf("transaction: %v", err)
+    }
+    var writes []stateWrite
+    for _, action := range tx.Actions {
+        ccPayload := &peer.ChaincodeActionPayload{}
+        if err := proto.Unmarshal(action.Payload, ccPayload); err != nil {
+            return nil, fmt.Errorf("chaincode action payload: %v", err)
+        }
+        if ccPayload.Action == nil {
+            continue
+        }
+        prp := &peer.ProposalResponsePayload{}
+        if err := proto.Unmarshal(ccPayload.Action.ProposalResponsePayload, prp); err != nil {
+            return nil, fmt.Errorf("proposal response payload: %v", err)
+        }
+        ca := &peer.ChaincodeAction{}
+        if err := proto.Unmarshal(prp.Extension, ca); err != nil {
+            return nil, fmt.Errorf("chaincode action: %v", err)
+        }
+        rws := &rwset.TxReadWriteSet{}
+        if err := proto.Unmarshal(ca.Results, rws); err != nil {
+            return nil, fmt.Errorf("read-write set: %v", err)
+        }
+        for _, ns := range rws.NsRwset {
+            if ns.Namespace != namespace {
+                continue
+            }
+            kv := &kvrwset.KVRWSet{}
+            if err := proto.Unmarshal(ns.Rwset, kv); err != nil {
+                return nil, fmt.Errorf("kv read-write set: %v", err)
+            }
+            for _, w := range kv.Writes {
+                writes = append(writes, stateWrite{TxID: chdr.TxId, Key: w.Key, Value: w.Value, IsDelete: w.IsDelete})
+            }
+        }
+    }
+    return writes, nil
+}
+
+// splitCompositeKey parses a key built by the chaincode's CreateCompositeKey:
+// U+0000, objectType, U+0000, then each attribute followed by U+0000.
+// ok is false for simple keys.
+func splitCompositeKey(key string) (objectType string, attrs []string, ok bool) {
+    if !strings.HasPrefix(key, "\x00") {
+        return "", nil, false
+    }
+    parts := strings.Split(strings.TrimSuffix(key[1:], "\x00"), "\x00")
+    return parts[0], parts[1:], true
+}
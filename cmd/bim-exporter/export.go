@@ -0,0 +1,172 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "syscall"
+    "time"
+
+    "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+    "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+    "github.com/spf13/cobra"
+)
+
+// options holds the command-line flags
+type options struct {
+    profile    string
+    wallet     string
+    identity   string
+    channel    string
+    chaincode  string
+    dbDriver   string
+    dsn        string
+    startBlock uint64
+    listen     string
+    slaHours   float64
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "bim-exporter",
+        Short:         "Export BIM chaincode history into a SQL reporting database",
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if opts.dbDriver != driverPostgres && opts.dbDriver != driverSQLite {
+                return fmt.Errorf("--db-driver must be %s or %s", driverPostgres, driverSQLite)
+            }
+            if opts.dsn == "" {
+                return fmt.Errorf("--dsn required")
+            }
+            ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+            defer stop()
+            return run(ctx, opts)
+        },
+    }
+
+    flags := root.Flags()
+    flags.StringVar(&opts.profile, "profile", envOr("BIM_EXPORTER_PROFILE", "connection.yaml"), "connection profile (env BIM_EXPORTER_PROFILE)")
+    flags.StringVar(&opts.wallet, "wallet", envOr("BIM_EXPORTER_WALLET", "wallet"), "filesystem wallet directory (env BIM_EXPORTER_WALLET)")
+    flags.StringVar(&opts.identity, "identity", envOr("BIM_EXPORTER_IDENTITY", "exporter"), "wallet identity label (env BIM_EXPORTER_IDENTITY)")
+    flags.StringVar(&opts.channel, "channel", envOr("BIM_EXPORTER_CHANNEL", "mychannel"), "channel name (env BIM_EXPORTER_CHANNEL)")
+    flags.StringVar(&opts.chaincode, "chaincode", envOr("BIM_EXPORTER_CHAINCODE", "bim"), "chaincode name (env BIM_EXPORTER_CHAINCODE)")
+    flags.StringVar(&opts.dbDriver, "db-driver", envOr("BIM_EXPORTER_DB_DRIVER", driverSQLite), "database driver: postgres or sqlite (env BIM_EXPORTER_DB_DRIVER)")
+    flags.StringVar(&opts.dsn, "dsn", os.Getenv("BIM_EXPORTER_DSN"), "database connection string (env BIM_EXPORTER_DSN)")
+    flags.Uint64Var(&opts.startBlock, "start-block", 0, "first block to export when the database has no checkpoint")
+    flags.StringVar(&opts.listen, "listen", os.Getenv("BIM_EXPORTER_LISTEN"), "HTTP listen address of the report endpoints, none when empty (env BIM_EXPORTER_LISTEN)")
+    flags.Float64Var(&opts.slaHours, "sla-hours", defaultSLAHours, "review turnaround SLA of /reports/sla when the request sets no sla")
+    return root
+}
+
+// run exports blocks until ctx is cancelled or the event stream fails
+func run(ctx context.Context, opts *options) error {
+    st, err := openStore(opts.dbDriver, opts.dsn)
+    if err != nil {
+        return err
+    }
+    defer st.Close()
+    if err := st.migrate(ctx); err != nil {
+        return err
+    }
+
+    from := opts.startBlock
+    last, ok, err := st.checkpoint(ctx, opts.channel)
+    if err != nil {
+        return err
+    }
+    if ok {
+        from = last + 1
+    }
+
+    wallet, err := gateway.NewFileSystemWallet(opts.wallet)
+    if err != nil {
+        return fmt.Errorf("failed to open wallet %s: %v", opts.wallet, err)
+    }
+    if !wallet.Exists(opts.identity) {
+        return fmt.Errorf("identity %q not found in wallet %s", opts.identity, opts.wallet)
+    }
+    gw, err := gateway.Connect(
+        gateway.WithConfig(config.FromFile(filepath.Clean(opts.profile))),
+        gateway.WithIdentity(wallet, opts.identity),
+        gateway.WithBlockNum(from),
+    )
+    if err != nil {
+        return fmt.Errorf("failed to connect to gateway: %v", err)
+    }
+    defer gw.Close()
+    network, err := gw.GetNetwork(opts.channel)
+    if err != nil {
+        return fmt.Errorf("failed to get channel %s: %v", opts.channel, err)
+    }
+
+    reg, events, err := network.RegisterBlockEvent()
+    if err != nil {
+        return fmt.Errorf("failed to register for block events: %v", err)
+    }
+    defer network.Unregister(reg)
+
+    log := slog.New(slog.NewTextHandler(os.Stderr, nil)).With("channel", opts.channel)
+    serveErr := make(chan error, 1)
+    if opts.listen != "" {
+        go func() { serveErr <- serveReports(ctx, opts, st) }()
+        log.Info("serving reports", "addr", opts.listen)
+    }
+    log.Info("exporting", "fromBlock", from, "driver", opts.dbDriver)
+    for {
+        select {
+        case <-ctx.Done():
+            return nil
+        case err := <-serveErr:
+            return fmt.Errorf("report server: %v", err)
+        case ev, ok := <-events:
+            if !ok {
+                return fmt.Errorf("block event stream closed")
+            }
+            number := ev.Block.GetHeader().GetNumber()
+            if number < from {
+                continue
+            }
+            writes, err := blockWrites(ev.Block, opts.chaincode)
+            if err != nil {
+                return fmt.Errorf("block %d: %v", number, err)
+            }
+            if err := st.apply(ctx, opts.channel, number, writes); err != nil {
+                return fmt.Errorf("block %d: %v", number, err)
+            }
+            if len(writes) > 0 {
+                log.Info("block exported", "block", number, "writes", len(writes))
+            }
+        }
+    }
+}
+
+// serveReports serves the report endpoints until ctx is cancelled
+func serveReports(ctx context.Context, opts *options, st *store) error {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/reports/sla", slaHandler(st, opts.slaHours))
+    srv := &http.Server{Addr: opts.listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+    go func() {
+        <-ctx.Done()
+        shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        srv.Shutdown(shutdown)
+    }()
+    if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    return nil
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
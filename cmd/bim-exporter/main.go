@@ -0,0 +1,27 @@
+// Command bim-exporter projects the BIM chaincode's ledger history into a SQL
+// database for reporting and BI dashboards.
+//
+// It follows the channel's block event stream, extracts the write sets of valid
+// transactions of the BIM chaincode and upserts BIMUpdate, BIMApproval (final decisions
+// and individual votes) and BIMComment records into PostgreSQL or SQLite. The last
+// exported block is checkpointed in the same database transaction as the rows, so a
+// restarted exporter resumes where it stopped:
+//
+//	bim-exporter --db-driver postgres --dsn "postgres://bim@db/reporting?sslmode=disable"
+//	bim-exporter --db-driver sqlite --dsn bim.db --start-block 0
+//
+// With --listen it also serves reports computed from the database, such as the review
+// turnaround report GET /reports/sla (see sla.go).
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+)
+
+// Review turnaround SLA report.
+//
+// The turnaround of a vote is the time from the update's submission (its Timestamp) to
+// the vote's Timestamp, both as recorded by the chaincode. The report groups the votes
+// of a period by reviewer and by department and counts the votes that took longer than
+// the SLA. Votes are exported since bim_approval_votes was added; run a fresh export
+// with --start-block 0 to include older ones.
+
+// defaultSLAHours is the turnaround a review is expected to meet when the request names none
+const defaultSLAHours = 72
+
+// slaFilter selects the votes of a report
+type slaFilter struct {
+    from     time.Time // votes at or after; zero for no lower bound
+    to       time.Time // votes before; zero for no upper bound
+    modelID  string
+    slaHours float64
+}
+
+// slaStats summarizes the turnaround of one reviewer or department, in hours
+type slaStats struct {
+    Key         string  `json:"key"`
+    Reviews     int     `json:"reviews"`
+    MeanHours   float64 `json:"meanHours"`
+    MedianHours float64 `json:"medianHours"`
+    P90Hours    float64 `json:"p90Hours"`
+    MaxHours    float64 `json:"maxHours"`
+    Breaches    int     `json:"breaches"` // votes slower than the SLA
+    BreachRate  float64 `json:"breachRate"`
+}
+
+// slaReport is the response of GET /reports/sla
+type slaReport struct {
+    From        string     `json:"from,omitempty"`
+    To          string     `json:"to,omitempty"`
+    ModelID     string     `json:"modelId,omitempty"`
+    SLAHours    float64    `json:"slaHours"`
+    Overall     slaStats   `json:"overall"`
+    Reviewers   []slaStats `json:"reviewers"`
+    Departments []slaStats `json:"departments"`
+}
+
+// slaReport computes the turnaround statistics of the votes matching f
+func (s *store) slaReport(ctx context.Context, f slaFilter) (*slaReport, error) {
+    query := `SELECT v.approver, v.department, u.created_at, v.voted_at
+        FROM bim_approval_votes v JOIN bim_updates u ON u.update_id = v.update_id
+        WHERE v.voted_at IS NOT NULL`
+    var args []interface{}
+    // the chaincode writes UTC RFC3339 timestamps, which sort as strings
+    if !f.from.IsZero() {
+        query += ` AND v.voted_at >= ?`
+        args = append(args, f.from.UTC().Format(time.RFC3339))
+    }
+    if !f.to.IsZero() {
+        query += ` AND v.voted_at < ?`
+        args = append(args, f.to.UTC().Format(time.RFC3339))
+    }
+    if f.modelID != "" {
+        query += ` AND v.model_id = ?`
+        args = append(args, f.modelID)
+    }
+    rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to query votes: %v", err)
+    }
+    defer rows.Close()
+
+    var all []float64
+    byReviewer := map[string][]float64{}
+    byDepartment := map[string][]float64{}
+    for rows.Next() {
+        var approver, department, submitted, voted *string
+        if err := rows.Scan(&approver, &department, &submitted, &voted); err != nil {
+            return nil, fmt.Errorf("failed to read vote: %v", err)
+        }
+        start, err1 := time.Parse(time.RFC3339, deref(submitted))
+        end, err2 := time.Parse(time.RFC3339, deref(voted))
+        if err1 != nil || err2 != nil || end.Before(start) {
+            continue
+        }
+        hours := end.Sub(start).Hours()
+        all = append(all, hours)
+        byReviewer[deref(approver)] = append(byReviewer[deref(approver)], hours)
+        dept := deref(department)
+        if dept == "" {
+            dept = "(none)"
+        }
+        byDepartment[dept] = append(byDepartment[dept], hours)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read votes: %v", err)
+    }
+
+    report := &slaReport{ModelID: f.modelID, SLAHours: f.slaHours}
+    if !f.from.IsZero() {
+        report.From = f.from.UTC().Format(time.RFC3339)
+    }
+    if !f.to.IsZero() {
+        report.To = f.to.UTC().Format(time.RFC3339)
+    }
+    report.Overall = newSLAStats("all", all, f.slaHours)
+    report.Reviewers = groupSLAStats(byReviewer, f.slaHours)
+    report.Departments = groupSLAStats(byDepartment, f.slaHours)
+    return report, nil
+}
+
+// groupSLAStats returns the statistics of each group, slowest median first
+func groupSLAStats(groups map[string][]float64, slaHours float64) []slaStats {
+    result := make([]slaStats, 0, len(groups))
+    for key, hours := range groups {
+        result = append(result, newSLAStats(key, hours, slaHours))
+    }
+    sort.Slice(result, func(i, j int) bool {
+        if result[i].MedianHours != result[j].MedianHours {
+            return result[i].MedianHours > result[j].MedianHours
+        }
+        return result[i].Key < result[j].Key
+    })
+    return result
+}
+
+func newSLAStats(key string, hours []float64, slaHours float64) slaStats {
+    st := slaStats{Key: key, Reviews: len(hours)}
+    if len(hours) == 0 {
+        return st
+    }
+    sort.Float64s(hours)
+    var total float64
+    for _, h := range hours {
+        total += h
+        if h > slaHours {
+            st.Breaches++
+        }
+    }
+    at := func(q float64) float64 { return hours[int(q*float64(len(hours)-1))] }
+    st.MeanHours = round2(total / float64(len(hours)))
+    st.MedianHours = round2(at(0.50))
+    st.P90Hours = round2(at(0.90))
+    st.MaxHours = round2(hours[len(hours)-1])
+    st.BreachRate = round2(float64(st.Breaches) / float64(len(hours)))
+    return st
+}
+
+func round2(f float64) float64 {
+    return math.Round(f*100) / 100
+}
+
+func deref(s *string) string {
+    if s == nil {
+        return ""
+    }
+    return *s
+}
+
+// slaHandler serves GET /reports/sla?from=...&to=...&model=...&sla=...&format=csv
+// from and to are dates (YYYY-MM-DD, to inclusive) or RFC3339 times (to exclusive);
+// sla is the turnaround limit in hours. format=csv returns one row per group.
+func slaHandler(st *store, defaultSLA float64) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        q := r.URL.Query()
+        f := slaFilter{modelID: q.Get("model"), slaHours: defaultSLA}
+        var err error
+        if f.from, err = parseReportTime(q.Get("from"), false); err != nil {
+            http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+        if f.to, err = parseReportTime(q.Get("to"), true); err != nil {
+            http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+            return
+        }
+        if !f.from.IsZero() && !f.to.IsZero() && !f.from.Before(f.to) {
+            http.Error(w, "from must lie before to", http.StatusBadRequest)
+            return
+        }
+        if v := q.Get("sla"); v != "" {
+            if f.slaHours, err = strconv.ParseFloat(v, 64); err != nil || f.slaHours <= 0 {
+                http.Error(w, "sla must be a positive number of hours", http.StatusBadRequest)
+                return
+            }
+        }
+        format := q.Get("format")
+        if format != "" && format != "json" && format != "csv" {
+            http.Error(w, "format must be json or csv", http.StatusBadRequest)
+            return
+        }
+
+        report, err := st.slaReport(r.Context(), f)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if format == "csv" {
+            w.Header().Set("Content-Type", "text/csv")
+            w.Header().Set("Content-Disposition", `attachment; filename="sla.csv"`)
+            writeSLACSV(w, report)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(report)
+    }
+}
+
+// parseReportTime parses a date or an RFC3339 time; a date used as an upper bound
+// means the end of that day
+func parseReportTime(v string, upper bool) (time.Time, error) {
+    if v == "" {
+        return time.Time{}, nil
+    }
+    if t, err := time.Parse("2006-01-02", v); err == nil {
+        if upper {
+            t = t.AddDate(0, 0, 1)
+        }
+        return t, nil
+    }
+    t, err := time.Parse(time.RFC3339, v)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("want YYYY-MM-DD or RFC3339, got %q", v)
+    }
+    return t, nil
+}
+
+// writeSLACSV writes the overall, reviewer and department rows of report
+func writeSLACSV(w http.ResponseWriter, report *slaReport) {
+    cw := csv.NewWriter(w)
+    cw.Write([]string{"group", "key", "reviews", "mean_hours", "median_hours", "p90_hours", "max_hours", "breaches", "breach_rate", "sla_hours"})
+    row := func(group string, st slaStats) {
+        cw.Write([]string{group, st.Key, strconv.Itoa(st.Reviews),
+            formatHours(st.MeanHours), formatHours(st.MedianHours), formatHours(st.P90Hours), formatHours(st.MaxHours),
+            strconv.Itoa(st.Breaches), formatHours(st.BreachRate), formatHours(report.SLAHours)})
+    }
+    row("overall", report.Overall)
+    for _, st := range report.Reviewers {
+        row("reviewer", st)
+    }
+    for _, st := range report.Departments {
+        row("department", st)
+    }
+    cw.Flush()
+}
+
+func formatHours(f float64) string {
+    return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+
+    _ "github.com/lib/pq"
+    _ "modernc.org/sqlite"
+)
+
+// Supported --db-driver values
+const (
+    driverPostgres = "postgres"
+    driverSQLite   = "sqlite"
+)
+
+// Composite-key object types of the exported sub-records
+const (
+    updateObjectType   = "BIMUpdate"       // ("BIMUpdate", updateID)
+    approvalObjectType = "BIMApproval"     // ("BIMApproval", updateID)
+    voteObjectType     = "BIMApprovalVote" // ("BIMApprovalVote", updateID, voterKey)
+    commentObjectType  = "BIMComment"      // ("BIMComment", updateID, commentID)
+)
+
+// schema is kept to types and syntax understood by both PostgreSQL and SQLite.
+// record holds the full JSON as stored on the ledger for fields not projected into columns.
+var schema = []string{
+    `CREATE TABLE IF NOT EXISTS bim_updates (
+        update_id          TEXT PRIMARY KEY,
+        model_id           TEXT NOT NULL,
+        version            TEXT NOT NULL,
+        description        TEXT,
+        initiator          TEXT,
+        status             TEXT NOT NULL,
+        review_mode        TEXT,
+        previous_update_id TEXT,
+        revision_number    INTEGER,
+        created_at         TEXT,
+        tx_id              TEXT NOT NULL,
+        block_num          BIGINT NOT NULL,
+        record             TEXT NOT NULL
+    )`,
+    `CREATE INDEX IF NOT EXISTS bim_updates_model_id ON bim_updates (model_id)`,
+    `CREATE INDEX IF NOT EXISTS bim_updates_status ON bim_updates (status)`,
+    `CREATE TABLE IF NOT EXISTS bim_approvals (
+        update_id   TEXT PRIMARY KEY,
+        model_id    TEXT NOT NULL,
+        version     TEXT,
+        approver    TEXT,
+        department  TEXT,
+        result      TEXT NOT NULL,
+        reason_code TEXT,
+        comment     TEXT,
+        approved_at TEXT,
+        tx_id       TEXT NOT NULL,
+        block_num   BIGINT NOT NULL,
+        record      TEXT NOT NULL
+    )`,
+    `CREATE INDEX IF NOT EXISTS bim_approvals_model_id ON bim_approvals (model_id)`,
+    `CREATE TABLE IF NOT EXISTS bim_approval_votes (
+        update_id  TEXT NOT NULL,
+        voter_key  TEXT NOT NULL,
+        model_id   TEXT NOT NULL,
+        approver   TEXT,
+        department TEXT,
+        result     TEXT NOT NULL,
+        voted_at   TEXT,
+        tx_id      TEXT NOT NULL,
+        block_num  BIGINT NOT NULL,
+        PRIMARY KEY (update_id, voter_key)
+    )`,
+    `CREATE INDEX IF NOT EXISTS bim_approval_votes_voted_at ON bim_approval_votes (voted_at)`,
+    `CREATE TABLE IF NOT EXISTS bim_comments (
+        update_id  TEXT NOT NULL,
+        comment_id TEXT NOT NULL,
+        reply_to   TEXT,
+        text       TEXT NOT NULL,
+        author     TEXT,
+        author_msp TEXT,
+        created_at TEXT,
+        block_num  BIGINT NOT NULL,
+        PRIMARY KEY (update_id, comment_id)
+    )`,
+    `CREATE TABLE IF NOT EXISTS bim_export_checkpoint (
+        channel_id TEXT PRIMARY KEY,
+        block_num  BIGINT NOT NULL
+    )`,
+}
+
+// updateRecord mirrors the columns projected from the chaincode's BIMUpdate
+type updateRecord struct {
+    UpdateID         string `json:"UpdateID"`
+    ModelID          string `json:"ModelID"`
+    Version          string `json:"Version"`
+    Description      string `json:"Description"`
+    Initiator        string `json:"Initiator"`
+    Timestamp        string `json:"Timestamp"`
+    Status           string `json:"Status"`
+    ReviewMode       string `json:"ReviewMode"`
+    PreviousUpdateID string `json:"PreviousUpdateID"`
+    RevisionNumber   int    `json:"RevisionNumber"`
+}
+
+// approvalRecord mirrors the columns projected from the chaincode's BIMApproval,
+// which is also the record of a single vote
+type approvalRecord struct {
+    UpdateID      string `json:"UpdateID"`
+    ModelID       string `json:"ModelID"`
+    Version       string `json:"Version"`
+    Approver      string `json:"Approver"`
+    Department    string `json:"Department"`
+    ApproveResult string `json:"ApproveResult"`
+    ReasonCode    string `json:"ReasonCode"`
+    Comment       string `json:"Comment"`
+    Timestamp     string `json:"Timestamp"`
+}
+
+// commentRecord mirrors the chaincode's BIMComment
+type commentRecord struct {
+    ReplyTo   string `json:"ReplyTo"`
+    Text      string `json:"Text"`
+    Author    string `json:"Author"`
+    AuthorMSP string `json:"AuthorMSP"`
+    Timestamp string `json:"Timestamp"`
+}
+
+// store writes the projection into the reporting database
+type store struct {
+    db     *sql.DB
+    driver string
+}
+
+func openStore(driver string, dsn string) (*store, error) {
+    db, err := sql.Open(driver, dsn)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open %s database: %v", driver, err)
+    }
+    if driver == driverSQLite {
+        // SQLite allows a single writer; one connection avoids SQLITE_BUSY
+        db.SetMaxOpenConns(1)
+    }
+    return &store{db: db, driver: driver}, nil
+}
+
+func (s *store) Close() error {
+    return s.db.Close()
+}
+
+// migrate creates the tables and indexes if they do not exist yet
+func (s *store) migrate(ctx context.Context) error {
+    for _, stmt := range schema {
+        if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+            return fmt.Errorf("failed to create schema: %v", err)
+        }
+    }
+    return nil
+}
+
+// checkpoint returns the last block exported for channel; ok is false before the first export
+func (s *store) checkpoint(ctx context.Context, channel string) (block uint64, ok bool, err error) {
+    var n int64
+    err = s.db.QueryRowContext(ctx, s.rebind(`SELECT block_num FROM bim_export_checkpoint WHERE channel_id = ?`), channel).Scan(&n)
+    if err == sql.ErrNoRows {
+        return 0, false, nil
+    }
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to read checkpoint: %v", err)
+    }
+    return uint64(n), true, nil
+}
+
+// apply projects the writes of one block and advances the checkpoint atomically
+func (s *store) apply(ctx context.Context, channel string, block uint64, writes []stateWrite) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    for _, w := range writes {
+        if err := s.project(ctx, tx, block, w); err != nil {
+            return fmt.Errorf("key %q in tx %s: %v", w.Key, w.TxID, err)
+        }
+    }
+    _, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO bim_export_checkpoint (channel_id, block_num) VALUES (?, ?)
+        ON CONFLICT (channel_id) DO UPDATE SET block_num = excluded.block_num`), channel, int64(block))
+    if err != nil {
+        return fmt.Errorf("failed to write checkpoint: %v", err)
+    }
+    return tx.Commit()
+}
+
+// project upserts or deletes the row a single state write maps to.
+// Index entries, votes, blockers and other sub-records are ignored.
+func (s *store) project(ctx context.Context, tx *sql.Tx, block uint64, w stateWrite) error {
+    objectType, attrs, composite := splitCompositeKey(w.Key)
+    switch {
+    case !composite || (objectType == updateObjectType && len(attrs) == 1):
+        // updates written by older chaincode versions sit under their plain UpdateID;
+        // the chaincode deletes that key when it moves the record to ("BIMUpdate", updateID),
+        // so plain key deletes must not drop the row
+        updateID := w.Key
+        if composite {
+            updateID = attrs[0]
+        }
+        if w.IsDelete {
+            if !composite {
+                return nil
+            }
+            _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM bim_updates WHERE update_id = ?`), updateID)
+            return err
+        }
+        var u updateRecord
+        // anything that does not parse as the update is skipped rather than failing the export
+        if err := json.Unmarshal(w.Value, &u); err != nil || u.UpdateID != updateID || u.ModelID == "" {
+            return nil
+        }
+        _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO bim_updates
+            (update_id, model_id, version, description, initiator, status, review_mode,
+             previous_update_id, revision_number, created_at, tx_id, block_num, record)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT (update_id) DO UPDATE SET
+                model_id = excluded.model_id, version = excluded.version, description = excluded.description,
+                initiator = excluded.initiator, status = excluded.status, review_mode = excluded.review_mode,
+                previous_update_id = excluded.previous_update_id, revision_number = excluded.revision_number,
+                created_at = excluded.created_at, tx_id = excluded.tx_id, block_num = excluded.block_num,
+                record = excluded.record`),
+            u.UpdateID, u.ModelID, u.Version, u.Description, u.Initiator, u.Status, u.ReviewMode,
+            u.PreviousUpdateID, u.RevisionNumber, u.Timestamp, w.TxID, int64(block), string(w.Value))
+        return err
+
+    case objectType == approvalObjectType && len(attrs) == 1:
+        if w.IsDelete {
+            _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM bim_approvals WHERE update_id = ?`), attrs[0])
+            return err
+        }
+        var a approvalRecord
+        if err := json.Unmarshal(w.Value, &a); err != nil {
+            return fmt.Errorf("failed to parse approval: %v", err)
+        }
+        _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO bim_approvals
+            (update_id, model_id, version, approver, department, result, reason_code, comment,
+             approved_at, tx_id, block_num, record)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT (update_id) DO UPDATE SET
+                model_id = excluded.model_id, version = excluded.version, approver = excluded.approver,
+                department = excluded.department, result = excluded.result, reason_code = excluded.reason_code,
+                comment = excluded.comment, approved_at = excluded.approved_at, tx_id = excluded.tx_id,
+                block_num = excluded.block_num, record = excluded.record`),
+            attrs[0], a.ModelID, a.Version, a.Approver, a.Department, a.ApproveResult, a.ReasonCode, a.Comment,
+            a.Timestamp, w.TxID, int64(block), string(w.Value))
+        return err
+
+    case objectType == voteObjectType && len(attrs) == 2:
+        if w.IsDelete {
+            _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM bim_approval_votes WHERE update_id = ? AND voter_key = ?`), attrs[0], attrs[1])
+            return err
+        }
+        var v approvalRecord
+        if err := json.Unmarshal(w.Value, &v); err != nil {
+            return fmt.Errorf("failed to parse approval vote: %v", err)
+        }
+        _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO bim_approval_votes
+            (update_id, voter_key, model_id, approver, department, result, voted_at, tx_id, block_num)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT (update_id, voter_key) DO UPDATE SET
+                model_id = excluded.model_id, approver = excluded.approver, department = excluded.department,
+                result = excluded.result, voted_at = excluded.voted_at, tx_id = excluded.tx_id,
+                block_num = excluded.block_num`),
+            attrs[0], attrs[1], v.ModelID, v.Approver, v.Department, v.ApproveResult, v.Timestamp, w.TxID, int64(block))
+        return err
+
+    case objectType == commentObjectType && len(attrs) == 2:
+        if w.IsDelete {
+            _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM bim_comments WHERE update_id = ? AND comment_id = ?`), attrs[0], attrs[1])
+            return err
+        }
+        var c commentRecord
+        if err := json.Unmarshal(w.Value, &c); err != nil {
+            return fmt.Errorf("failed to parse comment: %v", err)
+        }
+        _, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO bim_comments
+            (update_id, comment_id, reply_to, text, author, author_msp, created_at, block_num)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+            ON CONFLICT (update_id, comment_id) DO UPDATE SET
+                reply_to = excluded.reply_to, text = excluded.text, author = excluded.author,
+                author_msp = excluded.author_msp, created_at = excluded.created_at, block_num = excluded.block_num`),
+            attrs[0], attrs[1], c.ReplyTo, c.Text, c.Author, c.AuthorMSP, c.Timestamp, int64(block))
+        return err
+    }
+    return nil
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL
+func (s *store) rebind(query string) string {
+    if s.driver != driverPostgres {
+        return query
+    }
+    var b strings.Builder
+    n := 0
+    for _, r := range query {
+        if r == '?' {
+            n++
+            b.WriteString("$" + strconv.Itoa(n))
+            continue
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
@@ -0,0 +1,23 @@
+#!/usr/bin/env bash
+# Stages the mapping suite, bimclient and this command as module "bim" and builds the
+# bim-gateway binary into cmd/bim-gateway/build. Run from the repository root
+# (make gateway).
+#
+# Needs: go.
+set -euo pipefail
+
+ROOT=$(cd "$(dirname "$0")/../.." && pwd)
+BUILD="$ROOT/cmd/bim-gateway/build"
+STAGE="$BUILD/src"
+
+# the mapping suite's directory cannot be an import path; copy it to bim/mapping
+rm -rf "$STAGE"
+mkdir -p "$STAGE/mapping" "$STAGE/bimclient"
+find "$ROOT/One-to-Many Mapping Suite" -maxdepth 1 -name '*.go' ! -name '*_test.go' -exec cp {} "$STAGE/mapping/" \;
+cp -r "$ROOT/One-to-Many Mapping Suite/schemas" "$STAGE/mapping/schemas"
+find "$ROOT/bimclient" -maxdepth 1 -name '*.go' ! -name '*_test.go' -exec cp {} "$STAGE/bimclient/" \;
+find "$ROOT/cmd/bim-gateway" -maxdepth 1 -name '*.go' ! -name '*_test.go' -exec cp {} "$STAGE/" \;
+(cd "$STAGE" && go mod init bim >/dev/null 2>&1 && go mod tidy)
+
+cd "$STAGE" && go build -o "$BUILD/bim-gateway" .
+echo "built $BUILD/bim-gateway"
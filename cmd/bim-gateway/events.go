@@ -0,0 +1,78 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "strings"
+
+    "bim/bimclient"
+    "bim/mapping"
+)
+
+// listen subscribes to the chaincode events as identity and runs them through listener,
+// resuming from the listener's checkpoint, or from startBlock on the first start. Replay
+// handlers see the events from startBlock on. It returns nil when ctx ends and an error
+// when the subscription fails or closes.
+func listen(ctx context.Context, base bimclient.Config, identity string, startBlock uint64, listener *mapping.EventListener) error {
+    from, err := listener.StartBlock(startBlock)
+    if err != nil {
+        return err
+    }
+    cfg := base
+    cfg.Identity = identity
+    subscribe := listener.SubscribeBlock(startBlock, from)
+    cfg.EventStartBlock = &subscribe
+    c, err := bimclient.New(cfg)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    events, err := c.SubscribeEvents(ctx, "")
+    if err != nil {
+        return err
+    }
+    mapping.Logger().Info("listening for chaincode events", "identity", identity, "fromBlock", subscribe, "checkpoint", from)
+
+    chain := make(chan mapping.ChainEvent)
+    go func() {
+        defer close(chain)
+        for ev := range events {
+            select {
+            case chain <- mapping.ChainEvent{BlockNumber: ev.BlockNumber, Name: ev.Name, TxID: ev.TxID, Payload: ev.Payload}:
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+    return listener.Run(ctx, from, chain)
+}
+
+// newPublisher returns the publisher of the bus named by the flags, or nil when none is
+func newPublisher(opts *options) (*mapping.EventPublisher, error) {
+    switch {
+    case opts.kafkaBrokers != "" && opts.natsURL != "":
+        return nil, errors.New("--kafka-brokers and --nats-url are exclusive")
+    case opts.kafkaBrokers != "":
+        return mapping.NewEventPublisher(mapping.NewKafkaSink(strings.Split(opts.kafkaBrokers, ","), opts.kafkaTopic)), nil
+    case opts.natsURL != "":
+        sink, err := mapping.NewNATSSink(opts.natsURL, opts.natsSubject)
+        if err != nil {
+            return nil, err
+        }
+        return mapping.NewEventPublisher(sink), nil
+    }
+    return nil, nil
+}
+
+// watchersOnly is the Directory of the gateway's notifications: the gateway only notifies
+// the users watching a model, approvers and initiators are notified by the mapping service
+type watchersOnly struct{}
+
+func (watchersOnly) Approvers(modelID string) ([]mapping.Recipient, error) { return nil, nil }
+
+func (watchersOnly) Initiator(updateID string, initiator string) (*mapping.Recipient, error) {
+    return nil, nil
+}
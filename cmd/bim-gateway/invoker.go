@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+
+    "bim/bimclient"
+    "bim/mapping"
+)
+
+// identityClients keeps one bimclient.Client per wallet identity, channel and chaincode,
+// so that each call is signed by the user the request acts for
+type identityClients struct {
+    base bimclient.Config // Profile, Wallet, Retry and WaitForCommit of every client
+    // fallback signs requests that carry no identity; "" refuses them
+    fallback string
+
+    mu      sync.Mutex
+    clients map[string]*bimclient.Client
+}
+
+func newIdentityClients(base bimclient.Config, fallback string) *identityClients {
+    return &identityClients{base: base, fallback: fallback, clients: map[string]*bimclient.Client{}}
+}
+
+// client returns the client of the request's identity, connecting on first use
+func (p *identityClients) client(ctx context.Context, channel string, chaincode string) (*bimclient.Client, error) {
+    identity := mapping.InvokeIdentity(ctx)
+    if identity == "" {
+        identity = p.fallback
+    }
+    if identity == "" {
+        return nil, errors.New("the request names no user to sign as")
+    }
+    key := channel + "/" + chaincode + "/" + identity
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if c, ok := p.clients[key]; ok {
+        return c, nil
+    }
+    cfg := p.base
+    cfg.Identity, cfg.Channel, cfg.Chaincode = identity, channel, chaincode
+    c, err := bimclient.New(cfg)
+    if err != nil {
+        return nil, err
+    }
+    p.clients[key] = c
+    return c, nil
+}
+
+// Close closes every client
+func (p *identityClients) Close() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    for key, c := range p.clients {
+        c.Close()
+        delete(p.clients, key)
+    }
+}
+
+// invoker is the mapping.ChannelInvoker of the gateway. The connection profile decides
+// which peers endorse; the node only contributes its channel.
+type invoker struct {
+    clients *identityClients
+}
+
+func (i invoker) Invoke(ctx context.Context, node *mapping.NodeMapping, chaincode string, function string, args ...[]byte) ([]byte, error) {
+    result, _, err := i.submit(ctx, node, chaincode, function, args)
+    return result, err
+}
+
+func (i invoker) submit(ctx context.Context, node *mapping.NodeMapping, chaincode string, function string, args [][]byte) ([]byte, uint64, error) {
+    c, err := i.clients.client(ctx, node.Channel, chaincode)
+    if err != nil {
+        return nil, 0, err
+    }
+    // "Contract:Function"; a bare function belongs to the default contract
+    contract, fn, ok := strings.Cut(function, ":")
+    if !ok {
+        contract, fn = "", function
+    }
+    strArgs := make([]string, len(args))
+    for k, a := range args {
+        strArgs[k] = string(a)
+    }
+    return c.Submit(ctx, contract, fn, strArgs...)
+}
+
+// committingInvoker adds mapping.CommitInvoker for --wait-for-commit, whose clients wait
+// for the commit event of every submission
+type committingInvoker struct {
+    invoker
+}
+
+func (i committingInvoker) InvokeCommitted(ctx context.Context, node *mapping.NodeMapping, chaincode string, function string, args ...[]byte) ([]byte, uint64, error) {
+    return i.submit(ctx, node, chaincode, function, args)
+}
+
+// ledger is the gateway's mapping.LedgerQuerier; queries run as the request's identity,
+// so QueryUpdate applies that user's organization scope
+type ledger struct {
+    clients   *identityClients
+    channel   string
+    chaincode string
+}
+
+func (l ledger) QueryUpdate(ctx context.Context, updateID string) ([]byte, error) {
+    return l.evaluate(ctx, "QueryUpdate", updateID)
+}
+
+func (l ledger) QueryModelHistory(ctx context.Context, modelID string, pageSize int, bookmark string) ([]byte, error) {
+    return l.evaluate(ctx, "QueryModelHistory", modelID, strconv.Itoa(pageSize), bookmark)
+}
+
+func (l ledger) evaluate(ctx context.Context, fn string, args ...string) ([]byte, error) {
+    c, err := l.clients.client(ctx, l.channel, l.chaincode)
+    if err != nil {
+        return nil, err
+    }
+    result, err := c.Evaluate(ctx, "QueryContract", fn, args...)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", fn, err)
+    }
+    return result, nil
+}
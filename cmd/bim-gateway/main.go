@@ -0,0 +1,50 @@
+// Command bim-gateway serves the mapping suite's REST gateway (HTTPGateway) on a Fabric
+// network.
+//
+// Every transaction and query is signed with the wallet identity of the user the request
+// acts for (mapping.InvokeIdentity): the authenticated caller, or the userId query
+// parameter when authentication is off. The chaincode's role checks, duplicate vote
+// detection and QueryUpdate's organization scope all depend on it, so the wallet holds
+// one identity per user, labelled with the user ID, e.g. as enrolled by bim-enroll:
+//
+//	bim-gateway --config mapping.yaml --profile connection.yaml --wallet wallet --listen :8080
+//	curl -X POST 'localhost:8080/updates?userId=1001' -d '{"ModelID":"M-1","Version":"1.0"}'
+//
+// Beyond --max-in-flight concurrent requests it answers 503 with Retry-After, which
+// bimclient.GatewayClient waits out; GET /health reports the load.
+//
+// POST /graphql answers the same queries and writes as the REST routes, through the same
+// schema validation, submitter and per-user queries.
+//
+// POST /tokens issues a short-lived token for one file of an update the caller may query.
+// GET /files/<UpdateID>/<CID>?token=... streams that file from the IPFS node of the
+// configuration (ipfs.apiUrl) to anyone holding the token, so viewers never reach IPFS
+// itself. Tokens are signed with BIM_GATEWAY_TOKEN_KEY (at least 16 bytes), or with a
+// random key when unset.
+//
+// It also subscribes to the chaincode events as --event-identity (default --identity) and
+// runs them through a mapping.EventListener. The listener saves its checkpoint in the
+// --checkpoint file, and after a restart it replays the events committed while it was down.
+// Query results are cached per user (--cache-redis shares the cache between gateways), and
+// the listener removes the entries an event changed. Clients connected to GET /events
+// receive, over a WebSocket, the events of the updates they may query. The listener also
+// keeps the model watch list, rebuilt from --start-block on every start, and posts the
+// notifications of the users watching a model to --notify-webhook.
+// With --kafka-brokers or --nats-url the events are also published to that bus. The
+// checkpoint then only advances once the bus acknowledged them.
+//
+// It imports the mapping suite and bimclient as Go packages, so build it through
+// make gateway, which stages them as module "bim" like make simulate does.
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "bim/bimclient"
+    "bim/mapping"
+
+    "github.com/spf13/cobra"
+)
+
+// options holds the command-line flags
+type options struct {
+    config        string
+    listen        string
+    profile       string
+    wallet        string
+    chaincode     string
+    identity      string
+    waitForCommit bool
+    timeout       time.Duration
+    maxInFlight   int
+    retryAfter    time.Duration
+    tokenTTL      time.Duration
+
+    eventIdentity string
+    checkpoint    string
+    startBlock    uint64
+
+    kafkaBrokers string
+    kafkaTopic   string
+    natsURL      string
+    natsSubject  string
+
+    cacheRedis string
+    cacheTTL   time.Duration
+
+    notifyWebhook string
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "bim-gateway",
+        Short:         "Serve the BIM REST gateway, signing as each request's user",
+        Args:          cobra.NoArgs,
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+            defer stop()
+            return run(ctx, opts)
+        },
+    }
+
+    flags := root.Flags()
+    flags.StringVar(&opts.config, "config", os.Getenv("BIM_GATEWAY_CONFIG"), "mapping suite YAML configuration, defaults when empty (env BIM_GATEWAY_CONFIG)")
+    flags.StringVar(&opts.listen, "listen", envOr("BIM_GATEWAY_LISTEN", ":8080"), "HTTP listen address (env BIM_GATEWAY_LISTEN)")
+    flags.StringVar(&opts.profile, "profile", envOr("BIM_GATEWAY_PROFILE", "connection.yaml"), "connection profile (env BIM_GATEWAY_PROFILE)")
+    flags.StringVar(&opts.wallet, "wallet", envOr("BIM_GATEWAY_WALLET", "wallet"), "filesystem wallet holding one identity per user ID (env BIM_GATEWAY_WALLET)")
+    flags.StringVar(&opts.chaincode, "chaincode", envOr("BIM_GATEWAY_CHAINCODE", "bim"), "chaincode name (env BIM_GATEWAY_CHAINCODE)")
+    flags.StringVar(&opts.identity, "identity", os.Getenv("BIM_GATEWAY_IDENTITY"), "wallet identity for requests that name no user; such requests are refused when empty (env BIM_GATEWAY_IDENTITY)")
+    flags.BoolVar(&opts.waitForCommit, "wait-for-commit", false, "respond to writes only after the transaction committed VALID")
+    flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of one submission, 0 for none")
+    flags.IntVar(&opts.maxInFlight, "max-in-flight", 64, "requests handled at once; more are refused with 503 and Retry-After, 0 for no limit")
+    flags.DurationVar(&opts.retryAfter, "retry-after", 2*time.Second, "Retry-After sent with a 503 when --max-in-flight is reached")
+    flags.DurationVar(&opts.tokenTTL, "token-ttl", 15*time.Minute, "lifetime of the file retrieval tokens of POST /tokens")
+    flags.StringVar(&opts.eventIdentity, "event-identity", os.Getenv("BIM_GATEWAY_EVENT_IDENTITY"), "wallet identity that subscribes to chaincode events, defaults to --identity; no events are consumed when both are empty (env BIM_GATEWAY_EVENT_IDENTITY)")
+    flags.StringVar(&opts.checkpoint, "checkpoint", envOr("BIM_GATEWAY_CHECKPOINT", "bim-gateway.checkpoint"), "file holding the block the event listener resumes from (env BIM_GATEWAY_CHECKPOINT)")
+    flags.Uint64Var(&opts.startBlock, "start-block", 0, "block the event listener starts from when there is no checkpoint")
+    flags.StringVar(&opts.kafkaBrokers, "kafka-brokers", os.Getenv("BIM_GATEWAY_KAFKA_BROKERS"), "comma-separated Kafka brokers to publish the events to (env BIM_GATEWAY_KAFKA_BROKERS)")
+    flags.StringVar(&opts.kafkaTopic, "kafka-topic", envOr("BIM_GATEWAY_KAFKA_TOPIC", "bim.events"), "Kafka topic of the events (env BIM_GATEWAY_KAFKA_TOPIC)")
+    flags.StringVar(&opts.natsURL, "nats-url", os.Getenv("BIM_GATEWAY_NATS_URL"), "NATS server to publish the events to through JetStream (env BIM_GATEWAY_NATS_URL)")
+    flags.StringVar(&opts.natsSubject, "nats-subject", envOr("BIM_GATEWAY_NATS_SUBJECT", "bim.events"), "subject prefix of the events on NATS (env BIM_GATEWAY_NATS_SUBJECT)")
+    flags.StringVar(&opts.cacheRedis, "cache-redis", os.Getenv("BIM_GATEWAY_CACHE_REDIS"), "Redis address of a query cache shared by several gateways, in-process cache when empty (env BIM_GATEWAY_CACHE_REDIS)")
+    flags.DurationVar(&opts.cacheTTL, "cache-ttl", 5*time.Minute, "lifetime of a cached query result; events remove changed entries earlier")
+    flags.StringVar(&opts.notifyWebhook, "notify-webhook", os.Getenv("BIM_GATEWAY_NOTIFY_WEBHOOK"), "URL the notifications of model watchers are posted to, none are sent when empty (env BIM_GATEWAY_NOTIFY_WEBHOOK)")
+    return root
+}
+
+// run serves the gateway until ctx is cancelled or the server fails
+func run(ctx context.Context, opts *options) error {
+    cfg, err := mapping.LoadConfig(opts.config, nil)
+    if err != nil {
+        return err
+    }
+    if err := mapping.UseConfig(cfg); err != nil {
+        return err
+    }
+
+    base := bimclient.Config{
+        Profile:       opts.profile,
+        Wallet:        opts.wallet,
+        WaitForCommit: opts.waitForCommit,
+    }
+    clients := newIdentityClients(base, opts.identity)
+    defer clients.Close()
+
+    var inv mapping.ChannelInvoker = invoker{clients: clients}
+    if opts.waitForCommit {
+        inv = committingInvoker{invoker{clients: clients}}
+    }
+    submitter := mapping.NewRoutedSubmitter(inv, opts.chaincode)
+    submitter.Timeout = opts.timeout
+    submitter.WaitForCommit = opts.waitForCommit
+    var store mapping.CacheStore
+    if opts.cacheRedis != "" {
+        redis := mapping.NewRedisCacheStore(opts.cacheRedis, os.Getenv("BIM_GATEWAY_CACHE_REDIS_PASSWORD"), 0)
+        defer redis.Close()
+        store = redis
+    }
+    cache := mapping.NewCachedLedger(ledger{clients: clients, channel: cfg.Channel, chaincode: opts.chaincode}, store)
+    cache.TTL = opts.cacheTTL
+    gw := mapping.NewHTTPGateway(submitter, cache)
+    gw.Events = mapping.NewEventHub(cache)
+    gw.MaxInFlight, gw.RetryAfter = opts.maxInFlight, opts.retryAfter
+    // several gateways behind one address share BIM_GATEWAY_TOKEN_KEY; a random key
+    // invalidates the issued tokens on restart
+    if gw.Tokens, err = mapping.NewRetrievalTokens([]byte(os.Getenv("BIM_GATEWAY_TOKEN_KEY"))); err != nil {
+        return fmt.Errorf("BIM_GATEWAY_TOKEN_KEY: %v", err)
+    }
+    gw.Tokens.TTL = opts.tokenTTL
+    gw.Files = &mapping.IPFSContentSource{Config: cfg.IPFS}
+
+    eventIdentity := opts.eventIdentity
+    if eventIdentity == "" {
+        eventIdentity = opts.identity
+    }
+    if eventIdentity == "" {
+        if opts.kafkaBrokers != "" || opts.natsURL != "" {
+            return fmt.Errorf("publishing events needs --event-identity or --identity")
+        }
+        mapping.Logger().Warn("no --event-identity or --identity, chaincode events are not consumed")
+    }
+    listener := mapping.NewEventListener(&mapping.FileCheckpoint{Path: opts.checkpoint})
+    listener.Handle("query cache", cache.HandleEvent)
+    // after the cache, so that the scope check of a pushed event reads the new state
+    listener.Handle("websocket", gw.Events.HandleEvent)
+    // the watch list is only kept in memory and rebuilt from --start-block on every start
+    watches := mapping.NewWatchList(func(identity string) (*mapping.Recipient, error) {
+        return &mapping.Recipient{UserID: identity}, nil
+    })
+    listener.Replay("watch list", watches.HandleEvent)
+    if opts.notifyWebhook != "" {
+        dispatcher := mapping.NewDispatcher(watchersOnly{}, &mapping.WebhookNotifier{URL: opts.notifyWebhook})
+        dispatcher.Watchers = watches
+        dispatcher.Start(ctx, 4, 1000)
+        // runs after the listener returned, like publisher.Stop
+        defer dispatcher.Stop()
+        listener.Handle("watch notifications", dispatcher.HandleEvent)
+    }
+    publisher, err := newPublisher(opts)
+    if err != nil {
+        return err
+    }
+    if publisher != nil {
+        // the checkpoint then only moves once the bus acknowledged the events
+        listener.Publish(publisher)
+        publisher.Start(ctx, 1000)
+        defer func() {
+            // runs after the listener returned, nothing is queued any more
+            if err := publisher.Stop(); err != nil {
+                mapping.Logger().Warn("closing the event bus failed", "err", err)
+            }
+        }()
+    }
+    // the listener is stopped and awaited before the deferred publisher.Stop
+    listenCtx, stopListener := context.WithCancel(ctx)
+    var listenErr chan error // stays nil without a listener
+    listenDone := make(chan struct{})
+    if eventIdentity != "" {
+        events := base
+        events.Channel, events.Chaincode = cfg.Channel, opts.chaincode
+        listenErr = make(chan error, 1)
+        go func() {
+            defer close(listenDone)
+            listenErr <- listen(listenCtx, events, eventIdentity, opts.startBlock, listener)
+        }()
+    } else {
+        close(listenDone)
+    }
+    defer func() {
+        stopListener()
+        <-listenDone
+    }()
+
+    serveErr := make(chan error, 1)
+    go func() { serveErr <- mapping.ServeHTTPGateway(opts.listen, gw) }()
+    mapping.Logger().Info("serving the REST gateway", "addr", opts.listen, "waitForCommit", opts.waitForCommit)
+    select {
+    case <-ctx.Done():
+        return nil
+    case err := <-serveErr:
+        return fmt.Errorf("gateway: %v", err)
+    case err := <-listenErr:
+        if ctx.Err() != nil {
+            return nil
+        }
+        return fmt.Errorf("event listener: %v", err)
+    }
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
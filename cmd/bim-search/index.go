@@ -0,0 +1,246 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/blevesearch/bleve/v2"
+    _ "github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+    "github.com/blevesearch/bleve/v2/mapping"
+)
+
+// Document kinds
+const (
+    kindUpdate   = "update"
+    kindApproval = "approval"
+    kindComment  = "comment"
+)
+
+// lastBlockKey stores the highest exporter block number already indexed
+var lastBlockKey = []byte("lastBlock")
+
+// document is what gets indexed for an update, an approval or a comment.
+// Field names are the ones users put in query strings (modelId:M-1 +fire).
+type document struct {
+    Kind        string `json:"kind"`
+    UpdateID    string `json:"updateId"`
+    ModelID     string `json:"modelId"`
+    Version     string `json:"version,omitempty"`
+    Status      string `json:"status,omitempty"`
+    Description string `json:"description,omitempty"`
+    Initiator   string `json:"initiator,omitempty"`
+    Approver    string `json:"approver,omitempty"`
+    Result      string `json:"result,omitempty"`
+    ReasonCode  string `json:"reasonCode,omitempty"`
+    Comment     string `json:"comment,omitempty"`
+    Author      string `json:"author,omitempty"`
+    ManifestCID string `json:"manifestCid,omitempty"`
+    Added       int    `json:"added,omitempty"`
+    Modified    int    `json:"modified,omitempty"`
+    Deleted     int    `json:"deleted,omitempty"`
+    Timestamp   string `json:"timestamp,omitempty"`
+}
+
+// indexMapping analyzes free text with the CJK analyzer, since descriptions and
+// comments are often Chinese, and keeps IDs and codes as exact keywords
+func indexMapping() mapping.IndexMapping {
+    text := bleve.NewTextFieldMapping()
+    text.Analyzer = "cjk"
+    text.Store = true
+    text.IncludeTermVectors = true // needed for highlighting
+
+    keyword := bleve.NewKeywordFieldMapping()
+    keyword.Store = true
+
+    doc := bleve.NewDocumentMapping()
+    for _, f := range []string{"description", "comment"} {
+        doc.AddFieldMappingsAt(f, text)
+    }
+    for _, f := range []string{"kind", "updateId", "modelId", "version", "status", "initiator",
+        "approver", "result", "reasonCode", "author", "manifestCid", "timestamp"} {
+        doc.AddFieldMappingsAt(f, keyword)
+    }
+    for _, f := range []string{"added", "modified", "deleted"} {
+        doc.AddFieldMappingsAt(f, bleve.NewNumericFieldMapping())
+    }
+
+    m := bleve.NewIndexMapping()
+    m.DefaultMapping = doc
+    m.DefaultAnalyzer = "cjk"
+    return m
+}
+
+// openIndex opens the index at path, creating it on first use
+func openIndex(path string) (bleve.Index, error) {
+    idx, err := bleve.Open(path)
+    if err == bleve.ErrorIndexPathDoesNotExist {
+        idx, err = bleve.New(path, indexMapping())
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open index %s: %v", path, err)
+    }
+    return idx, nil
+}
+
+// syncer copies rows changed since the last indexed block from the exporter database
+type syncer struct {
+    db    *sql.DB
+    index bleve.Index
+    // postgres selects $n placeholders instead of ?
+    postgres bool
+}
+
+// rebind rewrites ? placeholders to $1, $2, ... for postgres
+func (s *syncer) rebind(query string) string {
+    if !s.postgres {
+        return query
+    }
+    var b strings.Builder
+    n := 0
+    for _, r := range query {
+        if r == '?' {
+            n++
+            fmt.Fprintf(&b, "$%d", n)
+            continue
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+// sync indexes every row exported after the last indexed block and returns the number
+// of documents written. Rows are never deleted by the chaincode, so deletions are not tracked.
+func (s *syncer) sync(ctx context.Context) (int, error) {
+    last, err := s.lastBlock()
+    if err != nil {
+        return 0, err
+    }
+    batch := s.index.NewBatch()
+    high := last
+
+    add := func(id string, doc *document, block int64) error {
+        if block > high {
+            high = block
+        }
+        return batch.Index(id, doc)
+    }
+    if err := s.updates(ctx, last, add); err != nil {
+        return 0, err
+    }
+    if err := s.approvals(ctx, last, add); err != nil {
+        return 0, err
+    }
+    if err := s.comments(ctx, last, add); err != nil {
+        return 0, err
+    }
+
+    n := batch.Size()
+    if n == 0 {
+        return 0, nil
+    }
+    batch.SetInternal(lastBlockKey, []byte(strconv.FormatInt(high, 10)))
+    if err := s.index.Batch(batch); err != nil {
+        return 0, fmt.Errorf("failed to write index batch: %v", err)
+    }
+    return n, nil
+}
+
+func (s *syncer) lastBlock() (int64, error) {
+    v, err := s.index.GetInternal(lastBlockKey)
+    if err != nil {
+        return 0, fmt.Errorf("failed to read index checkpoint: %v", err)
+    }
+    if v == nil {
+        return -1, nil
+    }
+    return strconv.ParseInt(string(v), 10, 64)
+}
+
+type addFunc func(id string, doc *document, block int64) error
+
+func (s *syncer) updates(ctx context.Context, after int64, add addFunc) error {
+    rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT update_id, model_id, version, status,
+        COALESCE(description, ''), COALESCE(initiator, ''), COALESCE(created_at, ''), record, block_num
+        FROM bim_updates WHERE block_num > ?`), after)
+    if err != nil {
+        return fmt.Errorf("failed to query updates: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var d document
+        var record string
+        var block int64
+        if err := rows.Scan(&d.UpdateID, &d.ModelID, &d.Version, &d.Status, &d.Description, &d.Initiator,
+            &d.Timestamp, &record, &block); err != nil {
+            return err
+        }
+        d.Kind = kindUpdate
+        var full struct {
+            ChangeManifest *struct {
+                CID      string `json:"CID"`
+                Added    int    `json:"Added"`
+                Modified int    `json:"Modified"`
+                Deleted  int    `json:"Deleted"`
+            } `json:"ChangeManifest"`
+        }
+        if err := json.Unmarshal([]byte(record), &full); err == nil && full.ChangeManifest != nil {
+            d.ManifestCID = full.ChangeManifest.CID
+            d.Added, d.Modified, d.Deleted = full.ChangeManifest.Added, full.ChangeManifest.Modified, full.ChangeManifest.Deleted
+        }
+        if err := add(kindUpdate+":"+d.UpdateID, &d, block); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+func (s *syncer) approvals(ctx context.Context, after int64, add addFunc) error {
+    rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT update_id, model_id, COALESCE(version, ''),
+        COALESCE(approver, ''), result, COALESCE(reason_code, ''), COALESCE(comment, ''), COALESCE(approved_at, ''), block_num
+        FROM bim_approvals WHERE block_num > ?`), after)
+    if err != nil {
+        return fmt.Errorf("failed to query approvals: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var d document
+        var block int64
+        if err := rows.Scan(&d.UpdateID, &d.ModelID, &d.Version, &d.Approver, &d.Result, &d.ReasonCode,
+            &d.Comment, &d.Timestamp, &block); err != nil {
+            return err
+        }
+        d.Kind = kindApproval
+        if err := add(kindApproval+":"+d.UpdateID, &d, block); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
+
+func (s *syncer) comments(ctx context.Context, after int64, add addFunc) error {
+    rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT c.update_id, c.comment_id, COALESCE(u.model_id, ''),
+        c.text, COALESCE(c.author, ''), COALESCE(c.created_at, ''), c.block_num
+        FROM bim_comments c LEFT JOIN bim_updates u ON u.update_id = c.update_id
+        WHERE c.block_num > ?`), after)
+    if err != nil {
+        return fmt.Errorf("failed to query comments: %v", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var d document
+        var commentID string
+        var block int64
+        if err := rows.Scan(&d.UpdateID, &commentID, &d.ModelID, &d.Comment, &d.Author, &d.Timestamp, &block); err != nil {
+            return err
+        }
+        d.Kind = kindComment
+        if err := add(kindComment+":"+d.UpdateID+":"+commentID, &d, block); err != nil {
+            return err
+        }
+    }
+    return rows.Err()
+}
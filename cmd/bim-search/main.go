@@ -0,0 +1,23 @@
+// Command bim-search serves full-text search over BIM update descriptions,
+// approval and discussion comments, and change manifest metadata.
+//
+// CouchDB selectors cannot do full-text search, so bim-search reads the reporting
+// database written by bim-exporter, keeps an embedded Bleve index in sync with it
+// and answers queries over HTTP:
+//
+//	bim-search --db-driver postgres --dsn "postgres://bim@db/reporting?sslmode=disable"
+//	curl 'localhost:8090/search?q=fire+rating&size=20'
+//	curl 'localhost:8090/search?q=kind:approval+%2BreasonCode:CLASH'
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "os/signal"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+
+    "github.com/blevesearch/bleve/v2"
+    _ "github.com/lib/pq"
+    "github.com/spf13/cobra"
+    _ "modernc.org/sqlite"
+)
+
+// maxPageSize bounds the size parameter of /search
+const maxPageSize = 100
+
+// options holds the command-line flags
+type options struct {
+    dbDriver string
+    dsn      string
+    index    string
+    listen   string
+    interval time.Duration
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "bim-search",
+        Short:         "Full-text search over exported BIM ledger data",
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            if opts.dbDriver != "postgres" && opts.dbDriver != "sqlite" {
+                return fmt.Errorf("--db-driver must be postgres or sqlite")
+            }
+            if opts.dsn == "" {
+                return fmt.Errorf("--dsn required")
+            }
+            ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+            defer stop()
+            return run(ctx, opts)
+        },
+    }
+
+    flags := root.Flags()
+    flags.StringVar(&opts.dbDriver, "db-driver", envOr("BIM_SEARCH_DB_DRIVER", "sqlite"), "bim-exporter database driver: postgres or sqlite (env BIM_SEARCH_DB_DRIVER)")
+    flags.StringVar(&opts.dsn, "dsn", os.Getenv("BIM_SEARCH_DSN"), "bim-exporter database connection string (env BIM_SEARCH_DSN)")
+    flags.StringVar(&opts.index, "index", envOr("BIM_SEARCH_INDEX", "bim.bleve"), "Bleve index directory (env BIM_SEARCH_INDEX)")
+    flags.StringVar(&opts.listen, "listen", envOr("BIM_SEARCH_LISTEN", ":8090"), "HTTP listen address (env BIM_SEARCH_LISTEN)")
+    flags.DurationVar(&opts.interval, "interval", 30*time.Second, "how often to pick up newly exported rows")
+    return root
+}
+
+// run keeps the index in sync and serves /search until ctx is cancelled
+func run(ctx context.Context, opts *options) error {
+    db, err := sql.Open(opts.dbDriver, opts.dsn)
+    if err != nil {
+        return fmt.Errorf("failed to open %s database: %v", opts.dbDriver, err)
+    }
+    defer db.Close()
+    idx, err := openIndex(opts.index)
+    if err != nil {
+        return err
+    }
+    defer idx.Close()
+
+    log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+    s := &syncer{db: db, index: idx, postgres: opts.dbDriver == "postgres"}
+
+    go func() {
+        ticker := time.NewTicker(opts.interval)
+        defer ticker.Stop()
+        for {
+            if n, err := s.sync(ctx); err != nil {
+                log.Error("index sync failed", "err", err)
+            } else if n > 0 {
+                log.Info("indexed", "documents", n)
+            }
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/search", searchHandler(idx))
+    srv := &http.Server{Addr: opts.listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+    go func() {
+        <-ctx.Done()
+        shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        srv.Shutdown(shutdown)
+    }()
+
+    log.Info("serving", "addr", opts.listen, "index", opts.index)
+    if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+        return err
+    }
+    return nil
+}
+
+// searchHit is one result of /search
+type searchHit struct {
+    ID        string              `json:"id"`
+    Score     float64             `json:"score"`
+    Kind      string              `json:"kind"`
+    UpdateID  string              `json:"updateId"`
+    ModelID   string              `json:"modelId"`
+    Fragments map[string][]string `json:"fragments,omitempty"`
+}
+
+// searchHandler serves GET /search?q=...&size=...&from=...
+// q uses the Bleve query string syntax, e.g. "fire rating", "+modelId:M-1 clash", "kind:comment"
+func searchHandler(idx bleve.Index) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        q := strings.TrimSpace(r.URL.Query().Get("q"))
+        if q == "" {
+            http.Error(w, "q required", http.StatusBadRequest)
+            return
+        }
+        size := intParam(r, "size", 20)
+        if size < 1 || size > maxPageSize {
+            http.Error(w, fmt.Sprintf("size must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+            return
+        }
+        from := intParam(r, "from", 0)
+        if from < 0 {
+            http.Error(w, "from must not be negative", http.StatusBadRequest)
+            return
+        }
+
+        req := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(q), size, from, false)
+        req.Fields = []string{"kind", "updateId", "modelId"}
+        req.Highlight = bleve.NewHighlight()
+        res, err := idx.Search(req)
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+
+        hits := make([]searchHit, 0, len(res.Hits))
+        for _, h := range res.Hits {
+            hits = append(hits, searchHit{
+                ID:        h.ID,
+                Score:     h.Score,
+                Kind:      stringField(h.Fields, "kind"),
+                UpdateID:  stringField(h.Fields, "updateId"),
+                ModelID:   stringField(h.Fields, "modelId"),
+                Fragments: h.Fragments,
+            })
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "total": res.Total,
+            "took":  res.Took.String(),
+            "hits":  hits,
+        })
+    }
+}
+
+// stringField returns a stored keyword field of a hit, or "" if it is missing
+func stringField(fields map[string]interface{}, name string) string {
+    v, _ := fields[name].(string)
+    return v
+}
+
+func intParam(r *http.Request, name string, fallback int) int {
+    v := r.URL.Query().Get(name)
+    if v == "" {
+        return fallback
+    }
+    n, err := strconv.Atoi(v)
+    if err != nil {
+        return -1
+    }
+    return n
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
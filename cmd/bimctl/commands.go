@@ -0,0 +1,185 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+
+    "github.com/spf13/cobra"
+)
+
+func newInitUpdateCommand(opts *options) *cobra.Command {
+    var file string
+    var dryRun bool
+    var update updateInput
+    cmd := &cobra.Command{
+        Use:   "init-update",
+        Short: "Initialize a BIM model update (role=modeler)",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            payload, err := updatePayload(file, &update)
+            if err != nil {
+                return err
+            }
+            s, err := connect(opts)
+            if err != nil {
+                return err
+            }
+            defer s.Close()
+
+            if dryRun {
+                return s.dryRun(initContract, "DryRunInitBIMUpdate", string(payload))
+            }
+            // a retry with the same ClientRequestID returns the UpdateID of the first attempt
+            result, err := s.submit(initContract, "InitBIMUpdate", string(payload))
+            if err != nil {
+                return fmt.Errorf("InitBIMUpdate failed: %v", err)
+            }
+            return printStatus(opts, "INITIALIZED", string(result))
+        },
+    }
+    cmd.Flags().StringVarP(&file, "file", "f", "", "update JSON file (overrides the field flags)")
+    cmd.Flags().StringVar(&update.UpdateID, "update-id", "", "update ID (generated by the chaincode if empty)")
+    cmd.Flags().StringVar(&update.ModelID, "model-id", "", "model ID")
+    cmd.Flags().StringVar(&update.Version, "version", "", "model version")
+    cmd.Flags().StringVar(&update.Description, "description", "", "change description")
+    cmd.Flags().StringVar(&update.ReviewMode, "review-mode", "", "OPEN or BLIND")
+    cmd.Flags().StringVar(&update.ClientRequestID, "client-request-id", "", "idempotency key; safe to retry with the same value")
+    cmd.Flags().BoolVar(&dryRun, "dry-run", false, "evaluate only: show the would-be result and state changes without submitting")
+    return cmd
+}
+
+func newApproveCommand(opts *options) *cobra.Command {
+    var result, comment, reason string
+    var dryRun bool
+    cmd := &cobra.Command{
+        Use:   "approve <updateID>",
+        Short: "Approve or reject an update (role=professional)",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            s, err := connect(opts)
+            if err != nil {
+                return err
+            }
+            defer s.Close()
+
+            if dryRun {
+                return s.dryRun(approvalContract, "DryRunApproveBIMUpdate", args[0], result, comment, reason)
+            }
+            if _, err := s.submit(approvalContract, "ApproveBIMUpdate", args[0], result, comment, reason); err != nil {
+                return fmt.Errorf("ApproveBIMUpdate failed: %v", err)
+            }
+            return printStatus(opts, result, args[0])
+        },
+    }
+    cmd.Flags().StringVar(&result, "result", "APPROVED", "APPROVED or REJECTED")
+    cmd.Flags().StringVar(&comment, "comment", "", "review comment (required when rejecting)")
+    cmd.Flags().StringVar(&reason, "reason", "", "rejection reason: CLASH, STANDARD_VIOLATION, INCOMPLETE or OTHER")
+    cmd.Flags().BoolVar(&dryRun, "dry-run", false, "evaluate only: show the would-be result and state changes without submitting")
+    return cmd
+}
+
+func newPublishCommand(opts *options) *cobra.Command {
+    return &cobra.Command{
+        Use:   "publish <updateID>",
+        Short: "Publish an approved update (role=bim_lead)",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            s, err := connect(opts)
+            if err != nil {
+                return err
+            }
+            defer s.Close()
+
+            if _, err := s.submit(approvalContract, "PublishBIMUpdate", args[0]); err != nil {
+                return fmt.Errorf("PublishBIMUpdate failed: %v", err)
+            }
+            return printStatus(opts, "PUBLISHED", args[0])
+        },
+    }
+}
+
+func newQueryCommand(opts *options) *cobra.Command {
+    return &cobra.Command{
+        Use:   "query <updateID>",
+        Short: "Show an update with its approval record",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            s, err := connect(opts)
+            if err != nil {
+                return err
+            }
+            defer s.Close()
+
+            data, err := s.evaluate(queryContract, "QueryUpdate", args[0])
+            if err != nil {
+                return fmt.Errorf("QueryUpdate failed: %v", err)
+            }
+            var rec historyRecord
+            if err := json.Unmarshal(data, &rec); err != nil {
+                return fmt.Errorf("failed to parse result: %v", err)
+            }
+            return printRecords(opts, []historyRecord{rec})
+        },
+    }
+}
+
+// historyPageSize is the number of records fetched per QueryModelHistory call
+const historyPageSize = 100
+
+func newHistoryCommand(opts *options) *cobra.Command {
+    return &cobra.Command{
+        Use:   "history <modelID>",
+        Short: "List all updates of a model",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            s, err := connect(opts)
+            if err != nil {
+                return err
+            }
+            defer s.Close()
+
+            var recs []historyRecord
+            bookmark := ""
+            for {
+                data, err := s.evaluate(queryContract, "QueryModelHistory", args[0], strconv.Itoa(historyPageSize), bookmark)
+                if err != nil {
+                    return fmt.Errorf("QueryModelHistory failed: %v", err)
+                }
+                var page struct {
+                    Records      []historyRecord `json:"Records"`
+                    FetchedCount int             `json:"FetchedCount"`
+                    Bookmark     string          `json:"Bookmark"`
+                }
+                if err := json.Unmarshal(data, &page); err != nil {
+                    return fmt.Errorf("failed to parse result: %v", err)
+                }
+                recs = append(recs, page.Records...)
+                if page.FetchedCount < historyPageSize || page.Bookmark == "" {
+                    break
+                }
+                bookmark = page.Bookmark
+            }
+            return printRecords(opts, recs)
+        },
+    }
+}
+
+// updatePayload builds the InitBIMUpdate JSON from a file or from the field flags
+func updatePayload(file string, update *updateInput) ([]byte, error) {
+    if file != "" {
+        data, err := os.ReadFile(file)
+        if err != nil {
+            return nil, err
+        }
+        if err := json.Unmarshal(data, update); err != nil {
+            return nil, fmt.Errorf("invalid update file %s: %v", file, err)
+        }
+        return data, nil
+    }
+    if update.ModelID == "" || update.Version == "" {
+        return nil, fmt.Errorf("--model-id and --version are required (or use --file)")
+    }
+    return json.Marshal(update)
+}
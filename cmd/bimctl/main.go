@@ -0,0 +1,23 @@
+// Command bimctl is a command-line client for the BIM chaincode.
+//
+// It connects through the Fabric gateway using a connection profile and a
+// filesystem wallet, and wraps the init, approval and query contracts:
+//
+//	bimctl init-update --file update.json
+//	bimctl approve U-001 --result REJECTED --reason CLASH --comment "duct clashes with beam B12"
+//	bimctl publish U-001
+//	bimctl query U-001
+//	bimctl history M-TOWER-A --output table
+package main
+
+import (
+    "fmt"
+    "os"
+)
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+    "text/tabwriter"
+)
+
+// updateInput is the InitBIMUpdate payload accepted by the init contract
+type updateInput struct {
+    UpdateID    string `json:"UpdateID,omitempty"`
+    ModelID     string `json:"ModelID"`
+    Version     string `json:"Version"`
+    Description string `json:"Description"`
+    ReviewMode  string `json:"ReviewMode,omitempty"`
+
+    ClientRequestID string `json:"ClientRequestID,omitempty"`
+}
+
+// historyRecord mirrors QueryContract's BIMHistoryRecord JSON
+type historyRecord struct {
+    UpdateID   string `json:"UpdateID"`
+    InitRecord *struct {
+        ModelID   string `json:"ModelID"`
+        Version   string `json:"Version"`
+        Initiator string `json:"Initiator"`
+        Timestamp string `json:"Timestamp"`
+        Status    string `json:"Status"`
+    } `json:"InitRecord"`
+    Approval *struct {
+        Approver      string `json:"Approver"`
+        ApproveResult string `json:"ApproveResult"`
+        ReasonCode    string `json:"ReasonCode"`
+        Timestamp     string `json:"Timestamp"`
+    } `json:"ApprovalRecord"`
+}
+
+// dryRunReport mirrors the chaincode's DryRunResult JSON
+type dryRunReport struct {
+    Result           string `json:"Result,omitempty"`
+    Error            string `json:"Error,omitempty"`
+    ValidationErrors []struct {
+        Field   string `json:"Field"`
+        Message string `json:"Message"`
+    } `json:"ValidationErrors,omitempty"`
+    Writes []struct {
+        ObjectType string   `json:"ObjectType,omitempty"`
+        Attrs      []string `json:"Attrs"`
+        Value      string   `json:"Value,omitempty"`
+        Deleted    bool     `json:"Deleted,omitempty"`
+    } `json:"Writes"`
+    Event *struct {
+        Name    string `json:"Name"`
+        Payload string `json:"Payload"`
+    } `json:"Event,omitempty"`
+}
+
+func printDryRun(opts *options, r *dryRunReport) error {
+    if opts.output == "json" {
+        return printJSON(r)
+    }
+    if r.Error != "" {
+        fmt.Printf("WOULD FAIL: %s\n", r.Error)
+        for _, fe := range r.ValidationErrors {
+            fmt.Printf("  %s: %s\n", fe.Field, fe.Message)
+        }
+        return nil
+    }
+    if r.Result != "" {
+        fmt.Printf("RESULT: %s\n", r.Result)
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "OP\tOBJECT TYPE\tKEY\tSIZE")
+    for _, c := range r.Writes {
+        op, objectType := "PUT", c.ObjectType
+        if c.Deleted {
+            op = "DEL"
+        }
+        if objectType == "" {
+            objectType = "-"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", op, objectType, strings.Join(c.Attrs, "/"), len(c.Value))
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    if r.Event != nil {
+        fmt.Printf("EVENT: %s\n", r.Event.Name)
+    }
+    return nil
+}
+
+func printStatus(opts *options, status string, updateID string) error {
+    if opts.output == "table" {
+        fmt.Printf("%s\t%s\n", updateID, status)
+        return nil
+    }
+    return printJSON(map[string]string{"UpdateID": updateID, "Status": status})
+}
+
+func printRecords(opts *options, recs []historyRecord) error {
+    if opts.output == "json" {
+        if recs == nil {
+            recs = []historyRecord{}
+        }
+        return printJSON(recs)
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "UPDATE ID\tMODEL\tVERSION\tSTATUS\tINITIATED\tDECISION\tDECIDED BY")
+    for _, r := range recs {
+        model, version, status, initiated := "-", "-", "-", "-"
+        if r.InitRecord != nil {
+            model, version, status, initiated = r.InitRecord.ModelID, r.InitRecord.Version, r.InitRecord.Status, r.InitRecord.Timestamp
+        }
+        decision, approver := "-", "-"
+        if r.Approval != nil {
+            decision = r.Approval.ApproveResult
+            if r.Approval.ReasonCode != "" {
+                decision += " (" + r.Approval.ReasonCode + ")"
+            }
+            approver = shorten(r.Approval.Approver, 32)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.UpdateID, model, version, status, initiated, decision, approver)
+    }
+    return w.Flush()
+}
+
+func printJSON(v interface{}) error {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(v)
+}
+
+// shorten truncates long x509 identity strings for table output
+func shorten(s string, n int) string {
+    if len(s) <= n {
+        return s
+    }
+    return s[:n-3] + "..."
+}
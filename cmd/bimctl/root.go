@@ -0,0 +1,160 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+
+    pb "github.com/hyperledger/fabric-protos-go/peer"
+    "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+    "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+    "github.com/spf13/cobra"
+)
+
+// Contract names as registered in the chaincode
+const (
+    initContract     = "SmartContract"
+    approvalContract = "ApprovalContract"
+    queryContract    = "QueryContract"
+)
+
+// options holds the global flags shared by every subcommand
+type options struct {
+    profile   string
+    wallet    string
+    identity  string
+    channel   string
+    chaincode string
+    output    string
+    wait      bool
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "bimctl",
+        Short:         "Command-line client for the BIM model update chaincode",
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+            if opts.output != "json" && opts.output != "table" {
+                return fmt.Errorf("--output must be json or table")
+            }
+            return nil
+        },
+    }
+
+    flags := root.PersistentFlags()
+    flags.StringVar(&opts.profile, "profile", envOr("BIMCTL_PROFILE", "connection.yaml"), "connection profile (env BIMCTL_PROFILE)")
+    flags.StringVar(&opts.wallet, "wallet", envOr("BIMCTL_WALLET", "wallet"), "filesystem wallet directory (env BIMCTL_WALLET)")
+    flags.StringVar(&opts.identity, "identity", envOr("BIMCTL_IDENTITY", "appUser"), "wallet identity label (env BIMCTL_IDENTITY)")
+    flags.StringVar(&opts.channel, "channel", envOr("BIMCTL_CHANNEL", "mychannel"), "channel name (env BIMCTL_CHANNEL)")
+    flags.StringVar(&opts.chaincode, "chaincode", envOr("BIMCTL_CHAINCODE", "bim"), "chaincode name (env BIMCTL_CHAINCODE)")
+    flags.StringVarP(&opts.output, "output", "o", "json", "output format: json or table")
+    flags.BoolVar(&opts.wait, "wait-for-commit", false, "wait for the commit event and fail unless the transaction was committed VALID")
+
+    root.AddCommand(
+        newInitUpdateCommand(opts),
+        newApproveCommand(opts),
+        newPublishCommand(opts),
+        newQueryCommand(opts),
+        newHistoryCommand(opts),
+    )
+    return root
+}
+
+// session is an open gateway connection bound to the configured channel
+type session struct {
+    gw      *gateway.Gateway
+    network *gateway.Network
+    opts    *options
+}
+
+// connect opens the gateway using the connection profile and wallet identity
+func connect(opts *options) (*session, error) {
+    wallet, err := gateway.NewFileSystemWallet(opts.wallet)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open wallet %s: %v", opts.wallet, err)
+    }
+    if !wallet.Exists(opts.identity) {
+        return nil, fmt.Errorf("identity %q not found in wallet %s", opts.identity, opts.wallet)
+    }
+
+    gw, err := gateway.Connect(
+        gateway.WithConfig(config.FromFile(filepath.Clean(opts.profile))),
+        gateway.WithIdentity(wallet, opts.identity),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to gateway: %v", err)
+    }
+    network, err := gw.GetNetwork(opts.channel)
+    if err != nil {
+        gw.Close()
+        return nil, fmt.Errorf("failed to get channel %s: %v", opts.channel, err)
+    }
+    return &session{gw: gw, network: network, opts: opts}, nil
+}
+
+func (s *session) Close() {
+    s.gw.Close()
+}
+
+// submit sends a transaction to be endorsed and committed. With --wait-for-commit it also
+// waits for the transaction's commit event and reports the block on stderr.
+func (s *session) submit(contract string, fn string, args ...string) ([]byte, error) {
+    cc := s.network.GetContractWithName(s.opts.chaincode, contract)
+    if !s.opts.wait {
+        return cc.SubmitTransaction(fn, args...)
+    }
+    tx, err := cc.CreateTransaction(fn)
+    if err != nil {
+        return nil, err
+    }
+    commit := tx.RegisterCommitEvent()
+    result, err := tx.Submit(args...)
+    if err != nil {
+        return nil, err
+    }
+    ev, ok := <-commit
+    if !ok || ev == nil {
+        return nil, fmt.Errorf("no commit event received")
+    }
+    if ev.TxValidationCode != pb.TxValidationCode_VALID {
+        return nil, fmt.Errorf("transaction %s was not committed: %s", ev.TxID, ev.TxValidationCode)
+    }
+    fmt.Fprintf(os.Stderr, "transaction %s committed in block %d\n", ev.TxID, ev.BlockNumber)
+    return result, nil
+}
+
+// evaluate runs a read-only query on a peer
+func (s *session) evaluate(contract string, fn string, args ...string) ([]byte, error) {
+    return s.network.GetContractWithName(s.opts.chaincode, contract).EvaluateTransaction(fn, args...)
+}
+
+// dryRun evaluates a DryRun* chaincode function and prints its report.
+// A transaction that would fail is reported as an error after printing the details.
+func (s *session) dryRun(contract string, fn string, args ...string) error {
+    data, err := s.evaluate(contract, fn, args...)
+    if err != nil {
+        return fmt.Errorf("%s failed: %v", fn, err)
+    }
+    var report dryRunReport
+    if err := json.Unmarshal(data, &report); err != nil {
+        return fmt.Errorf("failed to parse result: %v", err)
+    }
+    if err := printDryRun(s.opts, &report); err != nil {
+        return err
+    }
+    if report.Error != "" {
+        return fmt.Errorf("dry run: transaction would fail: %s", report.Error)
+    }
+    return nil
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
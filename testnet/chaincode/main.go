@@ -0,0 +1,24 @@
+// Command chaincode starts the BIM contracts as one Fabric chaincode.
+//
+// The chaincode sources live in "Smart Contract Group", which cannot be used as an
+// import path. `make testnet-deploy` copies them to testnet/build/chaincode and
+// this file to testnet/build, adds a go.mod for module "bim" and packages the result.
+package main
+
+import (
+    "log"
+
+    "bim/chaincode"
+
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func main() {
+    cc, err := contractapi.NewChaincode(chaincode.Contracts()...)
+    if err != nil {
+        log.Fatalf("failed to create chaincode: %v", err)
+    }
+    if err := cc.Start(); err != nil {
+        log.Fatalf("failed to start chaincode: %v", err)
+    }
+}
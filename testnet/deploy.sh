@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+# Packages the BIM chaincode and deploys it to the microfab network started by
+# docker-compose.yaml. Run from the repository root (make testnet-deploy).
+#
+# Needs: curl, npx (for weft), go, and the Fabric peer CLI on PATH with
+# FABRIC_CFG_PATH pointing at its config directory.
+set -euo pipefail
+
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+NET="$ROOT/testnet"
+BUILD="$NET/build"
+CONSOLE=${MICROFAB_CONSOLE:-http://console.127-0-0-1.nip.io:8080}
+CHANNEL=${BIM_CHANNEL:-mychannel}
+CC_NAME=${BIM_CHAINCODE:-bim}
+CC_VERSION=${BIM_CC_VERSION:-$(date +%s)}
+ORDERER=orderer-api.127-0-0-1.nip.io:8080
+
+# 1. wallets, gateway profiles and admin MSP directories for the running network
+curl -sf "$CONSOLE/ak/api/v1/components" |
+    npx --yes @hyperledger-labs/weft microfab -w "$NET/_wallets" -p "$NET/_gateways" -m "$NET/_msp" -f
+
+# 2. stage the chaincode as module "bim": the contracts become package bim/chaincode
+rm -rf "$BUILD"
+mkdir -p "$BUILD/chaincode"
+find "$ROOT/Smart Contract Group" -maxdepth 1 -name '*.go' -exec cp {} "$BUILD/chaincode/" \;
+cp -r "$ROOT/Smart Contract Group/META-INF" "$BUILD/META-INF"
+cp "$NET/chaincode/main.go" "$BUILD/main.go"
+(cd "$BUILD" && go mod init bim >/dev/null 2>&1 && go mod tidy && go mod vendor)
+
+# 3. install, approve and commit with the Org1 admin
+: "${FABRIC_CFG_PATH:?set FABRIC_CFG_PATH to the directory holding the peer CLI core.yaml}"
+export CORE_PEER_LOCALMSPID=Org1MSP
+export CORE_PEER_MSPCONFIGPATH="$NET/_msp/Org1/org1admin/msp"
+export CORE_PEER_ADDRESS=org1peer-api.127-0-0-1.nip.io:8080
+
+# every deploy is a new definition; the sequence follows the committed one
+SEQUENCE=$(peer lifecycle chaincode querycommitted -C "$CHANNEL" -n "$CC_NAME" 2>/dev/null |
+    sed -n 's/.*Sequence: \([0-9]*\).*/\1/p')
+SEQUENCE=$(( ${SEQUENCE:-0} + 1 ))
+
+LABEL="${CC_NAME}_${CC_VERSION}"
+peer lifecycle chaincode package "$BUILD/$LABEL.tgz" --path "$BUILD" --lang golang --label "$LABEL"
+peer lifecycle chaincode install "$BUILD/$LABEL.tgz"
+PACKAGE_ID=$(peer lifecycle chaincode queryinstalled |
+    sed -n "s/^Package ID: \(${LABEL}:[0-9a-f]*\), Label: ${LABEL}\$/\1/p")
+if [ -z "$PACKAGE_ID" ]; then
+    echo "package $LABEL was not installed" >&2
+    exit 1
+fi
+
+peer lifecycle chaincode approveformyorg -o "$ORDERER" -C "$CHANNEL" -n "$CC_NAME" \
+    --version "$CC_VERSION" --sequence "$SEQUENCE" --package-id "$PACKAGE_ID" --waitForEvent
+peer lifecycle chaincode commit -o "$ORDERER" -C "$CHANNEL" -n "$CC_NAME" \
+    --version "$CC_VERSION" --sequence "$SEQUENCE" --waitForEvent
+
+echo "deployed $CC_NAME version $CC_VERSION (sequence $SEQUENCE) on $CHANNEL"
@@ -0,0 +1,270 @@
+// Command e2e runs the BIM update lifecycle against a deployed chaincode:
+// init → query → approve → query → publish → query, plus the permission checks
+// a peer enforces that the in-memory chaincodetest harness only approximates.
+//
+// It expects the network from testnet/docker-compose.yaml with the chaincode deployed
+// and the test users registered (make testnet-up testnet-deploy testnet-users), then
+//
+//	go run ./testnet/e2e
+//
+// Every step is printed; the command exits non-zero on the first failure.
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+    "github.com/hyperledger/fabric-sdk-go/pkg/gateway"
+    "github.com/spf13/cobra"
+)
+
+// Contract names as registered in testnet/chaincode/main.go
+const (
+    initContract     = "SmartContract"
+    approvalContract = "ApprovalContract"
+    queryContract    = "QueryContract"
+)
+
+type options struct {
+    profile   string
+    wallet    string
+    channel   string
+    chaincode string
+
+    modeler  string
+    reviewer string
+    lead     string
+}
+
+func main() {
+    if err := newRootCommand().Execute(); err != nil {
+        fmt.Fprintln(os.Stderr, "error:", err)
+        os.Exit(1)
+    }
+}
+
+func newRootCommand() *cobra.Command {
+    opts := &options{}
+    root := &cobra.Command{
+        Use:           "e2e",
+        Short:         "Run the end-to-end lifecycle test against a Fabric network",
+        Args:          cobra.NoArgs,
+        SilenceUsage:  true,
+        SilenceErrors: true,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            return run(opts)
+        },
+    }
+    flags := root.Flags()
+    flags.StringVar(&opts.profile, "profile", envOr("BIM_E2E_PROFILE", "testnet/_gateways/org1gateway.json"), "connection profile (env BIM_E2E_PROFILE)")
+    flags.StringVar(&opts.wallet, "wallet", envOr("BIM_E2E_WALLET", "testnet/_wallets/Org1"), "filesystem wallet holding the test users (env BIM_E2E_WALLET)")
+    flags.StringVar(&opts.channel, "channel", envOr("BIM_CHANNEL", "mychannel"), "channel name (env BIM_CHANNEL)")
+    flags.StringVar(&opts.chaincode, "chaincode", envOr("BIM_CHAINCODE", "bim"), "chaincode name (env BIM_CHAINCODE)")
+    flags.StringVar(&opts.modeler, "modeler", "e2e-modeler", "wallet label of a role=modeler user")
+    flags.StringVar(&opts.reviewer, "reviewer", "e2e-reviewer", "wallet label of a role=professional user")
+    flags.StringVar(&opts.lead, "lead", "e2e-lead", "wallet label of a role=bim_lead user")
+    return root
+}
+
+// updateRecord is the part of QueryContract's BIMHistoryRecord the test checks
+type updateRecord struct {
+    UpdateID   string `json:"UpdateID"`
+    InitRecord *struct {
+        ModelID   string `json:"ModelID"`
+        Version   string `json:"Version"`
+        Initiator string `json:"Initiator"`
+        Status    string `json:"Status"`
+    } `json:"InitRecord"`
+    Approval *struct {
+        ApproveResult string `json:"ApproveResult"`
+    } `json:"ApprovalRecord"`
+}
+
+func run(opts *options) error {
+    modeler, err := connect(opts, opts.modeler)
+    if err != nil {
+        return err
+    }
+    defer modeler.Close()
+    reviewer, err := connect(opts, opts.reviewer)
+    if err != nil {
+        return err
+    }
+    defer reviewer.Close()
+    lead, err := connect(opts, opts.lead)
+    if err != nil {
+        return err
+    }
+    defer lead.Close()
+
+    // a fresh model per run, so runs against the same ledger do not interfere
+    modelID := fmt.Sprintf("E2E-%d", time.Now().Unix())
+    var updateID string
+
+    steps := []struct {
+        name string
+        fn   func() error
+    }{
+        {"modeler initializes an update", func() error {
+            payload, err := json.Marshal(map[string]string{
+                "ModelID":         modelID,
+                "Version":         "1.0.0",
+                "Description":     "end-to-end test update",
+                "ClientRequestID": modelID + "-init",
+            })
+            if err != nil {
+                return err
+            }
+            result, err := modeler.submit(initContract, "InitBIMUpdate", string(payload))
+            if err != nil {
+                return err
+            }
+            updateID = strings.TrimSpace(string(result))
+            if updateID == "" {
+                return fmt.Errorf("InitBIMUpdate returned no UpdateID")
+            }
+            return nil
+        }},
+        {"retry with the same ClientRequestID returns the same update", func() error {
+            payload, _ := json.Marshal(map[string]string{
+                "ModelID":         modelID,
+                "Version":         "1.0.0",
+                "Description":     "end-to-end test update",
+                "ClientRequestID": modelID + "-init",
+            })
+            result, err := modeler.submit(initContract, "InitBIMUpdate", string(payload))
+            if err != nil {
+                return err
+            }
+            if got := strings.TrimSpace(string(result)); got != updateID {
+                return fmt.Errorf("got UpdateID %s, want %s", got, updateID)
+            }
+            return nil
+        }},
+        {"update is INITIALIZED", func() error { return expectStatus(modeler, updateID, "INITIALIZED") }},
+        {"modeler cannot publish", func() error {
+            return expectDenied(modeler.submit(approvalContract, "PublishBIMUpdate", updateID))
+        }},
+        {"reviewer approves", func() error {
+            _, err := reviewer.submit(approvalContract, "ApproveBIMUpdate", updateID, "APPROVED", "checked by e2e", "")
+            return err
+        }},
+        {"update is APPROVED", func() error { return expectStatus(reviewer, updateID, "APPROVED") }},
+        {"reviewer cannot vote twice", func() error {
+            return expectDenied(reviewer.submit(approvalContract, "ApproveBIMUpdate", updateID, "APPROVED", "again", ""))
+        }},
+        {"BIM lead publishes", func() error {
+            _, err := lead.submit(approvalContract, "PublishBIMUpdate", updateID)
+            return err
+        }},
+        {"update is PUBLISHED", func() error { return expectStatus(lead, updateID, "PUBLISHED") }},
+        {"update appears in the model history", func() error {
+            data, err := lead.evaluate(queryContract, "QueryModelHistory", modelID, "10", "")
+            if err != nil {
+                return err
+            }
+            var page struct {
+                Records []updateRecord `json:"Records"`
+            }
+            if err := json.Unmarshal(data, &page); err != nil {
+                return fmt.Errorf("failed to parse history: %v", err)
+            }
+            if len(page.Records) != 1 || page.Records[0].UpdateID != updateID {
+                return fmt.Errorf("history of %s has %d records, want only %s", modelID, len(page.Records), updateID)
+            }
+            return nil
+        }},
+    }
+
+    for _, step := range steps {
+        start := time.Now()
+        if err := step.fn(); err != nil {
+            fmt.Printf("FAIL  %s: %v\n", step.name, err)
+            return fmt.Errorf("end-to-end test failed")
+        }
+        fmt.Printf("ok    %s (%s)\n", step.name, time.Since(start).Round(time.Millisecond))
+    }
+    fmt.Printf("PASS  update %s on model %s\n", updateID, modelID)
+    return nil
+}
+
+// expectStatus queries the update and compares its status
+func expectStatus(s *session, updateID string, want string) error {
+    data, err := s.evaluate(queryContract, "QueryUpdate", updateID)
+    if err != nil {
+        return err
+    }
+    var rec updateRecord
+    if err := json.Unmarshal(data, &rec); err != nil {
+        return fmt.Errorf("failed to parse QueryUpdate result: %v", err)
+    }
+    if rec.InitRecord == nil {
+        return fmt.Errorf("QueryUpdate returned no InitRecord")
+    }
+    if rec.InitRecord.Status != want {
+        return fmt.Errorf("status is %s, want %s", rec.InitRecord.Status, want)
+    }
+    return nil
+}
+
+// expectDenied checks that a transaction was rejected by the chaincode
+func expectDenied(_ []byte, err error) error {
+    if err == nil {
+        return fmt.Errorf("transaction succeeded, want it rejected")
+    }
+    return nil
+}
+
+// session is a gateway connection as one wallet identity
+type session struct {
+    gw      *gateway.Gateway
+    network *gateway.Network
+    opts    *options
+}
+
+func connect(opts *options, identity string) (*session, error) {
+    wallet, err := gateway.NewFileSystemWallet(opts.wallet)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open wallet %s: %v", opts.wallet, err)
+    }
+    if !wallet.Exists(identity) {
+        return nil, fmt.Errorf("identity %q not found in wallet %s (run make testnet-users)", identity, opts.wallet)
+    }
+    gw, err := gateway.Connect(
+        gateway.WithConfig(config.FromFile(filepath.Clean(opts.profile))),
+        gateway.WithIdentity(wallet, identity),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to gateway as %s: %v", identity, err)
+    }
+    network, err := gw.GetNetwork(opts.channel)
+    if err != nil {
+        gw.Close()
+        return nil, fmt.Errorf("failed to get channel %s: %v", opts.channel, err)
+    }
+    return &session{gw: gw, network: network, opts: opts}, nil
+}
+
+func (s *session) Close() {
+    s.gw.Close()
+}
+
+func (s *session) submit(contract string, fn string, args ...string) ([]byte, error) {
+    return s.network.GetContractWithName(s.opts.chaincode, contract).SubmitTransaction(fn, args...)
+}
+
+func (s *session) evaluate(contract string, fn string, args ...string) ([]byte, error) {
+    return s.network.GetContractWithName(s.opts.chaincode, contract).EvaluateTransaction(fn, args...)
+}
+
+func envOr(key string, fallback string) string {
+    if v, ok := os.LookupEnv(key); ok {
+        return v
+    }
+    return fallback
+}
@@ -0,0 +1,24 @@
+#!/usr/bin/env bash
+# Stages the contracts, the mapping suite and the simulation as module "bim" and runs
+# the simulate command on them. Run from the repository root (make simulate); the
+# arguments are passed to the command, e.g. --cycles 5000 --workers 16.
+#
+# Needs: go.
+set -euo pipefail
+
+ROOT=$(cd "$(dirname "$0")/.." && pwd)
+NET="$ROOT/testnet"
+BUILD="$NET/build/simulate"
+
+# the source directories cannot be import paths; copy them to bim/<package>
+rm -rf "$BUILD"
+mkdir -p "$BUILD/chaincode" "$BUILD/chaincodetest" "$BUILD/mapping" "$BUILD/simulation"
+find "$ROOT/Smart Contract Group" -maxdepth 1 -name '*.go' -exec cp {} "$BUILD/chaincode/" \;
+cp "$ROOT/Smart Contract Group/chaincodetest/"*.go "$BUILD/chaincodetest/"
+find "$ROOT/One-to-Many Mapping Suite" -maxdepth 1 -name '*.go' -exec cp {} "$BUILD/mapping/" \;
+cp -r "$ROOT/One-to-Many Mapping Suite/schemas" "$BUILD/mapping/schemas"
+cp "$NET/simulation/"*.go "$BUILD/simulation/"
+cp "$NET/simulate/main.go" "$BUILD/main.go"
+(cd "$BUILD" && go mod init bim >/dev/null 2>&1 && go mod tidy)
+
+cd "$BUILD" && go run . "$@"
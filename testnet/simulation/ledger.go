@@ -0,0 +1,253 @@
+// Package simulation runs the BIM pipeline without a Fabric network: the mapping suite
+// uploads and packages model files, the contracts execute on an in-memory ledger, and
+// chaincode events reach the mapping suite's event consumers, so thousands of
+// init/approve cycles can be timed on one machine.
+//
+// The ledger follows Fabric's execute-order-validate flow closely enough for the
+// contracts' concurrency behaviour to show: transactions execute in parallel against the
+// committed state, then commit one at a time after an MVCC check of everything they
+// read. It is not a performance model of a peer; there is no endorsement, ordering,
+// gossip or disk I/O.
+//
+// The package imports the contracts as bim/chaincode and the mapping suite as
+// bim/mapping; testnet/simulate.sh stages both, like deploy.sh stages the chaincode.
+package simulation
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+    "sync/atomic"
+
+    "github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// EventHandler receives committed chaincode events, with the signature of the
+// mapping suite's HandleEvent methods (Dispatcher, WatchList, PinManager, ...)
+type EventHandler func(eventName string, txID string, payload []byte) error
+
+// Event is a chaincode event of a committed transaction
+type Event struct {
+    BlockNumber uint64
+    TxID        string
+    Name        string
+    Payload     []byte
+}
+
+// Ledger is the world state of one channel. It is safe for concurrent use. Every valid
+// transaction is committed in a block of its own; invalid ones leave no trace.
+type Ledger struct {
+    channel string
+
+    mu     sync.RWMutex
+    state  map[string]entry
+    keys   []string // sorted keys of state, for range and composite key queries
+    height uint64
+
+    // committed events wait in queue until the delivery goroutine hands them to the
+    // handlers, in block order; the queue is unbounded so a handler may submit
+    // transactions itself
+    qmu       sync.Mutex
+    qcond     *sync.Cond
+    queue     []*Event
+    handlers  []EventHandler
+    pending   int // events queued or being delivered
+    closed    bool
+    done      chan struct{}
+    delivered uint64
+    failures  uint64
+}
+
+type entry struct {
+    value   []byte
+    version uint64 // block that last wrote the key
+}
+
+// NewLedger returns an empty ledger for channel and starts its event delivery
+func NewLedger(channel string) *Ledger {
+    l := &Ledger{channel: channel, state: map[string]entry{}, done: make(chan struct{})}
+    l.qcond = sync.NewCond(&l.qmu)
+    go l.deliver()
+    return l
+}
+
+// Channel returns the channel name transactions see in GetChannelID
+func (l *Ledger) Channel() string {
+    return l.channel
+}
+
+// Height returns the number of committed blocks
+func (l *Ledger) Height() uint64 {
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+    return l.height
+}
+
+// Len returns the number of keys in the world state
+func (l *Ledger) Len() int {
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+    return len(l.keys)
+}
+
+// Subscribe adds a handler for the events of transactions committed from now on
+func (l *Ledger) Subscribe(h EventHandler) {
+    l.qmu.Lock()
+    l.handlers = append(l.handlers, h)
+    l.qmu.Unlock()
+}
+
+// Sync waits until the events of all transactions committed so far were delivered
+func (l *Ledger) Sync() {
+    l.qmu.Lock()
+    for l.pending > 0 {
+        l.qcond.Wait()
+    }
+    l.qmu.Unlock()
+}
+
+// Close delivers the queued events and stops the delivery goroutine. Transactions
+// committed afterwards emit no events.
+func (l *Ledger) Close() {
+    l.qmu.Lock()
+    if !l.closed {
+        l.closed = true
+        l.qcond.Broadcast()
+    }
+    l.qmu.Unlock()
+    <-l.done
+}
+
+// Delivered returns how many events reached the handlers and how many handler calls
+// returned an error
+func (l *Ledger) Delivered() (events uint64, failures uint64) {
+    return atomic.LoadUint64(&l.delivered), atomic.LoadUint64(&l.failures)
+}
+
+func (l *Ledger) deliver() {
+    defer close(l.done)
+    for {
+        l.qmu.Lock()
+        for len(l.queue) == 0 && !l.closed {
+            l.qcond.Wait()
+        }
+        if len(l.queue) == 0 {
+            l.qmu.Unlock()
+            return
+        }
+        ev := l.queue[0]
+        l.queue = l.queue[1:]
+        handlers := l.handlers
+        l.qmu.Unlock()
+
+        for _, h := range handlers {
+            if err := h(ev.Name, ev.TxID, ev.Payload); err != nil {
+                atomic.AddUint64(&l.failures, 1)
+            }
+        }
+        atomic.AddUint64(&l.delivered, 1)
+
+        l.qmu.Lock()
+        l.pending--
+        l.qcond.Broadcast()
+        l.qmu.Unlock()
+    }
+}
+
+// get returns the committed value and version of key; version 0 means absent
+func (l *Ledger) get(key string) ([]byte, uint64) {
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+    e := l.state[key]
+    return e.value, e.version
+}
+
+// scan returns the committed entries with start <= key < end, at most limit of them
+// (limit <= 0 for all); end "" is unbounded. next is the first key left out, or "".
+func (l *Ledger) scan(start, end string, limit int) (kvs []*queryresult.KV, versions []uint64, next string) {
+    l.mu.RLock()
+    defer l.mu.RUnlock()
+    for i := sort.SearchStrings(l.keys, start); i < len(l.keys); i++ {
+        key := l.keys[i]
+        if end != "" && key >= end {
+            break
+        }
+        if limit > 0 && len(kvs) == limit {
+            return kvs, versions, key
+        }
+        e := l.state[key]
+        kvs = append(kvs, &queryresult.KV{Namespace: "bim", Key: key, Value: e.value})
+        versions = append(versions, e.version)
+    }
+    return kvs, versions, ""
+}
+
+// commit validates the read set of tx against the committed state and applies its
+// writes in a new block. Conflicts carry the validation codes a peer reports.
+func (l *Ledger) commit(tx *txStub) (uint64, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    for key, version := range tx.reads {
+        if l.state[key].version != version {
+            return 0, fmt.Errorf("transaction %s invalidated: MVCC_READ_CONFLICT on key %q", tx.txID, key)
+        }
+    }
+    for _, r := range tx.ranges {
+        if !l.rangeUnchanged(r) {
+            return 0, fmt.Errorf("transaction %s invalidated: PHANTOM_READ_CONFLICT in range [%q, %q)", tx.txID, r.start, r.end)
+        }
+    }
+
+    l.height++
+    for key, value := range tx.writes {
+        i := sort.SearchStrings(l.keys, key)
+        exists := i < len(l.keys) && l.keys[i] == key
+        switch {
+        case value == nil && exists:
+            delete(l.state, key)
+            l.keys = append(l.keys[:i], l.keys[i+1:]...)
+        case value != nil:
+            l.state[key] = entry{value: value, version: l.height}
+            if !exists {
+                l.keys = append(l.keys, "")
+                copy(l.keys[i+1:], l.keys[i:])
+                l.keys[i] = key
+            }
+        }
+    }
+    if tx.event != nil {
+        l.enqueue(&Event{BlockNumber: l.height, TxID: tx.txID, Name: tx.event.EventName, Payload: tx.event.Payload})
+    }
+    return l.height, nil
+}
+
+// rangeUnchanged reports whether a range query would still return the same keys at the
+// same versions; called with l.mu held
+func (l *Ledger) rangeUnchanged(r rangeRead) bool {
+    n := 0
+    for i := sort.SearchStrings(l.keys, r.start); i < len(l.keys); i++ {
+        key := l.keys[i]
+        if r.end != "" && key >= r.end {
+            break
+        }
+        if n == len(r.keys) || r.keys[n] != key || r.versions[n] != l.state[key].version {
+            return false
+        }
+        n++
+    }
+    return n == len(r.keys)
+}
+
+// enqueue queues an event for delivery; called with l.mu held, so events are queued in
+// block order
+func (l *Ledger) enqueue(ev *Event) {
+    l.qmu.Lock()
+    defer l.qmu.Unlock()
+    if l.closed {
+        return
+    }
+    l.queue = append(l.queue, ev)
+    l.pending++
+    l.qcond.Broadcast()
+}
@@ -0,0 +1,163 @@
+package simulation
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "fmt"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "bim/chaincode"
+    "bim/chaincodetest"
+    "bim/mapping"
+
+    "github.com/golang/protobuf/ptypes/timestamp"
+    "github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Network is the BIM chaincode deployed on a Ledger. Submit and Evaluate may be called
+// from any number of goroutines.
+type Network struct {
+    Ledger *Ledger
+    // Now gives the transaction timestamps; time.Now when nil
+    Now func() time.Time
+
+    cc    *contractapi.ContractChaincode
+    seq   uint64
+    mu    sync.Mutex
+    creds map[string]*chaincodetest.Credential
+}
+
+// Result is the outcome of a committed transaction
+type Result struct {
+    TxID        string
+    BlockNumber uint64
+    Payload     []byte // the function's return value as contractapi serializes it
+}
+
+// NewNetwork deploys the contracts of chaincode.Contracts on ledger
+func NewNetwork(ledger *Ledger) (*Network, error) {
+    cc, err := contractapi.NewChaincode(chaincode.Contracts()...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create chaincode: %v", err)
+    }
+    return &Network{Ledger: ledger, cc: cc, creds: map[string]*chaincodetest.Credential{}}, nil
+}
+
+// Submit executes function as id and commits the result. function is "Contract:Function"
+// or a function of the default SmartContract. A transaction that loses an MVCC race
+// fails with an error containing MVCC_READ_CONFLICT or PHANTOM_READ_CONFLICT.
+func (n *Network) Submit(id chaincodetest.Identity, function string, args ...string) (*Result, error) {
+    stub, payload, err := n.execute(id, function, args)
+    if err != nil {
+        return nil, err
+    }
+    block, err := n.Ledger.commit(stub)
+    if err != nil {
+        return nil, err
+    }
+    return &Result{TxID: stub.txID, BlockNumber: block, Payload: payload}, nil
+}
+
+// Evaluate executes function as id without committing, like a query
+func (n *Network) Evaluate(id chaincodetest.Identity, function string, args ...string) ([]byte, error) {
+    _, payload, err := n.execute(id, function, args)
+    return payload, err
+}
+
+func (n *Network) execute(id chaincodetest.Identity, function string, args []string) (*txStub, []byte, error) {
+    cred, err := n.credential(id)
+    if err != nil {
+        return nil, nil, err
+    }
+    now := time.Now()
+    if n.Now != nil {
+        now = n.Now()
+    }
+    txID := n.newTxID(cred.Creator())
+    signed, err := cred.SignProposal(txID)
+    if err != nil {
+        return nil, nil, err
+    }
+    stub := &txStub{
+        ledger:    n.Ledger,
+        txID:      txID,
+        args:      append([]string{function}, args...),
+        timestamp: &timestamp.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())},
+        creator:   cred.Creator(),
+        signed:    signed,
+        reads:     map[string]uint64{},
+        writes:    map[string][]byte{},
+    }
+    resp := n.cc.Invoke(stub)
+    if resp.Status >= 400 {
+        return nil, nil, fmt.Errorf("%s failed: %s", function, resp.Message)
+    }
+    return stub, resp.Payload, nil
+}
+
+// newTxID derives a transaction ID from the creator and a sequence number, in the hex
+// format of Fabric transaction IDs
+func (n *Network) newTxID(creator []byte) string {
+    var seq [8]byte
+    binary.BigEndian.PutUint64(seq[:], atomic.AddUint64(&n.seq, 1))
+    sum := sha256.Sum256(append(seq[:], creator...))
+    return hex.EncodeToString(sum[:])
+}
+
+// credential returns the cached certificate of id, issuing it on first use so that
+// cid.GetID stays the same for the identity
+func (n *Network) credential(id chaincodetest.Identity) (*chaincodetest.Credential, error) {
+    key := id.MSPID + "/" + id.Name
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    if c, ok := n.creds[key]; ok {
+        return c, nil
+    }
+    c, err := chaincodetest.NewCredential(id)
+    if err != nil {
+        return nil, err
+    }
+    n.creds[key] = c
+    return c, nil
+}
+
+// Invoker returns a mapping.ChannelInvoker that submits as id, for the mapping suite's
+// RoutedSubmitter. The node and chaincode arguments only have to name this ledger's
+// channel; the mapping suite chooses them from its node table.
+func (n *Network) Invoker(id chaincodetest.Identity) mapping.ChannelInvoker {
+    return invoker{network: n, id: id}
+}
+
+type invoker struct {
+    network *Network
+    id      chaincodetest.Identity
+}
+
+func (i invoker) Invoke(ctx context.Context, node *mapping.NodeMapping, chaincode string, function string, args ...[]byte) ([]byte, error) {
+    if err := ctx.Err(); err != nil {
+        return nil, err
+    }
+    if node.Channel != "" && node.Channel != i.network.Ledger.channel {
+        return nil, fmt.Errorf("channel %s is not simulated (only %s)", node.Channel, i.network.Ledger.channel)
+    }
+    strArgs := make([]string, len(args))
+    for k, a := range args {
+        strArgs[k] = string(a)
+    }
+    result, err := i.network.Submit(i.id, function, strArgs...)
+    if err != nil {
+        return nil, err
+    }
+    return result.Payload, nil
+}
+
+// IsConflict reports whether err is an MVCC or phantom read conflict, after which the
+// transaction can be submitted again
+func IsConflict(err error) bool {
+    return err != nil && strings.Contains(err.Error(), "_READ_CONFLICT")
+}
@@ -0,0 +1,68 @@
+package simulation
+
+import (
+    "context"
+    "encoding/json"
+    "testing"
+
+    "bim/mapping"
+)
+
+// TestSubmitInitBIMUpdate submits a packaged mapping transaction to the real contracts
+// and reads the stored update back
+func TestSubmitInitBIMUpdate(t *testing.T) {
+    ledger := NewLedger("mychannel")
+    defer ledger.Close()
+    network, err := NewNetwork(ledger)
+    if err != nil {
+        t.Fatal(err)
+    }
+    modeler, err := NewPipeline(network).participant("test-modeler", "modeler", departments()[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ctx := context.Background()
+    info, err := mapping.ProcessInitialInfo(ctx, "M-1.ifc", syntheticModel(1, "M-1", "1.0", 4096))
+    if err != nil {
+        t.Fatal(err)
+    }
+    user := &mapping.UserInfo{UserID: modeler.id.Name, Department: modeler.department, Role: "modeler"}
+    tx, err := mapping.PackageTransaction(ctx, user, info)
+    if err != nil {
+        t.Fatal(err)
+    }
+    meta := mapping.UpdateMeta{ModelID: "M-1", Version: "1.0", Description: "first issue"}
+    _, result, err := modeler.submitter.Submit(ctx, tx, meta)
+    if err != nil {
+        t.Fatal(err)
+    }
+    updateID := string(result)
+
+    payload, err := network.Evaluate(modeler.id, "ReadUpdate", updateID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var update mapping.LedgerUpdate
+    if err := json.Unmarshal(payload, &update); err != nil {
+        t.Fatal(err)
+    }
+    if update.ModelID != "M-1" || update.Version != "1.0" || update.Description != "first issue" {
+        t.Errorf("update = %s %s %q, want M-1 1.0 \"first issue\"", update.ModelID, update.Version, update.Description)
+    }
+    if len(update.Files) != 1 || update.Files[0].CID != info.CID || update.Files[0].Hash != info.FileHash {
+        t.Errorf("Files = %+v, want the model file %s", update.Files, info.CID)
+    }
+    if update.ClientRequestID != tx.TxID {
+        t.Errorf("ClientRequestID = %q, want %q", update.ClientRequestID, tx.TxID)
+    }
+
+    // the transaction ID makes a resubmission idempotent
+    _, again, err := modeler.submitter.Submit(ctx, tx, meta)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(again) != updateID {
+        t.Errorf("resubmission returned %s, want %s", again, updateID)
+    }
+}
@@ -0,0 +1,344 @@
+package simulation
+
+import (
+    "context"
+    "fmt"
+    "math/rand"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+
+    "bim/chaincodetest"
+    "bim/mapping"
+)
+
+// Phases of a cycle, the keys of Report.Latency
+const (
+    PhaseUpload  = "upload"  // mapping suite: hash, store and package the model file
+    PhaseInit    = "init"    // InitBIMUpdate
+    PhaseApprove = "approve" // one ApproveBIMUpdate vote
+    PhasePublish = "publish" // PublishBIMUpdate
+    PhaseCycle   = "cycle"   // the whole cycle
+)
+
+// simChaincode is the chaincode name the mapping suite's submitters are given
+const simChaincode = "bim"
+
+// Scenario describes a simulation run
+type Scenario struct {
+    Cycles    int  // init/approve cycles, default 1000
+    Workers   int  // concurrent modelers, default 8
+    Models    int  // models the cycles are spread over, default Workers
+    Reviewers int  // approving votes per update; sets the default approval threshold, default 1
+    FileSize  int  // bytes of the synthetic model file, default 64 KiB
+    Publish   bool // publish every approved update
+    // Retries is how often a transaction is submitted again after an MVCC conflict,
+    // default 3; negative never retries
+    Retries int
+    Seed    int64 // varies the synthetic model files
+}
+
+func (s *Scenario) applyDefaults() {
+    if s.Cycles <= 0 {
+        s.Cycles = 1000
+    }
+    if s.Workers <= 0 {
+        s.Workers = 8
+    }
+    if s.Models <= 0 {
+        s.Models = s.Workers
+    }
+    if s.Reviewers <= 0 {
+        s.Reviewers = 1
+    }
+    if s.FileSize <= 0 {
+        s.FileSize = 64 << 10
+    }
+    if s.Retries == 0 {
+        s.Retries = 3
+    } else if s.Retries < 0 {
+        s.Retries = 0
+    }
+}
+
+// Report summarizes a run
+type Report struct {
+    Scenario  Scenario
+    Completed int // cycles that ran every phase
+    Failed    int
+    Conflicts int // MVCC and phantom read conflicts, including retried ones
+    Blocks    uint64
+    Keys      int    // world state keys at the end
+    Events    uint64 // events delivered to the subscribed handlers
+    // HandlerErrors counts event handler calls that returned an error
+    HandlerErrors uint64
+    Elapsed       time.Duration
+    Latency       map[string]Latency
+    // Errors holds the first error of each failed cycle, at most 20
+    Errors []string
+}
+
+// Throughput returns completed cycles per second
+func (r *Report) Throughput() float64 {
+    if r.Elapsed <= 0 {
+        return 0
+    }
+    return float64(r.Completed) / r.Elapsed.Seconds()
+}
+
+// Latency is the distribution of one phase's durations
+type Latency struct {
+    Count int
+    Mean  time.Duration
+    P50   time.Duration
+    P95   time.Duration
+    P99   time.Duration
+    Max   time.Duration
+}
+
+func newLatency(samples []time.Duration) Latency {
+    if len(samples) == 0 {
+        return Latency{}
+    }
+    sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+    var total time.Duration
+    for _, d := range samples {
+        total += d
+    }
+    at := func(q float64) time.Duration { return samples[int(q*float64(len(samples)-1))] }
+    return Latency{
+        Count: len(samples),
+        Mean:  total / time.Duration(len(samples)),
+        P50:   at(0.50),
+        P95:   at(0.95),
+        P99:   at(0.99),
+        Max:   samples[len(samples)-1],
+    }
+}
+
+// Pipeline runs init/approve cycles through the mapping suite against a Network.
+//
+// The mapping suite uses its global configuration: the node table of CurrentConfig
+// decides the departments (the default one has architecture, structure, me and
+// management) and the MSP of each identity (OrgName + "MSP"). NewPipeline switches the
+// storage backend to a mapping.MemoryBackend.
+type Pipeline struct {
+    Network *Network
+    Storage *mapping.MemoryBackend
+
+    mu      sync.Mutex
+    samples map[string][]time.Duration
+}
+
+// NewPipeline creates a pipeline on network
+func NewPipeline(network *Network) *Pipeline {
+    storage := mapping.NewMemoryBackend()
+    mapping.UseStorageBackend(storage)
+    return &Pipeline{Network: network, Storage: storage}
+}
+
+// participant is a simulated user and the submitter that carries their transactions
+type participant struct {
+    id         chaincodetest.Identity
+    department string
+    submitter  *mapping.RoutedSubmitter
+}
+
+func (p *Pipeline) participant(name string, role string, department string) (*participant, error) {
+    node, err := mapping.MapToBlockchainNode(department)
+    if err != nil {
+        return nil, err
+    }
+    id := chaincodetest.Identity{
+        MSPID: node.OrgName + "MSP",
+        Name:  name,
+        Attrs: map[string]string{"role": role, "department": department},
+    }
+    return &participant{
+        id:         id,
+        department: department,
+        submitter:  mapping.NewRoutedSubmitter(p.Network.Invoker(id), simChaincode),
+    }, nil
+}
+
+// departments returns the departments of the mapping suite's node table, sorted
+func departments() []string {
+    var result []string
+    for dept := range mapping.CurrentConfig().Nodes {
+        result = append(result, dept)
+    }
+    sort.Strings(result)
+    return result
+}
+
+// Run executes the scenario and waits until the events of all committed transactions
+// were delivered to the ledger's handlers. Cancelling ctx stops starting new cycles.
+func (p *Pipeline) Run(ctx context.Context, sc Scenario) (*Report, error) {
+    sc.applyDefaults()
+    depts := departments()
+    if len(depts) == 0 {
+        return nil, fmt.Errorf("the mapping configuration has no nodes")
+    }
+
+    admin, err := p.participant("sim-admin", "admin", depts[0])
+    if err != nil {
+        return nil, err
+    }
+    if sc.Reviewers > 1 {
+        if _, err := p.Network.Submit(admin.id, "ConfigContract:SetDefaultApprovalThreshold", strconv.Itoa(sc.Reviewers)); err != nil {
+            return nil, err
+        }
+    }
+    lead, err := p.participant("sim-lead", "bim_lead", depts[0])
+    if err != nil {
+        return nil, err
+    }
+    reviewers := make([]*participant, sc.Reviewers)
+    for i := range reviewers {
+        if reviewers[i], err = p.participant(fmt.Sprintf("sim-reviewer%d", i+1), "professional", depts[(i+1)%len(depts)]); err != nil {
+            return nil, err
+        }
+    }
+    modelers := make([]*participant, sc.Workers)
+    for i := range modelers {
+        if modelers[i], err = p.participant(fmt.Sprintf("sim-modeler%d", i+1), "modeler", depts[i%len(depts)]); err != nil {
+            return nil, err
+        }
+    }
+
+    p.samples = map[string][]time.Duration{}
+    report := &Report{Scenario: sc}
+    var reportMu sync.Mutex
+    cycles := make(chan int)
+    var wg sync.WaitGroup
+    start := time.Now()
+    for w := 0; w < sc.Workers; w++ {
+        wg.Add(1)
+        go func(modeler *participant) {
+            defer wg.Done()
+            for i := range cycles {
+                conflicts, err := p.cycle(ctx, sc, i, modeler, reviewers, lead)
+                reportMu.Lock()
+                report.Conflicts += conflicts
+                if err != nil {
+                    report.Failed++
+                    if len(report.Errors) < 20 {
+                        report.Errors = append(report.Errors, fmt.Sprintf("cycle %d: %v", i, err))
+                    }
+                } else {
+                    report.Completed++
+                }
+                reportMu.Unlock()
+            }
+        }(modelers[w])
+    }
+    for i := 0; i < sc.Cycles && ctx.Err() == nil; i++ {
+        cycles <- i
+    }
+    close(cycles)
+    wg.Wait()
+    p.Network.Ledger.Sync()
+    report.Elapsed = time.Since(start)
+
+    report.Blocks = p.Network.Ledger.Height()
+    report.Keys = p.Network.Ledger.Len()
+    report.Events, report.HandlerErrors = p.Network.Ledger.Delivered()
+    report.Latency = map[string]Latency{}
+    for phase, samples := range p.samples {
+        report.Latency[phase] = newLatency(samples)
+    }
+    return report, ctx.Err()
+}
+
+// cycle uploads and submits one model version, approves it and optionally publishes it.
+// It returns the number of conflicts it retried.
+func (p *Pipeline) cycle(ctx context.Context, sc Scenario, i int, modeler *participant, reviewers []*participant, lead *participant) (int, error) {
+    cycleStart := time.Now()
+    modelID := fmt.Sprintf("SIM-%04d", i%sc.Models+1)
+    version := fmt.Sprintf("1.%d", i/sc.Models)
+
+    start := time.Now()
+    content := syntheticModel(sc.Seed+int64(i), modelID, version, sc.FileSize)
+    info, err := mapping.ProcessInitialInfo(ctx, modelID+".ifc", content)
+    if err != nil {
+        return 0, err
+    }
+    user := &mapping.UserInfo{UserID: modeler.id.Name, Department: modeler.department, Role: "modeler"}
+    tx, err := mapping.PackageTransaction(ctx, user, info)
+    if err != nil {
+        return 0, err
+    }
+    meta := mapping.UpdateMeta{ModelID: modelID, Version: version, Description: "simulated update " + tx.TxID}
+    p.record(PhaseUpload, time.Since(start))
+
+    conflicts := 0
+    retry := func(phase string, send func() ([]byte, error)) ([]byte, error) {
+        for attempt := 0; ; attempt++ {
+            start := time.Now()
+            result, err := send()
+            if err == nil {
+                p.record(phase, time.Since(start))
+                return result, nil
+            }
+            if !IsConflict(err) {
+                return nil, err
+            }
+            conflicts++
+            if attempt == sc.Retries {
+                return nil, err
+            }
+        }
+    }
+    submit := func(phase string, who *participant, function string, args ...string) ([]byte, error) {
+        raw := make([][]byte, len(args))
+        for k, a := range args {
+            raw[k] = []byte(a)
+        }
+        return retry(phase, func() ([]byte, error) {
+            _, result, err := who.submitter.SubmitArgs(ctx, who.department, "", function, raw...)
+            return result, err
+        })
+    }
+
+    // the update goes through the mapping suite's Transaction -> BIMUpdate conversion
+    result, err := retry(PhaseInit, func() ([]byte, error) {
+        _, result, err := modeler.submitter.Submit(ctx, tx, meta)
+        return result, err
+    })
+    if err != nil {
+        return conflicts, err
+    }
+    updateID := string(result)
+    for _, r := range reviewers {
+        if _, err := submit(PhaseApprove, r, "ApprovalContract:ApproveBIMUpdate", updateID, "APPROVED", "simulated review", ""); err != nil {
+            return conflicts, err
+        }
+    }
+    if sc.Publish {
+        if _, err := submit(PhasePublish, lead, "ApprovalContract:PublishBIMUpdate", updateID); err != nil {
+            return conflicts, err
+        }
+    }
+    p.record(PhaseCycle, time.Since(cycleStart))
+    return conflicts, nil
+}
+
+func (p *Pipeline) record(phase string, d time.Duration) {
+    p.mu.Lock()
+    p.samples[phase] = append(p.samples[phase], d)
+    p.mu.Unlock()
+}
+
+// syntheticModel returns an IFC-like file of size bytes, different for every seed
+func syntheticModel(seed int64, modelID string, version string, size int) []byte {
+    header := fmt.Sprintf("ISO-10303-21;\nHEADER;\nFILE_NAME('%s.ifc','%s');\nENDSEC;\nDATA;\n", modelID, version)
+    content := make([]byte, size)
+    n := copy(content, header)
+    rng := rand.New(rand.NewSource(seed))
+    const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789#=(),.;'\n"
+    for k := n; k < size; k++ {
+        content[k] = alphabet[rng.Intn(len(alphabet))]
+    }
+    return content
+}
@@ -0,0 +1,244 @@
+package simulation
+
+import (
+    "fmt"
+    "strings"
+    "unicode/utf8"
+
+    "github.com/golang/protobuf/ptypes/timestamp"
+    "github.com/hyperledger/fabric-chaincode-go/shim"
+    "github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+    pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const (
+    // compositeKeyNamespace starts every composite key, as in the Fabric shim
+    compositeKeyNamespace = "\x00"
+    // emptyKeySubstitute replaces an empty start key of a range query, so ranges over
+    // simple keys never include composite keys
+    emptyKeySubstitute = "\x01"
+)
+
+// txStub is the stub of one transaction. It implements the subset of
+// shim.ChaincodeStubInterface the contracts use; the other methods come from the nil
+// embedded interface and panic, which points at the method to add here.
+//
+// Like a peer, reads see the committed state only, not the transaction's own writes.
+// Every key read and every range scanned is recorded for the MVCC check at commit.
+type txStub struct {
+    shim.ChaincodeStubInterface
+
+    ledger    *Ledger
+    txID      string
+    args      []string // function name first
+    timestamp *timestamp.Timestamp
+    creator   []byte
+    signed    *pb.SignedProposal
+
+    reads  map[string]uint64 // key -> version read, 0 when absent
+    ranges []rangeRead
+    writes map[string][]byte // nil value deletes the key
+    event  *pb.ChaincodeEvent
+}
+
+// rangeRead is a range query's result, checked again for phantoms at commit
+type rangeRead struct {
+    start, end string
+    keys       []string
+    versions   []uint64
+}
+
+func (s *txStub) GetTxID() string {
+    return s.txID
+}
+
+func (s *txStub) GetChannelID() string {
+    return s.ledger.channel
+}
+
+func (s *txStub) GetArgs() [][]byte {
+    args := make([][]byte, len(s.args))
+    for i, a := range s.args {
+        args[i] = []byte(a)
+    }
+    return args
+}
+
+func (s *txStub) GetStringArgs() []string {
+    return s.args
+}
+
+func (s *txStub) GetFunctionAndParameters() (string, []string) {
+    if len(s.args) == 0 {
+        return "", nil
+    }
+    return s.args[0], s.args[1:]
+}
+
+func (s *txStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+    return s.timestamp, nil
+}
+
+func (s *txStub) GetCreator() ([]byte, error) {
+    return s.creator, nil
+}
+
+func (s *txStub) GetSignedProposal() (*pb.SignedProposal, error) {
+    return s.signed, nil
+}
+
+func (s *txStub) GetState(key string) ([]byte, error) {
+    if key == "" {
+        return nil, fmt.Errorf("key must not be an empty string")
+    }
+    value, version := s.ledger.get(key)
+    if _, ok := s.reads[key]; !ok {
+        s.reads[key] = version
+    }
+    return value, nil
+}
+
+func (s *txStub) PutState(key string, value []byte) error {
+    if key == "" {
+        return fmt.Errorf("key must not be an empty string")
+    }
+    if value == nil {
+        value = []byte{}
+    }
+    s.writes[key] = value
+    return nil
+}
+
+func (s *txStub) DelState(key string) error {
+    if key == "" {
+        return fmt.Errorf("key must not be an empty string")
+    }
+    s.writes[key] = nil
+    return nil
+}
+
+// SetEvent replaces the transaction's event; a peer only keeps the last one
+func (s *txStub) SetEvent(name string, payload []byte) error {
+    if name == "" {
+        return fmt.Errorf("event name can not be empty string")
+    }
+    s.event = &pb.ChaincodeEvent{TxId: s.txID, EventName: name, Payload: payload}
+    return nil
+}
+
+func (s *txStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+    if err := validateCompositeKeyPart(objectType); err != nil {
+        return "", err
+    }
+    key := compositeKeyNamespace + objectType + "\x00"
+    for _, attr := range attributes {
+        if err := validateCompositeKeyPart(attr); err != nil {
+            return "", err
+        }
+        key += attr + "\x00"
+    }
+    return key, nil
+}
+
+func (s *txStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+    if !strings.HasPrefix(compositeKey, compositeKeyNamespace) || !strings.HasSuffix(compositeKey, "\x00") {
+        return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+    }
+    parts := strings.Split(compositeKey[1:len(compositeKey)-1], "\x00")
+    return parts[0], parts[1:], nil
+}
+
+func (s *txStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+    iterator, _, err := s.GetStateByRangeWithPagination(startKey, endKey, 0, "")
+    return iterator, err
+}
+
+func (s *txStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+    for _, key := range []string{startKey, endKey} {
+        if strings.HasPrefix(key, compositeKeyNamespace) {
+            return nil, nil, fmt.Errorf("range query bound %q is a composite key", key)
+        }
+    }
+    if startKey == "" {
+        startKey = emptyKeySubstitute
+    }
+    return s.query(startKey, endKey, pageSize, bookmark)
+}
+
+func (s *txStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+    iterator, _, err := s.GetStateByPartialCompositeKeyWithPagination(objectType, keys, 0, "")
+    return iterator, err
+}
+
+func (s *txStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+    prefix, err := s.CreateCompositeKey(objectType, keys)
+    if err != nil {
+        return nil, nil, err
+    }
+    return s.query(prefix, prefix+string(utf8.MaxRune), pageSize, bookmark)
+}
+
+// GetQueryResultWithPagination fails: rich queries need CouchDB, and the simulated
+// ledger behaves like LevelDB
+func (s *txStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+    return nil, nil, fmt.Errorf("rich queries are not supported by the simulated state database")
+}
+
+// query scans [start, end) from bookmark on and records the scan for the phantom check.
+// The bookmark is the first key of the next page, "" after the last page.
+func (s *txStub) query(start, end string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+    if bookmark != "" {
+        if bookmark < start || (end != "" && bookmark >= end) {
+            return nil, nil, fmt.Errorf("bookmark %q is outside the queried range", bookmark)
+        }
+        start = bookmark
+    }
+    kvs, versions, next := s.ledger.scan(start, end, int(pageSize))
+    meta := &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(kvs))}
+    r := rangeRead{start: start, end: end, versions: versions}
+    for _, kv := range kvs {
+        r.keys = append(r.keys, kv.Key)
+    }
+    if next != "" {
+        // the page ends before next; later keys are not part of the read set
+        r.end = next
+        meta.Bookmark = next
+    }
+    s.ranges = append(s.ranges, r)
+    return &sliceIterator{kvs: kvs}, meta, nil
+}
+
+func validateCompositeKeyPart(part string) error {
+    if !utf8.ValidString(part) {
+        return fmt.Errorf("not a valid utf8 string: %q", part)
+    }
+    for _, r := range part {
+        if r == 0 || r == utf8.MaxRune {
+            return fmt.Errorf("input contains unicode %#U starting at position [%d], which is not allowed", r, strings.IndexRune(part, r))
+        }
+    }
+    return nil
+}
+
+// sliceIterator iterates over results already read into memory
+type sliceIterator struct {
+    kvs []*queryresult.KV
+    pos int
+}
+
+func (it *sliceIterator) HasNext() bool {
+    return it.pos < len(it.kvs)
+}
+
+func (it *sliceIterator) Next() (*queryresult.KV, error) {
+    if !it.HasNext() {
+        return nil, fmt.Errorf("no more results")
+    }
+    kv := it.kvs[it.pos]
+    it.pos++
+    return kv, nil
+}
+
+func (it *sliceIterator) Close() error {
+    return nil
+}